@@ -2,13 +2,27 @@ package agent
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"assistant_agent/internal/api"
+	"assistant_agent/internal/audit"
 	"assistant_agent/internal/config"
+	"assistant_agent/internal/container"
 	"assistant_agent/internal/executor"
+	"assistant_agent/internal/grpc"
 	"assistant_agent/internal/heartbeat"
 	"assistant_agent/internal/logger"
 	"assistant_agent/internal/plugin"
@@ -18,11 +32,21 @@ import (
 	"assistant_agent/internal/plugin/scheduler"
 	"assistant_agent/internal/plugin/software"
 	"assistant_agent/internal/plugin/updater"
+	"assistant_agent/internal/scripts"
 	"assistant_agent/internal/state"
 	"assistant_agent/internal/sysinfo"
 	"assistant_agent/internal/websocket"
 )
 
+// Transport 与服务器通信的传输层
+type Transport interface {
+	Connect() error
+	Receive() (string, interface{}, error)
+	Send(msgType string, data interface{}) error
+	SendCommandResult(result interface{}) error
+	Stop()
+}
+
 // Agent 主代理结构
 type Agent struct {
 	config *config.Config
@@ -31,16 +55,39 @@ type Agent struct {
 	wg     sync.WaitGroup
 
 	// 核心组件
-	stateMgr  *state.Manager
-	heartbeat *heartbeat.Heartbeat
-	wsClient  *websocket.Client
-	pluginMgr *plugin.Manager
-	sysinfo   *sysinfo.Collector
-	executor  *executor.Executor
+	stateMgr   *state.Manager
+	settings   *state.Settings
+	heartbeat  *heartbeat.Heartbeat
+	transport  Transport
+	pluginMgr  *plugin.Manager
+	sysinfo    *sysinfo.Collector
+	executor   *executor.Executor
+	cmdQueue   *executor.Queue
+	containers *container.Manager
+	scripts    *scripts.Store
+	auditor    *audit.Recorder
+	apiServer  *api.Server
 
 	// 状态
-	running bool
-	mu      sync.RWMutex
+	running   bool
+	mu        sync.RWMutex
+	connState string
+	connMu    sync.RWMutex
+
+	// 系统信息上报
+	sysinfoNow chan struct{} // 立即上报一次，如重新连接后
+	staticHash string        // 最近一次成功发送的静态信息摘要
+	sysinfoMu  sync.Mutex
+
+	// 上次运行未正常退出时的恢复信息，连接建立后上报一次
+	recovery   *state.Recovery
+	recoveryMu sync.Mutex
+
+	// 配置热加载
+	heartbeatReset chan struct{} // 心跳间隔变化后通知心跳循环重置定时器
+	configCancel   func()        // 取消配置变化订阅
+
+	stopShipping func() // 停止日志上报
 }
 
 // New 创建新的 Agent 实例
@@ -67,8 +114,27 @@ func New() (*Agent, error) {
 func (a *Agent) initComponents() error {
 	var err error
 
+	// 初始化审计日志
+	if a.config.Audit.Enabled {
+		a.auditor, err = audit.NewRecorder(filepath.Join(a.config.Agent.DataDir, a.config.Audit.File))
+		if err != nil {
+			return err
+		}
+	}
+
 	// 初始化状态管理器
-	a.stateMgr, err = state.NewManager(a.config.Agent.DataDir)
+	a.stateMgr, err = state.NewManagerWithBackend(a.config.Agent.DataDir, a.config.Agent.StateBackend)
+	if err != nil {
+		return err
+	}
+	if mode := a.config.Agent.JournalSync; mode != "" {
+		if err := a.stateMgr.SetJournalSync(mode); err != nil {
+			return err
+		}
+	}
+
+	// 加载插件写入的动态配置
+	a.settings, err = state.OpenSettings(a.config.Agent.DataDir)
 	if err != nil {
 		return err
 	}
@@ -78,18 +144,31 @@ func (a *Agent) initComponents() error {
 	if err != nil {
 		return err
 	}
+	a.heartbeat.SetAdaptive(a.config.Agent.HeartbeatAdaptive, a.config.Agent.HeartbeatMin, a.config.Agent.HeartbeatMax)
 
-	// 初始化 WebSocket 客户端
-	a.wsClient, err = websocket.NewClient(a.config.Server.URL, a.config.Security.Token)
+	// 初始化通信客户端
+	a.transport, err = newTransport(a.config)
 	if err != nil {
 		return err
 	}
+	if client, ok := a.transport.(*websocket.Client); ok {
+		client.OnStateChange(a.onConnectionState)
+	}
+
+	// 审计事件转发到服务器
+	if a.auditor != nil && a.config.Audit.Forward {
+		a.auditor.SetForwarder(func(event *audit.Event) error {
+			return a.transport.Send("audit_event", event)
+		})
+	}
 
 	// 初始化系统信息收集器
 	a.sysinfo, err = sysinfo.NewCollector()
 	if err != nil {
 		return err
 	}
+	a.sysinfo.SetContainerMode(a.config.Agent.ContainerMode)
+	a.sysinfo.SetNetworkEnv(a.config.Agent.NetworkEnv, a.config.Agent.PublicIPURL)
 
 	// 初始化命令执行器
 	a.executor, err = executor.New(a.config.Agent.WorkDir, a.config.Agent.TempDir)
@@ -97,14 +176,78 @@ func (a *Agent) initComponents() error {
 		return err
 	}
 
+	// 设置输出捕获选项
+	a.executor.SetOutputOptions(a.config.Agent.MaxOutputSize, a.config.Agent.CombinedOutput)
+
+	// 初始化命令执行历史
+	history, err := executor.NewHistory(a.config.Agent.DataDir, a.config.Agent.HistoryMax)
+	if err != nil {
+		return err
+	}
+	a.executor.SetHistory(history)
+
+	// 注册脚本解释器配置
+	for name, cfg := range a.config.Agent.Interpreters {
+		a.executor.RegisterInterpreter(name, &executor.Interpreter{
+			Extension: cfg.Extension,
+			Timeout:   cfg.Timeout,
+			Env:       cfg.Env,
+		})
+	}
+
+	// 设置命令安全策略
+	if policy := a.config.Security.CommandPolicy; policy.Enabled {
+		if err := a.executor.SetPolicy(&executor.Policy{
+			AllowBinaries:   policy.AllowBinaries,
+			DenyBinaries:    policy.DenyBinaries,
+			DenyPatterns:    policy.DenyPatterns,
+			ConfirmPatterns: policy.ConfirmPatterns,
+			ForbiddenPaths:  policy.ForbiddenPaths,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// 初始化脚本库
+	a.scripts, err = scripts.NewStore(filepath.Join(a.config.Agent.DataDir, "scripts"))
+	if err != nil {
+		return err
+	}
+	a.executor.SetScripts(a.scripts)
+
+	// 初始化命令队列
+	a.cmdQueue = executor.NewQueue(a.executor, a.config.Agent.CommandWorkers, a.config.Agent.CommandQueueSize, a.sendCommandResult)
+
+	// 初始化容器管理器
+	a.containers = container.NewManager(a.config.Agent.ContainerRuntime)
+
 	// 初始化插件管理器
 	a.pluginMgr = plugin.NewManager(a, a.config)
+	if pluginDir := a.externalPluginDir(); pluginDir != "" {
+		a.pluginMgr.SetExternalDir(pluginDir)
+	}
+	if a.config.Agent.PluginRegistry != "" {
+		if err := a.pluginMgr.SetRegistry(a.config.Agent.PluginRegistry, a.config.Agent.PluginRegistryKey); err != nil {
+			logger.Warnf("Plugin registry disabled: %v", err)
+		}
+	}
 
 	// 注册内置插件
 	if err := a.registerBuiltinPlugins(); err != nil {
 		logger.Warnf("Failed to register builtin plugins: %v", err)
 	}
 
+	// 初始化本地 HTTP API
+	if a.config.API.Enabled {
+		a.apiServer, err = api.NewServer(a.config.API, a, a.pluginMgr)
+		if err != nil {
+			return err
+		}
+		if a.auditor != nil {
+			a.apiServer.SetAuditor(a.auditor)
+		}
+	}
+
 	return nil
 }
 
@@ -123,24 +266,56 @@ func (a *Agent) Start() error {
 	if err := a.stateMgr.Start(); err != nil {
 		return err
 	}
+	if recovery := a.stateMgr.Recovery(); recovery != nil && recovery.Crashed {
+		a.recoveryMu.Lock()
+		a.recovery = recovery
+		a.recoveryMu.Unlock()
+	}
 
 	// 启动心跳检测
+	a.heartbeatReset = make(chan struct{}, 1)
 	a.wg.Add(1)
-	go a.runHeartbeat()
+	go a.runHeartbeat(a.heartbeatReset)
+
+	// 启动系统信息上报，先于服务器连接启动以便连接建立后立即上报
+	if a.config.Agent.SysinfoInterval > 0 && a.sysinfo != nil {
+		a.sysinfoNow = make(chan struct{}, 1)
+		a.wg.Add(1)
+		go a.runSysinfo(a.sysinfoNow)
+	}
 
-	// 启动 WebSocket 连接
+	// 启动服务器连接
 	a.wg.Add(1)
-	go a.runWebSocketClient()
+	go a.runTransport()
 
 	// 启动命令执行器
 	if err := a.executor.Start(); err != nil {
 		return err
 	}
+	a.cmdQueue.Start()
 
 	// 启动插件管理器
 	if err := a.pluginMgr.StartAll(); err != nil {
 		logger.Warnf("Failed to start some plugins: %v", err)
 	}
+	a.loadExternalPlugins()
+
+	// 启动本地 HTTP API
+	if a.apiServer != nil {
+		if err := a.apiServer.Start(); err != nil {
+			logger.Warnf("Failed to start API server: %v", err)
+		}
+	}
+
+	// 订阅配置热加载
+	a.configCancel = config.OnChange(a.applyConfig)
+
+	// 日志上报
+	if ship := a.config.Logging.Ship; ship.Enabled {
+		if err := a.startShipping(ship); err != nil {
+			logger.Warnf("Log shipping disabled: %v", err)
+		}
+	}
 
 	a.running = true
 	logger.Info("Assistant Agent started successfully")
@@ -159,12 +334,29 @@ func (a *Agent) Stop() {
 
 	logger.Info("Stopping Assistant Agent...")
 
+	// 取消配置变化订阅
+	if a.configCancel != nil {
+		a.configCancel()
+		a.configCancel = nil
+	}
+
+	// 停止日志上报，在断开连接前发送剩余的日志
+	if a.stopShipping != nil {
+		a.stopShipping()
+		a.stopShipping = nil
+	}
+
 	// 取消上下文
 	a.cancel()
 
-	// 停止 WebSocket 客户端
-	if a.wsClient != nil {
-		a.wsClient.Stop()
+	// 停止本地 HTTP API
+	if a.apiServer != nil {
+		a.apiServer.Stop()
+	}
+
+	// 停止通信客户端
+	if a.transport != nil {
+		a.transport.Stop()
 	}
 
 	// 停止心跳检测
@@ -177,6 +369,11 @@ func (a *Agent) Stop() {
 		a.stateMgr.Stop()
 	}
 
+	// 停止命令队列
+	if a.cmdQueue != nil {
+		a.cmdQueue.Stop()
+	}
+
 	// 停止命令执行器
 	if a.executor != nil {
 		a.executor.Stop()
@@ -194,8 +391,20 @@ func (a *Agent) Stop() {
 	logger.Info("Assistant Agent stopped")
 }
 
+// Restart 停止 Agent 后执行 replace（如用新版本替换当前进程）。
+// Agent 停止后无法恢复，replace 失败时以非零状态退出，由服务管理器重新启动
+func (a *Agent) Restart(replace func() error) error {
+	logger.Info("Restarting Assistant Agent...")
+	a.Stop()
+	if err := replace(); err != nil {
+		logger.Errorf("Failed to restart agent: %v", err)
+		os.Exit(1)
+	}
+	return nil
+}
+
 // runHeartbeat 运行心跳检测
-func (a *Agent) runHeartbeat() {
+func (a *Agent) runHeartbeat(reset <-chan struct{}) {
 	defer a.wg.Done()
 
 	ticker := time.NewTicker(time.Duration(a.config.Agent.Heartbeat) * time.Second)
@@ -204,61 +413,593 @@ func (a *Agent) runHeartbeat() {
 	for {
 		select {
 		case <-ticker.C:
+			// 先确定下一次的间隔，随本次心跳告知服务器
+			next := a.heartbeat.NextInterval(a.activeWork())
 			a.sendHeartbeat()
+			ticker.Reset(time.Duration(next) * time.Second)
+		case <-reset:
+			ticker.Reset(time.Duration(a.heartbeat.Adjust(a.activeWork())) * time.Second)
 		case <-a.ctx.Done():
 			return
 		}
 	}
 }
 
-// sendHeartbeat 发送心跳
+// applyConfig 应用热加载的配置：日志级别、心跳间隔和插件配置文件，其他配置需要重启 Agent 后生效
+func (a *Agent) applyConfig(old, cfg *config.Config) {
+	if cfg.Logging.Level != old.Logging.Level {
+		if err := logger.SetLevel(cfg.Logging.Level); err != nil {
+			logger.Warnf("Ignoring logging level %q: %v", cfg.Logging.Level, err)
+		} else {
+			logger.Infof("Logging level changed to %s", cfg.Logging.Level)
+		}
+	}
+
+	if !reflect.DeepEqual(cfg.Logging.Components, old.Logging.Components) {
+		if err := logger.SetComponentLevels(cfg.Logging.Components); err != nil {
+			logger.Warnf("Ignoring logging.components: %v", err)
+		} else {
+			logger.Infof("Component logging levels changed to %v", cfg.Logging.Components)
+		}
+	}
+
+	if cfg.Agent.Heartbeat != old.Agent.Heartbeat {
+		if cfg.Agent.Heartbeat <= 0 {
+			logger.Warnf("Ignoring heartbeat interval %d", cfg.Agent.Heartbeat)
+		} else if a.heartbeat != nil {
+			a.heartbeat.SetInterval(cfg.Agent.Heartbeat)
+			a.resetHeartbeat()
+			logger.Infof("Heartbeat interval changed to %ds", cfg.Agent.Heartbeat)
+		}
+	}
+
+	if cfg.Agent.HeartbeatAdaptive != old.Agent.HeartbeatAdaptive || cfg.Agent.HeartbeatMin != old.Agent.HeartbeatMin || cfg.Agent.HeartbeatMax != old.Agent.HeartbeatMax {
+		if cfg.Agent.HeartbeatAdaptive && (cfg.Agent.HeartbeatMin <= 0 || cfg.Agent.HeartbeatMax < cfg.Agent.HeartbeatMin) {
+			logger.Warnf("Ignoring adaptive heartbeat range %d-%ds", cfg.Agent.HeartbeatMin, cfg.Agent.HeartbeatMax)
+		} else if a.heartbeat != nil {
+			a.heartbeat.SetAdaptive(cfg.Agent.HeartbeatAdaptive, cfg.Agent.HeartbeatMin, cfg.Agent.HeartbeatMax)
+			a.resetHeartbeat()
+			logger.Infof("Adaptive heartbeat set to %v (%d-%ds)", cfg.Agent.HeartbeatAdaptive, cfg.Agent.HeartbeatMin, cfg.Agent.HeartbeatMax)
+		}
+	}
+
+	if a.pluginMgr != nil {
+		a.pluginMgr.SetMainConfigs(cfg.Plugins)
+		for _, name := range a.pluginMgr.ReloadConfigs() {
+			logger.Infof("Plugin config reloaded: %s", name)
+			if a.stateMgr != nil {
+				a.stateMgr.RecordEvent(state.JournalConfigChanged, map[string]interface{}{"plugin": name, "source": "reload"})
+			}
+		}
+	}
+}
+
+// runSysinfo 每隔 sysinfo_interval 秒收集一次系统信息，更新状态管理器并上报服务器
+func (a *Agent) runSysinfo(now <-chan struct{}) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(a.config.Agent.SysinfoInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.reportSystemInfo()
+		case <-now:
+			a.reportSystemInfo()
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// reportSystemInfo 收集并发送 system_info 消息。动态信息每次发送，
+// 静态信息（主机名、内核、网络接口等）只在变化后或重新连接后发送
+func (a *Agent) reportSystemInfo() {
+	info, err := a.sysinfo.Collect()
+	if err != nil {
+		logger.Warnf("Failed to collect system info: %v", err)
+		return
+	}
+	if a.stateMgr != nil {
+		a.stateMgr.UpdateSystemInfo(info)
+	}
+
+	static, dynamic := sysinfo.SplitStatic(info)
+	data, err := json.Marshal(static)
+	if err != nil {
+		logger.Warnf("Failed to encode system info: %v", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	payload := map[string]interface{}{
+		"agent_id":  a.agentID(),
+		"timestamp": time.Now(),
+		"dynamic":   dynamic,
+	}
+	a.sysinfoMu.Lock()
+	changed := hash != a.staticHash
+	a.sysinfoMu.Unlock()
+	if changed {
+		payload["static"] = static
+	}
+
+	if err := a.transport.Send("system_info", payload); err != nil {
+		logger.Warnf("Failed to send system info: %v", err)
+		return
+	}
+	if changed {
+		a.sysinfoMu.Lock()
+		a.staticHash = hash
+		a.sysinfoMu.Unlock()
+	}
+}
+
+// resendSystemInfo 重新连接后服务器可能没有保存静态信息，下次上报时重新发送并立即上报一次
+func (a *Agent) resendSystemInfo() {
+	a.sysinfoMu.Lock()
+	a.staticHash = ""
+	a.sysinfoMu.Unlock()
+
+	select {
+	case a.sysinfoNow <- struct{}{}:
+	default:
+	}
+}
+
+// resetHeartbeat 通知心跳循环按当前配置和活动状态重置定时器
+func (a *Agent) resetHeartbeat() {
+	select {
+	case a.heartbeatReset <- struct{}{}:
+	default:
+	}
+}
+
+// onActivity 收到命令或文件传输后调用，自适应心跳的当前间隔大于最小间隔时立即缩短，不必等到下一次心跳
+func (a *Agent) onActivity() {
+	if a.heartbeat == nil {
+		return
+	}
+	if current := a.heartbeat.EffectiveInterval(); a.heartbeat.Adjust(true) < current {
+		a.resetHeartbeat()
+	}
+}
+
+// activeWork 是否有执行中或排队的命令、进行中或排队的文件传输
+func (a *Agent) activeWork() bool {
+	if a.cmdQueue != nil && a.cmdQueue.Len() > 0 {
+		return true
+	}
+	if a.executor != nil && len(a.executor.ListRunningCommands()) > 0 {
+		return true
+	}
+	if a.pluginMgr != nil {
+		if status, err := a.pluginMgr.GetPluginStatus("file-transfer"); err == nil && status != nil {
+			for _, key := range []string{"active_transfers", "queued_transfers"} {
+				if count, ok := status.Metrics[key].(int); ok && count > 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// sendHeartbeat 发送包含状态摘要和系统资源快照的心跳，传输层支持 ping 时同时测量往返时间。
+// 连续失败（发送失败或服务器未响应 ping）达到上限时主动重连，首次达到上限时发布 server_unreachable 事件
 func (a *Agent) sendHeartbeat() {
+	err := a.transport.Send("heartbeat", a.heartbeatPayload())
+	if a.heartbeat == nil {
+		return
+	}
+	if err == nil {
+		err = a.pingServer()
+	}
+
+	maxFailures := a.config.Agent.HeartbeatFails
+	if err == nil {
+		if maxFailures > 0 && a.heartbeat.Failures() >= maxFailures {
+			logger.Info("Server is reachable again")
+		}
+		a.heartbeat.Beat()
+		a.SetGauge("heartbeat_misses", 0)
+		return
+	}
+
+	failures := a.heartbeat.Fail()
+	a.SetGauge("heartbeat_misses", float64(failures))
+	a.IncCounter("heartbeat_misses_total", 1)
+	logger.Warnf("Heartbeat failed (%d consecutive failures): %v", failures, err)
+
+	if maxFailures > 0 && failures%maxFailures == 0 {
+		if failures == maxFailures {
+			a.serverUnreachable(failures, err)
+		}
+		if reconnector, ok := a.transport.(interface{ Reconnect(cause error) }); ok {
+			reconnector.Reconnect(fmt.Errorf("%d consecutive heartbeat failures", failures))
+		}
+	}
+}
+
+// pingServer 传输层支持 ping 时等待服务器响应并记录往返时间，不支持时只以发送成功为准
+func (a *Agent) pingServer() error {
+	pinger, ok := a.transport.(interface {
+		Ping(timeout time.Duration) (time.Duration, error)
+	})
+	if !ok {
+		return nil
+	}
+
+	// 等待时间不超过心跳间隔，避免拖延下一次心跳
+	timeout := time.Duration(a.config.Agent.HeartbeatTimeout) * time.Second
+	if interval := time.Duration(a.heartbeat.EffectiveInterval()) * time.Second; interval > 0 && (timeout <= 0 || timeout > interval) {
+		timeout = interval
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	rtt, err := pinger.Ping(timeout)
+	if err != nil {
+		return err
+	}
+	a.heartbeat.RecordRTT(rtt)
+	stats := a.heartbeat.Stats()
+	a.SetGauge("heartbeat_rtt_ms", float64(rtt)/float64(time.Millisecond))
+	a.SetGauge("heartbeat_rtt_avg_ms", float64(stats.AvgRTT)/float64(time.Millisecond))
+	return nil
+}
+
+// serverUnreachable 服务器连续未响应，通知订阅了 server_unreachable 的插件
+func (a *Agent) serverUnreachable(failures int, cause error) {
+	stats := a.heartbeat.Stats()
+	logger.Errorf("Server unreachable after %d consecutive heartbeat failures: %v", failures, cause)
+	a.IncCounter("server_unreachable", 1)
+
+	if a.pluginMgr != nil {
+		data := map[string]interface{}{"failures": failures, "error": cause.Error()}
+		if !stats.LastPong.IsZero() {
+			data["last_pong"] = stats.LastPong.Unix()
+		}
+		a.pluginMgr.Publish("", plugin.EventServerUnreachable, data)
+	}
+}
+
+// heartbeatPayload 生成心跳内容：状态摘要加系统资源快照
+func (a *Agent) heartbeatPayload() map[string]interface{} {
+	payload := make(map[string]interface{})
+
+	// 心跳只收集资源使用率等概要信息，完整的系统信息由 sysinfo_interval 的收集循环上报
+	if a.sysinfo != nil {
+		info, err := a.sysinfo.CollectSummary()
+		if err != nil {
+			logger.Warnf("Failed to collect system info for heartbeat: %v", err)
+		} else {
+			if a.stateMgr != nil {
+				a.stateMgr.MergeSystemInfo(info)
+			}
+			payload["system"] = info
+		}
+	}
+
+	if a.stateMgr != nil {
+		// 任务数为执行中的命令数和队列中（排队及执行中）的命令数，变化时记录到状态变化日志
+		if a.executor != nil && a.cmdQueue != nil {
+			a.stateMgr.UpdateTaskCount(len(a.executor.ListRunningCommands()), a.cmdQueue.Len())
+		}
+		for key, value := range a.stateMgr.GetStatusSummary() {
+			payload[key] = value
+		}
+	}
+	payload["agent_id"] = a.agentID()
+	payload["timestamp"] = time.Now()
 	if a.heartbeat != nil {
-		a.heartbeat.Send()
+		// 下一次心跳的间隔（秒），自适应模式下会变化，服务器据此判断心跳是否超时
+		payload["heartbeat_interval"] = a.heartbeat.EffectiveInterval()
+	}
+
+	return payload
+}
+
+// newTransport 根据配置的协议创建通信客户端
+func newTransport(cfg *config.Config) (Transport, error) {
+	// WebSocket 和 gRPC 使用相同的证书配置
+	tlsConfig, err := websocket.NewTLSConfig(websocket.TLSOptions{
+		CertFile:  cfg.Security.CertFile,
+		KeyFile:   cfg.Security.KeyFile,
+		CAFile:    cfg.Security.CAFile,
+		VerifySSL: cfg.Security.VerifySSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Server.Protocol {
+	case "", "websocket":
+		client, err := websocket.NewClient(cfg.Server.URL, cfg.Security.Token)
+		if err != nil {
+			return nil, err
+		}
+		client.SetReconnectOptions(reconnectOptions(cfg))
+		client.SetTLSConfig(tlsConfig)
+		client.SetCompression(cfg.Server.Compression)
+		client.SetBatching(time.Duration(cfg.Server.BatchWindow)*time.Millisecond, cfg.Server.BatchMaxMessages)
+		// 结果消息在收到服务器确认前持久化，断线期间产生的结果在重连后补发
+		if cfg.Agent.DataDir != "" {
+			if err := client.EnableOutbox(filepath.Join(cfg.Agent.DataDir, "outbox"), cfg.Server.OutboxSize); err != nil {
+				logger.Warnf("Outbox disabled, results produced while disconnected may be lost: %v", err)
+			}
+		}
+		return client, nil
+	case "grpc":
+		client, err := grpc.NewClient(cfg.Server.GRPCAddress, cfg.Security.Token)
+		if err != nil {
+			return nil, err
+		}
+		client.SetTLSConfig(tlsConfig)
+		client.SetPlaintext(cfg.Server.GRPCPlaintext)
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unsupported server protocol: %s", cfg.Server.Protocol)
+	}
+}
+
+// reconnectOptions 根据配置生成断线重连参数
+func reconnectOptions(cfg *config.Config) websocket.ReconnectOptions {
+	opts := websocket.DefaultReconnectOptions()
+	if cfg.Agent.RetryDelay > 0 {
+		opts.InitialDelay = time.Duration(cfg.Agent.RetryDelay) * time.Second
+	}
+	if cfg.Agent.RetryMaxDelay > 0 {
+		opts.MaxDelay = time.Duration(cfg.Agent.RetryMaxDelay) * time.Second
 	}
+	opts.MaxRetries = cfg.Agent.MaxRetries
+	return opts
 }
 
-// runWebSocketClient 运行 WebSocket 客户端
-func (a *Agent) runWebSocketClient() {
+// runTransport 运行通信客户端
+// WebSocket 客户端在 Receive 内部自动重连，Receive 返回错误时按退避策略重新建立连接
+func (a *Agent) runTransport() {
 	defer a.wg.Done()
 
+	backoff := reconnectOptions(a.config)
+	attempt := 0
 	for {
+		err := a.transport.Connect()
+		if err == nil {
+			attempt = 0
+			// WebSocket 客户端在连接状态回调中注册，包括 Receive 内部的自动重连
+			if _, ok := a.transport.(*websocket.Client); !ok {
+				a.register()
+			}
+			err = a.receiveMessages()
+		}
+
+		if a.ctx.Err() != nil {
+			return
+		}
+
+		attempt++
+		delay := backoff.Delay(attempt)
+		logger.Errorf("Server connection failed: %v, retrying in %v", err, delay)
+
 		select {
 		case <-a.ctx.Done():
 			return
-		default:
-			if err := a.wsClient.Connect(); err != nil {
-				logger.Errorf("Failed to connect to WebSocket server: %v", err)
-				time.Sleep(5 * time.Second)
-				continue
-			}
+		case <-time.After(delay):
+		}
+	}
+}
 
-			// 处理消息
-			for {
-				select {
-				case <-a.ctx.Done():
-					return
-				default:
-					msgType, data, err := a.wsClient.Receive()
-					if err != nil {
-						logger.Errorf("Failed to receive message: %v", err)
-						break
-					}
-
-					if err := a.handleMessage(msgType, data); err != nil {
-						logger.Errorf("Failed to handle message: %v", err)
-					}
-				}
+// receiveMessages 持续接收并处理消息，直到传输层返回错误
+func (a *Agent) receiveMessages() error {
+	for {
+		msgType, data, err := a.transport.Receive()
+		if err != nil {
+			return err
+		}
+
+		if err := a.handleMessage(msgType, data); err != nil {
+			logger.Errorf("Failed to handle message: %v", err)
+		}
+	}
+}
+
+// onConnectionState 记录 WebSocket 连接状态变化
+func (a *Agent) onConnectionState(state websocket.ConnectionState, err error) {
+	a.connMu.Lock()
+	previous := a.connState
+	a.connState = string(state)
+	a.connMu.Unlock()
+
+	// 断线后重新连接成功计为一次重连
+	if state == websocket.StateConnected && previous == string(websocket.StateReconnecting) {
+		a.IncCounter("reconnects", 1)
+	}
+
+	if err != nil {
+		logger.Warnf("Server connection state changed to %s: %v", state, err)
+	} else {
+		logger.Infof("Server connection state changed to %s", state)
+	}
+
+	if state == websocket.StateConnected {
+		a.register()
+		a.resendSystemInfo()
+		a.reportRecovery()
+	}
+}
+
+// startShipping 开始将日志以 agent_logs 消息发送到服务器，未连接时日志缓存到数据目录下
+func (a *Agent) startShipping(ship config.LogShipConfig) error {
+	stop, err := logger.StartShipping(logger.ShipOptions{
+		Level:         ship.Level,
+		BatchSize:     ship.BatchSize,
+		FlushInterval: time.Duration(ship.FlushInterval) * time.Second,
+		BufferSize:    ship.BufferSize,
+		SpillFile:     filepath.Join(a.config.Agent.DataDir, "log_spool.jsonl"),
+		MaxSpillSize:  int64(ship.MaxSpillSize) * 1024 * 1024,
+	}, a.sendLogs)
+	if err != nil {
+		return err
+	}
+	a.stopShipping = stop
+	return nil
+}
+
+// sendLogs 发送一批日志，未连接时返回错误由调用方缓存。不报告连接状态的通信方式（如 gRPC）直接发送
+func (a *Agent) sendLogs(records []logger.Record, dropped int64) error {
+	a.connMu.RLock()
+	connected := a.connState == "" || a.connState == string(websocket.StateConnected)
+	a.connMu.RUnlock()
+	if !connected {
+		return fmt.Errorf("not connected to server")
+	}
+
+	data := map[string]interface{}{"logs": records}
+	if dropped > 0 {
+		data["dropped"] = dropped
+	}
+	return a.transport.Send("agent_logs", data)
+}
+
+// reportRecovery 上次运行未正常退出时发送 agent_recovered 事件，包含崩溃前的状态变化记录，供服务器核对
+func (a *Agent) reportRecovery() {
+	a.recoveryMu.Lock()
+	defer a.recoveryMu.Unlock()
+	if a.recovery == nil {
+		return
+	}
+
+	err := a.NotifyEvent("agent_recovered", map[string]interface{}{
+		"started_at":    a.recovery.StartedAt,
+		"last_entry_at": a.recovery.LastEntryAt,
+		"running_tasks": a.recovery.RunningTasks,
+		"total_tasks":   a.recovery.TotalTasks,
+		"entries":       a.recovery.Entries,
+	})
+	if err != nil {
+		logger.Warnf("Failed to report recovery: %v", err)
+		return
+	}
+	a.recovery = nil
+}
+
+// capabilities Agent 支持的服务器消息类型，注册时上报
+var capabilities = []string{
+	"command", "command_history", "get_processes", "container", "script", "schedule",
+	"file_transfer", "update", "plugin", "plugin_config", "plugin_manage", "reload_plugins", "config_update",
+}
+
+// register 连接建立后向服务器注册，服务器通过 registered 消息返回分配的 Agent ID
+func (a *Agent) register() {
+	if err := a.transport.Send("register", a.registrationInfo()); err != nil {
+		logger.Warnf("Failed to send registration: %v", err)
+	}
+}
+
+// registrationInfo 生成注册信息
+func (a *Agent) registrationInfo() map[string]interface{} {
+	hostname, _ := os.Hostname()
+
+	plugins := make([]map[string]interface{}, 0)
+	if a.pluginMgr != nil {
+		for _, p := range a.pluginMgr.ListPlugins() {
+			info := p.Info()
+			entry := map[string]interface{}{
+				"name":    info.Name,
+				"version": info.Version,
+			}
+			// 上报命令参数声明，服务器可据此生成调用界面
+			if provider, ok := p.(plugin.CommandSchemaProvider); ok {
+				entry["commands"] = provider.CommandSchemas()
 			}
+			plugins = append(plugins, entry)
+		}
+	}
+
+	return map[string]interface{}{
+		"agent_id":     a.agentID(),
+		"name":         a.config.Agent.Name,
+		"hostname":     hostname,
+		"version":      a.config.Agent.Version,
+		"os":           runtime.GOOS,
+		"arch":         runtime.GOARCH,
+		"capabilities": capabilities,
+		"plugins":      plugins,
+	}
+}
+
+// agentID 返回 Agent ID，优先使用服务器分配并持久化的 ID，其次使用配置
+func (a *Agent) agentID() string {
+	if a.stateMgr != nil {
+		if id := a.stateMgr.GetAgentID(); id != "" {
+			return id
 		}
 	}
+	return a.config.Agent.ID
+}
+
+// handleRegistered 处理服务器的注册响应，持久化服务器分配的 Agent ID
+func (a *Agent) handleRegistered(data interface{}) error {
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid registration response format")
+	}
+
+	if accepted, ok := dataMap["accepted"].(bool); ok && !accepted {
+		reason, _ := dataMap["reason"].(string)
+		return fmt.Errorf("registration rejected by server: %s", reason)
+	}
+
+	agentID, _ := dataMap["agent_id"].(string)
+	if agentID == "" {
+		return fmt.Errorf("agent_id is required in registration response")
+	}
+
+	if agentID != a.agentID() {
+		a.stateMgr.SetAgentID(agentID)
+		logger.Infof("Registered with server, assigned agent ID: %s", agentID)
+	} else {
+		logger.Infof("Registered with server as %s", agentID)
+	}
+	return nil
 }
 
-// handleMessage 处理接收到的消息
+// handleMessage 处理接收到的消息，每条消息的处理结果都会记录审计事件
 func (a *Agent) handleMessage(msgType string, data interface{}) error {
+	err := a.dispatchMessage(msgType, data)
+	if err == nil && (msgType == "command" || msgType == "file_transfer") {
+		a.onActivity()
+	}
+
+	// 命令和插件命令异步执行，此处只记录接收，执行结果在上报时记录
+	outcome := audit.OutcomeSuccess
+	if msgType == "command" || msgType == "plugin" {
+		outcome = audit.OutcomeAccepted
+	}
+	a.recordAudit(msgType, audit.OriginServer, auditTarget(msgType, data), data, outcome, err)
+
+	return err
+}
+
+// dispatchMessage 按消息类型分发处理
+func (a *Agent) dispatchMessage(msgType string, data interface{}) error {
 	switch msgType {
+	case "registered":
+		return a.handleRegistered(data)
 	case "command":
 		return a.handleCommand(data)
+	case "command_history":
+		return a.handleCommandHistory(data)
+	case "get_processes":
+		return a.handleGetProcesses(data)
+	case "container":
+		return a.handleContainer(data)
+	case "script":
+		return a.handleScript(data)
 	case "schedule":
 		return a.handleSchedule(data)
 	case "file_transfer":
@@ -267,48 +1008,476 @@ func (a *Agent) handleMessage(msgType string, data interface{}) error {
 		return a.handleUpdate(data)
 	case "plugin":
 		return a.handlePluginCommand(data)
+	case "plugin_config":
+		return a.handlePluginConfig(data)
+	case "plugin_manage":
+		return a.handlePluginManage(data)
+	case "reload_plugins":
+		return a.handleReloadPlugins()
+	case "config_update":
+		return a.handleConfigUpdate(data)
 	default:
 		logger.Warnf("Unknown message type: %s", msgType)
 		return nil
 	}
-}
+}
+
+// recordAudit 记录审计事件，未启用审计时忽略
+func (a *Agent) recordAudit(action, origin, target string, args interface{}, outcome string, err error) {
+	if a.auditor == nil {
+		return
+	}
+	if auditErr := a.auditor.Record(action, origin, target, args, outcome, err); auditErr != nil {
+		logger.Errorf("Failed to record audit event: %v", auditErr)
+	}
+}
+
+// auditTarget 从消息中提取审计对象标识
+func auditTarget(msgType string, data interface{}) string {
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	switch msgType {
+	case "plugin":
+		pluginName, _ := dataMap["plugin"].(string)
+		command, _ := dataMap["command"].(string)
+		return pluginName + "." + command
+	case "plugin_config":
+		pluginName, _ := dataMap["plugin"].(string)
+		return pluginName
+	case "plugin_manage":
+		action, _ := dataMap["action"].(string)
+		pluginName, _ := dataMap["plugin"].(string)
+		return action + ":" + pluginName
+	case "file_transfer":
+		if destination, ok := dataMap["destination"].(string); ok {
+			return destination
+		}
+	case "container", "script":
+		action, _ := dataMap["action"].(string)
+		if name, ok := dataMap["name"].(string); ok && name != "" {
+			return action + ":" + name
+		}
+		if id, ok := dataMap["container"].(string); ok && id != "" {
+			return action + ":" + id
+		}
+		return action
+	}
+
+	id, _ := dataMap["id"].(string)
+	return id
+}
+
+// handleCommand 处理命令消息
+func (a *Agent) handleCommand(data interface{}) error {
+	if a.executor != nil && a.cmdQueue != nil {
+		dataMap, ok := data.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid command data format")
+		}
+
+		// 可通过 script_name 引用脚本库中的脚本代替内联命令
+		script, _ := dataMap["command"].(string)
+		scriptRef, _ := dataMap["script_name"].(string)
+		if script == "" && scriptRef == "" {
+			return fmt.Errorf("command is required")
+		}
+
+		// 命令 ID 用于关联流式输出
+		commandID, _ := dataMap["id"].(string)
+		if commandID == "" {
+			commandID = fmt.Sprintf("cmd_%d", time.Now().UnixNano())
+		}
+
+		// 构建命令
+		cmd := &executor.Command{
+			ID:         commandID,
+			Type:       executor.CommandTypeShell,
+			Script:     script,
+			ScriptRef:  scriptRef,
+			Args:       []string{},
+			WorkingDir: a.config.Agent.WorkDir,
+			Timeout:    300, // 默认5分钟超时
+			OnOutput:   a.sendCommandOutput,
+		}
+
+		if cmdType, ok := dataMap["type"].(string); ok && cmdType != "" {
+			cmd.Type = executor.CommandType(cmdType)
+		}
+
+		// 解释器命令未指定超时时使用解释器默认超时
+		if cmd.Type == executor.CommandTypeInterpreter {
+			cmd.Interpreter, _ = dataMap["interpreter"].(string)
+			if a.config.Agent.Interpreters[cmd.Interpreter].Timeout > 0 {
+				cmd.Timeout = 0
+			}
+		}
+
+		if timeout, ok := dataMap["timeout"].(float64); ok && timeout > 0 {
+			cmd.Timeout = int(timeout)
+		}
+
+		// 服务端确认执行命中高危规则的命令
+		cmd.Confirmed, _ = dataMap["confirmed"].(bool)
+
+		// 以指定用户身份执行
+		cmd.RunAs, _ = dataMap["run_as"].(string)
+		cmd.RunAsPass, _ = dataMap["run_as_password"].(string)
+
+		// 资源限制
+		if maxMemory, ok := dataMap["max_memory_mb"].(float64); ok {
+			cmd.MaxMemoryMB = int(maxMemory)
+		}
+		if cpuQuota, ok := dataMap["cpu_quota"].(float64); ok {
+			cmd.CPUQuota = cpuQuota
+		}
+		if niceness, ok := dataMap["niceness"].(float64); ok {
+			cmd.Niceness = int(niceness)
+		}
+		if maxOutput, ok := dataMap["max_output_size"].(float64); ok {
+			cmd.MaxOutputSize = int64(maxOutput)
+		}
+
+		if env, ok := dataMap["env"].([]interface{}); ok {
+			for _, item := range env {
+				if str, ok := item.(string); ok {
+					cmd.Env = append(cmd.Env, str)
+				}
+			}
+		}
+
+		// 如果有参数，添加到Args中
+		if args, ok := dataMap["args"].([]interface{}); ok {
+			for _, arg := range args {
+				if str, ok := arg.(string); ok {
+					cmd.Args = append(cmd.Args, str)
+				}
+			}
+		}
+
+		// 提交到命令队列异步执行，结果通过 command_result 上报
+		return a.cmdQueue.Submit(cmd)
+	}
+	return fmt.Errorf("executor not available")
+}
+
+// handleCommandHistory 处理命令历史查询
+func (a *Agent) handleCommandHistory(data interface{}) error {
+	if a.executor == nil {
+		return fmt.Errorf("executor not available")
+	}
+
+	query, err := parseHistoryQuery(data)
+	if err != nil {
+		return err
+	}
+
+	// 每次只返回一页，has_more 为 true 时服务器以 offset + count 继续查询
+	results, total, err := a.executor.QueryHistory(query)
+	if err != nil {
+		return err
+	}
+
+	return a.transport.Send("command_history_result", map[string]interface{}{
+		"results":  results,
+		"count":    len(results),
+		"total":    total,
+		"offset":   query.Offset,
+		"has_more": query.Offset+len(results) < total,
+	})
+}
+
+// parseHistoryQuery 解析命令历史查询条件
+func parseHistoryQuery(data interface{}) (*executor.HistoryQuery, error) {
+	query := &executor.HistoryQuery{}
+
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return query, nil
+	}
+
+	query.ID, _ = dataMap["id"].(string)
+
+	for key, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value, ok := dataMap[key].(string)
+		if !ok || value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", key, err)
+		}
+		*target = t
+	}
+
+	if exitCode, ok := dataMap["exit_code"].(float64); ok {
+		code := int(exitCode)
+		query.ExitCode = &code
+	}
+	if success, ok := dataMap["success"].(bool); ok {
+		query.Success = &success
+	}
+	if limit, ok := dataMap["limit"].(float64); ok {
+		query.Limit = int(limit)
+	}
+	if offset, ok := dataMap["offset"].(float64); ok {
+		if offset < 0 {
+			return nil, fmt.Errorf("invalid offset: %v", offset)
+		}
+		query.Offset = int(offset)
+	}
+
+	return query, nil
+}
+
+// handleGetProcesses 处理进程列表查询，同时返回已登录的用户会话
+func (a *Agent) handleGetProcesses(data interface{}) error {
+	if a.sysinfo == nil {
+		return fmt.Errorf("system info collector not available")
+	}
+
+	query := parseProcessQuery(data)
+	processes, total, err := a.sysinfo.Processes(query)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"processes": processes,
+		"count":     len(processes),
+		"total":     total,
+	}
+	if sessions, err := a.sysinfo.Sessions(); err != nil {
+		logger.Debugf("Failed to list user sessions: %v", err)
+	} else {
+		result["sessions"] = sessions
+	}
+	return a.transport.Send("processes_result", result)
+}
+
+// parseProcessQuery 解析进程查询条件，默认按 CPU 使用率排序返回前 50 个进程
+func parseProcessQuery(data interface{}) sysinfo.ProcessQuery {
+	query := sysinfo.ProcessQuery{Limit: 50}
+
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return query
+	}
+	query.SortBy, _ = dataMap["sort_by"].(string)
+	query.Name, _ = dataMap["name"].(string)
+	query.User, _ = dataMap["user"].(string)
+	if limit, ok := dataMap["limit"].(float64); ok && limit >= 0 {
+		query.Limit = int(limit)
+	}
+	return query
+}
+
+// sendCommandResult 上报命令执行结果
+func (a *Agent) sendCommandResult(result *executor.Result) {
+	var execErr error
+	a.IncCounter("commands_executed", 1)
+	if !result.Success {
+		execErr = errors.New(result.Error)
+		a.IncCounter("commands_failed", 1)
+	}
+	a.recordAudit("command_result", audit.OriginServer, result.ID, nil, audit.OutcomeSuccess, execErr)
+
+	if err := a.transport.SendCommandResult(result); err != nil {
+		logger.Errorf("Failed to send command result %s: %v", result.ID, err)
+	}
+}
+
+// sendCommandOutput 将命令输出片段实时发送到服务器
+func (a *Agent) sendCommandOutput(chunk *executor.OutputChunk) {
+	if err := a.transport.Send("command_output", chunk); err != nil {
+		logger.Debugf("Failed to send command output: %v", err)
+	}
+}
+
+// handleContainer 处理容器管理消息，结果通过 container_result 返回
+func (a *Agent) handleContainer(data interface{}) error {
+	if a.containers == nil {
+		return fmt.Errorf("container manager not available")
+	}
+
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid container data format")
+	}
+
+	action, ok := dataMap["action"].(string)
+	if !ok || action == "" {
+		return fmt.Errorf("action is required")
+	}
+
+	requestID, _ := dataMap["id"].(string)
+	containerID, _ := dataMap["container"].(string)
+
+	// 日志流在后台持续推送，结束后再返回结果
+	if action == "logs" {
+		if containerID == "" {
+			return fmt.Errorf("container is required")
+		}
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			err := a.streamContainerLogs(requestID, containerID, container.ParseLogOptions(dataMap))
+			a.sendContainerResult(requestID, action, nil, err)
+		}()
+		return nil
+	}
 
-// handleCommand 处理命令消息
-func (a *Agent) handleCommand(data interface{}) error {
-	// 直接使用命令执行器处理命令
-	if a.executor != nil {
-		dataMap, ok := data.(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("invalid command data format")
+	// 拉取镜像、创建和运行容器可能需要数分钟，同样在后台执行，不阻塞消息接收；
+	// 参数错误同步返回
+	if action == "pull" || action == "create" || action == "run" {
+		image, _ := dataMap["image"].(string)
+		var opts *container.CreateOptions
+		if action != "pull" {
+			var err error
+			if opts, err = container.ParseCreateOptions(dataMap); err != nil {
+				a.sendContainerResult(requestID, action, nil, err)
+				return err
+			}
 		}
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
+			defer cancel()
+
+			var result interface{}
+			var err error
+			switch action {
+			case "pull":
+				result, err = a.containers.Pull(ctx, image)
+			case "create":
+				result, err = a.containers.Create(ctx, opts)
+			default:
+				result, err = a.containers.Run(ctx, opts)
+			}
+			a.sendContainerResult(requestID, action, result, err)
+		}()
+		return nil
+	}
 
-		// 构建命令
-		cmd := &executor.Command{
-			Type:       executor.CommandTypeShell,
-			Script:     dataMap["command"].(string),
-			Args:       []string{},
-			WorkingDir: a.config.Agent.WorkDir,
-			Timeout:    300, // 默认5分钟超时
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
+	defer cancel()
+
+	var result interface{}
+	var err error
+	switch action {
+	case "start":
+		err = a.containers.Start(ctx, containerID)
+	case "stop":
+		timeout := -1
+		if t, ok := dataMap["timeout"].(float64); ok {
+			timeout = int(t)
 		}
+		err = a.containers.Stop(ctx, containerID, timeout)
+	case "remove":
+		force, _ := dataMap["force"].(bool)
+		err = a.containers.Remove(ctx, containerID, force)
+	case "list":
+		all, _ := dataMap["all"].(bool)
+		result, err = a.containers.List(ctx, all)
+	default:
+		err = fmt.Errorf("unknown container action: %s", action)
+	}
 
-		// 如果有参数，添加到Args中
-		if args, ok := dataMap["args"].([]interface{}); ok {
-			for _, arg := range args {
-				if str, ok := arg.(string); ok {
-					cmd.Args = append(cmd.Args, str)
-				}
-			}
+	a.sendContainerResult(requestID, action, result, err)
+	return err
+}
+
+// streamContainerLogs 将容器日志逐行推送为 container_log 消息
+func (a *Agent) streamContainerLogs(requestID, containerID string, opts *container.LogOptions) error {
+	var seq int64
+	return a.containers.Logs(a.ctx, containerID, opts, func(stream, line string) {
+		seq++
+		if err := a.transport.Send("container_log", map[string]interface{}{
+			"id":        requestID,
+			"container": containerID,
+			"seq":       seq,
+			"stream":    stream,
+			"data":      line,
+		}); err != nil {
+			logger.Debugf("Failed to send container log: %v", err)
 		}
+	})
+}
+
+// sendContainerResult 上报容器操作结果
+func (a *Agent) sendContainerResult(requestID, action string, result interface{}, err error) {
+	response := map[string]interface{}{
+		"id":      requestID,
+		"action":  action,
+		"success": err == nil,
+		"result":  result,
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	if sendErr := a.transport.Send("container_result", response); sendErr != nil {
+		logger.Errorf("Failed to send container result: %v", sendErr)
+	}
+}
+
+// handleScript 处理脚本库管理消息，结果通过 script_result 返回
+func (a *Agent) handleScript(data interface{}) error {
+	if a.scripts == nil {
+		return fmt.Errorf("script library not available")
+	}
+
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid script data format")
+	}
+
+	action, ok := dataMap["action"].(string)
+	if !ok || action == "" {
+		return fmt.Errorf("action is required")
+	}
+
+	name, _ := dataMap["name"].(string)
+	version, _ := dataMap["version"].(string)
 
-		// 执行命令
-		result := a.executor.Execute(cmd)
-		if !result.Success {
-			return fmt.Errorf("command execution failed: %s", result.Error)
+	var result interface{}
+	var err error
+	switch action {
+	case "save":
+		script := &scripts.Script{Name: name, Version: version}
+		script.Type, _ = dataMap["type"].(string)
+		script.Interpreter, _ = dataMap["interpreter"].(string)
+		script.Content, _ = dataMap["content"].(string)
+		script.Checksum, _ = dataMap["checksum"].(string)
+		script.Description, _ = dataMap["description"].(string)
+		if err = a.scripts.Save(script); err == nil {
+			result = map[string]interface{}{"ref": script.Ref(), "checksum": script.Checksum}
 		}
+	case "get":
+		result, err = a.scripts.Get(name, version)
+	case "list":
+		result, err = a.scripts.List()
+	case "delete":
+		err = a.scripts.Delete(name, version)
+	default:
+		err = fmt.Errorf("unknown script action: %s", action)
+	}
 
-		return nil
+	response := map[string]interface{}{
+		"action":  action,
+		"success": err == nil,
+		"result":  result,
 	}
-	return fmt.Errorf("executor not available")
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	if sendErr := a.transport.Send("script_result", response); sendErr != nil {
+		logger.Errorf("Failed to send script result: %v", sendErr)
+	}
+	return err
 }
 
 // handleSchedule 处理定时任务消息
@@ -342,7 +1511,7 @@ func (a *Agent) handleSchedule(data interface{}) error {
 			}
 
 			// 发送结果回服务器
-			return a.wsClient.Send("schedule_result", map[string]interface{}{
+			return a.transport.Send("schedule_result", map[string]interface{}{
 				"command": command,
 				"result":  result,
 			})
@@ -351,13 +1520,21 @@ func (a *Agent) handleSchedule(data interface{}) error {
 	return fmt.Errorf("scheduler plugin not available")
 }
 
-// handleFileTransfer 处理文件传输消息
+// handleFileTransfer 处理文件传输消息，type 为 download 时从服务器下载，否则上传到服务器
 func (a *Agent) handleFileTransfer(data interface{}) error {
 	// 通过文件传输插件处理文件传输
 	if a.pluginMgr != nil {
-		filetransferPlugin, exists := a.pluginMgr.GetPlugin("filetransfer")
-		if exists {
-			_, err := filetransferPlugin.HandleCommand("upload", data.(map[string]interface{}))
+		if _, exists := a.pluginMgr.GetPlugin("file-transfer"); exists {
+			args, ok := data.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid file transfer data format")
+			}
+			command := "upload"
+			if transferType, _ := args["type"].(string); transferType == "download" {
+				command = "download"
+			}
+			delete(args, "type")
+			_, err := a.pluginMgr.SendCommand("file-transfer", command, args)
 			return err
 		}
 	}
@@ -389,16 +1566,26 @@ func (a *Agent) handleUpdate(data interface{}) error {
 				}
 			}
 
-			result, err := updaterPlugin.HandleCommand(command, args)
-			if err != nil {
-				return err
-			}
-
-			// 发送结果回服务器
-			return a.wsClient.Send("update_result", map[string]interface{}{
-				"command": command,
-				"result":  result,
-			})
+			// 下载和安装更新可能需要数分钟，在后台执行，不阻塞消息接收；
+			// 结果或错误通过 update_result 返回
+			a.wg.Add(1)
+			go func() {
+				defer a.wg.Done()
+				response := map[string]interface{}{"command": command}
+				if id, ok := dataMap["id"].(string); ok {
+					response["id"] = id
+				}
+				result, err := updaterPlugin.HandleCommand(command, args)
+				if err != nil {
+					response["error"] = err.Error()
+				} else {
+					response["result"] = result
+				}
+				if sendErr := a.transport.Send("update_result", response); sendErr != nil {
+					logger.Errorf("Failed to send update result: %v", sendErr)
+				}
+			}()
+			return nil
 		}
 	}
 	return fmt.Errorf("updater plugin not available")
@@ -426,23 +1613,257 @@ func (a *Agent) handlePluginCommand(data interface{}) error {
 	}
 
 	args, _ := dataMap["args"].(map[string]interface{})
+	requestID, _ := dataMap["id"].(string)
+
+	// 参数按插件声明同步校验，错误随消息处理结果返回
+	if err := a.pluginMgr.ValidateCommand(pluginName, command, args); err != nil {
+		// 参数校验失败时将逐项错误返回服务器
+		var validationErr *plugin.ValidationError
+		if errors.As(err, &validationErr) {
+			response := pluginResult(requestID, pluginName, command)
+			response["error"] = err.Error()
+			response["validation_errors"] = validationErr.Fields
+			if sendErr := a.transport.Send("plugin_result", response); sendErr != nil {
+				logger.Warnf("Failed to send plugin validation errors: %v", sendErr)
+			}
+		}
+		if err == plugin.ErrPluginNotFound {
+			return fmt.Errorf("plugin %s not found", pluginName)
+		}
+		return err
+	}
+
+	// 命令在后台执行，不阻塞消息接收：插件可能通过 CallServer 等待服务器响应，
+	// 而响应只能由接收循环读取
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.runPluginCommand(requestID, pluginName, command, args)
+	}()
+	return nil
+}
 
-	plugin, exists := a.pluginMgr.GetPlugin(pluginName)
-	if !exists {
-		return fmt.Errorf("plugin %s not found", pluginName)
+// pluginResult 创建 plugin_result 消息，带回服务器请求的 id 以便对应请求
+func pluginResult(requestID, pluginName, command string) map[string]interface{} {
+	response := map[string]interface{}{
+		"plugin":  pluginName,
+		"command": command,
+	}
+	if requestID != "" {
+		response["id"] = requestID
 	}
+	return response
+}
 
-	result, err := plugin.HandleCommand(command, args)
+// runPluginCommand 执行插件命令并通过 plugin_result 返回结果或错误
+func (a *Agent) runPluginCommand(requestID, pluginName, command string, args map[string]interface{}) {
+	response := pluginResult(requestID, pluginName, command)
+	result, err := a.pluginMgr.SendCommand(pluginName, command, args)
 	if err != nil {
-		return err
+		response["error"] = err.Error()
+	} else {
+		response["result"] = result
+	}
+	a.recordAudit("plugin_result", audit.OriginServer, pluginName+"."+command, nil, audit.OutcomeSuccess, err)
+
+	if sendErr := a.transport.Send("plugin_result", response); sendErr != nil {
+		logger.Errorf("Failed to send plugin result: %v", sendErr)
+	}
+}
+
+// handlePluginConfig 处理服务器下发的插件配置，结果通过 plugin_config_result 返回
+func (a *Agent) handlePluginConfig(data interface{}) error {
+	if a.pluginMgr == nil {
+		return fmt.Errorf("plugin manager not available")
+	}
+
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid plugin config data")
 	}
 
-	// 发送结果回服务器
-	return a.wsClient.Send("plugin_result", map[string]interface{}{
+	pluginName, _ := dataMap["plugin"].(string)
+	if pluginName == "" {
+		return fmt.Errorf("plugin name not specified")
+	}
+	update, ok := dataMap["config"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("plugin config not specified")
+	}
+	restart, _ := dataMap["restart"].(bool)
+
+	config, err := a.pluginMgr.UpdatePluginConfig(pluginName, update, restart)
+	if err == nil && a.stateMgr != nil {
+		// 只记录修改的配置项，不记录值
+		keys := make([]string, 0, len(update))
+		for key := range update {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		a.stateMgr.RecordEvent(state.JournalConfigChanged, map[string]interface{}{
+			"plugin":  pluginName,
+			"keys":    keys,
+			"restart": restart,
+		})
+	}
+	response := map[string]interface{}{
 		"plugin":  pluginName,
-		"command": command,
+		"success": err == nil,
+		"config":  config,
+	}
+	if id, ok := dataMap["id"].(string); ok {
+		response["id"] = id
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	if sendErr := a.transport.Send("plugin_config_result", response); sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// handleConfigUpdate 处理服务器下发的配置，校验后与本地配置合并（默认值 < 配置文件 < 环境变量 < 远程配置），
+// 写入数据目录并通过配置热加载应用，结果通过 config_update_result 返回
+func (a *Agent) handleConfigUpdate(data interface{}) error {
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid config update data")
+	}
+	update, ok := dataMap["config"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("config not specified")
+	}
+
+	overrides, err := config.UpdateRemote(update)
+	if err == nil && a.stateMgr != nil {
+		// 只记录修改的配置项，不记录值
+		keys := make([]string, 0, len(update))
+		for key := range update {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		a.stateMgr.RecordEvent(state.JournalConfigChanged, map[string]interface{}{
+			"source": "remote",
+			"keys":   keys,
+		})
+	}
+	response := map[string]interface{}{
+		"success": err == nil,
+		"config":  overrides,
+	}
+	if id, ok := dataMap["id"].(string); ok {
+		response["id"] = id
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	if sendErr := a.transport.Send("config_update_result", response); sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// handlePluginManage 处理插件安装、升级和卸载，结果通过 plugin_manage_result 返回
+func (a *Agent) handlePluginManage(data interface{}) error {
+	if a.pluginMgr == nil {
+		return fmt.Errorf("plugin manager not available")
+	}
+
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid plugin manage data")
+	}
+
+	action, _ := dataMap["action"].(string)
+	pluginName, _ := dataMap["plugin"].(string)
+	version, _ := dataMap["version"].(string)
+	if pluginName == "" {
+		return fmt.Errorf("plugin name not specified")
+	}
+
+	var info *plugin.PluginInfo
+	var err error
+	switch action {
+	case "install":
+		info, err = a.pluginMgr.InstallPlugin(pluginName, version)
+	case "upgrade":
+		info, err = a.pluginMgr.UpgradePlugin(pluginName, version)
+	case "uninstall":
+		err = a.pluginMgr.UninstallPlugin(pluginName)
+	default:
+		return fmt.Errorf("unknown plugin action: %s", action)
+	}
+
+	response := map[string]interface{}{
+		"action":  action,
+		"plugin":  pluginName,
+		"success": err == nil,
+	}
+	if id, ok := dataMap["id"].(string); ok {
+		response["id"] = id
+	}
+	if info != nil {
+		response["version"] = info.Version
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	if sendErr := a.transport.Send("plugin_manage_result", response); sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// externalPluginDir 外部插件目录，未配置时使用数据目录下的 external_plugins
+func (a *Agent) externalPluginDir() string {
+	if a.config.Agent.PluginDir != "" {
+		return a.config.Agent.PluginDir
+	}
+	if a.config.Agent.DataDir != "" {
+		return filepath.Join(a.config.Agent.DataDir, "external_plugins")
+	}
+	return ""
+}
+
+// loadExternalPlugins 启动时加载外部插件目录中的插件
+func (a *Agent) loadExternalPlugins() {
+	if a.externalPluginDir() == "" {
+		return
+	}
+
+	result, err := a.pluginMgr.ReloadExternalPlugins()
+	if err != nil {
+		logger.Warnf("Failed to load external plugins: %v", err)
+		return
+	}
+	for name, loadErr := range result.Errors {
+		logger.Warnf("Failed to load external plugin %s: %s", name, loadErr)
+	}
+}
+
+// handleReloadPlugins 处理 reload_plugins 消息，重新扫描外部插件目录
+func (a *Agent) handleReloadPlugins() error {
+	if a.pluginMgr == nil {
+		return fmt.Errorf("plugin manager not available")
+	}
+
+	result, err := a.pluginMgr.ReloadExternalPlugins()
+	response := map[string]interface{}{
+		"success": err == nil,
 		"result":  result,
-	})
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	if sendErr := a.transport.Send("reload_plugins_result", response); sendErr != nil {
+		return sendErr
+	}
+	return err
 }
 
 // IsRunning 检查 Agent 是否正在运行
@@ -511,26 +1932,78 @@ func (a *Agent) GetSystemInfo() (map[string]interface{}, error) {
 }
 
 func (a *Agent) ExecuteCommand(command string, args []string, timeout time.Duration) (string, error) {
+	return a.ExecuteCommandContext(context.Background(), command, args, timeout)
+}
+
+// ExecuteCommandContext 通过命令执行器执行命令，ctx 取消时终止命令
+func (a *Agent) ExecuteCommandContext(ctx context.Context, command string, args []string, timeout time.Duration) (string, error) {
+	return a.executePluginCommand(&executor.Command{
+		Type:    executor.CommandTypeShell,
+		Script:  command,
+		Args:    args,
+		Context: ctx,
+	}, timeout, "command")
+}
+
+// CallServer 向服务器发送请求并等待响应，timeout 为 0 时使用默认超时
+func (a *Agent) CallServer(msgType string, data interface{}, timeout time.Duration) (interface{}, error) {
+	caller, ok := a.transport.(interface {
+		Call(msgType string, data interface{}, timeout time.Duration) (interface{}, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("transport does not support request/response calls")
+	}
+	return caller.Call(msgType, data, timeout)
+}
+
+// ExecuteScript 执行脚本库中的脚本，ref 为 name@version
+func (a *Agent) ExecuteScript(ref string, args []string, timeout time.Duration) (string, error) {
+	return a.ExecuteScriptContext(context.Background(), ref, args, timeout)
+}
+
+// ExecuteScriptContext 执行脚本库中的脚本，ctx 取消时终止脚本
+func (a *Agent) ExecuteScriptContext(ctx context.Context, ref string, args []string, timeout time.Duration) (string, error) {
+	return a.executePluginCommand(&executor.Command{
+		ScriptRef: ref,
+		Args:      args,
+		Context:   ctx,
+	}, timeout, "script")
+}
+
+// RunCommand 按插件构造的命令执行，未指定工作目录时使用 Agent 工作目录，ctx 取消时终止命令
+func (a *Agent) RunCommand(ctx context.Context, cmd *executor.Command) (*executor.Result, error) {
+	if a.executor == nil {
+		return nil, fmt.Errorf("executor not available")
+	}
+
+	run := *cmd
+	if run.WorkingDir == "" {
+		run.WorkingDir = a.config.Agent.WorkDir
+	}
+	run.Context = ctx
+	return a.executor.Execute(&run), nil
+}
+
+// executePluginCommand 为插件执行命令，返回标准输出或合并输出
+func (a *Agent) executePluginCommand(cmd *executor.Command, timeout time.Duration, kind string) (string, error) {
 	// 直接使用命令执行器执行命令
-	if a.executor != nil {
-		cmd := &executor.Command{
-			Type:       executor.CommandTypeShell,
-			Script:     command,
-			Args:       args,
-			WorkingDir: a.config.Agent.WorkDir,
-			Timeout:    int(timeout.Seconds()),
-		}
+	if a.executor == nil {
+		return "", fmt.Errorf("executor not available")
+	}
 
-		result := a.executor.Execute(cmd)
-		if !result.Success {
-			return "", fmt.Errorf("command execution failed: %s", result.Error)
-		}
+	cmd.WorkingDir = a.config.Agent.WorkDir
+	cmd.Timeout = int(timeout.Seconds())
 
-		return result.Output, nil
+	result := a.executor.Execute(cmd)
+	if !result.Success {
+		return "", fmt.Errorf("%s execution failed: %s", kind, result.Error)
 	}
 
-	// 如果执行器不可用，返回错误
-	return "", fmt.Errorf("executor not available")
+	// 未保留合并输出时返回标准输出
+	if !a.config.Agent.CombinedOutput {
+		return result.Stdout, nil
+	}
+	return result.Output, nil
 }
 
 func (a *Agent) ReadFile(path string) ([]byte, error) {
@@ -546,6 +2019,32 @@ func (a *Agent) FileExists(path string) bool {
 	return err == nil
 }
 
+// Command 供插件直接运行程序
+func (a *Agent) Command(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	return exec.CommandContext(ctx, name, args...), nil
+}
+
+// OpenFile 等文件系统方法供插件流式读写文件
+func (a *Agent) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag, perm)
+}
+
+func (a *Agent) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (a *Agent) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (a *Agent) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (a *Agent) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
 func (a *Agent) GetConfig(key string) interface{} {
 	// 从配置中获取值
 	switch key {
@@ -553,14 +2052,20 @@ func (a *Agent) GetConfig(key string) interface{} {
 		return a.config.Server.Host
 	case "server.port":
 		return a.config.Server.Port
+	case "agent.id":
+		return a.agentID()
 	case "agent.name":
 		return a.config.Agent.Name
+	case "agent.version":
+		return a.config.Agent.Version
 	case "agent.work_dir":
 		return a.config.Agent.WorkDir
 	case "agent.data_dir":
 		return a.config.Agent.DataDir
 	case "agent.temp_dir":
 		return a.config.Agent.TempDir
+	case "agent.container_runtime":
+		return a.config.Agent.ContainerRuntime
 	case "logging.level":
 		return a.config.Logging.Level
 	case "logging.file":
@@ -568,14 +2073,49 @@ func (a *Agent) GetConfig(key string) interface{} {
 	case "security.token":
 		return a.config.Security.Token
 	default:
+		// 插件通过 SetConfig 写入的动态配置
+		if a.settings != nil {
+			return a.settings.Get(key)
+		}
 		return nil
 	}
 }
 
+// SetConfig 写入动态配置，保存在数据目录下的 settings.json，value 为 nil 时删除。
+// 主配置文件中的配置段（server、agent、security 等）只能通过配置文件或远程配置修改
 func (a *Agent) SetConfig(key string, value interface{}) error {
-	// 这里可以实现动态配置更新
-	// 暂时返回不支持的错误
-	return fmt.Errorf("dynamic config update not supported")
+	err := a.setConfig(key, value)
+	a.recordAudit("config_change", audit.OriginPlugin, key, value, audit.OutcomeSuccess, err)
+	return err
+}
+
+func (a *Agent) setConfig(key string, value interface{}) error {
+	if coreConfigKey(key) {
+		return fmt.Errorf("%s is a core config key and cannot be changed dynamically", key)
+	}
+	if a.settings == nil {
+		return fmt.Errorf("dynamic config not available")
+	}
+	_, changed, err := a.settings.Set(key, value)
+	if err != nil {
+		return err
+	}
+	if changed && a.stateMgr != nil {
+		a.stateMgr.RecordEvent(state.JournalConfigChanged, map[string]interface{}{"key": key, "source": "plugin"})
+	}
+	return nil
+}
+
+// coreConfigKey 判断键是否属于主配置文件中的配置段
+func coreConfigKey(key string) bool {
+	section, _, _ := strings.Cut(strings.ToLower(key), ".")
+	configType := reflect.TypeOf(config.Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if configType.Field(i).Tag.Get("mapstructure") == section {
+			return true
+		}
+	}
+	return false
 }
 
 func (a *Agent) GetStatus() map[string]interface{} {
@@ -584,6 +2124,43 @@ func (a *Agent) GetStatus() map[string]interface{} {
 		"uptime":  time.Since(a.stateMgr.GetStartTime()).Seconds(),
 	}
 
+	if id := a.agentID(); id != "" {
+		status["agent_id"] = id
+	}
+
+	a.connMu.RLock()
+	if a.connState != "" {
+		status["connection_state"] = a.connState
+	}
+	a.connMu.RUnlock()
+
+	// connection_state 只由 WebSocket 传输层设置，connected 对所有传输层可用
+	if conn, ok := a.transport.(interface{ IsConnected() bool }); ok {
+		status["connected"] = conn.IsConnected()
+	}
+
+	if pending, ok := a.transport.(interface{ PendingMessages() int }); ok {
+		status["pending_messages"] = pending.PendingMessages()
+	}
+
+	// 正在执行的命令和命令队列长度（排队中和执行中）
+	if a.executor != nil {
+		status["running_commands"] = len(a.executor.ListRunningCommands())
+	}
+	if a.cmdQueue != nil {
+		status["queued_commands"] = a.cmdQueue.Len()
+	}
+
+	// 命令数、重连次数和插件发布的统计数据
+	if a.stateMgr != nil {
+		summary := a.stateMgr.GetStatusSummary()
+		for _, key := range []string{"counters", "gauges"} {
+			if value, ok := summary[key]; ok {
+				status[key] = value
+			}
+		}
+	}
+
 	// 添加插件状态
 	if a.pluginMgr != nil {
 		pluginStatuses := a.pluginMgr.GetAllPluginStatus()
@@ -599,9 +2176,23 @@ func (a *Agent) SetStatus(key string, value interface{}) error {
 	return fmt.Errorf("status update not supported")
 }
 
+// SetGauge 设置统计值，随状态摘要和心跳上报
+func (a *Agent) SetGauge(name string, value float64) {
+	if a.stateMgr != nil {
+		a.stateMgr.SetGauge(name, value)
+	}
+}
+
+// IncCounter 累加计数，随状态摘要和心跳上报
+func (a *Agent) IncCounter(name string, delta float64) {
+	if a.stateMgr != nil {
+		a.stateMgr.IncCounter(name, delta)
+	}
+}
+
 func (a *Agent) NotifyEvent(eventType string, data map[string]interface{}) error {
-	// 通过 WebSocket 发送事件到服务器
-	return a.wsClient.Send("event", map[string]interface{}{
+	// 通过通信客户端发送事件到服务器
+	return a.transport.Send("event", map[string]interface{}{
 		"type": eventType,
 		"data": data,
 	})
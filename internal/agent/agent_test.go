@@ -1,12 +1,35 @@
 package agent
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
+	"assistant_agent/internal/audit"
 	"assistant_agent/internal/config"
+	"assistant_agent/internal/container"
+	"assistant_agent/internal/executor"
+	"assistant_agent/internal/grpc"
+	"assistant_agent/internal/heartbeat"
 	"assistant_agent/internal/logger"
-
+	"assistant_agent/internal/plugin"
+	"assistant_agent/internal/plugin/filetransfer"
+	"assistant_agent/internal/plugin/monitor"
+	"assistant_agent/internal/plugin/password"
+	"assistant_agent/internal/plugin/updater"
+	"assistant_agent/internal/scripts"
+	"assistant_agent/internal/state"
+	"assistant_agent/internal/sysinfo"
+	"assistant_agent/internal/websocket"
+
+	gws "github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,7 +53,7 @@ func TestNew(t *testing.T) {
 	// 验证组件是否创建
 	assert.NotNil(t, agent.stateMgr)
 	assert.NotNil(t, agent.heartbeat)
-	assert.NotNil(t, agent.wsClient)
+	assert.NotNil(t, agent.transport)
 	assert.NotNil(t, agent.pluginMgr)
 }
 
@@ -202,14 +225,16 @@ func TestAgentComponentIntegration(t *testing.T) {
 	// 验证组件集成
 	assert.NotNil(t, agent.stateMgr)
 	assert.NotNil(t, agent.heartbeat)
-	assert.NotNil(t, agent.wsClient)
+	assert.NotNil(t, agent.transport)
 	assert.NotNil(t, agent.pluginMgr)
 
 	// 验证组件之间的依赖关系
 	// 插件管理器应该已初始化
 	assert.NotNil(t, agent.pluginMgr)
 	// WebSocket 客户端应该配置正确
-	assert.NotEmpty(t, agent.wsClient.GetURL())
+	wsClient, ok := agent.transport.(*websocket.Client)
+	require.True(t, ok)
+	assert.NotEmpty(t, wsClient.GetURL())
 }
 
 func TestAgentLifecycle(t *testing.T) {
@@ -409,5 +434,849 @@ func TestAgentWebSocketCommunication(t *testing.T) {
 
 	// 验证 WebSocket 客户端状态
 	// 注意：在实际环境中，连接可能会失败，这是正常的
-	assert.NotNil(t, agent.wsClient)
+	assert.NotNil(t, agent.transport)
+}
+
+func TestNewTransport(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{URL: "ws://localhost:8080/ws", GRPCAddress: "localhost:9090"}}
+
+	// 默认使用 WebSocket
+	transport, err := newTransport(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &websocket.Client{}, transport)
+
+	cfg.Server.Protocol = "grpc"
+	transport, err = newTransport(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &grpc.Client{}, transport)
+
+	cfg.Server.Protocol = "mqtt"
+	_, err = newTransport(cfg)
+	assert.Error(t, err)
+}
+
+// fakeTransport 记录发送消息的传输层
+type fakeTransport struct {
+	mu   sync.Mutex
+	sent []string
+	data []interface{}
+}
+
+func (f *fakeTransport) Connect() error                        { return nil }
+func (f *fakeTransport) Receive() (string, interface{}, error) { return "", nil, nil }
+func (f *fakeTransport) Stop()                                 {}
+func (f *fakeTransport) SendCommandResult(result interface{}) error {
+	return f.Send("command_result", result)
+}
+func (f *fakeTransport) Send(msgType string, data interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, msgType)
+	f.data = append(f.data, data)
+	return nil
+}
+func (f *fakeTransport) messages() ([]string, []interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.sent...), append([]interface{}(nil), f.data...)
+}
+
+func TestHandleCommandStreamsOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell streaming test requires bash")
+	}
+
+	tempDir := t.TempDir()
+	exec, err := executor.New(filepath.Join(tempDir, "work"), filepath.Join(tempDir, "temp"))
+	require.NoError(t, err)
+
+	transport := &fakeTransport{}
+	agent := &Agent{
+		config:    &config.Config{Agent: config.AgentConfig{WorkDir: filepath.Join(tempDir, "work")}},
+		transport: transport,
+		executor:  exec,
+	}
+	agent.cmdQueue = executor.NewQueue(exec, 1, 10, agent.sendCommandResult)
+	agent.cmdQueue.Start()
+	defer agent.cmdQueue.Stop()
+
+	err = agent.handleCommand(map[string]interface{}{"id": "cmd-1", "command": "echo hello"})
+	require.NoError(t, err)
+
+	// 命令异步执行，先推送输出再上报结果
+	assert.Eventually(t, func() bool {
+		sent, _ := transport.messages()
+		return len(sent) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sent, data := transport.messages()
+	assert.Equal(t, []string{"command_output", "command_result"}, sent)
+	chunk := data[0].(*executor.OutputChunk)
+	assert.Equal(t, "cmd-1", chunk.ID)
+	assert.Equal(t, int64(1), chunk.Seq)
+	assert.Equal(t, "hello\n", chunk.Data)
+	result := data[1].(*executor.Result)
+	assert.Equal(t, "cmd-1", result.ID)
+	assert.True(t, result.Success)
+
+	// 缺少 command 字段
+	assert.Error(t, agent.handleCommand(map[string]interface{}{}))
+}
+
+func TestParseHistoryQuery(t *testing.T) {
+	query, err := parseHistoryQuery(map[string]interface{}{
+		"id":        "cmd-1",
+		"since":     "2024-01-01T00:00:00Z",
+		"exit_code": float64(1),
+		"success":   false,
+		"limit":     float64(20),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "cmd-1", query.ID)
+	assert.Equal(t, 2024, query.Since.Year())
+	assert.True(t, query.Until.IsZero())
+	assert.Equal(t, 1, *query.ExitCode)
+	assert.False(t, *query.Success)
+	assert.Equal(t, 20, query.Limit)
+
+	_, err = parseHistoryQuery(map[string]interface{}{"until": "yesterday"})
+	assert.Error(t, err)
+}
+
+func TestHandleCommandHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	exec, err := executor.New(filepath.Join(tempDir, "work"), filepath.Join(tempDir, "temp"))
+	require.NoError(t, err)
+	history, err := executor.NewHistory(tempDir, 10)
+	require.NoError(t, err)
+	exec.SetHistory(history)
+	require.NoError(t, history.Record(&executor.Result{ID: "cmd-1", Success: true}))
+	require.NoError(t, history.Record(&executor.Result{ID: "cmd-2", Success: true}))
+
+	transport := &fakeTransport{}
+	agent := &Agent{transport: transport, executor: exec}
+
+	require.NoError(t, agent.handleCommandHistory(map[string]interface{}{"id": "cmd-1"}))
+	sent, data := transport.messages()
+	require.Equal(t, []string{"command_history_result"}, sent)
+	assert.Equal(t, 1, data[0].(map[string]interface{})["count"])
+
+	// 按页返回，has_more 表示还有后续记录
+	require.NoError(t, agent.handleCommandHistory(map[string]interface{}{"limit": float64(1)}))
+	_, data = transport.messages()
+	page := data[1].(map[string]interface{})
+	assert.Equal(t, 2, page["total"])
+	assert.Equal(t, true, page["has_more"])
+	require.NoError(t, agent.handleCommandHistory(map[string]interface{}{"limit": float64(1), "offset": float64(1)}))
+	_, data = transport.messages()
+	assert.Equal(t, false, data[2].(map[string]interface{})["has_more"])
+
+	_, err = parseHistoryQuery(map[string]interface{}{"offset": float64(-1)})
+	assert.Error(t, err)
+}
+
+func TestHandleContainer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake container runtime requires sh")
+	}
+
+	// 模拟容器运行时：logs 输出两行日志，其余子命令回显参数
+	fakeRuntime := filepath.Join(t.TempDir(), "docker")
+	script := "#!/bin/sh\nif [ \"$1\" = logs ]; then echo line1; echo line2 >&2; exit 0; fi\necho \"$@\"\n"
+	require.NoError(t, os.WriteFile(fakeRuntime, []byte(script), 0755))
+
+	transport := &fakeTransport{}
+	agent := &Agent{
+		ctx:        context.Background(),
+		transport:  transport,
+		containers: container.NewManager(fakeRuntime),
+	}
+
+	// 拉取镜像在后台执行，完成后上报带请求 id 的结果
+	require.NoError(t, agent.handleContainer(map[string]interface{}{"id": "c-1", "action": "pull", "image": "nginx"}))
+	agent.wg.Wait()
+	sent, data := transport.messages()
+	require.Equal(t, []string{"container_result"}, sent)
+	response := data[0].(map[string]interface{})
+	assert.Equal(t, "c-1", response["id"])
+	assert.Equal(t, true, response["success"])
+	assert.Equal(t, "pull nginx", response["result"])
+
+	// 日志异步推送，结束后上报结果
+	require.NoError(t, agent.handleContainer(map[string]interface{}{"id": "c-2", "action": "logs", "container": "web"}))
+	agent.wg.Wait()
+	sent, data = transport.messages()
+	require.Len(t, sent, 4)
+	assert.ElementsMatch(t, []string{"container_log", "container_log"}, sent[1:3])
+	assert.Equal(t, "container_result", sent[3])
+	assert.Equal(t, true, data[3].(map[string]interface{})["success"])
+
+	// 错误同时返回并上报
+	err := agent.handleContainer(map[string]interface{}{"id": "c-3", "action": "unknown"})
+	assert.Error(t, err)
+	_, data = transport.messages()
+	assert.Equal(t, false, data[len(data)-1].(map[string]interface{})["success"])
+
+	// 创建参数错误同步返回
+	assert.Error(t, agent.handleContainer(map[string]interface{}{"id": "c-4", "action": "run"}))
+	_, data = transport.messages()
+	assert.Equal(t, "c-4", data[len(data)-1].(map[string]interface{})["id"])
+	assert.Equal(t, false, data[len(data)-1].(map[string]interface{})["success"])
+
+	assert.Error(t, agent.handleContainer(map[string]interface{}{"action": "logs"}))
+	assert.Error(t, agent.handleContainer(map[string]interface{}{}))
+}
+
+func TestHandleScript(t *testing.T) {
+	store, err := scripts.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	transport := &fakeTransport{}
+	agent := &Agent{transport: transport, scripts: store}
+
+	require.NoError(t, agent.handleScript(map[string]interface{}{
+		"action":  "save",
+		"name":    "cleanup",
+		"version": "1.0",
+		"content": "echo cleanup",
+	}))
+	sent, data := transport.messages()
+	require.Equal(t, []string{"script_result"}, sent)
+	result := data[0].(map[string]interface{})["result"].(map[string]interface{})
+	assert.Equal(t, "cleanup@1.0", result["ref"])
+	assert.Equal(t, scripts.Checksum("echo cleanup"), result["checksum"])
+
+	require.NoError(t, agent.handleScript(map[string]interface{}{"action": "get", "name": "cleanup"}))
+	_, data = transport.messages()
+	assert.Equal(t, "echo cleanup", data[1].(map[string]interface{})["result"].(*scripts.Script).Content)
+
+	// 摘要不一致时拒绝保存
+	assert.Error(t, agent.handleScript(map[string]interface{}{
+		"action":   "save",
+		"name":     "cleanup",
+		"version":  "2.0",
+		"content":  "echo cleanup",
+		"checksum": "bad",
+	}))
+	assert.Error(t, agent.handleScript(map[string]interface{}{"action": "unknown"}))
+}
+
+func TestHandleMessageRecordsAudit(t *testing.T) {
+	recorder, err := audit.NewRecorder(filepath.Join(t.TempDir(), "audit.log"))
+	require.NoError(t, err)
+
+	agent := &Agent{transport: &fakeTransport{}, auditor: recorder}
+
+	// 插件管理器不可用时记录失败事件
+	err = agent.handleMessage("plugin", map[string]interface{}{"plugin": "monitor", "command": "status"})
+	assert.Error(t, err)
+	assert.NoError(t, agent.handleMessage("unknown", map[string]interface{}{"id": "x"}))
+	agent.sendCommandResult(&executor.Result{ID: "cmd-1", Success: false, Error: "exit status 1"})
+
+	events, err := recorder.Events()
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "plugin", events[0].Action)
+	assert.Equal(t, "monitor.status", events[0].Target)
+	assert.Equal(t, audit.OutcomeFailure, events[0].Outcome)
+	assert.Equal(t, "unknown", events[1].Action)
+	assert.Equal(t, audit.OutcomeSuccess, events[1].Outcome)
+	assert.Equal(t, "command_result", events[2].Action)
+	assert.Equal(t, "cmd-1", events[2].Target)
+	assert.Equal(t, "exit status 1", events[2].Error)
+	assert.NoError(t, recorder.Verify())
+}
+
+func TestReconnectOptions(t *testing.T) {
+	cfg := &config.Config{Agent: config.AgentConfig{RetryDelay: 2, RetryMaxDelay: 60, MaxRetries: 5}}
+	opts := reconnectOptions(cfg)
+	assert.Equal(t, 2*time.Second, opts.InitialDelay)
+	assert.Equal(t, time.Minute, opts.MaxDelay)
+	assert.Equal(t, 5, opts.MaxRetries)
+
+	// 未配置时使用默认值
+	opts = reconnectOptions(&config.Config{})
+	assert.Equal(t, websocket.DefaultReconnectOptions().InitialDelay, opts.InitialDelay)
+	assert.Equal(t, 0, opts.MaxRetries)
+}
+
+func TestRegistrationHandshake(t *testing.T) {
+	stateMgr, err := state.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	transport := &fakeTransport{}
+	agent := &Agent{
+		config:    &config.Config{Agent: config.AgentConfig{ID: "configured-id", Name: "edge-1", Version: "1.2.0"}},
+		transport: transport,
+		stateMgr:  stateMgr,
+	}
+
+	// 连接建立后发送注册信息，未分配 ID 时使用配置的 ID
+	agent.onConnectionState(websocket.StateConnected, nil)
+	sent, data := transport.messages()
+	require.Equal(t, []string{"register"}, sent)
+	info := data[0].(map[string]interface{})
+	assert.Equal(t, "configured-id", info["agent_id"])
+	assert.Equal(t, "edge-1", info["name"])
+	assert.Equal(t, "1.2.0", info["version"])
+	assert.Equal(t, runtime.GOOS, info["os"])
+	assert.Contains(t, info["capabilities"], "command")
+
+	// 服务器分配的 ID 持久化后用于后续注册
+	require.NoError(t, agent.dispatchMessage("registered", map[string]interface{}{"agent_id": "srv-42"}))
+	assert.Equal(t, "srv-42", stateMgr.GetAgentID())
+	agent.onConnectionState(websocket.StateConnected, nil)
+	_, data = transport.messages()
+	assert.Equal(t, "srv-42", data[1].(map[string]interface{})["agent_id"])
+
+	assert.Error(t, agent.handleRegistered(map[string]interface{}{}))
+	assert.Error(t, agent.handleRegistered(map[string]interface{}{"accepted": false, "reason": "unknown token"}))
+}
+
+// failingTransport 发送总是失败的传输层，记录主动重连次数
+type failingTransport struct {
+	fakeTransport
+	reconnects int
+}
+
+func (f *failingTransport) Send(msgType string, data interface{}) error {
+	f.fakeTransport.Send(msgType, data)
+	return errors.New("write: broken pipe")
+}
+func (f *failingTransport) Reconnect(cause error) { f.reconnects++ }
+
+func TestSendHeartbeat(t *testing.T) {
+	stateMgr, err := state.NewManager(t.TempDir())
+	require.NoError(t, err)
+	stateMgr.SetAgentID("agent-1")
+	hb, err := heartbeat.New(30)
+	require.NoError(t, err)
+
+	transport := &fakeTransport{}
+	agent := &Agent{
+		config:    &config.Config{Agent: config.AgentConfig{HeartbeatFails: 2}},
+		transport: transport,
+		stateMgr:  stateMgr,
+		heartbeat: hb,
+	}
+
+	agent.sendHeartbeat()
+	sent, data := transport.messages()
+	require.Equal(t, []string{"heartbeat"}, sent)
+	payload := data[0].(map[string]interface{})
+	assert.Equal(t, "agent-1", payload["agent_id"])
+	assert.Contains(t, payload, "uptime")
+	assert.Contains(t, payload, "running_tasks")
+
+	// 连续失败达到上限时触发重连
+	failing := &failingTransport{}
+	agent.transport = failing
+	agent.sendHeartbeat()
+	assert.Equal(t, 0, failing.reconnects)
+	agent.sendHeartbeat()
+	assert.Equal(t, 1, failing.reconnects)
+	assert.Equal(t, 2, hb.Failures())
+
+	agent.transport = transport
+	agent.sendHeartbeat()
+	assert.Equal(t, 0, hb.Failures())
+}
+
+// pingTransport 支持 ping 的传输层，pong 为 false 时模拟服务器不响应
+type pingTransport struct {
+	fakeTransport
+	pong       bool
+	reconnects int
+}
+
+func (p *pingTransport) Ping(timeout time.Duration) (time.Duration, error) {
+	if !p.pong {
+		return 0, errors.New("no pong received")
+	}
+	return 20 * time.Millisecond, nil
+}
+func (p *pingTransport) Reconnect(cause error) { p.reconnects++ }
+
+func TestSendHeartbeatPing(t *testing.T) {
+	stateMgr, err := state.NewManager(t.TempDir())
+	require.NoError(t, err)
+	hb, err := heartbeat.New(30)
+	require.NoError(t, err)
+
+	transport := &pingTransport{pong: true}
+	agent := &Agent{
+		config:    &config.Config{Agent: config.AgentConfig{HeartbeatFails: 2, HeartbeatTimeout: 1}},
+		transport: transport,
+		stateMgr:  stateMgr,
+		heartbeat: hb,
+	}
+
+	// 收到响应时记录往返时间
+	agent.sendHeartbeat()
+	assert.Equal(t, 20*time.Millisecond, hb.Stats().LastRTT)
+	gauges := stateMgr.GetStatus().Gauges
+	assert.Equal(t, float64(20), gauges["heartbeat_rtt_ms"])
+	assert.Equal(t, float64(0), gauges["heartbeat_misses"])
+
+	// 心跳发送成功但服务器不响应也计为失败，达到上限时重连并只通知一次不可达
+	transport.pong = false
+	agent.sendHeartbeat()
+	assert.Equal(t, 0, transport.reconnects)
+	agent.sendHeartbeat()
+	assert.Equal(t, 1, transport.reconnects)
+	agent.sendHeartbeat()
+	agent.sendHeartbeat()
+	assert.Equal(t, 2, transport.reconnects)
+	status := stateMgr.GetStatus()
+	assert.Equal(t, float64(4), status.Gauges["heartbeat_misses"])
+	assert.Equal(t, float64(4), status.Counters["heartbeat_misses_total"])
+	assert.Equal(t, float64(1), status.Counters["server_unreachable"])
+
+	transport.pong = true
+	agent.sendHeartbeat()
+	assert.Equal(t, 0, hb.Failures())
+	assert.Equal(t, float64(0), stateMgr.GetStatus().Gauges["heartbeat_misses"])
+}
+
+func TestReportSystemInfo(t *testing.T) {
+	stateMgr, err := state.NewManager(t.TempDir())
+	require.NoError(t, err)
+	collector, err := sysinfo.NewCollector()
+	require.NoError(t, err)
+
+	transport := &fakeTransport{}
+	agent := &Agent{
+		config:    &config.Config{},
+		transport: transport,
+		stateMgr:  stateMgr,
+		sysinfo:   collector,
+	}
+
+	// 第一次上报包含静态信息，之后静态信息没有变化时只发送动态信息
+	agent.reportSystemInfo()
+	agent.reportSystemInfo()
+	sent, data := transport.messages()
+	require.Equal(t, []string{"system_info", "system_info"}, sent)
+	first := data[0].(map[string]interface{})
+	assert.Contains(t, first["static"], "hostname")
+	assert.Contains(t, first["dynamic"], "cpu_usage")
+	assert.NotContains(t, data[1], "static")
+	assert.NotNil(t, stateMgr.GetStatus().SystemInfo)
+
+	// 发送失败时下次重新发送静态信息
+	agent.staticHash = ""
+	agent.transport = &failingTransport{}
+	agent.reportSystemInfo()
+	agent.transport = transport
+	agent.reportSystemInfo()
+	_, data = transport.messages()
+	assert.Contains(t, data[2], "static")
+
+	// 重新连接后重新发送静态信息
+	agent.onConnectionState(websocket.StateConnected, nil)
+	agent.reportSystemInfo()
+	sent, data = transport.messages()
+	assert.Equal(t, "register", sent[3])
+	assert.Contains(t, data[4], "static")
+}
+
+func TestReportRecovery(t *testing.T) {
+	dataDir := t.TempDir()
+	stateMgr, err := state.NewManager(dataDir)
+	require.NoError(t, err)
+	require.NoError(t, stateMgr.Start())
+	stateMgr.UpdateTaskCount(1, 3)
+
+	// 上次运行没有调用 Stop，重新启动后连接建立时上报一次
+	stateMgr, err = state.NewManager(dataDir)
+	require.NoError(t, err)
+	transport := &fakeTransport{}
+	agent := &Agent{
+		config:    &config.Config{},
+		transport: transport,
+		stateMgr:  stateMgr,
+	}
+	require.NoError(t, stateMgr.Start())
+	agent.recovery = stateMgr.Recovery()
+	agent.onConnectionState(websocket.StateConnected, nil)
+	agent.onConnectionState(websocket.StateConnected, nil)
+
+	sent, data := transport.messages()
+	var events []map[string]interface{}
+	for i, msgType := range sent {
+		if msgType == "event" {
+			events = append(events, data[i].(map[string]interface{}))
+		}
+	}
+	require.Len(t, events, 1)
+	assert.Equal(t, "agent_recovered", events[0]["type"])
+	event := events[0]["data"].(map[string]interface{})
+	assert.Equal(t, 1, event["running_tasks"])
+	assert.Equal(t, 3, event["total_tasks"])
+}
+
+func TestAgentStats(t *testing.T) {
+	stateMgr, err := state.NewManager(t.TempDir())
+	require.NoError(t, err)
+	agent := &Agent{
+		config:    &config.Config{},
+		transport: &fakeTransport{},
+		stateMgr:  stateMgr,
+	}
+
+	// 首次连接不计为重连
+	agent.onConnectionState(websocket.StateConnected, nil)
+	agent.onConnectionState(websocket.StateDisconnected, nil)
+	agent.onConnectionState(websocket.StateReconnecting, nil)
+	agent.onConnectionState(websocket.StateConnected, nil)
+	agent.sendCommandResult(&executor.Result{ID: "c1", Success: true})
+	agent.sendCommandResult(&executor.Result{ID: "c2", Error: "exit status 1"})
+	agent.SetGauge("custom", 7)
+
+	status := agent.GetStatus()
+	assert.Equal(t, map[string]float64{"reconnects": 1, "commands_executed": 2, "commands_failed": 1}, status["counters"])
+	assert.NotContains(t, status, "connected")
+
+	// gRPC 传输层没有 connection_state，以 connected 表示连接状态
+	grpcClient, err := grpc.NewClient("127.0.0.1:1", "token")
+	require.NoError(t, err)
+	agent.transport = grpcClient
+	assert.Equal(t, false, agent.GetStatus()["connected"])
+	assert.Equal(t, map[string]float64{"custom": 7}, status["gauges"])
+}
+
+func TestAgentRestart(t *testing.T) {
+	agent := &Agent{running: true}
+	agent.ctx, agent.cancel = context.WithCancel(context.Background())
+
+	// replace 执行前 Agent 已停止
+	replaced := false
+	require.NoError(t, agent.Restart(func() error {
+		assert.False(t, agent.running)
+		assert.Error(t, agent.ctx.Err())
+		replaced = true
+		return nil
+	}))
+	assert.True(t, replaced)
+}
+
+func TestApplyConfig(t *testing.T) {
+	hb, err := heartbeat.New(30)
+	require.NoError(t, err)
+	agent := &Agent{heartbeat: hb, heartbeatReset: make(chan struct{}, 1)}
+
+	old := &config.Config{Agent: config.AgentConfig{Heartbeat: 30}, Logging: config.LoggingConfig{Level: "info"}}
+	cfg := &config.Config{Agent: config.AgentConfig{Heartbeat: 10}, Logging: config.LoggingConfig{Level: "info"}}
+	agent.applyConfig(old, cfg)
+	assert.Equal(t, 10, hb.GetInterval())
+	select {
+	case <-agent.heartbeatReset:
+	default:
+		t.Fatal("heartbeat loop not notified")
+	}
+
+	// 无效的心跳间隔忽略
+	agent.applyConfig(cfg, &config.Config{Agent: config.AgentConfig{Heartbeat: 0}})
+	assert.Equal(t, 10, hb.GetInterval())
+	assert.Len(t, agent.heartbeatReset, 0)
+
+	// 开启自适应心跳，无效的范围忽略
+	adaptive := &config.Config{Agent: config.AgentConfig{Heartbeat: 10, HeartbeatAdaptive: true, HeartbeatMin: 5, HeartbeatMax: 60}, Logging: cfg.Logging}
+	agent.applyConfig(cfg, adaptive)
+	assert.Len(t, agent.heartbeatReset, 1)
+	<-agent.heartbeatReset
+	assert.Equal(t, 5, hb.Adjust(true))
+	invalid := &config.Config{Agent: config.AgentConfig{Heartbeat: 10, HeartbeatAdaptive: true, HeartbeatMin: 60, HeartbeatMax: 5}, Logging: cfg.Logging}
+	agent.applyConfig(adaptive, invalid)
+	assert.Len(t, agent.heartbeatReset, 0)
+	assert.Equal(t, 5, hb.Adjust(true))
+}
+
+func TestAdaptiveHeartbeat(t *testing.T) {
+	hb, err := heartbeat.New(30)
+	require.NoError(t, err)
+	transport := &fakeTransport{}
+	agent := &Agent{config: &config.Config{}, transport: transport, heartbeat: hb, heartbeatReset: make(chan struct{}, 1)}
+
+	// 未开启自适应时收到命令不重置定时器
+	agent.onActivity()
+	assert.Len(t, agent.heartbeatReset, 0)
+	assert.False(t, agent.activeWork())
+
+	// 空闲间隔延长后，收到命令立即缩短为最小间隔
+	hb.SetAdaptive(true, 5, 120)
+	hb.NextInterval(false)
+	hb.NextInterval(false)
+	assert.Equal(t, 60, hb.EffectiveInterval())
+	agent.onActivity()
+	assert.Len(t, agent.heartbeatReset, 1)
+	assert.Equal(t, 5, hb.EffectiveInterval())
+
+	// 心跳告知服务器当前间隔
+	agent.sendHeartbeat()
+	_, data := transport.messages()
+	assert.Equal(t, 5, data[0].(map[string]interface{})["heartbeat_interval"])
+}
+
+func TestHandleGetProcesses(t *testing.T) {
+	collector, err := sysinfo.NewCollector()
+	require.NoError(t, err)
+	transport := &fakeTransport{}
+	agent := &Agent{transport: transport, sysinfo: collector}
+
+	require.NoError(t, agent.dispatchMessage("get_processes", map[string]interface{}{"sort_by": "memory", "limit": float64(3)}))
+	sent, data := transport.messages()
+	require.Equal(t, []string{"processes_result"}, sent)
+	result := data[0].(map[string]interface{})
+	processes := result["processes"].([]*sysinfo.ProcessInfo)
+	assert.LessOrEqual(t, len(processes), 3)
+	assert.Equal(t, len(processes), result["count"])
+	assert.GreaterOrEqual(t, result["total"], len(processes))
+
+	assert.Equal(t, 50, parseProcessQuery(nil).Limit)
+	assert.Error(t, agent.dispatchMessage("get_processes", map[string]interface{}{"sort_by": "threads"}))
+}
+
+func TestHandleReloadPlugins(t *testing.T) {
+	transport := &fakeTransport{}
+	cfg := &config.Config{Agent: config.AgentConfig{DataDir: t.TempDir()}}
+	agent := &Agent{config: cfg, transport: transport}
+	agent.pluginMgr = plugin.NewManager(agent, cfg)
+
+	// 未配置插件目录时返回错误结果
+	assert.Error(t, agent.dispatchMessage("reload_plugins", nil))
+
+	agent.pluginMgr.SetExternalDir(agent.externalPluginDir())
+	assert.Equal(t, filepath.Join(cfg.Agent.DataDir, "external_plugins"), agent.externalPluginDir())
+	require.NoError(t, agent.dispatchMessage("reload_plugins", nil))
+
+	sent, data := transport.messages()
+	require.Equal(t, []string{"reload_plugins_result", "reload_plugins_result"}, sent)
+	assert.Equal(t, false, data[0].(map[string]interface{})["success"])
+	response := data[1].(map[string]interface{})
+	assert.Equal(t, true, response["success"])
+	assert.Empty(t, response["result"].(*plugin.ReloadResult).Loaded)
+}
+
+func TestHandlePluginConfig(t *testing.T) {
+	transport := &fakeTransport{}
+	cfg := &config.Config{Agent: config.AgentConfig{DataDir: t.TempDir()}}
+	agent := &Agent{config: cfg, transport: transport}
+	agent.pluginMgr = plugin.NewManager(agent, cfg)
+	require.NoError(t, agent.pluginMgr.Register(monitor.NewMonitorPlugin()))
+
+	require.NoError(t, agent.dispatchMessage("plugin_config", map[string]interface{}{
+		"id":     "cfg-1",
+		"plugin": "system-monitor",
+		"config": map[string]interface{}{"collect_interval": "10s"},
+	}))
+	assert.Error(t, agent.dispatchMessage("plugin_config", map[string]interface{}{
+		"plugin": "missing",
+		"config": map[string]interface{}{"collect_interval": "10s"},
+	}))
+	assert.Error(t, agent.dispatchMessage("plugin_config", map[string]interface{}{"plugin": "system-monitor"}))
+
+	sent, data := transport.messages()
+	require.Equal(t, []string{"plugin_config_result", "plugin_config_result"}, sent)
+	response := data[0].(map[string]interface{})
+	assert.Equal(t, true, response["success"])
+	assert.Equal(t, "cfg-1", response["id"])
+	assert.Equal(t, "10s", response["config"].(map[string]interface{})["collect_interval"])
+	assert.Equal(t, false, data[1].(map[string]interface{})["success"])
+	assert.FileExists(t, filepath.Join(cfg.Agent.DataDir, "plugins", "system-monitor.json"))
+}
+
+func TestHandlePluginManage(t *testing.T) {
+	transport := &fakeTransport{}
+	cfg := &config.Config{Agent: config.AgentConfig{DataDir: t.TempDir()}}
+	agent := &Agent{config: cfg, transport: transport}
+	agent.pluginMgr = plugin.NewManager(agent, cfg)
+
+	assert.Error(t, agent.dispatchMessage("plugin_manage", map[string]interface{}{"action": "remove", "plugin": "hello"}))
+	assert.Error(t, agent.dispatchMessage("plugin_manage", map[string]interface{}{"action": "install"}))
+
+	// 未配置插件仓库时返回失败结果
+	assert.Error(t, agent.dispatchMessage("plugin_manage", map[string]interface{}{
+		"id":     "pm-1",
+		"action": "install",
+		"plugin": "hello",
+	}))
+	sent, data := transport.messages()
+	require.Equal(t, []string{"plugin_manage_result"}, sent)
+	response := data[0].(map[string]interface{})
+	assert.Equal(t, "pm-1", response["id"])
+	assert.Equal(t, false, response["success"])
+	assert.Contains(t, response["error"], "registry is not configured")
+}
+
+func TestHandlePluginCommandValidation(t *testing.T) {
+	transport := &fakeTransport{}
+	cfg := &config.Config{}
+	agent := &Agent{config: cfg, transport: transport}
+	agent.pluginMgr = plugin.NewManager(agent, cfg)
+	require.NoError(t, agent.pluginMgr.Register(filetransfer.NewFileTransferPlugin()))
+	require.NoError(t, agent.pluginMgr.StartPlugin("file-transfer"))
+	defer agent.pluginMgr.Stop()
+
+	err := agent.dispatchMessage("plugin", map[string]interface{}{
+		"id":      "plg-1",
+		"plugin":  "file-transfer",
+		"command": "upload",
+		"args":    map[string]interface{}{"source": "/tmp/a"},
+	})
+	assert.True(t, errors.Is(err, plugin.ErrInvalidArguments))
+
+	sent, data := transport.messages()
+	require.Equal(t, []string{"plugin_result"}, sent)
+	response := data[0].(map[string]interface{})
+	assert.Equal(t, "plg-1", response["id"])
+	assert.Equal(t, []plugin.FieldError{{Field: "destination", Message: "is required"}}, response["validation_errors"])
+
+	assert.EqualError(t, agent.dispatchMessage("plugin", map[string]interface{}{
+		"plugin":  "missing",
+		"command": "upload",
+	}), "plugin missing not found")
+}
+
+func TestHandleUpdate(t *testing.T) {
+	transport := &fakeTransport{}
+	cfg := &config.Config{Agent: config.AgentConfig{DataDir: t.TempDir()}}
+	agent := &Agent{config: cfg, transport: transport}
+	agent.pluginMgr = plugin.NewManager(agent, cfg)
+	require.NoError(t, agent.pluginMgr.Register(updater.NewUpdaterPlugin()))
+	require.NoError(t, agent.pluginMgr.StartPlugin("updater"))
+	defer agent.pluginMgr.Stop()
+
+	// 更新命令在后台执行，结果和错误都通过带请求 id 的 update_result 返回
+	require.NoError(t, agent.dispatchMessage("update", map[string]interface{}{"id": "u-1", "command": "get_version"}))
+	require.NoError(t, agent.dispatchMessage("update", map[string]interface{}{"id": "u-2", "command": "unknown"}))
+	agent.wg.Wait()
+
+	sent, data := transport.messages()
+	require.Equal(t, []string{"update_result", "update_result"}, sent)
+	responses := map[string]map[string]interface{}{}
+	for _, item := range data {
+		response := item.(map[string]interface{})
+		responses[response["id"].(string)] = response
+	}
+	assert.NotNil(t, responses["u-1"]["result"])
+	assert.Nil(t, responses["u-1"]["error"])
+	assert.Contains(t, responses["u-2"]["error"], "unknown command")
+}
+
+func TestPluginCommandCallsServer(t *testing.T) {
+	// 服务器下发 plugin 消息后应答插件发起的请求，最后收到 plugin_result
+	results := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := gws.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(websocket.Message{
+			Type: "plugin",
+			Data: map[string]interface{}{"id": "plg-2", "plugin": "password-manager", "command": "share_key"},
+		})
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			switch msg.Type {
+			case "password_share_key":
+				conn.WriteJSON(websocket.Message{Type: "reply", ReplyTo: msg.ID, Data: map[string]interface{}{}})
+			case "plugin_result":
+				results <- msg.Data.(map[string]interface{})
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, err := websocket.NewClient("ws"+server.URL[len("http"):], "")
+	require.NoError(t, err)
+	defer client.Stop()
+
+	t.Setenv("PASSWORD_MASTER_KEY", "master-password-for-test")
+	cfg := &config.Config{Agent: config.AgentConfig{DataDir: t.TempDir()}}
+	agent := &Agent{config: cfg, transport: client}
+	agent.ctx, agent.cancel = context.WithCancel(context.Background())
+	defer agent.cancel()
+	agent.pluginMgr = plugin.NewManager(agent, cfg)
+	require.NoError(t, agent.pluginMgr.Register(password.NewPasswordPlugin()))
+	require.NoError(t, agent.pluginMgr.StartPlugin("password-manager"))
+	defer agent.pluginMgr.Stop()
+
+	require.NoError(t, client.Connect())
+	go agent.receiveMessages()
+
+	select {
+	case response := <-results:
+		require.Nil(t, response["error"])
+		assert.Equal(t, "plg-2", response["id"])
+		result := response["result"].(map[string]interface{})
+		assert.NotEmpty(t, result["public_key"])
+		assert.Equal(t, true, result["published"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin command blocked the receive loop")
+	}
+}
+
+func TestHandleConfigUpdate(t *testing.T) {
+	transport := &fakeTransport{}
+	agent := &Agent{config: &config.Config{}, transport: transport}
+
+	assert.Error(t, agent.dispatchMessage("config_update", "invalid"))
+	assert.Error(t, agent.dispatchMessage("config_update", map[string]interface{}{"id": "cfg-1"}))
+
+	// 安全配置不能远程修改，结果中附带错误
+	assert.Error(t, agent.dispatchMessage("config_update", map[string]interface{}{
+		"id":     "cfg-2",
+		"config": map[string]interface{}{"security": map[string]interface{}{"token": "x"}},
+	}))
+	sent, data := transport.messages()
+	require.Equal(t, []string{"config_update_result"}, sent)
+	response := data[0].(map[string]interface{})
+	assert.Equal(t, "cfg-2", response["id"])
+	assert.Equal(t, false, response["success"])
+	assert.Contains(t, response["error"], "security.token")
+}
+
+func TestAgentSetConfig(t *testing.T) {
+	dataDir := t.TempDir()
+	settings, err := state.OpenSettings(dataDir)
+	require.NoError(t, err)
+	agent := &Agent{config: &config.Config{Agent: config.AgentConfig{Name: "edge"}}, settings: settings}
+
+	// 主配置文件中的配置段不能修改
+	for _, key := range []string{"agent.name", "security.token", "Server.host", "plugins.updater"} {
+		assert.Error(t, agent.SetConfig(key, "x"), key)
+	}
+	assert.Equal(t, "edge", agent.GetConfig("agent.name"))
+
+	// 动态配置保存在数据目录下，重启后可读取
+	require.NoError(t, agent.SetConfig("scheduler.last_run", "2024-01-01"))
+	assert.Equal(t, "2024-01-01", agent.GetConfig("scheduler.last_run"))
+	reopened, err := state.OpenSettings(dataDir)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-01", reopened.Get("scheduler.last_run"))
+
+	require.NoError(t, agent.SetConfig("scheduler.last_run", nil))
+	assert.Nil(t, agent.GetConfig("scheduler.last_run"))
+}
+
+func TestSendLogs(t *testing.T) {
+	transport := &fakeTransport{}
+	agent := &Agent{transport: transport, connState: string(websocket.StateReconnecting)}
+	records := []logger.Record{{Level: "warning", Message: "disk almost full"}}
+
+	// 未连接时返回错误，由日志上报写入磁盘缓存
+	assert.Error(t, agent.sendLogs(records, 0))
+
+	agent.connState = string(websocket.StateConnected)
+	require.NoError(t, agent.sendLogs(records, 2))
+	sent, data := transport.messages()
+	require.Equal(t, []string{"agent_logs"}, sent)
+	assert.Equal(t, map[string]interface{}{"logs": records, "dropped": int64(2)}, data[0])
 }
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/audit"
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/logger"
+	"assistant_agent/internal/plugin"
+)
+
+// maxRequestBodySize 插件命令请求体的最大字节数
+const maxRequestBodySize = 1 << 20
+
+// Response API 响应结构
+type Response struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// PluginSummary 插件概要信息
+type PluginSummary struct {
+	Info   *plugin.PluginInfo   `json:"info"`
+	Status *plugin.PluginStatus `json:"status"`
+}
+
+// Server 本地 HTTP API 服务
+type Server struct {
+	listen     string
+	token      string
+	agent      plugin.AgentInterface
+	pluginMgr  *plugin.Manager
+	auditor    *audit.Recorder
+	httpServer *http.Server
+	listener   net.Listener
+	mu         sync.Mutex
+}
+
+// NewServer 创建本地 HTTP API 服务
+func NewServer(cfg config.APIConfig, agent plugin.AgentInterface, pluginMgr *plugin.Manager) (*Server, error) {
+	if cfg.Listen == "" {
+		return nil, fmt.Errorf("api listen address is required")
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("api token is required")
+	}
+
+	s := &Server{
+		listen:    cfg.Listen,
+		token:     cfg.Token,
+		agent:     agent,
+		pluginMgr: pluginMgr,
+	}
+
+	s.httpServer = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// SetAuditor 设置审计记录器，设置后每次插件命令调用都会被记录
+func (s *Server) SetAuditor(auditor *audit.Recorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auditor = auditor
+}
+
+// Handler 返回 HTTP 处理器
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/status", s.handleStatus)
+	mux.HandleFunc("/api/v1/plugins", s.handlePlugins)
+	mux.HandleFunc("/api/v1/plugins/", s.handlePluginCommand)
+	return s.withAuth(mux)
+}
+
+// Start 启动 HTTP 服务
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", s.listen, err)
+	}
+	s.listener = listener
+
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("API server error: %v", err)
+		}
+	}()
+
+	logger.Infof("API server listening on %s", listener.Addr().String())
+	return nil
+}
+
+// Stop 停止 HTTP 服务
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		logger.Warnf("Failed to shutdown API server: %v", err)
+	}
+	s.listener = nil
+
+	logger.Info("API server stopped")
+}
+
+// Addr 返回实际监听地址
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return s.listen
+	}
+	return s.listener.Addr().String()
+}
+
+// withAuth 校验访问令牌，所有请求都必须携带令牌
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleStatus 处理状态查询
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: s.agent.GetStatus()})
+}
+
+// handlePlugins 处理插件列表查询
+func (s *Server) handlePlugins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	plugins := s.pluginMgr.ListPlugins()
+	summaries := make([]*PluginSummary, 0, len(plugins))
+	for _, p := range plugins {
+		summaries = append(summaries, &PluginSummary{
+			Info:   p.Info(),
+			Status: p.Status(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: summaries})
+}
+
+// handlePluginCommand 处理插件命令分发
+// 路径格式: POST /api/v1/plugins/{plugin}/commands/{command}
+func (s *Server) handlePluginCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/plugins/"), "/"), "/")
+	if len(parts) != 3 || parts[1] != "commands" || parts[0] == "" || parts[2] == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	pluginName, command := parts[0], parts[2]
+
+	// 请求体必须是 JSON，拒绝跨站表单等简单请求
+	args := make(map[string]interface{})
+	if r.ContentLength != 0 {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, "content type must be application/json")
+			return
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&args); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+
+	result, err := s.pluginMgr.SendCommand(pluginName, command, args)
+	s.recordAudit(pluginName+"."+command, args, err)
+	if err != nil {
+		// 参数校验失败时与 WebSocket 的 plugin_result 一样返回逐项错误
+		var validationErr *plugin.ValidationError
+		if errors.As(err, &validationErr) {
+			writeJSON(w, http.StatusBadRequest, Response{
+				Success: false,
+				Data:    map[string]interface{}{"validation_errors": validationErr.Fields},
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, plugin.ErrPluginNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, plugin.ErrPluginNotStarted):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, plugin.ErrInvalidCommand), errors.Is(err, plugin.ErrInvalidArguments):
+			status = http.StatusBadRequest
+		case errors.Is(err, plugin.ErrPermissionDenied):
+			status = http.StatusForbidden
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: result})
+}
+
+// recordAudit 记录插件命令调用审计事件
+func (s *Server) recordAudit(target string, args map[string]interface{}, err error) {
+	s.mu.Lock()
+	auditor := s.auditor
+	s.mu.Unlock()
+
+	if auditor == nil {
+		return
+	}
+	if auditErr := auditor.Record("plugin", audit.OriginAPI, target, args, audit.OutcomeSuccess, err); auditErr != nil {
+		logger.Errorf("Failed to record audit event: %v", auditErr)
+	}
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Warnf("Failed to write API response: %v", err)
+	}
+}
+
+// writeError 写入错误响应
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, Response{Success: false, Error: msg})
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/audit"
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/executor"
+	"assistant_agent/internal/logger"
+	"assistant_agent/internal/plugin"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	// 初始化配置和日志
+	config.Init()
+	logger.Init()
+}
+
+// mockAgent 模拟 Agent 接口
+type mockAgent struct{}
+
+func (m *mockAgent) GetSystemInfo() (map[string]interface{}, error) { return nil, nil }
+func (m *mockAgent) ExecuteCommand(command string, args []string, timeout time.Duration) (string, error) {
+	return "", nil
+}
+func (m *mockAgent) ExecuteScript(ref string, args []string, timeout time.Duration) (string, error) {
+	return "", nil
+}
+func (m *mockAgent) ExecuteCommandContext(ctx context.Context, command string, args []string, timeout time.Duration) (string, error) {
+	return "", nil
+}
+func (m *mockAgent) ExecuteScriptContext(ctx context.Context, ref string, args []string, timeout time.Duration) (string, error) {
+	return "", nil
+}
+func (m *mockAgent) RunCommand(ctx context.Context, cmd *executor.Command) (*executor.Result, error) {
+	return &executor.Result{ID: cmd.ID, Success: true}, nil
+}
+func (m *mockAgent) CallServer(msgType string, data interface{}, timeout time.Duration) (interface{}, error) {
+	return nil, nil
+}
+func (m *mockAgent) ReadFile(path string) ([]byte, error)          { return nil, nil }
+func (m *mockAgent) WriteFile(path string, data []byte) error      { return nil }
+func (m *mockAgent) FileExists(path string) bool                   { return false }
+func (m *mockAgent) GetConfig(key string) interface{}              { return nil }
+func (m *mockAgent) SetConfig(key string, value interface{}) error { return nil }
+func (m *mockAgent) SetStatus(key string, value interface{}) error { return nil }
+func (m *mockAgent) GetStatus() map[string]interface{} {
+	return map[string]interface{}{"running": true}
+}
+func (m *mockAgent) NotifyEvent(string, map[string]interface{}) error { return nil }
+
+// mockPlugin 模拟插件
+type mockPlugin struct{}
+
+func (p *mockPlugin) Info() *plugin.PluginInfo {
+	return &plugin.PluginInfo{Name: "mock", Version: "1.0.0"}
+}
+func (p *mockPlugin) Init(ctx *plugin.PluginContext) error { return nil }
+func (p *mockPlugin) Start() error                         { return nil }
+func (p *mockPlugin) Stop() error                          { return nil }
+func (p *mockPlugin) HandleCommand(command string, args map[string]interface{}) (interface{}, error) {
+	return args, nil
+}
+func (p *mockPlugin) HandleEvent(string, map[string]interface{}) error { return nil }
+func (p *mockPlugin) Status() *plugin.PluginStatus {
+	return &plugin.PluginStatus{Status: "stopped"}
+}
+func (p *mockPlugin) Health() error                                 { return nil }
+func (p *mockPlugin) GetConfig() map[string]interface{}             { return nil }
+func (p *mockPlugin) SetConfig(config map[string]interface{}) error { return nil }
+func (p *mockPlugin) CommandSchemas() map[string]*plugin.CommandSchema {
+	return map[string]*plugin.CommandSchema{
+		"echo": {Args: map[string]plugin.ArgSchema{"a": {Type: plugin.ArgInteger}}},
+	}
+}
+
+// testToken 测试服务使用的访问令牌
+const testToken = "secret"
+
+func newTestServer(t *testing.T) *Server {
+	cfg := &config.Config{Agent: config.AgentConfig{DataDir: t.TempDir()}}
+	agent := &mockAgent{}
+	mgr := plugin.NewManager(agent, cfg)
+	require.NoError(t, mgr.Register(&mockPlugin{}))
+
+	server, err := NewServer(config.APIConfig{Enabled: true, Listen: "127.0.0.1:0", Token: testToken}, agent, mgr)
+	require.NoError(t, err)
+	return server
+}
+
+// serve 携带访问令牌处理请求，有请求体时按 JSON 发送
+func serve(server *Server, req *http.Request) *httptest.ResponseRecorder {
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if req.ContentLength != 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) Response {
+	var resp Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestNewServerRequiresListen(t *testing.T) {
+	_, err := NewServer(config.APIConfig{}, &mockAgent{}, nil)
+	assert.Error(t, err)
+
+	// 没有令牌时拒绝启动，不允许未认证的访问
+	_, err = NewServer(config.APIConfig{Enabled: true, Listen: "127.0.0.1:0"}, &mockAgent{}, nil)
+	assert.Error(t, err)
+}
+
+func TestServerStatus(t *testing.T) {
+	server := newTestServer(t)
+
+	rec := serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	resp := decode(t, rec)
+	assert.True(t, resp.Success)
+	assert.Equal(t, true, resp.Data.(map[string]interface{})["running"])
+}
+
+func TestServerPlugins(t *testing.T) {
+	server := newTestServer(t)
+
+	rec := serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/plugins", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	resp := decode(t, rec)
+	assert.True(t, resp.Success)
+	assert.Len(t, resp.Data, 1)
+}
+
+func TestServerPluginCommand(t *testing.T) {
+	server := newTestServer(t)
+
+	// 插件未启动
+	rec := serve(server, httptest.NewRequest(http.MethodPost, "/api/v1/plugins/mock/commands/echo", strings.NewReader(`{"a":1}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	// 插件不存在
+	rec = serve(server, httptest.NewRequest(http.MethodPost, "/api/v1/plugins/missing/commands/echo", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// 路径错误
+	rec = serve(server, httptest.NewRequest(http.MethodPost, "/api/v1/plugins/mock/echo", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// 方法错误
+	rec = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/plugins/mock/commands/echo", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	// 请求体不是 JSON
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/plugins/mock/commands/echo", strings.NewReader("a=1"))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	// 请求体过大
+	body := `{"a":"` + strings.Repeat("x", maxRequestBodySize) + `"}`
+	rec = serve(server, httptest.NewRequest(http.MethodPost, "/api/v1/plugins/mock/commands/echo", strings.NewReader(body)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestServerAuth(t *testing.T) {
+	server := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/status", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	server.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServerStartStop(t *testing.T) {
+	server := newTestServer(t)
+
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+server.Addr()+"/api/v1/status", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServerPluginCommandAudit(t *testing.T) {
+	server := newTestServer(t)
+	recorder, err := audit.NewRecorder(filepath.Join(t.TempDir(), "audit.log"))
+	require.NoError(t, err)
+	server.SetAuditor(recorder)
+
+	rec := serve(server, httptest.NewRequest(http.MethodPost, "/api/v1/plugins/missing/commands/echo", strings.NewReader(`{"a":1}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	events, err := recorder.Events()
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, audit.OriginAPI, events[0].Origin)
+	assert.Equal(t, "missing.echo", events[0].Target)
+	assert.Equal(t, audit.OutcomeFailure, events[0].Outcome)
+	assert.Equal(t, audit.HashArgs(map[string]interface{}{"a": float64(1)}), events[0].ArgsHash)
+}
+
+func TestServerPluginCommandValidation(t *testing.T) {
+	server := newTestServer(t)
+	require.NoError(t, server.pluginMgr.StartPlugin("mock"))
+
+	// 参数校验失败返回 400 和逐项错误
+	rec := serve(server, httptest.NewRequest(http.MethodPost, "/api/v1/plugins/mock/commands/echo", strings.NewReader(`{"a":"x"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	resp := decode(t, rec)
+	assert.False(t, resp.Success)
+	fields := resp.Data.(map[string]interface{})["validation_errors"].([]interface{})
+	require.Len(t, fields, 1)
+	assert.Equal(t, "a", fields[0].(map[string]interface{})["field"])
+
+	rec = serve(server, httptest.NewRequest(http.MethodPost, "/api/v1/plugins/mock/commands/echo", strings.NewReader(`{"a":1}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, map[string]interface{}{"a": float64(1)}, decode(t, rec).Data)
+}
@@ -0,0 +1,219 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/logger"
+)
+
+// 审计事件来源
+const (
+	OriginServer = "server" // 服务器下发
+	OriginAPI    = "api"    // 本地 HTTP API
+	OriginPlugin = "plugin" // 插件内部调用
+)
+
+// 审计事件结果
+const (
+	OutcomeSuccess  = "success"
+	OutcomeFailure  = "failure"
+	OutcomeAccepted = "accepted" // 已接收，结果异步产生
+)
+
+// Event 审计事件
+type Event struct {
+	Seq       int64     `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"` // command、plugin、file_transfer、config_change 等
+	Origin    string    `json:"origin"`
+	Target    string    `json:"target,omitempty"`
+	ArgsHash  string    `json:"args_hash,omitempty"` // 参数 JSON 的 SHA-256，避免记录敏感明文
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	PrevHash  string    `json:"prev_hash"` // 上一条事件的哈希，形成防篡改链
+	Hash      string    `json:"hash"`
+}
+
+// Forwarder 审计事件转发函数，用于将事件上报到服务器
+type Forwarder func(event *Event) error
+
+// Recorder 审计记录器，以只追加的 JSON Lines 文件持久化事件
+type Recorder struct {
+	path      string
+	seq       int64
+	lastHash  string
+	forwarder Forwarder
+	mu        sync.Mutex
+}
+
+// NewRecorder 创建审计记录器，已有审计文件时从最后一条事件继续
+func NewRecorder(path string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{path: path}
+	events, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > 0 {
+		last := events[len(events)-1]
+		r.seq = last.Seq
+		r.lastHash = last.Hash
+	}
+
+	return r, nil
+}
+
+// SetForwarder 设置事件转发函数，传入 nil 表示不转发
+func (r *Recorder) SetForwarder(forwarder Forwarder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.forwarder = forwarder
+}
+
+// Record 记录一条审计事件，args 会被序列化后计算哈希，err 不为空时结果记为失败
+func (r *Recorder) Record(action, origin, target string, args interface{}, outcome string, err error) error {
+	event := &Event{
+		Timestamp: time.Now().UTC(),
+		Action:    action,
+		Origin:    origin,
+		Target:    target,
+		ArgsHash:  HashArgs(args),
+		Outcome:   outcome,
+	}
+	if err != nil {
+		event.Outcome = OutcomeFailure
+		event.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	event.Seq = r.seq + 1
+	event.PrevHash = r.lastHash
+	event.Hash = eventHash(event)
+
+	data, marshalErr := json.Marshal(event)
+	if marshalErr != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("failed to marshal audit event: %v", marshalErr)
+	}
+
+	if writeErr := r.append(data); writeErr != nil {
+		r.mu.Unlock()
+		return writeErr
+	}
+	r.seq = event.Seq
+	r.lastHash = event.Hash
+	forwarder := r.forwarder
+	r.mu.Unlock()
+
+	// 转发失败不影响本地记录
+	if forwarder != nil {
+		if fwdErr := forwarder(event); fwdErr != nil {
+			return fmt.Errorf("failed to forward audit event: %v", fwdErr)
+		}
+	}
+	return nil
+}
+
+// Events 读取全部审计事件
+func (r *Recorder) Events() ([]*Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load()
+}
+
+// Verify 校验审计文件的哈希链，返回第一处被篡改或缺失的事件序号
+func (r *Recorder) Verify() error {
+	events, err := r.Events()
+	if err != nil {
+		return err
+	}
+
+	prevHash := ""
+	for i, event := range events {
+		if event.Seq != int64(i+1) {
+			return fmt.Errorf("audit event sequence broken at %d", i+1)
+		}
+		if event.PrevHash != prevHash || event.Hash != eventHash(event) {
+			return fmt.Errorf("audit event %d has been tampered with", event.Seq)
+		}
+		prevHash = event.Hash
+	}
+	return nil
+}
+
+// HashArgs 计算参数 JSON 的 SHA-256，参数为空时返回空字符串
+func HashArgs(args interface{}) string {
+	if args == nil {
+		return ""
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%v", args))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// eventHash 计算事件哈希，覆盖除 Hash 外的全部字段
+func eventHash(event *Event) string {
+	copied := *event
+	copied.Hash = ""
+	data, _ := json.Marshal(&copied)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// append 以追加方式写入一行并落盘
+func (r *Recorder) append(data []byte) error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// load 读取审计文件
+func (r *Recorder) load() ([]*Event, error) {
+	file, err := os.Open(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []*Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		// 损坏的记录跳过，由 Verify 报告哈希链断裂
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			logger.Warnf("Skipping corrupted audit log entry: %v", err)
+			continue
+		}
+		events = append(events, &event)
+	}
+
+	return events, scanner.Err()
+}
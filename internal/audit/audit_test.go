@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	// 初始化配置和日志
+	config.Init()
+	logger.Init()
+}
+
+func TestRecorderRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	recorder, err := NewRecorder(path)
+	require.NoError(t, err)
+
+	args := map[string]interface{}{"command": "echo secret"}
+	require.NoError(t, recorder.Record("command", OriginServer, "cmd-1", args, OutcomeAccepted, nil))
+	require.NoError(t, recorder.Record("plugin", OriginAPI, "monitor.status", nil, OutcomeSuccess, errors.New("boom")))
+
+	events, err := recorder.Events()
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, int64(1), events[0].Seq)
+	assert.Equal(t, "command", events[0].Action)
+	assert.Equal(t, OriginServer, events[0].Origin)
+	assert.Equal(t, OutcomeAccepted, events[0].Outcome)
+	assert.Equal(t, HashArgs(args), events[0].ArgsHash)
+	assert.Empty(t, events[0].PrevHash)
+
+	assert.Equal(t, OutcomeFailure, events[1].Outcome)
+	assert.Equal(t, "boom", events[1].Error)
+	assert.Equal(t, events[0].Hash, events[1].PrevHash)
+
+	// 参数只记录哈希
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+
+	require.NoError(t, recorder.Verify())
+}
+
+func TestRecorderResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	recorder, err := NewRecorder(path)
+	require.NoError(t, err)
+	require.NoError(t, recorder.Record("command", OriginServer, "cmd-1", nil, OutcomeSuccess, nil))
+
+	// 重新打开后继续哈希链
+	reopened, err := NewRecorder(path)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Record("command", OriginServer, "cmd-2", nil, OutcomeSuccess, nil))
+
+	events, err := reopened.Events()
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(2), events[1].Seq)
+	require.NoError(t, reopened.Verify())
+}
+
+func TestRecorderVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	recorder, err := NewRecorder(path)
+	require.NoError(t, err)
+	for _, target := range []string{"a", "b", "c"} {
+		require.NoError(t, recorder.Record("command", OriginServer, target, nil, OutcomeSuccess, nil))
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// 修改事件内容
+	tampered := strings.Replace(string(data), `"target":"b"`, `"target":"x"`, 1)
+	require.NoError(t, os.WriteFile(path, []byte(tampered), 0600))
+	assert.Error(t, recorder.Verify())
+
+	// 删除事件
+	lines := strings.SplitAfter(string(data), "\n")
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+lines[2]), 0600))
+	assert.Error(t, recorder.Verify())
+}
+
+func TestRecorderForwarder(t *testing.T) {
+	recorder, err := NewRecorder(filepath.Join(t.TempDir(), "audit.log"))
+	require.NoError(t, err)
+
+	var forwarded []*Event
+	recorder.SetForwarder(func(event *Event) error {
+		forwarded = append(forwarded, event)
+		return nil
+	})
+	require.NoError(t, recorder.Record("file_transfer", OriginServer, "/tmp/a", nil, OutcomeSuccess, nil))
+	require.Len(t, forwarded, 1)
+	assert.Equal(t, "file_transfer", forwarded[0].Action)
+
+	// 转发失败时本地记录仍保留
+	recorder.SetForwarder(func(event *Event) error { return errors.New("offline") })
+	assert.Error(t, recorder.Record("command", OriginServer, "", nil, OutcomeSuccess, nil))
+	events, err := recorder.Events()
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/spf13/viper"
 )
@@ -15,28 +16,72 @@ type Config struct {
 	Agent    AgentConfig    `mapstructure:"agent"`
 	Logging  LoggingConfig  `mapstructure:"logging"`
 	Security SecurityConfig `mapstructure:"security"`
+	API      APIConfig      `mapstructure:"api"`
+	Audit    AuditConfig    `mapstructure:"audit"`
+
+	// Plugins 按插件名配置插件，启动时合并到插件配置，字符串中的 ${VAR} 展开为环境变量
+	Plugins map[string]map[string]interface{} `mapstructure:"plugins"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
-	URL  string `mapstructure:"url"`
+	Host        string `mapstructure:"host"`
+	Port        int    `mapstructure:"port"`
+	URL         string `mapstructure:"url"`
+	Protocol    string `mapstructure:"protocol"`     // websocket 或 grpc
+	GRPCAddress string `mapstructure:"grpc_address"` // gRPC 服务地址
+	OutboxSize  int    `mapstructure:"outbox_size"`  // 断线期间最多缓存的待确认消息数
+
+	Compression      bool `mapstructure:"compression"`        // 是否启用 permessage-deflate 压缩
+	BatchWindow      int  `mapstructure:"batch_window"`       // 小消息合并窗口（毫秒），0 表示不合并
+	BatchMaxMessages int  `mapstructure:"batch_max_messages"` // 单个批次最多合并的消息数
+	GRPCPlaintext    bool `mapstructure:"grpc_plaintext"`     // gRPC 不使用 TLS，仅限本机或受信任网络，此时不发送令牌
 }
 
 // AgentConfig 代理配置
 type AgentConfig struct {
-	ID            string `mapstructure:"id"`
-	Name          string `mapstructure:"name"`
-	Version       string `mapstructure:"version"`
-	Heartbeat     int    `mapstructure:"heartbeat"`
-	MaxRetries    int    `mapstructure:"max_retries"`
-	RetryDelay    int    `mapstructure:"retry_delay"`
-	WorkDir       string `mapstructure:"work_dir"`
-	TempDir       string `mapstructure:"temp_dir"`
-	LogDir        string `mapstructure:"log_dir"`
-	DataDir       string `mapstructure:"data_dir"`
-	ContainerMode bool   `mapstructure:"container_mode"`
+	ID               string `mapstructure:"id"`
+	Name             string `mapstructure:"name"`
+	Version          string `mapstructure:"version"`
+	Heartbeat        int    `mapstructure:"heartbeat"`
+	HeartbeatFails   int    `mapstructure:"heartbeat_max_failures"`
+	HeartbeatTimeout int    `mapstructure:"heartbeat_timeout"` // 等待服务器响应 ping 的时间（秒），不超过心跳间隔
+	SysinfoInterval  int    `mapstructure:"sysinfo_interval"`  // 系统信息上报间隔（秒），0 表示不上报
+	MaxRetries       int    `mapstructure:"max_retries"`
+	RetryDelay       int    `mapstructure:"retry_delay"`
+	RetryMaxDelay    int    `mapstructure:"retry_max_delay"`
+	WorkDir          string `mapstructure:"work_dir"`
+	TempDir          string `mapstructure:"temp_dir"`
+	LogDir           string `mapstructure:"log_dir"`
+	DataDir          string `mapstructure:"data_dir"`
+	ContainerMode    bool   `mapstructure:"container_mode"` // 运行在容器内，系统信息以 cgroup 限制为准
+	CommandWorkers   int    `mapstructure:"command_workers"`
+	CommandQueueSize int    `mapstructure:"command_queue_size"`
+	MaxOutputSize    int64  `mapstructure:"max_output_size"`
+	CombinedOutput   bool   `mapstructure:"combined_output"`
+	HistoryMax       int    `mapstructure:"history_max_entries"`
+	ContainerRuntime string `mapstructure:"container_runtime"`
+	NetworkEnv       bool   `mapstructure:"network_env"`   // 上报 DNS、默认网关、代理和公网 IP
+	PublicIPURL      string `mapstructure:"public_ip_url"` // 返回公网 IP 的服务地址，为空时不查询
+	JournalSync      string `mapstructure:"journal_sync"`  // 状态变化日志落盘方式：always、interval 或 none
+	StateBackend     string `mapstructure:"state_backend"` // 状态存储后端：bolt 或 json
+
+	HeartbeatAdaptive bool `mapstructure:"heartbeat_adaptive"` // 按活动调整心跳间隔
+	HeartbeatMin      int  `mapstructure:"heartbeat_min"`      // 自适应模式下有命令或文件传输进行时的间隔（秒）
+	HeartbeatMax      int  `mapstructure:"heartbeat_max"`      // 自适应模式下空闲时的最大间隔（秒）
+
+	PluginDir         string `mapstructure:"plugin_dir"`          // 外部插件目录，为空时使用 data_dir/external_plugins
+	PluginRegistry    string `mapstructure:"plugin_registry"`     // 插件仓库地址
+	PluginRegistryKey string `mapstructure:"plugin_registry_key"` // 插件签名公钥（Ed25519，base64）
+
+	Interpreters map[string]InterpreterConfig `mapstructure:"interpreters"`
+}
+
+// InterpreterConfig 脚本解释器配置
+type InterpreterConfig struct {
+	Extension string   `mapstructure:"extension"`
+	Timeout   int      `mapstructure:"timeout"`
+	Env       []string `mapstructure:"env"`
 }
 
 // LoggingConfig 日志配置
@@ -44,6 +89,52 @@ type LoggingConfig struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
 	File   string `mapstructure:"file"`
+
+	MaxSize    int  `mapstructure:"max_size"`    // 单个日志文件的最大大小（MB），超过后轮转，0 表示不轮转
+	MaxBackups int  `mapstructure:"max_backups"` // 保留的轮转文件数，0 表示不限制
+	MaxAge     int  `mapstructure:"max_age"`     // 轮转文件的保留天数，0 表示不限制
+	Compress   bool `mapstructure:"compress"`    // 是否以 gzip 压缩轮转文件
+
+	Components map[string]string `mapstructure:"components"` // 按组件（如 websocket、插件名）单独设置日志级别
+
+	Redact   LogRedactConfig   `mapstructure:"redact"`
+	Ship     LogShipConfig     `mapstructure:"ship"`
+	Syslog   LogSyslogConfig   `mapstructure:"syslog"`
+	EventLog LogEventLogConfig `mapstructure:"eventlog"`
+}
+
+// LogRedactConfig 日志脱敏配置，在写入文件、syslog 和上报之前替换敏感内容
+type LogRedactConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Fields   []string `mapstructure:"fields"`   // 敏感字段名关键词，字段名或 key=value 的键包含任一关键词（忽略大小写、_ 和 -）时替换值
+	Patterns []string `mapstructure:"patterns"` // 额外的正则，匹配的内容被替换，有 secret 命名分组时只替换该分组
+}
+
+// LogShipConfig 日志上报配置，将日志以 agent_logs 消息发送到服务器
+type LogShipConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Level         string `mapstructure:"level"`          // 上报的最低级别
+	BatchSize     int    `mapstructure:"batch_size"`     // 每条消息最多包含的日志数
+	FlushInterval int    `mapstructure:"flush_interval"` // 发送间隔（秒）
+	BufferSize    int    `mapstructure:"buffer_size"`    // 内存中缓存的日志数，超出后写入数据目录下的 log_spool.jsonl
+	MaxSpillSize  int    `mapstructure:"max_spill_size"` // 磁盘缓存的最大大小（MB），超出后丢弃新日志
+}
+
+// LogSyslogConfig syslog 输出配置，与日志文件同时输出
+type LogSyslogConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Network  string `mapstructure:"network"`  // udp 或 tcp 发送到远程 syslog（RFC5424），为空时写入本机 syslog
+	Address  string `mapstructure:"address"`  // 远程 syslog 地址，如 10.0.0.1:514
+	Facility string `mapstructure:"facility"` // 如 daemon、local0
+	Tag      string `mapstructure:"tag"`      // 程序名
+	Level    string `mapstructure:"level"`    // 输出的最低级别
+}
+
+// LogEventLogConfig Windows 事件日志输出配置
+type LogEventLogConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Source  string `mapstructure:"source"` // 事件源名称
+	Level   string `mapstructure:"level"`  // 输出的最低级别
 }
 
 // SecurityConfig 安全配置
@@ -51,13 +142,55 @@ type SecurityConfig struct {
 	Token     string `mapstructure:"token"`
 	CertFile  string `mapstructure:"cert_file"`
 	KeyFile   string `mapstructure:"key_file"`
+	CAFile    string `mapstructure:"ca_file"` // 自定义 CA 证书，用于自建服务端
 	VerifySSL bool   `mapstructure:"verify_ssl"`
+
+	CommandPolicy CommandPolicyConfig `mapstructure:"command_policy"`
+
+	// PluginPermissions 按插件名覆盖插件声明的权限
+	PluginPermissions map[string]PluginPermissionConfig `mapstructure:"plugin_permissions"`
+}
+
+// PluginPermissionConfig 插件权限配置
+type PluginPermissionConfig struct {
+	Exec        bool     `mapstructure:"exec"`         // 允许执行命令、脚本和程序，以及重启 Agent
+	ReadPaths   []string `mapstructure:"read_paths"`   // 允许读取的目录
+	WritePaths  []string `mapstructure:"write_paths"`  // 允许写入的目录
+	ConfigWrite bool     `mapstructure:"config_write"` // 允许修改配置
+	Server      bool     `mapstructure:"server"`       // 允许向服务器发起请求
+}
+
+// CommandPolicyConfig 命令安全策略配置
+type CommandPolicyConfig struct {
+	Enabled         bool     `mapstructure:"enabled"`
+	AllowBinaries   []string `mapstructure:"allow_binaries"`
+	DenyBinaries    []string `mapstructure:"deny_binaries"`
+	DenyPatterns    []string `mapstructure:"deny_patterns"`
+	ConfirmPatterns []string `mapstructure:"confirm_patterns"`
+	ForbiddenPaths  []string `mapstructure:"forbidden_paths"`
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	File    string `mapstructure:"file"`    // 审计文件名，位于数据目录下
+	Forward bool   `mapstructure:"forward"` // 是否将审计事件转发到服务器
+}
+
+// APIConfig 本地 HTTP API 配置
+type APIConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Listen  string `mapstructure:"listen"`
+	Token   string `mapstructure:"token"`
 }
 
 var (
 	// GlobalConfig 全局配置实例
 	GlobalConfig *Config
 	configFile   = "config.yaml"
+
+	// configMu 保护 GlobalConfig 指针，Reload 时整体替换
+	configMu sync.RWMutex
 )
 
 // getSystemDirectories 获取系统标准目录
@@ -181,11 +314,21 @@ func Init() error {
 		// 配置文件不存在，使用默认配置
 	}
 
-	// 解析配置
-	GlobalConfig = &Config{}
-	if err := viper.Unmarshal(GlobalConfig); err != nil {
+	// 解析配置，数据目录中有服务器下发的配置时叠加后重新解析
+	cfg, err := load(nil)
+	if err != nil {
 		return err
 	}
+	loadOverrides(cfg.Agent.DataDir)
+	if overrides := RemoteOverrides(); len(overrides) > 0 {
+		if cfg, err = load(overrides); err != nil {
+			return err
+		}
+	}
+	if err := validate(cfg); err != nil {
+		return err
+	}
+	GlobalConfig = cfg
 
 	// 创建必要的目录
 	if err := createDirectories(); err != nil {
@@ -200,14 +343,41 @@ func setDefaults() {
 	viper.SetDefault("server.host", "localhost")
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.url", "ws://localhost:8080/ws")
+	viper.SetDefault("server.protocol", "websocket")
+	viper.SetDefault("server.grpc_address", "localhost:9090")
+	viper.SetDefault("server.grpc_plaintext", false)
+	viper.SetDefault("server.outbox_size", 10000)
+	viper.SetDefault("server.compression", true)
+	viper.SetDefault("server.batch_window", 0)
+	viper.SetDefault("server.batch_max_messages", 50)
 
 	viper.SetDefault("agent.id", "")
 	viper.SetDefault("agent.name", "assistant-agent")
 	viper.SetDefault("agent.version", "1.0.0")
 	viper.SetDefault("agent.heartbeat", 30)
+	viper.SetDefault("agent.heartbeat_max_failures", 3)
+	viper.SetDefault("agent.heartbeat_timeout", 10)
+	viper.SetDefault("agent.heartbeat_adaptive", false)
+	viper.SetDefault("agent.heartbeat_min", 10)
+	viper.SetDefault("agent.heartbeat_max", 300)
+	viper.SetDefault("agent.sysinfo_interval", 300)
 	viper.SetDefault("agent.max_retries", 3)
 	viper.SetDefault("agent.retry_delay", 5)
+	viper.SetDefault("agent.retry_max_delay", 300)
 	viper.SetDefault("agent.container_mode", false)
+	viper.SetDefault("agent.command_workers", 4)
+	viper.SetDefault("agent.command_queue_size", 100)
+	viper.SetDefault("agent.max_output_size", 10485760)
+	viper.SetDefault("agent.combined_output", true)
+	viper.SetDefault("agent.history_max_entries", 1000)
+	viper.SetDefault("agent.container_runtime", "docker")
+	viper.SetDefault("agent.network_env", false)
+	viper.SetDefault("agent.public_ip_url", "")
+	viper.SetDefault("agent.journal_sync", "interval")
+	viper.SetDefault("agent.state_backend", "bolt")
+	viper.SetDefault("agent.plugin_dir", "")
+	viper.SetDefault("agent.plugin_registry", "")
+	viper.SetDefault("agent.plugin_registry_key", "")
 
 	// 使用系统标准目录
 	tempDir, logDir, workDir, dataDir := getSystemDirectories()
@@ -219,11 +389,44 @@ func setDefaults() {
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 	viper.SetDefault("logging.file", "assistant_agent.log")
+	viper.SetDefault("logging.max_size", 100)
+	viper.SetDefault("logging.max_backups", 10)
+	viper.SetDefault("logging.max_age", 30)
+	viper.SetDefault("logging.compress", true)
+	viper.SetDefault("logging.redact.enabled", true)
+	viper.SetDefault("logging.redact.fields", []string{"password", "passwd", "secret", "token", "api_key", "access_key", "private_key", "authorization", "credential"})
+	viper.SetDefault("logging.redact.patterns", []string{})
+	viper.SetDefault("logging.ship.enabled", false)
+	viper.SetDefault("logging.ship.level", "warn")
+	viper.SetDefault("logging.ship.batch_size", 100)
+	viper.SetDefault("logging.ship.flush_interval", 5)
+	viper.SetDefault("logging.ship.buffer_size", 1000)
+	viper.SetDefault("logging.ship.max_spill_size", 10)
+	viper.SetDefault("logging.syslog.enabled", false)
+	viper.SetDefault("logging.syslog.network", "")
+	viper.SetDefault("logging.syslog.address", "")
+	viper.SetDefault("logging.syslog.facility", "daemon")
+	viper.SetDefault("logging.syslog.tag", "assistant_agent")
+	viper.SetDefault("logging.syslog.level", "info")
+	viper.SetDefault("logging.eventlog.enabled", false)
+	viper.SetDefault("logging.eventlog.source", "AssistantAgent")
+	viper.SetDefault("logging.eventlog.level", "warn")
 
 	viper.SetDefault("security.token", "")
 	viper.SetDefault("security.cert_file", "")
 	viper.SetDefault("security.key_file", "")
+	viper.SetDefault("security.ca_file", "")
 	viper.SetDefault("security.verify_ssl", true)
+	viper.SetDefault("security.command_policy.enabled", true)
+
+	// 审计日志默认配置
+	viper.SetDefault("audit.enabled", true)
+	viper.SetDefault("audit.file", "audit.log")
+	viper.SetDefault("audit.forward", false)
+
+	viper.SetDefault("api.enabled", false)
+	viper.SetDefault("api.listen", "127.0.0.1:8090")
+	viper.SetDefault("api.token", "")
 }
 
 // createDirectories 创建必要的目录
@@ -246,5 +449,7 @@ func createDirectories() error {
 
 // GetConfig 获取全局配置
 func GetConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
 	return GlobalConfig
 }
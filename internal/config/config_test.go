@@ -5,7 +5,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -209,4 +211,183 @@ func TestCanWrite(t *testing.T) {
 	if runtime.GOOS != "windows" {
 		assert.False(t, canWrite("/root"))
 	}
-} 
\ No newline at end of file
+} 
+func TestReload(t *testing.T) {
+	configFilePath := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(configFilePath, []byte(content), 0644))
+	}
+	write("agent:\n  heartbeat: 30\nlogging:\n  level: info\n")
+
+	GlobalConfig = nil
+	require.NoError(t, Init())
+	viper.SetConfigFile(configFilePath)
+	require.NoError(t, Reload())
+	assert.Equal(t, "info", GetConfig().Logging.Level)
+
+	// 重新加载后通知订阅者
+	var changes [][2]*Config
+	cancel := OnChange(func(old, new *Config) {
+		changes = append(changes, [2]*Config{old, new})
+	})
+	write("agent:\n  heartbeat: 10\nlogging:\n  level: debug\n")
+	require.NoError(t, Reload())
+	require.Len(t, changes, 1)
+	assert.Equal(t, "info", changes[0][0].Logging.Level)
+	assert.Equal(t, "debug", changes[0][1].Logging.Level)
+	assert.Equal(t, 10, GetConfig().Agent.Heartbeat)
+
+	// 配置文件无效时保留原配置
+	write("logging: [")
+	assert.Error(t, Reload())
+	assert.Equal(t, "debug", GetConfig().Logging.Level)
+
+	// 启用本地 API 但没有配置令牌时拒绝加载
+	write("api:\n  enabled: true\n")
+	assert.Error(t, Reload())
+	assert.False(t, GetConfig().API.Enabled)
+
+	// 取消订阅后不再通知
+	cancel()
+	write("logging:\n  level: warn\n")
+	require.NoError(t, Reload())
+	assert.Len(t, changes, 1)
+
+	// 监听文件变化自动重新加载
+	stop, err := Watch(nil)
+	require.NoError(t, err)
+	defer stop()
+	write("logging:\n  level: error\n")
+	assert.Eventually(t, func() bool {
+		return GetConfig().Logging.Level == "error"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestRemoteConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	configFilePath := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFilePath, []byte("agent:\n  data_dir: "+dataDir+"\n  heartbeat: 30\nlogging:\n  level: info\n  format: text\n"), 0644))
+	t.Setenv("ASSISTANT_AGENT_AGENT_HEARTBEAT", "20")
+
+	GlobalConfig = nil
+	require.NoError(t, Init())
+	viper.SetConfigFile(configFilePath)
+	require.NoError(t, Reload())
+	loadOverrides(dataDir)
+	require.NoError(t, Reload())
+	assert.Equal(t, 20, GetConfig().Agent.Heartbeat) // 环境变量优先于配置文件
+
+	// 远程配置优先于环境变量，嵌套对象和 logging.level 形式的键均可
+	overrides, err := UpdateRemote(map[string]interface{}{
+		"logging":         map[string]interface{}{"level": "debug"},
+		"agent.heartbeat": 15.0,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"logging.level": "debug", "agent.heartbeat": 15.0}, overrides)
+	assert.Equal(t, "debug", GetConfig().Logging.Level)
+	assert.Equal(t, 15, GetConfig().Agent.Heartbeat)
+	assert.FileExists(t, filepath.Join(dataDir, remoteConfigFile))
+
+	// 拒绝本地配置项、未知配置项和无效的值，原配置不变
+	for _, update := range []map[string]interface{}{
+		{"security.token": "x"},
+		{"security": map[string]interface{}{"verify_ssl": false}},
+		{"api.enabled": true},
+		{"api": map[string]interface{}{"listen": "0.0.0.0:8090"}},
+		{"agent.data_dir": "/tmp"},
+		{"server.grpc_plaintext": true},
+		{"agent.unknown": 1.0},
+		{"agent.heartbeat": "abc"},
+		{"agent.heartbeat": 0.0},
+		{"logging.level": "verbose"},
+		{"logging.components.websocket": "loud"},
+		{"agent.heartbeat_adaptive": true, "agent.heartbeat_min": 60.0, "agent.heartbeat_max": 30.0},
+		{},
+	} {
+		_, err := UpdateRemote(update)
+		assert.Error(t, err, update)
+	}
+	assert.Equal(t, 15, GetConfig().Agent.Heartbeat)
+
+	// 重启后从数据目录加载远程配置
+	GlobalConfig = nil
+	require.NoError(t, Init())
+	assert.Equal(t, "debug", GetConfig().Logging.Level)
+
+	// 值为 null 时恢复为本地配置
+	overrides, err = UpdateRemote(map[string]interface{}{"agent.heartbeat": nil})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"logging.level": "debug"}, overrides)
+	assert.Equal(t, 20, GetConfig().Agent.Heartbeat)
+}
+
+func TestSecretValues(t *testing.T) {
+	t.Setenv(SecretKeyEnv, "test-key")
+
+	encrypted, err := EncryptValue("s3cret", "enc")
+	require.NoError(t, err)
+	assert.True(t, IsSecret(encrypted))
+	assert.NotContains(t, encrypted, "s3cret")
+	plaintext, err := DecryptValue(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", plaintext)
+
+	// 普通值原样返回
+	plaintext, err = DecryptValue("plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", plaintext)
+
+	// 无效的加密值和钥匙串引用
+	_, err = DecryptValue("enc:!!!")
+	assert.Error(t, err)
+	_, err = DecryptValue("keyring:no-account")
+	assert.Error(t, err)
+	_, err = EncryptValue("s3cret", "rot13")
+	assert.Error(t, err)
+
+	// 加载配置时自动解密
+	configFilePath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFilePath, []byte("security:\n  token: "+encrypted+"\n"), 0644))
+	t.Cleanup(func() {
+		// 清除 viper 中的加密值，避免影响后续测试
+		os.WriteFile(configFilePath, nil, 0644)
+		viper.ReadInConfig()
+	})
+	GlobalConfig = nil
+	require.NoError(t, Init())
+	viper.SetConfigFile(configFilePath)
+	require.NoError(t, Reload())
+	assert.Equal(t, "s3cret", GetConfig().Security.Token)
+
+	// 换了密钥后无法解密，保留原配置
+	t.Setenv(SecretKeyEnv, "other-key")
+	_, err = DecryptValue(encrypted)
+	assert.Error(t, err)
+	assert.Error(t, Reload())
+	assert.Equal(t, "s3cret", GetConfig().Security.Token)
+}
+
+func TestPluginsConfig(t *testing.T) {
+	t.Setenv("TEST_PLUGIN_URL", "https://updates.example.com")
+	configFilePath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFilePath, []byte(`plugins:
+  updater:
+    update_url: "${TEST_PLUGIN_URL}/agent"
+    channel: stable
+    password: "pa$$word"
+    mirrors: ["${TEST_PLUGIN_URL}", "${TEST_PLUGIN_UNSET}"]
+`), 0644))
+
+	GlobalConfig = nil
+	require.NoError(t, Init())
+	viper.SetConfigFile(configFilePath)
+	require.NoError(t, Reload())
+
+	// ${VAR} 展开为环境变量，其他 $ 保持原样
+	updater := GetConfig().Plugins["updater"]
+	assert.Equal(t, "https://updates.example.com/agent", updater["update_url"])
+	assert.Equal(t, "stable", updater["channel"])
+	assert.Equal(t, "pa$$word", updater["password"])
+	assert.Equal(t, []interface{}{"https://updates.example.com", ""}, updater["mirrors"])
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"assistant_agent/internal/fsutil"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// remoteConfigFile 服务器下发的配置，位于数据目录下，由 Agent 管理，不应手工修改
+const remoteConfigFile = "remote_config.json"
+
+// localOnlyKeys 只能在本地修改的配置：安全配置、本地 API（是否启用、监听地址和令牌）、日志脱敏规则、gRPC 明文连接，
+// 以及远程配置文件所在的数据目录
+var localOnlyKeys = []string{"security", "api", "logging.redact", "server.grpc_plaintext", "agent.data_dir"}
+
+var (
+	remoteMu sync.Mutex
+	// remoteOverrides 服务器下发的配置，键为 logging.level 形式，优先级高于配置文件和环境变量
+	remoteOverrides = map[string]interface{}{}
+)
+
+// RemoteOverrides 返回服务器下发的配置
+func RemoteOverrides() map[string]interface{} {
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+	return copyOverrides(remoteOverrides)
+}
+
+// UpdateRemote 合并服务器下发的配置，值为 nil 的键恢复为本地配置。update 可以使用 logging.level
+// 形式的键，也可以是嵌套的 map。校验通过后写入数据目录下的 remote_config.json 并通过 Reload 应用，
+// 返回合并后的全部远程配置
+func UpdateRemote(update map[string]interface{}) (map[string]interface{}, error) {
+	changes := map[string]interface{}{}
+	flattenConfig("", update, changes)
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("no config values")
+	}
+	for key := range changes {
+		if localOnly(key) {
+			return nil, fmt.Errorf("%s can only be changed locally", key)
+		}
+	}
+
+	remoteMu.Lock()
+	merged := copyOverrides(remoteOverrides)
+	remoteMu.Unlock()
+	for key, value := range changes {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+
+	// 远程配置必须对应已知的配置项且类型正确，叠加到本地配置后整体有效
+	if err := checkOverrides(merged); err != nil {
+		return nil, err
+	}
+	cfg, err := load(merged)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+
+	current := GetConfig()
+	if current == nil {
+		return nil, fmt.Errorf("config not initialized")
+	}
+	if err := saveOverrides(filepath.Join(current.Agent.DataDir, remoteConfigFile), merged); err != nil {
+		return nil, err
+	}
+
+	remoteMu.Lock()
+	remoteOverrides = merged
+	remoteMu.Unlock()
+	return copyOverrides(merged), Reload()
+}
+
+// load 解析默认值、配置文件和环境变量，再叠加服务器下发的配置并解密加密值。
+// 使用新的 viper 实例叠加，删除远程配置后能恢复为本地的值
+func load(overrides map[string]interface{}) (*Config, error) {
+	settings := viper.New()
+	if err := settings.MergeConfigMap(viper.AllSettings()); err != nil {
+		return nil, fmt.Errorf("failed to merge config: %v", err)
+	}
+	for key, value := range overrides {
+		settings.Set(key, value)
+	}
+	if err := decryptSettings(settings); err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := settings.Unmarshal(cfg); err != nil {
+		return nil, err
+	}
+	for name, values := range cfg.Plugins {
+		cfg.Plugins[name] = expandEnv(values).(map[string]interface{})
+	}
+	return cfg, nil
+}
+
+// envPattern 插件配置中的环境变量引用，只支持 ${VAR} 形式，避免改写值中普通的 $
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv 展开配置值（包括嵌套的 map 和列表）中的环境变量，未设置的变量展开为空字符串
+func expandEnv(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return envPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			return os.Getenv(ref[2 : len(ref)-1])
+		})
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = expandEnv(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = expandEnv(item)
+		}
+		return result
+	}
+	return value
+}
+
+// loadOverrides 读取数据目录下的远程配置，文件不存在时为空，文件损坏时忽略
+func loadOverrides(dataDir string) {
+	overrides := map[string]interface{}{}
+	path := filepath.Join(dataDir, remoteConfigFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &overrides); err != nil {
+			logrus.Warnf("Ignoring invalid remote config %s: %v", path, err)
+			overrides = map[string]interface{}{}
+		}
+	}
+
+	remoteMu.Lock()
+	remoteOverrides = overrides
+	remoteMu.Unlock()
+}
+
+// saveOverrides 原子地写入远程配置
+func saveOverrides(path string, overrides map[string]interface{}) error {
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal remote config: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write remote config: %v", err)
+	}
+	return nil
+}
+
+// checkOverrides 单独解析远程配置，拒绝未知的配置项和无法转换的值
+func checkOverrides(overrides map[string]interface{}) error {
+	settings := viper.New()
+	for key, value := range overrides {
+		settings.Set(key, value)
+	}
+	if err := settings.UnmarshalExact(&Config{}); err != nil {
+		return fmt.Errorf("invalid remote config: %v", err)
+	}
+	return nil
+}
+
+// validate 检查配置取值，启动、重新加载和应用远程配置时都会校验
+func validate(cfg *Config) error {
+	if _, err := logrus.ParseLevel(cfg.Logging.Level); err != nil {
+		return fmt.Errorf("invalid logging.level: %s", cfg.Logging.Level)
+	}
+	for component, level := range cfg.Logging.Components {
+		if _, err := logrus.ParseLevel(level); err != nil {
+			return fmt.Errorf("invalid logging.components.%s: %s", component, level)
+		}
+	}
+	if cfg.Logging.Format != "json" && cfg.Logging.Format != "text" {
+		return fmt.Errorf("invalid logging.format: %s", cfg.Logging.Format)
+	}
+	if cfg.Agent.Heartbeat <= 0 {
+		return fmt.Errorf("agent.heartbeat must be positive")
+	}
+	if cfg.Agent.HeartbeatAdaptive && (cfg.Agent.HeartbeatMin <= 0 || cfg.Agent.HeartbeatMax < cfg.Agent.HeartbeatMin) {
+		return fmt.Errorf("agent.heartbeat_min must be positive and not greater than agent.heartbeat_max")
+	}
+	if cfg.Agent.SysinfoInterval < 0 {
+		return fmt.Errorf("agent.sysinfo_interval must not be negative")
+	}
+	if cfg.API.Enabled && cfg.API.Token == "" {
+		return fmt.Errorf("api.token is required when api.enabled is true")
+	}
+	return nil
+}
+
+// flattenConfig 将嵌套的配置展开为 logging.level 形式的键
+func flattenConfig(prefix string, values map[string]interface{}, out map[string]interface{}) {
+	for key, value := range values {
+		key = strings.ToLower(key)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenConfig(key, nested, out)
+			continue
+		}
+		out[key] = value
+	}
+}
+
+// localOnly 判断配置项是否只能在本地修改
+func localOnly(key string) bool {
+	for _, protected := range localOnlyKeys {
+		if key == protected || strings.HasPrefix(key, protected+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// copyOverrides 复制远程配置，避免调用方与全局配置共享同一个 map
+func copyOverrides(overrides map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(overrides))
+	for key, value := range overrides {
+		result[key] = value
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/spf13/viper"
+)
+
+// 加密配置值的前缀，加载配置时自动解密
+const (
+	SecretEnc     = "enc:"     // AES-256-GCM 加密，密钥由机器标识或 SecretKeyEnv 派生
+	SecretKeyring = "keyring:" // 系统钥匙串中的密码，格式为 keyring:服务名/账户名
+	SecretDPAPI   = "dpapi:"   // Windows DPAPI 加密（本机范围），仅 Windows 可用
+)
+
+// SecretKeyEnv 设置后以该值派生 enc: 的密钥，用于机器标识会变化的环境（如容器）
+const SecretKeyEnv = "ASSISTANT_AGENT_SECRET_KEY"
+
+// secretKeyContext 派生密钥时附加的上下文，避免与其他程序使用同一机器标识派生出相同的密钥
+const secretKeyContext = "assistant_agent/config-secret/v1:"
+
+// IsSecret 判断配置值是否为加密值
+func IsSecret(value string) bool {
+	return strings.HasPrefix(value, SecretEnc) || strings.HasPrefix(value, SecretKeyring) || strings.HasPrefix(value, SecretDPAPI)
+}
+
+// EncryptValue 加密配置值，method 为 enc 或 dpapi，返回可以直接写入配置文件的值
+func EncryptValue(plaintext, method string) (string, error) {
+	switch method {
+	case "", strings.TrimSuffix(SecretEnc, ":"):
+		key, err := secretKey()
+		if err != nil {
+			return "", err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return "", err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", err
+		}
+		return SecretEnc + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+	case strings.TrimSuffix(SecretDPAPI, ":"):
+		data, err := dpapiProtect([]byte(plaintext))
+		if err != nil {
+			return "", err
+		}
+		return SecretDPAPI + base64.StdEncoding.EncodeToString(data), nil
+	}
+	return "", fmt.Errorf("unsupported secret method: %s", method)
+}
+
+// DecryptValue 解密配置值，不是加密值时原样返回
+func DecryptValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnc):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, SecretEnc))
+		if err != nil {
+			return "", fmt.Errorf("invalid encrypted value: %v", err)
+		}
+		key, err := secretKey()
+		if err != nil {
+			return "", err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return "", err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return "", err
+		}
+		if len(data) < gcm.NonceSize() {
+			return "", fmt.Errorf("encrypted value too short")
+		}
+		plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt value, it may have been encrypted on another machine or with another key")
+		}
+		return string(plaintext), nil
+	case strings.HasPrefix(value, SecretKeyring):
+		return keyringLookup(strings.TrimPrefix(value, SecretKeyring))
+	case strings.HasPrefix(value, SecretDPAPI):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, SecretDPAPI))
+		if err != nil {
+			return "", fmt.Errorf("invalid dpapi value: %v", err)
+		}
+		plaintext, err := dpapiUnprotect(data)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	}
+	return value, nil
+}
+
+// decryptSettings 解密配置中所有带加密前缀的字符串
+func decryptSettings(settings *viper.Viper) error {
+	for _, key := range settings.AllKeys() {
+		value, ok := settings.Get(key).(string)
+		if !ok || !IsSecret(value) {
+			continue
+		}
+		plaintext, err := DecryptValue(value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %v", key, err)
+		}
+		settings.Set(key, plaintext)
+	}
+	return nil
+}
+
+// secretKey 返回 enc: 使用的 AES-256 密钥
+func secretKey() ([]byte, error) {
+	seed := os.Getenv(SecretKeyEnv)
+	if seed == "" {
+		id, err := host.HostID()
+		if err != nil || id == "" {
+			return nil, fmt.Errorf("failed to read machine id, set %s instead: %v", SecretKeyEnv, err)
+		}
+		seed = id
+	}
+	key := sha256.Sum256([]byte(secretKeyContext + seed))
+	return key[:], nil
+}
+
+// keyringLookup 从系统钥匙串读取密码：Linux 使用 Secret Service（secret-tool），macOS 使用钥匙串（security）
+func keyringLookup(ref string) (string, error) {
+	service, account, ok := strings.Cut(ref, "/")
+	if !ok || service == "" || account == "" {
+		return "", fmt.Errorf("invalid keyring reference %q, expected keyring:service/account", ref)
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	default:
+		return "", fmt.Errorf("keyring is not supported on %s, use dpapi: values instead", runtime.GOOS)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("keyring lookup %s failed: %v %s", ref, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package config
+
+import "fmt"
+
+func dpapiProtect(data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("dpapi is only available on windows")
+}
+
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("dpapi is only available on windows")
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package config
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// dpapiProtect 使用本机范围的 DPAPI 加密，本机任何账户（包括以 LocalSystem 运行的服务）都能解密
+func dpapiProtect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(newBlob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN|windows.CRYPTPROTECT_LOCAL_MACHINE, &out); err != nil {
+		return nil, fmt.Errorf("dpapi encrypt failed: %v", err)
+	}
+	return takeBlob(&out), nil
+}
+
+// dpapiUnprotect 解密 DPAPI 加密的数据
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(newBlob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, fmt.Errorf("dpapi decrypt failed: %v", err)
+	}
+	return takeBlob(&out), nil
+}
+
+func newBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+}
+
+// takeBlob 复制系统分配的结果并释放
+func takeBlob(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(uintptr(unsafe.Pointer(blob.Data))))
+	result := make([]byte, blob.Size)
+	copy(result, unsafe.Slice(blob.Data, blob.Size))
+	return result
+}
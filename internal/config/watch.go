@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// watchDelay 配置文件变化后等待的时间，编辑器保存时的多次写入合并为一次重新加载
+const watchDelay = 500 * time.Millisecond
+
+// ChangeHandler 配置变化回调，old 为重新加载前的配置
+type ChangeHandler func(old, new *Config)
+
+var (
+	handlersMu sync.Mutex
+	handlers   = map[int]ChangeHandler{}
+	handlerSeq int
+
+	// reloadMu 串行化重新加载，SIGHUP 和文件变化同时发生时不会并发读取配置文件
+	reloadMu sync.Mutex
+)
+
+// OnChange 订阅配置变化，Reload 成功后按订阅顺序调用，返回取消订阅的函数
+func OnChange(handler ChangeHandler) (cancel func()) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+
+	handlerSeq++
+	id := handlerSeq
+	handlers[id] = handler
+	return func() {
+		handlersMu.Lock()
+		defer handlersMu.Unlock()
+		delete(handlers, id)
+	}
+}
+
+// Reload 重新读取配置文件和环境变量并叠加服务器下发的配置，解析成功后替换 GlobalConfig 并通知订阅者，失败时保留原配置
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return fmt.Errorf("failed to read config: %v", err)
+		}
+	}
+	cfg, err := load(RemoteOverrides())
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %v", err)
+	}
+	if err := validate(cfg); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	configMu.Lock()
+	old := GlobalConfig
+	GlobalConfig = cfg
+	configMu.Unlock()
+	if old == nil {
+		return nil
+	}
+
+	handlersMu.Lock()
+	ids := make([]int, 0, len(handlers))
+	for id := range handlers {
+		ids = append(ids, id)
+	}
+	callbacks := make([]ChangeHandler, 0, len(ids))
+	sort.Ints(ids)
+	for _, id := range ids {
+		callbacks = append(callbacks, handlers[id])
+	}
+	handlersMu.Unlock()
+
+	for _, handler := range callbacks {
+		handler(old, cfg)
+	}
+	return nil
+}
+
+// Watch 监听配置文件，文件写入或被替换后自动 Reload，重新加载失败时调用 onError。
+// 没有使用配置文件时不监听，返回的函数停止监听
+func Watch(onError func(error)) (stop func(), err error) {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return func() {}, nil
+	}
+	file = filepath.Clean(file)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config watcher: %v", err)
+	}
+	// 监听所在目录而不是文件本身，编辑器通过重命名替换文件后仍能收到事件
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch config directory: %v", err)
+	}
+
+	report := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != file || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(watchDelay, func() {
+					if err := Reload(); err != nil {
+						report(err)
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				report(fmt.Errorf("config watcher: %v", err))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			watcher.Close()
+		})
+	}, nil
+}
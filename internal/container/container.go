@@ -0,0 +1,426 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultRuntime 默认容器运行时命令
+const DefaultRuntime = "docker"
+
+// ContainerInfo 容器信息
+type ContainerInfo struct {
+	ID        string `json:"id"`
+	Names     string `json:"names"`
+	Image     string `json:"image"`
+	Command   string `json:"command"`
+	State     string `json:"state"`
+	Status    string `json:"status"`
+	Ports     string `json:"ports"`
+	CreatedAt string `json:"created_at"`
+}
+
+// CreateOptions 创建容器参数
+type CreateOptions struct {
+	Name       string            `json:"name,omitempty"`
+	Image      string            `json:"image"`
+	Command    []string          `json:"command,omitempty"`
+	Env        []string          `json:"env,omitempty"`
+	Ports      []string          `json:"ports,omitempty"`
+	Volumes    []string          `json:"volumes,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	WorkingDir string            `json:"working_dir,omitempty"`
+	User       string            `json:"user,omitempty"`
+	Network    string            `json:"network,omitempty"`
+	AutoRemove bool              `json:"auto_remove,omitempty"`
+}
+
+// LogOptions 容器日志参数
+type LogOptions struct {
+	Follow     bool   `json:"follow,omitempty"`
+	Tail       string `json:"tail,omitempty"`
+	Since      string `json:"since,omitempty"`
+	Timestamps bool   `json:"timestamps,omitempty"`
+}
+
+// LogHandler 容器日志回调，stream 为 stdout 或 stderr
+type LogHandler func(stream, line string)
+
+// RunResult 一次性运行容器的结果
+type RunResult struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// Manager 容器管理器，通过容器运行时命令行（docker、podman 等）管理容器
+type Manager struct {
+	runtime string
+}
+
+// NewManager 创建容器管理器，runtime 为空时使用 docker
+func NewManager(runtime string) *Manager {
+	if runtime == "" {
+		runtime = DefaultRuntime
+	}
+	return &Manager{runtime: runtime}
+}
+
+// Runtime 返回容器运行时命令
+func (m *Manager) Runtime() string {
+	return m.runtime
+}
+
+// Available 检查容器运行时是否可用
+func (m *Manager) Available() bool {
+	_, err := exec.LookPath(m.runtime)
+	return err == nil
+}
+
+// Pull 拉取镜像
+func (m *Manager) Pull(ctx context.Context, image string) (string, error) {
+	if image == "" {
+		return "", fmt.Errorf("image is required")
+	}
+	return m.run(ctx, "pull", image)
+}
+
+// Create 创建容器，返回容器 ID
+func (m *Manager) Create(ctx context.Context, opts *CreateOptions) (string, error) {
+	args, err := createArgs("create", opts)
+	if err != nil {
+		return "", err
+	}
+	return m.run(ctx, args...)
+}
+
+// Start 启动容器
+func (m *Manager) Start(ctx context.Context, id string) error {
+	if id == "" {
+		return fmt.Errorf("container id is required")
+	}
+	_, err := m.run(ctx, "start", id)
+	return err
+}
+
+// Stop 停止容器，timeout 为等待容器退出的秒数，小于 0 时使用运行时默认值
+func (m *Manager) Stop(ctx context.Context, id string, timeout int) error {
+	if id == "" {
+		return fmt.Errorf("container id is required")
+	}
+	args := []string{"stop"}
+	if timeout >= 0 {
+		args = append(args, "-t", strconv.Itoa(timeout))
+	}
+	_, err := m.run(ctx, append(args, id)...)
+	return err
+}
+
+// Remove 删除容器
+func (m *Manager) Remove(ctx context.Context, id string, force bool) error {
+	if id == "" {
+		return fmt.Errorf("container id is required")
+	}
+	args := []string{"rm"}
+	if force {
+		args = append(args, "-f")
+	}
+	_, err := m.run(ctx, append(args, id)...)
+	return err
+}
+
+// List 列出容器，all 为 true 时包含已停止的容器
+func (m *Manager) List(ctx context.Context, all bool) ([]*ContainerInfo, error) {
+	args := []string{"ps", "--no-trunc", "--format", "{{json .}}"}
+	if all {
+		args = append(args, "-a")
+	}
+
+	output, err := m.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]*ContainerInfo, 0)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var raw struct {
+			ID        string
+			Names     string
+			Image     string
+			Command   string
+			State     string
+			Status    string
+			Ports     string
+			CreatedAt string
+		}
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse container list: %v", err)
+		}
+		containers = append(containers, &ContainerInfo{
+			ID:        raw.ID,
+			Names:     raw.Names,
+			Image:     raw.Image,
+			Command:   raw.Command,
+			State:     raw.State,
+			Status:    raw.Status,
+			Ports:     raw.Ports,
+			CreatedAt: raw.CreatedAt,
+		})
+	}
+
+	return containers, nil
+}
+
+// Logs 读取容器日志并逐行回调，Follow 时阻塞直到容器退出或 ctx 取消
+func (m *Manager) Logs(ctx context.Context, id string, opts *LogOptions, handler LogHandler) error {
+	if id == "" {
+		return fmt.Errorf("container id is required")
+	}
+	if handler == nil {
+		return fmt.Errorf("log handler is required")
+	}
+	if opts == nil {
+		opts = &LogOptions{}
+	}
+
+	args := []string{"logs"}
+	if opts.Follow {
+		args = append(args, "-f")
+	}
+	if opts.Tail != "" {
+		args = append(args, "--tail", opts.Tail)
+	}
+	if opts.Since != "" {
+		args = append(args, "--since", opts.Since)
+	}
+	if opts.Timestamps {
+		args = append(args, "-t")
+	}
+	args = append(args, id)
+
+	cmd := exec.CommandContext(ctx, m.runtime, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s logs: %v", m.runtime, err)
+	}
+
+	// 回调串行执行，调用方无需处理并发
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	scan := func(stream string, r io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			mu.Lock()
+			handler(stream, scanner.Text())
+			mu.Unlock()
+		}
+	}
+	wg.Add(2)
+	go scan("stdout", stdout)
+	go scan("stderr", stderr)
+	wg.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("%s logs failed: %v", m.runtime, err)
+	}
+	return nil
+}
+
+// Run 以前台方式运行一次性容器并等待其退出，容器退出后自动删除
+func (m *Manager) Run(ctx context.Context, opts *CreateOptions) (*RunResult, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("image is required")
+	}
+
+	// 一次性容器退出后不保留
+	runOpts := *opts
+	runOpts.AutoRemove = true
+	args, err := createArgs("run", &runOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, m.runtime, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	result := &RunResult{}
+	err = cmd.Run()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+			result.ExitCode = exitErr.ExitCode()
+			return result, fmt.Errorf("container exited with code %d", result.ExitCode)
+		}
+		result.ExitCode = -1
+		if ctx.Err() != nil {
+			return result, fmt.Errorf("container run cancelled: %v", ctx.Err())
+		}
+		return result, fmt.Errorf("failed to run container: %v", err)
+	}
+
+	return result, nil
+}
+
+// run 执行运行时命令并返回去除首尾空白的标准输出
+func (m *Manager) run(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, m.runtime, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("%s %s failed: %s", m.runtime, args[0], message)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// createArgs 构建 create/run 命令参数
+func createArgs(action string, opts *CreateOptions) ([]string, error) {
+	if opts == nil || opts.Image == "" {
+		return nil, fmt.Errorf("image is required")
+	}
+
+	args := []string{action}
+	if opts.Name != "" {
+		args = append(args, "--name", opts.Name)
+	}
+	if opts.AutoRemove {
+		args = append(args, "--rm")
+	}
+	for _, env := range opts.Env {
+		args = append(args, "-e", env)
+	}
+	for _, port := range opts.Ports {
+		args = append(args, "-p", port)
+	}
+	for _, volume := range opts.Volumes {
+		args = append(args, "-v", volume)
+	}
+	keys := make([]string, 0, len(opts.Labels))
+	for key := range opts.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--label", key+"="+opts.Labels[key])
+	}
+	if opts.WorkingDir != "" {
+		args = append(args, "-w", opts.WorkingDir)
+	}
+	if opts.User != "" {
+		args = append(args, "-u", opts.User)
+	}
+	if opts.Network != "" {
+		args = append(args, "--network", opts.Network)
+	}
+
+	args = append(args, opts.Image)
+	return append(args, opts.Command...), nil
+}
+
+// ParseCreateOptions 从消息参数解析创建容器参数
+func ParseCreateOptions(args map[string]interface{}) (*CreateOptions, error) {
+	opts := &CreateOptions{}
+	opts.Image, _ = args["image"].(string)
+	if opts.Image == "" {
+		return nil, fmt.Errorf("image is required")
+	}
+
+	opts.Name, _ = args["name"].(string)
+	opts.WorkingDir, _ = args["working_dir"].(string)
+	opts.User, _ = args["user"].(string)
+	opts.Network, _ = args["network"].(string)
+	opts.AutoRemove, _ = args["auto_remove"].(bool)
+	// 字符串形式的命令按空白拆分，需要保留空格的参数应使用数组形式
+	if command, ok := args["command"].(string); ok {
+		opts.Command = strings.Fields(command)
+	} else {
+		opts.Command = stringSlice(args["command"])
+	}
+	opts.Env = stringSlice(args["env"])
+	opts.Ports = stringSlice(args["ports"])
+	opts.Volumes = stringSlice(args["volumes"])
+
+	if labels, ok := args["labels"].(map[string]interface{}); ok {
+		opts.Labels = make(map[string]string, len(labels))
+		for key, value := range labels {
+			opts.Labels[key] = fmt.Sprint(value)
+		}
+	}
+
+	return opts, nil
+}
+
+// ParseLogOptions 从消息参数解析容器日志参数
+func ParseLogOptions(args map[string]interface{}) *LogOptions {
+	opts := &LogOptions{}
+	opts.Follow, _ = args["follow"].(bool)
+	opts.Since, _ = args["since"].(string)
+	opts.Timestamps, _ = args["timestamps"].(bool)
+
+	switch tail := args["tail"].(type) {
+	case string:
+		opts.Tail = tail
+	case float64:
+		opts.Tail = strconv.Itoa(int(tail))
+	}
+
+	return opts
+}
+
+// stringSlice 将字符串或字符串数组参数转换为 []string
+func stringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRuntime 创建模拟容器运行时，将调用参数写入 args 文件并按子命令返回固定输出
+func fakeRuntime(t *testing.T) (*Manager, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake runtime requires sh")
+	}
+
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := `#!/bin/sh
+echo "$@" >> "` + argsFile + `"
+case "$1" in
+  create) echo "0123456789abcdef" ;;
+  ps) echo '{"ID":"abc","Names":"web","Image":"nginx","State":"running","Status":"Up 1 minute"}' ;;
+  logs) echo "out line"; echo "err line" >&2 ;;
+  run) echo "hello from container"; exit 3 ;;
+  rm) echo "Error: No such container: $2" >&2; exit 1 ;;
+esac
+`
+	path := filepath.Join(dir, "docker")
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755))
+	return NewManager(path), argsFile
+}
+
+func readArgs(t *testing.T, argsFile string) []string {
+	data, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestNewManager(t *testing.T) {
+	assert.Equal(t, DefaultRuntime, NewManager("").Runtime())
+	assert.Equal(t, "podman", NewManager("podman").Runtime())
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	manager, argsFile := fakeRuntime(t)
+	ctx := context.Background()
+
+	_, err := manager.Pull(ctx, "nginx:latest")
+	require.NoError(t, err)
+
+	id, err := manager.Create(ctx, &CreateOptions{
+		Name:    "web",
+		Image:   "nginx:latest",
+		Command: []string{"nginx", "-g", "daemon off;"},
+		Env:     []string{"A=1"},
+		Ports:   []string{"8080:80"},
+		Labels:  map[string]string{"b": "2", "a": "1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", id)
+
+	require.NoError(t, manager.Start(ctx, id))
+	require.NoError(t, manager.Stop(ctx, id, 5))
+
+	err = manager.Remove(ctx, "missing", true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No such container")
+
+	assert.Equal(t, []string{
+		"pull nginx:latest",
+		"create --name web -e A=1 -p 8080:80 --label a=1 --label b=2 nginx:latest nginx -g daemon off;",
+		"start 0123456789abcdef",
+		"stop -t 5 0123456789abcdef",
+		"rm -f missing",
+	}, readArgs(t, argsFile))
+}
+
+func TestManagerValidation(t *testing.T) {
+	manager := NewManager("")
+	ctx := context.Background()
+
+	_, err := manager.Pull(ctx, "")
+	assert.Error(t, err)
+	_, err = manager.Create(ctx, &CreateOptions{})
+	assert.Error(t, err)
+	assert.Error(t, manager.Start(ctx, ""))
+	assert.Error(t, manager.Stop(ctx, "", -1))
+	assert.Error(t, manager.Remove(ctx, "", false))
+	assert.Error(t, manager.Logs(ctx, "abc", nil, nil))
+	_, err = manager.Run(ctx, nil)
+	assert.Error(t, err)
+}
+
+func TestManagerList(t *testing.T) {
+	manager, argsFile := fakeRuntime(t)
+
+	containers, err := manager.List(context.Background(), true)
+	require.NoError(t, err)
+	require.Len(t, containers, 1)
+	assert.Equal(t, "abc", containers[0].ID)
+	assert.Equal(t, "web", containers[0].Names)
+	assert.Equal(t, "running", containers[0].State)
+	assert.Equal(t, []string{"ps --no-trunc --format {{json .}} -a"}, readArgs(t, argsFile))
+}
+
+func TestManagerLogs(t *testing.T) {
+	manager, argsFile := fakeRuntime(t)
+
+	lines := make(map[string]string)
+	err := manager.Logs(context.Background(), "abc", &LogOptions{Follow: true, Tail: "10"}, func(stream, line string) {
+		lines[stream] = line
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "out line", lines["stdout"])
+	assert.Equal(t, "err line", lines["stderr"])
+	assert.Equal(t, []string{"logs -f --tail 10 abc"}, readArgs(t, argsFile))
+}
+
+func TestManagerRun(t *testing.T) {
+	manager, argsFile := fakeRuntime(t)
+
+	result, err := manager.Run(context.Background(), &CreateOptions{Image: "alpine", Command: []string{"echo", "hi"}})
+	require.Error(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "hello from container\n", result.Stdout)
+	assert.Equal(t, []string{"run --rm alpine echo hi"}, readArgs(t, argsFile))
+}
+
+func TestParseOptions(t *testing.T) {
+	_, err := ParseCreateOptions(map[string]interface{}{})
+	assert.Error(t, err)
+
+	opts, err := ParseCreateOptions(map[string]interface{}{
+		"image":   "alpine",
+		"command": "echo hello world",
+		"env":     []interface{}{"A=1", "B=2"},
+		"volumes": "/data:/data",
+		"labels":  map[string]interface{}{"team": "ops"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo", "hello", "world"}, opts.Command)
+	assert.Equal(t, []string{"A=1", "B=2"}, opts.Env)
+	assert.Equal(t, []string{"/data:/data"}, opts.Volumes)
+	assert.Equal(t, map[string]string{"team": "ops"}, opts.Labels)
+
+	logOpts := ParseLogOptions(map[string]interface{}{"follow": true, "tail": float64(100)})
+	assert.True(t, logOpts.Follow)
+	assert.Equal(t, "100", logOpts.Tail)
+}
@@ -1,7 +1,9 @@
 package executor
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,15 +13,17 @@ import (
 	"time"
 
 	"assistant_agent/internal/logger"
+	"assistant_agent/internal/scripts"
 )
 
 // CommandType 命令类型
 type CommandType string
 
 const (
-	CommandTypeShell      CommandType = "shell"
-	CommandTypePowerShell CommandType = "powershell"
-	CommandTypeContainer  CommandType = "container"
+	CommandTypeShell       CommandType = "shell"
+	CommandTypePowerShell  CommandType = "powershell"
+	CommandTypeContainer   CommandType = "container"
+	CommandTypeInterpreter CommandType = "interpreter"
 )
 
 // Command 命令结构
@@ -27,32 +31,78 @@ type Command struct {
 	ID          string      `json:"id"`
 	Type        CommandType `json:"type"`
 	Script      string      `json:"script"`
+	ScriptRef   string      `json:"script_ref,omitempty"` // 脚本库引用 name@version，设置后忽略 Script
 	Args        []string    `json:"args"`
 	WorkingDir  string      `json:"working_dir"`
 	Timeout     int         `json:"timeout"`
 	ContainerID string      `json:"container_id,omitempty"`
+	Interpreter string      `json:"interpreter,omitempty"`
 	User        string      `json:"user,omitempty"`
+	RunAs       string      `json:"run_as,omitempty"`          // 以指定系统用户身份执行
+	RunAsPass   string      `json:"run_as_password,omitempty"` // Windows 下登录目标用户所需的密码
 	Env         []string    `json:"env,omitempty"`
+	Confirmed   bool        `json:"confirmed,omitempty"` // 已确认执行命中高危规则的命令
+
+	// 资源限制
+	MaxMemoryMB int     `json:"max_memory_mb,omitempty"` // 最大内存（MB）
+	CPUQuota    float64 `json:"cpu_quota,omitempty"`     // CPU 配额，以单核百分比表示，如 50 表示半个核
+	Niceness    int     `json:"niceness,omitempty"`      // 进程优先级，范围 -20 ~ 19
+
+	MaxOutputSize int64 `json:"max_output_size,omitempty"` // 单个输出流的最大字节数，覆盖执行器默认值
+
+	// OnOutput 输出回调，设置后 stdout/stderr 会在执行过程中增量回调
+	OnOutput OutputHandler `json:"-"`
+
+	// Context 设置后作为命令的父上下文，取消时终止命令
+	Context context.Context `json:"-"`
 }
 
+// OutputChunk 命令输出片段
+type OutputChunk struct {
+	ID     string `json:"id"`
+	Seq    int64  `json:"seq"`
+	Stream string `json:"stream"` // stdout, stderr
+	Data   string `json:"data"`
+}
+
+// OutputHandler 命令输出回调
+type OutputHandler func(chunk *OutputChunk)
+
 // Result 执行结果
 type Result struct {
 	ID        string    `json:"id"`
 	Success   bool      `json:"success"`
 	ExitCode  int       `json:"exit_code"`
-	Output    string    `json:"output"`
+	Output    string    `json:"output"` // 合并输出，关闭 combined 选项时为空
+	Stdout    string    `json:"stdout"`
+	Stderr    string    `json:"stderr"`
+	Truncated bool      `json:"truncated,omitempty"` // 输出是否因超出大小限制被截断
 	Error     string    `json:"error"`
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
 	Duration  float64   `json:"duration"`
+
+	LimitExceeded   string `json:"limit_exceeded,omitempty"` // 触发的资源限制类型：memory、cpu
+	KilledByTimeout bool   `json:"killed_by_timeout"`        // 是否因超时被终止
+
+	ConfirmationRequired bool `json:"confirmation_required,omitempty"` // 命中高危规则，需携带 confirmed 重新下发
 }
 
+// DefaultMaxOutputSize 默认单个输出流的最大字节数
+const DefaultMaxOutputSize = 10 * 1024 * 1024
+
 // Executor 命令执行器
 type Executor struct {
-	workDir string
-	tempDir string
-	mu      sync.RWMutex
-	running map[string]*exec.Cmd
+	workDir        string
+	tempDir        string
+	maxOutputSize  int64
+	combinedOutput bool
+	mu             sync.RWMutex
+	running        map[string]*exec.Cmd
+	interpreters   map[string]*Interpreter
+	scripts        *scripts.Store
+	policy         *compiledPolicy
+	history        *History
 }
 
 // New 创建新的执行器
@@ -66,12 +116,44 @@ func New(workDir, tempDir string) (*Executor, error) {
 	}
 
 	return &Executor{
-		workDir: workDir,
-		tempDir: tempDir,
-		running: make(map[string]*exec.Cmd),
+		workDir:        workDir,
+		tempDir:        tempDir,
+		maxOutputSize:  DefaultMaxOutputSize,
+		combinedOutput: true,
+		running:        make(map[string]*exec.Cmd),
+		interpreters:   make(map[string]*Interpreter),
 	}, nil
 }
 
+// SetOutputOptions 设置输出捕获选项
+// maxSize 为单个输出流的最大字节数（0 表示不限制），combined 控制是否保留合并输出
+func (e *Executor) SetOutputOptions(maxSize int64, combined bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.maxOutputSize = maxSize
+	e.combinedOutput = combined
+}
+
+// SetHistory 设置命令历史存储，设置后每次执行结果都会被记录
+func (e *Executor) SetHistory(history *History) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.history = history
+}
+
+// QueryHistory 分页查询命令执行历史，同时返回满足条件的记录总数
+func (e *Executor) QueryHistory(query *HistoryQuery) ([]*Result, int, error) {
+	e.mu.RLock()
+	history := e.history
+	e.mu.RUnlock()
+
+	if history == nil {
+		return nil, 0, fmt.Errorf("command history not enabled")
+	}
+	return history.Query(query)
+}
+
 // Start 启动执行器
 func (e *Executor) Start() error {
 	logger.Info("Command executor started")
@@ -86,9 +168,7 @@ func (e *Executor) Stop() {
 	// 停止所有运行中的命令
 	for id, cmd := range e.running {
 		logger.Infof("Stopping command: %s", id)
-		if cmd.Process != nil {
-			cmd.Process.Kill()
-		}
+		killCommand(cmd)
 		delete(e.running, id)
 	}
 
@@ -102,18 +182,23 @@ func (e *Executor) Execute(cmd *Command) *Result {
 		StartTime: time.Now(),
 	}
 
-	logger.Infof("Executing command: %s, type: %s", cmd.ID, cmd.Type)
+	// 引用脚本库中的脚本时，执行前解析并校验摘要
+	err := e.resolveScript(cmd)
+	if err == nil {
+		// 检查命令安全策略
+		err = e.checkPolicy(cmd)
+	}
 
-	switch cmd.Type {
-	case CommandTypeShell:
-		result = e.executeShell(cmd)
-	case CommandTypePowerShell:
-		result = e.executePowerShell(cmd)
-	case CommandTypeContainer:
-		result = e.executeContainer(cmd)
-	default:
+	if err != nil {
 		result.Success = false
-		result.Error = fmt.Sprintf("unsupported command type: %s", cmd.Type)
+		result.Error = err.Error()
+		if policyErr, ok := err.(*PolicyError); ok {
+			result.ConfirmationRequired = policyErr.ConfirmationRequired
+			logger.Warnf("Command %s blocked: %s", cmd.ID, policyErr.Reason)
+		}
+	} else {
+		logger.Infof("Executing command: %s, type: %s", cmd.ID, cmd.Type)
+		result = e.dispatch(cmd)
 	}
 
 	result.EndTime = time.Now()
@@ -122,9 +207,40 @@ func (e *Executor) Execute(cmd *Command) *Result {
 	logger.Infof("Command %s completed, success: %v, exit code: %d",
 		cmd.ID, result.Success, result.ExitCode)
 
+	// 记录执行历史
+	e.mu.RLock()
+	history := e.history
+	e.mu.RUnlock()
+	if history != nil {
+		if err := history.Record(result); err != nil {
+			logger.Warnf("Failed to record command history: %v", err)
+		}
+	}
+
 	return result
 }
 
+// dispatch 按命令类型执行命令
+func (e *Executor) dispatch(cmd *Command) *Result {
+	switch cmd.Type {
+	case CommandTypeShell:
+		return e.executeShell(cmd)
+	case CommandTypePowerShell:
+		return e.executePowerShell(cmd)
+	case CommandTypeContainer:
+		return e.executeContainer(cmd)
+	case CommandTypeInterpreter:
+		return e.executeInterpreter(cmd)
+	default:
+		return &Result{
+			ID:        cmd.ID,
+			StartTime: time.Now(),
+			Success:   false,
+			Error:     fmt.Sprintf("unsupported command type: %s", cmd.Type),
+		}
+	}
+}
+
 // executeShell 执行 Shell 命令
 func (e *Executor) executeShell(cmd *Command) *Result {
 	result := &Result{
@@ -148,13 +264,17 @@ func (e *Executor) executeShell(cmd *Command) *Result {
 		return result
 	}
 
+	// 设置超时
+	ctx, cancel := e.commandContext(cmd)
+	defer cancel()
+
 	// 创建命令
 	var execCmd *exec.Cmd
 	if runtime.GOOS == "windows" {
 		// Windows 上使用 Git Bash 或 WSL
-		execCmd = exec.Command("bash", scriptFile)
+		execCmd = exec.CommandContext(ctx, "bash", scriptFile)
 	} else {
-		execCmd = exec.Command("bash", scriptFile)
+		execCmd = exec.CommandContext(ctx, "bash", scriptFile)
 	}
 
 	// 设置工作目录
@@ -167,30 +287,16 @@ func (e *Executor) executeShell(cmd *Command) *Result {
 	// 设置环境变量
 	execCmd.Env = append(os.Environ(), cmd.Env...)
 
-	// 设置超时
-	ctx := context.Background()
-	if cmd.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(cmd.Timeout)*time.Second)
-		defer cancel()
-		execCmd = exec.CommandContext(ctx, execCmd.Path, execCmd.Args[1:]...)
-	}
-
-	// 捕获输出
-	output, err := execCmd.CombinedOutput()
-	result.Output = string(output)
-
+	// 切换执行用户
+	cleanup, err := configureRunAs(execCmd, cmd, scriptFile)
 	if err != nil {
 		result.Success = false
 		result.Error = err.Error()
-		if execCmd.ProcessState != nil {
-			result.ExitCode = execCmd.ProcessState.ExitCode()
-		}
-	} else {
-		result.Success = true
-		result.ExitCode = 0
+		return result
 	}
+	defer cleanup()
 
+	e.runCommand(ctx, cmd, execCmd, result)
 	return result
 }
 
@@ -210,8 +316,12 @@ func (e *Executor) executePowerShell(cmd *Command) *Result {
 	}
 	defer os.Remove(scriptFile)
 
+	// 设置超时
+	ctx, cancel := e.commandContext(cmd)
+	defer cancel()
+
 	// 创建 PowerShell 命令
-	execCmd := exec.Command("powershell", "-ExecutionPolicy", "Bypass", "-File", scriptFile)
+	execCmd := exec.CommandContext(ctx, "powershell", "-ExecutionPolicy", "Bypass", "-File", scriptFile)
 
 	// 设置工作目录
 	if cmd.WorkingDir != "" {
@@ -223,30 +333,16 @@ func (e *Executor) executePowerShell(cmd *Command) *Result {
 	// 设置环境变量
 	execCmd.Env = append(os.Environ(), cmd.Env...)
 
-	// 设置超时
-	ctx := context.Background()
-	if cmd.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(cmd.Timeout)*time.Second)
-		defer cancel()
-		execCmd = exec.CommandContext(ctx, execCmd.Path, execCmd.Args[1:]...)
-	}
-
-	// 捕获输出
-	output, err := execCmd.CombinedOutput()
-	result.Output = string(output)
-
+	// 切换执行用户
+	cleanup, err := configureRunAs(execCmd, cmd, scriptFile)
 	if err != nil {
 		result.Success = false
 		result.Error = err.Error()
-		if execCmd.ProcessState != nil {
-			result.ExitCode = execCmd.ProcessState.ExitCode()
-		}
-	} else {
-		result.Success = true
-		result.ExitCode = 0
+		return result
 	}
+	defer cleanup()
 
+	e.runCommand(ctx, cmd, execCmd, result)
 	return result
 }
 
@@ -276,9 +372,11 @@ func (e *Executor) executeContainer(cmd *Command) *Result {
 	// 构建 docker exec 命令
 	dockerArgs := []string{"exec"}
 
-	// 添加用户参数
+	// 添加用户参数，容器内用户由 docker 负责切换
 	if cmd.User != "" {
 		dockerArgs = append(dockerArgs, "-u", cmd.User)
+	} else if cmd.RunAs != "" {
+		dockerArgs = append(dockerArgs, "-u", cmd.RunAs)
 	}
 
 	// 添加工作目录
@@ -293,25 +391,97 @@ func (e *Executor) executeContainer(cmd *Command) *Result {
 
 	dockerArgs = append(dockerArgs, cmd.ContainerID, "bash", scriptFile)
 
+	// 设置超时
+	ctx, cancel := e.commandContext(cmd)
+	defer cancel()
+
 	// 创建命令
-	execCmd := exec.Command("docker", dockerArgs...)
+	execCmd := exec.CommandContext(ctx, "docker", dockerArgs...)
 
-	// 设置超时
-	ctx := context.Background()
+	e.runCommand(ctx, cmd, execCmd, result)
+	return result
+}
+
+// commandContext 根据命令超时设置创建上下文
+func (e *Executor) commandContext(cmd *Command) (context.Context, context.CancelFunc) {
+	parent := cmd.Context
+	if parent == nil {
+		parent = context.Background()
+	}
 	if cmd.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(cmd.Timeout)*time.Second)
-		defer cancel()
-		execCmd = exec.CommandContext(ctx, execCmd.Path, execCmd.Args[1:]...)
+		return context.WithTimeout(parent, time.Duration(cmd.Timeout)*time.Second)
+	}
+	return context.WithCancel(parent)
+}
+
+// runCommand 运行命令并捕获输出，设置了 OnOutput 时增量回调输出
+func (e *Executor) runCommand(ctx context.Context, cmd *Command, execCmd *exec.Cmd, result *Result) {
+	e.mu.RLock()
+	collector := &outputCollector{
+		id:       cmd.ID,
+		handler:  cmd.OnOutput,
+		limit:    e.maxOutputSize,
+		combined: e.combinedOutput,
+	}
+	e.mu.RUnlock()
+	if cmd.MaxOutputSize > 0 {
+		collector.limit = cmd.MaxOutputSize
+	}
+	execCmd.Stdout = collector.writer("stdout")
+	execCmd.Stderr = collector.writer("stderr")
+	// 子进程持有管道时避免 Wait 无限阻塞
+	execCmd.WaitDelay = time.Second
+
+	// 超时或停止时终止整个进程树，避免子进程成为孤儿
+	tree := newProcessTree(execCmd)
+	defer tree.release()
+	execCmd.Cancel = tree.kill
+
+	limits, err := newProcessLimits(cmd)
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return
 	}
 
-	// 捕获输出
-	output, err := execCmd.CombinedOutput()
-	result.Output = string(output)
+	if err := limits.prepare(execCmd); err != nil {
+		limits.release()
+		result.Success = false
+		result.Error = fmt.Sprintf("failed to apply resource limits: %v", err)
+		return
+	}
+
+	err = execCmd.Start()
+	if err == nil {
+		if treeErr := tree.attach(execCmd.Process); treeErr != nil {
+			logger.Warnf("Failed to track process tree for command %s: %v", cmd.ID, treeErr)
+		}
+
+		// 无法应用资源限制时不允许命令继续运行
+		if limitErr := limits.apply(execCmd.Process); limitErr != nil {
+			tree.kill()
+			execCmd.Wait()
+			limits.release()
+			result.Success = false
+			result.Error = fmt.Sprintf("failed to apply resource limits: %v", limitErr)
+			return
+		}
+		e.track(cmd.ID, execCmd)
+		err = execCmd.Wait()
+		e.untrack(cmd.ID, execCmd)
+	}
+	collector.fill(result)
+	result.LimitExceeded = limits.release()
 
 	if err != nil {
 		result.Success = false
 		result.Error = err.Error()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result.Error = fmt.Sprintf("command timeout after %d seconds", cmd.Timeout)
+			result.KilledByTimeout = true
+		} else if errors.Is(ctx.Err(), context.Canceled) && cmd.Context != nil && cmd.Context.Err() != nil {
+			result.Error = "command canceled"
+		}
 		if execCmd.ProcessState != nil {
 			result.ExitCode = execCmd.ProcessState.ExitCode()
 		}
@@ -319,8 +489,123 @@ func (e *Executor) executeContainer(cmd *Command) *Result {
 		result.Success = true
 		result.ExitCode = 0
 	}
+}
 
-	return result
+// killCommand 终止命令及其子进程
+func killCommand(execCmd *exec.Cmd) error {
+	if execCmd.Cancel != nil {
+		return execCmd.Cancel()
+	}
+	if execCmd.Process != nil {
+		return execCmd.Process.Kill()
+	}
+	return nil
+}
+
+// track 登记运行中的命令
+func (e *Executor) track(id string, execCmd *exec.Cmd) {
+	if id == "" {
+		return
+	}
+
+	e.mu.Lock()
+	e.running[id] = execCmd
+	e.mu.Unlock()
+}
+
+// untrack 移除已结束的命令
+func (e *Executor) untrack(id string, execCmd *exec.Cmd) {
+	if id == "" {
+		return
+	}
+
+	e.mu.Lock()
+	if e.running[id] == execCmd {
+		delete(e.running, id)
+	}
+	e.mu.Unlock()
+}
+
+// outputCollector 收集命令输出并按序号回调
+type outputCollector struct {
+	id        string
+	handler   OutputHandler
+	limit     int64 // 单个输出流的最大字节数，0 表示不限制
+	combined  bool  // 是否保留合并输出
+	stdout    bytes.Buffer
+	stderr    bytes.Buffer
+	output    bytes.Buffer
+	truncated bool
+	seq       int64
+	mu        sync.Mutex
+}
+
+// writer 返回指定输出流的写入器
+func (c *outputCollector) writer(stream string) io.Writer {
+	return &streamWriter{collector: c, stream: stream}
+}
+
+// write 写入输出并回调
+func (c *outputCollector) write(stream string, p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf := &c.stdout
+	if stream == "stderr" {
+		buf = &c.stderr
+	}
+
+	// 超出大小限制的部分直接丢弃
+	if c.limit > 0 {
+		remaining := c.limit - int64(buf.Len())
+		if int64(len(p)) > remaining {
+			if remaining < 0 {
+				remaining = 0
+			}
+			p = p[:remaining]
+			c.truncated = true
+		}
+	}
+	if len(p) == 0 {
+		return
+	}
+
+	buf.Write(p)
+	if c.combined {
+		c.output.Write(p)
+	}
+	if c.handler != nil {
+		c.seq++
+		c.handler(&OutputChunk{
+			ID:     c.id,
+			Seq:    c.seq,
+			Stream: stream,
+			Data:   string(p),
+		})
+	}
+}
+
+// fill 将收集的输出写入执行结果
+func (c *outputCollector) fill(result *Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result.Stdout = c.stdout.String()
+	result.Stderr = c.stderr.String()
+	result.Output = c.output.String()
+	result.Truncated = c.truncated
+}
+
+// streamWriter 单个输出流的写入器
+type streamWriter struct {
+	collector *outputCollector
+	stream    string
+}
+
+// Write 实现 io.Writer
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.collector.write(w.stream, p)
+	return len(p), nil
 }
 
 // createScriptFile 创建临时脚本文件
@@ -347,10 +632,8 @@ func (e *Executor) StopCommand(id string) error {
 	defer e.mu.Unlock()
 
 	if cmd, exists := e.running[id]; exists {
-		if cmd.Process != nil {
-			if err := cmd.Process.Kill(); err != nil {
-				return err
-			}
+		if err := killCommand(cmd); err != nil && err != os.ErrProcessDone {
+			return err
 		}
 		delete(e.running, id)
 		logger.Infof("Command %s stopped", id)
@@ -1,10 +1,12 @@
 package executor
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"assistant_agent/internal/config"
 	"assistant_agent/internal/logger"
@@ -190,6 +192,36 @@ func TestExecutorTimeout(t *testing.T) {
 	}
 }
 
+func TestExecutorContextCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep command requires sh")
+	}
+
+	tempDir := t.TempDir()
+	exec, err := New(filepath.Join(tempDir, "work"), filepath.Join(tempDir, "temp"))
+	require.NoError(t, err)
+	require.NoError(t, exec.Start())
+	defer exec.Stop()
+
+	// 取消上下文后命令被终止
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	result := exec.Execute(&Command{
+		ID:      "test-cancel",
+		Type:    CommandTypeShell,
+		Script:  "sleep 10",
+		Timeout: 30,
+		Context: ctx,
+	})
+
+	assert.False(t, result.Success)
+	assert.Equal(t, "command canceled", result.Error)
+	assert.False(t, result.KilledByTimeout)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
 func TestExecutorInvalidCommandType(t *testing.T) {
 	// 创建执行器
 	tempDir := t.TempDir()
@@ -307,6 +339,112 @@ func TestExecutorEnvironmentVariables(t *testing.T) {
 	}
 }
 
+func TestExecutorStreamOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell streaming test requires bash")
+	}
+
+	// 创建执行器
+	tempDir := t.TempDir()
+	exec, err := New(filepath.Join(tempDir, "work"), filepath.Join(tempDir, "temp"))
+	require.NoError(t, err)
+	require.NoError(t, exec.Start())
+	defer exec.Stop()
+
+	// 收集输出片段
+	var chunks []*OutputChunk
+	cmd := &Command{
+		ID:      "test-stream",
+		Type:    CommandTypeShell,
+		Script:  "echo out; sleep 0.1; echo err >&2",
+		Timeout: 10,
+		OnOutput: func(chunk *OutputChunk) {
+			chunks = append(chunks, chunk)
+		},
+	}
+
+	result := exec.Execute(cmd)
+	assert.True(t, result.Success)
+
+	// 验证片段顺序和流类型
+	require.Len(t, chunks, 2)
+	assert.Equal(t, int64(1), chunks[0].Seq)
+	assert.Equal(t, "stdout", chunks[0].Stream)
+	assert.Equal(t, "out\n", chunks[0].Data)
+	assert.Equal(t, int64(2), chunks[1].Seq)
+	assert.Equal(t, "stderr", chunks[1].Stream)
+	assert.Equal(t, "test-stream", chunks[1].ID)
+
+	// 合并输出仍然完整
+	assert.Equal(t, "out\nerr\n", result.Output)
+}
+
+func TestExecutorSeparateOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("output capture test requires bash")
+	}
+
+	// 创建执行器
+	tempDir := t.TempDir()
+	exec, err := New(filepath.Join(tempDir, "work"), filepath.Join(tempDir, "temp"))
+	require.NoError(t, err)
+
+	cmd := &Command{
+		ID:      "test-separate",
+		Type:    CommandTypeShell,
+		Script:  "echo out; echo err >&2",
+		Timeout: 10,
+	}
+
+	// 默认同时保留合并输出
+	result := exec.Execute(cmd)
+	assert.True(t, result.Success)
+	assert.Equal(t, "out\n", result.Stdout)
+	assert.Equal(t, "err\n", result.Stderr)
+	assert.Contains(t, result.Output, "out\n")
+	assert.Contains(t, result.Output, "err\n")
+
+	// 关闭合并输出
+	exec.SetOutputOptions(DefaultMaxOutputSize, false)
+	result = exec.Execute(cmd)
+	assert.Equal(t, "out\n", result.Stdout)
+	assert.Empty(t, result.Output)
+}
+
+func TestExecutorOutputTruncation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("output capture test requires bash")
+	}
+
+	// 创建执行器
+	tempDir := t.TempDir()
+	exec, err := New(filepath.Join(tempDir, "work"), filepath.Join(tempDir, "temp"))
+	require.NoError(t, err)
+	exec.SetOutputOptions(1024, true)
+
+	result := exec.Execute(&Command{
+		ID:      "test-truncate",
+		Type:    CommandTypeShell,
+		Script:  "head -c 100000 /dev/zero | tr '\\0' a; echo err >&2",
+		Timeout: 10,
+	})
+	assert.True(t, result.Success)
+	assert.True(t, result.Truncated)
+	assert.Len(t, result.Stdout, 1024)
+	assert.Equal(t, "err\n", result.Stderr)
+
+	// 命令级限制覆盖执行器默认值
+	result = exec.Execute(&Command{
+		ID:            "test-truncate-override",
+		Type:          CommandTypeShell,
+		Script:        "echo hello",
+		MaxOutputSize: 2,
+		Timeout:       10,
+	})
+	assert.True(t, result.Truncated)
+	assert.Equal(t, "he", result.Stdout)
+}
+
 func TestExecutorStopCommand(t *testing.T) {
 	// 创建执行器
 	tempDir := t.TempDir()
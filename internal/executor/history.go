@@ -0,0 +1,298 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/fsutil"
+	"assistant_agent/internal/logger"
+)
+
+const (
+	// historyFileName 命令历史文件名
+	historyFileName = "command_history.jsonl"
+	// DefaultHistoryMaxEntries 默认保留的历史记录条数
+	DefaultHistoryMaxEntries = 1000
+	// DefaultHistoryLimit 未指定 limit 时每页返回的记录数
+	DefaultHistoryLimit = 50
+	// MaxHistoryLimit 每页最多返回的记录数
+	MaxHistoryLimit = 200
+	// HistoryMaxOutputSize 历史记录中每个输出流保存的最大字节数，超出部分截断
+	HistoryMaxOutputSize = 16 * 1024
+)
+
+// HistoryQuery 命令历史查询条件，零值字段表示不限制
+type HistoryQuery struct {
+	ID       string    `json:"id,omitempty"`
+	Since    time.Time `json:"since,omitempty"`
+	Until    time.Time `json:"until,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Success  *bool     `json:"success,omitempty"`
+	Offset   int       `json:"offset,omitempty"` // 跳过的记录数，用于分页
+	Limit    int       `json:"limit,omitempty"`  // 为 0 时使用 DefaultHistoryLimit，最大 MaxHistoryLimit
+}
+
+// historyEntry 历史记录的索引，保存查询条件用到的字段和记录在文件中的位置，
+// 查询时只读取命中的记录，不需要重新解析整个文件
+type historyEntry struct {
+	offset    int64
+	size      int
+	id        string
+	startTime time.Time
+	exitCode  int
+	success   bool
+}
+
+// History 命令历史存储，以 JSON Lines 格式保存在数据目录下
+type History struct {
+	path       string
+	maxEntries int
+	entries    []historyEntry
+	mu         sync.Mutex
+}
+
+// NewHistory 创建命令历史存储
+func NewHistory(dataDir string, maxEntries int) (*History, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultHistoryMaxEntries
+	}
+
+	h := &History{
+		path:       filepath.Join(dataDir, historyFileName),
+		maxEntries: maxEntries,
+	}
+
+	entries, err := h.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	h.entries = entries
+
+	return h, nil
+}
+
+// Record 追加一条执行结果，输出超过 HistoryMaxOutputSize 的部分不保存
+func (h *History) Record(result *Result) error {
+	data, err := json.Marshal(historyRecord(result))
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %v", err)
+	}
+	data = append(data, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	h.entries = append(h.entries, newHistoryEntry(result, offset, len(data)))
+
+	// 记录数超过上限两倍时压缩，避免每次写入都重写文件
+	if len(h.entries) > h.maxEntries*2 {
+		return h.compact()
+	}
+	return nil
+}
+
+// historyRecord 返回用于保存的结果副本，每个输出流只保留前 HistoryMaxOutputSize 字节
+func historyRecord(result *Result) *Result {
+	record := *result
+	for _, output := range []*string{&record.Output, &record.Stdout, &record.Stderr} {
+		if len(*output) > HistoryMaxOutputSize {
+			*output = (*output)[:HistoryMaxOutputSize]
+			record.Truncated = true
+		}
+	}
+	return &record
+}
+
+// newHistoryEntry 创建记录的索引
+func newHistoryEntry(result *Result, offset int64, size int) historyEntry {
+	return historyEntry{
+		offset:    offset,
+		size:      size,
+		id:        result.ID,
+		startTime: result.StartTime,
+		exitCode:  result.ExitCode,
+		success:   result.Success,
+	}
+}
+
+// Query 按条件分页查询历史记录，按开始时间倒序返回，同时返回满足条件的记录总数
+func (h *History) Query(query *HistoryQuery) ([]*Result, int, error) {
+	if query == nil {
+		query = &HistoryQuery{}
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	limit = min(limit, MaxHistoryLimit)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var page []historyEntry
+	total := 0
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entry := h.entries[i]
+		if !query.match(&entry) {
+			continue
+		}
+		if total >= query.Offset && len(page) < limit {
+			page = append(page, entry)
+		}
+		total++
+	}
+	if len(page) == 0 {
+		return []*Result{}, total, nil
+	}
+
+	file, err := os.Open(h.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	results := make([]*Result, 0, len(page))
+	for _, entry := range page {
+		result, err := readHistoryEntry(file, entry)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, result)
+	}
+	return results, total, nil
+}
+
+// match 判断记录是否满足查询条件
+func (q *HistoryQuery) match(entry *historyEntry) bool {
+	if q.ID != "" && entry.id != q.ID {
+		return false
+	}
+	if !q.Since.IsZero() && entry.startTime.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && entry.startTime.After(q.Until) {
+		return false
+	}
+	if q.ExitCode != nil && entry.exitCode != *q.ExitCode {
+		return false
+	}
+	if q.Success != nil && entry.success != *q.Success {
+		return false
+	}
+	return true
+}
+
+// readHistoryEntry 按索引读取一条记录
+func readHistoryEntry(file *os.File, entry historyEntry) (*Result, error) {
+	data := make([]byte, entry.size)
+	if _, err := file.ReadAt(data, entry.offset); err != nil {
+		return nil, fmt.Errorf("failed to read command history: %v", err)
+	}
+	var result Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid command history entry: %v", err)
+	}
+	return &result, nil
+}
+
+// loadIndex 扫描历史文件建立索引，跳过损坏的记录
+func (h *History) loadIndex() ([]historyEntry, error) {
+	file, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		// 没有换行符的最后一行是未写完的记录
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var result Result
+		if err := json.Unmarshal(line, &result); err != nil {
+			logger.Warnf("Skipping corrupted command history entry: %v", err)
+		} else {
+			entries = append(entries, newHistoryEntry(&result, offset, len(line)))
+		}
+		offset += int64(len(line))
+	}
+	return entries, nil
+}
+
+// compact 只保留最近 maxEntries 条记录，旧版本保存的超长输出同时被截断
+func (h *History) compact() error {
+	entries := h.entries
+	if len(entries) > h.maxEntries {
+		entries = entries[len(entries)-h.maxEntries:]
+	}
+
+	src, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	compacted := make([]historyEntry, 0, len(entries))
+	err = fsutil.WriteAtomic(fsutil.OS, h.path, 0600, func(w io.Writer) error {
+		var offset int64
+		for _, entry := range entries {
+			result, err := readHistoryEntry(src, entry)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(historyRecord(result))
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			compacted = append(compacted, newHistoryEntry(result, offset, len(data)))
+			offset += int64(len(data))
+		}
+		// Windows 上不能重命名覆盖仍被打开的文件
+		src.Close()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.entries = compacted
+	return nil
+}
@@ -0,0 +1,189 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryRecordAndQuery(t *testing.T) {
+	history, err := NewHistory(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, history.Record(&Result{
+			ID:        fmt.Sprintf("cmd-%d", i),
+			Success:   i%2 == 0,
+			ExitCode:  i % 2,
+			StartTime: base.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+
+	// 全部记录按时间倒序
+	results, _, err := history.Query(nil)
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+	assert.Equal(t, "cmd-4", results[0].ID)
+
+	// 按 ID 查询
+	results, _, err = history.Query(&HistoryQuery{ID: "cmd-2"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "cmd-2", results[0].ID)
+
+	// 按退出码查询
+	exitCode := 1
+	results, _, err = history.Query(&HistoryQuery{ExitCode: &exitCode})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// 按时间范围查询
+	results, _, err = history.Query(&HistoryQuery{Since: base.Add(90 * time.Second), Until: base.Add(210 * time.Second)})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "cmd-3", results[0].ID)
+	assert.Equal(t, "cmd-2", results[1].ID)
+
+	// 限制条数
+	results, _, err = history.Query(&HistoryQuery{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	dir := t.TempDir()
+	history, err := NewHistory(dir, 10)
+	require.NoError(t, err)
+	require.NoError(t, history.Record(&Result{ID: "persisted"}))
+
+	// 重新打开后仍可查询
+	reopened, err := NewHistory(dir, 10)
+	require.NoError(t, err)
+	results, _, err := reopened.Query(&HistoryQuery{ID: "persisted"})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	// 损坏的记录会被跳过
+	file, err := os.OpenFile(filepath.Join(dir, historyFileName), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString("not json\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	results, _, err = reopened.Query(nil)
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func TestHistoryCompact(t *testing.T) {
+	history, err := NewHistory(t.TempDir(), 3)
+	require.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, history.Record(&Result{ID: fmt.Sprintf("cmd-%d", i)}))
+	}
+
+	results, _, err := history.Query(nil)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "cmd-6", results[0].ID)
+	assert.Equal(t, "cmd-4", results[2].ID)
+}
+
+func TestHistoryPagination(t *testing.T) {
+	history, err := NewHistory(t.TempDir(), MaxHistoryLimit*2)
+	require.NoError(t, err)
+	for i := 0; i < MaxHistoryLimit+10; i++ {
+		require.NoError(t, history.Record(&Result{ID: fmt.Sprintf("cmd-%d", i), Success: i%2 == 0}))
+	}
+
+	// 未指定 limit 时使用默认值，超过上限时按上限返回
+	results, total, err := history.Query(nil)
+	require.NoError(t, err)
+	assert.Len(t, results, DefaultHistoryLimit)
+	assert.Equal(t, MaxHistoryLimit+10, total)
+	results, _, err = history.Query(&HistoryQuery{Limit: MaxHistoryLimit * 2})
+	require.NoError(t, err)
+	assert.Len(t, results, MaxHistoryLimit)
+
+	// offset 跳过满足条件的记录，total 只统计满足条件的记录
+	success := true
+	results, total, err = history.Query(&HistoryQuery{Success: &success, Offset: 2, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, (MaxHistoryLimit+10)/2, total)
+	require.Len(t, results, 2)
+	assert.Equal(t, fmt.Sprintf("cmd-%d", MaxHistoryLimit+10-6), results[0].ID)
+
+	results, _, err = history.Query(&HistoryQuery{Offset: MaxHistoryLimit + 10})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestHistoryTruncatesOutput(t *testing.T) {
+	dir := t.TempDir()
+	history, err := NewHistory(dir, 2)
+	require.NoError(t, err)
+
+	large := strings.Repeat("x", HistoryMaxOutputSize+100)
+	result := &Result{ID: "large", Stdout: large, Output: large, Stderr: "error"}
+	require.NoError(t, history.Record(result))
+	assert.Len(t, result.Stdout, HistoryMaxOutputSize+100, "caller's result is not modified")
+
+	results, _, err := history.Query(nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Len(t, results[0].Stdout, HistoryMaxOutputSize)
+	assert.Len(t, results[0].Output, HistoryMaxOutputSize)
+	assert.Equal(t, "error", results[0].Stderr)
+	assert.True(t, results[0].Truncated)
+
+	// 压缩时旧版本保存的超长输出同样被截断
+	var legacy []byte
+	for i := 0; i < 4; i++ {
+		line, err := json.Marshal(&Result{ID: fmt.Sprintf("legacy-%d", i), Stdout: large})
+		require.NoError(t, err)
+		legacy = append(append(legacy, line...), '\n')
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, historyFileName), legacy, 0600))
+	history, err = NewHistory(dir, 2)
+	require.NoError(t, err)
+	require.NoError(t, history.Record(&Result{ID: "cmd-0"}))
+
+	results, _, err = history.Query(nil)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "legacy-3", results[1].ID)
+	assert.Len(t, results[1].Stdout, HistoryMaxOutputSize)
+	assert.True(t, results[1].Truncated)
+}
+
+func TestExecutorRecordsHistory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("history test requires bash")
+	}
+
+	executor := newTestExecutor(t)
+	_, _, err := executor.QueryHistory(nil)
+	assert.Error(t, err)
+
+	history, err := NewHistory(t.TempDir(), 10)
+	require.NoError(t, err)
+	executor.SetHistory(history)
+
+	executor.Execute(&Command{ID: "recorded", Type: CommandTypeShell, Script: "exit 3", Timeout: 10})
+
+	results, _, err := executor.QueryHistory(&HistoryQuery{ID: "recorded"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, 3, results[0].ExitCode)
+	assert.False(t, results[0].Success)
+}
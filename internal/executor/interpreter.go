@@ -0,0 +1,140 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Interpreter 解释器配置
+type Interpreter struct {
+	Extension string   `json:"extension"` // 脚本文件扩展名
+	Timeout   int      `json:"timeout"`   // 命令未指定超时时使用的默认超时（秒）
+	Env       []string `json:"env"`       // 注入的环境变量
+}
+
+// defaultExtensions 常见解释器的脚本扩展名
+var defaultExtensions = map[string]string{
+	"python":     "py",
+	"pypy":       "py",
+	"node":       "js",
+	"nodejs":     "js",
+	"deno":       "ts",
+	"ruby":       "rb",
+	"perl":       "pl",
+	"php":        "php",
+	"lua":        "lua",
+	"bash":       "sh",
+	"sh":         "sh",
+	"zsh":        "sh",
+	"pwsh":       "ps1",
+	"powershell": "ps1",
+}
+
+// RegisterInterpreter 注册解释器配置，name 为解释器可执行文件名
+func (e *Executor) RegisterInterpreter(name string, interpreter *Interpreter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.interpreters[name] = interpreter
+}
+
+// getInterpreter 获取解释器配置，未注册时返回默认配置
+func (e *Executor) getInterpreter(name string) *Interpreter {
+	e.mu.RLock()
+	interpreter, exists := e.interpreters[name]
+	e.mu.RUnlock()
+
+	result := &Interpreter{}
+	if exists {
+		*result = *interpreter
+	}
+	if result.Extension == "" {
+		result.Extension = interpreterExtension(name)
+	}
+	return result
+}
+
+// interpreterExtension 根据解释器名称推断脚本扩展名
+func interpreterExtension(name string) string {
+	// 同时兼容 Unix 和 Windows 路径分隔符
+	base := strings.ToLower(name[strings.LastIndexAny(name, `/\`)+1:])
+	base = strings.TrimSuffix(base, ".exe")
+	// 去掉版本号后缀，如 python3、python3.11
+	base = strings.TrimRight(base, "0123456789.")
+
+	if ext, ok := defaultExtensions[base]; ok {
+		return ext
+	}
+	return "script"
+}
+
+// executeInterpreter 使用指定解释器执行脚本
+func (e *Executor) executeInterpreter(cmd *Command) *Result {
+	result := &Result{
+		ID:        cmd.ID,
+		StartTime: time.Now(),
+	}
+
+	if cmd.Interpreter == "" {
+		result.Success = false
+		result.Error = "interpreter is required for interpreter commands"
+		return result
+	}
+
+	binary, err := exec.LookPath(cmd.Interpreter)
+	if err != nil {
+		result.Success = false
+		result.Error = fmt.Sprintf("interpreter not found: %s", cmd.Interpreter)
+		return result
+	}
+
+	interpreter := e.getInterpreter(cmd.Interpreter)
+
+	// 创建临时脚本文件
+	scriptFile, err := e.createScriptFile(cmd.Script, interpreter.Extension)
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+	defer os.Remove(scriptFile)
+
+	// 命令未指定超时时使用解释器默认超时
+	if cmd.Timeout <= 0 && interpreter.Timeout > 0 {
+		timeoutCmd := *cmd
+		timeoutCmd.Timeout = interpreter.Timeout
+		cmd = &timeoutCmd
+	}
+
+	// 设置超时
+	ctx, cancel := e.commandContext(cmd)
+	defer cancel()
+
+	// 创建命令
+	execCmd := exec.CommandContext(ctx, binary, append([]string{scriptFile}, cmd.Args...)...)
+
+	// 设置工作目录
+	if cmd.WorkingDir != "" {
+		execCmd.Dir = cmd.WorkingDir
+	} else {
+		execCmd.Dir = e.workDir
+	}
+
+	// 设置环境变量，命令级变量覆盖解释器级变量
+	env := append(os.Environ(), interpreter.Env...)
+	execCmd.Env = append(env, cmd.Env...)
+
+	// 切换执行用户
+	cleanup, err := configureRunAs(execCmd, cmd, scriptFile)
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+	defer cleanup()
+
+	e.runCommand(ctx, cmd, execCmd, result)
+	return result
+}
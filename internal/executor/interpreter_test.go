@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpreterExtension(t *testing.T) {
+	assert.Equal(t, "py", interpreterExtension("python3"))
+	assert.Equal(t, "py", interpreterExtension("/usr/bin/python3.11"))
+	assert.Equal(t, "js", interpreterExtension("node"))
+	assert.Equal(t, "rb", interpreterExtension("ruby"))
+	assert.Equal(t, "ps1", interpreterExtension(`C:\Program Files\PowerShell\7\pwsh.exe`))
+	assert.Equal(t, "script", interpreterExtension("unknown"))
+}
+
+func TestExecutorInterpreterCommand(t *testing.T) {
+	perl, err := exec.LookPath("perl")
+	if err != nil {
+		t.Skip("perl not available")
+	}
+
+	executor := newTestExecutor(t)
+	executor.RegisterInterpreter(perl, &Interpreter{Env: []string{"GREETING=hello", "TARGET=interpreter"}})
+
+	cmd := &Command{
+		ID:          "test-interpreter",
+		Type:        CommandTypeInterpreter,
+		Interpreter: perl,
+		Script:      `print "$ENV{GREETING} $ENV{TARGET} $ARGV[0]\n";`,
+		Args:        []string{"arg"},
+		Env:         []string{"TARGET=command"},
+		Timeout:     10,
+	}
+
+	result := executor.Execute(cmd)
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, "hello command arg\n", result.Output)
+}
+
+func TestExecutorInterpreterTimeout(t *testing.T) {
+	perl, err := exec.LookPath("perl")
+	if err != nil {
+		t.Skip("perl not available")
+	}
+
+	executor := newTestExecutor(t)
+	executor.RegisterInterpreter(perl, &Interpreter{Timeout: 1})
+
+	result := executor.Execute(&Command{
+		ID:          "test-interpreter-timeout",
+		Type:        CommandTypeInterpreter,
+		Interpreter: perl,
+		Script:      "sleep 5;",
+	})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "timeout")
+}
+
+func TestExecutorInterpreterErrors(t *testing.T) {
+	executor := newTestExecutor(t)
+
+	result := executor.Execute(&Command{ID: "missing", Type: CommandTypeInterpreter, Script: "1"})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "interpreter is required")
+
+	result = executor.Execute(&Command{ID: "unknown", Type: CommandTypeInterpreter, Interpreter: "no-such-interpreter", Script: "1"})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "interpreter not found")
+}
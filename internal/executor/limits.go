@@ -0,0 +1,12 @@
+package executor
+
+// 资源限制类型
+const (
+	LimitMemory = "memory"
+	LimitCPU    = "cpu"
+)
+
+// hasResourceLimits 判断命令是否设置了资源限制
+func hasResourceLimits(cmd *Command) bool {
+	return cmd.MaxMemoryMB > 0 || cmd.CPUQuota > 0 || cmd.Niceness != 0
+}
@@ -0,0 +1,314 @@
+//go:build linux
+
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"assistant_agent/internal/logger"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cgroupRoot      = "/sys/fs/cgroup"
+	cgroupAgentLeaf = "agent" // 委派的 cgroup 中存放 Agent 自身进程的叶子组，命令子组与其并列
+	cgroupCPUPeriod = 100000
+
+	// limitsEnv 设置后进程作为启动器运行：先为自身设置 rlimit 和 niceness，再执行目标程序
+	limitsEnv = "ASSISTANT_AGENT_PROCESS_LIMITS"
+)
+
+var (
+	delegatedOnce sync.Once
+	delegatedDir  string
+	delegatedErr  error
+)
+
+func init() {
+	if spec, ok := os.LookupEnv(limitsEnv); ok {
+		os.Unsetenv(limitsEnv)
+		if err := execLimited(spec, os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to apply resource limits: %v\n", err)
+			os.Exit(126)
+		}
+	}
+}
+
+// processLimits 单个命令的资源限制，优先使用 cgroup v2，不可用时回退到 rlimit
+type processLimits struct {
+	cmd       *Command
+	cgroupDir string
+	cgroupFD  *os.File
+}
+
+// newProcessLimits 在进程启动前准备资源限制
+func newProcessLimits(cmd *Command) (*processLimits, error) {
+	if !hasResourceLimits(cmd) {
+		return nil, nil
+	}
+
+	l := &processLimits{cmd: cmd}
+	if cmd.MaxMemoryMB > 0 || cmd.CPUQuota > 0 {
+		dir, err := createCgroup(cmd)
+		if err != nil {
+			logger.Debugf("cgroup v2 not available, falling back to rlimit: %v", err)
+		} else {
+			l.cgroupDir = dir
+		}
+	}
+
+	return l, nil
+}
+
+// prepare 在进程启动前配置资源限制，进程从第一条指令起就受限，之后创建的子进程也无法逃逸：
+// 进程通过 CgroupFD 直接创建在命令的 cgroup 中；rlimit 和 niceness 由 Agent 自身作为启动器
+// 在子进程内设置后再执行目标程序
+func (l *processLimits) prepare(execCmd *exec.Cmd) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.cgroupDir != "" {
+		dir, err := os.Open(l.cgroupDir)
+		if err != nil {
+			return fmt.Errorf("failed to open cgroup: %v", err)
+		}
+		l.cgroupFD = dir
+		if execCmd.SysProcAttr == nil {
+			execCmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		execCmd.SysProcAttr.UseCgroupFD = true
+		execCmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	}
+
+	var spec []string
+	if l.cgroupDir == "" {
+		if l.cmd.MaxMemoryMB > 0 {
+			spec = append(spec, fmt.Sprintf("as=%d", uint64(l.cmd.MaxMemoryMB)*1024*1024))
+		}
+		if l.cmd.CPUQuota > 0 {
+			logger.Warnf("CPU quota for command %s requires cgroup v2, ignored", l.cmd.ID)
+		}
+	}
+	if l.cmd.Niceness != 0 {
+		spec = append(spec, fmt.Sprintf("nice=%d", l.cmd.Niceness))
+	}
+	// 程序不存在时保留原命令，由 Start 返回查找失败的错误
+	if len(spec) == 0 || execCmd.Err != nil {
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate process launcher: %v", err)
+	}
+	execCmd.Env = append(execCmd.Environ(), limitsEnv+"="+strings.Join(spec, ","))
+	execCmd.Args = append([]string{self, execCmd.Path}, execCmd.Args...)
+	execCmd.Path = self
+	return nil
+}
+
+// apply 在进程启动后关闭 cgroup 目录，限制已在 prepare 中生效
+func (l *processLimits) apply(process *os.Process) error {
+	if l != nil && l.cgroupFD != nil {
+		l.cgroupFD.Close()
+		l.cgroupFD = nil
+	}
+	return nil
+}
+
+// release 在进程结束后释放资源，返回触发的资源限制类型
+func (l *processLimits) release() string {
+	if l == nil {
+		return ""
+	}
+	if l.cgroupFD != nil {
+		l.cgroupFD.Close()
+		l.cgroupFD = nil
+	}
+	if l.cgroupDir == "" {
+		return ""
+	}
+	defer os.Remove(l.cgroupDir)
+
+	if readCgroupStat(filepath.Join(l.cgroupDir, "memory.events"), "oom_kill") > 0 {
+		return LimitMemory
+	}
+	if readCgroupStat(filepath.Join(l.cgroupDir, "cpu.stat"), "nr_throttled") > 0 {
+		return LimitCPU
+	}
+	return ""
+}
+
+// execLimited 按 spec（as=<字节数>,nice=<值>）设置当前进程的限制后执行目标程序，
+// args 为程序路径和完整的参数列表
+func execLimited(spec string, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("missing command")
+	}
+
+	// Linux 的 niceness 按线程生效，需在执行 exec 的线程上设置
+	runtime.LockOSThread()
+	for _, item := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(item, "=")
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid limit %q", item)
+		}
+		switch key {
+		case "as":
+			if err := unix.Setrlimit(unix.RLIMIT_AS, &unix.Rlimit{Cur: uint64(n), Max: uint64(n)}); err != nil {
+				return fmt.Errorf("failed to set memory rlimit: %v", err)
+			}
+		case "nice":
+			if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, int(n)); err != nil {
+				return fmt.Errorf("failed to set niceness: %v", err)
+			}
+		default:
+			return fmt.Errorf("invalid limit %q", item)
+		}
+	}
+
+	return syscall.Exec(args[0], args[1:], os.Environ())
+}
+
+// delegatedCgroup 返回委派给 Agent 的 cgroup v2 子树，只在首次调用时配置
+func delegatedCgroup() (string, error) {
+	delegatedOnce.Do(func() {
+		delegatedDir, delegatedErr = setupDelegatedCgroup(cgroupRoot, "/proc/self/cgroup")
+	})
+	return delegatedDir, delegatedErr
+}
+
+// setupDelegatedCgroup 查找 Agent 所在的、已委派给它的 cgroup（systemd 服务设置 Delegate=yes），
+// 把 Agent 自身的进程移到叶子组 agent 中，再为命令子组启用 memory 和 cpu 控制器。
+// 根 cgroup 和未委派的 cgroup 由系统管理，不会修改
+func setupDelegatedCgroup(root, selfCgroup string) (string, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 not mounted")
+	}
+
+	data, err := os.ReadFile(selfCgroup)
+	if err != nil {
+		return "", err
+	}
+	path, ok := unifiedCgroupPath(string(data))
+	if !ok || path == "/" {
+		return "", fmt.Errorf("agent is not in a delegated cgroup")
+	}
+
+	base := filepath.Join(root, path)
+	// 之前已配置过时 Agent 位于叶子组中，例如更新后原地重启
+	if filepath.Base(base) == cgroupAgentLeaf && isDelegated(filepath.Dir(base)) {
+		return filepath.Dir(base), nil
+	}
+	if !isDelegated(base) {
+		return "", fmt.Errorf("cgroup %s is not delegated to the agent", base)
+	}
+
+	// 有进程的 cgroup 不能为子组启用控制器，先把 Agent 的进程移到叶子组
+	leaf := filepath.Join(base, cgroupAgentLeaf)
+	if err := os.MkdirAll(leaf, 0755); err != nil {
+		return "", err
+	}
+	procs, err := os.ReadFile(filepath.Join(base, "cgroup.procs"))
+	if err != nil {
+		return "", err
+	}
+	for _, pid := range strings.Fields(string(procs)) {
+		// 移动期间退出的进程忽略，仍有进程残留时启用控制器会失败
+		os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(pid), 0644)
+	}
+	if err := os.WriteFile(filepath.Join(base, "cgroup.subtree_control"), []byte("+memory +cpu"), 0644); err != nil {
+		return "", fmt.Errorf("failed to enable cgroup controllers: %v", err)
+	}
+
+	return base, nil
+}
+
+// unifiedCgroupPath 从 /proc/self/cgroup 中读取 cgroup v2 的路径
+func unifiedCgroupPath(content string) (string, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		if path, ok := strings.CutPrefix(strings.TrimSpace(line), "0::"); ok {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// isDelegated 判断 cgroup 是否已委派，systemd 为 Delegate=yes 的单元设置 trusted.delegate 或 user.delegate 扩展属性
+func isDelegated(dir string) bool {
+	for _, name := range []string{"trusted.delegate", "user.delegate"} {
+		buf := make([]byte, 8)
+		if n, err := unix.Getxattr(dir, name, buf); err == nil && string(buf[:n]) == "1" {
+			return true
+		}
+	}
+	return false
+}
+
+// createCgroup 在委派给 Agent 的 cgroup 中为命令创建子组并写入限制
+func createCgroup(cmd *Command) (string, error) {
+	parent, err := delegatedCgroup()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(parent, fmt.Sprintf("cmd-%d", time.Now().UnixNano()))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", err
+	}
+
+	if cmd.MaxMemoryMB > 0 {
+		limit := strconv.FormatInt(int64(cmd.MaxMemoryMB)*1024*1024, 10)
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(limit), 0644); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+		// 禁止使用 swap 绕过内存限制
+		os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0644)
+	}
+
+	if cmd.CPUQuota > 0 {
+		quota := int64(cmd.CPUQuota / 100 * cgroupCPUPeriod)
+		if quota < 1000 {
+			quota = 1000
+		}
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)), 0644); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// readCgroupStat 读取 cgroup 统计文件中的指定字段
+func readCgroupStat(path, key string) int64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			value, _ := strconv.ParseInt(fields[1], 10, 64)
+			return value
+		}
+	}
+	return 0
+}
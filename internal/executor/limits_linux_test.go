@@ -0,0 +1,64 @@
+//go:build linux
+
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnifiedCgroupPath(t *testing.T) {
+	path, ok := unifiedCgroupPath("12:memory:/legacy\n0::/system.slice/assistant-agent.service\n")
+	assert.True(t, ok)
+	assert.Equal(t, "/system.slice/assistant-agent.service", path)
+
+	_, ok = unifiedCgroupPath("4:cpu,cpuacct:/docker/abc\n")
+	assert.False(t, ok)
+}
+
+func TestSetupDelegatedCgroupRejectsUndelegated(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), nil, 0644))
+	service := filepath.Join(root, "system.slice", "assistant-agent.service")
+	require.NoError(t, os.MkdirAll(service, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(service, "cgroup.subtree_control"), nil, 0644))
+	selfCgroup := filepath.Join(t.TempDir(), "cgroup")
+
+	// 位于根 cgroup 或未委派的 cgroup 时不修改任何控制器配置
+	for _, content := range []string{"0::/\n", "0::/system.slice/assistant-agent.service\n"} {
+		require.NoError(t, os.WriteFile(selfCgroup, []byte(content), 0644))
+		_, err := setupDelegatedCgroup(root, selfCgroup)
+		assert.Error(t, err)
+	}
+
+	for _, dir := range []string{root, service} {
+		data, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+		require.NoError(t, err)
+		assert.Empty(t, data)
+	}
+	_, err := os.Stat(filepath.Join(service, cgroupAgentLeaf))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExecutorMemoryRlimitInChild(t *testing.T) {
+	if _, err := delegatedCgroup(); err == nil {
+		t.Skip("memory limit uses cgroup in this environment")
+	}
+
+	executor := newTestExecutor(t)
+	result := executor.Execute(&Command{
+		ID:          "test-rlimit",
+		Type:        CommandTypeShell,
+		Script:      "ulimit -v; sh -c 'ulimit -v'",
+		MaxMemoryMB: 64,
+		Timeout:     10,
+	})
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, []string{"65536", "65536"}, strings.Fields(result.Output))
+}
@@ -0,0 +1,54 @@
+//go:build !linux && !windows
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"assistant_agent/internal/logger"
+)
+
+// processLimits 单个命令的资源限制，当前平台仅支持 niceness
+type processLimits struct {
+	cmd *Command
+}
+
+// newProcessLimits 在进程启动前准备资源限制
+func newProcessLimits(cmd *Command) (*processLimits, error) {
+	if !hasResourceLimits(cmd) {
+		return nil, nil
+	}
+	return &processLimits{cmd: cmd}, nil
+}
+
+// prepare 在进程启动前配置资源限制，当前平台在 apply 中应用
+func (l *processLimits) prepare(execCmd *exec.Cmd) error {
+	return nil
+}
+
+// apply 在进程启动后应用资源限制
+func (l *processLimits) apply(process *os.Process) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.cmd.MaxMemoryMB > 0 || l.cmd.CPUQuota > 0 {
+		logger.Warnf("Memory and CPU limits are not supported on this platform, ignored for command %s", l.cmd.ID)
+	}
+
+	if l.cmd.Niceness != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, process.Pid, l.cmd.Niceness); err != nil {
+			return fmt.Errorf("failed to set niceness: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// release 在进程结束后释放资源，返回触发的资源限制类型
+func (l *processLimits) release() string {
+	return ""
+}
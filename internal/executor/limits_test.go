@@ -0,0 +1,51 @@
+package executor
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasResourceLimits(t *testing.T) {
+	assert.False(t, hasResourceLimits(&Command{}))
+	assert.True(t, hasResourceLimits(&Command{MaxMemoryMB: 64}))
+	assert.True(t, hasResourceLimits(&Command{CPUQuota: 50}))
+	assert.True(t, hasResourceLimits(&Command{Niceness: 10}))
+}
+
+func TestExecutorNiceness(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("niceness test requires unix")
+	}
+
+	executor := newTestExecutor(t)
+	result := executor.Execute(&Command{
+		ID:       "test-nice",
+		Type:     CommandTypeShell,
+		Script:   "ps -o ni= -p $$; sh -c 'ps -o ni= -p $$'",
+		Niceness: 10,
+		Timeout:  10,
+	})
+	require.True(t, result.Success, result.Error)
+	// 限制在进程启动时已生效，立即创建的子进程同样受限
+	assert.Equal(t, []string{"10", "10"}, strings.Fields(result.Output))
+}
+
+func TestExecutorMemoryLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("memory limit test requires linux")
+	}
+
+	executor := newTestExecutor(t)
+	result := executor.Execute(&Command{
+		ID:          "test-memory",
+		Type:        CommandTypeShell,
+		Script:      "x=$(head -c 200000000 /dev/zero | tr '\\0' a); echo ${#x}",
+		MaxMemoryMB: 64,
+		Timeout:     10,
+	})
+	assert.False(t, result.Success)
+}
@@ -0,0 +1,184 @@
+//go:build windows
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	jobObjectCPURateControlEnable  = 0x1
+	jobObjectCPURateControlHardCap = 0x4
+)
+
+// jobObjectCPURateControlInformation JOBOBJECT_CPU_RATE_CONTROL_INFORMATION
+type jobObjectCPURateControlInformation struct {
+	ControlFlags uint32
+	CPURate      uint32
+}
+
+// processLimits 单个命令的资源限制，基于 Job Object 实现
+type processLimits struct {
+	cmd *Command
+	job windows.Handle
+}
+
+// newProcessLimits 在进程启动前创建 Job Object 并写入限制
+func newProcessLimits(cmd *Command) (*processLimits, error) {
+	if !hasResourceLimits(cmd) {
+		return nil, nil
+	}
+
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job object: %v", err)
+	}
+	l := &processLimits{cmd: cmd, job: job}
+
+	if cmd.MaxMemoryMB > 0 {
+		info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+		info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_PROCESS_MEMORY
+		info.ProcessMemoryLimit = uintptr(cmd.MaxMemoryMB) * 1024 * 1024
+		if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+			uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+			l.release()
+			return nil, fmt.Errorf("failed to set memory limit: %v", err)
+		}
+	}
+
+	if cmd.CPUQuota > 0 {
+		// CpuRate 以整机 CPU 的万分比表示，CPUQuota 以单核百分比表示
+		rate := uint32(cmd.CPUQuota * 100 / float64(runtime.NumCPU()))
+		if rate < 1 {
+			rate = 1
+		}
+		if rate > 10000 {
+			rate = 10000
+		}
+		info := jobObjectCPURateControlInformation{
+			ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlHardCap,
+			CPURate:      rate,
+		}
+		if _, err := windows.SetInformationJobObject(job, windows.JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+			l.release()
+			return nil, fmt.Errorf("failed to set cpu quota: %v", err)
+		}
+	}
+
+	return l, nil
+}
+
+// prepare 以挂起状态启动进程，在 apply 加入 Job Object 后才恢复运行，
+// 避免进程在受限之前分配内存或创建不受限的子进程
+func (l *processLimits) prepare(execCmd *exec.Cmd) error {
+	if l == nil {
+		return nil
+	}
+	if execCmd.SysProcAttr == nil {
+		execCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	execCmd.SysProcAttr.CreationFlags |= windows.CREATE_SUSPENDED
+	return nil
+}
+
+// apply 在进程启动后将进程加入 Job Object、设置优先级，然后恢复进程的主线程
+func (l *processLimits) apply(process *os.Process) error {
+	if l == nil {
+		return nil
+	}
+
+	handle, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE|windows.PROCESS_SET_INFORMATION, false, uint32(process.Pid))
+	if err != nil {
+		return fmt.Errorf("failed to open process: %v", err)
+	}
+	defer windows.CloseHandle(handle)
+
+	if err := windows.AssignProcessToJobObject(l.job, handle); err != nil {
+		return fmt.Errorf("failed to assign process to job object: %v", err)
+	}
+
+	if l.cmd.Niceness != 0 {
+		if err := windows.SetPriorityClass(handle, priorityClass(l.cmd.Niceness)); err != nil {
+			return fmt.Errorf("failed to set priority class: %v", err)
+		}
+	}
+
+	return resumeProcess(uint32(process.Pid))
+}
+
+// resumeProcess 恢复以 CREATE_SUSPENDED 启动的进程。os.Process 不提供主线程句柄，
+// 通过线程快照找到属于该进程的线程逐个恢复
+func resumeProcess(pid uint32) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create thread snapshot: %v", err)
+	}
+	defer windows.CloseHandle(snapshot)
+
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	resumed := 0
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+		thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if err != nil {
+			return fmt.Errorf("failed to open thread: %v", err)
+		}
+		_, err = windows.ResumeThread(thread)
+		windows.CloseHandle(thread)
+		if err != nil {
+			return fmt.Errorf("failed to resume thread: %v", err)
+		}
+		resumed++
+	}
+	if resumed == 0 {
+		return fmt.Errorf("no threads found for process %d", pid)
+	}
+	return nil
+}
+
+// release 在进程结束后关闭 Job Object，返回触发的资源限制类型
+func (l *processLimits) release() string {
+	if l == nil || l.job == 0 {
+		return ""
+	}
+	defer func() {
+		windows.CloseHandle(l.job)
+		l.job = 0
+	}()
+
+	if l.cmd.MaxMemoryMB > 0 {
+		info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+		if err := windows.QueryInformationJobObject(l.job, windows.JobObjectExtendedLimitInformation,
+			uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), nil); err == nil {
+			if info.PeakProcessMemoryUsed >= info.ProcessMemoryLimit {
+				return LimitMemory
+			}
+		}
+	}
+
+	return ""
+}
+
+// priorityClass 将 Unix niceness 映射为 Windows 优先级
+func priorityClass(niceness int) uint32 {
+	switch {
+	case niceness >= 15:
+		return windows.IDLE_PRIORITY_CLASS
+	case niceness > 0:
+		return windows.BELOW_NORMAL_PRIORITY_CLASS
+	case niceness <= -15:
+		return windows.HIGH_PRIORITY_CLASS
+	default:
+		return windows.ABOVE_NORMAL_PRIORITY_CLASS
+	}
+}
@@ -0,0 +1,291 @@
+package executor
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// defaultConfirmPatterns 内置的高危操作规则，命中后需要确认才能执行
+var defaultConfirmPatterns = []string{
+	// rm -rf /
+	`\brm\s+(-[a-zA-Z]*[rRf][a-zA-Z]*\s+)+(--no-preserve-root\s+)?/(\*)?(\s|$|;|&|\|)`,
+	// 格式化文件系统、直接写块设备
+	`\bmkfs(\.\w+)?\b`,
+	`\bdd\b.*\bof=/dev/`,
+	`>\s*/dev/[sh]d[a-z]`,
+	// fork 炸弹
+	`:\(\)\s*\{\s*:\|:&\s*\};:`,
+	// 修改注册表
+	`(?i)\breg(\.exe)?\s+(add|delete|import)\b`,
+	`(?i)\b(Set|New|Remove)-ItemProperty\b.*\b(HKLM|HKCU|Registry)::?`,
+	// 格式化或递归删除 Windows 磁盘
+	`(?i)\bformat(\.com)?\s+[a-z]:`,
+	`(?i)\bRemove-Item\b.*-Recurse\b.*\b[a-z]:\\(\s|$|'|")`,
+}
+
+// defaultConfirmBinaries 内置的关机重启程序，仅在作为命令调用时需要确认，出现在参数或文本中不受影响
+var defaultConfirmBinaries = []string{"shutdown", "reboot", "halt", "poweroff"}
+
+// shellKeywords 语法关键字，出现在命令位置时跳过，不作为程序名
+var shellKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"while": true, "until": true, "do": true, "done": true, "esac": true,
+	"{": true, "}": true, "!": true,
+}
+
+// shellClauses 语法结构，所在片段不包含命令：for/select/case 的变量和列表、函数定义、条件表达式
+var shellClauses = map[string]bool{
+	"for": true, "select": true, "case": true, "function": true, "[": true, "[[": true, "((": true,
+}
+
+// Policy 命令安全策略，零值仅启用内置的高危操作确认规则
+type Policy struct {
+	AllowBinaries   []string // 允许执行的程序名，为空表示不限制
+	DenyBinaries    []string // 禁止执行的程序名
+	DenyPatterns    []string // 禁止的脚本内容正则
+	ConfirmPatterns []string // 需要确认的脚本内容正则，会追加内置的高危操作规则
+	ForbiddenPaths  []string // 禁止访问的路径
+}
+
+// PolicyError 命令违反安全策略
+type PolicyError struct {
+	Reason               string
+	ConfirmationRequired bool
+}
+
+func (e *PolicyError) Error() string {
+	if e.ConfirmationRequired {
+		return fmt.Sprintf("command requires confirmation: %s", e.Reason)
+	}
+	return fmt.Sprintf("command rejected by policy: %s", e.Reason)
+}
+
+// compiledPolicy 预编译的安全策略
+type compiledPolicy struct {
+	allow   map[string]bool
+	deny    map[string]bool
+	denyRe  []*regexp.Regexp
+	confirm []*regexp.Regexp
+	paths   []string
+
+	confirmBinaries map[string]bool
+}
+
+// SetPolicy 设置命令安全策略，传入 nil 表示关闭策略检查
+func (e *Executor) SetPolicy(policy *Policy) error {
+	var compiled *compiledPolicy
+	if policy != nil {
+		var err error
+		if compiled, err = compilePolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policy = compiled
+	return nil
+}
+
+// compilePolicy 编译安全策略
+func compilePolicy(policy *Policy) (*compiledPolicy, error) {
+	compiled := &compiledPolicy{
+		allow: make(map[string]bool),
+		deny:  make(map[string]bool),
+
+		confirmBinaries: make(map[string]bool),
+	}
+	for _, name := range defaultConfirmBinaries {
+		compiled.confirmBinaries[name] = true
+	}
+
+	for _, name := range policy.AllowBinaries {
+		compiled.allow[normalizeBinary(name)] = true
+	}
+	for _, name := range policy.DenyBinaries {
+		compiled.deny[normalizeBinary(name)] = true
+	}
+
+	for _, pattern := range policy.DenyPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %v", pattern, err)
+		}
+		compiled.denyRe = append(compiled.denyRe, re)
+	}
+
+	for _, pattern := range append(append([]string{}, defaultConfirmPatterns...), policy.ConfirmPatterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid confirm pattern %q: %v", pattern, err)
+		}
+		compiled.confirm = append(compiled.confirm, re)
+	}
+
+	for _, p := range policy.ForbiddenPaths {
+		if p = normalizePath(p); p != "" {
+			compiled.paths = append(compiled.paths, p)
+		}
+	}
+
+	return compiled, nil
+}
+
+// checkPolicy 检查命令是否满足安全策略
+func (e *Executor) checkPolicy(cmd *Command) error {
+	e.mu.RLock()
+	policy := e.policy
+	e.mu.RUnlock()
+
+	if policy == nil {
+		return nil
+	}
+	return policy.check(cmd)
+}
+
+// check 依次检查程序名、禁止规则、禁止路径和需确认规则
+func (p *compiledPolicy) check(cmd *Command) error {
+	binaries := commandBinaries(cmd)
+	for _, binary := range binaries {
+		if p.deny[binary] {
+			return &PolicyError{Reason: fmt.Sprintf("binary %s is denied", binary)}
+		}
+		if len(p.allow) > 0 && !p.allow[binary] {
+			return &PolicyError{Reason: fmt.Sprintf("binary %s is not in allowlist", binary)}
+		}
+	}
+
+	content := strings.Join(append([]string{cmd.Script}, cmd.Args...), " ")
+	for _, re := range p.denyRe {
+		if re.MatchString(content) {
+			return &PolicyError{Reason: fmt.Sprintf("script matches deny pattern %s", re.String())}
+		}
+	}
+
+	for _, forbidden := range p.paths {
+		if pathWithin(cmd.WorkingDir, forbidden) {
+			return &PolicyError{Reason: fmt.Sprintf("working directory %s is forbidden", cmd.WorkingDir)}
+		}
+		for _, token := range tokenize(content) {
+			if pathWithin(token, forbidden) {
+				return &PolicyError{Reason: fmt.Sprintf("path %s is forbidden", forbidden)}
+			}
+		}
+	}
+
+	if cmd.Confirmed {
+		return nil
+	}
+	for _, binary := range binaries {
+		if p.confirmBinaries[binary] {
+			return &PolicyError{
+				Reason:               fmt.Sprintf("binary %s is dangerous", binary),
+				ConfirmationRequired: true,
+			}
+		}
+	}
+	for _, re := range p.confirm {
+		if re.MatchString(content) {
+			return &PolicyError{
+				Reason:               fmt.Sprintf("script matches dangerous pattern %s", re.String()),
+				ConfirmationRequired: true,
+			}
+		}
+	}
+
+	return nil
+}
+
+// commandBinaries 提取命令中调用的程序名
+func commandBinaries(cmd *Command) []string {
+	switch cmd.Type {
+	case CommandTypeInterpreter:
+		return []string{normalizeBinary(cmd.Interpreter)}
+	case CommandTypeContainer:
+		// 容器内的程序由容器隔离，仅检查 docker 本身
+		return []string{"docker"}
+	}
+
+	binaries := make([]string, 0)
+	for _, segment := range commandSegments(cmd.Script) {
+		fields := strings.Fields(segment)
+		// 跳过环境变量赋值、语法关键字和常见的命令前缀
+		for len(fields) > 0 && (strings.Contains(fields[0], "=") || shellKeywords[fields[0]] || fields[0] == "sudo" ||
+			fields[0] == "env" || fields[0] == "exec" || fields[0] == "nohup" || fields[0] == "time" || fields[0] == "&") {
+			if fields[0] == "sudo" && !containsBinary(binaries, "sudo") {
+				binaries = append(binaries, "sudo")
+			}
+			fields = fields[1:]
+		}
+		// 跳过注释、语法结构和 name() { 形式的函数定义
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || shellClauses[fields[0]] || strings.HasSuffix(fields[0], "()") {
+			continue
+		}
+		binary := normalizeBinary(strings.Trim(fields[0], "(){}"))
+		if binary != "" && !containsBinary(binaries, binary) {
+			binaries = append(binaries, binary)
+		}
+	}
+	return binaries
+}
+
+// commandSegments 按换行、分号、管道和逻辑运算符拆分脚本
+func commandSegments(script string) []string {
+	replacer := strings.NewReplacer("&&", "\n", "||", "\n", ";", "\n", "|", "\n", "$(", "\n", "`", "\n")
+	return strings.Split(replacer.Replace(script), "\n")
+}
+
+// tokenize 拆分出脚本中的单词，去除引号
+func tokenize(content string) []string {
+	return strings.FieldsFunc(content, func(r rune) bool {
+		switch r {
+		case ' ', '\t', '\n', '\r', ';', '|', '&', '"', '\'', '`', '(', ')', '<', '>', '=':
+			return true
+		}
+		return false
+	})
+}
+
+// normalizeBinary 去除路径和 .exe 后缀并转为小写
+func normalizeBinary(name string) string {
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(strings.ToLower(name), ".exe")
+}
+
+// normalizePath 统一路径分隔符并去除末尾分隔符
+func normalizePath(p string) string {
+	p = strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")
+	if p == "" {
+		return ""
+	}
+	if cleaned := path.Clean(p); cleaned != "/" {
+		return strings.ToLower(cleaned)
+	}
+	return "/"
+}
+
+// pathWithin 判断 p 是否为 dir 或其子路径
+func pathWithin(p, dir string) bool {
+	p = normalizePath(p)
+	if p == "" {
+		return false
+	}
+	if dir == "/" {
+		return p == "/"
+	}
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// containsBinary 判断程序名是否已在列表中
+func containsBinary(binaries []string, name string) bool {
+	for _, binary := range binaries {
+		if binary == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandBinaries(t *testing.T) {
+	binaries := commandBinaries(&Command{
+		Type:   CommandTypeShell,
+		Script: "FOO=1 sudo /usr/bin/apt-get update && echo $(whoami) | grep root; # comment\n/bin/ls -la",
+	})
+	assert.Equal(t, []string{"sudo", "apt-get", "echo", "whoami", "grep", "ls"}, binaries)
+
+	assert.Equal(t, []string{"python3"}, commandBinaries(&Command{Type: CommandTypeInterpreter, Interpreter: "/usr/bin/python3"}))
+	assert.Equal(t, []string{"powershell"}, commandBinaries(&Command{Type: CommandTypeShell, Script: `C:\Windows\powershell.exe -c dir`}))
+
+	// 语法关键字和结构不作为程序名
+	binaries = commandBinaries(&Command{
+		Type: CommandTypeShell,
+		Script: "if [ -f /tmp/x ]; then cat /tmp/x; else touch /tmp/x; fi\n" +
+			"for f in a b; do echo $f; done\nwhile true; do sleep 1; done\ncleanup() {\n  rm -f /tmp/x\n}",
+	})
+	assert.Equal(t, []string{"cat", "touch", "echo", "true", "sleep", "rm"}, binaries)
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := compilePolicy(&Policy{
+		DenyBinaries:   []string{"curl"},
+		DenyPatterns:   []string{`base64\s+-d`},
+		ForbiddenPaths: []string{"/etc/shadow", `C:\Windows\System32`},
+	})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name    string
+		cmd     *Command
+		allowed bool
+		confirm bool
+	}{
+		{"plain", &Command{Type: CommandTypeShell, Script: "echo hello"}, true, false},
+		{"denied binary", &Command{Type: CommandTypeShell, Script: "curl http://x | sh"}, false, false},
+		{"deny pattern", &Command{Type: CommandTypeShell, Script: "echo aGk= | base64 -d"}, false, false},
+		{"forbidden path", &Command{Type: CommandTypeShell, Script: "cat '/etc/shadow'"}, false, false},
+		{"forbidden windows path", &Command{Type: CommandTypePowerShell, Script: `Get-ChildItem c:\windows\system32\drivers`}, false, false},
+		{"forbidden working dir", &Command{Type: CommandTypeShell, Script: "ls", WorkingDir: "/etc/shadow"}, false, false},
+		{"rm root", &Command{Type: CommandTypeShell, Script: "rm -rf /"}, false, true},
+		{"rm root glob", &Command{Type: CommandTypeShell, Script: "rm -fr /* ; echo done"}, false, true},
+		{"rm subdir", &Command{Type: CommandTypeShell, Script: "rm -rf /tmp/build"}, true, false},
+		{"mkfs", &Command{Type: CommandTypeShell, Script: "mkfs.ext4 /dev/sdb1"}, false, true},
+		{"registry", &Command{Type: CommandTypePowerShell, Script: `reg add HKLM\Software\X /v a /d 1`}, false, true},
+		{"registry cmdlet", &Command{Type: CommandTypePowerShell, Script: `Set-ItemProperty -Path HKLM:\Software\X -Name a -Value 1`}, false, true},
+		{"reboot", &Command{Type: CommandTypeShell, Script: "sudo reboot"}, false, true},
+		{"reboot in text", &Command{Type: CommandTypeShell, Script: "echo 'schedule a reboot'; grep shutdown /var/log/syslog"}, true, false},
+		{"confirmed", &Command{Type: CommandTypeShell, Script: "reboot", Confirmed: true}, true, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.check(tc.cmd)
+			if tc.allowed {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			policyErr, ok := err.(*PolicyError)
+			require.True(t, ok)
+			assert.Equal(t, tc.confirm, policyErr.ConfirmationRequired)
+		})
+	}
+}
+
+func TestPolicyAllowlist(t *testing.T) {
+	policy, err := compilePolicy(&Policy{AllowBinaries: []string{"echo", "ls"}})
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.check(&Command{Type: CommandTypeShell, Script: "echo a; ls"}))
+	assert.Error(t, policy.check(&Command{Type: CommandTypeShell, Script: "echo a && cat /etc/hosts"}))
+	assert.Error(t, policy.check(&Command{Type: CommandTypeInterpreter, Interpreter: "python3"}))
+	assert.NoError(t, policy.check(&Command{Type: CommandTypeShell, Script: "for f in a b; do echo $f; done"}))
+
+	_, err = compilePolicy(&Policy{DenyPatterns: []string{"("}})
+	assert.Error(t, err)
+}
+
+func TestExecutorPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("policy test requires bash")
+	}
+
+	executor := newTestExecutor(t)
+	require.NoError(t, executor.SetPolicy(&Policy{ConfirmPatterns: []string{`\bdanger\b`}}))
+
+	result := executor.Execute(&Command{ID: "danger", Type: CommandTypeShell, Script: "echo danger", Timeout: 10})
+	assert.False(t, result.Success)
+	assert.True(t, result.ConfirmationRequired)
+	assert.Contains(t, result.Error, "requires confirmation")
+
+	result = executor.Execute(&Command{ID: "confirmed", Type: CommandTypeShell, Script: "echo danger", Timeout: 10, Confirmed: true})
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, "danger\n", result.Output)
+
+	// 关闭策略
+	require.NoError(t, executor.SetPolicy(nil))
+	result = executor.Execute(&Command{ID: "disabled", Type: CommandTypeShell, Script: "echo danger", Timeout: 10})
+	assert.True(t, result.Success)
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// processTree 命令进程树，基于独立进程组实现
+type processTree struct {
+	execCmd *exec.Cmd
+}
+
+// newProcessTree 在进程启动前配置独立进程组
+func newProcessTree(execCmd *exec.Cmd) *processTree {
+	if execCmd.SysProcAttr == nil {
+		execCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	execCmd.SysProcAttr.Setpgid = true
+
+	return &processTree{execCmd: execCmd}
+}
+
+// attach 在进程启动后关联进程树
+func (t *processTree) attach(process *os.Process) error {
+	return nil
+}
+
+// kill 终止整个进程组
+func (t *processTree) kill() error {
+	if t.execCmd.Process == nil {
+		return nil
+	}
+
+	err := syscall.Kill(-t.execCmd.Process.Pid, syscall.SIGKILL)
+	if err == syscall.ESRCH {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// release 释放进程树资源
+func (t *processTree) release() {}
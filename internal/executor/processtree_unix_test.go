@@ -0,0 +1,69 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutorTimeoutKillsProcessTree(t *testing.T) {
+	executor := newTestExecutor(t)
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+
+	start := time.Now()
+	result := executor.Execute(&Command{
+		ID:      "test-tree",
+		Type:    CommandTypeShell,
+		Script:  "sleep 30 & echo $! > " + pidFile + "; wait",
+		Timeout: 1,
+	})
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.False(t, result.Success)
+	assert.True(t, result.KilledByTimeout)
+
+	data, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	require.NoError(t, err)
+
+	// 子进程应随进程组一起被终止
+	assert.Eventually(t, func() bool {
+		return syscall.Kill(pid, 0) == syscall.ESRCH
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestExecutorStopCommandKillsProcessTree(t *testing.T) {
+	executor := newTestExecutor(t)
+	done := make(chan *Result, 1)
+
+	go func() {
+		done <- executor.Execute(&Command{
+			ID:      "test-stop-tree",
+			Type:    CommandTypeShell,
+			Script:  "sleep 30 & wait",
+			Timeout: 60,
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		return len(executor.ListRunningCommands()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, executor.StopCommand("test-stop-tree"))
+
+	select {
+	case result := <-done:
+		assert.False(t, result.Success)
+		assert.False(t, result.KilledByTimeout)
+	case <-time.After(10 * time.Second):
+		t.Fatal("command was not stopped")
+	}
+}
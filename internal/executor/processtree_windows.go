@@ -0,0 +1,64 @@
+//go:build windows
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/windows"
+)
+
+// processTree 命令进程树，基于 Job Object 实现
+type processTree struct {
+	execCmd *exec.Cmd
+	job     windows.Handle
+}
+
+// newProcessTree 在进程启动前创建 Job Object
+func newProcessTree(execCmd *exec.Cmd) *processTree {
+	t := &processTree{execCmd: execCmd}
+
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return t
+	}
+
+	t.job = job
+	return t
+}
+
+// attach 在进程启动后将进程加入 Job Object，子进程会自动继承
+func (t *processTree) attach(process *os.Process) error {
+	if t.job == 0 {
+		return nil
+	}
+
+	handle, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(process.Pid))
+	if err != nil {
+		return fmt.Errorf("failed to open process: %v", err)
+	}
+	defer windows.CloseHandle(handle)
+
+	return windows.AssignProcessToJobObject(t.job, handle)
+}
+
+// kill 终止整个进程树
+func (t *processTree) kill() error {
+	if t.job != 0 {
+		return windows.TerminateJobObject(t.job, 1)
+	}
+	if t.execCmd.Process == nil {
+		return nil
+	}
+	return t.execCmd.Process.Kill()
+}
+
+// release 关闭 Job Object
+func (t *processTree) release() {
+	if t.job != 0 {
+		windows.CloseHandle(t.job)
+		t.job = 0
+	}
+}
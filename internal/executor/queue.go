@@ -0,0 +1,221 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/logger"
+)
+
+var (
+	// ErrQueueFull 命令队列已满
+	ErrQueueFull = errors.New("command queue is full")
+	// ErrQueueStopped 命令队列已停止
+	ErrQueueStopped = errors.New("command queue is stopped")
+)
+
+const (
+	// CommandStateQueued 排队中
+	CommandStateQueued = "queued"
+	// CommandStateRunning 执行中
+	CommandStateRunning = "running"
+)
+
+// ResultHandler 命令执行结果回调
+type ResultHandler func(result *Result)
+
+// Queue 命令队列，使用固定数量的 worker 并发执行命令
+type Queue struct {
+	executor *Executor
+	workers  int
+	commands chan *Command
+	handler  ResultHandler
+	states   map[string]string
+	running  bool
+	mu       sync.RWMutex
+	wg       sync.WaitGroup
+	stopChan chan struct{}
+}
+
+// NewQueue 创建命令队列
+func NewQueue(executor *Executor, workers, size int, handler ResultHandler) *Queue {
+	if workers <= 0 {
+		workers = 1
+	}
+	if size <= 0 {
+		size = 100
+	}
+
+	return &Queue{
+		executor: executor,
+		workers:  workers,
+		commands: make(chan *Command, size),
+		handler:  handler,
+		states:   make(map[string]string),
+	}
+}
+
+// Start 启动 worker
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.running {
+		return
+	}
+	q.running = true
+	q.stopChan = make(chan struct{})
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker(q.stopChan)
+	}
+
+	logger.Infof("Command queue started with %d workers", q.workers)
+}
+
+// Stop 停止队列，终止执行中的命令并丢弃排队中的命令，
+// 丢弃的命令通过回调报告取消结果，服务器不会一直等待
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	if !q.running {
+		q.mu.Unlock()
+		return
+	}
+	q.running = false
+	close(q.stopChan)
+
+	for id, state := range q.states {
+		if state == CommandStateRunning {
+			if err := q.executor.StopCommand(id); err != nil {
+				logger.Warnf("Failed to stop command %s: %v", id, err)
+			}
+		}
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+
+	// 丢弃排队中的命令
+	var dropped []*Command
+	for len(q.commands) > 0 {
+		dropped = append(dropped, <-q.commands)
+	}
+
+	q.mu.Lock()
+	if len(dropped) > 0 {
+		logger.Warnf("Command queue stopped, %d queued commands dropped", len(dropped))
+	}
+	q.states = make(map[string]string)
+	q.mu.Unlock()
+
+	for _, cmd := range dropped {
+		q.cancel(cmd)
+	}
+
+	logger.Info("Command queue stopped")
+}
+
+// Submit 提交命令，命令将异步执行并通过回调报告结果
+func (q *Queue) Submit(cmd *Command) error {
+	if cmd.ID == "" {
+		return fmt.Errorf("command id is required")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.running {
+		return ErrQueueStopped
+	}
+	if _, exists := q.states[cmd.ID]; exists {
+		return fmt.Errorf("command %s already exists", cmd.ID)
+	}
+
+	select {
+	case q.commands <- cmd:
+		q.states[cmd.ID] = CommandStateQueued
+		logger.Debugf("Command %s queued", cmd.ID)
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// State 获取命令状态
+func (q *Queue) State(id string) (string, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	state, exists := q.states[id]
+	return state, exists
+}
+
+// Len 返回排队中和执行中的命令数量
+func (q *Queue) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.states)
+}
+
+// worker 从队列中取出命令并执行
+func (q *Queue) worker(stopChan chan struct{}) {
+	defer q.wg.Done()
+
+	for {
+		// 优先响应停止信号
+		select {
+		case <-stopChan:
+			return
+		default:
+		}
+
+		select {
+		case <-stopChan:
+			return
+		case cmd := <-q.commands:
+			q.execute(cmd)
+		}
+	}
+}
+
+// execute 执行单个命令并回调结果
+func (q *Queue) execute(cmd *Command) {
+	q.mu.Lock()
+	if !q.running {
+		delete(q.states, cmd.ID)
+		q.mu.Unlock()
+		q.cancel(cmd)
+		return
+	}
+	q.states[cmd.ID] = CommandStateRunning
+	q.mu.Unlock()
+
+	result := q.executor.Execute(cmd)
+
+	q.mu.Lock()
+	delete(q.states, cmd.ID)
+	q.mu.Unlock()
+
+	if q.handler != nil {
+		q.handler(result)
+	}
+}
+
+// cancel 报告未执行就被丢弃的命令
+func (q *Queue) cancel(cmd *Command) {
+	if q.handler == nil {
+		return
+	}
+	now := time.Now()
+	q.handler(&Result{
+		ID:        cmd.ID,
+		Success:   false,
+		ExitCode:  -1,
+		Error:     "command canceled: command queue stopped",
+		StartTime: now,
+		EndTime:   now,
+	})
+}
@@ -0,0 +1,164 @@
+package executor
+
+import (
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecutor(t *testing.T) *Executor {
+	tempDir := t.TempDir()
+	exec, err := New(filepath.Join(tempDir, "work"), filepath.Join(tempDir, "temp"))
+	require.NoError(t, err)
+	return exec
+}
+
+func TestQueueSubmit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("queue test requires bash")
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]*Result)
+	done := make(chan struct{}, 3)
+
+	queue := NewQueue(newTestExecutor(t), 2, 10, func(result *Result) {
+		mu.Lock()
+		results[result.ID] = result
+		mu.Unlock()
+		done <- struct{}{}
+	})
+	queue.Start()
+	defer queue.Stop()
+
+	for _, id := range []string{"cmd-1", "cmd-2", "cmd-3"} {
+		require.NoError(t, queue.Submit(&Command{ID: id, Type: CommandTypeShell, Script: "echo " + id, Timeout: 10}))
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for command results")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, results, 3)
+	assert.True(t, results["cmd-2"].Success)
+	assert.Contains(t, results["cmd-2"].Output, "cmd-2")
+	assert.Equal(t, 0, queue.Len())
+}
+
+func TestQueueTracksState(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("queue test requires bash")
+	}
+
+	exec := newTestExecutor(t)
+	done := make(chan *Result, 2)
+	queue := NewQueue(exec, 1, 10, func(result *Result) {
+		done <- result
+	})
+	queue.Start()
+	defer queue.Stop()
+
+	require.NoError(t, queue.Submit(&Command{ID: "slow", Type: CommandTypeShell, Script: "sleep 0.5", Timeout: 10}))
+	require.NoError(t, queue.Submit(&Command{ID: "next", Type: CommandTypeShell, Script: "true", Timeout: 10}))
+
+	// 重复 ID
+	assert.Error(t, queue.Submit(&Command{ID: "slow", Type: CommandTypeShell, Script: "true"}))
+
+	// 单个 worker 时第二个命令排队等待
+	assert.Eventually(t, func() bool {
+		state, _ := queue.State("slow")
+		return state == CommandStateRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	state, exists := queue.State("next")
+	assert.True(t, exists)
+	assert.Equal(t, CommandStateQueued, state)
+
+	// 执行中的命令登记在执行器中
+	assert.Eventually(t, func() bool {
+		return len(exec.ListRunningCommands()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "slow", (<-done).ID)
+	assert.Equal(t, "next", (<-done).ID)
+}
+
+func TestQueueErrors(t *testing.T) {
+	queue := NewQueue(newTestExecutor(t), 1, 1, nil)
+
+	// 未启动
+	assert.Equal(t, ErrQueueStopped, queue.Submit(&Command{ID: "cmd-1"}))
+
+	// 缺少 ID
+	assert.Error(t, queue.Submit(&Command{}))
+}
+
+func TestQueueFull(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("queue test requires bash")
+	}
+
+	queue := NewQueue(newTestExecutor(t), 1, 1, nil)
+	queue.Start()
+
+	require.NoError(t, queue.Submit(&Command{ID: "running", Type: CommandTypeShell, Script: "sleep 5", Timeout: 10}))
+	assert.Eventually(t, func() bool {
+		state, _ := queue.State("running")
+		return state == CommandStateRunning
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, queue.Submit(&Command{ID: "queued", Type: CommandTypeShell, Script: "true"}))
+	assert.Equal(t, ErrQueueFull, queue.Submit(&Command{ID: "overflow", Type: CommandTypeShell, Script: "true"}))
+
+	// 停止时终止执行中的命令
+	start := time.Now()
+	queue.Stop()
+	assert.Less(t, time.Since(start), 4*time.Second)
+	assert.Equal(t, 0, queue.Len())
+}
+
+func TestQueueStopReportsDropped(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("queue test requires bash")
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]*Result)
+	queue := NewQueue(newTestExecutor(t), 1, 10, func(result *Result) {
+		mu.Lock()
+		results[result.ID] = result
+		mu.Unlock()
+	})
+	queue.Start()
+
+	require.NoError(t, queue.Submit(&Command{ID: "running", Type: CommandTypeShell, Script: "sleep 5", Timeout: 10}))
+	assert.Eventually(t, func() bool {
+		state, _ := queue.State("running")
+		return state == CommandStateRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, queue.Submit(&Command{ID: "queued-1", Type: CommandTypeShell, Script: "true"}))
+	require.NoError(t, queue.Submit(&Command{ID: "queued-2", Type: CommandTypeShell, Script: "true"}))
+
+	// 停止后每个命令都有结果，排队中的命令报告为取消
+	queue.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, results, 3)
+	assert.False(t, results["running"].Success)
+	for _, id := range []string{"queued-1", "queued-2"} {
+		assert.False(t, results[id].Success)
+		assert.Equal(t, -1, results[id].ExitCode)
+		assert.Contains(t, results[id].Error, "canceled")
+	}
+}
@@ -0,0 +1,18 @@
+package executor
+
+import (
+	"fmt"
+	"os/user"
+)
+
+// lookupRunAsUser 校验并查找 RunAs 目标用户
+func lookupRunAsUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, ok := err.(user.UnknownUserError); ok {
+			return nil, fmt.Errorf("run_as user does not exist: %s", name)
+		}
+		return nil, fmt.Errorf("failed to lookup run_as user %s: %v", name, err)
+	}
+	return u, nil
+}
@@ -0,0 +1,56 @@
+package executor
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutorRunAsUnknownUser(t *testing.T) {
+	executor := newTestExecutor(t)
+
+	result := executor.Execute(&Command{
+		ID:      "test-runas-unknown",
+		Type:    CommandTypeShell,
+		Script:  "true",
+		RunAs:   "no-such-user-for-runas",
+		Timeout: 10,
+	})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "run_as user does not exist")
+}
+
+func TestExecutorRunAs(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		t.Skip("run_as test requires root on unix")
+	}
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip("user nobody not available")
+	}
+
+	// 目标用户需要能够访问工作目录和临时目录
+	tempDir := t.TempDir()
+	for dir := tempDir; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if strings.HasPrefix(dir, os.TempDir()) {
+			require.NoError(t, os.Chmod(dir, 0755))
+		}
+	}
+	executor, err := New(filepath.Join(tempDir, "work"), filepath.Join(tempDir, "temp"))
+	require.NoError(t, err)
+
+	result := executor.Execute(&Command{
+		ID:      "test-runas",
+		Type:    CommandTypeShell,
+		Script:  "id -un",
+		RunAs:   "nobody",
+		Timeout: 10,
+	})
+	require.True(t, result.Success, result.Error+result.Output)
+	assert.Equal(t, "nobody\n", result.Output)
+}
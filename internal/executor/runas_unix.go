@@ -0,0 +1,95 @@
+//go:build !windows
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// configureRunAs 配置命令以指定用户身份执行
+// root 运行时通过 setuid/setgid 直接降权，否则通过 sudo 切换用户
+func configureRunAs(execCmd *exec.Cmd, cmd *Command, scriptFile string) (func(), error) {
+	noop := func() {}
+	if cmd.RunAs == "" {
+		return noop, nil
+	}
+
+	u, err := lookupRunAsUser(cmd.RunAs)
+	if err != nil {
+		return nil, err
+	}
+
+	if os.Geteuid() != 0 {
+		return noop, configureSudo(execCmd, cmd, scriptFile)
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid for run_as user %s: %s", cmd.RunAs, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid for run_as user %s: %s", cmd.RunAs, u.Gid)
+	}
+
+	// 附加组
+	var groups []uint32
+	if groupIDs, err := u.GroupIds(); err == nil {
+		for _, id := range groupIDs {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				groups = append(groups, uint32(g))
+			}
+		}
+	}
+
+	if execCmd.SysProcAttr == nil {
+		execCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	execCmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    uint32(uid),
+		Gid:    uint32(gid),
+		Groups: groups,
+	}
+
+	// 目标用户需要能够读取脚本文件
+	if scriptFile != "" {
+		if err := os.Chown(scriptFile, int(uid), int(gid)); err != nil {
+			return nil, fmt.Errorf("failed to chown script for run_as user %s: %v", cmd.RunAs, err)
+		}
+	}
+
+	// 使用目标用户的身份环境变量，命令级变量仍然优先
+	execCmd.Env = append(execCmd.Env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	execCmd.Env = append(execCmd.Env, cmd.Env...)
+
+	return noop, nil
+}
+
+// configureSudo 通过 sudo 以指定用户身份执行命令
+func configureSudo(execCmd *exec.Cmd, cmd *Command, scriptFile string) error {
+	sudo, err := exec.LookPath("sudo")
+	if err != nil {
+		return fmt.Errorf("run_as requires root privileges or sudo")
+	}
+
+	// 目标用户需要能够读取脚本文件
+	if scriptFile != "" {
+		if err := os.Chmod(scriptFile, 0755); err != nil {
+			return err
+		}
+	}
+
+	// sudo 会重置环境变量，通过 env 显式传递命令级变量
+	args := []string{"sudo", "-n", "-u", cmd.RunAs, "--", "env"}
+	args = append(args, cmd.Env...)
+	args = append(args, execCmd.Path)
+	args = append(args, execCmd.Args[1:]...)
+
+	execCmd.Path = sudo
+	execCmd.Args = args
+	return nil
+}
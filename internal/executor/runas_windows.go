@@ -0,0 +1,92 @@
+//go:build windows
+
+package executor
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	logon32LogonInteractive = 2
+	logon32ProviderDefault  = 0
+)
+
+var (
+	modadvapi32    = syscall.NewLazyDLL("advapi32.dll")
+	procLogonUserW = modadvapi32.NewProc("LogonUserW")
+)
+
+// configureRunAs 配置命令以指定用户身份执行
+// 通过 LogonUser 获取目标用户令牌后创建进程
+func configureRunAs(execCmd *exec.Cmd, cmd *Command, scriptFile string) (func(), error) {
+	noop := func() {}
+	if cmd.RunAs == "" {
+		return noop, nil
+	}
+
+	if _, err := lookupRunAsUser(cmd.RunAs); err != nil {
+		return nil, err
+	}
+
+	if cmd.RunAsPass == "" {
+		return nil, fmt.Errorf("run_as_password is required to run as %s on windows", cmd.RunAs)
+	}
+
+	domain, username := splitWindowsUser(cmd.RunAs)
+	token, err := logonUser(username, domain, cmd.RunAsPass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to logon as %s: %v", cmd.RunAs, err)
+	}
+
+	if execCmd.SysProcAttr == nil {
+		execCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	execCmd.SysProcAttr.Token = token
+
+	return func() { token.Close() }, nil
+}
+
+// splitWindowsUser 拆分 DOMAIN\user 或 user@domain 格式的用户名
+func splitWindowsUser(name string) (domain, username string) {
+	if i := strings.Index(name, `\`); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	if i := strings.Index(name, "@"); i >= 0 {
+		return name[i+1:], name[:i]
+	}
+	return ".", name
+}
+
+// logonUser 调用 LogonUserW 获取用户令牌
+func logonUser(username, domain, password string) (syscall.Token, error) {
+	user, err := syscall.UTF16PtrFromString(username)
+	if err != nil {
+		return 0, err
+	}
+	dom, err := syscall.UTF16PtrFromString(domain)
+	if err != nil {
+		return 0, err
+	}
+	pass, err := syscall.UTF16PtrFromString(password)
+	if err != nil {
+		return 0, err
+	}
+
+	var token syscall.Token
+	r, _, e := procLogonUserW.Call(
+		uintptr(unsafe.Pointer(user)),
+		uintptr(unsafe.Pointer(dom)),
+		uintptr(unsafe.Pointer(pass)),
+		logon32LogonInteractive,
+		logon32ProviderDefault,
+		uintptr(unsafe.Pointer(&token)),
+	)
+	if r == 0 {
+		return 0, e
+	}
+	return token, nil
+}
@@ -0,0 +1,40 @@
+package executor
+
+import (
+	"fmt"
+
+	"assistant_agent/internal/scripts"
+)
+
+// SetScripts 设置脚本库，设置后命令可通过 ScriptRef 引用脚本库中的脚本
+func (e *Executor) SetScripts(store *scripts.Store) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scripts = store
+}
+
+// resolveScript 将命令的脚本引用解析为脚本内容，脚本类型和解释器以脚本库中的定义为准
+func (e *Executor) resolveScript(cmd *Command) error {
+	if cmd.ScriptRef == "" {
+		return nil
+	}
+
+	e.mu.RLock()
+	store := e.scripts
+	e.mu.RUnlock()
+	if store == nil {
+		return fmt.Errorf("script library not enabled")
+	}
+
+	script, err := store.Resolve(cmd.ScriptRef)
+	if err != nil {
+		return err
+	}
+
+	cmd.Script = script.Content
+	cmd.Type = CommandType(script.Type)
+	if script.Interpreter != "" {
+		cmd.Interpreter = script.Interpreter
+	}
+	return nil
+}
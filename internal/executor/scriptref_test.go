@@ -0,0 +1,37 @@
+package executor
+
+import (
+	"runtime"
+	"testing"
+
+	"assistant_agent/internal/scripts"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutorScriptRef(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("script library test requires bash")
+	}
+
+	executor := newTestExecutor(t)
+
+	// 未设置脚本库
+	result := executor.Execute(&Command{ID: "no-store", ScriptRef: "hello@1"})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "script library not enabled")
+
+	store, err := scripts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, store.Save(&scripts.Script{Name: "hello", Version: "1", Content: "echo hello"}))
+	executor.SetScripts(store)
+
+	result = executor.Execute(&Command{ID: "ref", ScriptRef: "hello@1", Timeout: 10})
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, "hello\n", result.Output)
+
+	result = executor.Execute(&Command{ID: "missing", ScriptRef: "hello@2"})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "script not found")
+}
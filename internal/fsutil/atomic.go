@@ -0,0 +1,80 @@
+// Package fsutil 提供文件写入的公共辅助函数
+package fsutil
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// FileSystem 原子写入用到的文件操作，plugin.FileSystem 同样满足该接口，
+// 插件通过受限的 Agent 文件接口写入时也能使用
+type FileSystem interface {
+	OpenFile(path string, flag int, perm os.FileMode) (*os.File, error)
+	Rename(oldPath, newPath string) error
+	Remove(path string) error
+}
+
+type osFS struct{}
+
+func (osFS) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag, perm)
+}
+
+func (osFS) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (osFS) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// OS 直接访问本地文件系统的 FileSystem
+var OS FileSystem = osFS{}
+
+// WriteFileAtomic 原子地写入文件内容，见 WriteAtomic
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return WriteAtomic(OS, path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteAtomic 先将 write 的输出写入同目录下的 path.tmp 并落盘，再重命名为 path，
+// 写到一半崩溃时原文件保持完整；失败时删除临时文件
+func WriteAtomic(fs FileSystem, path string, perm os.FileMode, write func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	file, err := fs.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		file.Close()
+		fs.Remove(tmp)
+		return err
+	}
+
+	// 临时文件可能是上次失败时留下的，权限以本次为准
+	if err := file.Chmod(perm); err != nil {
+		return fail(err)
+	}
+	writer := bufio.NewWriter(file)
+	if err := write(writer); err != nil {
+		return fail(err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := file.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := file.Close(); err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+	if err := fs.Rename(tmp, path); err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/grpc/pb"
+	"assistant_agent/internal/logger"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Client gRPC 客户端
+type Client struct {
+	address   string
+	token     string
+	conn      *grpclib.ClientConn
+	stream    pb.AgentControl_ConnectClient
+	cancel    context.CancelFunc
+	connected bool
+	mu        sync.RWMutex
+	sendMu    sync.Mutex
+
+	tlsConfig *tls.Config
+	plaintext bool // 不使用 TLS，只用于本机或受信任的网络，此时不发送令牌
+}
+
+// NewClient 创建新的 gRPC 客户端
+func NewClient(address, token string) (*Client, error) {
+	if address == "" {
+		return nil, fmt.Errorf("grpc address is required")
+	}
+
+	return &Client{
+		address: address,
+		token:   token,
+	}, nil
+}
+
+// SetTLSConfig 设置 TLS 配置（证书校验、客户端证书、CA），需在 Connect 之前调用
+func (c *Client) SetTLSConfig(tlsConfig *tls.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tlsConfig = tlsConfig
+}
+
+// SetPlaintext 设置是否不使用 TLS 连接，需在 Connect 之前调用。
+// 明文连接中令牌可被窃听，因此不发送令牌
+func (c *Client) SetPlaintext(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.plaintext = enabled
+}
+
+// Connect 连接到服务器并建立控制流
+func (c *Client) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connected {
+		return nil
+	}
+
+	creds := insecure.NewCredentials()
+	if !c.plaintext {
+		tlsConfig := c.tlsConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpclib.Dial(c.address, grpclib.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	switch {
+	case c.token == "":
+	case c.plaintext:
+		logger.Warn("gRPC plaintext connection, authentication token is not sent")
+	default:
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+	}
+
+	stream, err := pb.NewAgentControlClient(conn).Connect(ctx)
+	if err != nil {
+		cancel()
+		conn.Close()
+		return fmt.Errorf("failed to open control stream: %v", err)
+	}
+
+	c.conn = conn
+	c.stream = stream
+	c.cancel = cancel
+	c.connected = true
+
+	logger.Info("Connected to server via gRPC")
+	return nil
+}
+
+// Disconnect 断开连接
+func (c *Client) Disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.stream = nil
+	c.connected = false
+
+	logger.Info("Disconnected from server")
+}
+
+// Stop 停止客户端
+func (c *Client) Stop() {
+	c.Disconnect()
+}
+
+// Reconnect 主动断开当前连接，Receive 返回错误后由调用方重新连接
+func (c *Client) Reconnect(cause error) {
+	logger.Warnf("Dropping server connection: %v", cause)
+	c.Disconnect()
+}
+
+// IsConnected 检查是否已连接
+func (c *Client) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connected && c.stream != nil
+}
+
+// GetAddress 获取服务器地址
+func (c *Client) GetAddress() string {
+	return c.address
+}
+
+// Send 发送消息
+func (c *Client) Send(msgType string, data interface{}) error {
+	c.mu.RLock()
+	stream := c.stream
+	connected := c.connected
+	c.mu.RUnlock()
+
+	if !connected || stream == nil {
+		return fmt.Errorf("not connected to server")
+	}
+
+	value, err := toValue(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %v", err)
+	}
+
+	msg := &pb.AgentMessage{
+		Type:      msgType,
+		Data:      value,
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	// gRPC 流不允许并发发送
+	c.sendMu.Lock()
+	err = stream.Send(msg)
+	c.sendMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		c.connected = false
+		c.mu.Unlock()
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+
+	logger.Debugf("Sent message: %s", msgType)
+	return nil
+}
+
+// SendHeartbeat 发送心跳
+func (c *Client) SendHeartbeat(status interface{}) error {
+	return c.Send("heartbeat", status)
+}
+
+// SendCommandResult 发送命令执行结果
+func (c *Client) SendCommandResult(result interface{}) error {
+	return c.Send("command_result", result)
+}
+
+// Receive 接收消息，返回与 WebSocket 协议一致的消息类型和数据
+func (c *Client) Receive() (string, interface{}, error) {
+	c.mu.RLock()
+	stream := c.stream
+	connected := c.connected
+	c.mu.RUnlock()
+
+	if !connected || stream == nil {
+		return "", nil, fmt.Errorf("not connected")
+	}
+
+	msg, err := stream.Recv()
+	if err != nil {
+		c.mu.Lock()
+		c.connected = false
+		c.mu.Unlock()
+		return "", nil, err
+	}
+
+	msgType, data := FromServerMessage(msg)
+	logger.Debugf("Received message: %s", msgType)
+	return msgType, data, nil
+}
+
+// FromServerMessage 将服务器消息转换为消息类型和数据。数据中没有 id 时使用消息的 id，
+// 以便结果消息与请求对应
+func FromServerMessage(msg *pb.ServerMessage) (string, interface{}) {
+	msgType, data := fromPayload(msg)
+	if dataMap, ok := data.(map[string]interface{}); ok && msg.Id != "" {
+		if id, _ := dataMap["id"].(string); id == "" {
+			dataMap["id"] = msg.Id
+		}
+	}
+	return msgType, data
+}
+
+// fromPayload 将服务器消息的内容转换为与 WebSocket 协议一致的消息类型和数据
+func fromPayload(msg *pb.ServerMessage) (string, interface{}) {
+	switch payload := msg.Payload.(type) {
+	case *pb.ServerMessage_Command:
+		return "command", fromCommandRequest(payload.Command)
+	case *pb.ServerMessage_Schedule:
+		data := payload.Schedule.Args.AsMap()
+		if payload.Schedule.Command != "" {
+			data["command"] = payload.Schedule.Command
+		}
+		return "schedule", data
+	case *pb.ServerMessage_FileTransfer:
+		data := map[string]interface{}{
+			"source":      payload.FileTransfer.Source,
+			"destination": payload.FileTransfer.Destination,
+		}
+		if len(payload.FileTransfer.Options) > 0 {
+			options := make(map[string]interface{}, len(payload.FileTransfer.Options))
+			for key, value := range payload.FileTransfer.Options {
+				options[key] = value
+			}
+			data["options"] = options
+		}
+		return "file_transfer", data
+	case *pb.ServerMessage_Plugin:
+		return "plugin", map[string]interface{}{
+			"plugin":  payload.Plugin.Plugin,
+			"command": payload.Plugin.Command,
+			"args":    payload.Plugin.Args.AsMap(),
+		}
+	case *pb.ServerMessage_Generic:
+		return payload.Generic.Type, payload.Generic.Data.AsInterface()
+	default:
+		return "", nil
+	}
+}
+
+// fromCommandRequest 将命令请求转换为 command 消息的数据，只设置非零值的字段
+func fromCommandRequest(command *pb.CommandRequest) map[string]interface{} {
+	data := map[string]interface{}{
+		"command": command.Command,
+		"args":    toInterfaces(command.Args),
+	}
+	optional := map[string]string{
+		"id":              command.Id,
+		"type":            command.Type,
+		"script_name":     command.ScriptName,
+		"interpreter":     command.Interpreter,
+		"run_as":          command.RunAs,
+		"run_as_password": command.RunAsPassword,
+	}
+	for key, value := range optional {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	if command.Timeout > 0 {
+		data["timeout"] = float64(command.Timeout)
+	}
+	if len(command.Env) > 0 {
+		data["env"] = toInterfaces(command.Env)
+	}
+	if command.Confirmed {
+		data["confirmed"] = true
+	}
+	if command.MaxOutputSize > 0 {
+		data["max_output_size"] = float64(command.MaxOutputSize)
+	}
+	if limits := command.Limits; limits != nil {
+		if limits.MaxMemoryMb > 0 {
+			data["max_memory_mb"] = float64(limits.MaxMemoryMb)
+		}
+		if limits.CpuQuota > 0 {
+			data["cpu_quota"] = limits.CpuQuota
+		}
+		if limits.Niceness != 0 {
+			data["niceness"] = float64(limits.Niceness)
+		}
+	}
+	return data
+}
+
+// toInterfaces 将字符串列表转换为与 JSON 解码结果一致的 []interface{}
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+// toValue 将任意数据转换为 protobuf Value
+func toValue(data interface{}) (*structpb.Value, error) {
+	// 通过 JSON 归一化结构体等任意类型
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized interface{}
+	if err := json.Unmarshal(raw, &normalized); err != nil {
+		return nil, err
+	}
+
+	return structpb.NewValue(normalized)
+}
@@ -0,0 +1,273 @@
+package grpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/grpc/pb"
+	"assistant_agent/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func init() {
+	// 初始化配置和日志
+	config.Init()
+	logger.Init()
+}
+
+// testServer 测试用控制服务
+type testServer struct {
+	pb.UnimplementedAgentControlServer
+	outgoing chan *pb.ServerMessage
+	incoming chan *pb.AgentMessage
+	tokens   chan []string
+}
+
+func (s *testServer) Connect(stream pb.AgentControl_ConnectServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.tokens <- md.Get("authorization")
+
+	go func() {
+		for msg := range s.outgoing {
+			if err := stream.Send(msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		s.incoming <- msg
+	}
+}
+
+// newTestCert 生成 127.0.0.1 的自签名服务端证书，返回证书和信任它的证书池
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// startTestServer 启动测试控制服务，cert 为 nil 时使用明文
+func startTestServer(t *testing.T, cert *tls.Certificate) (*testServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &testServer{
+		outgoing: make(chan *pb.ServerMessage, 10),
+		incoming: make(chan *pb.AgentMessage, 10),
+		tokens:   make(chan []string, 1),
+	}
+
+	var opts []grpclib.ServerOption
+	if cert != nil {
+		opts = append(opts, grpclib.Creds(credentials.NewServerTLSFromCert(cert)))
+	}
+	server := grpclib.NewServer(opts...)
+	pb.RegisterAgentControlServer(server, srv)
+	go server.Serve(listener)
+	t.Cleanup(func() {
+		close(srv.outgoing)
+		server.Stop()
+	})
+
+	return srv, listener.Addr().String()
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient("localhost:9090", "test-token")
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:9090", client.GetAddress())
+	assert.False(t, client.IsConnected())
+
+	_, err = NewClient("", "")
+	assert.Error(t, err)
+}
+
+func TestClientSendNotConnected(t *testing.T) {
+	client, err := NewClient("localhost:9090", "")
+	require.NoError(t, err)
+
+	assert.Error(t, client.Send("test", "data"))
+	_, _, err = client.Receive()
+	assert.Error(t, err)
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	cert, pool := newTestCert(t)
+	srv, addr := startTestServer(t, &cert)
+
+	client, err := NewClient(addr, "test-token")
+	require.NoError(t, err)
+	client.SetTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})
+	require.NoError(t, client.Connect())
+	defer client.Disconnect()
+	assert.True(t, client.IsConnected())
+
+	// 发送消息
+	require.NoError(t, client.Send("command_result", map[string]interface{}{"exit_code": 0}))
+
+	select {
+	case msg := <-srv.incoming:
+		assert.Equal(t, "command_result", msg.Type)
+		assert.Equal(t, float64(0), msg.Data.GetStructValue().AsMap()["exit_code"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for agent message")
+	}
+	assert.Equal(t, []string{"Bearer test-token"}, <-srv.tokens)
+
+	// 接收消息
+	srv.outgoing <- &pb.ServerMessage{
+		Payload: &pb.ServerMessage_Command{Command: &pb.CommandRequest{Command: "echo", Args: []string{"hello"}}},
+	}
+
+	msgType, data, err := client.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, "command", msgType)
+	assert.Equal(t, "echo", data.(map[string]interface{})["command"])
+	assert.Equal(t, []interface{}{"hello"}, data.(map[string]interface{})["args"])
+}
+
+func TestClientTLSRequired(t *testing.T) {
+	// 默认使用 TLS，明文服务端无法完成握手
+	srv, addr := startTestServer(t, nil)
+
+	client, err := NewClient(addr, "test-token")
+	require.NoError(t, err)
+	assert.Error(t, client.Connect())
+	assert.Empty(t, srv.tokens)
+}
+
+func TestClientPlaintextOmitsToken(t *testing.T) {
+	srv, addr := startTestServer(t, nil)
+
+	client, err := NewClient(addr, "test-token")
+	require.NoError(t, err)
+	client.SetPlaintext(true)
+	require.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	require.NoError(t, client.Send("heartbeat", nil))
+	select {
+	case <-srv.incoming:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for agent message")
+	}
+	// 明文连接不发送令牌
+	assert.Empty(t, <-srv.tokens)
+}
+
+func TestFromServerMessage(t *testing.T) {
+	args, err := structpb.NewStruct(map[string]interface{}{"name": "backup"})
+	require.NoError(t, err)
+
+	msgType, data := FromServerMessage(&pb.ServerMessage{
+		Payload: &pb.ServerMessage_Schedule{Schedule: &pb.ScheduleRequest{Command: "add_task", Args: args}},
+	})
+	assert.Equal(t, "schedule", msgType)
+	assert.Equal(t, map[string]interface{}{"command": "add_task", "name": "backup"}, data)
+
+	msgType, data = FromServerMessage(&pb.ServerMessage{
+		Payload: &pb.ServerMessage_FileTransfer{FileTransfer: &pb.FileTransferRequest{Source: "/a", Destination: "/b"}},
+	})
+	assert.Equal(t, "file_transfer", msgType)
+	assert.Equal(t, map[string]interface{}{"source": "/a", "destination": "/b"}, data)
+
+	msgType, data = FromServerMessage(&pb.ServerMessage{
+		Payload: &pb.ServerMessage_Plugin{Plugin: &pb.PluginRequest{Plugin: "updater", Command: "check_update"}},
+	})
+	assert.Equal(t, "plugin", msgType)
+	assert.Equal(t, "updater", data.(map[string]interface{})["plugin"])
+
+	msgType, data = FromServerMessage(&pb.ServerMessage{
+		Payload: &pb.ServerMessage_Generic{Generic: &pb.GenericMessage{Type: "update", Data: structpb.NewStringValue("v2")}},
+	})
+	assert.Equal(t, "update", msgType)
+	assert.Equal(t, "v2", data)
+
+	// 所有消息都带上 ServerMessage.id，数据中已有的 id 优先
+	_, data = FromServerMessage(&pb.ServerMessage{
+		Id:      "msg-1",
+		Payload: &pb.ServerMessage_Plugin{Plugin: &pb.PluginRequest{Plugin: "updater", Command: "check_update"}},
+	})
+	assert.Equal(t, "msg-1", data.(map[string]interface{})["id"])
+
+	generic, err := structpb.NewValue(map[string]interface{}{"id": "upd-1", "command": "check_update"})
+	require.NoError(t, err)
+	_, data = FromServerMessage(&pb.ServerMessage{
+		Id:      "msg-2",
+		Payload: &pb.ServerMessage_Generic{Generic: &pb.GenericMessage{Type: "update", Data: generic}},
+	})
+	assert.Equal(t, "upd-1", data.(map[string]interface{})["id"])
+
+	// 命令请求支持与 WebSocket command 消息相同的字段
+	msgType, data = FromServerMessage(&pb.ServerMessage{
+		Id: "msg-3",
+		Payload: &pb.ServerMessage_Command{Command: &pb.CommandRequest{
+			ScriptName:    "cleanup@1.0",
+			Args:          []string{"-v"},
+			Timeout:       60,
+			RunAs:         "deploy",
+			Env:           []string{"A=1"},
+			Confirmed:     true,
+			MaxOutputSize: 1024,
+			Limits:        &pb.CommandLimits{MaxMemoryMb: 256, CpuQuota: 0.5, Niceness: 10},
+		}},
+	})
+	assert.Equal(t, "command", msgType)
+	assert.Equal(t, map[string]interface{}{
+		"id":              "msg-3",
+		"command":         "",
+		"script_name":     "cleanup@1.0",
+		"args":            []interface{}{"-v"},
+		"timeout":         float64(60),
+		"run_as":          "deploy",
+		"env":             []interface{}{"A=1"},
+		"confirmed":       true,
+		"max_output_size": float64(1024),
+		"max_memory_mb":   float64(256),
+		"cpu_quota":       0.5,
+		"niceness":        float64(10),
+	}, data)
+
+	_, data = FromServerMessage(&pb.ServerMessage{
+		Id:      "msg-4",
+		Payload: &pb.ServerMessage_Command{Command: &pb.CommandRequest{Id: "cmd-1", Command: "uptime"}},
+	})
+	assert.Equal(t, "cmd-1", data.(map[string]interface{})["id"])
+}
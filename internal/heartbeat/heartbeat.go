@@ -1,16 +1,46 @@
 package heartbeat
 
 import (
+	"sync"
 	"time"
 
 	"assistant_agent/internal/logger"
 )
 
+// rttSmoothing 平均往返时间的平滑系数，与 TCP 的 SRTT 相同
+const rttSmoothing = 0.125
+
 // Heartbeat 心跳检测器
 type Heartbeat struct {
 	interval int
 	lastBeat time.Time
 	healthy  bool
+	failures int // 连续失败次数：发送失败或未收到服务器响应
+	mu       sync.Mutex
+
+	// 自适应间隔：有活动时使用 minInterval，空闲时从 interval 开始每次心跳翻倍，直到 maxInterval
+	adaptive    bool
+	minInterval int
+	maxInterval int
+	current     int // 当前使用的间隔，尚未计算时为 0
+
+	totalMisses int
+	rtt         time.Duration // 最近一次往返时间
+	avgRTT      time.Duration
+	minRTT      time.Duration
+	maxRTT      time.Duration
+	lastPong    time.Time
+}
+
+// Stats 心跳统计
+type Stats struct {
+	LastRTT     time.Duration `json:"last_rtt"`
+	AvgRTT      time.Duration `json:"avg_rtt"`
+	MinRTT      time.Duration `json:"min_rtt"`
+	MaxRTT      time.Duration `json:"max_rtt"`
+	LastPong    time.Time     `json:"last_pong"`
+	Misses      int           `json:"misses"`       // 连续失败次数
+	TotalMisses int           `json:"total_misses"` // 累计失败次数
 }
 
 // New 创建新的心跳检测器
@@ -24,20 +54,81 @@ func New(interval int) (*Heartbeat, error) {
 
 // Beat 发送心跳
 func (h *Heartbeat) Beat() {
+	h.mu.Lock()
 	h.lastBeat = time.Now()
 	h.healthy = true
+	h.failures = 0
+	h.mu.Unlock()
 	logger.Debug("Heartbeat sent")
 }
 
+// Fail 记录一次心跳发送失败或服务器未响应，返回连续失败次数
+func (h *Heartbeat) Fail() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures++
+	h.totalMisses++
+	return h.failures
+}
+
+// RecordRTT 记录收到服务器响应的往返时间
+func (h *Heartbeat) RecordRTT(rtt time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.lastPong.IsZero() {
+		h.avgRTT, h.minRTT, h.maxRTT = rtt, rtt, rtt
+	} else {
+		h.avgRTT += time.Duration(rttSmoothing * float64(rtt-h.avgRTT))
+		if rtt < h.minRTT {
+			h.minRTT = rtt
+		}
+		if rtt > h.maxRTT {
+			h.maxRTT = rtt
+		}
+	}
+	h.rtt = rtt
+	h.lastPong = time.Now()
+}
+
+// Stats 获取往返时间和失败次数统计
+func (h *Heartbeat) Stats() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return Stats{
+		LastRTT:     h.rtt,
+		AvgRTT:      h.avgRTT,
+		MinRTT:      h.minRTT,
+		MaxRTT:      h.maxRTT,
+		LastPong:    h.lastPong,
+		Misses:      h.failures,
+		TotalMisses: h.totalMisses,
+	}
+}
+
+// Failures 获取连续发送失败次数
+func (h *Heartbeat) Failures() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failures
+}
+
 // IsHealthy 检查是否健康
 func (h *Heartbeat) IsHealthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	// 如果间隔为负数或零，则总是健康的
 	if h.interval <= 0 {
 		return true
 	}
 	
-	// 如果超过心跳间隔的2倍时间没有心跳，则认为不健康
-	if time.Since(h.lastBeat) > time.Duration(h.interval*2)*time.Second {
+	// 如果超过心跳间隔的2倍时间没有心跳，则认为不健康，自适应模式下按当前间隔计算
+	interval := h.interval
+	if h.adaptive && h.current > interval {
+		interval = h.current
+	}
+	if time.Since(h.lastBeat) > time.Duration(interval*2)*time.Second {
 		h.healthy = false
 	}
 	return h.healthy
@@ -45,17 +136,89 @@ func (h *Heartbeat) IsHealthy() bool {
 
 // GetLastBeat 获取最后心跳时间
 func (h *Heartbeat) GetLastBeat() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	return h.lastBeat
 }
 
 // GetInterval 获取心跳间隔
 func (h *Heartbeat) GetInterval() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	return h.interval
 }
 
+// SetInterval 修改心跳间隔，用于配置热加载
+func (h *Heartbeat) SetInterval(interval int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.interval = interval
+}
+
+// SetAdaptive 开启或关闭自适应间隔，minInterval 和 maxInterval 为间隔的上下限（秒）
+func (h *Heartbeat) SetAdaptive(enabled bool, minInterval, maxInterval int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.adaptive = enabled
+	h.minInterval = minInterval
+	h.maxInterval = maxInterval
+	h.current = 0
+}
+
+// NextInterval 心跳发送后计算下一次心跳的间隔（秒）。未开启自适应时为配置的间隔；
+// 开启后有活动时为最小间隔，空闲时先恢复为配置的间隔，之后每次翻倍直到最大间隔
+func (h *Heartbeat) NextInterval(active bool) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.adjust(active, true)
+}
+
+// Adjust 活动开始或配置变化时重新计算当前间隔，空闲时不延长
+func (h *Heartbeat) Adjust(active bool) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.adjust(active, false)
+}
+
+// EffectiveInterval 获取当前使用的心跳间隔
+func (h *Heartbeat) EffectiveInterval() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.adaptive || h.current <= 0 {
+		return h.interval
+	}
+	return h.current
+}
+
+func (h *Heartbeat) adjust(active, grow bool) int {
+	if !h.adaptive {
+		return h.interval
+	}
+	switch {
+	case active:
+		h.current = h.minInterval
+	case h.current < h.interval:
+		h.current = h.interval
+	case grow:
+		h.current *= 2
+	}
+	if h.current > h.maxInterval {
+		h.current = h.maxInterval
+	}
+	if h.current < h.minInterval {
+		h.current = h.minInterval
+	}
+	if h.current <= 0 {
+		h.current = h.interval
+	}
+	return h.current
+}
+
 // Stop 停止心跳
 func (h *Heartbeat) Stop() {
+	h.mu.Lock()
 	h.healthy = false
+	h.mu.Unlock()
 	logger.Debug("Heartbeat stopped")
 }
 
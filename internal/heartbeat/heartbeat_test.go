@@ -276,4 +276,73 @@ func TestHeartbeatEdgeCase(t *testing.T) {
 
 	// 现在应该是不健康的
 	assert.False(t, heartbeat.IsHealthy())
-} 
\ No newline at end of file
+} 
+func TestHeartbeatFailures(t *testing.T) {
+	heartbeat, err := New(30)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, heartbeat.Fail())
+	assert.Equal(t, 2, heartbeat.Fail())
+	assert.Equal(t, 2, heartbeat.Failures())
+
+	// 发送成功后清零
+	heartbeat.Beat()
+	assert.Equal(t, 0, heartbeat.Failures())
+}
+
+func TestHeartbeatStats(t *testing.T) {
+	heartbeat, err := New(30)
+	require.NoError(t, err)
+	assert.Zero(t, heartbeat.Stats().LastPong)
+
+	heartbeat.RecordRTT(100 * time.Millisecond)
+	heartbeat.RecordRTT(200 * time.Millisecond)
+	stats := heartbeat.Stats()
+	assert.Equal(t, 200*time.Millisecond, stats.LastRTT)
+	assert.Equal(t, 100*time.Millisecond, stats.MinRTT)
+	assert.Equal(t, 200*time.Millisecond, stats.MaxRTT)
+	// 平均值平滑变化：100ms + (200ms-100ms)/8
+	assert.Equal(t, 112500*time.Microsecond, stats.AvgRTT)
+	assert.WithinDuration(t, time.Now(), stats.LastPong, time.Second)
+
+	// 连续失败次数在成功后清零，累计次数保留
+	heartbeat.Fail()
+	heartbeat.Fail()
+	assert.Equal(t, 2, heartbeat.Stats().Misses)
+	heartbeat.Beat()
+	stats = heartbeat.Stats()
+	assert.Equal(t, 0, stats.Misses)
+	assert.Equal(t, 2, stats.TotalMisses)
+}
+
+func TestHeartbeatAdaptive(t *testing.T) {
+	heartbeat, err := New(30)
+	require.NoError(t, err)
+
+	// 未开启时始终使用配置的间隔
+	assert.Equal(t, 30, heartbeat.NextInterval(true))
+	assert.Equal(t, 30, heartbeat.EffectiveInterval())
+
+	// 空闲时从配置的间隔开始翻倍直到最大间隔
+	heartbeat.SetAdaptive(true, 10, 100)
+	assert.Equal(t, 30, heartbeat.NextInterval(false))
+	assert.Equal(t, 60, heartbeat.NextInterval(false))
+	assert.Equal(t, 100, heartbeat.NextInterval(false))
+	assert.Equal(t, 100, heartbeat.NextInterval(false))
+	assert.Equal(t, 100, heartbeat.Adjust(false))
+
+	// 按当前间隔判断健康状态
+	heartbeat.mu.Lock()
+	heartbeat.lastBeat = time.Now().Add(-150 * time.Second)
+	heartbeat.mu.Unlock()
+	assert.True(t, heartbeat.IsHealthy())
+
+	// 有活动时立即使用最小间隔，活动结束后恢复为配置的间隔
+	assert.Equal(t, 10, heartbeat.Adjust(true))
+	assert.Equal(t, 10, heartbeat.EffectiveInterval())
+	assert.Equal(t, 10, heartbeat.NextInterval(true))
+	assert.Equal(t, 30, heartbeat.NextInterval(false))
+
+	heartbeat.SetAdaptive(false, 10, 100)
+	assert.Equal(t, 30, heartbeat.NextInterval(true))
+}
@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	levelMu sync.RWMutex
+	// baseLevel 全局日志级别，没有单独设置级别的组件和包级函数使用
+	baseLevel = logrus.InfoLevel
+	// componentLevels 单独设置了级别的组件
+	componentLevels = map[string]logrus.Level{}
+)
+
+// Logger 组件日志，日志带 component 字段，级别可以通过 logging.components 单独设置
+type Logger struct {
+	component string
+}
+
+// Component 返回组件日志，如 Component("websocket")。组件名不能包含 "."
+func Component(name string) *Logger {
+	return &Logger{component: name}
+}
+
+func (l *Logger) Debug(args ...interface{}) {
+	l.log(logrus.DebugLevel, args...)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(logrus.DebugLevel, format, args...)
+}
+
+func (l *Logger) Info(args ...interface{}) {
+	l.log(logrus.InfoLevel, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(logrus.InfoLevel, format, args...)
+}
+
+func (l *Logger) Warn(args ...interface{}) {
+	l.log(logrus.WarnLevel, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(logrus.WarnLevel, format, args...)
+}
+
+func (l *Logger) Error(args ...interface{}) {
+	l.log(logrus.ErrorLevel, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(logrus.ErrorLevel, format, args...)
+}
+
+func (l *Logger) log(level logrus.Level, args ...interface{}) {
+	if enabled(l.component, level) {
+		log.WithField("component", l.component).Log(level, args...)
+	}
+}
+
+func (l *Logger) logf(level logrus.Level, format string, args ...interface{}) {
+	if enabled(l.component, level) {
+		log.WithField("component", l.component).Logf(level, format, args...)
+	}
+}
+
+// SetComponentLevel 设置组件的日志级别，level 为空时恢复为全局级别
+func SetComponentLevel(component, level string) error {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+
+	if level == "" {
+		delete(componentLevels, component)
+	} else {
+		parsed, err := logrus.ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("invalid level %q for component %s", level, component)
+		}
+		componentLevels[component] = parsed
+	}
+	applyLevelLocked()
+	return nil
+}
+
+// SetComponentLevels 整体替换组件级别，用于加载和热加载配置，有无效的级别时不做修改
+func SetComponentLevels(levels map[string]string) error {
+	parsed := make(map[string]logrus.Level, len(levels))
+	for component, level := range levels {
+		value, err := logrus.ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("invalid level %q for component %s", level, component)
+		}
+		parsed[component] = value
+	}
+
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	componentLevels = parsed
+	applyLevelLocked()
+	return nil
+}
+
+// ComponentLevels 返回单独设置了级别的组件
+func ComponentLevels() map[string]string {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+	result := make(map[string]string, len(componentLevels))
+	for component, level := range componentLevels {
+		result[component] = level.String()
+	}
+	return result
+}
+
+// enabled 判断组件（为空时为全局）是否输出该级别的日志
+func enabled(component string, level logrus.Level) bool {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+	if componentLevel, ok := componentLevels[component]; ok && component != "" {
+		return level <= componentLevel
+	}
+	return level <= baseLevel
+}
+
+// setBaseLevel 设置全局日志级别
+func setBaseLevel(level logrus.Level) {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	baseLevel = level
+	applyLevelLocked()
+}
+
+// applyLevelLocked logrus 的级别取全局和各组件中最详细的一个，由 enabled 按组件过滤
+func applyLevelLocked() {
+	if log == nil {
+		return
+	}
+	level := baseLevel
+	for _, componentLevel := range componentLevels {
+		if componentLevel > level {
+			level = componentLevel
+		}
+	}
+	log.SetLevel(level)
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package logger
+
+import "fmt"
+
+// openEventLog Windows 事件日志只在 Windows 上可用
+func openEventLog(source string) (sink, error) {
+	return nil, fmt.Errorf("windows event log is not supported on this platform")
+}
@@ -0,0 +1,49 @@
+//go:build windows
+
+package logger
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// 事件 ID，EventCreate 格式的事件源支持 1-1000
+const (
+	eventIDError   = 1
+	eventIDWarning = 2
+	eventIDInfo    = 3
+)
+
+// eventLogSink 写入 Windows 应用程序事件日志
+type eventLogSink struct {
+	log *eventlog.Log
+}
+
+// openEventLog 打开事件源，未注册时注册为 EventCreate 格式（需要管理员权限，安装服务时完成），
+// 已注册时忽略注册错误
+func openEventLog(source string) (sink, error) {
+	eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log source %s: %v", source, err)
+	}
+	return &eventLogSink{log: l}, nil
+}
+
+func (s *eventLogSink) write(entry *logrus.Entry) error {
+	msg := formatMessage(entry)
+	switch {
+	case entry.Level <= logrus.ErrorLevel:
+		return s.log.Error(eventIDError, msg)
+	case entry.Level == logrus.WarnLevel:
+		return s.log.Warning(eventIDWarning, msg)
+	default:
+		return s.log.Info(eventIDInfo, msg)
+	}
+}
+
+func (s *eventLogSink) Close() error {
+	return s.log.Close()
+}
@@ -1,26 +1,47 @@
 package logger
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"assistant_agent/internal/config"
 
 	"github.com/sirupsen/logrus"
 )
 
-var log *logrus.Logger
+var (
+	log *logrus.Logger
+
+	// output 日志文件，输出到标准输出时为 nil
+	output *rotatingFile
+
+	// sinks syslog、事件日志等其他输出目标
+	sinks []sink
+)
 
 // Init 初始化日志
 func Init() error {
 	log = logrus.New()
 
+	// 脱敏最先执行，之后的 Hook 和格式化只看到替换后的内容
+	if cfg := config.GetConfig().Logging.Redact; cfg.Enabled {
+		r, err := newRedactor(cfg.Fields, cfg.Patterns)
+		if err != nil {
+			// 自定义规则无效时仍使用字段名和内置规则
+			r, _ = newRedactor(cfg.Fields, nil)
+			defer log.Warnf("Ignoring logging.redact.patterns: %v", err)
+		}
+		log.AddHook(r)
+	}
+
 	// 设置日志级别
 	level, err := logrus.ParseLevel(config.GetConfig().Logging.Level)
 	if err != nil {
 		level = logrus.InfoLevel
 	}
-	log.SetLevel(level)
+	setBaseLevel(level)
 
 	// 设置日志格式
 	if config.GetConfig().Logging.Format == "json" {
@@ -31,59 +52,143 @@ func Init() error {
 		})
 	}
 
-	// 设置日志文件
-	if config.GetConfig().Logging.File != "" {
-		logFile := filepath.Join(config.GetConfig().Agent.LogDir, config.GetConfig().Logging.File)
-		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	// 设置日志文件，重复初始化时关闭之前的文件
+	if output != nil {
+		output.Close()
+		output = nil
+	}
+	if cfg := config.GetConfig().Logging; cfg.File != "" {
+		logFile := filepath.Join(config.GetConfig().Agent.LogDir, cfg.File)
+		file, err := openRotatingFile(logFile, RotateOptions{
+			MaxSize:    int64(cfg.MaxSize) * 1024 * 1024,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     time.Duration(cfg.MaxAge) * 24 * time.Hour,
+			Compress:   cfg.Compress,
+		})
 		if err != nil {
 			return err
 		}
+		output = file
 		log.SetOutput(file)
 	} else {
 		log.SetOutput(os.Stdout)
 	}
 
+	// 设置其他输出目标，不可用时只记录警告，不影响启动
+	for _, s := range sinks {
+		s.Close()
+	}
+	sinks = nil
+	if cfg := config.GetConfig().Logging.Syslog; cfg.Enabled {
+		if err := addSink(cfg.Level, func() (sink, error) {
+			return openSyslog(SyslogOptions{Network: cfg.Network, Address: cfg.Address, Facility: cfg.Facility, Tag: cfg.Tag})
+		}); err != nil {
+			log.Warnf("Syslog output disabled: %v", err)
+		}
+	}
+	if cfg := config.GetConfig().Logging.EventLog; cfg.Enabled {
+		if err := addSink(cfg.Level, func() (sink, error) {
+			return openEventLog(cfg.Source)
+		}); err != nil {
+			log.Warnf("Event log output disabled: %v", err)
+		}
+	}
+
+	// 设置组件日志级别
+	if err := SetComponentLevels(config.GetConfig().Logging.Components); err != nil {
+		log.Warnf("Ignoring logging.components: %v", err)
+	}
+
+	return nil
+}
+
+// addSink 打开输出目标并添加为不低于 level 的 Hook
+func addSink(level string, open func() (sink, error)) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid level: %s", level)
+	}
+	s, err := open()
+	if err != nil {
+		return err
+	}
+	sinks = append(sinks, s)
+	log.AddHook(&sinkHook{level: parsed, sink: s})
+	return nil
+}
+
+// Reopen 重新打开日志文件，logrotate 移走文件后通过 SIGUSR1 触发，输出到标准输出时无操作
+func Reopen() error {
+	if output == nil {
+		return nil
+	}
+	return output.Reopen()
+}
+
+// SetLevel 修改全局日志级别，用于配置热加载，级别无效时返回错误。单独设置了级别的组件不受影响
+func SetLevel(level string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	setBaseLevel(parsed)
 	return nil
 }
 
 // Debug 调试日志
 func Debug(args ...interface{}) {
-	log.Debug(args...)
+	if enabled("", logrus.DebugLevel) {
+		log.Debug(args...)
+	}
 }
 
 // Debugf 格式化调试日志
 func Debugf(format string, args ...interface{}) {
-	log.Debugf(format, args...)
+	if enabled("", logrus.DebugLevel) {
+		log.Debugf(format, args...)
+	}
 }
 
 // Info 信息日志
 func Info(args ...interface{}) {
-	log.Info(args...)
+	if enabled("", logrus.InfoLevel) {
+		log.Info(args...)
+	}
 }
 
 // Infof 格式化信息日志
 func Infof(format string, args ...interface{}) {
-	log.Infof(format, args...)
+	if enabled("", logrus.InfoLevel) {
+		log.Infof(format, args...)
+	}
 }
 
 // Warn 警告日志
 func Warn(args ...interface{}) {
-	log.Warn(args...)
+	if enabled("", logrus.WarnLevel) {
+		log.Warn(args...)
+	}
 }
 
 // Warnf 格式化警告日志
 func Warnf(format string, args ...interface{}) {
-	log.Warnf(format, args...)
+	if enabled("", logrus.WarnLevel) {
+		log.Warnf(format, args...)
+	}
 }
 
 // Error 错误日志
 func Error(args ...interface{}) {
-	log.Error(args...)
+	if enabled("", logrus.ErrorLevel) {
+		log.Error(args...)
+	}
 }
 
 // Errorf 格式化错误日志
 func Errorf(format string, args ...interface{}) {
-	log.Errorf(format, args...)
+	if enabled("", logrus.ErrorLevel) {
+		log.Errorf(format, args...)
+	}
 }
 
 // Fatal 致命错误日志
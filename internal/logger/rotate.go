@@ -0,0 +1,216 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/fsutil"
+)
+
+// backupTimeFormat 轮转后的文件名中的时间，按文件名排序即按时间排序
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateOptions 日志轮转配置，为 0 的限制不生效
+type RotateOptions struct {
+	MaxSize    int64         // 单个文件的最大字节数，超过后轮转
+	MaxBackups int           // 保留的轮转文件数
+	MaxAge     time.Duration // 轮转文件的保留时间
+	Compress   bool          // 轮转文件以 gzip 压缩
+}
+
+// rotatingFile 按大小轮转的日志文件，轮转后的文件名为 <name>-<time><ext>，压缩后追加 .gz
+type rotatingFile struct {
+	path    string
+	options RotateOptions
+	file    *os.File
+	size    int64
+	mu      sync.Mutex
+
+	// cleanupMu 串行化压缩和清理，轮转频繁时后台任务不会并发处理同一个文件
+	cleanupMu sync.Mutex
+	cleanupWg sync.WaitGroup
+}
+
+// openRotatingFile 打开日志文件，目录不存在时创建，并在后台清理过期的轮转文件
+func openRotatingFile(path string, options RotateOptions) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, options: options}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.startCleanup()
+	return r, nil
+}
+
+// Write 写入日志，写入后超过 MaxSize 时先轮转
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.options.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.options.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Reopen 关闭并重新打开日志文件，用于 logrotate 等外部工具移走文件之后
+func (r *rotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	return r.open()
+}
+
+// Close 关闭日志文件并等待后台清理完成
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.mu.Unlock()
+	r.cleanupWg.Wait()
+	return err
+}
+
+// open 以追加方式打开日志文件
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+// rotate 将当前文件重命名为带时间的轮转文件并打开新文件
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+	if err := os.Rename(r.path, r.backupName(time.Now())); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate log file: %v", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.startCleanup()
+	return nil
+}
+
+func (r *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "-" + t.Format(backupTimeFormat) + ext
+}
+
+func (r *rotatingFile) startCleanup() {
+	if r.options.MaxBackups <= 0 && r.options.MaxAge <= 0 && !r.options.Compress {
+		return
+	}
+	r.cleanupWg.Add(1)
+	go func() {
+		defer r.cleanupWg.Done()
+		r.cleanup()
+	}()
+}
+
+// cleanup 删除超出数量或过期的轮转文件，压缩剩余未压缩的文件
+func (r *rotatingFile) cleanup() {
+	r.cleanupMu.Lock()
+	defer r.cleanupMu.Unlock()
+
+	backups := r.backups()
+	for i, backup := range backups {
+		expired := r.options.MaxAge > 0 && time.Since(backup.time) > r.options.MaxAge
+		if (r.options.MaxBackups > 0 && i >= r.options.MaxBackups) || expired {
+			os.Remove(backup.path)
+			continue
+		}
+		if r.options.Compress && !strings.HasSuffix(backup.path, ".gz") {
+			if err := compressFile(backup.path); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to compress log file %s: %v\n", backup.path, err)
+			}
+		}
+	}
+}
+
+type logBackup struct {
+	path string
+	time time.Time
+}
+
+// backups 列出轮转文件，最新的在前
+func (r *rotatingFile) backups() []logBackup {
+	dir := filepath.Dir(r.path)
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(filepath.Base(r.path), ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var backups []logBackup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimPrefix(stamp, prefix), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, logBackup{path: filepath.Join(dir, name), time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.After(backups[j].time) })
+	return backups
+}
+
+// compressFile 将文件压缩为 .gz 后删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := fsutil.WriteAtomic(fsutil.OS, path+".gz", 0644, func(w io.Writer) error {
+		writer := gzip.NewWriter(w)
+		if _, err := io.Copy(writer, src); err != nil {
+			return err
+		}
+		return writer.Close()
+	}); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,323 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/fsutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Record 上报服务器的日志记录
+type Record struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// ShipOptions 日志上报配置
+type ShipOptions struct {
+	Level         string        // 上报的最低级别，如 warn
+	BatchSize     int           // 每批最多包含的记录数
+	FlushInterval time.Duration // 未满一批时的发送间隔，同时也是发送失败后的重试间隔
+	BufferSize    int           // 内存中缓存的记录数，缓存满时写入磁盘
+	SpillFile     string        // 发送失败或内存缓存满时写入的文件，为空时丢弃
+	MaxSpillSize  int64         // 磁盘缓存的最大字节数，超出后丢弃新记录
+}
+
+// SendFunc 发送一批日志，dropped 为上次发送成功以来丢弃的记录数。
+// 返回错误时这批记录写入磁盘缓存，之后按时间顺序重发
+type SendFunc func(records []Record, dropped int64) error
+
+// shipper 收集日志记录并分批发送的 logrus Hook
+type shipper struct {
+	options ShipOptions
+	level   logrus.Level
+	send    SendFunc
+	buffer  chan Record
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex // 保护磁盘缓存和 dropped
+	dropped int64
+}
+
+// StartShipping 开始将不低于 options.Level 的日志发送给 send，返回停止函数。
+// 停止时尝试发送剩余的记录，发送失败的记录保留在磁盘缓存中，下次启动后重发
+func StartShipping(options ShipOptions, send SendFunc) (stop func(), err error) {
+	level, err := logrus.ParseLevel(options.Level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log shipping level: %s", options.Level)
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = 5 * time.Second
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = 1000
+	}
+
+	s := &shipper{
+		options: options,
+		level:   level,
+		send:    send,
+		buffer:  make(chan Record, options.BufferSize),
+		done:    make(chan struct{}),
+	}
+	log.AddHook(s)
+	s.wg.Add(1)
+	go s.run()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			removeHook(s)
+			close(s.done)
+			s.wg.Wait()
+		})
+	}, nil
+}
+
+// removeHook 从全局日志中移除 Hook，保留其他 Hook
+func removeHook(hook logrus.Hook) {
+	hooks := make(logrus.LevelHooks)
+	for level, levelHooks := range log.Hooks {
+		for _, h := range levelHooks {
+			if h != hook {
+				hooks[level] = append(hooks[level], h)
+			}
+		}
+	}
+	log.ReplaceHooks(hooks)
+}
+
+func (s *shipper) Levels() []logrus.Level {
+	return levelsUpTo(s.level)
+}
+
+// Fire 记录进入内存缓存，缓存满时写入磁盘，日志调用方不会等待网络发送
+func (s *shipper) Fire(entry *logrus.Entry) error {
+	record := Record{Time: entry.Time, Level: entry.Level.String(), Message: entry.Message}
+	if len(entry.Data) > 0 {
+		record.Fields = make(map[string]interface{}, len(entry.Data))
+		for key, value := range entry.Data {
+			// error 序列化为 JSON 时是空对象
+			if err, ok := value.(error); ok {
+				value = err.Error()
+			}
+			record.Fields[key] = value
+		}
+	}
+
+	select {
+	case s.buffer <- record:
+	default:
+		s.spill([]Record{record})
+	}
+	return nil
+}
+
+func (s *shipper) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.options.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []Record
+	for {
+		select {
+		case record := <-s.buffer:
+			batch = append(batch, record)
+			if len(batch) >= s.options.BatchSize {
+				s.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = nil
+		case <-s.done:
+			for {
+				select {
+				case record := <-s.buffer:
+					batch = append(batch, record)
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush 先重发磁盘缓存中较早的记录，成功后再发送本批，失败的记录写入磁盘缓存
+func (s *shipper) flush(batch []Record) {
+	if !s.resendSpilled() {
+		s.spill(batch)
+		return
+	}
+	for len(batch) > 0 {
+		n := len(batch)
+		if n > s.options.BatchSize {
+			n = s.options.BatchSize
+		}
+		if err := s.sendBatch(batch[:n]); err != nil {
+			s.spill(batch)
+			return
+		}
+		batch = batch[n:]
+	}
+}
+
+// sendBatch 发送一批记录，成功后清零丢弃计数
+func (s *shipper) sendBatch(records []Record) error {
+	s.mu.Lock()
+	dropped := s.dropped
+	s.mu.Unlock()
+
+	if err := s.send(records, dropped); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.dropped -= dropped
+	s.mu.Unlock()
+	return nil
+}
+
+// spill 将记录追加到磁盘缓存，没有磁盘缓存或超过大小限制时丢弃
+func (s *shipper) spill(records []Record) {
+	if len(records) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.options.SpillFile == "" {
+		s.dropped += int64(len(records))
+		return
+	}
+	var size int64
+	if info, err := os.Stat(s.options.SpillFile); err == nil {
+		size = info.Size()
+	}
+
+	var data []byte
+	for i, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			s.dropped++
+			continue
+		}
+		if s.options.MaxSpillSize > 0 && size+int64(len(data)+len(line)+1) > s.options.MaxSpillSize {
+			s.dropped += int64(len(records) - i)
+			break
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if len(data) == 0 {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.options.SpillFile), 0755); err != nil {
+		s.dropped += int64(len(records))
+		return
+	}
+	file, err := os.OpenFile(s.options.SpillFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		s.dropped += int64(len(records))
+		return
+	}
+	defer file.Close()
+	file.Write(data)
+}
+
+// resendSpilled 按顺序重发磁盘缓存中的记录，全部发送成功（或没有缓存）时返回 true，
+// 失败时未发送的记录保留在磁盘缓存中
+func (s *shipper) resendSpilled() bool {
+	if s.options.SpillFile == "" {
+		return true
+	}
+	s.mu.Lock()
+	records, err := readSpill(s.options.SpillFile)
+	s.mu.Unlock()
+	if err != nil || len(records) == 0 {
+		return true
+	}
+
+	sent := 0
+	for sent < len(records) {
+		end := sent + s.options.BatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		if err := s.sendBatch(records[sent:end]); err != nil {
+			break
+		}
+		sent = end
+	}
+	if sent == 0 {
+		return false
+	}
+
+	// 发送期间 Fire 可能追加了新记录，重写时保留
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := readSpill(s.options.SpillFile)
+	if err != nil {
+		return false
+	}
+	if sent > len(current) {
+		sent = len(current)
+	}
+	remaining := current[sent:]
+	if len(remaining) == 0 {
+		os.Remove(s.options.SpillFile)
+		return true
+	}
+	writeSpill(s.options.SpillFile, remaining)
+	return false
+}
+
+// readSpill 读取磁盘缓存，损坏的行跳过
+func readSpill(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// writeSpill 原子地替换磁盘缓存
+func writeSpill(path string, records []Record) error {
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return fsutil.WriteFileAtomic(path, data, 0644)
+}
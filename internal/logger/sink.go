@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sink 日志文件之外的输出目标，如 syslog、Windows 事件日志
+type sink interface {
+	write(entry *logrus.Entry) error
+	Close() error
+}
+
+// sinkHook 将不低于指定级别的日志写入输出目标的 logrus Hook
+type sinkHook struct {
+	level logrus.Level
+	sink  sink
+}
+
+func (h *sinkHook) Levels() []logrus.Level {
+	return levelsUpTo(h.level)
+}
+
+// Fire 写入失败时只输出到标准错误，返回错误会使 logrus 跳过之后的 Hook（如日志上报）
+func (h *sinkHook) Fire(entry *logrus.Entry) error {
+	if err := h.sink.write(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write log to sink: %v\n", err)
+	}
+	return nil
+}
+
+// levelsUpTo 返回不低于 level 的级别
+func levelsUpTo(level logrus.Level) []logrus.Level {
+	levels := make([]logrus.Level, 0, len(logrus.AllLevels))
+	for _, l := range logrus.AllLevels {
+		if l <= level {
+			levels = append(levels, l)
+		}
+	}
+	return levels
+}
+
+// formatMessage 将日志格式化为单行文本，字段按键名排序追加为 key=value
+func formatMessage(entry *logrus.Entry) string {
+	if len(entry.Data) == 0 {
+		return entry.Message
+	}
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(entry.Message)
+	for _, key := range keys {
+		value := fmt.Sprint(entry.Data[key])
+		if strings.ContainsAny(value, " \t\r\n=\"") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" " + key + "=" + value)
+	}
+	return b.String()
+}
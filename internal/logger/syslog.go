@@ -0,0 +1,177 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SyslogOptions syslog 输出配置
+type SyslogOptions struct {
+	Network  string // udp 或 tcp，为空时写入本机 syslog
+	Address  string // 远程 syslog 地址，如 10.0.0.1:514
+	Facility string // 如 daemon、local0
+	Tag      string // 程序名，RFC5424 中的 APP-NAME
+}
+
+// localSyslogPaths 本机 syslog 的 socket 路径，依次尝试
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogWriteTimeout 写入超时，syslog 不可用时不长时间阻塞日志调用方
+const syslogWriteTimeout = 5 * time.Second
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSink 写入 syslog。远程以 RFC5424 格式发送，TCP 按 RFC6587 以长度前缀分帧；
+// 本机 socket 使用 journald、rsyslog 都能识别的传统格式
+type syslogSink struct {
+	options  SyslogOptions
+	facility int
+	hostname string
+	pid      int
+
+	mu      sync.Mutex
+	conn    net.Conn
+	network string // 实际连接的网络，本机为 unixgram 或 unix
+}
+
+func openSyslog(options SyslogOptions) (*syslogSink, error) {
+	facility, ok := syslogFacilities[options.Facility]
+	if !ok {
+		return nil, fmt.Errorf("invalid syslog facility: %s", options.Facility)
+	}
+	switch options.Network {
+	case "":
+	case "udp", "tcp":
+		if options.Address == "" {
+			return nil, fmt.Errorf("syslog address is required for network %s", options.Network)
+		}
+	default:
+		return nil, fmt.Errorf("invalid syslog network: %s", options.Network)
+	}
+	if options.Tag == "" {
+		options.Tag = "assistant_agent"
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+
+	s := &syslogSink{options: options, facility: facility, hostname: hostname, pid: os.Getpid()}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect 建立连接，调用方持有 mu 或尚未共享
+func (s *syslogSink) connect() error {
+	if s.options.Network != "" {
+		conn, err := net.DialTimeout(s.options.Network, s.options.Address, syslogWriteTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog %s: %v", s.options.Address, err)
+		}
+		s.conn, s.network = conn, s.options.Network
+		return nil
+	}
+	for _, path := range localSyslogPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.DialTimeout(network, path, syslogWriteTimeout); err == nil {
+				s.conn, s.network = conn, network
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("local syslog is not available")
+}
+
+func (s *syslogSink) write(entry *logrus.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	if err := s.send(entry); err != nil {
+		// 连接可能已被对端关闭（如 rsyslog 重启），重连后重试一次
+		s.conn.Close()
+		s.conn = nil
+		if err := s.connect(); err != nil {
+			return err
+		}
+		return s.send(entry)
+	}
+	return nil
+}
+
+func (s *syslogSink) send(entry *logrus.Entry) error {
+	var msg string
+	if s.options.Network == "" {
+		msg = s.formatLocal(entry)
+		if s.network == "unix" {
+			msg += "\n"
+		}
+	} else {
+		msg = s.formatRFC5424(entry)
+		if s.network == "tcp" {
+			msg = strconv.Itoa(len(msg)) + " " + msg
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+// formatRFC5424 <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *syslogSink) formatRFC5424(entry *logrus.Entry) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		s.priority(entry.Level), entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, s.options.Tag, s.pid, formatMessage(entry))
+}
+
+// formatLocal <PRI>Jan _2 15:04:05 TAG[PID]: MSG
+func (s *syslogSink) formatLocal(entry *logrus.Entry) string {
+	return fmt.Sprintf("<%d>%s %s[%d]: %s",
+		s.priority(entry.Level), entry.Time.Format(time.Stamp), s.options.Tag, s.pid, formatMessage(entry))
+}
+
+// priority facility*8 + severity
+func (s *syslogSink) priority(level logrus.Level) int {
+	var severity int
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		severity = 2 // crit
+	case logrus.ErrorLevel:
+		severity = 3 // err
+	case logrus.WarnLevel:
+		severity = 4 // warning
+	case logrus.InfoLevel:
+		severity = 6 // info
+	default:
+		severity = 7 // debug
+	}
+	return s.facility*8 + severity
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 插件配置来自配置文件、插件配置文件和服务器下发，同一个键的值可能是数字、布尔值或字符串，
+// 以下函数按期望的类型读取，无法转换时返回默认值
+
+// ConfigString 读取字符串配置，空字符串视为未配置
+func ConfigString(config map[string]interface{}, key, defaultValue string) string {
+	if v, ok := config[key].(string); ok && v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+// ConfigInt 读取整数配置，配置值可以是数字或字符串
+func ConfigInt(config map[string]interface{}, key string, defaultValue int) int {
+	switch v := config[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// ConfigBool 读取布尔配置，配置值可以是布尔值或字符串
+func ConfigBool(config map[string]interface{}, key string, defaultValue bool) bool {
+	switch v := config[key].(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// ConfigDuration 读取时长配置，如 "30s"，不大于 0 时返回默认值
+func ConfigDuration(config map[string]interface{}, key string, defaultValue time.Duration) time.Duration {
+	if v, ok := config[key].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// ParseClock 解析 HH:MM，返回从零点开始的分钟数，用于维护窗口、传输时间段等配置
+func ParseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigHelpers(t *testing.T) {
+	config := map[string]interface{}{
+		"name":     "edge",
+		"empty":    "",
+		"int":      3,
+		"int64":    int64(4),
+		"float":    5.0,
+		"numeric":  "6",
+		"bool":     true,
+		"boolText": "false",
+		"duration": "30s",
+		"zero":     "0s",
+		"invalid":  "abc",
+	}
+
+	assert.Equal(t, "edge", ConfigString(config, "name", "x"))
+	assert.Equal(t, "x", ConfigString(config, "empty", "x"))
+	assert.Equal(t, "x", ConfigString(config, "int", "x"))
+
+	assert.Equal(t, 3, ConfigInt(config, "int", 0))
+	assert.Equal(t, 4, ConfigInt(config, "int64", 0))
+	assert.Equal(t, 5, ConfigInt(config, "float", 0))
+	assert.Equal(t, 6, ConfigInt(config, "numeric", 0))
+	assert.Equal(t, 7, ConfigInt(config, "invalid", 7))
+	assert.Equal(t, 7, ConfigInt(config, "missing", 7))
+
+	assert.True(t, ConfigBool(config, "bool", false))
+	assert.False(t, ConfigBool(config, "boolText", true))
+	assert.True(t, ConfigBool(config, "invalid", true))
+
+	assert.Equal(t, 30*time.Second, ConfigDuration(config, "duration", time.Minute))
+	assert.Equal(t, time.Minute, ConfigDuration(config, "zero", time.Minute))
+	assert.Equal(t, time.Minute, ConfigDuration(config, "invalid", time.Minute))
+
+	minutes, err := ParseClock(" 22:30 ")
+	require.NoError(t, err)
+	assert.Equal(t, 22*60+30, minutes)
+	_, err = ParseClock("25:00")
+	assert.Error(t, err)
+}
@@ -14,7 +14,9 @@ var (
 	ErrPluginStartFailed     = errors.New("plugin start failed")
 	ErrPluginStopFailed      = errors.New("plugin stop failed")
 	ErrInvalidCommand        = errors.New("invalid command")
+	ErrInvalidArguments      = errors.New("invalid command arguments")
 	ErrInvalidEvent          = errors.New("invalid event")
 	ErrPluginConfigNotFound  = errors.New("plugin config not found")
 	ErrPluginConfigInvalid   = errors.New("plugin config invalid")
+	ErrPermissionDenied      = errors.New("plugin permission denied")
 ) 
\ No newline at end of file
@@ -0,0 +1,271 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/logger"
+)
+
+// EventAll 订阅所有类型的事件
+const EventAll = "*"
+
+// EventConfigChanged 插件通过 SetConfig 修改动态配置后发布，数据包含 key 和 value（删除时为 nil）
+const EventConfigChanged = "config_changed"
+
+// EventServerUnreachable 心跳连续失败（发送失败或服务器未响应 ping）达到上限时由 Agent 发布，
+// 数据包含 failures、error 和最后一次收到响应的时间 last_pong（Unix 秒，从未收到时没有）
+const EventServerUnreachable = "server_unreachable"
+
+// EventSubscriber 插件订阅事件的接口，通过 PluginContext.Events 获取
+// 订阅的事件由 HandleEvent 接收，插件自身发出的事件不会回送给自己
+type EventSubscriber interface {
+	Subscribe(eventTypes ...string) error
+	Unsubscribe(eventTypes ...string) error
+}
+
+// EventBus 插件事件总线，记录事件类型与订阅插件的对应关系
+type EventBus struct {
+	subscribers map[string]map[string]bool // 事件类型 -> 插件名集合
+	mu          sync.RWMutex
+}
+
+// NewEventBus 创建事件总线
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[string]map[string]bool),
+	}
+}
+
+// Subscribe 为插件订阅事件类型
+func (b *EventBus) Subscribe(pluginName string, eventTypes ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, eventType := range eventTypes {
+		if b.subscribers[eventType] == nil {
+			b.subscribers[eventType] = make(map[string]bool)
+		}
+		b.subscribers[eventType][pluginName] = true
+	}
+}
+
+// Unsubscribe 取消插件的订阅，未指定事件类型时取消全部订阅
+func (b *EventBus) Unsubscribe(pluginName string, eventTypes ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(eventTypes) == 0 {
+		for eventType := range b.subscribers {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+
+	for _, eventType := range eventTypes {
+		delete(b.subscribers[eventType], pluginName)
+		if len(b.subscribers[eventType]) == 0 {
+			delete(b.subscribers, eventType)
+		}
+	}
+}
+
+// Subscribers 返回订阅了事件类型（包括订阅全部事件）的插件，按名称排序
+func (b *EventBus) Subscribers(eventType string) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names := make(map[string]bool)
+	for name := range b.subscribers[eventType] {
+		names[name] = true
+	}
+	for name := range b.subscribers[EventAll] {
+		names[name] = true
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Subscriptions 返回插件订阅的事件类型，按名称排序
+func (b *EventBus) Subscriptions(pluginName string) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	result := make([]string, 0)
+	for eventType, names := range b.subscribers {
+		if names[pluginName] {
+			result = append(result, eventType)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Publish 将事件路由给所有订阅该事件类型且正在运行的插件，source 为发出事件的插件
+// 事件异步投递，发布方无需等待订阅方处理完成，也不会因订阅方回调而互相等待
+func (m *Manager) Publish(source, eventType string, data map[string]interface{}) {
+	targets := make([]*PluginInstance, 0)
+	names := make([]string, 0)
+
+	m.mu.RLock()
+	for _, name := range m.events.Subscribers(eventType) {
+		if name == source {
+			continue
+		}
+		if instance, exists := m.plugins[name]; exists {
+			targets = append(targets, instance)
+			names = append(names, name)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	event := make(map[string]interface{}, len(data)+2)
+	for key, value := range data {
+		event[key] = value
+	}
+	if _, exists := event["source"]; !exists && source != "" {
+		event["source"] = source
+	}
+	if _, exists := event["timestamp"]; !exists {
+		event["timestamp"] = time.Now().Unix()
+	}
+
+	for i, instance := range targets {
+		go m.deliverEvent(names[i], instance, eventType, event)
+	}
+}
+
+// deliverEvent 投递事件到单个插件
+func (m *Manager) deliverEvent(name string, instance *PluginInstance, eventType string, data map[string]interface{}) {
+	if !m.isRunning(instance) {
+		return
+	}
+	if err := instance.Plugin.HandleEvent(eventType, data); err != nil {
+		logger.Warnf("Plugin %s failed to handle event %s: %v", name, eventType, err)
+	}
+}
+
+// pluginEvents 绑定到单个插件的事件订阅
+type pluginEvents struct {
+	bus  *EventBus
+	name string
+}
+
+func (e *pluginEvents) Subscribe(eventTypes ...string) error {
+	e.bus.Subscribe(e.name, eventTypes...)
+	return nil
+}
+
+func (e *pluginEvents) Unsubscribe(eventTypes ...string) error {
+	e.bus.Unsubscribe(e.name, eventTypes...)
+	return nil
+}
+
+// pluginAgent 提供给插件的 AgentInterface，NotifyEvent 在上报服务器的同时发布到事件总线
+type pluginAgent struct {
+	AgentInterface
+	manager *Manager
+	name    string
+}
+
+func (a *pluginAgent) NotifyEvent(eventType string, data map[string]interface{}) error {
+	a.manager.Publish(a.name, eventType, data)
+	return a.AgentInterface.NotifyEvent(eventType, data)
+}
+
+// SetConfig 值发生变化时通知订阅了 config_changed 的其他插件
+func (a *pluginAgent) SetConfig(key string, value interface{}) error {
+	old := a.AgentInterface.GetConfig(key)
+	if err := a.AgentInterface.SetConfig(key, value); err != nil {
+		return err
+	}
+	if current := a.AgentInterface.GetConfig(key); !reflect.DeepEqual(old, current) {
+		a.manager.Publish(a.name, EventConfigChanged, map[string]interface{}{"key": key, "value": current})
+	}
+	return nil
+}
+
+// OpenFile 等文件系统方法转发到底层 Agent，底层 Agent 不支持时返回错误
+func (a *pluginAgent) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return nil, err
+	}
+	return fs.OpenFile(path, flag, perm)
+}
+
+func (a *pluginAgent) Stat(path string) (os.FileInfo, error) {
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(path)
+}
+
+func (a *pluginAgent) Rename(oldPath, newPath string) error {
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return err
+	}
+	return fs.Rename(oldPath, newPath)
+}
+
+func (a *pluginAgent) Remove(path string) error {
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return err
+	}
+	return fs.Remove(path)
+}
+
+func (a *pluginAgent) MkdirAll(path string, perm os.FileMode) error {
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return err
+	}
+	return fs.MkdirAll(path, perm)
+}
+
+// Command 转发到底层 Agent，底层 Agent 不支持时返回错误
+func (a *pluginAgent) Command(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	commander, err := AgentCommander(a.AgentInterface)
+	if err != nil {
+		return nil, err
+	}
+	return commander.Command(ctx, name, args...)
+}
+
+// Restart 转发到底层 Agent，底层 Agent 不支持时返回错误
+func (a *pluginAgent) Restart(replace func() error) error {
+	restarter, err := AgentRestarter(a.AgentInterface)
+	if err != nil {
+		return err
+	}
+	return restarter.Restart(replace)
+}
+
+// SetGauge 和 IncCounter 以插件名为前缀转发到底层 Agent，底层 Agent 不支持时忽略
+func (a *pluginAgent) SetGauge(name string, value float64) {
+	if stats, err := AgentStats(a.AgentInterface); err == nil {
+		stats.SetGauge(a.name+"."+name, value)
+	}
+}
+
+func (a *pluginAgent) IncCounter(name string, delta float64) {
+	if stats, err := AgentStats(a.AgentInterface); err == nil {
+		stats.IncCounter(a.name+"."+name, delta)
+	}
+}
@@ -0,0 +1,222 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscriberPlugin 初始化时订阅事件并记录收到的事件
+type subscriberPlugin struct {
+	MockPlugin
+	ctx    *PluginContext
+	topics []string
+	events chan string
+}
+
+func newSubscriberPlugin(name string, topics ...string) *subscriberPlugin {
+	return &subscriberPlugin{
+		MockPlugin: MockPlugin{
+			info:   &PluginInfo{Name: name, Version: "1.0.0"},
+			status: &PluginStatus{Status: "stopped"},
+		},
+		topics: topics,
+		events: make(chan string, 10),
+	}
+}
+
+func (p *subscriberPlugin) Init(ctx *PluginContext) error {
+	p.ctx = ctx
+	return ctx.Events.Subscribe(p.topics...)
+}
+
+func (p *subscriberPlugin) HandleEvent(eventType string, data map[string]interface{}) error {
+	p.events <- eventType + ":" + data["source"].(string)
+	return nil
+}
+
+// waitEvent 等待插件收到事件，超时返回空字符串
+func waitEvent(p *subscriberPlugin) string {
+	select {
+	case event := <-p.events:
+		return event
+	case <-time.After(2 * time.Second):
+		return ""
+	}
+}
+
+func TestEventBusSubscriptions(t *testing.T) {
+	bus := NewEventBus()
+	bus.Subscribe("monitor", "task_failed", "password_expired")
+	bus.Subscribe("audit", EventAll)
+
+	assert.Equal(t, []string{"audit", "monitor"}, bus.Subscribers("task_failed"))
+	assert.Equal(t, []string{"audit"}, bus.Subscribers("alert_triggered"))
+	assert.Equal(t, []string{"password_expired", "task_failed"}, bus.Subscriptions("monitor"))
+
+	bus.Unsubscribe("monitor", "task_failed")
+	assert.Equal(t, []string{"audit"}, bus.Subscribers("task_failed"))
+
+	bus.Unsubscribe("monitor")
+	bus.Unsubscribe("audit")
+	assert.Empty(t, bus.Subscribers("password_expired"))
+	assert.Empty(t, bus.Subscriptions("audit"))
+}
+
+func TestManagerPublishEvents(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	manager := NewManager(&MockAgent{config: make(map[string]interface{})}, &config.Config{})
+	publisher := newSubscriberPlugin("scheduler", "task_failed")
+	watcher := newSubscriberPlugin("watcher", "task_failed", "alert_triggered")
+	idle := newSubscriberPlugin("idle", "task_failed")
+
+	for _, p := range []*subscriberPlugin{publisher, watcher, idle} {
+		require.NoError(t, manager.Register(p))
+	}
+	require.NoError(t, manager.StartPlugin("scheduler"))
+	require.NoError(t, manager.StartPlugin("watcher"))
+	require.NoError(t, manager.StartPlugin("idle"))
+	require.NoError(t, manager.StopPlugin("idle"))
+
+	// 插件通过 NotifyEvent 发出的事件路由给其他订阅者，不回送给发布者，已停止的插件不接收
+	require.NoError(t, publisher.ctx.Agent.NotifyEvent("task_failed", map[string]interface{}{"task_id": "t1"}))
+	assert.Equal(t, "task_failed:scheduler", waitEvent(watcher))
+
+	manager.Publish("monitor", "alert_triggered", map[string]interface{}{})
+	assert.Equal(t, "alert_triggered:monitor", waitEvent(watcher))
+
+	// 未订阅的事件不投递
+	manager.Publish("monitor", "password_expired", map[string]interface{}{})
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, watcher.events)
+	assert.Empty(t, publisher.events)
+	assert.Empty(t, idle.events)
+
+	// 注销插件时取消订阅
+	require.NoError(t, manager.Unregister("watcher"))
+	assert.Empty(t, manager.events.Subscriptions("watcher"))
+}
+
+// statsAgent 记录统计数据的 Agent
+type statsAgent struct {
+	*MockAgent
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+}
+
+func (a *statsAgent) SetGauge(name string, value float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.gauges[name] = value
+}
+
+func (a *statsAgent) IncCounter(name string, delta float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counters[name] += delta
+}
+
+func TestPluginStats(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	agent := &statsAgent{MockAgent: &MockAgent{config: make(map[string]interface{})}, counters: map[string]float64{}, gauges: map[string]float64{}}
+	manager := NewManager(agent, &config.Config{})
+	p := newSubscriberPlugin("scheduler")
+	require.NoError(t, manager.Register(p))
+	require.NoError(t, manager.StartPlugin("scheduler"))
+
+	// 插件发布的统计数据加上插件名前缀
+	stats, err := AgentStats(p.ctx.Agent)
+	require.NoError(t, err)
+	stats.IncCounter("jobs_run", 2)
+	stats.SetGauge("jobs_pending", 5)
+
+	// 外部插件通过回调发布
+	handle := hostHandler(p.ctx)
+	_, err = handle(context.Background(), "IncCounter", []byte(`{"key": "jobs_run", "value": 1}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"scheduler.jobs_run": 3}, agent.counters)
+	assert.Equal(t, map[string]float64{"scheduler.jobs_pending": 5}, agent.gauges)
+
+	// 底层 Agent 不支持时插件调用不出错，回调返回错误
+	_, err = AgentStats(agent.MockAgent)
+	assert.Error(t, err)
+	plain := &pluginAgent{AgentInterface: agent.MockAgent, manager: manager, name: "scheduler"}
+	plain.IncCounter("jobs_run", 1)
+	_, err = hostHandler(&PluginContext{Agent: agent.MockAgent})(context.Background(), "SetGauge", []byte(`{"key": "x", "value": 1}`))
+	assert.Error(t, err)
+}
+
+// restartingAgent 记录重启调用的 Agent
+type restartingAgent struct {
+	*MockAgent
+	restarted bool
+}
+
+func (a *restartingAgent) Restart(replace func() error) error {
+	a.restarted = true
+	return replace()
+}
+
+func TestPluginRestart(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	agent := &restartingAgent{MockAgent: &MockAgent{config: make(map[string]interface{})}}
+	manager := NewManager(agent, &config.Config{Security: config.SecurityConfig{
+		PluginPermissions: map[string]config.PluginPermissionConfig{"updater": {Exec: true}},
+	}})
+	p := newSubscriberPlugin("updater")
+	require.NoError(t, manager.Register(p))
+	require.NoError(t, manager.StartPlugin("updater"))
+
+	// 插件上下文中的 Agent 转发重启请求
+	restarter, err := AgentRestarter(p.ctx.Agent)
+	require.NoError(t, err)
+	replaced := false
+	require.NoError(t, restarter.Restart(func() error {
+		replaced = true
+		return nil
+	}))
+	assert.True(t, agent.restarted)
+	assert.True(t, replaced)
+
+	// 底层 Agent 不支持时返回错误
+	plain := &pluginAgent{AgentInterface: agent.MockAgent, manager: manager, name: "updater"}
+	assert.Error(t, plain.Restart(func() error { return nil }))
+}
+
+func TestPluginConfigChanged(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	manager := NewManager(&MockAgent{config: make(map[string]interface{})}, &config.Config{})
+	scheduler := newSubscriberPlugin("scheduler", EventConfigChanged)
+	scheduler.info.Permissions = &PluginPermissions{ConfigWrite: true}
+	watcher := newSubscriberPlugin("watcher", EventConfigChanged)
+	require.NoError(t, manager.Register(scheduler))
+	require.NoError(t, manager.Register(watcher))
+	require.NoError(t, manager.StartPlugin("scheduler"))
+	require.NoError(t, manager.StartPlugin("watcher"))
+
+	// 值变化时通知其他插件，不回送给修改配置的插件
+	require.NoError(t, scheduler.ctx.Agent.SetConfig("scheduler.last_run", "2024-01-01"))
+	assert.Equal(t, "config_changed:scheduler", waitEvent(watcher))
+
+	// 值未变化时不通知
+	require.NoError(t, scheduler.ctx.Agent.SetConfig("scheduler.last_run", "2024-01-01"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, watcher.events)
+	assert.Empty(t, scheduler.events)
+}
@@ -0,0 +1,520 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/executor"
+	"assistant_agent/internal/logger"
+	"assistant_agent/internal/plugin/pb"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 外部插件协议
+const (
+	// ExternalProtocolVersion 外部插件握手协议版本
+	ExternalProtocolVersion = 1
+	// ExternalTokenEnv Agent 传给外部插件进程的认证令牌环境变量，双方的 gRPC 调用都需携带该令牌
+	ExternalTokenEnv = "ASSISTANT_AGENT_PLUGIN_TOKEN"
+)
+
+// 外部插件调用超时
+const (
+	externalHandshakeTimeout = 10 * time.Second
+	externalCallTimeout      = 30 * time.Second
+	externalCommandTimeout   = 10 * time.Minute
+)
+
+// ExternalPlugin 以独立进程运行的外部插件，通过本地 gRPC 与 Agent 双向通信
+// 插件进程启动后在标准输出打印 "1|tcp|127.0.0.1:端口" 完成握手，标准输入关闭时退出
+type ExternalPlugin struct {
+	path    string
+	modTime time.Time
+	size    int64
+	token   string
+	info    *PluginInfo
+	schemas map[string]*CommandSchema
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	conn    *grpclib.ClientConn
+	client  pb.PluginClient
+	host    *grpclib.Server
+	mu      sync.Mutex
+}
+
+// LaunchExternalPlugin 启动外部插件进程并完成握手
+func LaunchExternalPlugin(path string) (*ExternalPlugin, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ExternalPlugin{
+		path:    path,
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		token:   token,
+	}
+
+	cmd := exec.Command(path)
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = append(os.Environ(), ExternalTokenEnv+"="+token)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %v", filepath.Base(path), err)
+	}
+	p.cmd = cmd
+	p.stdin = stdin
+
+	name := filepath.Base(path)
+	go forwardPluginOutput(name, stderr)
+
+	// 握手后的标准输出继续作为插件日志
+	output := bufio.NewReader(stdout)
+	address, err := readHandshake(output)
+	if err != nil {
+		p.kill()
+		return nil, fmt.Errorf("plugin %s handshake failed: %v", name, err)
+	}
+	go forwardPluginOutput(name, output)
+
+	conn, err := grpclib.Dial(address, grpclib.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		p.kill()
+		return nil, fmt.Errorf("failed to connect to plugin %s: %v", name, err)
+	}
+	p.conn = conn
+	p.client = pb.NewPluginClient(conn)
+
+	var info PluginInfo
+	if err := p.call("Info", nil, &info); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if info.Name == "" {
+		p.Close()
+		return nil, ErrInvalidPluginInfo
+	}
+	p.info = &info
+
+	// 未声明命令参数的插件返回空
+	if err := p.call("CommandSchemas", nil, &p.schemas); err != nil {
+		logger.Warnf("Failed to get command schemas from plugin %s: %v", info.Name, err)
+	}
+
+	logger.Infof("External plugin launched: %s (%s, pid %d)", info.Name, path, cmd.Process.Pid)
+	return p, nil
+}
+
+// CommandSchemas 返回插件声明的命令参数
+func (p *ExternalPlugin) CommandSchemas() map[string]*CommandSchema {
+	return p.schemas
+}
+
+// Path 返回插件可执行文件路径
+func (p *ExternalPlugin) Path() string {
+	return p.path
+}
+
+// Changed 判断插件文件是否在启动后被修改或删除
+func (p *ExternalPlugin) Changed() bool {
+	stat, err := os.Stat(p.path)
+	if err != nil {
+		return true
+	}
+	return !stat.ModTime().Equal(p.modTime) || stat.Size() != p.size
+}
+
+// Info 返回插件信息
+func (p *ExternalPlugin) Info() *PluginInfo {
+	return p.info
+}
+
+// Init 启动 Agent 回调服务并初始化插件
+func (p *ExternalPlugin) Init(ctx *PluginContext) error {
+	p.mu.Lock()
+	if p.host != nil {
+		p.host.Stop()
+		p.host = nil
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		p.mu.Unlock()
+		return fmt.Errorf("failed to listen for plugin callbacks: %v", err)
+	}
+	host := grpclib.NewServer(grpclib.UnaryInterceptor(tokenInterceptor(p.token)))
+	pb.RegisterPluginHostServer(host, &hostServer{handle: hostHandler(ctx)})
+	p.host = host
+	p.mu.Unlock()
+
+	go host.Serve(listener)
+
+	return p.call("Init", map[string]interface{}{"host_address": listener.Addr().String()}, nil)
+}
+
+// Start 启动插件
+func (p *ExternalPlugin) Start() error {
+	return p.call("Start", nil, nil)
+}
+
+// Stop 停止插件，插件进程保持运行，可再次启动
+func (p *ExternalPlugin) Stop() error {
+	return p.call("Stop", nil, nil)
+}
+
+// HandleCommand 处理命令
+func (p *ExternalPlugin) HandleCommand(command string, args map[string]interface{}) (interface{}, error) {
+	var result interface{}
+	err := p.callTimeout(externalCommandTimeout, "HandleCommand", map[string]interface{}{
+		"command": command,
+		"args":    args,
+	}, &result)
+	return result, err
+}
+
+// HandleEvent 处理事件
+func (p *ExternalPlugin) HandleEvent(eventType string, data map[string]interface{}) error {
+	return p.call("HandleEvent", map[string]interface{}{
+		"event_type": eventType,
+		"data":       data,
+	}, nil)
+}
+
+// Status 获取插件状态，插件进程无响应时返回 error 状态
+func (p *ExternalPlugin) Status() *PluginStatus {
+	var pluginStatus PluginStatus
+	if err := p.call("Status", nil, &pluginStatus); err != nil {
+		return &PluginStatus{
+			Status:      "error",
+			LastError:   err.Error(),
+			LastUpdated: time.Now(),
+		}
+	}
+	return &pluginStatus
+}
+
+// Health 健康检查
+func (p *ExternalPlugin) Health() error {
+	return p.call("Health", nil, nil)
+}
+
+// GetConfig 获取插件配置
+func (p *ExternalPlugin) GetConfig() map[string]interface{} {
+	var config map[string]interface{}
+	if err := p.call("GetConfig", nil, &config); err != nil {
+		logger.Warnf("Failed to get config from plugin %s: %v", p.info.Name, err)
+	}
+	return config
+}
+
+// SetConfig 设置插件配置
+func (p *ExternalPlugin) SetConfig(config map[string]interface{}) error {
+	return p.call("SetConfig", config, nil)
+}
+
+// Close 关闭插件进程和回调服务
+func (p *ExternalPlugin) Close() error {
+	p.mu.Lock()
+	if p.host != nil {
+		p.host.Stop()
+		p.host = nil
+	}
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.client = nil
+	}
+	p.mu.Unlock()
+
+	// 关闭标准输入通知插件退出，超时后强制结束
+	p.stdin.Close()
+	done := make(chan struct{})
+	go func() {
+		p.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		p.cmd.Process.Kill()
+		<-done
+	}
+	return nil
+}
+
+// kill 握手失败时结束插件进程
+func (p *ExternalPlugin) kill() {
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+}
+
+// call 以默认超时调用插件方法
+func (p *ExternalPlugin) call(method string, args, result interface{}) error {
+	return p.callTimeout(externalCallTimeout, method, args, result)
+}
+
+// callTimeout 调用插件方法
+func (p *ExternalPlugin) callTimeout(timeout time.Duration, method string, args, result interface{}) error {
+	p.mu.Lock()
+	client := p.client
+	p.mu.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("plugin %s is closed", filepath.Base(p.path))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return invoke(ctx, client, p.token, method, args, result)
+}
+
+// invoker 插件服务和回调服务共用的调用接口
+type invoker interface {
+	Invoke(ctx context.Context, in *pb.InvokeRequest, opts ...grpclib.CallOption) (*pb.InvokeResponse, error)
+}
+
+// invoke 以 JSON 编码参数调用远端方法并解码结果
+func invoke(ctx context.Context, client invoker, token, method string, args, result interface{}) error {
+	var payload []byte
+	if args != nil {
+		var err error
+		if payload, err = json.Marshal(args); err != nil {
+			return fmt.Errorf("failed to marshal %s arguments: %v", method, err)
+		}
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	resp, err := client.Invoke(ctx, &pb.InvokeRequest{Method: method, Payload: payload})
+	if err != nil {
+		return fmt.Errorf("plugin rpc %s failed: %v", method, err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	if result != nil && len(resp.Payload) > 0 {
+		if err := json.Unmarshal(resp.Payload, result); err != nil {
+			return fmt.Errorf("failed to unmarshal %s result: %v", method, err)
+		}
+	}
+	return nil
+}
+
+// invokeHandler 按方法名处理调用，ctx 在调用方取消或断开时取消
+type invokeHandler func(ctx context.Context, method string, payload []byte) (interface{}, error)
+
+// handleInvoke 执行调用并编码结果，方法错误放在响应中而不是作为 gRPC 错误返回
+func handleInvoke(ctx context.Context, handle invokeHandler, req *pb.InvokeRequest) (*pb.InvokeResponse, error) {
+	result, err := handle(ctx, req.Method, req.Payload)
+	if err != nil {
+		return &pb.InvokeResponse{Error: err.Error()}, nil
+	}
+	if result == nil {
+		return &pb.InvokeResponse{}, nil
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return &pb.InvokeResponse{Error: fmt.Sprintf("failed to marshal %s result: %v", req.Method, err)}, nil
+	}
+	return &pb.InvokeResponse{Payload: payload}, nil
+}
+
+// hostServer Agent 侧的回调服务
+type hostServer struct {
+	pb.UnimplementedPluginHostServer
+	handle invokeHandler
+}
+
+func (s *hostServer) Invoke(ctx context.Context, req *pb.InvokeRequest) (*pb.InvokeResponse, error) {
+	return handleInvoke(ctx, s.handle, req)
+}
+
+// hostHandler 将插件的回调转发给插件上下文中的 AgentInterface 和事件订阅
+func hostHandler(ctx *PluginContext) invokeHandler {
+	agent := ctx.Agent
+	return func(callCtx context.Context, method string, payload []byte) (interface{}, error) {
+		var args struct {
+			Command   string                 `json:"command"`
+			Ref       string                 `json:"ref"`
+			Args      []string               `json:"args"`
+			TimeoutMs int64                  `json:"timeout_ms"`
+			Path      string                 `json:"path"`
+			Data      []byte                 `json:"data"`
+			Key       string                 `json:"key"`
+			Value     interface{}            `json:"value"`
+			EventType string                 `json:"event_type"`
+			EventData map[string]interface{} `json:"event_data"`
+			Events    []string               `json:"events"`
+			MsgType   string                 `json:"msg_type"`
+			Payload   interface{}            `json:"payload"`
+			Cmd       *executor.Command      `json:"cmd"`
+		}
+		if len(payload) > 0 {
+			if err := json.Unmarshal(payload, &args); err != nil {
+				return nil, fmt.Errorf("invalid %s arguments: %v", method, err)
+			}
+		}
+		timeout := time.Duration(args.TimeoutMs) * time.Millisecond
+
+		switch method {
+		case "GetSystemInfo":
+			return agent.GetSystemInfo()
+		case "ExecuteCommand":
+			return agent.ExecuteCommandContext(callCtx, args.Command, args.Args, timeout)
+		case "ExecuteScript":
+			return agent.ExecuteScriptContext(callCtx, args.Ref, args.Args, timeout)
+		case "RunCommand":
+			if args.Cmd == nil {
+				return nil, fmt.Errorf("invalid RunCommand arguments: cmd is required")
+			}
+			return agent.RunCommand(callCtx, args.Cmd)
+		case "ReadFile":
+			return agent.ReadFile(args.Path)
+		case "WriteFile":
+			return nil, agent.WriteFile(args.Path, args.Data)
+		case "FileExists":
+			return agent.FileExists(args.Path), nil
+		case "GetConfig":
+			return agent.GetConfig(args.Key), nil
+		case "SetConfig":
+			return nil, agent.SetConfig(args.Key, args.Value)
+		case "GetStatus":
+			return agent.GetStatus(), nil
+		case "SetStatus":
+			return nil, agent.SetStatus(args.Key, args.Value)
+		case "NotifyEvent":
+			return nil, agent.NotifyEvent(args.EventType, args.EventData)
+		case "CallServer":
+			return agent.CallServer(args.MsgType, args.Payload, timeout)
+		case "SetGauge", "IncCounter":
+			stats, err := AgentStats(agent)
+			if err != nil {
+				return nil, err
+			}
+			value, _ := args.Value.(float64)
+			if method == "SetGauge" {
+				stats.SetGauge(args.Key, value)
+			} else {
+				stats.IncCounter(args.Key, value)
+			}
+			return nil, nil
+		case "Subscribe":
+			if ctx.Events == nil {
+				return nil, fmt.Errorf("event bus not available")
+			}
+			return nil, ctx.Events.Subscribe(args.Events...)
+		case "Unsubscribe":
+			if ctx.Events == nil {
+				return nil, fmt.Errorf("event bus not available")
+			}
+			return nil, ctx.Events.Unsubscribe(args.Events...)
+		default:
+			return nil, fmt.Errorf("unknown host method: %s", method)
+		}
+	}
+}
+
+// tokenInterceptor 校验调用方携带的令牌，防止本机其他进程调用
+func tokenInterceptor(token string) grpclib.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("authorization"); len(values) == 0 || values[0] != "Bearer "+token {
+			return nil, status.Error(codes.Unauthenticated, "invalid plugin token")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// readHandshake 读取插件打印的握手信息，返回 gRPC 地址
+func readHandshake(output *bufio.Reader) (string, error) {
+	type handshake struct {
+		line string
+		err  error
+	}
+	ch := make(chan handshake, 1)
+	go func() {
+		line, err := output.ReadString('\n')
+		ch <- handshake{line: line, err: err}
+	}()
+
+	select {
+	case result := <-ch:
+		if result.err != nil {
+			return "", fmt.Errorf("failed to read handshake: %v", result.err)
+		}
+		return parseHandshake(result.line)
+	case <-time.After(externalHandshakeTimeout):
+		return "", fmt.Errorf("timed out waiting for handshake")
+	}
+}
+
+// parseHandshake 解析 "版本|tcp|地址" 格式的握手信息
+func parseHandshake(line string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid handshake: %q", strings.TrimSpace(line))
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil || version != ExternalProtocolVersion {
+		return "", fmt.Errorf("unsupported plugin protocol version: %s", parts[0])
+	}
+	if parts[1] != "tcp" {
+		return "", fmt.Errorf("unsupported plugin network: %s", parts[1])
+	}
+	return parts[2], nil
+}
+
+// forwardPluginOutput 将插件进程的输出写入 Agent 日志
+func forwardPluginOutput(name string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		logger.Infof("[Plugin:%s] %s", name, scanner.Text())
+	}
+}
+
+// randomToken 生成随机令牌
+func randomToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// externalHelperEnv 设置后测试进程作为外部插件运行
+const externalHelperEnv = "ASSISTANT_AGENT_TEST_EXTERNAL_PLUGIN"
+
+// echoPlugin 外部插件测试实现，exec 命令通过回调调用 Agent 执行命令
+type echoPlugin struct {
+	ctx    *PluginContext
+	status *PluginStatus
+}
+
+func (p *echoPlugin) Info() *PluginInfo {
+	return &PluginInfo{Name: "echo-external", Version: os.Getenv(externalHelperEnv)}
+}
+func (p *echoPlugin) Init(ctx *PluginContext) error {
+	p.ctx = ctx
+	p.status = &PluginStatus{Status: "stopped"}
+	return nil
+}
+func (p *echoPlugin) Start() error { p.status.Status = "running"; return nil }
+func (p *echoPlugin) Stop() error  { p.status.Status = "stopped"; return nil }
+func (p *echoPlugin) HandleCommand(command string, args map[string]interface{}) (interface{}, error) {
+	switch command {
+	case "echo":
+		return args, nil
+	case "exec":
+		return p.ctx.Agent.ExecuteCommand("whoami", nil, time.Second)
+	}
+	return nil, ErrInvalidCommand
+}
+func (p *echoPlugin) HandleEvent(eventType string, data map[string]interface{}) error { return nil }
+func (p *echoPlugin) Status() *PluginStatus                                           { return p.status }
+func (p *echoPlugin) Health() error                                                   { return nil }
+func (p *echoPlugin) GetConfig() map[string]interface{}                               { return nil }
+func (p *echoPlugin) SetConfig(config map[string]interface{}) error                   { return nil }
+
+// TestExternalPluginHelper 由外部插件测试启动，不直接运行
+func TestExternalPluginHelper(t *testing.T) {
+	if os.Getenv(externalHelperEnv) == "" {
+		t.Skip("helper process for external plugin tests")
+	}
+	ServeExternal(&echoPlugin{})
+	os.Exit(0)
+}
+
+// externalPluginScript 返回启动测试进程作为外部插件的脚本
+func externalPluginScript(version string) []byte {
+	return []byte(fmt.Sprintf("#!/bin/sh\n%s=%s exec %q -test.run=^TestExternalPluginHelper$\n",
+		externalHelperEnv, version, os.Args[0]))
+}
+
+// writeExternalPlugin 生成启动测试进程的插件脚本
+func writeExternalPlugin(t *testing.T, path, version string) {
+	require.NoError(t, os.WriteFile(path, externalPluginScript(version), 0755))
+}
+
+func TestParseHandshake(t *testing.T) {
+	address, err := parseHandshake("1|tcp|127.0.0.1:4321\n")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:4321", address)
+
+	for _, line := range []string{"", "hello", "2|tcp|127.0.0.1:1", "1|unix|/tmp/sock"} {
+		_, err := parseHandshake(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestServeExternalRequiresToken(t *testing.T) {
+	os.Unsetenv(ExternalTokenEnv)
+	assert.Error(t, ServeExternal(&echoPlugin{}))
+}
+
+func TestManagerReloadExternalPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("external plugin test uses a shell script launcher")
+	}
+	config.Init()
+	logger.Init()
+
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Security.PluginPermissions = map[string]config.PluginPermissionConfig{"echo-external": {Exec: true}}
+	manager := NewManager(&MockAgent{config: make(map[string]interface{})}, cfg)
+	defer manager.Stop()
+
+	_, err := manager.ReloadExternalPlugins()
+	assert.Error(t, err)
+	manager.SetExternalDir(dir)
+
+	// 不可执行的文件和 .so 被忽略
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.txt"), []byte("docs"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "legacy.so"), []byte{}, 0755))
+	pluginPath := filepath.Join(dir, "echo-plugin")
+	writeExternalPlugin(t, pluginPath, "1.0.0")
+
+	result, err := manager.ReloadExternalPlugins()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo-external"}, result.Loaded)
+	assert.Empty(t, result.Errors)
+
+	output, err := manager.SendCommand("echo-external", "echo", map[string]interface{}{"key": "value"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"key": "value"}, output)
+
+	// 插件通过回调服务调用 Agent
+	output, err = manager.SendCommand("echo-external", "exec", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "command executed", output)
+
+	_, err = manager.SendCommand("echo-external", "unknown", nil)
+	assert.EqualError(t, err, ErrInvalidCommand.Error())
+
+	result, err = manager.ReloadExternalPlugins()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo-external"}, result.Unchanged)
+
+	// 文件变化后重启插件
+	writeExternalPlugin(t, pluginPath, "2.0.0-updated")
+	result, err = manager.ReloadExternalPlugins()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo-external"}, result.Reloaded)
+	plugin, ok := manager.GetPlugin("echo-external")
+	require.True(t, ok)
+	assert.Equal(t, "2.0.0-updated", plugin.Info().Version)
+
+	require.NoError(t, os.Remove(pluginPath))
+	result, err = manager.ReloadExternalPlugins()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo-external"}, result.Removed)
+	_, ok = manager.GetPlugin("echo-external")
+	assert.False(t, ok)
+}
@@ -0,0 +1,416 @@
+package filetransfer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"assistant_agent/internal/plugin"
+)
+
+// 打包和解包：upload 的 archive 参数（tar.gz 或 zip）先把源目录打包到临时目录再上传，
+// download 的 extract 参数在下载完成并校验后把压缩包解压到 destination 目录。
+// 压缩包中的路径相对源目录，解压时拒绝绝对路径和 .. 等指向目标目录之外的条目，跳过符号链接和设备文件
+const (
+	defaultMaxArchiveSize  = 1024 * 1024 * 1024     // 打包的文件总大小上限
+	defaultMaxExtractSize  = 4 * 1024 * 1024 * 1024 // 解压后的文件总大小上限
+	defaultMaxExtractFiles = 100000
+)
+
+// archiveFormats 支持的格式及对应的扩展名
+var archiveFormats = map[string]string{
+	"tar.gz": ".tar.gz",
+	"zip":    ".zip",
+}
+
+// detectArchiveFormat 根据文件名判断压缩包格式，无法判断时返回空
+func detectArchiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	}
+	return ""
+}
+
+// parseArchiveArgs 解析 archive（上传时的打包格式）和 extract（下载后解压）参数
+func parseArchiveArgs(transferType, source string, args map[string]interface{}) (string, bool, error) {
+	format, _ := args["archive"].(string)
+	extract, _ := args["extract"].(bool)
+	if format != "" {
+		if _, ok := archiveFormats[format]; !ok {
+			return "", false, fmt.Errorf("unsupported archive format %q, expected tar.gz or zip", format)
+		}
+	}
+	if transferType == "download" && extract && format == "" {
+		if format = detectArchiveFormat(source); format == "" {
+			return "", false, fmt.Errorf("cannot detect archive format of %s, set archive to tar.gz or zip", source)
+		}
+	}
+	if transferType == "download" && !extract {
+		format = ""
+	}
+	return format, extract, nil
+}
+
+// archivePath 返回传输使用的临时压缩包路径，暂停后继续时使用同一个文件
+func (p *FileTransferPlugin) archivePath(transfer *TransferInfo) string {
+	return filepath.Join(p.tempDir, "file-transfer-"+transfer.ID+archiveFormats[transfer.Archive])
+}
+
+// uploadSource 返回上传时读取的本地文件，打包上传时为临时压缩包
+func (p *FileTransferPlugin) uploadSource(transfer *TransferInfo) string {
+	if transfer.Archive != "" {
+		return p.archivePath(transfer)
+	}
+	return transfer.Source
+}
+
+// downloadTarget 返回下载写入的本地文件，下载后解压时为临时压缩包
+func (p *FileTransferPlugin) downloadTarget(transfer *TransferInfo) string {
+	if transfer.Extract {
+		return p.archivePath(transfer)
+	}
+	return transfer.Destination
+}
+
+// withArchive 在上传前打包源目录、下载后解压，结束（暂停除外）后删除临时压缩包
+func (p *FileTransferPlugin) withArchive(perform performFunc) performFunc {
+	return func(transfer *TransferInfo, stop <-chan struct{}) error {
+		if transfer.Archive == "" {
+			return perform(transfer, stop)
+		}
+		fsys, err := plugin.AgentFS(p.ctx.Agent)
+		if err != nil {
+			return err
+		}
+		archive := p.archivePath(transfer)
+		defer func() {
+			p.mu.RLock()
+			paused := transfer.interrupted == "paused"
+			p.mu.RUnlock()
+			if !paused {
+				fsys.Remove(archive)
+			}
+		}()
+
+		if transfer.Type == "upload" {
+			// 暂停后继续时服务器已确认的块来自之前的压缩包，不能重新打包
+			if _, err := fsys.Stat(archive); err != nil || transfer.Transferred == 0 {
+				limit := int64(plugin.ConfigInt(p.config, "max_archive_size", defaultMaxArchiveSize))
+				if err := createArchive(fsys, transfer.Source, archive, transfer.Archive, limit, stop); err != nil {
+					return err
+				}
+			}
+			return perform(transfer, stop)
+		}
+
+		if err := perform(transfer, stop); err != nil {
+			return err
+		}
+		limits := extractLimits{
+			size:  int64(plugin.ConfigInt(p.config, "max_extract_size", defaultMaxExtractSize)),
+			files: plugin.ConfigInt(p.config, "max_extract_files", defaultMaxExtractFiles),
+		}
+		skipped, err := extractArchive(fsys, archive, transfer.Destination, transfer.Archive, limits)
+		for _, name := range skipped {
+			p.ctx.Logger.Warnf("Skipped unsupported archive entry %s in %s", name, transfer.Source)
+		}
+		return err
+	}
+}
+
+// archiveWriter 向压缩包写入条目，name 使用 / 分隔
+type archiveWriter interface {
+	addDir(name string, info fs.FileInfo) error
+	addFile(name string, info fs.FileInfo, r io.Reader) error
+	Close() error
+}
+
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (w *tarGzWriter) addDir(name string, info fs.FileInfo) error {
+	return w.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: int64(info.Mode().Perm()), ModTime: info.ModTime()})
+}
+
+func (w *tarGzWriter) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: info.Size(), Mode: int64(info.Mode().Perm()), ModTime: info.ModTime()}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	// 打包过程中文件变长时只写入头中声明的长度
+	_, err := io.Copy(w.tw, io.LimitReader(r, info.Size()))
+	return err
+}
+
+func (w *tarGzWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipArchiveWriter) addDir(name string, info fs.FileInfo) error {
+	header := &zip.FileHeader{Name: name + "/", Modified: info.ModTime()}
+	header.SetMode(info.Mode())
+	_, err := w.zw.CreateHeader(header)
+	return err
+}
+
+func (w *zipArchiveWriter) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	fw, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return w.zw.Close()
+}
+
+// createArchive 把 source（目录或单个文件）打包到 archive，先写入 archive.part 再重命名，
+// 文件总大小超过 limit 时失败
+func createArchive(fsys plugin.FileSystem, source, archive, format string, limit int64, stop <-chan struct{}) error {
+	info, err := fsys.Stat(source)
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(archive), 0755); err != nil {
+		return err
+	}
+	part := archive + ".part"
+	f, err := fsys.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	var w archiveWriter
+	if format == "zip" {
+		w = &zipArchiveWriter{zw: zip.NewWriter(f)}
+	} else {
+		gz := gzip.NewWriter(f)
+		w = &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}
+	}
+
+	var total int64
+	var add func(name, full string, info fs.FileInfo) error
+	add = func(name, full string, info fs.FileInfo) error {
+		select {
+		case <-stop:
+			return errTransferStopped
+		default:
+		}
+		switch {
+		case info.IsDir():
+			if name != "" {
+				if err := w.addDir(name, info); err != nil {
+					return err
+				}
+			}
+			entries, err := readDir(fsys, full)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				childInfo, err := entry.Info()
+				if err != nil {
+					return err
+				}
+				if err := add(path.Join(name, entry.Name()), filepath.Join(full, entry.Name()), childInfo); err != nil {
+					return err
+				}
+			}
+			return nil
+		case info.Mode().IsRegular():
+			if total += info.Size(); total > limit {
+				return fmt.Errorf("archive exceeds max_archive_size of %d bytes", limit)
+			}
+			r, err := fsys.OpenFile(full, os.O_RDONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return w.addFile(name, info, r)
+		}
+		// 符号链接、设备文件等不打包
+		return nil
+	}
+
+	name := ""
+	if !info.IsDir() {
+		name = info.Name()
+	}
+	err = add(name, source, info)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fsys.Remove(part)
+		return err
+	}
+	return fsys.Rename(part, archive)
+}
+
+// extractLimits 解压限制，防止压缩炸弹
+type extractLimits struct {
+	size  int64
+	files int
+}
+
+// safeJoin 返回条目在 dest 中的路径，拒绝绝对路径和指向 dest 之外的路径（zip-slip）
+func safeJoin(dest, name string) (string, error) {
+	clean := filepath.FromSlash(name)
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+	target := filepath.Join(dest, clean)
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q is outside the destination", name)
+	}
+	return target, nil
+}
+
+// extractor 把条目写入目标目录并统计大小和数量
+type extractor struct {
+	fsys   plugin.FileSystem
+	dest   string
+	limits extractLimits
+	size   int64
+	files  int
+}
+
+func (e *extractor) dir(name string) error {
+	target, err := safeJoin(e.dest, name)
+	if err != nil {
+		return err
+	}
+	return e.fsys.MkdirAll(target, 0755)
+}
+
+func (e *extractor) file(name string, mode fs.FileMode, r io.Reader) error {
+	target, err := safeJoin(e.dest, name)
+	if err != nil {
+		return err
+	}
+	if e.files++; e.files > e.limits.files {
+		return fmt.Errorf("archive has more than max_extract_files of %d entries", e.limits.files)
+	}
+	if err := e.fsys.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := e.fsys.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0200)
+	if err != nil {
+		return err
+	}
+	// 不信任条目头中声明的大小，按实际解压的字节数限制
+	remaining := e.limits.size - e.size
+	n, err := io.Copy(f, io.LimitReader(r, remaining+1))
+	e.size += n
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > remaining {
+		err = fmt.Errorf("archive exceeds max_extract_size of %d bytes", e.limits.size)
+	}
+	return err
+}
+
+// extractArchive 把 archive 解压到 dest，返回跳过的条目（符号链接、设备文件等）
+func extractArchive(fsys plugin.FileSystem, archive, dest, format string, limits extractLimits) ([]string, error) {
+	if err := fsys.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	f, err := fsys.OpenFile(archive, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	e := &extractor{fsys: fsys, dest: dest, limits: limits}
+	var skipped []string
+	if format == "zip" {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip archive: %v", err)
+		}
+		for _, entry := range zr.File {
+			mode := entry.Mode()
+			switch {
+			case mode.IsDir():
+				err = e.dir(entry.Name)
+			case mode.IsRegular():
+				var r io.ReadCloser
+				if r, err = entry.Open(); err == nil {
+					err = e.file(entry.Name, mode, r)
+					r.Close()
+				}
+			default:
+				skipped = append(skipped, entry.Name)
+			}
+			if err != nil {
+				return skipped, err
+			}
+		}
+		return skipped, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tar.gz archive: %v", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, fmt.Errorf("invalid tar.gz archive: %v", err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(header.Name)
+		case tar.TypeReg:
+			err = e.file(header.Name, fs.FileMode(header.Mode), tr)
+		case tar.TypeXGlobalHeader:
+		default:
+			skipped = append(skipped, header.Name)
+		}
+		if err != nil {
+			return skipped, err
+		}
+	}
+}
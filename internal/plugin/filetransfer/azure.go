@@ -0,0 +1,265 @@
+package filetransfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// azureAPIVersion Blob Storage REST API 版本
+const azureAPIVersion = "2020-10-02"
+
+// azureBackend Azure Blob Storage 后端，使用共享密钥签名或 SAS 令牌
+// 小于 threshold 的 blob 一次 Put Blob 上传，否则 Put Block 分块上传后 Put Block List 提交，
+// 每块带 Content-MD5 由服务端校验，提交时设置整个 blob 的 MD5 供下载校验
+type azureBackend struct {
+	client    *http.Client
+	endpoint  *url.URL
+	account   string
+	key       []byte // 共享密钥，使用 SAS 令牌时为空
+	sasToken  url.Values
+	container string
+	blockSize int64
+	threshold int64
+	now       func() time.Time
+}
+
+// newAzureBackend 创建 Azure 后端，endpoint 为空时使用 https://<account>.blob.core.windows.net
+func newAzureBackend(client *http.Client, endpoint, account, accountKey, sasToken, container string) (*azureBackend, error) {
+	if account == "" {
+		return nil, fmt.Errorf("azure_account is required")
+	}
+	b := &azureBackend{
+		client:    client,
+		account:   account,
+		container: container,
+		blockSize: defaultMultipartPartSize,
+		threshold: defaultMultipartThreshold,
+		now:       time.Now,
+	}
+	switch {
+	case accountKey != "":
+		key, err := base64.StdEncoding.DecodeString(accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure_account_key: %v", err)
+		}
+		b.key = key
+	case sasToken != "":
+		values, err := url.ParseQuery(strings.TrimPrefix(sasToken, "?"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure_sas_token: %v", err)
+		}
+		b.sasToken = values
+	default:
+		return nil, fmt.Errorf("azure_account_key or azure_sas_token is required")
+	}
+	if endpoint == "" {
+		endpoint = "https://" + account + ".blob.core.windows.net"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid azure_endpoint %q", endpoint)
+	}
+	b.endpoint = u
+	return b, nil
+}
+
+// sign 使用共享密钥为请求签名
+func (b *azureBackend) sign(req *http.Request) {
+	var canonicalHeaders strings.Builder
+	names := make([]string, 0)
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	// 资源路径为 /<account><path>，查询参数按名称排序
+	resource := "/" + b.account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(key) + ":" + strings.Join(values, ",")
+	}
+
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = fmt.Sprint(req.ContentLength)
+	}
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date，使用 x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalHeaders.String() + resource,
+	}, "\n")
+	signature := base64.StdEncoding.EncodeToString(hmacSHA256(b.key, stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+b.account+":"+signature)
+}
+
+// do 发送请求，非 2xx 响应转换为错误
+func (b *azureBackend) do(ctx context.Context, method, blob string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + b.container + "/" + blob
+	if query == nil {
+		query = url.Values{}
+	}
+	for key, values := range b.sasToken {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("x-ms-date", b.now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	if b.key != nil {
+		b.sign(req)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodHead {
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, blob, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// contentMD5Hex 将 Content-MD5 头（base64）转换为十六进制，无法解析时返回空
+func contentMD5Hex(value string) string {
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sum) != md5.Size {
+		return ""
+	}
+	return hex.EncodeToString(sum)
+}
+
+func (b *azureBackend) stat(ctx context.Context, blob string) (remoteObject, error) {
+	resp, err := b.do(ctx, http.MethodHead, blob, nil, nil, 0, nil)
+	if err != nil {
+		return remoteObject{}, err
+	}
+	resp.Body.Close()
+	return remoteObject{Size: resp.ContentLength, MD5: contentMD5Hex(resp.Header.Get("Content-MD5"))}, nil
+}
+
+func (b *azureBackend) open(ctx context.Context, blob string, offset int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("x-ms-range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := b.do(ctx, http.MethodGet, blob, nil, nil, 0, header)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("range request not supported")
+	}
+	return resp.Body, nil
+}
+
+// putSection 上传一段数据，Content-MD5 由服务端校验
+func (b *azureBackend) putSection(rt *remoteTransfer, blob string, query url.Values, r io.ReaderAt, offset, length int64, header http.Header) error {
+	_, contentMD5, err := sectionHashes(r, offset, length)
+	if err != nil {
+		return err
+	}
+	return rt.do(func() error {
+		h := header.Clone()
+		h.Set("Content-MD5", contentMD5)
+		resp, err := b.do(rt.ctx, http.MethodPut, blob, query, rt.body(r, offset, length), length, h)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+}
+
+func (b *azureBackend) upload(rt *remoteTransfer, blob string, r io.ReaderAt, size int64) error {
+	if size < b.threshold {
+		return b.putSection(rt, blob, nil, r, 0, size, http.Header{"X-Ms-Blob-Type": {"BlockBlob"}})
+	}
+
+	// 块 ID 在同一 blob 中长度必须相同
+	var blockIDs []string
+	for offset, index := int64(0), 0; offset < size; offset, index = offset+b.blockSize, index+1 {
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", index)))
+		query := url.Values{"comp": {"block"}, "blockid": {id}}
+		if err := b.putSection(rt, blob, query, r, offset, min(b.blockSize, size-offset), http.Header{}); err != nil {
+			return err
+		}
+		blockIDs = append(blockIDs, id)
+	}
+
+	// 提交块列表，并设置整个 blob 的 MD5（上传块时已累计）
+	if err := rt.hash.finish(size); err != nil {
+		return err
+	}
+	contentMD5 := base64.StdEncoding.EncodeToString(rt.hash.md5Digest())
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}{Latest: blockIDs})
+	if err != nil {
+		return err
+	}
+	body = append([]byte(xml.Header), body...)
+	return rt.do(func() error {
+		resp, err := b.do(rt.ctx, http.MethodPut, blob, url.Values{"comp": {"blocklist"}}, bytes.NewReader(body), int64(len(body)),
+			http.Header{"X-Ms-Blob-Content-Md5": {contentMD5}})
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+}
+
+func (b *azureBackend) close() error {
+	return nil
+}
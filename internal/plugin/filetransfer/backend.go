@@ -0,0 +1,307 @@
+package filetransfer
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"assistant_agent/internal/plugin"
+)
+
+// 远程存储后端，upload 的 destination 或 download 的 source 为以下 URL 时直接与存储服务传输，不经过服务器：
+//
+//	s3://bucket/key          Amazon S3 及兼容服务（s3_endpoint），SigV4 签名
+//	gs://bucket/key          Google Cloud Storage XML API，使用 HMAC 密钥
+//	azure://container/blob   Azure Blob Storage，使用共享密钥或 SAS 令牌
+//	sftp://[user@]host[:port]/path
+const (
+	defaultMultipartThreshold = 64 * 1024 * 1024
+	defaultMultipartPartSize  = 16 * 1024 * 1024
+	// minMultipartPartSize S3 要求除最后一个分段外每段至少 5 MiB
+	minMultipartPartSize = 5 * 1024 * 1024
+)
+
+// remoteObject 远程对象信息，MD5 未知时为空
+type remoteObject struct {
+	Size int64
+	MD5  string
+}
+
+// remoteBackend 远程存储后端
+type remoteBackend interface {
+	// stat 返回对象信息，对象不存在时返回 os.ErrNotExist
+	stat(ctx context.Context, key string) (remoteObject, error)
+	// open 从 offset 开始读取对象
+	open(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
+	// upload 上传对象并校验，rt 提供限速读取和重试
+	upload(rt *remoteTransfer, key string, r io.ReaderAt, size int64) error
+	close() error
+}
+
+// isRemoteURL 判断路径是否为远程存储 URL
+func isRemoteURL(path string) bool {
+	for _, scheme := range []string{"s3://", "gs://", "azure://", "sftp://"} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// openBackend 根据 URL 和插件配置创建后端，返回后端和对象键
+func (p *FileTransferPlugin) openBackend(rawURL string) (remoteBackend, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid remote url %q: %v", rawURL, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, "", fmt.Errorf("invalid remote url %q: bucket and key are required", rawURL)
+	}
+	configString := func(name string) string {
+		value, _ := p.config[name].(string)
+		return value
+	}
+	client := &http.Client{}
+	partSize := int64(plugin.ConfigInt(p.config, "multipart_part_size", defaultMultipartPartSize))
+	threshold := int64(plugin.ConfigInt(p.config, "multipart_threshold", defaultMultipartThreshold))
+	partSize = max(partSize, minMultipartPartSize)
+
+	switch u.Scheme {
+	case "s3":
+		region := configString("s3_region")
+		if region == "" {
+			region = "us-east-1"
+		}
+		backend, err := newS3Backend(client, configString("s3_endpoint"), u.Host, region,
+			configString("s3_access_key_id"), configString("s3_secret_access_key"), configString("s3_session_token"))
+		if err != nil {
+			return nil, "", err
+		}
+		backend.partSize, backend.threshold = partSize, threshold
+		return backend, key, nil
+	case "gs":
+		// GCS XML API 兼容 S3 的签名和分段上传
+		backend, err := newS3Backend(client, "https://storage.googleapis.com", u.Host, "auto",
+			configString("gcs_access_key_id"), configString("gcs_secret_access_key"), "")
+		if err != nil {
+			return nil, "", err
+		}
+		backend.partSize, backend.threshold = partSize, threshold
+		return backend, key, nil
+	case "azure":
+		backend, err := newAzureBackend(client, configString("azure_endpoint"), configString("azure_account"),
+			configString("azure_account_key"), configString("azure_sas_token"), u.Host)
+		if err != nil {
+			return nil, "", err
+		}
+		backend.blockSize, backend.threshold = partSize, threshold
+		return backend, key, nil
+	case "sftp":
+		user := configString("sftp_user")
+		if u.User != nil {
+			user = u.User.Username()
+		}
+		backend, err := p.newSFTPBackend(u.Host, user)
+		if err != nil {
+			return nil, "", err
+		}
+		return backend, "/" + key, nil
+	}
+	return nil, "", fmt.Errorf("unsupported remote url scheme: %s", u.Scheme)
+}
+
+// remoteTransfer 后端执行一次传输时的上下文，提供限速读取、进度更新和重试
+type remoteTransfer struct {
+	ctx      context.Context
+	p        *FileTransferPlugin
+	transfer *TransferInfo
+	stop     <-chan struct{}
+	retry    *retrier
+	hash     *runningHash // 上传时累计已读取数据的 SHA-256 和 MD5
+}
+
+// body 返回 r 中 [offset, offset+length) 的读取器，读取时限速并更新进度
+func (rt *remoteTransfer) body(r io.ReaderAt, offset, length int64) io.Reader {
+	return &progressReader{r: io.NewSectionReader(r, offset, length), rt: rt, read: offset}
+}
+
+// do 执行操作，失败时按重试策略重试，传输被停止时返回 errTransferStopped
+func (rt *remoteTransfer) do(op func() error) error {
+	for {
+		err := op()
+		if err == nil {
+			rt.retry.reset()
+			return nil
+		}
+		if rt.ctx.Err() != nil {
+			return errTransferStopped
+		}
+		if err := rt.retry.wait(err); err != nil {
+			return err
+		}
+	}
+}
+
+// progressReader 按限速读取，更新已传输字节数
+type progressReader struct {
+	r    io.Reader
+	rt   *remoteTransfer
+	read int64
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	if err := r.rt.p.throttle(r.rt.transfer, len(b), r.rt.stop); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(b)
+	if r.rt.hash != nil {
+		if err := r.rt.hash.update(r.read, b[:n]); err != nil {
+			return n, err
+		}
+	}
+	r.read += int64(n)
+	r.rt.p.reportProgress(r.rt.transfer, r.read)
+	return n, err
+}
+
+// newRemoteTransfer 创建传输上下文，插件停止时取消正在进行的请求
+func (p *FileTransferPlugin) newRemoteTransfer(transfer *TransferInfo, stop <-chan struct{}) (*remoteTransfer, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return &remoteTransfer{
+		ctx:      ctx,
+		p:        p,
+		transfer: transfer,
+		stop:     stop,
+		retry:    &retrier{p: p, transfer: transfer, stop: stop},
+	}, cancel
+}
+
+// performRemoteUpload 将本地文件上传到远程存储
+func (p *FileTransferPlugin) performRemoteUpload(transfer *TransferInfo, backend remoteBackend, key string, stop <-chan struct{}) error {
+	defer backend.close()
+	fsys, err := plugin.AgentFS(p.ctx.Agent)
+	if err != nil {
+		return err
+	}
+	f, err := fsys.OpenFile(p.uploadSource(transfer), os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	transfer.Size = info.Size()
+	p.mu.Unlock()
+
+	rt, cancel := p.newRemoteTransfer(transfer, stop)
+	defer cancel()
+	rt.hash = newRunningHash(f, true)
+	if err := backend.upload(rt, key, f, info.Size()); err != nil {
+		if rt.ctx.Err() != nil {
+			return errTransferStopped
+		}
+		return err
+	}
+
+	_, err = p.verifyIntegrity(transfer, rt.hash, info.Size(), "")
+	return err
+}
+
+// performRemoteDownload 从远程存储下载到 destination.part，中断或暂停后从已写入的位置继续，
+// 完成后校验大小、MD5（后端提供时）和请求中的 SHA-256、签名再重命名
+func (p *FileTransferPlugin) performRemoteDownload(transfer *TransferInfo, backend remoteBackend, key string, stop <-chan struct{}) error {
+	defer backend.close()
+	fsys, err := plugin.AgentFS(p.ctx.Agent)
+	if err != nil {
+		return err
+	}
+	rt, cancel := p.newRemoteTransfer(transfer, stop)
+	defer cancel()
+	resume := p.resumableBytes(transfer)
+
+	var object remoteObject
+	notFound := false
+	if err := rt.do(func() error {
+		var err error
+		object, err = backend.stat(rt.ctx, key)
+		if errors.Is(err, os.ErrNotExist) {
+			// 对象不存在时不重试
+			notFound = true
+			return nil
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+	if notFound {
+		return fmt.Errorf("remote object not found: %s", transfer.Source)
+	}
+	p.mu.Lock()
+	transfer.Size = object.Size
+	p.mu.Unlock()
+
+	part := p.downloadTarget(transfer) + ".part"
+	f, offset, err := openPart(fsys, part, resume(object.Size))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := newRunningHash(f, true)
+	for offset < object.Size {
+		rc, err := backend.open(rt.ctx, key, offset)
+		if err == nil {
+			w := &progressWriter{w: io.MultiWriter(io.NewOffsetWriter(f, offset), hash.writerAt(offset)),
+				p: p, transfer: transfer, stop: stop, written: offset}
+			_, err = io.Copy(w, io.LimitReader(rc, object.Size-offset))
+			rc.Close()
+			offset = w.written
+		}
+		if err != nil {
+			if rt.ctx.Err() != nil {
+				return errTransferStopped
+			}
+			if err := rt.retry.wait(err); err != nil {
+				return err
+			}
+			continue
+		}
+		rt.retry.reset()
+		if offset < object.Size {
+			// 对象在下载过程中变短
+			return fmt.Errorf("remote object truncated at %d of %d bytes", offset, object.Size)
+		}
+	}
+
+	if err := hash.finish(object.Size); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.md5Digest()); object.MD5 != "" && sum != object.MD5 {
+		return fmt.Errorf("md5 mismatch: expected %s, got %s", object.MD5, sum)
+	}
+	if _, err := p.verifyIntegrity(transfer, hash, object.Size, ""); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return fsys.Rename(part, p.downloadTarget(transfer))
+}
@@ -0,0 +1,276 @@
+package filetransfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"assistant_agent/internal/plugin"
+)
+
+// pausedTransfersFileName 暂停的传输保存在数据目录中，Agent 重启后可以继续
+const pausedTransfersFileName = "file_transfers.json"
+
+// performFunc 执行一次传输，stop 关闭时中止
+type performFunc func(*TransferInfo, <-chan struct{}) error
+
+// performer 返回上传或下载的执行函数，远程存储的配置错误在此时返回。
+// 远程存储后端在每次执行时创建，暂停后继续时重新连接
+func (p *FileTransferPlugin) performer(transferType, source, destination string) (performFunc, error) {
+	remote := destination
+	if transferType == "download" {
+		remote = source
+	}
+	if !isRemoteURL(remote) {
+		if transferType == "download" {
+			return p.withArchive(p.performDownload), nil
+		}
+		return p.withArchive(p.performUpload), nil
+	}
+
+	backend, _, err := p.openBackend(remote)
+	if err != nil {
+		return nil, err
+	}
+	backend.close()
+	return p.withArchive(func(transfer *TransferInfo, stop <-chan struct{}) error {
+		backend, key, err := p.openBackend(remote)
+		if err != nil {
+			return err
+		}
+		if transferType == "download" {
+			return p.performRemoteDownload(transfer, backend, key, stop)
+		}
+		return p.performRemoteUpload(transfer, backend, key, stop)
+	}), nil
+}
+
+// syncPerformer 返回同步的执行函数，plan 为空时（暂停后继续）重新生成同步计划，已同步的文件不再复制
+func (p *FileTransferPlugin) syncPerformer(opts *SyncOptions, plan *SyncPlan) performFunc {
+	return func(transfer *TransferInfo, stop <-chan struct{}) error {
+		if plan == nil {
+			fsys, err := plugin.AgentFS(p.ctx.Agent)
+			if err != nil {
+				return err
+			}
+			if plan, err = planSync(fsys, transfer.Source, transfer.Destination, opts); err != nil {
+				return err
+			}
+			p.mu.Lock()
+			transfer.Size = transfer.Transferred + plan.Bytes
+			p.mu.Unlock()
+		}
+		return p.performSync(transfer, plan, stop)
+	}
+}
+
+// interruptLocked 中止正在执行的传输，reason 为 paused、cancelled 或 stopped，调用方需持有 p.mu
+func (t *TransferInfo) interruptLocked(reason string) bool {
+	if t.stop == nil || t.interrupted != "" {
+		return false
+	}
+	t.interrupted = reason
+	close(t.stop)
+	return true
+}
+
+// active 判断传输是否正在执行
+func (t *TransferInfo) active() bool {
+	return t.Status == "running" || t.Status == "waiting"
+}
+
+// handleCancel 取消传输：正在执行的传输立即中止，已下载的临时文件被删除
+func (p *FileTransferPlugin) handleCancel(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	p.mu.Lock()
+	transfer, exists := p.transfers[id]
+	if !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("transfer not found")
+	}
+	switch {
+	case transfer.active():
+		// 传输结束后由 finishTransfer 更新状态并清理
+		transfer.interruptLocked("cancelled")
+		p.mu.Unlock()
+	case transfer.Status == "queued":
+		p.dequeueLocked(transfer)
+		transfer.interrupted = "cancelled"
+		p.mu.Unlock()
+		p.finishTransfer(transfer, errTransferStopped)
+	case transfer.Status == "paused":
+		transfer.Status = "cancelled"
+		event := transfer.snapshot()
+		p.mu.Unlock()
+		p.cleanupTransfer(transfer)
+		p.savePausedTransfers()
+		p.ctx.Agent.NotifyEvent("transfer_cancelled", event)
+	default:
+		status := transfer.Status
+		p.mu.Unlock()
+		return nil, fmt.Errorf("transfer is %s", status)
+	}
+
+	return map[string]interface{}{
+		"id":      id,
+		"message": "Transfer cancelled",
+	}, nil
+}
+
+// handlePause 暂停正在执行的传输，已传输的数据保留，resume 时从中断处继续
+func (p *FileTransferPlugin) handlePause(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	p.mu.Lock()
+	transfer, exists := p.transfers[id]
+	if !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("transfer not found")
+	}
+	switch {
+	case transfer.active():
+		transfer.interruptLocked("paused")
+		p.mu.Unlock()
+	case transfer.Status == "queued":
+		// 排队的传输直接暂停，resume 后重新排队
+		p.dequeueLocked(transfer)
+		transfer.interrupted = "paused"
+		p.mu.Unlock()
+		p.finishTransfer(transfer, errTransferStopped)
+	default:
+		status := transfer.Status
+		p.mu.Unlock()
+		return nil, fmt.Errorf("transfer is %s", status)
+	}
+
+	return map[string]interface{}{
+		"id":      id,
+		"message": "Transfer paused",
+	}, nil
+}
+
+// handleResume 继续暂停的传输，传输重新排队
+func (p *FileTransferPlugin) handleResume(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	p.mu.RLock()
+	transfer, exists := p.transfers[id]
+	var status string
+	if exists {
+		status = transfer.Status
+	}
+	p.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("transfer not found")
+	}
+	if status != "paused" {
+		return nil, fmt.Errorf("transfer is %s", status)
+	}
+
+	var perform performFunc
+	if transfer.Type == "sync" {
+		perform = p.syncPerformer(transfer.Sync, nil)
+	} else {
+		var err error
+		if perform, err = p.performer(transfer.Type, transfer.Source, transfer.Destination); err != nil {
+			return nil, err
+		}
+	}
+	if !p.startTransfer(transfer, perform) {
+		return nil, fmt.Errorf("transfer is not paused")
+	}
+	p.savePausedTransfers()
+
+	return map[string]interface{}{
+		"id":      id,
+		"status":  "resumed",
+		"message": "Transfer resumed",
+	}, nil
+}
+
+// cleanupTransfer 删除取消的下载留下的临时文件和暂停时保留的压缩包，同步和上传的其他临时文件在中止时已删除
+func (p *FileTransferPlugin) cleanupTransfer(transfer *TransferInfo) {
+	fsys, err := plugin.AgentFS(p.ctx.Agent)
+	if err != nil {
+		return
+	}
+	if transfer.Archive != "" {
+		fsys.Remove(p.archivePath(transfer))
+	}
+	if transfer.Type != "download" {
+		return
+	}
+	if err := fsys.Remove(p.downloadTarget(transfer) + ".part"); err != nil {
+		p.ctx.Logger.Debugf("Failed to remove partial download %s: %v", transfer.Destination, err)
+	}
+}
+
+// pausedTransfersPath 返回保存暂停传输的文件路径，未配置数据目录时返回空
+func pausedTransfersPath(dataDir string) string {
+	if dataDir == "" {
+		return ""
+	}
+	return filepath.Join(dataDir, pausedTransfersFileName)
+}
+
+// loadPausedTransfers 加载上次运行时暂停的传输
+func (p *FileTransferPlugin) loadPausedTransfers() error {
+	if p.stateFile == "" || !p.ctx.Agent.FileExists(p.stateFile) {
+		return nil
+	}
+	data, err := p.ctx.Agent.ReadFile(p.stateFile)
+	if err != nil {
+		return err
+	}
+	var transfers []*TransferInfo
+	if err := json.Unmarshal(data, &transfers); err != nil {
+		return fmt.Errorf("invalid paused transfers: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, transfer := range transfers {
+		transfer.Status = "paused"
+		transfer.limiter = newRateLimiter(transfer.RateLimit)
+		p.transfers[transfer.ID] = transfer
+	}
+	return nil
+}
+
+// savePausedTransfers 保存暂停的传输，未配置数据目录时只保存在内存中
+func (p *FileTransferPlugin) savePausedTransfers() {
+	if p.stateFile == "" {
+		return
+	}
+
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	p.mu.RLock()
+	paused := make([]*TransferInfo, 0)
+	for _, transfer := range p.transfers {
+		if transfer.Status == "paused" {
+			paused = append(paused, transfer)
+		}
+	}
+	data, err := json.Marshal(paused)
+	p.mu.RUnlock()
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to encode paused transfers: %v", err)
+		return
+	}
+
+	if err := p.ctx.Agent.WriteFile(p.stateFile, data); err != nil {
+		p.ctx.Logger.Errorf("Failed to save paused transfers: %v", err)
+	}
+}
@@ -0,0 +1,426 @@
+package filetransfer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"assistant_agent/internal/plugin"
+)
+
+// 增量传输：接收方按 block_size 计算已有旧文件每个完整块的弱校验和（rsync 滚动校验和）和 SHA-256，
+// 发送方在新文件上滚动匹配这些块，只传输未匹配的数据。操作列表按顺序描述新文件：
+//
+//	{"type": "copy", "block": 3, "count": 2}    复制旧文件的第 3、4 块
+//	{"type": "data", "offset": 8192, "size": 100} 新文件 offset 处的数据需要传输
+//
+// 上传：file_upload_signatures {transfer_id, destination, block_size} -> {blocks}，旧文件不存在时 blocks 为空；
+// 增量更小时发送 file_upload_delta {transfer_id, destination, size, block_size, ops}，再用 file_upload_chunk
+// 按 offset 上传 data 操作的数据，最后 file_upload_complete 带 delta: true。
+// 下载：本地已有 destination 时发送 file_download_delta {transfer_id, source, block_size, blocks} -> {ops}，
+// 服务器认为增量不划算时返回 {full: true}；data 操作的数据通过 file_download_chunk 获取。
+// 请求失败或增量不比完整传输小时回退到完整传输。
+const (
+	defaultDeltaMinSize = 1024 * 1024
+	minDeltaBlockSize   = 2 * 1024
+	maxDeltaBlockSize   = 64 * 1024
+	// deltaOpOverhead 估算每个操作的编码开销
+	deltaOpOverhead = 48
+)
+
+// blockSignature 旧文件一个块的校验和
+type blockSignature struct {
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+// deltaOp 增量操作
+type deltaOp struct {
+	Type   string `json:"type"` // copy, data
+	Block  int64  `json:"block,omitempty"`
+	Count  int64  `json:"count,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// rollingChecksum rsync 弱校验和，窗口滑动一个字节时 O(1) 更新
+type rollingChecksum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingChecksum(block []byte) *rollingChecksum {
+	r := &rollingChecksum{n: uint32(len(block))}
+	for i, c := range block {
+		r.a += uint32(c)
+		r.b += uint32(len(block)-i) * uint32(c)
+	}
+	return r
+}
+
+// roll 移出 out 并移入 in
+func (r *rollingChecksum) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+func (r *rollingChecksum) value() uint32 {
+	return (r.a & 0xffff) | (r.b&0xffff)<<16
+}
+
+// strongChecksum 返回块的 SHA-256
+func strongChecksum(block []byte) string {
+	sum := sha256.Sum256(block)
+	return hex.EncodeToString(sum[:])
+}
+
+// deltaBlockSize 根据文件大小选择块大小，约为大小的平方根
+func deltaBlockSize(size int64) int64 {
+	blockSize := int64(math.Sqrt(float64(size)))
+	blockSize = (blockSize + 1023) / 1024 * 1024
+	return max(minDeltaBlockSize, min(blockSize, maxDeltaBlockSize))
+}
+
+// computeSignatures 计算每个完整块的校验和，末尾不足一块的数据不参与匹配
+func computeSignatures(r io.Reader, blockSize int64) ([]blockSignature, error) {
+	reader := bufio.NewReader(r)
+	block := make([]byte, blockSize)
+	var signatures []blockSignature
+	for {
+		if _, err := io.ReadFull(reader, block); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return signatures, nil
+			}
+			return nil, err
+		}
+		signatures = append(signatures, blockSignature{
+			Weak:   newRollingChecksum(block).value(),
+			Strong: strongChecksum(block),
+		})
+	}
+}
+
+// computeDelta 在新文件上滚动匹配旧文件的块，返回操作列表和需要传输的字节数
+func computeDelta(r io.Reader, size, blockSize int64, signatures []blockSignature) ([]deltaOp, int64, error) {
+	index := make(map[uint32][]int64, len(signatures))
+	for i, signature := range signatures {
+		index[signature.Weak] = append(index[signature.Weak], int64(i))
+	}
+
+	var ops []deltaOp
+	var literal int64
+	addLiteral := func(start, end int64) {
+		if end <= start {
+			return
+		}
+		literal += end - start
+		if last := len(ops) - 1; last >= 0 && ops[last].Type == "data" && ops[last].Offset+ops[last].Size == start {
+			ops[last].Size += end - start
+			return
+		}
+		ops = append(ops, deltaOp{Type: "data", Offset: start, Size: end - start})
+	}
+	addCopy := func(block int64) {
+		if last := len(ops) - 1; last >= 0 && ops[last].Type == "copy" && ops[last].Block+ops[last].Count == block {
+			ops[last].Count++
+			return
+		}
+		ops = append(ops, deltaOp{Type: "copy", Block: block, Count: 1})
+	}
+
+	reader := bufio.NewReader(r)
+	window := make([]byte, blockSize)
+	ordered := make([]byte, blockSize)
+	var pos, literalStart int64
+	for {
+		// 窗口从 pos 开始，填满一块后开始滚动
+		if _, err := io.ReadFull(reader, window); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, 0, err
+		}
+		sum := newRollingChecksum(window)
+		head := int64(0)
+		matched := false
+		for {
+			if candidates, ok := index[sum.value()]; ok {
+				copy(ordered, window[head:])
+				copy(ordered[blockSize-head:], window[:head])
+				strong := strongChecksum(ordered)
+				for _, block := range candidates {
+					if signatures[block].Strong == strong {
+						addLiteral(literalStart, pos)
+						addCopy(block)
+						pos += blockSize
+						literalStart = pos
+						matched = true
+						break
+					}
+				}
+				if matched {
+					break
+				}
+			}
+			c, err := reader.ReadByte()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, 0, err
+			}
+			out := window[head]
+			window[head] = c
+			head = (head + 1) % blockSize
+			sum.roll(out, c)
+			pos++
+		}
+		if !matched {
+			break
+		}
+	}
+	addLiteral(literalStart, size)
+	return ops, literal, nil
+}
+
+// deltaWorthwhile 判断增量是否比完整传输小
+func deltaWorthwhile(ops []deltaOp, literal, size int64) bool {
+	return literal+int64(len(ops))*deltaOpOverhead < size
+}
+
+// deltaEnabled 判断文件是否尝试增量传输
+func (p *FileTransferPlugin) deltaEnabled(size int64) bool {
+	return plugin.ConfigBool(p.config, "delta_enabled", true) && size >= int64(plugin.ConfigInt(p.config, "delta_min_size", defaultDeltaMinSize))
+}
+
+// parseSignatures 解析服务器返回的块校验和
+func parseSignatures(value interface{}) []blockSignature {
+	items, _ := value.([]interface{})
+	signatures := make([]blockSignature, 0, len(items))
+	for _, item := range items {
+		fields, _ := item.(map[string]interface{})
+		weak, ok := toInt64(fields["weak"])
+		strong, _ := fields["strong"].(string)
+		if !ok || strong == "" {
+			return nil
+		}
+		signatures = append(signatures, blockSignature{Weak: uint32(weak), Strong: strong})
+	}
+	return signatures
+}
+
+// parseDeltaOps 解析服务器返回的操作列表，并检查操作覆盖的长度与文件大小一致
+func parseDeltaOps(value interface{}, size, blockSize int64, blocks int) ([]deltaOp, error) {
+	items, _ := value.([]interface{})
+	ops := make([]deltaOp, 0, len(items))
+	var covered int64
+	for _, item := range items {
+		fields, _ := item.(map[string]interface{})
+		op := deltaOp{}
+		op.Type, _ = fields["type"].(string)
+		op.Block, _ = toInt64(fields["block"])
+		op.Count, _ = toInt64(fields["count"])
+		op.Offset, _ = toInt64(fields["offset"])
+		op.Size, _ = toInt64(fields["size"])
+		switch {
+		case op.Type == "copy" && op.Block >= 0 && op.Count > 0 && op.Block+op.Count <= int64(blocks):
+			covered += op.Count * blockSize
+		case op.Type == "data" && op.Offset == covered && op.Size > 0:
+			covered += op.Size
+		default:
+			return nil, fmt.Errorf("invalid delta operation %v", fields)
+		}
+		ops = append(ops, op)
+	}
+	if covered != size {
+		return nil, fmt.Errorf("delta covers %d bytes, expected %d", covered, size)
+	}
+	return ops, nil
+}
+
+// uploadDelta 服务器已有旧文件且增量更小时只上传变化的数据，返回 false 表示需要完整上传
+func (p *FileTransferPlugin) uploadDelta(transfer *TransferInfo, f *os.File, size int64, hash *runningHash, retry *retrier, stop <-chan struct{}) (bool, error) {
+	blockSize := deltaBlockSize(size)
+	resp, err := p.callServer("file_upload_signatures", map[string]interface{}{
+		"transfer_id": transfer.ID,
+		"destination": transfer.Destination,
+		"block_size":  blockSize,
+	})
+	if err != nil {
+		p.ctx.Logger.Debugf("Delta upload not available for %s: %v", transfer.ID, err)
+		return false, nil
+	}
+	signatures := parseSignatures(resp["blocks"])
+	if len(signatures) == 0 {
+		return false, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	ops, literal, err := computeDelta(f, size, blockSize, signatures)
+	if err != nil {
+		return false, err
+	}
+	if !deltaWorthwhile(ops, literal, size) {
+		return false, nil
+	}
+
+	p.mu.Lock()
+	transfer.Delta = true
+	transfer.LiteralBytes = literal
+	p.mu.Unlock()
+
+	if err := p.callWithRetry(retry, "file_upload_delta", map[string]interface{}{
+		"transfer_id": transfer.ID,
+		"destination": transfer.Destination,
+		"size":        size,
+		"block_size":  blockSize,
+		"ops":         ops,
+	}); err != nil {
+		return true, err
+	}
+
+	// 按块上传 data 操作的数据，copy 操作直接计入进度
+	buf := make([]byte, transfer.ChunkSize)
+	var index int64
+	for _, op := range ops {
+		if op.Type == "copy" {
+			continue
+		}
+		for offset := op.Offset; offset < op.Offset+op.Size; offset += transfer.ChunkSize {
+			select {
+			case <-stop:
+				return true, errTransferStopped
+			default:
+			}
+			data := buf[:min(transfer.ChunkSize, op.Offset+op.Size-offset)]
+			if _, err := f.ReadAt(data, offset); err != nil {
+				return true, err
+			}
+			if err := hash.update(offset, data); err != nil {
+				return true, err
+			}
+			if err := p.throttle(transfer, len(data), stop); err != nil {
+				return true, err
+			}
+			if err := p.callWithRetry(retry, "file_upload_chunk", map[string]interface{}{
+				"transfer_id": transfer.ID,
+				"index":       index,
+				"offset":      offset,
+				"data":        base64.StdEncoding.EncodeToString(data),
+				"checksum":    chunkChecksum(data),
+			}); err != nil {
+				return true, err
+			}
+			index++
+			p.reportProgress(transfer, offset+int64(len(data)))
+		}
+	}
+	return true, p.completeUpload(transfer, hash, size, true, retry)
+}
+
+// downloadDelta 本地已有旧文件时请求增量，只下载变化的数据写入 part，返回 false 表示需要完整下载
+func (p *FileTransferPlugin) downloadDelta(transfer *TransferInfo, fsys plugin.FileSystem, part *os.File, size int64, hash *runningHash, retry *retrier, stop <-chan struct{}) (bool, error) {
+	old, err := fsys.OpenFile(p.downloadTarget(transfer), os.O_RDONLY, 0)
+	if err != nil {
+		return false, nil
+	}
+	defer old.Close()
+
+	blockSize := deltaBlockSize(size)
+	signatures, err := computeSignatures(old, blockSize)
+	if err != nil || len(signatures) == 0 {
+		return false, err
+	}
+	resp, err := p.callServer("file_download_delta", map[string]interface{}{
+		"transfer_id": transfer.ID,
+		"source":      transfer.Source,
+		"block_size":  blockSize,
+		"blocks":      signatures,
+	})
+	if err != nil {
+		p.ctx.Logger.Debugf("Delta download not available for %s: %v", transfer.ID, err)
+		return false, nil
+	}
+	if full, _ := resp["full"].(bool); full {
+		return false, nil
+	}
+	ops, err := parseDeltaOps(resp["ops"], size, blockSize, len(signatures))
+	if err != nil {
+		return false, err
+	}
+
+	var literal int64
+	for _, op := range ops {
+		if op.Type == "data" {
+			literal += op.Size
+		}
+	}
+	p.mu.Lock()
+	transfer.Delta = true
+	transfer.LiteralBytes = literal
+	p.mu.Unlock()
+
+	var offset, index int64
+	for _, op := range ops {
+		select {
+		case <-stop:
+			return true, errTransferStopped
+		default:
+		}
+		if op.Type == "copy" {
+			length := op.Count * blockSize
+			copied := io.NewSectionReader(old, op.Block*blockSize, length)
+			if _, err := io.Copy(io.MultiWriter(io.NewOffsetWriter(part, offset), hash.writerAt(offset)), copied); err != nil {
+				return true, err
+			}
+			offset += length
+			p.reportProgress(transfer, offset)
+			continue
+		}
+		for end := op.Offset + op.Size; offset < end; {
+			want := min(transfer.ChunkSize, end-offset)
+			if err := p.throttle(transfer, int(want), stop); err != nil {
+				return true, err
+			}
+			data, err := p.downloadChunk(transfer, index, offset, want)
+			if err != nil {
+				if err := retry.wait(err); err != nil {
+					return true, err
+				}
+				continue
+			}
+			retry.reset()
+			if _, err := part.WriteAt(data, offset); err != nil {
+				return true, err
+			}
+			if err := hash.update(offset, data); err != nil {
+				return true, err
+			}
+			index++
+			offset += want
+			p.reportProgress(transfer, offset)
+		}
+	}
+	return true, nil
+}
+
+// callWithRetry 调用服务器，失败时按重试策略重试
+func (p *FileTransferPlugin) callWithRetry(retry *retrier, msgType string, data map[string]interface{}) error {
+	for {
+		_, err := p.callServer(msgType, data)
+		if err == nil {
+			retry.reset()
+			return nil
+		}
+		if err := retry.wait(err); err != nil {
+			return err
+		}
+	}
+}
@@ -1,9 +1,7 @@
 package filetransfer
 
 import (
-	"crypto/md5"
 	"crypto/rand"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -21,22 +19,53 @@ type FileTransferPlugin struct {
 	transfers map[string]*TransferInfo
 	mu        sync.RWMutex
 	stopChan  chan struct{}
+	limiter   *rateLimiter // rate_limit 全局限速，所有传输共享
+	stateFile string       // 暂停的传输保存位置
+	tempDir   string       // 打包和解压使用的临时压缩包位置
+	queue     []*transferJob
+	running   int  // 正在执行的传输数，不超过 max_concurrent
+	started   bool // 插件停止期间排队的传输不执行
+	saveMu    sync.Mutex
 }
 
 // TransferInfo 传输信息
 type TransferInfo struct {
-	ID          string    `json:"id"`
-	Type        string    `json:"type"` // upload, download
-	Source      string    `json:"source"`
-	Destination string    `json:"destination"`
-	Size        int64     `json:"size"`
-	Transferred int64     `json:"transferred"`
-	Status      string    `json:"status"` // pending, running, completed, failed
-	Progress    float64   `json:"progress"`
-	StartTime   time.Time `json:"start_time"`
-	EndTime     time.Time `json:"end_time"`
-	Error       string    `json:"error,omitempty"`
-	MD5         string    `json:"md5,omitempty"`
+	ID             string       `json:"id"`
+	Type           string       `json:"type"` // upload, download, sync
+	Source         string       `json:"source"`
+	Destination    string       `json:"destination"`
+	Size           int64        `json:"size"`
+	Transferred    int64        `json:"transferred"`
+	Status         string       `json:"status"`                   // pending, queued, running, waiting, paused, completed, failed, cancelled
+	Priority       int          `json:"priority,omitempty"`       // 排队时优先级高的先执行
+	QueuePosition  int          `json:"queue_position,omitempty"` // 排队位置，从 1 开始
+	Progress       float64      `json:"progress"`
+	StartTime      time.Time    `json:"start_time"`
+	EndTime        time.Time    `json:"end_time"`
+	Error          string       `json:"error,omitempty"`
+	SHA256         string       `json:"sha256,omitempty"`
+	ExpectedSHA256 string       `json:"expected_sha256,omitempty"` // 请求中期望的 SHA-256，不一致时传输失败
+	Signature      string       `json:"signature,omitempty"`       // 对文件 SHA-256 摘要的 Ed25519 分离签名（base64）
+	Verified       bool         `json:"verified,omitempty"`        // 期望的 SHA-256 或签名已校验通过
+	ChunkSize      int64        `json:"chunk_size,omitempty"`
+	Chunks         int64        `json:"chunks,omitempty"`
+	Retries        int          `json:"retries,omitempty"`       // 连接中断等原因导致的重试次数
+	Delta          bool         `json:"delta,omitempty"`         // 是否为增量传输
+	LiteralBytes   int64        `json:"literal_bytes,omitempty"` // 增量传输实际传输的字节数，其余内容从旧文件复制
+	RateLimit      int64        `json:"rate_limit,omitempty"`    // 单个传输的限速（KB/s）
+	Windows        string       `json:"windows,omitempty"`       // 允许传输的时间段，覆盖 transfer_windows 配置
+	Throughput     float64      `json:"throughput"`              // 传输中为当前速度，结束后为平均速度（字节/秒）
+	Sync           *SyncOptions `json:"sync,omitempty"`          // 同步选项，暂停后继续时重新生成同步计划
+	Archive        string       `json:"archive,omitempty"`       // 上传前打包或下载后解压的格式：tar.gz、zip
+	Extract        bool         `json:"extract,omitempty"`       // 下载完成后解压到 destination 目录
+
+	progressAt      time.Time // 上次发送 transfer_progress 事件的时间
+	limiter         *rateLimiter
+	throughputAt    time.Time // 上次计算吞吐量的时间和当时已传输的字节数
+	throughputBytes int64
+	stop            chan struct{} // 关闭时中止传输
+	interrupted     string        // 中止原因：paused、cancelled、stopped
+	counted         int64         // 已计入 bytes_transferred 统计的字节数，暂停后继续时只累加新传输的部分
 }
 
 // TransferRequest 传输请求
@@ -75,9 +104,53 @@ func (p *FileTransferPlugin) Info() *plugin.PluginInfo {
 		Homepage:    "https://github.com/assistant-agent/plugins",
 		Tags:        []string{"file", "transfer", "sync"},
 		Config: map[string]string{
+			// 同时执行的传输数，其余传输按 priority 排队
 			"max_concurrent": "5",
-			"chunk_size":     "8192",
-			"retry_count":    "3",
+			// 与服务器之间按块传输，每块单独校验和确认，连续失败 retry_count 次后放弃
+			"chunk_size":        "262144",
+			"retry_count":       "3",
+			"retry_delay":       "2s",
+			"progress_interval": "1s",
+			// 不小于 delta_min_size 的文件在对方已有旧版本时只传输变化的块
+			"delta_enabled":  "true",
+			"delta_min_size": "1048576",
+			// rate_limit 为所有传输共享的限速（KB/s，0 不限速），transfer_windows 为允许传输的时间段，
+			// 如 "22:00-06:00"，之外的时间传输暂停等待
+			"rate_limit":       "0",
+			"transfer_windows": "",
+			// 打包上传的文件总大小上限，以及下载后解压的总大小和文件数上限（防止压缩炸弹）
+			"max_archive_size":  "1073741824",
+			"max_extract_size":  "4294967296",
+			"max_extract_files": "100000",
+			// 校验传输参数 signature 的 Ed25519 公钥（base64）
+			"signing_public_key": "",
+			// 远程存储（s3://、gs://、azure://、sftp://）的凭据，不小于 multipart_threshold 的对象
+			// 按 multipart_part_size 分段上传
+			"multipart_threshold":         "67108864",
+			"multipart_part_size":         "16777216",
+			"s3_region":                   "us-east-1",
+			"s3_endpoint":                 "",
+			"s3_access_key_id":            "",
+			"s3_secret_access_key":        "",
+			"s3_session_token":            "",
+			"gcs_access_key_id":           "",
+			"gcs_secret_access_key":       "",
+			"azure_account":               "",
+			"azure_account_key":           "",
+			"azure_sas_token":             "",
+			"azure_endpoint":              "",
+			"sftp_user":                   "",
+			"sftp_password":               "",
+			"sftp_private_key":            "",
+			"sftp_private_key_passphrase": "",
+			"sftp_known_hosts":            "",
+			"sftp_host_key":               "",
+		},
+		// 默认只能访问 Agent 的工作、临时和数据目录，其他目录通过 security.plugin_permissions 配置
+		Permissions: &plugin.PluginPermissions{
+			ReadPaths:  []string{plugin.PathWorkDir, plugin.PathTempDir, plugin.PathDataDir},
+			WritePaths: []string{plugin.PathWorkDir, plugin.PathTempDir, plugin.PathDataDir},
+			Server:     true,
 		},
 	}
 }
@@ -87,12 +160,37 @@ func (p *FileTransferPlugin) Init(ctx *plugin.PluginContext) error {
 	p.ctx = ctx
 	p.status.Status = "initialized"
 
+	// 暂停的传输保存在数据目录中
+	dataDir, _ := ctx.Agent.GetConfig("agent.data_dir").(string)
+	p.stateFile = pausedTransfersPath(dataDir)
+	if p.tempDir, _ = ctx.Agent.GetConfig("agent.temp_dir").(string); p.tempDir == "" {
+		p.tempDir = os.TempDir()
+	}
+	if err := p.loadPausedTransfers(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load paused transfers: %v", err)
+	}
+
+	// 其他插件通过 file_upload_requested 事件请求上传文件（如密码库备份）
+	if ctx.Events != nil {
+		if err := ctx.Events.Subscribe("file_upload_requested"); err != nil {
+			return err
+		}
+	}
+
 	p.ctx.Logger.Info("File transfer plugin initialized")
 	return nil
 }
 
 // Start 启动插件
 func (p *FileTransferPlugin) Start() error {
+	// 修改配置后插件会被重启，每次启动使用新的停止信号
+	p.mu.Lock()
+	p.stopChan = make(chan struct{})
+	p.limiter = newRateLimiter(int64(plugin.ConfigInt(p.config, "rate_limit", 0)))
+	p.started = true
+	p.dispatchLocked()
+	p.mu.Unlock()
+
 	p.status.Status = "running"
 	p.status.StartTime = time.Now()
 
@@ -100,10 +198,13 @@ func (p *FileTransferPlugin) Start() error {
 	return nil
 }
 
-// Stop 停止插件
+// Stop 停止插件，进行中的传输立即中止，排队的传输在插件再次启动后执行
 func (p *FileTransferPlugin) Stop() error {
 	p.status.Status = "stopped"
+	p.mu.Lock()
+	p.started = false
 	close(p.stopChan)
+	p.mu.Unlock()
 
 	p.ctx.Logger.Info("File transfer plugin stopped")
 	return nil
@@ -122,6 +223,10 @@ func (p *FileTransferPlugin) HandleCommand(command string, args map[string]inter
 		return p.handleStatus(args)
 	case "cancel":
 		return p.handleCancel(args)
+	case "pause":
+		return p.handlePause(args)
+	case "resume":
+		return p.handleResume(args)
 	case "sync":
 		return p.handleSync(args)
 	default:
@@ -129,6 +234,48 @@ func (p *FileTransferPlugin) HandleCommand(command string, args map[string]inter
 	}
 }
 
+// CommandSchemas 返回命令参数声明，插件管理器据此校验参数
+func (p *FileTransferPlugin) CommandSchemas() map[string]*plugin.CommandSchema {
+	return fileTransferCommandSchemas
+}
+
+var (
+	serverTransferArgs = map[string]plugin.ArgSchema{
+		"source":      {Type: plugin.ArgString, Required: true},
+		"destination": {Type: plugin.ArgString, Required: true},
+		"chunk_size":  {Type: plugin.ArgInteger, Description: "块大小（字节），默认使用 chunk_size 配置"},
+		"rate_limit":  {Type: plugin.ArgInteger, Description: "限速（KB/s），与全局 rate_limit 同时生效"},
+		"windows":     {Type: plugin.ArgString, Description: "允许传输的时间段，如 22:00-06:00"},
+		"priority":    {Type: plugin.ArgInteger, Description: "排队时优先级高的先执行"},
+		"sha256":      {Type: plugin.ArgString, Description: "期望的 SHA-256，不一致时传输失败"},
+		"signature":   {Type: plugin.ArgString, Description: "对文件 SHA-256 摘要的 Ed25519 签名（base64），使用 signing_public_key 校验"},
+		"archive":     {Type: plugin.ArgString, Description: "上传时把 source 打包为 tar.gz 或 zip；下载时指定解压格式，默认按 source 扩展名判断"},
+		"extract":     {Type: plugin.ArgBool, Default: false, Description: "下载完成后解压到 destination 目录"},
+	}
+	syncArgs = map[string]plugin.ArgSchema{
+		"source":      {Type: plugin.ArgString, Required: true},
+		"destination": {Type: plugin.ArgString, Required: true},
+		"include":     {Type: plugin.ArgArray, Description: "只同步匹配的文件，如 [\"*.conf\", \"nginx/**\"]"},
+		"exclude":     {Type: plugin.ArgArray, Description: "跳过匹配的文件和目录"},
+		"delete":      {Type: plugin.ArgBool, Default: false, Description: "删除目标目录中源目录没有的文件"},
+		"dry_run":     {Type: plugin.ArgBool, Default: false, Description: "只返回同步计划，不复制文件"},
+		"rate_limit":  {Type: plugin.ArgInteger, Description: "限速（KB/s），与全局 rate_limit 同时生效"},
+		"windows":     {Type: plugin.ArgString, Description: "允许传输的时间段，如 22:00-06:00"},
+		"priority":    {Type: plugin.ArgInteger, Description: "排队时优先级高的先执行"},
+	}
+	transferIDArgs = map[string]plugin.ArgSchema{"id": {Type: plugin.ArgString, Required: true}}
+
+	fileTransferCommandSchemas = map[string]*plugin.CommandSchema{
+		"upload":   {Args: serverTransferArgs},
+		"download": {Args: serverTransferArgs},
+		"sync":     {Args: syncArgs},
+		"status":   {Args: transferIDArgs},
+		"cancel":   {Args: transferIDArgs},
+		"pause":    {Args: transferIDArgs},
+		"resume":   {Args: transferIDArgs},
+	}
+)
+
 // HandleEvent 处理事件
 func (p *FileTransferPlugin) HandleEvent(eventType string, data map[string]interface{}) error {
 	switch eventType {
@@ -138,6 +285,8 @@ func (p *FileTransferPlugin) HandleEvent(eventType string, data map[string]inter
 		return p.handleTransferFailed(data)
 	case "disk_space_low":
 		return p.handleDiskSpaceLow(data)
+	case "file_upload_requested":
+		return p.handleUploadRequested(data)
 	default:
 		return plugin.ErrInvalidEvent
 	}
@@ -152,15 +301,19 @@ func (p *FileTransferPlugin) Status() *plugin.PluginStatus {
 
 	activeCount := 0
 	var totalBytes int64
+	var throughput float64
 	for _, transfer := range p.transfers {
 		if transfer.Status == "running" {
 			activeCount++
+			throughput += transfer.Throughput
 		}
 		totalBytes += transfer.Transferred
 	}
 
 	p.status.Metrics["active_transfers"] = activeCount
+	p.status.Metrics["queued_transfers"] = len(p.queue)
 	p.status.Metrics["total_bytes"] = totalBytes
+	p.status.Metrics["throughput"] = throughput
 
 	return p.status
 }
@@ -184,7 +337,20 @@ func (p *FileTransferPlugin) SetConfig(config map[string]interface{}) error {
 	return nil
 }
 
-// handleUpload 处理上传命令
+// ValidateConfig 校验传输时间段和限速配置
+func (p *FileTransferPlugin) ValidateConfig(config map[string]interface{}) error {
+	if value, ok := config["transfer_windows"].(string); ok {
+		if _, err := parseWindows(value); err != nil {
+			return err
+		}
+	}
+	if plugin.ConfigInt(config, "rate_limit", 0) < 0 {
+		return fmt.Errorf("rate_limit must not be negative")
+	}
+	return nil
+}
+
+// handleUpload 处理上传命令，将本地文件上传到服务器或远程存储的 destination
 func (p *FileTransferPlugin) handleUpload(args map[string]interface{}) (interface{}, error) {
 	source, ok := args["source"].(string)
 	if !ok {
@@ -197,55 +363,38 @@ func (p *FileTransferPlugin) handleUpload(args map[string]interface{}) (interfac
 	}
 
 	// 检查源文件是否存在
-	if !p.ctx.Agent.FileExists(source) {
+	fs, err := plugin.AgentFS(p.ctx.Agent)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := fs.Stat(source)
+	if err != nil {
 		return nil, fmt.Errorf("source file does not exist: %s", source)
 	}
+	// 目录需要打包后上传
+	size := fileInfo.Size()
+	if archive, _ := args["archive"].(string); archive != "" {
+		size = 0
+	} else if fileInfo.IsDir() {
+		return nil, fmt.Errorf("source is a directory: %s", source)
+	}
 
-	// 获取文件信息
-	fileInfo, err := os.Stat(source)
+	// 远程存储 URL 直接与存储服务传输
+	perform, err := p.performer("upload", source, destination)
 	if err != nil {
 		return nil, err
 	}
 
-	// 创建传输信息
-	transferID := p.generateID()
-	transfer := &TransferInfo{
-		ID:          transferID,
-		Type:        "upload",
-		Source:      source,
-		Destination: destination,
-		Size:        fileInfo.Size(),
-		Status:      "pending",
-		StartTime:   time.Now(),
+	transfer, err := p.newTransfer("upload", source, destination, size, args)
+	if err != nil {
+		return nil, err
 	}
+	p.startTransfer(transfer, perform)
 
-	// 添加到传输列表
-	p.mu.Lock()
-	p.transfers[transferID] = transfer
-	p.mu.Unlock()
-
-	// 异步执行上传
-	go func() {
-		if err := p.performUpload(transfer); err != nil {
-			transfer.Status = "failed"
-			transfer.Error = err.Error()
-			p.ctx.Logger.Errorf("Upload failed: %v", err)
-		} else {
-			transfer.Status = "completed"
-			transfer.Progress = 100.0
-			p.ctx.Logger.Infof("Upload completed: %s", source)
-		}
-		transfer.EndTime = time.Now()
-	}()
-
-	return map[string]interface{}{
-		"id":      transferID,
-		"status":  "started",
-		"message": "Upload started",
-	}, nil
+	return p.startResult(transfer, "Upload started"), nil
 }
 
-// handleDownload 处理下载命令
+// handleDownload 处理下载命令，将服务器或远程存储上的 source 下载到本地 destination
 func (p *FileTransferPlugin) handleDownload(args map[string]interface{}) (interface{}, error) {
 	source, ok := args["source"].(string)
 	if !ok {
@@ -257,41 +406,210 @@ func (p *FileTransferPlugin) handleDownload(args map[string]interface{}) (interf
 		return nil, fmt.Errorf("destination is required")
 	}
 
-	// 创建传输信息
-	transferID := p.generateID()
+	// 远程存储 URL 直接与存储服务传输
+	perform, err := p.performer("download", source, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer, err := p.newTransfer("download", source, destination, 0, args)
+	if err != nil {
+		return nil, err
+	}
+	p.startTransfer(transfer, perform)
+
+	return p.startResult(transfer, "Download started"), nil
+}
+
+// newTransfer 创建传输信息并加入传输列表，size 未知时为 0
+func (p *FileTransferPlugin) newTransfer(transferType, source, destination string, size int64, args map[string]interface{}) (*TransferInfo, error) {
+	chunkSize := int64(plugin.ConfigInt(p.config, "chunk_size", defaultChunkSize))
+	if v, ok := toInt64(args["chunk_size"]); ok {
+		chunkSize = v
+	}
+	if chunkSize <= 0 || chunkSize > maxChunkSize {
+		chunkSize = defaultChunkSize
+	}
+	expectedSHA256, signature, err := p.parseIntegrityArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	archive, extract, err := parseArchiveArgs(transferType, source, args)
+	if err != nil {
+		return nil, err
+	}
+	rateLimit, _ := toInt64(args["rate_limit"])
+	priority, _ := toInt64(args["priority"])
+	windows, _ := args["windows"].(string)
+	if _, err := parseWindows(windows); err != nil {
+		return nil, err
+	}
+
 	transfer := &TransferInfo{
-		ID:          transferID,
-		Type:        "download",
-		Source:      source,
-		Destination: destination,
-		Status:      "pending",
-		StartTime:   time.Now(),
+		ID:             p.generateID(),
+		Type:           transferType,
+		Source:         source,
+		Destination:    destination,
+		Size:           size,
+		Status:         "pending",
+		StartTime:      time.Now(),
+		ChunkSize:      chunkSize,
+		RateLimit:      rateLimit,
+		Priority:       int(priority),
+		Windows:        windows,
+		limiter:        newRateLimiter(rateLimit),
+		ExpectedSHA256: expectedSHA256,
+		Signature:      signature,
+		Archive:        archive,
+		Extract:        extract,
 	}
 
 	// 添加到传输列表
 	p.mu.Lock()
-	p.transfers[transferID] = transfer
+	p.transfers[transfer.ID] = transfer
 	p.mu.Unlock()
+	return transfer, nil
+}
+
+// startTransfer 把传输加入队列，max_concurrent 名额空闲时在后台执行，传输已在排队或执行时返回 false
+func (p *FileTransferPlugin) startTransfer(transfer *TransferInfo, perform performFunc) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if transfer.active() || transfer.Status == "queued" {
+		return false
+	}
+	transfer.interrupted = ""
+	transfer.Status = "queued"
+	transfer.Error = ""
+	p.enqueueLocked(&transferJob{transfer: transfer, perform: perform})
+	return true
+}
+
+// launchLocked 在后台执行传输，插件停止、取消或暂停时关闭传输的 stop 中止 I/O，
+// 结束后释放名额并执行下一个排队的传输，调用方需持有 p.mu
+func (p *FileTransferPlugin) launchLocked(job *transferJob) {
+	transfer := job.transfer
+	pluginStop := p.stopChan
+	stop := make(chan struct{})
+	transfer.stop = stop
+	transfer.Status = "running"
+	transfer.throughputAt = time.Now()
 
-	// 异步执行下载
+	done := make(chan struct{})
 	go func() {
-		if err := p.performDownload(transfer); err != nil {
-			transfer.Status = "failed"
-			transfer.Error = err.Error()
-			p.ctx.Logger.Errorf("Download failed: %v", err)
-		} else {
-			transfer.Status = "completed"
-			transfer.Progress = 100.0
-			p.ctx.Logger.Infof("Download completed: %s", destination)
+		select {
+		case <-pluginStop:
+			p.mu.Lock()
+			transfer.interruptLocked("stopped")
+			p.mu.Unlock()
+		case <-done:
 		}
-		transfer.EndTime = time.Now()
 	}()
 
-	return map[string]interface{}{
-		"id":      transferID,
-		"status":  "started",
-		"message": "Download started",
-	}, nil
+	go func() {
+		err := job.perform(transfer, stop)
+		close(done)
+
+		p.mu.Lock()
+		p.running--
+		p.dispatchLocked()
+		p.mu.Unlock()
+		p.finishTransfer(transfer, err)
+	}()
+}
+
+// finishTransfer 更新结束的传输状态并发送 transfer_completed、transfer_failed、transfer_cancelled 或 transfer_paused 事件
+func (p *FileTransferPlugin) finishTransfer(transfer *TransferInfo, err error) {
+	p.mu.Lock()
+	eventType := "transfer_completed"
+	switch {
+	case err == nil:
+		transfer.Status = "completed"
+		transfer.Progress = 100.0
+	case transfer.interrupted == "paused":
+		transfer.Status = "paused"
+		eventType = "transfer_paused"
+	case transfer.interrupted == "cancelled":
+		transfer.Status = "cancelled"
+		eventType = "transfer_cancelled"
+	default:
+		transfer.Status = "failed"
+		transfer.Error = err.Error()
+		eventType = "transfer_failed"
+	}
+	transfer.stop = nil
+	if transfer.Status != "paused" {
+		transfer.EndTime = time.Now()
+		if elapsed := transfer.EndTime.Sub(transfer.StartTime).Seconds(); elapsed > 0 {
+			transfer.Throughput = float64(transfer.Transferred) / elapsed
+		}
+	}
+	event := transfer.snapshot()
+	transferred := transfer.Transferred - transfer.counted
+	transfer.counted = max(transfer.counted, transfer.Transferred)
+	p.mu.Unlock()
+
+	if stats, err := plugin.AgentStats(p.ctx.Agent); err == nil {
+		stats.IncCounter("transfers_"+transfer.Status, 1)
+		if transferred > 0 {
+			stats.IncCounter("bytes_transferred", float64(transferred))
+		}
+	}
+
+	switch eventType {
+	case "transfer_completed":
+		p.ctx.Logger.Infof("%s completed: %s -> %s", transfer.Type, transfer.Source, transfer.Destination)
+	case "transfer_failed":
+		p.ctx.Logger.Errorf("%s failed: %s: %v", transfer.Type, transfer.Source, err)
+	case "transfer_cancelled":
+		p.ctx.Logger.Infof("%s cancelled: %s", transfer.Type, transfer.Source)
+		p.cleanupTransfer(transfer)
+	case "transfer_paused":
+		p.ctx.Logger.Infof("%s paused: %s", transfer.Type, transfer.Source)
+		p.savePausedTransfers()
+	}
+	p.ctx.Agent.NotifyEvent(eventType, event)
+}
+
+// snapshot 返回用于事件的传输信息，调用方需持有 p.mu
+func (t *TransferInfo) snapshot() map[string]interface{} {
+	event := map[string]interface{}{
+		"id":          t.ID,
+		"type":        t.Type,
+		"source":      t.Source,
+		"destination": t.Destination,
+		"size":        t.Size,
+		"transferred": t.Transferred,
+		"progress":    t.Progress,
+		"status":      t.Status,
+		"throughput":  t.Throughput,
+	}
+	if t.Error != "" {
+		event["error"] = t.Error
+	}
+	return event
+}
+
+// reportProgress 更新已传输字节数，每隔 progress_interval 发送一次 transfer_progress 事件
+func (p *FileTransferPlugin) reportProgress(transfer *TransferInfo, transferred int64) {
+	p.mu.Lock()
+	transfer.Transferred = transferred
+	if transfer.Size > 0 {
+		transfer.Progress = float64(transferred) / float64(transfer.Size) * 100
+	}
+	now := time.Now()
+	transfer.updateThroughput(now)
+	interval := plugin.ConfigDuration(p.config, "progress_interval", defaultProgressInterval)
+	var event map[string]interface{}
+	if now.Sub(transfer.progressAt) >= interval || transferred == transfer.Size {
+		transfer.progressAt = now
+		event = transfer.snapshot()
+	}
+	p.mu.Unlock()
+
+	if event != nil {
+		p.ctx.Agent.NotifyEvent("transfer_progress", event)
+	}
 }
 
 // handleList 处理列表命令
@@ -299,9 +617,9 @@ func (p *FileTransferPlugin) handleList(args map[string]interface{}) (interface{
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	transfers := make([]*TransferInfo, 0, len(p.transfers))
+	transfers := make([]TransferInfo, 0, len(p.transfers))
 	for _, transfer := range p.transfers {
-		transfers = append(transfers, transfer)
+		transfers = append(transfers, *transfer)
 	}
 
 	return map[string]interface{}{
@@ -318,42 +636,18 @@ func (p *FileTransferPlugin) handleStatus(args map[string]interface{}) (interfac
 	}
 
 	p.mu.RLock()
-	transfer, exists := p.transfers[id]
-	p.mu.RUnlock()
-
-	if !exists {
-		return nil, fmt.Errorf("transfer not found")
-	}
-
-	return transfer, nil
-}
-
-// handleCancel 处理取消命令
-func (p *FileTransferPlugin) handleCancel(args map[string]interface{}) (interface{}, error) {
-	id, ok := args["id"].(string)
-	if !ok {
-		return nil, fmt.Errorf("id is required")
-	}
-
-	p.mu.Lock()
+	defer p.mu.RUnlock()
 	transfer, exists := p.transfers[id]
 	if !exists {
-		p.mu.Unlock()
 		return nil, fmt.Errorf("transfer not found")
 	}
 
-	if transfer.Status == "running" {
-		transfer.Status = "cancelled"
-	}
-	p.mu.Unlock()
-
-	return map[string]interface{}{
-		"id":      id,
-		"message": "Transfer cancelled",
-	}, nil
+	// 返回副本，传输仍在后台更新
+	result := *transfer
+	return &result, nil
 }
 
-// handleSync 处理同步命令
+// handleSync 处理同步命令，先生成同步计划，dry_run 时只返回计划
 func (p *FileTransferPlugin) handleSync(args map[string]interface{}) (interface{}, error) {
 	source, ok := args["source"].(string)
 	if !ok {
@@ -365,92 +659,41 @@ func (p *FileTransferPlugin) handleSync(args map[string]interface{}) (interface{
 		return nil, fmt.Errorf("destination is required")
 	}
 
-	// 执行同步
-	go func() {
-		if err := p.performSync(source, destination); err != nil {
-			p.ctx.Logger.Errorf("Sync failed: %v", err)
-		} else {
-			p.ctx.Logger.Infof("Sync completed: %s -> %s", source, destination)
-		}
-	}()
-
-	return map[string]interface{}{
-		"status":  "started",
-		"message": "Sync started",
-	}, nil
-}
-
-// performUpload 执行上传
-func (p *FileTransferPlugin) performUpload(transfer *TransferInfo) error {
-	transfer.Status = "running"
-
-	// 读取源文件
-	sourceData, err := p.ctx.Agent.ReadFile(transfer.Source)
-	if err != nil {
-		return err
+	opts := &SyncOptions{
+		Include: stringList(args["include"]),
+		Exclude: stringList(args["exclude"]),
 	}
-
-	transfer.Size = int64(len(sourceData))
-
-	// 写入目标文件
-	if err := p.ctx.Agent.WriteFile(transfer.Destination, sourceData); err != nil {
-		return err
+	opts.Delete, _ = args["delete"].(bool)
+	opts.DryRun, _ = args["dry_run"].(bool)
+	if err := opts.validate(); err != nil {
+		return nil, err
 	}
 
-	transfer.Transferred = transfer.Size
-	transfer.Progress = 100.0
-
-	// 计算MD5
-	hash := md5.Sum(sourceData)
-	transfer.MD5 = hex.EncodeToString(hash[:])
-
-	return nil
-}
-
-// performDownload 执行下载
-func (p *FileTransferPlugin) performDownload(transfer *TransferInfo) error {
-	transfer.Status = "running"
-
-	// 读取源文件
-	sourceData, err := p.ctx.Agent.ReadFile(transfer.Source)
+	fs, err := plugin.AgentFS(p.ctx.Agent)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	transfer.Size = int64(len(sourceData))
-
-	// 写入目标文件
-	if err := p.ctx.Agent.WriteFile(transfer.Destination, sourceData); err != nil {
-		return err
+	plan, err := planSync(fs, source, destination, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	transfer.Transferred = transfer.Size
-	transfer.Progress = 100.0
-
-	// 计算MD5
-	hash := md5.Sum(sourceData)
-	transfer.MD5 = hex.EncodeToString(hash[:])
-
-	return nil
-}
-
-// performSync 执行同步
-func (p *FileTransferPlugin) performSync(source, destination string) error {
-	// 简单的文件同步实现
-	// 这里可以实现更复杂的同步逻辑，如增量同步、目录同步等
-
-	if !p.ctx.Agent.FileExists(source) {
-		return fmt.Errorf("source does not exist: %s", source)
+	if opts.DryRun {
+		return map[string]interface{}{
+			"dry_run": true,
+			"plan":    plan,
+		}, nil
 	}
 
-	// 读取源文件
-	sourceData, err := p.ctx.Agent.ReadFile(source)
+	transfer, err := p.newTransfer("sync", source, destination, plan.Bytes, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	transfer.Sync = opts
+	p.startTransfer(transfer, p.syncPerformer(opts, plan))
 
-	// 写入目标文件
-	return p.ctx.Agent.WriteFile(destination, sourceData)
+	result := p.startResult(transfer, "Sync started")
+	result["plan"] = plan
+	return result, nil
 }
 
 // generateID 生成唯一ID
@@ -460,6 +703,31 @@ func (p *FileTransferPlugin) generateID() string {
 	return fmt.Sprintf("%x", b)
 }
 
+// stringList 将 JSON 数组转换为字符串列表，忽略非字符串元素
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok && s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// toInt64 将 JSON 数值转换为 int64
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
 // 事件处理方法
 func (p *FileTransferPlugin) handleTransferCompleted(data map[string]interface{}) error {
 	p.ctx.Logger.Info("Transfer completed event received")
@@ -471,6 +739,17 @@ func (p *FileTransferPlugin) handleTransferFailed(data map[string]interface{}) e
 	return nil
 }
 
+// handleUploadRequested 处理其他插件的上传请求，data 包含 source、destination 和 requester
+func (p *FileTransferPlugin) handleUploadRequested(data map[string]interface{}) error {
+	result, err := p.handleUpload(data)
+	if err != nil {
+		return err
+	}
+	requester, _ := data["requester"].(string)
+	p.ctx.Logger.Infof("Upload %v requested by %s", result.(map[string]interface{})["id"], requester)
+	return nil
+}
+
 func (p *FileTransferPlugin) handleDiskSpaceLow(data map[string]interface{}) error {
 	p.ctx.Logger.Info("Disk space low event received")
 	return nil
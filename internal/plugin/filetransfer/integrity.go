@@ -0,0 +1,160 @@
+package filetransfer
+
+import (
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// runningHash 在数据传输过程中按顺序累计文件的 SHA-256，不必在结束后重新读取整个文件；
+// 与远程存储传输时同时累计 MD5 供存储服务校验。重试导致重复的数据被跳过，
+// 跳过的区域（续传、增量复制的块）在需要时从 r 补读
+type runningHash struct {
+	sha256 hash.Hash
+	md5    hash.Hash // 不需要 MD5 时为 nil
+	w      io.Writer
+	r      io.ReaderAt
+	offset int64
+}
+
+func newRunningHash(r io.ReaderAt, withMD5 bool) *runningHash {
+	h := &runningHash{sha256: sha256.New(), r: r}
+	h.w = h.sha256
+	if withMD5 {
+		h.md5 = md5.New()
+		h.w = io.MultiWriter(h.sha256, h.md5)
+	}
+	return h
+}
+
+// update 加入文件 offset 处的数据
+func (h *runningHash) update(offset int64, data []byte) error {
+	if offset > h.offset {
+		if err := h.fill(offset); err != nil {
+			return err
+		}
+	}
+	if end := offset + int64(len(data)); end > h.offset {
+		h.w.Write(data[h.offset-offset:])
+		h.offset = end
+	}
+	return nil
+}
+
+// writerAt 返回从 offset 开始顺序加入数据的 Writer
+func (h *runningHash) writerAt(offset int64) io.Writer {
+	return &hashWriter{h: h, offset: offset}
+}
+
+type hashWriter struct {
+	h      *runningHash
+	offset int64
+}
+
+func (w *hashWriter) Write(b []byte) (int, error) {
+	if err := w.h.update(w.offset, b); err != nil {
+		return 0, err
+	}
+	w.offset += int64(len(b))
+	return len(b), nil
+}
+
+// fill 从 r 读取 [h.offset, end) 加入哈希
+func (h *runningHash) fill(end int64) error {
+	n, err := io.Copy(h.w, io.NewSectionReader(h.r, h.offset, end-h.offset))
+	h.offset += n
+	if err == nil && h.offset < end {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// finish 补齐到文件末尾 size
+func (h *runningHash) finish(size int64) error {
+	if h.offset < size {
+		return h.fill(size)
+	}
+	return nil
+}
+
+// sum 返回十六进制 SHA-256，调用前需要 finish
+func (h *runningHash) sum() string {
+	return hex.EncodeToString(h.sha256.Sum(nil))
+}
+
+// md5Digest 返回 MD5，调用前需要 finish
+func (h *runningHash) md5Digest() []byte {
+	return h.md5.Sum(nil)
+}
+
+// parseIntegrityArgs 解析传输参数中的 sha256（期望的 SHA-256）和 signature（base64 编码的 Ed25519 签名）
+func (p *FileTransferPlugin) parseIntegrityArgs(args map[string]interface{}) (string, string, error) {
+	expected, _ := args["sha256"].(string)
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if expected != "" {
+		if decoded, err := hex.DecodeString(expected); err != nil || len(decoded) != sha256.Size {
+			return "", "", fmt.Errorf("invalid sha256 %q", expected)
+		}
+	}
+	signature, _ := args["signature"].(string)
+	if signature != "" {
+		if _, err := p.signingKey(); err != nil {
+			return "", "", err
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(signature); err != nil || len(decoded) != ed25519.SignatureSize {
+			return "", "", fmt.Errorf("invalid signature")
+		}
+	}
+	return expected, signature, nil
+}
+
+// signingKey 返回 signing_public_key 配置的 Ed25519 公钥（base64）
+func (p *FileTransferPlugin) signingKey() (ed25519.PublicKey, error) {
+	encoded, _ := p.config["signing_public_key"].(string)
+	if encoded == "" {
+		return nil, fmt.Errorf("signing_public_key is not configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid signing_public_key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyIntegrity 补齐哈希后依次检查对方报告的 SHA-256（reported，未知时为空）、请求中期望的 SHA-256
+// 和分离签名（对文件 SHA-256 摘要的 Ed25519 签名），全部通过后记录到传输信息并返回 SHA-256
+func (p *FileTransferPlugin) verifyIntegrity(transfer *TransferInfo, h *runningHash, size int64, reported string) (string, error) {
+	if err := h.finish(size); err != nil {
+		return "", err
+	}
+	digest := h.sha256.Sum(nil)
+	sum := hex.EncodeToString(digest)
+	if reported != "" && !strings.EqualFold(reported, sum) {
+		return "", fmt.Errorf("sha256 mismatch: expected %s, got %s", reported, sum)
+	}
+	if transfer.ExpectedSHA256 != "" && transfer.ExpectedSHA256 != sum {
+		return "", fmt.Errorf("sha256 does not match the expected hash: expected %s, got %s", transfer.ExpectedSHA256, sum)
+	}
+	if transfer.Signature != "" {
+		key, err := p.signingKey()
+		if err != nil {
+			return "", err
+		}
+		signature, err := base64.StdEncoding.DecodeString(transfer.Signature)
+		if err != nil || !ed25519.Verify(key, digest, signature) {
+			return "", fmt.Errorf("signature verification failed")
+		}
+	}
+
+	p.mu.Lock()
+	transfer.SHA256 = sum
+	transfer.Verified = transfer.ExpectedSHA256 != "" || transfer.Signature != ""
+	p.mu.Unlock()
+	return sum, nil
+}
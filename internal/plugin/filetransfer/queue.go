@@ -0,0 +1,76 @@
+package filetransfer
+
+import (
+	"sort"
+
+	"assistant_agent/internal/plugin"
+)
+
+// defaultMaxConcurrent 同时执行的传输数，其余传输按优先级排队
+const defaultMaxConcurrent = 5
+
+// transferJob 排队等待执行的传输
+type transferJob struct {
+	transfer *TransferInfo
+	perform  performFunc
+}
+
+// enqueueLocked 按优先级把传输加入队列，优先级高的先执行，相同优先级先进先出，调用方需持有 p.mu
+func (p *FileTransferPlugin) enqueueLocked(job *transferJob) {
+	priority := job.transfer.Priority
+	i := sort.Search(len(p.queue), func(i int) bool { return p.queue[i].transfer.Priority < priority })
+	p.queue = append(p.queue, nil)
+	copy(p.queue[i+1:], p.queue[i:])
+	p.queue[i] = job
+	p.dispatchLocked()
+}
+
+// dequeueLocked 把传输移出队列，调用方需持有 p.mu
+func (p *FileTransferPlugin) dequeueLocked(transfer *TransferInfo) {
+	for i, job := range p.queue {
+		if job.transfer == transfer {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			break
+		}
+	}
+	transfer.QueuePosition = 0
+	p.renumberQueueLocked()
+}
+
+// dispatchLocked 在名额（max_concurrent）允许时依次执行队首的传输，插件停止期间不执行，调用方需持有 p.mu
+func (p *FileTransferPlugin) dispatchLocked() {
+	limit := max(1, plugin.ConfigInt(p.config, "max_concurrent", defaultMaxConcurrent))
+	for p.started && p.running < limit && len(p.queue) > 0 {
+		job := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		job.transfer.QueuePosition = 0
+		p.running++
+		p.launchLocked(job)
+	}
+	p.renumberQueueLocked()
+}
+
+// renumberQueueLocked 更新排队传输的位置（从 1 开始），调用方需持有 p.mu
+func (p *FileTransferPlugin) renumberQueueLocked() {
+	for i, job := range p.queue {
+		job.transfer.QueuePosition = i + 1
+	}
+}
+
+// startResult 返回开始传输的命令结果，名额已满时状态为 queued 并带排队位置
+func (p *FileTransferPlugin) startResult(transfer *TransferInfo, message string) map[string]interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := map[string]interface{}{
+		"id":      transfer.ID,
+		"status":  "started",
+		"message": message,
+	}
+	if transfer.Status == "queued" {
+		result["status"] = "queued"
+		result["queue_position"] = transfer.QueuePosition
+	}
+	return result
+}
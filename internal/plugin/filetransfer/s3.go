@@ -0,0 +1,336 @@
+package filetransfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Backend Amazon S3 及兼容服务（MinIO、GCS XML API 等）的后端，请求使用 AWS Signature Version 4 签名
+// 小于 threshold 的对象一次 PUT 上传，否则分段上传，每段都带 Content-MD5 由服务端校验
+type s3Backend struct {
+	client       *http.Client
+	endpoint     *url.URL // 为空时使用 AWS 虚拟主机风格地址 bucket.s3.region.amazonaws.com
+	bucket       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	partSize     int64
+	threshold    int64
+	now          func() time.Time
+}
+
+// newS3Backend 创建 S3 后端，endpoint 为空时使用 AWS 地址，否则使用路径风格访问
+func newS3Backend(client *http.Client, endpoint, bucket, region, accessKey, secretKey, sessionToken string) (*s3Backend, error) {
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("access key id and secret access key are required for bucket %s", bucket)
+	}
+	b := &s3Backend{
+		client:       client,
+		bucket:       bucket,
+		region:       region,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		partSize:     defaultMultipartPartSize,
+		threshold:    defaultMultipartThreshold,
+		now:          time.Now,
+	}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+		}
+		b.endpoint = u
+	}
+	return b, nil
+}
+
+// objectURL 返回对象地址
+func (b *s3Backend) objectURL(key string, query url.Values) *url.URL {
+	u := &url.URL{Scheme: "https", Host: b.bucket + ".s3." + b.region + ".amazonaws.com", Path: "/" + key}
+	if b.endpoint != nil {
+		u = &url.URL{Scheme: b.endpoint.Scheme, Host: b.endpoint.Host,
+			Path: strings.TrimSuffix(b.endpoint.Path, "/") + "/" + b.bucket + "/" + key}
+	}
+	u.RawQuery = query.Encode()
+	return u
+}
+
+// awsEscape 按 SigV4 规则编码，只保留非保留字符，path 为 true 时保留 /
+func awsEscape(s string, path bool) string {
+	var buf strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' || (path && c == '/') {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign 为请求添加 SigV4 签名，payloadHash 为请求体的 SHA-256
+func (b *s3Backend) sign(req *http.Request, payloadHash string) {
+	amzDate := b.now().UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if b.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", b.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-md5" || name == "content-type" || name == "range" {
+			headers[name] = strings.TrimSpace(values[0])
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, awsEscape(key, false)+"="+awsEscape(query.Get(key), false))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, true),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + b.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), date)
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.accessKey, scope, signedHeaders, signature))
+}
+
+// emptyPayloadHash 空请求体的 SHA-256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// do 签名并发送请求，非 2xx 响应转换为错误
+func (b *s3Backend) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, payloadHash string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	b.sign(req, payloadHash)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodHead {
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// etagMD5 从 ETag 中取 MD5，分段上传的对象 ETag 不是 MD5，返回空
+func etagMD5(etag string) string {
+	etag = strings.Trim(etag, `"`)
+	if len(etag) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return ""
+	}
+	return strings.ToLower(etag)
+}
+
+func (b *s3Backend) stat(ctx context.Context, key string) (remoteObject, error) {
+	resp, err := b.do(ctx, http.MethodHead, key, nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return remoteObject{}, err
+	}
+	resp.Body.Close()
+	return remoteObject{Size: resp.ContentLength, MD5: etagMD5(resp.Header.Get("ETag"))}, nil
+}
+
+func (b *s3Backend) open(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := b.do(ctx, http.MethodGet, key, nil, nil, 0, emptyPayloadHash, header)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("range request not supported")
+	}
+	return resp.Body, nil
+}
+
+// sectionHashes 计算 r 中一段数据的 SHA-256（十六进制）和 MD5（base64），用于签名和 Content-MD5
+func sectionHashes(r io.ReaderAt, offset, length int64) (string, string, error) {
+	sha, sum := sha256.New(), md5.New()
+	if _, err := io.Copy(io.MultiWriter(sha, sum), io.NewSectionReader(r, offset, length)); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(sha.Sum(nil)), base64.StdEncoding.EncodeToString(sum.Sum(nil)), nil
+}
+
+// putSection 上传一段数据，返回 ETag
+func (b *s3Backend) putSection(rt *remoteTransfer, key string, query url.Values, r io.ReaderAt, offset, length int64) (string, error) {
+	payloadHash, contentMD5, err := sectionHashes(r, offset, length)
+	if err != nil {
+		return "", err
+	}
+	var etag string
+	err = rt.do(func() error {
+		resp, err := b.do(rt.ctx, http.MethodPut, key, query, rt.body(r, offset, length), length, payloadHash,
+			http.Header{"Content-Md5": {contentMD5}})
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		etag = resp.Header.Get("ETag")
+		return nil
+	})
+	return etag, err
+}
+
+func (b *s3Backend) upload(rt *remoteTransfer, key string, r io.ReaderAt, size int64) error {
+	if size < b.threshold {
+		_, err := b.putSection(rt, key, nil, r, 0, size)
+		return err
+	}
+
+	// 分段上传：创建上传、逐段上传、提交，失败时中止上传释放已上传的分段
+	var uploadID string
+	if err := rt.do(func() error {
+		resp, err := b.do(rt.ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0, emptyPayloadHash, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+			return fmt.Errorf("invalid create multipart upload response: %v", err)
+		}
+		uploadID = result.UploadID
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []completedPart
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+b.partSize, number+1 {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		etag, err := b.putSection(rt, key, query, r, offset, min(b.partSize, size-offset))
+		if err != nil {
+			b.abort(key, uploadID)
+			return err
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	payloadHash := sha256.Sum256(body)
+	err = rt.do(func() error {
+		resp, err := b.do(rt.ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body),
+			int64(len(body)), hex.EncodeToString(payloadHash[:]), nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		// 提交失败时 S3 可能返回 200 和错误内容
+		var result struct {
+			XMLName xml.Name
+			Message string `xml:"Message"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+			return fmt.Errorf("complete multipart upload: %s", result.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		b.abort(key, uploadID)
+	}
+	return err
+}
+
+// abort 中止分段上传，传输可能已被停止，使用独立的超时
+func (b *s3Backend) abort(key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), serverCallTimeout)
+	defer cancel()
+	if resp, err := b.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0, emptyPayloadHash, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (b *s3Backend) close() error {
+	return nil
+}
@@ -0,0 +1,388 @@
+package filetransfer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// 与服务器之间的分块传输协议，均通过 CallServer 发起：
+//
+//	file_upload_init     {transfer_id, destination, size, chunk_size, chunks} -> {next_chunk}
+//	file_upload_chunk    {transfer_id, index, offset, data, checksum}         -> {next_chunk}
+//	file_upload_complete {transfer_id, destination, size, sha256}             -> {}
+//	file_download_init   {transfer_id, source, chunk_size}                    -> {size, sha256}
+//	file_download_chunk  {transfer_id, source, index, offset, size}           -> {data, checksum}
+//
+// data 为 base64 编码的块内容，checksum 为块内容的 SHA-256。上传中断后重新调用
+// file_upload_init，从服务器返回的 next_chunk（已确认的块数）继续；下载从本地已写入的块继续。
+const (
+	defaultChunkSize        = 256 * 1024
+	maxChunkSize            = 4 * 1024 * 1024
+	defaultRetryCount       = 3
+	defaultRetryDelay       = 2 * time.Second
+	maxRetryDelay           = 30 * time.Second
+	defaultProgressInterval = time.Second
+	serverCallTimeout       = 60 * time.Second
+)
+
+// errTransferStopped 插件停止、取消或暂停时中止传输
+var errTransferStopped = errors.New("transfer stopped")
+
+// callServer 调用服务器并返回响应字段
+func (p *FileTransferPlugin) callServer(msgType string, data map[string]interface{}) (map[string]interface{}, error) {
+	resp, err := p.ctx.Agent.CallServer(msgType, data, serverCallTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return map[string]interface{}{}, nil
+	}
+	fields, ok := resp.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s response", msgType)
+	}
+	return fields, nil
+}
+
+// retrier 记录连续失败次数，超过 retry_count 后放弃，每次重试的等待时间加倍
+type retrier struct {
+	p        *FileTransferPlugin
+	transfer *TransferInfo
+	stop     <-chan struct{}
+	failures int
+}
+
+// wait 记录一次失败并等待重试，不再重试时返回错误
+func (r *retrier) wait(err error) error {
+	r.failures++
+	if r.failures > plugin.ConfigInt(r.p.config, "retry_count", defaultRetryCount) {
+		return err
+	}
+	delay := plugin.ConfigDuration(r.p.config, "retry_delay", defaultRetryDelay) << (r.failures - 1)
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	r.p.mu.Lock()
+	r.transfer.Retries++
+	r.p.mu.Unlock()
+	r.p.ctx.Logger.Warnf("Transfer %s interrupted, retrying in %v: %v", r.transfer.ID, delay, err)
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-r.stop:
+		return errTransferStopped
+	}
+}
+
+// reset 传输有进展后清除失败计数
+func (r *retrier) reset() {
+	r.failures = 0
+}
+
+// chunkCount 返回文件的块数
+func chunkCount(size, chunkSize int64) int64 {
+	return (size + chunkSize - 1) / chunkSize
+}
+
+// chunkChecksum 返回块内容的 SHA-256
+func chunkChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// performUpload 按块上传文件到服务器，每块确认后再发送下一块
+func (p *FileTransferPlugin) performUpload(transfer *TransferInfo, stop <-chan struct{}) error {
+	fs, err := plugin.AgentFS(p.ctx.Agent)
+	if err != nil {
+		return err
+	}
+	f, err := fs.OpenFile(p.uploadSource(transfer), os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size, chunkSize := info.Size(), transfer.ChunkSize
+	chunks := chunkCount(size, chunkSize)
+	p.mu.Lock()
+	transfer.Size = size
+	transfer.Chunks = chunks
+	p.mu.Unlock()
+
+	retry := &retrier{p: p, transfer: transfer, stop: stop}
+	hash := newRunningHash(f, false)
+	if p.deltaEnabled(size) {
+		if handled, err := p.uploadDelta(transfer, f, size, hash, retry, stop); handled || err != nil {
+			return err
+		}
+	}
+
+	// register 向服务器登记传输，返回服务器已确认的块数
+	register := func() (int64, error) {
+		for {
+			resp, err := p.callServer("file_upload_init", map[string]interface{}{
+				"transfer_id": transfer.ID,
+				"destination": transfer.Destination,
+				"size":        size,
+				"chunk_size":  chunkSize,
+				"chunks":      chunks,
+			})
+			if err == nil {
+				next, _ := toInt64(resp["next_chunk"])
+				if next < 0 || next > chunks {
+					return 0, fmt.Errorf("server returned invalid next_chunk %d", next)
+				}
+				return next, nil
+			}
+			if err := retry.wait(err); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	next, err := register()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize)
+	for next < chunks {
+		select {
+		case <-stop:
+			return errTransferStopped
+		default:
+		}
+
+		offset := next * chunkSize
+		n, err := f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if want := min(chunkSize, size-offset); int64(n) != want {
+			return fmt.Errorf("source file changed during upload")
+		}
+		data := buf[:n]
+		if err := hash.update(offset, data); err != nil {
+			return err
+		}
+		if err := p.throttle(transfer, n, stop); err != nil {
+			return err
+		}
+
+		_, err = p.callServer("file_upload_chunk", map[string]interface{}{
+			"transfer_id": transfer.ID,
+			"index":       next,
+			"offset":      offset,
+			"data":        base64.StdEncoding.EncodeToString(data),
+			"checksum":    chunkChecksum(data),
+		})
+		if err != nil {
+			if err := retry.wait(err); err != nil {
+				return err
+			}
+			// 重新连接后从服务器确认的位置继续
+			if next, err = register(); err != nil {
+				return err
+			}
+			continue
+		}
+		retry.reset()
+		next++
+		p.reportProgress(transfer, min(next*chunkSize, size))
+	}
+	return p.completeUpload(transfer, hash, size, false, retry)
+}
+
+// completeUpload 校验文件后通知服务器上传完成，服务器用 sha256 校验组装后的文件
+func (p *FileTransferPlugin) completeUpload(transfer *TransferInfo, hash *runningHash, size int64, delta bool, retry *retrier) error {
+	sum, err := p.verifyIntegrity(transfer, hash, size, "")
+	if err != nil {
+		return err
+	}
+
+	return p.callWithRetry(retry, "file_upload_complete", map[string]interface{}{
+		"transfer_id": transfer.ID,
+		"destination": transfer.Destination,
+		"size":        size,
+		"sha256":      sum,
+		"delta":       delta,
+	})
+}
+
+// performDownload 按块从服务器下载文件，写入 destination.part，全部完成并校验后重命名
+func (p *FileTransferPlugin) performDownload(transfer *TransferInfo, stop <-chan struct{}) error {
+	fs, err := plugin.AgentFS(p.ctx.Agent)
+	if err != nil {
+		return err
+	}
+
+	retry := &retrier{p: p, transfer: transfer, stop: stop}
+	chunkSize := transfer.ChunkSize
+	resume := p.resumableBytes(transfer)
+	var size int64 = -1
+	var reportedSHA256 string
+	// stat 获取文件大小，重新连接后确认文件没有变化
+	stat := func() error {
+		for {
+			resp, err := p.callServer("file_download_init", map[string]interface{}{
+				"transfer_id": transfer.ID,
+				"source":      transfer.Source,
+				"chunk_size":  chunkSize,
+			})
+			if err == nil {
+				current, ok := toInt64(resp["size"])
+				if !ok || current < 0 {
+					return fmt.Errorf("server returned invalid size")
+				}
+				if size >= 0 && current != size {
+					return fmt.Errorf("source file changed during download")
+				}
+				size = current
+				reportedSHA256, _ = resp["sha256"].(string)
+				return nil
+			}
+			if err := retry.wait(err); err != nil {
+				return err
+			}
+		}
+	}
+	if err := stat(); err != nil {
+		return err
+	}
+
+	chunks := chunkCount(size, chunkSize)
+	p.mu.Lock()
+	transfer.Size = size
+	transfer.Chunks = chunks
+	p.mu.Unlock()
+
+	part := p.downloadTarget(transfer) + ".part"
+	f, done, err := openPart(fs, part, resume(size))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// 暂停后继续时从已写入的完整块开始
+	next := done / chunkSize
+	handled := false
+	hash := newRunningHash(f, false)
+	if next == 0 && p.deltaEnabled(size) {
+		if handled, err = p.downloadDelta(transfer, fs, f, size, hash, retry, stop); err != nil {
+			return err
+		}
+	}
+	for !handled && next < chunks {
+		select {
+		case <-stop:
+			return errTransferStopped
+		default:
+		}
+
+		offset := next * chunkSize
+		want := min(chunkSize, size-offset)
+		if err := p.throttle(transfer, int(want), stop); err != nil {
+			return err
+		}
+		data, err := p.downloadChunk(transfer, next, offset, want)
+		if err != nil {
+			if err := retry.wait(err); err != nil {
+				return err
+			}
+			if err := stat(); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := f.WriteAt(data, offset); err != nil {
+			return err
+		}
+		if err := hash.update(offset, data); err != nil {
+			return err
+		}
+		retry.reset()
+		next++
+		p.reportProgress(transfer, offset+want)
+	}
+
+	if _, err := p.verifyIntegrity(transfer, hash, size, reportedSHA256); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return fs.Rename(part, p.downloadTarget(transfer))
+}
+
+// resumableBytes 记录传输开始前已传输的字节数，返回的函数在源文件大小与上次相同时返回该值，否则返回 0
+func (p *FileTransferPlugin) resumableBytes(transfer *TransferInfo) func(size int64) int64 {
+	p.mu.RLock()
+	previousSize, transferred := transfer.Size, transfer.Transferred
+	p.mu.RUnlock()
+	return func(size int64) int64 {
+		if size != previousSize {
+			return 0
+		}
+		return transferred
+	}
+}
+
+// openPart 打开下载的临时文件，保留前 resume 字节（不超过文件现有长度），返回保留的长度
+func openPart(fsys plugin.FileSystem, path string, resume int64) (*os.File, int64, error) {
+	f, err := fsys.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resume > 0 {
+		info, err := f.Stat()
+		if err != nil {
+			resume = 0
+		} else {
+			resume = min(resume, info.Size())
+		}
+	}
+	if err := f.Truncate(resume); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, resume, nil
+}
+
+// downloadChunk 下载一个块并校验长度和校验和
+func (p *FileTransferPlugin) downloadChunk(transfer *TransferInfo, index, offset, size int64) ([]byte, error) {
+	resp, err := p.callServer("file_download_chunk", map[string]interface{}{
+		"transfer_id": transfer.ID,
+		"source":      transfer.Source,
+		"index":       index,
+		"offset":      offset,
+		"size":        size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded, _ := resp["data"].(string)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk %d data: %v", index, err)
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("chunk %d size mismatch: expected %d, got %d", index, size, len(data))
+	}
+	if checksum, _ := resp["checksum"].(string); checksum != "" && checksum != chunkChecksum(data) {
+		return nil, fmt.Errorf("chunk %d checksum mismatch", index)
+	}
+	return data, nil
+}
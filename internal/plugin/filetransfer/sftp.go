@@ -0,0 +1,461 @@
+package filetransfer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTP 协议第 3 版（draft-ietf-secsh-filexfer-02）中用到的消息
+const (
+	sshFxpInit    = 1
+	sshFxpVersion = 2
+	sshFxpOpen    = 3
+	sshFxpClose   = 4
+	sshFxpRead    = 5
+	sshFxpWrite   = 6
+	sshFxpStat    = 17
+	sshFxpStatus  = 101
+	sshFxpHandle  = 102
+	sshFxpData    = 103
+	sshFxpAttrs   = 105
+
+	sshFxOK         = 0
+	sshFxEOF        = 1
+	sshFxNoSuchFile = 2
+
+	sshFxfRead  = 0x01
+	sshFxfWrite = 0x02
+	sshFxfCreat = 0x08
+	sshFxfTrunc = 0x10
+
+	sshFileXferAttrSize = 0x01
+
+	// sftpChunkSize 单次读写的大小，大多数服务器限制为 32 KiB
+	sftpChunkSize = 32 * 1024
+)
+
+// sftpStatusError 服务器返回的错误状态
+type sftpStatusError struct {
+	code    uint32
+	message string
+}
+
+func (e *sftpStatusError) Error() string {
+	return fmt.Sprintf("sftp error %d: %s", e.code, e.message)
+}
+
+// sftpClient 最小的 SFTP 客户端，请求依次发送并等待响应
+type sftpClient struct {
+	mu     sync.Mutex
+	r      io.Reader
+	w      io.Writer
+	nextID uint32
+}
+
+// newSFTPClient 在 sftp 子系统的输入输出上完成版本协商
+func newSFTPClient(r io.Reader, w io.Writer) (*sftpClient, error) {
+	c := &sftpClient{r: r, w: w}
+	if err := c.writePacket(sshFxpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return nil, err
+	}
+	typ, _, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	if typ != sshFxpVersion {
+		return nil, fmt.Errorf("unexpected sftp packet %d during init", typ)
+	}
+	return c, nil
+}
+
+func (c *sftpClient) writePacket(typ byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	packet = append(packet, typ)
+	_, err := c.w.Write(append(packet, payload...))
+	return err
+}
+
+func (c *sftpClient) readPacket() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > 4*sftpChunkSize {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], payload, nil
+}
+
+// appendString 按 SSH 字符串格式（长度前缀）追加
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// readString 读取 SSH 字符串，返回字符串和剩余数据
+func readString(b []byte) (string, []byte, bool) {
+	if len(b) < 4 {
+		return "", nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return "", nil, false
+	}
+	return string(b[4 : 4+n]), b[4+n:], true
+}
+
+// request 发送请求并返回响应类型和去掉请求 ID 的内容，状态响应中的错误转换为 sftpStatusError
+func (c *sftpClient) request(typ byte, payload []byte) (byte, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := c.nextID
+	if err := c.writePacket(typ, append(binary.BigEndian.AppendUint32(nil, id), payload...)); err != nil {
+		return 0, nil, err
+	}
+	respType, resp, err := c.readPacket()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(resp) < 4 || binary.BigEndian.Uint32(resp) != id {
+		return 0, nil, fmt.Errorf("unexpected sftp response id")
+	}
+	resp = resp[4:]
+	if respType == sshFxpStatus {
+		if len(resp) < 4 {
+			return 0, nil, fmt.Errorf("invalid sftp status")
+		}
+		code := binary.BigEndian.Uint32(resp)
+		if code == sshFxOK {
+			return respType, nil, nil
+		}
+		message, _, _ := readString(resp[4:])
+		return 0, nil, &sftpStatusError{code: code, message: message}
+	}
+	return respType, resp, nil
+}
+
+// stat 返回文件大小，文件不存在时返回 os.ErrNotExist
+func (c *sftpClient) stat(path string) (int64, error) {
+	typ, resp, err := c.request(sshFxpStat, appendString(nil, path))
+	var status *sftpStatusError
+	if errors.As(err, &status) && status.code == sshFxNoSuchFile {
+		return 0, os.ErrNotExist
+	}
+	if err != nil {
+		return 0, err
+	}
+	if typ != sshFxpAttrs || len(resp) < 12 || binary.BigEndian.Uint32(resp)&sshFileXferAttrSize == 0 {
+		return 0, fmt.Errorf("sftp server did not return file size for %s", path)
+	}
+	return int64(binary.BigEndian.Uint64(resp[4:])), nil
+}
+
+// open 打开文件，返回句柄
+func (c *sftpClient) open(path string, flags uint32) (string, error) {
+	payload := appendString(nil, path)
+	payload = binary.BigEndian.AppendUint32(payload, flags)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // 不设置属性
+	typ, resp, err := c.request(sshFxpOpen, payload)
+	if err != nil {
+		return "", err
+	}
+	handle, _, ok := readString(resp)
+	if typ != sshFxpHandle || !ok {
+		return "", fmt.Errorf("invalid sftp open response")
+	}
+	return handle, nil
+}
+
+func (c *sftpClient) close(handle string) error {
+	_, _, err := c.request(sshFxpClose, appendString(nil, handle))
+	return err
+}
+
+// read 读取最多 n 字节，到达文件末尾时返回 io.EOF
+func (c *sftpClient) read(handle string, offset int64, n int) ([]byte, error) {
+	payload := appendString(nil, handle)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(offset))
+	payload = binary.BigEndian.AppendUint32(payload, uint32(n))
+	typ, resp, err := c.request(sshFxpRead, payload)
+	var status *sftpStatusError
+	if errors.As(err, &status) && status.code == sshFxEOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _, ok := readString(resp)
+	if typ != sshFxpData || !ok {
+		return nil, fmt.Errorf("invalid sftp read response")
+	}
+	return []byte(data), nil
+}
+
+func (c *sftpClient) write(handle string, offset int64, data []byte) error {
+	payload := appendString(nil, handle)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(offset))
+	payload = appendString(payload, string(data))
+	_, _, err := c.request(sshFxpWrite, payload)
+	return err
+}
+
+// sftpReader 从 offset 开始顺序读取远程文件
+type sftpReader struct {
+	b      *sftpBackend
+	client *sftpClient
+	handle string
+	offset int64
+	stop   func() bool
+}
+
+func (r *sftpReader) Read(p []byte) (int, error) {
+	data, err := r.client.read(r.handle, r.offset, min(len(p), sftpChunkSize))
+	if err != nil {
+		if err != io.EOF {
+			r.b.reset()
+		}
+		return 0, err
+	}
+	r.offset += int64(len(data))
+	return copy(p, data), nil
+}
+
+func (r *sftpReader) Close() error {
+	r.stop()
+	return r.client.close(r.handle)
+}
+
+// sftpBackend SFTP 后端，连接在第一次使用时建立，出错后关闭，重试时重新连接
+// SFTP 没有服务端校验和，上传后核对文件大小，传输过程的完整性由 SSH 保证
+type sftpBackend struct {
+	dial func() (*sftpClient, io.Closer, error)
+
+	mu     sync.Mutex
+	client *sftpClient
+	conn   io.Closer
+}
+
+// newSFTPBackend 使用 sftp_password 或 sftp_private_key 认证，并用 sftp_known_hosts 或 sftp_host_key 校验主机密钥
+func (p *FileTransferPlugin) newSFTPBackend(host, user string) (*sftpBackend, error) {
+	configString := func(name string) string {
+		value, _ := p.config[name].(string)
+		return value
+	}
+	if user == "" {
+		return nil, fmt.Errorf("sftp user is required")
+	}
+
+	var auth []ssh.AuthMethod
+	if path := configString("sftp_private_key"); path != "" {
+		pemBytes, err := p.ctx.Agent.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sftp private key: %v", err)
+		}
+		var signer ssh.Signer
+		if passphrase := configString("sftp_private_key_passphrase"); passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pemBytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid sftp private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password := configString("sftp_password"); password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("sftp_password or sftp_private_key is required")
+	}
+
+	hostKeyCallback, err := p.sftpHostKeyCallback(configString("sftp_known_hosts"), configString("sftp_host_key"))
+	if err != nil {
+		return nil, err
+	}
+
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		address = net.JoinHostPort(host, "22")
+	}
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         serverCallTimeout,
+	}
+	return &sftpBackend{dial: func() (*sftpClient, io.Closer, error) {
+		conn, err := ssh.Dial("tcp", address, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		session, err := conn.NewSession()
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		stdin, err := session.StdinPipe()
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		stdout, err := session.StdoutPipe()
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		if err := session.RequestSubsystem("sftp"); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		client, err := newSFTPClient(stdout, stdin)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		return client, conn, nil
+	}}, nil
+}
+
+// sftpHostKeyCallback 返回主机密钥校验函数，必须配置 known_hosts 文件或主机密钥指纹（如 SHA256:...）
+func (p *FileTransferPlugin) sftpHostKeyCallback(knownHostsPath, fingerprint string) (ssh.HostKeyCallback, error) {
+	if knownHostsPath != "" {
+		// 通过 Agent 检查插件是否有权读取该文件
+		if !p.ctx.Agent.FileExists(knownHostsPath) {
+			return nil, fmt.Errorf("sftp known hosts file not accessible: %s", knownHostsPath)
+		}
+		return knownhosts.New(knownHostsPath)
+	}
+	if fingerprint != "" {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if ssh.FingerprintSHA256(key) != fingerprint {
+				return fmt.Errorf("sftp host key mismatch for %s: got %s", hostname, ssh.FingerprintSHA256(key))
+			}
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("sftp_known_hosts or sftp_host_key is required to verify the server")
+}
+
+// connect 返回当前连接的客户端，没有连接时建立连接，ctx 取消时关闭连接以中断阻塞的读写
+func (b *sftpBackend) connect(ctx context.Context) (*sftpClient, func() bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client == nil {
+		client, conn, err := b.dial()
+		if err != nil {
+			return nil, nil, err
+		}
+		b.client, b.conn = client, conn
+	}
+	return b.client, context.AfterFunc(ctx, b.reset), nil
+}
+
+// reset 关闭连接，下次使用时重新连接
+func (b *sftpBackend) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	b.client, b.conn = nil, nil
+}
+
+func (b *sftpBackend) stat(ctx context.Context, path string) (remoteObject, error) {
+	client, stop, err := b.connect(ctx)
+	if err != nil {
+		return remoteObject{}, err
+	}
+	defer stop()
+	size, err := client.stat(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		b.reset()
+	}
+	return remoteObject{Size: size}, err
+}
+
+func (b *sftpBackend) open(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	client, stop, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := client.open(path, sshFxfRead)
+	if err != nil {
+		stop()
+		b.reset()
+		return nil, err
+	}
+	return &sftpReader{b: b, client: client, handle: handle, offset: offset, stop: stop}, nil
+}
+
+func (b *sftpBackend) upload(rt *remoteTransfer, path string, r io.ReaderAt, size int64) error {
+	return rt.do(func() error {
+		client, stop, err := b.connect(rt.ctx)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		if err := b.write(client, path, rt.body(r, 0, size)); err != nil {
+			b.reset()
+			return err
+		}
+		written, err := client.stat(path)
+		if err != nil {
+			b.reset()
+			return err
+		}
+		if written != size {
+			return fmt.Errorf("sftp upload size mismatch: expected %d, got %d", size, written)
+		}
+		return nil
+	})
+}
+
+// write 覆盖写入远程文件
+func (b *sftpBackend) write(client *sftpClient, path string, body io.Reader) error {
+	handle, err := client.open(path, sshFxfWrite|sshFxfCreat|sshFxfTrunc)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, sftpChunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			if err := client.write(handle, offset, buf[:n]); err != nil {
+				client.close(handle)
+				return err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			client.close(handle)
+			return err
+		}
+	}
+	return client.close(handle)
+}
+
+func (b *sftpBackend) close() error {
+	b.reset()
+	return nil
+}
@@ -0,0 +1,339 @@
+package filetransfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"assistant_agent/internal/plugin"
+)
+
+// SyncOptions 目录同步选项
+// 模式不含 / 时匹配任意层级的文件名，含 / 时匹配相对同步根目录的路径，** 匹配任意层级目录，
+// 以 / 结尾的模式只匹配目录。被排除的目录不会遍历，被排除的文件也不会被删除
+type SyncOptions struct {
+	Include []string `json:"include,omitempty"` // 非空时只同步匹配的文件
+	Exclude []string `json:"exclude,omitempty"`
+	Delete  bool     `json:"delete"` // 删除目标目录中源目录没有的文件和目录
+	DryRun  bool     `json:"dry_run"`
+}
+
+// SyncPlan 同步计划，路径均为相对同步根目录的路径
+type SyncPlan struct {
+	Copy      []string `json:"copy"`   // 目标中不存在的文件
+	Update    []string `json:"update"` // 内容不同的文件
+	Delete    []string `json:"delete"` // 目标中多余的文件和目录，子项排在目录之前
+	Unchanged int      `json:"unchanged"`
+	Bytes     int64    `json:"bytes"` // 需要复制的字节数
+
+	files []syncFile
+}
+
+// syncFile 需要复制的文件
+type syncFile struct {
+	source      string
+	destination string
+	size        int64
+	mode        fs.FileMode
+}
+
+// validate 检查模式语法
+func (o *SyncOptions) validate() error {
+	for _, pattern := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(strings.Trim(pattern, "/"), ""); err != nil || strings.Trim(pattern, "/") == "" {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// matchPattern 判断相对路径是否匹配模式
+func matchPattern(pattern, rel string, isDir bool) bool {
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(rel))
+		return matched
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments 逐级匹配路径，** 匹配零个或多个目录
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], parts[0]); !matched {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// matchAny 判断相对路径是否匹配任一模式
+func matchAny(patterns []string, rel string, isDir bool) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// selected 判断文件是否在同步范围内
+func (o *SyncOptions) selected(rel string) bool {
+	return len(o.Include) == 0 || matchAny(o.Include, rel, false)
+}
+
+// readDir 通过 Agent 读取目录，按名称排序
+func readDir(fsys plugin.FileSystem, dir string) ([]os.DirEntry, error) {
+	f, err := fsys.OpenFile(dir, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := f.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	// os.File.ReadDir 按目录顺序返回，排序后同步计划稳定
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// fileDigest 计算文件内容的 SHA-256
+func fileDigest(fsys plugin.FileSystem, name string) ([]byte, error) {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// planFile 比较源文件和目标文件，大小相同时比较内容
+func planFile(fsys plugin.FileSystem, plan *SyncPlan, rel, source, destination string, info fs.FileInfo) error {
+	file := syncFile{source: source, destination: destination, size: info.Size(), mode: info.Mode().Perm()}
+	existing, err := fsys.Stat(destination)
+	switch {
+	case os.IsNotExist(err):
+		plan.Copy = append(plan.Copy, rel)
+	case err != nil:
+		return err
+	case existing.IsDir():
+		return fmt.Errorf("destination %s is a directory", destination)
+	case existing.Size() != info.Size():
+		plan.Update = append(plan.Update, rel)
+	default:
+		sourceSum, err := fileDigest(fsys, source)
+		if err != nil {
+			return err
+		}
+		destinationSum, err := fileDigest(fsys, destination)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(sourceSum, destinationSum) {
+			plan.Unchanged++
+			return nil
+		}
+		plan.Update = append(plan.Update, rel)
+	}
+	plan.files = append(plan.files, file)
+	plan.Bytes += file.size
+	return nil
+}
+
+// planSync 比较源和目标生成同步计划，源为文件时只同步该文件
+func planSync(fsys plugin.FileSystem, source, destination string, opts *SyncOptions) (*SyncPlan, error) {
+	info, err := fsys.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("source does not exist: %s", source)
+	}
+	plan := &SyncPlan{Copy: []string{}, Update: []string{}, Delete: []string{}}
+	if !info.IsDir() {
+		return plan, planFile(fsys, plan, filepath.Base(source), source, destination, info)
+	}
+
+	// 遍历源目录，记录同步范围内的文件和目录
+	wanted := make(map[string]bool)
+	var walkSource func(rel string) error
+	walkSource = func(rel string) error {
+		entries, err := readDir(fsys, filepath.Join(source, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			child := path.Join(rel, entry.Name())
+			if matchAny(opts.Exclude, child, entry.IsDir()) {
+				continue
+			}
+			if entry.IsDir() {
+				wanted[child] = true
+				if err := walkSource(child); err != nil {
+					return err
+				}
+				continue
+			}
+			// 符号链接、设备等特殊文件不同步
+			if !entry.Type().IsRegular() || !opts.selected(child) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			wanted[child] = true
+			if err := planFile(fsys, plan, child, filepath.Join(source, filepath.FromSlash(child)),
+				filepath.Join(destination, filepath.FromSlash(child)), info); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walkSource(""); err != nil {
+		return nil, err
+	}
+
+	if !opts.Delete {
+		return plan, nil
+	}
+	// 遍历目标目录，返回目录下的内容是否全部删除，目录本身只在源中不存在且已清空时删除
+	var walkDestination func(rel string) (bool, error)
+	walkDestination = func(rel string) (bool, error) {
+		entries, err := readDir(fsys, filepath.Join(destination, filepath.FromSlash(rel)))
+		if err != nil {
+			return false, err
+		}
+		empty := true
+		for _, entry := range entries {
+			child := path.Join(rel, entry.Name())
+			if wanted[child] && !entry.IsDir() {
+				empty = false
+				continue
+			}
+			if matchAny(opts.Exclude, child, entry.IsDir()) || (!entry.IsDir() && !opts.selected(child)) {
+				empty = false
+				continue
+			}
+			if entry.IsDir() {
+				childEmpty, err := walkDestination(child)
+				if err != nil {
+					return false, err
+				}
+				if wanted[child] || !childEmpty {
+					empty = false
+					continue
+				}
+			}
+			plan.Delete = append(plan.Delete, child)
+		}
+		return empty, nil
+	}
+	if existing, err := fsys.Stat(destination); err == nil && existing.IsDir() {
+		if _, err := walkDestination(""); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// progressWriter 按限速写入，统计写入的字节数并更新传输进度
+type progressWriter struct {
+	w        io.Writer
+	p        *FileTransferPlugin
+	transfer *TransferInfo
+	stop     <-chan struct{}
+	written  int64
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	if err := w.p.throttle(w.transfer, len(b), w.stop); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(b)
+	w.written += int64(n)
+	w.p.reportProgress(w.transfer, w.written)
+	return n, err
+}
+
+// copyFile 复制文件，先写入 destination.part 再重命名，目标目录不存在时创建
+func copyFile(fsys plugin.FileSystem, file syncFile, w *progressWriter) error {
+	if err := fsys.MkdirAll(filepath.Dir(file.destination), 0755); err != nil {
+		return err
+	}
+	src, err := fsys.OpenFile(file.source, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	part := file.destination + ".part"
+	dst, err := fsys.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.mode)
+	if err != nil {
+		return err
+	}
+	w.w = dst
+	if _, err := io.Copy(w, src); err != nil {
+		dst.Close()
+		fsys.Remove(part)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		fsys.Remove(part)
+		return err
+	}
+	return fsys.Rename(part, file.destination)
+}
+
+// performSync 按同步计划复制文件并删除多余的文件
+func (p *FileTransferPlugin) performSync(transfer *TransferInfo, plan *SyncPlan, stop <-chan struct{}) error {
+	fsys, err := plugin.AgentFS(p.ctx.Agent)
+	if err != nil {
+		return err
+	}
+
+	w := &progressWriter{p: p, transfer: transfer, stop: stop}
+	for _, file := range plan.files {
+		select {
+		case <-stop:
+			return errTransferStopped
+		default:
+		}
+		if err := copyFile(fsys, file, w); err != nil {
+			return err
+		}
+	}
+
+	for _, rel := range plan.Delete {
+		if err := fsys.Remove(filepath.Join(transfer.Destination, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
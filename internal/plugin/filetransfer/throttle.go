@@ -0,0 +1,182 @@
+package filetransfer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// windowCheckInterval 传输时间段之外等待时的检查间隔
+	windowCheckInterval = 30 * time.Second
+	// throughputInterval 计算当前吞吐量的采样间隔
+	throughputInterval = time.Second
+)
+
+// rateLimiter 令牌桶限速器，允许最多一秒的突发
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // 字节/秒
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter 创建限速器，kbps 为 KB/s，不大于 0 时不限速返回 nil
+func newRateLimiter(kbps int64) *rateLimiter {
+	if kbps <= 0 {
+		return nil
+	}
+	rate := float64(kbps * 1024)
+	return &rateLimiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// reserve 预留 n 字节，返回需要等待的时间，令牌不足时令牌数可以为负，后续调用方顺延等待
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait 等待可以发送 n 字节，nil 限速器不等待
+func (l *rateLimiter) wait(n int, stop <-chan struct{}) error {
+	if l == nil {
+		return nil
+	}
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-stop:
+		return errTransferStopped
+	}
+}
+
+// transferWindow 允许传输的时间段，按 Agent 本地时间计算，end 早于 start 时跨越午夜
+type transferWindow struct {
+	start, end int // 从零点开始的分钟数
+}
+
+// parseWindows 解析逗号分隔的时间段，如 "22:00-06:00,12:00-13:00"，空字符串表示不限制
+func parseWindows(value string) ([]transferWindow, error) {
+	var windows []transferWindow
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		startText, endText, ok := strings.Cut(item, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid transfer window %q, expected HH:MM-HH:MM", item)
+		}
+		start, err := plugin.ParseClock(startText)
+		if err != nil {
+			return nil, err
+		}
+		end, err := plugin.ParseClock(endText)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("transfer window %q start and end must differ", item)
+		}
+		windows = append(windows, transferWindow{start: start, end: end})
+	}
+	return windows, nil
+}
+
+// inWindows 判断时间是否落在任一时间段内，没有时间段时始终允许
+func inWindows(windows []transferWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range windows {
+		if w.start < w.end && minute >= w.start && minute < w.end {
+			return true
+		}
+		if w.start > w.end && (minute >= w.start || minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// transferWindows 返回传输使用的时间段，传输参数 windows 优先于 transfer_windows 配置
+func (p *FileTransferPlugin) transferWindows(transfer *TransferInfo) []transferWindow {
+	value, _ := p.config["transfer_windows"].(string)
+	if transfer.Windows != "" {
+		value = transfer.Windows
+	}
+	// 配置和参数已在设置时校验
+	windows, _ := parseWindows(value)
+	return windows
+}
+
+// waitWindow 不在允许的时间段内时将传输标记为 waiting 并等待
+func (p *FileTransferPlugin) waitWindow(transfer *TransferInfo, stop <-chan struct{}) error {
+	windows := p.transferWindows(transfer)
+	waiting := false
+	for !inWindows(windows, time.Now()) {
+		if !waiting {
+			waiting = true
+			p.mu.Lock()
+			transfer.Status = "waiting"
+			transfer.Throughput = 0
+			p.mu.Unlock()
+			p.ctx.Logger.Infof("Transfer %s outside transfer window, waiting", transfer.ID)
+		}
+		select {
+		case <-time.After(windowCheckInterval):
+		case <-stop:
+			return errTransferStopped
+		}
+	}
+	if waiting {
+		p.mu.Lock()
+		transfer.Status = "running"
+		p.mu.Unlock()
+		p.ctx.Logger.Infof("Transfer %s resumed in transfer window", transfer.ID)
+	}
+	return nil
+}
+
+// throttle 发送或接收 n 字节前调用，先等待传输时间段，再按全局和传输的限速等待
+func (p *FileTransferPlugin) throttle(transfer *TransferInfo, n int, stop <-chan struct{}) error {
+	if err := p.waitWindow(transfer, stop); err != nil {
+		return err
+	}
+	p.mu.RLock()
+	global := p.limiter
+	p.mu.RUnlock()
+	if err := global.wait(n, stop); err != nil {
+		return err
+	}
+	return transfer.limiter.wait(n, stop)
+}
+
+// updateThroughput 按采样间隔更新当前吞吐量（字节/秒），调用方需持有 p.mu
+func (t *TransferInfo) updateThroughput(now time.Time) {
+	if t.throughputAt.IsZero() {
+		t.throughputAt, t.throughputBytes = now, t.Transferred
+		return
+	}
+	elapsed := now.Sub(t.throughputAt)
+	if elapsed < throughputInterval {
+		return
+	}
+	t.Throughput = float64(t.Transferred-t.throughputBytes) / elapsed.Seconds()
+	t.throughputAt, t.throughputBytes = now, t.Transferred
+}
@@ -0,0 +1,342 @@
+package plugin
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/logger"
+)
+
+// registryTimeout 访问插件仓库的超时时间
+const registryTimeout = 5 * time.Minute
+
+// PluginManifest 插件仓库返回的插件包描述
+type PluginManifest struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	URL       string `json:"url"`       // 插件可执行文件地址，可以是相对仓库的路径
+	SHA256    string `json:"sha256"`    // 可执行文件的 SHA-256（十六进制）
+	Signature string `json:"signature"` // 对 SignedContent 的 Ed25519 签名（base64）
+}
+
+// SignedContent 返回签名覆盖的内容，将名称和版本与文件摘要绑定，防止替换为其他插件的合法包
+func (m *PluginManifest) SignedContent() []byte {
+	return []byte(m.Name + "\n" + m.Version + "\n" + strings.ToLower(m.SHA256))
+}
+
+// pluginRegistry 插件仓库
+type pluginRegistry struct {
+	url       string
+	publicKey ed25519.PublicKey
+	client    *http.Client
+}
+
+// SetRegistry 设置插件仓库地址和用于校验插件签名的 Ed25519 公钥（base64）
+func (m *Manager) SetRegistry(registryURL, publicKey string) error {
+	if registryURL == "" {
+		return fmt.Errorf("plugin registry url is empty")
+	}
+	if _, err := url.Parse(registryURL); err != nil {
+		return fmt.Errorf("invalid plugin registry url: %v", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid plugin registry public key")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.registry = &pluginRegistry{
+		url:       strings.TrimRight(registryURL, "/"),
+		publicKey: ed25519.PublicKey(key),
+		client:    &http.Client{Timeout: registryTimeout},
+	}
+	return nil
+}
+
+// InstallPlugin 从插件仓库下载插件，校验后安装到外部插件目录并启动，version 为空时安装最新版本
+func (m *Manager) InstallPlugin(name, version string) (*PluginInfo, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	registry, dir, err := m.registrySettings()
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := m.GetPlugin(name); exists {
+		return nil, ErrPluginAlreadyExists
+	}
+
+	manifest, err := registry.manifest(name, version)
+	if err != nil {
+		return nil, err
+	}
+	download, err := registry.download(manifest, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	path := externalPluginPath(dir, name)
+	if err := os.Rename(download, path); err != nil {
+		os.Remove(download)
+		return nil, fmt.Errorf("failed to install plugin: %v", err)
+	}
+
+	info, err := m.loadInstalled(path, name)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	logger.Infof("Plugin installed: %s v%s", name, manifest.Version)
+	return info, nil
+}
+
+// UpgradePlugin 将已安装的插件升级到指定版本，version 为空时升级到最新版本
+// 新版本无法启动时恢复旧版本
+func (m *Manager) UpgradePlugin(name, version string) (*PluginInfo, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	registry, dir, err := m.registrySettings()
+	if err != nil {
+		return nil, err
+	}
+	current, err := m.installedPlugin(name, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := registry.manifest(name, version)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Version == current.Info().Version {
+		return current.Info(), nil
+	}
+
+	download, err := registry.download(manifest, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// 停止旧版本并保留备份
+	path := current.Path()
+	backup := filepath.Join(dir, "."+filepath.Base(path)+".bak")
+	if err := m.Unregister(name); err != nil {
+		os.Remove(download)
+		return nil, err
+	}
+	if err := os.Rename(path, backup); err != nil {
+		os.Remove(download)
+		return nil, fmt.Errorf("failed to back up plugin: %v", err)
+	}
+	if err := os.Rename(download, path); err != nil {
+		os.Remove(download)
+		os.Rename(backup, path)
+		m.loadExternal(path)
+		return nil, fmt.Errorf("failed to install plugin: %v", err)
+	}
+
+	info, err := m.loadInstalled(path, name)
+	if err != nil {
+		logger.Errorf("Failed to start plugin %s v%s, restoring previous version: %v", name, manifest.Version, err)
+		os.Rename(backup, path)
+		if _, restoreErr := m.loadExternal(path); restoreErr != nil {
+			logger.Errorf("Failed to restore plugin %s: %v", name, restoreErr)
+		}
+		return nil, err
+	}
+
+	os.Remove(backup)
+	logger.Infof("Plugin upgraded: %s v%s", name, manifest.Version)
+	return info, nil
+}
+
+// UninstallPlugin 停止并删除从外部插件目录加载的插件
+func (m *Manager) UninstallPlugin(name string) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	m.mu.RLock()
+	dir := m.extDir
+	m.mu.RUnlock()
+
+	current, err := m.installedPlugin(name, dir)
+	if err != nil {
+		return err
+	}
+	if err := m.Unregister(name); err != nil {
+		return err
+	}
+	if err := os.Remove(current.Path()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove plugin file: %v", err)
+	}
+
+	logger.Infof("Plugin uninstalled: %s", name)
+	return nil
+}
+
+// registrySettings 返回插件仓库和外部插件目录
+func (m *Manager) registrySettings() (*pluginRegistry, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.registry == nil {
+		return nil, "", fmt.Errorf("plugin registry is not configured")
+	}
+	if m.extDir == "" {
+		return nil, "", fmt.Errorf("external plugin directory is not configured")
+	}
+	return m.registry, m.extDir, nil
+}
+
+// installedPlugin 返回从外部插件目录加载的插件，内置插件不能卸载或升级
+func (m *Manager) installedPlugin(name, dir string) (*ExternalPlugin, error) {
+	plugin, exists := m.GetPlugin(name)
+	if !exists {
+		return nil, ErrPluginNotFound
+	}
+	external, ok := plugin.(*ExternalPlugin)
+	if !ok || filepath.Dir(external.Path()) != filepath.Clean(dir) {
+		return nil, fmt.Errorf("plugin %s is not an installed plugin", name)
+	}
+	return external, nil
+}
+
+// loadInstalled 加载安装的插件，并确认插件名与仓库中的名称一致
+func (m *Manager) loadInstalled(path, name string) (*PluginInfo, error) {
+	loaded, err := m.loadExternal(path)
+	if err != nil {
+		return nil, err
+	}
+	plugin, _ := m.GetPlugin(loaded)
+	if loaded != name {
+		m.Unregister(loaded)
+		return nil, fmt.Errorf("plugin package %s reports name %s", name, loaded)
+	}
+	return plugin.Info(), nil
+}
+
+// externalPluginPath 插件在外部插件目录中的文件路径
+func externalPluginPath(dir, name string) string {
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(dir, name)
+}
+
+// manifest 查询插件包描述
+func (r *pluginRegistry) manifest(name, version string) (*PluginManifest, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid plugin name: %q", name)
+	}
+
+	query := url.Values{}
+	query.Set("os", runtime.GOOS)
+	query.Set("arch", runtime.GOARCH)
+	if version != "" {
+		query.Set("version", version)
+	}
+
+	resp, err := r.client.Get(r.url + "/plugins/" + url.PathEscape(name) + "?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query plugin registry: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("plugin %s not found in registry", name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("plugin registry returned status %d", resp.StatusCode)
+	}
+
+	var manifest PluginManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid plugin manifest: %v", err)
+	}
+	if manifest.Name != name {
+		return nil, fmt.Errorf("plugin registry returned manifest for %s", manifest.Name)
+	}
+	if version != "" && manifest.Version != version {
+		return nil, fmt.Errorf("plugin registry returned version %s, expected %s", manifest.Version, version)
+	}
+	if manifest.URL == "" || manifest.SHA256 == "" {
+		return nil, fmt.Errorf("invalid plugin manifest: url and sha256 are required")
+	}
+
+	// 先校验签名，避免下载未签名的包
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil || !ed25519.Verify(r.publicKey, manifest.SignedContent(), signature) {
+		return nil, fmt.Errorf("invalid signature for plugin %s v%s", name, manifest.Version)
+	}
+
+	return &manifest, nil
+}
+
+// download 下载插件包到目录中的临时文件，校验摘要后返回临时文件路径
+func (r *pluginRegistry) download(manifest *PluginManifest, dir string) (string, error) {
+	name := manifest.Name
+	location, err := url.Parse(manifest.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid plugin url: %v", err)
+	}
+	base, _ := url.Parse(r.url + "/")
+	downloadURL := base.ResolveReference(location).String()
+
+	resp, err := r.client.Get(downloadURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download plugin: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("plugin download returned status %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	// 临时文件以点开头，重新加载时不会被当作插件
+	file, err := os.CreateTemp(dir, "."+name+"-*.download")
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to download plugin: %v", err)
+	}
+
+	if checksum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(checksum, manifest.SHA256) {
+		os.Remove(path)
+		return "", fmt.Errorf("checksum mismatch for plugin %s: expected %s, got %s", name, manifest.SHA256, checksum)
+	}
+
+	if err := os.Chmod(path, 0755); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRegistry 测试插件仓库，按名称和版本提供插件包
+type testRegistry struct {
+	privateKey ed25519.PrivateKey
+	latest     string
+	packages   map[string][]byte // 版本 -> 插件文件内容
+	manifests  map[string]*PluginManifest
+}
+
+func newTestRegistry(t *testing.T) (*testRegistry, string) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &testRegistry{
+		privateKey: privateKey,
+		packages:   make(map[string][]byte),
+		manifests:  make(map[string]*PluginManifest),
+	}, base64.StdEncoding.EncodeToString(publicKey)
+}
+
+// publish 发布插件版本并签名
+func (r *testRegistry) publish(name, version string, content []byte) *PluginManifest {
+	sum := sha256.Sum256(content)
+	manifest := &PluginManifest{
+		Name:    name,
+		Version: version,
+		URL:     "files/" + name + "-" + version,
+		SHA256:  hex.EncodeToString(sum[:]),
+	}
+	manifest.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(r.privateKey, manifest.SignedContent()))
+	r.packages[version] = content
+	r.manifests[version] = manifest
+	r.latest = version
+	return manifest
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, "/files/") {
+		version := req.URL.Path[strings.LastIndex(req.URL.Path, "-")+1:]
+		w.Write(r.packages[version])
+		return
+	}
+
+	version := req.URL.Query().Get("version")
+	if version == "" {
+		version = r.latest
+	}
+	manifest, ok := r.manifests[version]
+	if !ok || req.URL.Path != "/plugins/"+manifest.Name {
+		http.NotFound(w, req)
+		return
+	}
+	json.NewEncoder(w).Encode(manifest)
+}
+
+func TestManagerInstallPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("external plugin test uses a shell script launcher")
+	}
+	config.Init()
+	logger.Init()
+
+	registry, publicKey := newTestRegistry(t)
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	dir := t.TempDir()
+	manager := NewManager(&MockAgent{config: make(map[string]interface{})}, &config.Config{})
+	defer manager.Stop()
+	manager.SetExternalDir(dir)
+
+	_, err := manager.InstallPlugin("echo-external", "")
+	assert.Error(t, err)
+	assert.Error(t, manager.SetRegistry(server.URL, "invalid"))
+	require.NoError(t, manager.SetRegistry(server.URL, publicKey))
+
+	// 安装最新版本
+	registry.publish("echo-external", "1.0.0", externalPluginScript("1.0.0"))
+	info, err := manager.InstallPlugin("echo-external", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", info.Version)
+	assert.FileExists(t, filepath.Join(dir, "echo-external"))
+	_, err = manager.InstallPlugin("echo-external", "")
+	assert.Equal(t, ErrPluginAlreadyExists, err)
+
+	// 升级到指定版本，已是该版本时不重复安装
+	registry.publish("echo-external", "2.0.0", externalPluginScript("2.0.0"))
+	info, err = manager.UpgradePlugin("echo-external", "2.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0", info.Version)
+	info, err = manager.UpgradePlugin("echo-external", "")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0", info.Version)
+
+	// 文件被篡改或签名无效时拒绝安装，保留当前版本
+	manifest := registry.publish("echo-external", "3.0.0", externalPluginScript("3.0.0"))
+	registry.packages["3.0.0"] = externalPluginScript("tampered")
+	_, err = manager.UpgradePlugin("echo-external", "")
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	registry.packages["3.0.0"] = externalPluginScript("3.0.0")
+	manifest.Signature = base64.StdEncoding.EncodeToString(make([]byte, ed25519.SignatureSize))
+	_, err = manager.UpgradePlugin("echo-external", "")
+	assert.ErrorContains(t, err, "invalid signature")
+
+	plugin, ok := manager.GetPlugin("echo-external")
+	require.True(t, ok)
+	assert.Equal(t, "2.0.0", plugin.Info().Version)
+
+	_, err = manager.InstallPlugin("missing", "")
+	assert.ErrorContains(t, err, "not found")
+
+	// 内置插件不能卸载
+	require.NoError(t, manager.Register(newSubscriberPlugin("builtin")))
+	assert.Error(t, manager.UninstallPlugin("builtin"))
+
+	require.NoError(t, manager.UninstallPlugin("echo-external"))
+	_, ok = manager.GetPlugin("echo-external")
+	assert.False(t, ok)
+
+	// 临时文件和备份均已清理
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	"assistant_agent/internal/config"
+	"assistant_agent/internal/fsutil"
 	"assistant_agent/internal/logger"
 )
 
@@ -19,6 +22,13 @@ type Manager struct {
 	agent     AgentInterface
 	config    *config.Config
 	plugins   map[string]*PluginInstance
+	events    *EventBus
+	extDir    string     // 外部插件目录，为空时不加载外部插件
+	registry  *pluginRegistry
+	reloadMu  sync.Mutex // 串行化外部插件重新加载
+
+	// mainConfigs 主配置文件 plugins 段的插件配置，覆盖插件配置文件中的同名键
+	mainConfigs map[string]map[string]interface{}
 	mu        sync.RWMutex
 	ctx       context.Context
 	cancel    context.CancelFunc
@@ -38,12 +48,14 @@ type PluginInstance struct {
 func NewManager(agent AgentInterface, cfg *config.Config) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Manager{
-		factories: make(map[string]PluginFactory),
-		agent:     agent,
-		config:    cfg,
-		plugins:   make(map[string]*PluginInstance),
-		ctx:       ctx,
-		cancel:    cancel,
+		factories:   make(map[string]PluginFactory),
+		agent:       agent,
+		config:      cfg,
+		plugins:     make(map[string]*PluginInstance),
+		events:      NewEventBus(),
+		mainConfigs: cfg.Plugins,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 }
 
@@ -62,11 +74,15 @@ func (m *Manager) Register(plugin Plugin) error {
 		return ErrPluginAlreadyExists
 	}
 
-	// 创建插件实例
+	// 创建插件实例，未配置数据目录时不持久化插件配置
+	configFile := ""
+	if m.config.Agent.DataDir != "" {
+		configFile = filepath.Join(m.config.Agent.DataDir, "plugins", fmt.Sprintf("%s.json", info.Name))
+	}
 	instance := &PluginInstance{
 		Plugin:     plugin,
 		Config:     make(map[string]interface{}),
-		ConfigFile: filepath.Join(m.config.Agent.DataDir, "plugins", fmt.Sprintf("%s.json", info.Name)),
+		ConfigFile: configFile,
 		Status: &PluginStatus{
 			Status:      "stopped",
 			StartTime:   time.Time{},
@@ -85,26 +101,32 @@ func (m *Manager) Register(plugin Plugin) error {
 }
 
 // Unregister 注销插件
+// 插件先从管理器移除，再在锁外停止，避免插件停止时回调 Agent 与管理器互相等待
 func (m *Manager) Unregister(pluginName string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	instance, exists := m.plugins[pluginName]
 	if !exists {
+		m.mu.Unlock()
 		return ErrPluginNotFound
 	}
+	running := instance.Status.Status == "running"
+
+	// 从管理器移除并取消事件订阅
+	delete(m.plugins, pluginName)
+	m.mu.Unlock()
+	m.events.Unsubscribe(pluginName)
 
 	// 停止插件
-	if instance.Status.Status == "running" {
+	if running {
 		if err := instance.Plugin.Stop(); err != nil {
 			logger.Warnf("Failed to stop plugin %s: %v", pluginName, err)
 		}
 	}
 
-	// 从管理器移除
-
-	// 从管理器移除
-	delete(m.plugins, pluginName)
+	// 外部插件同时结束插件进程
+	if external, ok := instance.Plugin.(*ExternalPlugin); ok {
+		external.Close()
+	}
 
 	logger.Infof("Plugin unregistered: %s", pluginName)
 	return nil
@@ -135,48 +157,61 @@ func (m *Manager) ListPlugins() []Plugin {
 }
 
 // StartPlugin 启动插件
+// 插件的 Init 和 Start 在管理器锁外执行，避免插件回调 Agent 时与管理器互相等待
 func (m *Manager) StartPlugin(name string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	instance, exists := m.plugins[name]
 	if !exists {
+		m.mu.Unlock()
 		return ErrPluginNotFound
 	}
-
-	if instance.Status.Status == "running" {
+	if instance.Status.Status == "running" || instance.Status.Status == "starting" {
+		m.mu.Unlock()
 		return ErrPluginAlreadyStarted
 	}
+	instance.Status.Status = "starting"
+	m.mu.Unlock()
 
-	// 加载配置
-	if err := m.LoadPluginConfig(name); err != nil {
+	// 加载配置，已保存的配置在初始化前应用到插件
+	if err := m.loadConfig(instance); err != nil {
 		logger.Warnf("Failed to load config for plugin %s: %v", name, err)
 	}
+	instance.mu.RLock()
+	saved := instance.Config
+	instance.mu.RUnlock()
+	if len(saved) > 0 {
+		if err := instance.Plugin.SetConfig(copyConfig(saved)); err != nil {
+			logger.Warnf("Failed to apply saved config for plugin %s: %v", name, err)
+		}
+	}
 
-	// 创建插件上下文
+	// 创建插件上下文，插件通过 NotifyEvent 发出的事件同时发布到事件总线
+	// 声明了权限的插件只能通过受限的 AgentInterface 访问 Agent
+	agent := newSandboxAgent(m.agent, name, m.pluginPermissions(name, instance.Plugin.Info()), m.config.Agent)
 	instance.Context = &PluginContext{
-		Agent:  m.agent,
-		Logger: &PluginLogger{pluginName: name},
+		Agent:  &pluginAgent{AgentInterface: agent, manager: m, name: name},
+		Logger: newPluginLogger(name),
+		Events: &pluginEvents{bus: m.events, name: name},
 	}
 
 	// 初始化插件
 	if err := instance.Plugin.Init(instance.Context); err != nil {
-		instance.Status.Status = "error"
-		instance.Status.LastError = err.Error()
+		m.setStatus(instance, "error", err)
 		return fmt.Errorf("failed to init plugin %s: %w", name, err)
 	}
 
 	// 启动插件
 	if err := instance.Plugin.Start(); err != nil {
-		instance.Status.Status = "error"
-		instance.Status.LastError = err.Error()
+		m.setStatus(instance, "error", err)
 		return fmt.Errorf("failed to start plugin %s: %w", name, err)
 	}
 
 	// 更新状态
+	m.mu.Lock()
 	instance.Status.Status = "running"
 	instance.Status.StartTime = time.Now()
 	instance.Status.LastError = ""
+	m.mu.Unlock()
 
 	logger.Infof("Plugin started: %s", name)
 	return nil
@@ -185,37 +220,48 @@ func (m *Manager) StartPlugin(name string) error {
 // StopPlugin 停止插件
 func (m *Manager) StopPlugin(name string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	instance, exists := m.plugins[name]
 	if !exists {
+		m.mu.Unlock()
 		return ErrPluginNotFound
 	}
-
 	if instance.Status.Status != "running" {
+		m.mu.Unlock()
 		return ErrPluginNotStarted
 	}
+	instance.Status.Status = "stopping"
+	m.mu.Unlock()
 
 	// 停止插件
 	if err := instance.Plugin.Stop(); err != nil {
-		instance.Status.Status = "error"
-		instance.Status.LastError = err.Error()
+		m.setStatus(instance, "error", err)
 		return fmt.Errorf("failed to stop plugin %s: %w", name, err)
 	}
 
 	// 保存配置
-	if err := m.SavePluginConfig(name); err != nil {
+	if err := m.saveConfig(instance); err != nil {
 		logger.Warnf("Failed to save config for plugin %s: %v", name, err)
 	}
 
 	// 更新状态
-	instance.Status.Status = "stopped"
-	instance.Status.LastError = ""
+	m.setStatus(instance, "stopped", nil)
 
 	logger.Infof("Plugin stopped: %s", name)
 	return nil
 }
 
+// setStatus 更新插件状态，err 不为空时记录为最近错误
+func (m *Manager) setStatus(instance *PluginInstance, status string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	instance.Status.Status = status
+	instance.Status.LastError = ""
+	if err != nil {
+		instance.Status.LastError = err.Error()
+	}
+}
+
 // StartAll 启动所有插件
 func (m *Manager) StartAll() error {
 	m.mu.RLock()
@@ -297,19 +343,39 @@ func (m *Manager) GetAllPluginStatus() map[string]*PluginStatus {
 
 // SendCommand 发送命令到插件
 func (m *Manager) SendCommand(pluginName, command string, args map[string]interface{}) (interface{}, error) {
+	instance, args, err := m.prepareCommand(pluginName, command, args)
+	if err != nil {
+		return nil, err
+	}
+	return instance.Plugin.HandleCommand(command, args)
+}
+
+// ValidateCommand 检查插件是否存在并运行，按插件声明校验命令参数，不执行命令。
+// 供需要先同步返回参数错误、再在后台执行命令的调用方使用
+func (m *Manager) ValidateCommand(pluginName, command string, args map[string]interface{}) error {
+	_, _, err := m.prepareCommand(pluginName, command, args)
+	return err
+}
+
+// prepareCommand 查找运行中的插件并按其声明的命令参数校验、转换参数
+func (m *Manager) prepareCommand(pluginName, command string, args map[string]interface{}) (*PluginInstance, map[string]interface{}, error) {
 	m.mu.RLock()
 	instance, exists := m.plugins[pluginName]
 	m.mu.RUnlock()
 
 	if !exists {
-		return nil, ErrPluginNotFound
+		return nil, nil, ErrPluginNotFound
 	}
 
-	if instance.Status.Status != "running" {
-		return nil, ErrPluginNotStarted
+	if !m.isRunning(instance) {
+		return nil, nil, ErrPluginNotStarted
 	}
 
-	return instance.Plugin.HandleCommand(command, args)
+	args, err := validateCommand(pluginName, instance.Plugin, command, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return instance, args, nil
 }
 
 // SendEvent 发送事件到插件
@@ -322,13 +388,29 @@ func (m *Manager) SendEvent(pluginName, eventType string, data map[string]interf
 		return ErrPluginNotFound
 	}
 
-	if instance.Status.Status != "running" {
+	if !m.isRunning(instance) {
 		return ErrPluginNotStarted
 	}
 
 	return instance.Plugin.HandleEvent(eventType, data)
 }
 
+// isRunning 判断插件是否在运行，未经管理器启动的插件以插件自身上报的状态为准
+func (m *Manager) isRunning(instance *PluginInstance) bool {
+	m.mu.RLock()
+	status := instance.Status.Status
+	m.mu.RUnlock()
+
+	if status == "running" {
+		return true
+	}
+	if status != "stopped" {
+		return false
+	}
+	reported := instance.Plugin.Status()
+	return reported != nil && reported.Status == "running"
+}
+
 // LoadPluginConfig 加载插件配置
 func (m *Manager) LoadPluginConfig(name string) error {
 	m.mu.RLock()
@@ -338,34 +420,128 @@ func (m *Manager) LoadPluginConfig(name string) error {
 	if !exists {
 		return ErrPluginNotFound
 	}
+	return m.loadConfig(instance)
+}
 
-	// 确保配置目录存在
-	configDir := filepath.Dir(instance.ConfigFile)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+// loadConfig 从配置文件加载插件配置，再合并主配置文件中的插件配置
+func (m *Manager) loadConfig(instance *PluginInstance) error {
+	config, err := m.readConfig(instance)
+	if err != nil || config == nil {
 		return err
 	}
 
-	// 读取配置文件
-	data, err := os.ReadFile(instance.ConfigFile)
+	instance.mu.Lock()
+	instance.Config = config
+	instance.mu.Unlock()
+
+	return nil
+}
+
+// readConfig 读取插件配置文件并合并主配置文件中的插件配置，都没有时返回 nil
+func (m *Manager) readConfig(instance *PluginInstance) (map[string]interface{}, error) {
+	var config map[string]interface{}
+	if instance.ConfigFile != "" {
+		// 确保配置目录存在
+		if err := os.MkdirAll(filepath.Dir(instance.ConfigFile), 0755); err != nil {
+			return nil, err
+		}
+
+		// 读取配置文件，不存在时使用默认配置
+		var err error
+		if config, err = readConfigFile(instance.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+
+	overlay := m.mainConfig(instance.Plugin.Info().Name)
+	if len(overlay) == 0 {
+		return config, nil
+	}
+	if config == nil {
+		config = make(map[string]interface{}, len(overlay))
+	}
+	for key, value := range overlay {
+		config[key] = value
+	}
+	return config, nil
+}
+
+// SetMainConfigs 更新主配置文件中的插件配置，配置热加载时调用，随后通过 ReloadConfigs 应用
+func (m *Manager) SetMainConfigs(configs map[string]map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mainConfigs = configs
+}
+
+// mainConfig 返回主配置文件中指定插件的配置
+func (m *Manager) mainConfig(name string) map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.mainConfigs[name]
+}
+
+// readConfigFile 读取插件配置文件，文件不存在时返回 nil
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// 配置文件不存在，使用默认配置
-			return nil
+			return nil, nil
 		}
-		return err
+		return nil, err
 	}
 
-	// 解析配置
 	var config map[string]interface{}
 	if err := json.Unmarshal(data, &config); err != nil {
-		return err
+		return nil, err
 	}
+	return config, nil
+}
 
-	instance.mu.Lock()
-	instance.Config = config
-	instance.mu.Unlock()
+// ReloadConfigs 重新读取所有插件的配置文件和主配置文件中的插件配置，内容变化的插件校验后通过 SetConfig 应用，
+// 返回应用了新配置的插件名。用于配置热加载，插件不会重启
+func (m *Manager) ReloadConfigs() []string {
+	m.mu.RLock()
+	instances := make(map[string]*PluginInstance, len(m.plugins))
+	for name, instance := range m.plugins {
+		instances[name] = instance
+	}
+	m.mu.RUnlock()
 
-	return nil
+	changed := make([]string, 0)
+	for name, instance := range instances {
+		config, err := m.readConfig(instance)
+		if err != nil {
+			logger.Warnf("Failed to reload config for plugin %s: %v", name, err)
+			continue
+		}
+		if config == nil {
+			continue
+		}
+
+		instance.mu.RLock()
+		unchanged := reflect.DeepEqual(config, instance.Config)
+		instance.mu.RUnlock()
+		if unchanged {
+			continue
+		}
+
+		if validator, ok := instance.Plugin.(ConfigValidator); ok {
+			if err := validator.ValidateConfig(config); err != nil {
+				logger.Warnf("Ignoring invalid config for plugin %s: %v", name, err)
+				continue
+			}
+		}
+		if err := instance.Plugin.SetConfig(copyConfig(config)); err != nil {
+			logger.Warnf("Failed to apply config for plugin %s: %v", name, err)
+			continue
+		}
+		instance.mu.Lock()
+		instance.Config = config
+		instance.mu.Unlock()
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	return changed
 }
 
 // SavePluginConfig 保存插件配置
@@ -377,16 +553,92 @@ func (m *Manager) SavePluginConfig(name string) error {
 	if !exists {
 		return ErrPluginNotFound
 	}
+	return m.saveConfig(instance)
+}
+
+// UpdatePluginConfig 更新插件配置：合并到当前配置（值为 nil 的键被删除），
+// 校验后通过 SetConfig 应用并写入配置文件，restart 为 true 且插件正在运行时重启插件
+func (m *Manager) UpdatePluginConfig(name string, update map[string]interface{}, restart bool) (map[string]interface{}, error) {
+	if len(update) == 0 {
+		return nil, fmt.Errorf("%w: no config values", ErrPluginConfigInvalid)
+	}
 
-	// 获取插件配置
-	config := instance.Plugin.GetConfig()
-	if config == nil {
-		config = make(map[string]interface{})
+	m.mu.RLock()
+	instance, exists := m.plugins[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrPluginNotFound
 	}
 
-	// 确保配置目录存在
+	// 合并配置
+	merged := copyConfig(instance.Plugin.GetConfig())
+	for key, value := range update {
+		if key == "" {
+			return nil, fmt.Errorf("%w: empty config key", ErrPluginConfigInvalid)
+		}
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+
+	// 校验并应用
+	if validator, ok := instance.Plugin.(ConfigValidator); ok {
+		if err := validator.ValidateConfig(merged); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPluginConfigInvalid, err)
+		}
+	}
+	if err := instance.Plugin.SetConfig(copyConfig(merged)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPluginConfigInvalid, err)
+	}
+
+	instance.mu.Lock()
+	instance.Config = merged
+	instance.mu.Unlock()
+
+	if err := m.saveConfig(instance); err != nil {
+		return merged, fmt.Errorf("config applied but not saved: %w", err)
+	}
+	logger.Infof("Plugin config updated: %s", name)
+
+	if restart && m.isRunning(instance) {
+		if err := m.StopPlugin(name); err != nil && err != ErrPluginNotStarted {
+			return merged, err
+		}
+		if err := m.StartPlugin(name); err != nil {
+			return merged, err
+		}
+	}
+
+	return merged, nil
+}
+
+// copyConfig 复制配置，避免插件与管理器共享同一个 map
+func copyConfig(config map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(config))
+	for key, value := range config {
+		result[key] = value
+	}
+	return result
+}
+
+// saveConfig 将插件当前配置写入配置文件
+func (m *Manager) saveConfig(instance *PluginInstance) error {
+	if instance.ConfigFile == "" {
+		return nil
+	}
+
+	// 获取插件配置，主配置文件中的键以主配置文件为准，不写入插件配置文件（其中可能有解密后的密钥）
+	config := copyConfig(instance.Plugin.GetConfig())
+	for key := range m.mainConfig(instance.Plugin.Info().Name) {
+		delete(config, key)
+	}
+
+	// 确保配置目录存在，服务器下发的配置中可能有凭据，只允许 Agent 用户访问
 	configDir := filepath.Dir(instance.ConfigFile)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
 		return err
 	}
 
@@ -396,8 +648,8 @@ func (m *Manager) SavePluginConfig(name string) error {
 		return err
 	}
 
-	// 写入配置文件
-	return os.WriteFile(instance.ConfigFile, data, 0644)
+	// 原子地写入配置文件，写到一半崩溃时保留原配置
+	return fsutil.WriteFileAtomic(instance.ConfigFile, data, 0600)
 }
 
 // RegisterFactory 注册插件工厂
@@ -424,41 +676,60 @@ func (m *Manager) CreatePlugin(pluginType string, config map[string]interface{})
 func (m *Manager) Stop() {
 	m.cancel()
 	m.StopAll()
+
+	// 结束所有外部插件进程
+	m.mu.RLock()
+	externals := make([]*ExternalPlugin, 0)
+	for _, instance := range m.plugins {
+		if external, ok := instance.Plugin.(*ExternalPlugin); ok {
+			externals = append(externals, external)
+		}
+	}
+	m.mu.RUnlock()
+	for _, external := range externals {
+		external.Close()
+	}
 }
 
-// PluginLogger 插件日志适配器
+// PluginLogger 插件日志适配器，组件名为插件名，可通过 logging.components 单独设置插件的日志级别
 type PluginLogger struct {
 	pluginName string
+	log        *logger.Logger
+}
+
+// newPluginLogger 创建插件日志
+func newPluginLogger(name string) *PluginLogger {
+	return &PluginLogger{pluginName: name, log: logger.Component(name)}
 }
 
 func (l *PluginLogger) Debug(args ...interface{}) {
-	logger.Debugf("[Plugin:%s] %v", l.pluginName, args)
+	l.log.Debugf("[Plugin:%s] %v", l.pluginName, args)
 }
 
 func (l *PluginLogger) Info(args ...interface{}) {
-	logger.Infof("[Plugin:%s] %v", l.pluginName, args)
+	l.log.Infof("[Plugin:%s] %v", l.pluginName, args)
 }
 
 func (l *PluginLogger) Warn(args ...interface{}) {
-	logger.Warnf("[Plugin:%s] %v", l.pluginName, args)
+	l.log.Warnf("[Plugin:%s] %v", l.pluginName, args)
 }
 
 func (l *PluginLogger) Error(args ...interface{}) {
-	logger.Errorf("[Plugin:%s] %v", l.pluginName, args)
+	l.log.Errorf("[Plugin:%s] %v", l.pluginName, args)
 }
 
 func (l *PluginLogger) Debugf(format string, args ...interface{}) {
-	logger.Debugf("[Plugin:%s] "+format, append([]interface{}{l.pluginName}, args...)...)
+	l.log.Debugf("[Plugin:%s] "+format, append([]interface{}{l.pluginName}, args...)...)
 }
 
 func (l *PluginLogger) Infof(format string, args ...interface{}) {
-	logger.Infof("[Plugin:%s] "+format, append([]interface{}{l.pluginName}, args...)...)
+	l.log.Infof("[Plugin:%s] "+format, append([]interface{}{l.pluginName}, args...)...)
 }
 
 func (l *PluginLogger) Warnf(format string, args ...interface{}) {
-	logger.Warnf("[Plugin:%s] "+format, append([]interface{}{l.pluginName}, args...)...)
+	l.log.Warnf("[Plugin:%s] "+format, append([]interface{}{l.pluginName}, args...)...)
 }
 
 func (l *PluginLogger) Errorf(format string, args ...interface{}) {
-	logger.Errorf("[Plugin:%s] "+format, append([]interface{}{l.pluginName}, args...)...)
+	l.log.Errorf("[Plugin:%s] "+format, append([]interface{}{l.pluginName}, args...)...)
 }
@@ -1,10 +1,18 @@
 package plugin
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
 	"assistant_agent/internal/config"
+	"assistant_agent/internal/executor"
 	"assistant_agent/internal/logger"
 
 	"github.com/stretchr/testify/assert"
@@ -30,6 +38,26 @@ func (m *MockAgent) ExecuteCommand(command string, args []string, timeout time.D
 	return "command executed", nil
 }
 
+func (m *MockAgent) ExecuteScript(ref string, args []string, timeout time.Duration) (string, error) {
+	return "script executed", nil
+}
+
+func (m *MockAgent) ExecuteCommandContext(ctx context.Context, command string, args []string, timeout time.Duration) (string, error) {
+	return m.ExecuteCommand(command, args, timeout)
+}
+
+func (m *MockAgent) ExecuteScriptContext(ctx context.Context, ref string, args []string, timeout time.Duration) (string, error) {
+	return m.ExecuteScript(ref, args, timeout)
+}
+
+func (m *MockAgent) RunCommand(ctx context.Context, cmd *executor.Command) (*executor.Result, error) {
+	return &executor.Result{ID: cmd.ID, Success: true, Stdout: "command executed"}, nil
+}
+
+func (m *MockAgent) CallServer(msgType string, data interface{}, timeout time.Duration) (interface{}, error) {
+	return nil, nil
+}
+
 func (m *MockAgent) ReadFile(path string) ([]byte, error) {
 	return []byte("test content"), nil
 }
@@ -490,3 +518,153 @@ func TestManagerErrorCases(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, ErrPluginNotStarted, err)
 }
+
+// validatingPlugin 校验配置的插件，interval 必须为正数
+type validatingPlugin struct {
+	MockPlugin
+	inits int
+}
+
+func (p *validatingPlugin) Init(ctx *PluginContext) error {
+	p.inits++
+	return nil
+}
+
+func (p *validatingPlugin) ValidateConfig(config map[string]interface{}) error {
+	if interval, ok := config["interval"].(float64); ok && interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	return nil
+}
+
+func TestManagerUpdatePluginConfig(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	cfg := &config.Config{Agent: config.AgentConfig{DataDir: t.TempDir()}}
+	manager := NewManager(&MockAgent{config: make(map[string]interface{})}, cfg)
+	plugin := &validatingPlugin{MockPlugin: MockPlugin{
+		info:   &PluginInfo{Name: "monitor", Version: "1.0.0"},
+		status: &PluginStatus{Status: "stopped"},
+		config: map[string]interface{}{"interval": 30.0, "legacy": true},
+	}}
+	require.NoError(t, manager.Register(plugin))
+	require.NoError(t, manager.StartPlugin("monitor"))
+
+	// 合并配置，值为 nil 的键被删除
+	updated, err := manager.UpdatePluginConfig("monitor", map[string]interface{}{"cpu_threshold": 90.0, "legacy": nil}, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"interval": 30.0, "cpu_threshold": 90.0}, updated)
+	assert.Equal(t, updated, plugin.GetConfig())
+	assert.Equal(t, 1, plugin.inits)
+
+	// 保存的配置中可能有服务器下发的凭据，只有 Agent 用户可读
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(cfg.Agent.DataDir, "plugins", "monitor.json"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// 校验失败时不应用
+	_, err = manager.UpdatePluginConfig("monitor", map[string]interface{}{"interval": -1.0}, false)
+	assert.True(t, errors.Is(err, ErrPluginConfigInvalid))
+	assert.Equal(t, 30.0, plugin.GetConfig()["interval"])
+
+	_, err = manager.UpdatePluginConfig("monitor", nil, false)
+	assert.True(t, errors.Is(err, ErrPluginConfigInvalid))
+	_, err = manager.UpdatePluginConfig("missing", map[string]interface{}{"a": 1}, false)
+	assert.Equal(t, ErrPluginNotFound, err)
+
+	// 重启后使用已保存的配置
+	_, err = manager.UpdatePluginConfig("monitor", map[string]interface{}{"interval": 60.0}, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, plugin.inits)
+	assert.Equal(t, "running", plugin.Status().Status)
+
+	data, err := os.ReadFile(filepath.Join(cfg.Agent.DataDir, "plugins", "monitor.json"))
+	require.NoError(t, err)
+	var saved map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &saved))
+	assert.Equal(t, map[string]interface{}{"interval": 60.0, "cpu_threshold": 90.0}, saved)
+
+	// 重新创建管理器和插件（Agent 重启）时应用已保存的配置
+	restarted := NewManager(&MockAgent{config: make(map[string]interface{})}, cfg)
+	fresh := &validatingPlugin{MockPlugin: MockPlugin{
+		info:   &PluginInfo{Name: "monitor", Version: "1.0.0"},
+		status: &PluginStatus{Status: "stopped"},
+	}}
+	require.NoError(t, restarted.Register(fresh))
+	require.NoError(t, restarted.StartPlugin("monitor"))
+	assert.Equal(t, saved, fresh.GetConfig())
+}
+
+func TestManagerReloadConfigs(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	cfg := &config.Config{Agent: config.AgentConfig{DataDir: t.TempDir()}}
+	manager := NewManager(&MockAgent{config: make(map[string]interface{})}, cfg)
+	plugin := &validatingPlugin{MockPlugin: MockPlugin{
+		info:   &PluginInfo{Name: "monitor", Version: "1.0.0"},
+		status: &PluginStatus{Status: "stopped"},
+		config: map[string]interface{}{"interval": 30.0},
+	}}
+	require.NoError(t, manager.Register(plugin))
+	require.NoError(t, manager.StartPlugin("monitor"))
+
+	// 没有配置文件时不变
+	assert.Empty(t, manager.ReloadConfigs())
+
+	// 配置文件变化后应用新配置，插件不重启
+	configFile := filepath.Join(cfg.Agent.DataDir, "plugins", "monitor.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(configFile), 0755))
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"interval": 60}`), 0644))
+	assert.Equal(t, []string{"monitor"}, manager.ReloadConfigs())
+	assert.Equal(t, 60.0, plugin.GetConfig()["interval"])
+	assert.Equal(t, 1, plugin.inits)
+	assert.Empty(t, manager.ReloadConfigs())
+
+	// 校验失败或无法解析时保留原配置
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"interval": -1}`), 0644))
+	assert.Empty(t, manager.ReloadConfigs())
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"interval":`), 0644))
+	assert.Empty(t, manager.ReloadConfigs())
+	assert.Equal(t, 60.0, plugin.GetConfig()["interval"])
+}
+
+func TestManagerMainConfigs(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	cfg := &config.Config{
+		Agent:   config.AgentConfig{DataDir: t.TempDir()},
+		Plugins: map[string]map[string]interface{}{"monitor": {"interval": 45.0, "token": "s3cret"}},
+	}
+	configFile := filepath.Join(cfg.Agent.DataDir, "plugins", "monitor.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(configFile), 0755))
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"interval": 60, "threshold": 80}`), 0644))
+
+	manager := NewManager(&MockAgent{config: make(map[string]interface{})}, cfg)
+	plugin := &validatingPlugin{MockPlugin: MockPlugin{
+		info:   &PluginInfo{Name: "monitor", Version: "1.0.0"},
+		status: &PluginStatus{Status: "stopped"},
+	}}
+	require.NoError(t, manager.Register(plugin))
+
+	// 主配置文件中的键覆盖插件配置文件
+	require.NoError(t, manager.StartPlugin("monitor"))
+	assert.Equal(t, map[string]interface{}{"interval": 45.0, "threshold": 80.0, "token": "s3cret"}, plugin.GetConfig())
+
+	// 主配置文件中的键不写入插件配置文件
+	require.NoError(t, manager.StopPlugin("monitor"))
+	data, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"threshold": 80}`, string(data))
+
+	// 热加载时应用新的主配置
+	require.NoError(t, manager.StartPlugin("monitor"))
+	assert.Empty(t, manager.ReloadConfigs())
+	manager.SetMainConfigs(map[string]map[string]interface{}{"monitor": {"interval": 90.0}})
+	assert.Equal(t, []string{"monitor"}, manager.ReloadConfigs())
+	assert.Equal(t, map[string]interface{}{"interval": 90.0, "threshold": 80.0}, plugin.GetConfig())
+}
@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// defaultAlertCooldown 告警恢复后再次触发时不重复通知的时间
+	defaultAlertCooldown = 5 * time.Minute
+	// resolvedAlertRetention 已恢复的告警保留时间，超过后从告警列表中删除
+	resolvedAlertRetention = 24 * time.Hour
+)
+
+// triggerAlertLocked 保存告警并发送 alert_triggered 事件，extra 中的字段附加到事件
+// 同一告警已处于活动状态时只更新当前值和注解；恢复后 alert_cooldown 内再次触发时重新激活原告警，
+// 仍发送事件但不再通知，调用方需持有 p.mu
+func (p *MonitorPlugin) triggerAlertLocked(alert *AlertInfo, extra map[string]interface{}) {
+	existing, exists := p.alerts[alert.ID]
+	if exists && existing.Status != "resolved" {
+		existing.Current = alert.Current
+		existing.UpdatedAt = alert.CreatedAt
+		for key, value := range alert.Annotations {
+			existing.Annotations[key] = value
+		}
+		return
+	}
+
+	cooldown := plugin.ConfigDuration(p.config, "alert_cooldown", defaultAlertCooldown)
+	suppressed := exists && alert.CreatedAt.Sub(existing.ResolvedAt) < cooldown
+	if suppressed {
+		existing.Status = "active"
+		existing.ResolvedAt = time.Time{}
+		existing.Message = alert.Message
+		existing.Current = alert.Current
+		existing.UpdatedAt = alert.CreatedAt
+		existing.Occurrences++
+		existing.notified = false
+		for key, value := range alert.Annotations {
+			existing.Annotations[key] = value
+		}
+		alert = existing
+	} else {
+		alert.UpdatedAt = alert.CreatedAt
+		alert.Occurrences = 1
+		if exists {
+			alert.Occurrences = existing.Occurrences + 1
+		}
+		p.alerts[alert.ID] = alert
+	}
+
+	// 发送告警事件
+	data := map[string]interface{}{
+		"alert_id":    alert.ID,
+		"name":        alert.Name,
+		"severity":    alert.Severity,
+		"message":     alert.Message,
+		"metric":      alert.Metric,
+		"threshold":   alert.Threshold,
+		"current":     alert.Current,
+		"occurrences": alert.Occurrences,
+		"suppressed":  suppressed,
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+	p.ctx.Agent.NotifyEvent("alert_triggered", data)
+
+	if suppressed {
+		p.ctx.Logger.Infof("Alert re-triggered within cooldown, notification suppressed: %s", alert.Message)
+		return
+	}
+	alert.notified = p.notifyLocked(alert, "triggered")
+	p.ctx.Logger.Warnf("Alert triggered: %s", alert.Message)
+}
+
+// resolveAlertLocked 恢复告警并发送 alert_resolved 事件，触发时发送过通知的告警同时发送恢复通知
+// 调用方需持有 p.mu
+func (p *MonitorPlugin) resolveAlertLocked(alert *AlertInfo, now time.Time, reason string) {
+	alert.Status = "resolved"
+	alert.ResolvedAt = now
+	alert.UpdatedAt = now
+
+	p.ctx.Agent.NotifyEvent("alert_resolved", map[string]interface{}{
+		"alert_id": alert.ID,
+		"name":     alert.Name,
+		"severity": alert.Severity,
+		"reason":   reason,
+		"duration": now.Sub(alert.CreatedAt).Seconds(),
+	})
+	if alert.notified {
+		p.notifyLocked(alert, "resolved")
+		alert.notified = false
+	}
+
+	p.ctx.Logger.Infof("Alert resolved (%s): %s", reason, alert.Name)
+}
+
+// escalateAfterLocked 返回告警的升级时间，规则的 escalate_after 优先于插件配置，为 0 时不升级
+func (p *MonitorPlugin) escalateAfterLocked(alert *AlertInfo) time.Duration {
+	if rule, exists := p.rules[alert.Rule]; exists && rule.EscalateAfter != "" {
+		d, _ := time.ParseDuration(rule.EscalateAfter)
+		return d
+	}
+	return plugin.ConfigDuration(p.config, "escalate_after", 0)
+}
+
+// nextSeverity 返回高一级的告警级别，已是最高级别时返回空
+func nextSeverity(severity string) string {
+	for i, s := range ruleSeverities {
+		if s == severity && i+1 < len(ruleSeverities) {
+			return ruleSeverities[i+1]
+		}
+	}
+	return ""
+}
+
+// escalateAlertsLocked 提升持续未确认的告警级别，每经过一次升级时间提升一级直到 critical
+// 升级后发送 alert_escalated 事件和通知，调用方需持有 p.mu
+func (p *MonitorPlugin) escalateAlertsLocked(now time.Time) {
+	for _, alert := range p.alerts {
+		if alert.Status != "active" {
+			continue
+		}
+		after := p.escalateAfterLocked(alert)
+		if after <= 0 {
+			continue
+		}
+		since := alert.CreatedAt
+		if !alert.EscalatedAt.IsZero() {
+			since = alert.EscalatedAt
+		}
+		severity := nextSeverity(alert.Severity)
+		if severity == "" || now.Sub(since) < after {
+			continue
+		}
+
+		if alert.OriginalSeverity == "" {
+			alert.OriginalSeverity = alert.Severity
+		}
+		previous := alert.Severity
+		alert.Severity = severity
+		alert.EscalatedAt = now
+		alert.UpdatedAt = now
+
+		p.ctx.Agent.NotifyEvent("alert_escalated", map[string]interface{}{
+			"alert_id":          alert.ID,
+			"name":              alert.Name,
+			"severity":          alert.Severity,
+			"previous_severity": previous,
+			"message":           alert.Message,
+		})
+		if p.notifyLocked(alert, "escalated") {
+			alert.notified = true
+		}
+		p.ctx.Logger.Warnf("Alert escalated from %s to %s: %s", previous, alert.Severity, alert.Message)
+	}
+}
+
+// maintainAlerts 定期升级告警并删除恢复超过 24 小时的告警
+func (p *MonitorPlugin) maintainAlerts(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.escalateAlertsLocked(now)
+	for id, alert := range p.alerts {
+		if alert.Status == "resolved" && now.Sub(alert.ResolvedAt) > resolvedAlertRetention {
+			delete(p.alerts, id)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// checksFileName 服务检查配置文件，位于 Agent 数据目录
+const checksFileName = "monitor_checks.json"
+
+// 服务检查默认间隔和超时
+const (
+	defaultCheckInterval = time.Minute
+	defaultCheckTimeout  = 10 * time.Second
+)
+
+// checkTypes 支持的检查类型
+var checkTypes = []string{"http", "tcp", "icmp"}
+
+// ServiceCheck 服务检查：http 请求 URL，tcp 连接 host:port，icmp ping 主机
+type ServiceCheck struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Target       string `json:"target"`
+	Interval     string `json:"interval,omitempty"`      // 默认 1m
+	Timeout      string `json:"timeout,omitempty"`       // 默认 10s
+	Method       string `json:"method,omitempty"`        // http 请求方法，默认 GET
+	ExpectStatus int    `json:"expect_status,omitempty"` // http 期望的状态码，为 0 时小于 400 即成功
+}
+
+// CheckResult 最近一次检查结果
+type CheckResult struct {
+	Up         bool      `json:"up"`
+	Latency    float64   `json:"latency"` // 秒
+	StatusCode int       `json:"status_code,omitempty"`
+	CertExpiry time.Time `json:"cert_expiry,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Failures   int       `json:"failures"` // 连续失败次数
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// CheckView 检查及其最近一次结果
+type CheckView struct {
+	*ServiceCheck
+	Result *CheckResult `json:"result,omitempty"`
+}
+
+// checkState 检查的运行状态
+type checkState struct {
+	check   *ServiceCheck
+	result  *CheckResult
+	nextRun time.Time
+	running bool
+}
+
+func (c *ServiceCheck) interval() time.Duration {
+	if d, err := time.ParseDuration(c.Interval); err == nil && d > 0 {
+		return d
+	}
+	return defaultCheckInterval
+}
+
+func (c *ServiceCheck) timeout() time.Duration {
+	if d, err := time.ParseDuration(c.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultCheckTimeout
+}
+
+// validate 校验检查配置
+func (c *ServiceCheck) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !containsString(checkTypes, c.Type) {
+		return fmt.Errorf("invalid check type: %q", c.Type)
+	}
+	if c.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+	for _, d := range []string{c.Interval, c.Timeout} {
+		if d == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+			return fmt.Errorf("invalid duration: %q", d)
+		}
+	}
+
+	switch c.Type {
+	case "http":
+		u, err := url.Parse(c.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url: %q", c.Target)
+		}
+	case "tcp":
+		if _, _, err := net.SplitHostPort(c.Target); err != nil {
+			return fmt.Errorf("invalid address: %q, expected host:port", c.Target)
+		}
+	}
+	return nil
+}
+
+// probe 执行一次检查，返回的结果不包括连续失败次数
+func (p *MonitorPlugin) probe(ctx context.Context, check *ServiceCheck) *CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout())
+	defer cancel()
+
+	result := &CheckResult{CheckedAt: time.Now()}
+	var err error
+	switch check.Type {
+	case "http":
+		err = p.probeHTTP(ctx, check, result)
+	case "tcp":
+		var conn net.Conn
+		var dialer net.Dialer
+		if conn, err = dialer.DialContext(ctx, "tcp", check.Target); err == nil {
+			conn.Close()
+		}
+	case "icmp":
+		err = pingICMP(ctx, check.Target)
+	}
+	result.Latency = time.Since(result.CheckedAt).Seconds()
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Up = true
+	}
+	return result
+}
+
+// probeHTTP 请求 URL 并检查状态码，https 时记录证书过期时间
+func (p *MonitorPlugin) probeHTTP(ctx context.Context, check *ServiceCheck, result *CheckResult) error {
+	method := check.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, check.Target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "assistant_agent-monitor")
+
+	client := &http.Client{Transport: p.checkTransport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	result.StatusCode = resp.StatusCode
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.CertExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+	if check.ExpectStatus != 0 && resp.StatusCode != check.ExpectStatus {
+		return fmt.Errorf("unexpected status code %d, expected %d", resp.StatusCode, check.ExpectStatus)
+	}
+	if check.ExpectStatus == 0 && resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pingICMP 发送一个 ICMP Echo 请求并等待应答
+// 优先使用非特权 ICMP 套接字（Linux 需 ping_group_range 允许，macOS 默认允许），失败时使用原始套接字（需 root 或管理员权限）
+func pingICMP(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no address for %s", host)
+	}
+	ip := addrs[0].IP
+
+	udpNetwork, rawNetwork, protocol := "udp4", "ip4:icmp", 1
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if ip.To4() == nil {
+		udpNetwork, rawNetwork, protocol = "udp6", "ip6:ipv6-icmp", 58
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	conn, err := icmp.ListenPacket(udpNetwork, "")
+	if err != nil {
+		if conn, err = icmp.ListenPacket(rawNetwork, ""); err != nil {
+			return fmt.Errorf("failed to open icmp socket: %v", err)
+		}
+		dst = &net.IPAddr{IP: ip}
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// 非特权套接字由内核改写 ID，只按序号匹配应答
+	seq := rand.Intn(0xffff)
+	msg := icmp.Message{Type: echoType, Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: seq, Data: []byte("assistant_agent")}}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(data, dst); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq {
+			return nil
+		}
+	}
+}
+
+// checkSamples 将检查结果转换为指标
+func checkSamples(check *ServiceCheck, result *CheckResult, now time.Time) []sample {
+	labels := map[string]string{"check": check.Name, "type": check.Type, "target": check.Target}
+	up := 0.0
+	if result.Up {
+		up = 1
+	}
+	samples := []sample{
+		{Name: "check_up", Value: up, Labels: labels},
+		{Name: "check_latency", Value: result.Latency, Unit: "seconds", Labels: labels},
+		{Name: "check_failures", Value: float64(result.Failures), Unit: "count", Labels: labels},
+	}
+	if result.StatusCode != 0 {
+		samples = append(samples, sample{Name: "check_status_code", Value: float64(result.StatusCode), Labels: labels})
+	}
+	if !result.CertExpiry.IsZero() {
+		samples = append(samples, sample{Name: "check_cert_expiry_days", Value: result.CertExpiry.Sub(now).Hours() / 24, Unit: "days", Labels: labels})
+	}
+	return samples
+}
+
+// runCheck 执行检查并记录结果和指标
+func (p *MonitorPlugin) runCheck(ctx context.Context, check *ServiceCheck) *CheckResult {
+	result := p.probe(ctx, check)
+
+	p.mu.Lock()
+	state, exists := p.checks[check.Name]
+	if exists && state.check == check {
+		if !result.Up {
+			result.Failures = 1
+			if state.result != nil {
+				result.Failures = state.result.Failures + 1
+			}
+		}
+		state.result = result
+		state.running = false
+		state.nextRun = result.CheckedAt.Add(check.interval())
+	}
+	p.mu.Unlock()
+
+	// 检查已被删除或修改时不再记录指标
+	if exists && state.check == check {
+		p.recordSamples("check/"+check.Name, checkSamples(check, result, time.Now()), time.Now())
+		if !result.Up {
+			p.ctx.Logger.Debugf("Service check %s failed: %s", check.Name, result.Error)
+		}
+	}
+	return result
+}
+
+// runChecks 每秒调度到期的检查，同一检查不会并发执行
+func (p *MonitorPlugin) runChecks(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		p.mu.Lock()
+		for _, state := range p.checks {
+			if !state.running && !now.Before(state.nextRun) {
+				state.running = true
+				go p.runCheck(ctx, state.check)
+			}
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// handleAddCheck 处理添加服务检查命令
+func (p *MonitorPlugin) handleAddCheck(args map[string]interface{}) (interface{}, error) {
+	check := &ServiceCheck{}
+	check.Name, _ = args["name"].(string)
+	check.Type, _ = args["type"].(string)
+	check.Target, _ = args["target"].(string)
+	check.Interval, _ = args["interval"].(string)
+	check.Timeout, _ = args["timeout"].(string)
+	if v, ok := args["method"].(string); ok {
+		check.Method = strings.ToUpper(strings.TrimSpace(v))
+	}
+	if v, ok := args["expect_status"].(float64); ok {
+		check.ExpectStatus = int(v)
+	}
+	if err := check.validate(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if _, exists := p.checks[check.Name]; exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("check %s already exists", check.Name)
+	}
+	p.checks[check.Name] = &checkState{check: check}
+	p.mu.Unlock()
+
+	if err := p.saveChecks(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save service checks: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    check.Name,
+		"check":   check,
+		"message": "Check added successfully",
+	}, nil
+}
+
+// handleRemoveCheck 处理移除服务检查命令，同时删除检查的指标
+func (p *MonitorPlugin) handleRemoveCheck(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["name"].(string)
+
+	p.mu.Lock()
+	if _, exists := p.checks[name]; !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("check %s not found", name)
+	}
+	delete(p.checks, name)
+	p.mu.Unlock()
+
+	p.recordSamples("check/"+name, nil, time.Now())
+	if err := p.saveChecks(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save service checks: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"message": "Check removed successfully",
+	}, nil
+}
+
+// handleGetChecks 处理获取服务检查命令，按名称排序
+func (p *MonitorPlugin) handleGetChecks(args map[string]interface{}) (interface{}, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	checks := make([]*CheckView, 0, len(p.checks))
+	for _, state := range p.checks {
+		checks = append(checks, &CheckView{ServiceCheck: state.check, Result: state.result})
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+	return map[string]interface{}{
+		"checks": checks,
+		"count":  len(checks),
+	}, nil
+}
+
+// handleRunCheck 处理立即执行服务检查命令
+func (p *MonitorPlugin) handleRunCheck(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["name"].(string)
+
+	p.mu.Lock()
+	state, exists := p.checks[name]
+	if !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("check %s not found", name)
+	}
+	if state.running {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("check %s is already running", name)
+	}
+	state.running = true
+	check := state.check
+	p.mu.Unlock()
+
+	return map[string]interface{}{
+		"name":   name,
+		"result": p.runCheck(context.Background(), check),
+	}, nil
+}
+
+// loadChecks 从数据目录加载服务检查
+func (p *MonitorPlugin) loadChecks() error {
+	if p.checksFile == "" || !p.ctx.Agent.FileExists(p.checksFile) {
+		return nil
+	}
+	data, err := p.ctx.Agent.ReadFile(p.checksFile)
+	if err != nil {
+		return err
+	}
+	var checks []*ServiceCheck
+	if err := json.Unmarshal(data, &checks); err != nil {
+		return fmt.Errorf("invalid service checks: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, check := range checks {
+		if err := check.validate(); err != nil {
+			p.ctx.Logger.Warnf("Skipping invalid service check %s: %v", check.Name, err)
+			continue
+		}
+		p.checks[check.Name] = &checkState{check: check}
+	}
+	return nil
+}
+
+// saveChecks 保存服务检查，未配置数据目录时只保存在内存中
+func (p *MonitorPlugin) saveChecks() error {
+	if p.checksFile == "" {
+		return nil
+	}
+
+	p.mu.RLock()
+	checks := make([]*ServiceCheck, 0, len(p.checks))
+	for _, state := range p.checks {
+		checks = append(checks, state.check)
+	}
+	p.mu.RUnlock()
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+	data, err := json.MarshalIndent(checks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return p.ctx.Agent.WriteFile(p.checksFile, data)
+}
@@ -0,0 +1,234 @@
+package monitor
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// defaultCollectInterval 默认采集间隔
+const defaultCollectInterval = 30 * time.Second
+
+// sample 一次采集得到的指标值
+type sample struct {
+	Name   string
+	Value  float64
+	Unit   string
+	Labels map[string]string
+}
+
+// metricKey 返回时间序列的唯一标识，如 partition_usage{mount="/"}
+func metricKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(labels[key]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// counterSample 累计计数器的上次采样
+type counterSample struct {
+	value uint64
+	at    time.Time
+}
+
+// counterRate 根据累计计数器的两次采样计算每秒速率，计数器回绕或重置时返回 false
+func counterRate(prev, cur uint64, elapsed time.Duration) (float64, bool) {
+	if cur < prev || elapsed <= 0 {
+		return 0, false
+	}
+	return float64(cur-prev) / elapsed.Seconds(), true
+}
+
+// rate 记录计数器的当前值并返回与上次采样之间的速率，第一次采样没有速率
+func (p *MonitorPlugin) rate(key string, value uint64, now time.Time) (float64, bool) {
+	prev, exists := p.counters[key]
+	p.counters[key] = counterSample{value: value, at: now}
+	if !exists {
+		return 0, false
+	}
+	return counterRate(prev.value, value, now.Sub(prev.at))
+}
+
+// systemSamples 采集主机指标：总体使用率来自 Agent 的系统信息收集器，
+// 每核 CPU、每个分区、磁盘和网络接口的速率直接通过 gopsutil 采集
+func (p *MonitorPlugin) systemSamples(now time.Time) []sample {
+	var samples []sample
+	add := func(name string, value float64, unit string, labels map[string]string) {
+		samples = append(samples, sample{Name: name, Value: value, Unit: unit, Labels: labels})
+	}
+
+	if sysInfo, err := p.ctx.Agent.GetSystemInfo(); err != nil {
+		p.ctx.Logger.Errorf("Failed to get system info: %v", err)
+	} else {
+		for _, metric := range []struct{ key, name, unit string }{
+			{"cpu_usage", "cpu_usage", "percent"},
+			{"memory_usage", "memory_usage", "percent"},
+			{"disk_usage", "disk_usage", "percent"},
+			{"uptime", "uptime", "seconds"},
+		} {
+			if value, ok := toFloat(sysInfo[metric.key]); ok {
+				add(metric.name, value, metric.unit, nil)
+			}
+		}
+		if conns, ok := sysInfo["connections"].(map[string]int); ok {
+			total := 0
+			for state, count := range conns {
+				add("tcp_connections", float64(count), "count", map[string]string{"state": state})
+				total += count
+			}
+			add("tcp_connections_total", float64(total), "count", nil)
+		}
+	}
+
+	if count, err := cpu.Counts(true); err == nil {
+		add("cpu_count", float64(count), "count", nil)
+	}
+	if usage, err := cpu.Percent(0, true); err == nil {
+		for i, value := range usage {
+			add("cpu_core_usage", value, "percent", map[string]string{"core": strconv.Itoa(i)})
+		}
+	}
+	if avg, err := load.Avg(); err == nil {
+		add("load_1", avg.Load1, "", nil)
+		add("load_5", avg.Load5, "", nil)
+		add("load_15", avg.Load15, "", nil)
+	}
+
+	if vm, err := mem.VirtualMemory(); err == nil {
+		add("memory_total", float64(vm.Total), "bytes", nil)
+		add("memory_used", float64(vm.Used), "bytes", nil)
+		add("memory_available", float64(vm.Available), "bytes", nil)
+	}
+	if swap, err := mem.SwapMemory(); err == nil && swap.Total > 0 {
+		add("swap_usage", swap.UsedPercent, "percent", nil)
+	}
+
+	if partitions, err := disk.Partitions(false); err == nil {
+		for _, partition := range partitions {
+			usage, err := disk.Usage(partition.Mountpoint)
+			if err != nil || usage.Total == 0 {
+				continue
+			}
+			labels := map[string]string{"mount": partition.Mountpoint, "device": partition.Device}
+			add("partition_usage", usage.UsedPercent, "percent", labels)
+			add("partition_free", float64(usage.Free), "bytes", labels)
+		}
+	}
+	if counters, err := disk.IOCounters(); err == nil {
+		for device, counter := range counters {
+			labels := map[string]string{"device": device}
+			if value, ok := p.rate("disk_read/"+device, counter.ReadBytes, now); ok {
+				add("disk_read_rate", value, "bytes/s", labels)
+			}
+			if value, ok := p.rate("disk_write/"+device, counter.WriteBytes, now); ok {
+				add("disk_write_rate", value, "bytes/s", labels)
+			}
+		}
+	}
+
+	// 网络总流量不包括回环接口
+	if counters, err := net.IOCounters(true); err == nil {
+		var totalIn, totalOut float64
+		hasRate := false
+		for _, counter := range counters {
+			labels := map[string]string{"interface": counter.Name}
+			in, okIn := p.rate("net_in/"+counter.Name, counter.BytesRecv, now)
+			out, okOut := p.rate("net_out/"+counter.Name, counter.BytesSent, now)
+			if !okIn || !okOut {
+				continue
+			}
+			add("network_interface_in", in, "bytes/s", labels)
+			add("network_interface_out", out, "bytes/s", labels)
+			if !isLoopback(counter.Name) {
+				totalIn, totalOut, hasRate = totalIn+in, totalOut+out, true
+			}
+		}
+		if hasRate {
+			add("network_in", totalIn, "bytes/s", nil)
+			add("network_out", totalOut, "bytes/s", nil)
+		}
+	}
+
+	return samples
+}
+
+// isLoopback 判断是否为回环接口
+func isLoopback(name string) bool {
+	return name == "lo" || strings.HasPrefix(name, "lo0") || strings.HasPrefix(name, "Loopback")
+}
+
+// toFloat 将系统信息中的数值转换为 float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// recordSamples 保存一轮采集的指标，删除来源相同但本轮没有采集到的时间序列（如已移除的网络接口）
+func (p *MonitorPlugin) recordSamples(source string, samples []sample, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen := make(map[string]bool, len(samples))
+	for _, s := range samples {
+		key := metricKey(s.Name, s.Labels)
+		seen[key] = true
+		p.updateMetricLocked(key, s, source, now)
+		p.history.add(key, s, now)
+	}
+	p.history.prune(now)
+	for key, metric := range p.metrics {
+		if metric.Metadata["source"] == source && !seen[key] {
+			delete(p.metrics, key)
+		}
+	}
+
+	p.evaluateRulesLocked(now)
+}
+
+// collectSystemMetrics 收集系统指标
+func (p *MonitorPlugin) collectSystemMetrics() {
+	p.collectMu.Lock()
+	defer p.collectMu.Unlock()
+
+	now := time.Now()
+	p.recordSamples("system", p.systemSamples(now), now)
+}
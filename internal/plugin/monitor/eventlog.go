@@ -0,0 +1,384 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// defaultEventLogInterval 默认的系统日志读取间隔
+	defaultEventLogInterval = time.Minute
+	// eventLogCommandTimeout journalctl 和 wevtutil 的执行超时
+	eventLogCommandTimeout = 30 * time.Second
+	// eventLogQueryLimit 每个通道每次最多读取的事件数，超出的事件不计入
+	eventLogQueryLimit = 1000
+	// maxEventMessageLength 单条事件消息保留的最大长度
+	maxEventMessageLength = 2048
+	// maxEventEntries 内存中保留的最近事件数
+	maxEventEntries = 100
+	// defaultEventForwardMax 每次最多转发到服务器的事件数
+	defaultEventForwardMax = 100
+)
+
+// eventLevels 统计的事件级别
+var eventLevels = []string{"error", "critical"}
+
+// EventEntry 系统日志中的一条错误事件
+type EventEntry struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`             // journald, eventlog
+	Channel  string    `json:"channel"`            // journald 为 journal，Windows 为事件日志通道
+	Level    string    `json:"level"`              // error, critical
+	Provider string    `json:"provider,omitempty"` // journald 的 SYSLOG_IDENTIFIER 或单元，Windows 的事件来源
+	EventID  int       `json:"event_id,omitempty"`
+	Message  string    `json:"message"`
+}
+
+// eventLogState 系统日志的读取位置，只在读取协程中使用
+type eventLogState struct {
+	cursor  string            // journald 最后一条事件的游标
+	records map[string]uint64 // Windows 各通道已读取的最大 EventRecordID
+	last    time.Time         // 上次读取的时间，还没有读取位置时从这里开始
+	errs    map[string]string // 各通道最近一次的错误，变化时才记录日志
+
+	commander plugin.Commander // 通过 Agent 运行 journalctl 和 wevtutil
+}
+
+// truncateMessage 截断事件消息
+func truncateMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if len(message) > maxEventMessageLength {
+		return message[:maxEventMessageLength]
+	}
+	return message
+}
+
+// journalLevel 将 journald 优先级转换为事件级别，emerg、alert、crit 为 critical
+func journalLevel(priority string) string {
+	if p, err := strconv.Atoi(priority); err == nil && p <= 2 {
+		return "critical"
+	}
+	return "error"
+}
+
+// parseJournal 解析 journalctl -o json 的输出，返回事件和最后一条事件的游标
+// 二进制消息（JSON 中为数组）忽略消息内容
+func parseJournal(data []byte) ([]EventEntry, string) {
+	var entries []EventEntry
+	var cursor string
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		var fields map[string]interface{}
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &fields) != nil {
+			continue
+		}
+		str := func(key string) string {
+			s, _ := fields[key].(string)
+			return s
+		}
+		entry := EventEntry{
+			Source:   "journald",
+			Channel:  "journal",
+			Level:    journalLevel(str("PRIORITY")),
+			Provider: str("SYSLOG_IDENTIFIER"),
+			Message:  truncateMessage(str("MESSAGE")),
+		}
+		if entry.Provider == "" {
+			entry.Provider = str("_SYSTEMD_UNIT")
+		}
+		if usec, err := strconv.ParseInt(str("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+			entry.Time = time.UnixMicro(usec)
+		}
+		entries = append(entries, entry)
+		if c := str("__CURSOR"); c != "" {
+			cursor = c
+		}
+	}
+	return entries, cursor
+}
+
+// readJournal 读取上次位置之后 err 及以上优先级的 journald 事件
+func (s *eventLogState) readJournal(ctx context.Context) ([]EventEntry, error) {
+	args := []string{"-p", "err", "-o", "json", "--no-pager", "-q", "-n", strconv.Itoa(eventLogQueryLimit)}
+	if s.cursor != "" {
+		args = append(args, "--after-cursor", s.cursor)
+	} else {
+		args = append(args, "--since", fmt.Sprintf("@%d", s.last.Unix()))
+	}
+	out, err := commandOutput(ctx, s.commander, "journalctl", args...)
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("journalctl failed: %v", err)
+	}
+	entries, cursor := parseJournal(out)
+	if cursor != "" {
+		s.cursor = cursor
+	}
+	return entries, nil
+}
+
+// winEvent wevtutil /f:RenderedXml 输出的事件
+type winEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     int `xml:"EventID"`
+		Level       int `xml:"Level"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID uint64 `xml:"EventRecordID"`
+		Channel       string `xml:"Channel"`
+	} `xml:"System"`
+	RenderingInfo struct {
+		Message string `xml:"Message"`
+	} `xml:"RenderingInfo"`
+}
+
+// parseWevtutil 解析 wevtutil qe /f:RenderedXml 的输出（多个 Event 元素），返回事件和最大的 EventRecordID
+func parseWevtutil(data []byte) ([]EventEntry, uint64, error) {
+	// 非英文系统上 wevtutil 可能按控制台代码页输出
+	decoder := xml.NewDecoder(strings.NewReader(strings.ToValidUTF8(string(data), "?")))
+	var entries []EventEntry
+	var maxRecord uint64
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, maxRecord, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Event" {
+			continue
+		}
+		var event winEvent
+		if err := decoder.DecodeElement(&event, &start); err != nil {
+			return entries, maxRecord, err
+		}
+
+		level := "error"
+		if event.System.Level == 1 {
+			level = "critical"
+		}
+		entry := EventEntry{
+			Source:   "eventlog",
+			Channel:  event.System.Channel,
+			Level:    level,
+			Provider: event.System.Provider.Name,
+			EventID:  event.System.EventID,
+			Message:  truncateMessage(event.RenderingInfo.Message),
+		}
+		entry.Time, _ = time.Parse(time.RFC3339Nano, event.System.TimeCreated.SystemTime)
+		entries = append(entries, entry)
+		if event.System.EventRecordID > maxRecord {
+			maxRecord = event.System.EventRecordID
+		}
+	}
+	return entries, maxRecord, nil
+}
+
+// readWindowsChannel 读取通道中上次位置之后的严重和错误事件
+func (s *eventLogState) readWindowsChannel(ctx context.Context, channel string) ([]EventEntry, error) {
+	filter := fmt.Sprintf("TimeCreated[@SystemTime>'%s']", s.last.UTC().Format(time.RFC3339Nano))
+	if id := s.records[channel]; id > 0 {
+		filter = fmt.Sprintf("EventRecordID>%d", id)
+	}
+	query := fmt.Sprintf("*[System[(Level=1 or Level=2) and %s]]", filter)
+	out, err := commandOutput(ctx, s.commander, "wevtutil", "qe", channel, "/q:"+query, "/f:RenderedXml",
+		"/rd:false", "/c:"+strconv.Itoa(eventLogQueryLimit))
+	if err != nil {
+		return nil, fmt.Errorf("wevtutil failed: %v", err)
+	}
+	entries, maxRecord, err := parseWevtutil(out)
+	if maxRecord > s.records[channel] {
+		s.records[channel] = maxRecord
+	}
+	for i := range entries {
+		if entries[i].Channel == "" {
+			entries[i].Channel = channel
+		}
+	}
+	return entries, err
+}
+
+// eventLogChannels 返回 Windows 上读取的事件日志通道（event_log_channels，逗号分隔）
+func (p *MonitorPlugin) eventLogChannels() []string {
+	list, ok := p.currentConfig()["event_log_channels"].(string)
+	if !ok {
+		list = "System,Application"
+	}
+	var channels []string
+	for _, channel := range strings.Split(list, ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// eventLogSamples 按来源、通道和级别计算每分钟的错误事件数，没有事件的通道输出 0
+func eventLogSamples(source string, channels []string, entries []EventEntry, elapsed time.Duration) []sample {
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		counts[entry.Channel+"/"+entry.Level]++
+	}
+	minutes := elapsed.Minutes()
+	if minutes <= 0 {
+		minutes = 1
+	}
+	var samples []sample
+	for _, channel := range channels {
+		for _, level := range eventLevels {
+			samples = append(samples, sample{
+				Name:   "event_log_error_rate",
+				Value:  float64(counts[channel+"/"+level]) / minutes,
+				Unit:   "events/min",
+				Labels: map[string]string{"source": source, "channel": channel, "level": level},
+			})
+		}
+	}
+	return samples
+}
+
+// recordEventLog 记录一次读取的事件：输出错误率指标、保存最近的事件，
+// event_log_forward 为 true 时将事件通过 event_log_entries 事件转发到服务器
+func (p *MonitorPlugin) recordEventLog(source string, channels []string, entries []EventEntry, elapsed time.Duration, now time.Time) {
+	if len(entries) > 0 {
+		p.mu.Lock()
+		p.eventEntries = append(p.eventEntries, entries...)
+		if len(p.eventEntries) > maxEventEntries {
+			p.eventEntries = p.eventEntries[len(p.eventEntries)-maxEventEntries:]
+		}
+		p.mu.Unlock()
+
+		config := p.currentConfig()
+		if plugin.ConfigBool(config, "event_log_forward", false) {
+			forward := entries
+			if limit := plugin.ConfigInt(config, "event_log_forward_max", defaultEventForwardMax); len(forward) > limit {
+				forward = forward[:limit]
+			}
+			p.ctx.Agent.NotifyEvent("event_log_entries", map[string]interface{}{
+				"entries":   forward,
+				"count":     len(entries),
+				"truncated": len(forward) < len(entries),
+			})
+		}
+	}
+
+	p.recordSamples("eventlog", eventLogSamples(source, channels, entries, elapsed), now)
+}
+
+// pollEventLog 读取 journald（Linux）或 Windows 事件日志中上次读取之后的错误事件
+func (p *MonitorPlugin) pollEventLog(state *eventLogState, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventLogCommandTimeout)
+	defer cancel()
+
+	var source string
+	var channels []string
+	var entries []EventEntry
+	read := func(channel string, fn func() ([]EventEntry, error)) {
+		channelEntries, err := fn()
+		entries = append(entries, channelEntries...)
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+		if message != state.errs[channel] {
+			if message != "" {
+				p.ctx.Logger.Warnf("Failed to read event log %s: %s", channel, message)
+			}
+			state.errs[channel] = message
+		}
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		source, channels = "journald", []string{"journal"}
+		read("journal", func() ([]EventEntry, error) { return state.readJournal(ctx) })
+	case "windows":
+		source, channels = "eventlog", p.eventLogChannels()
+		for _, channel := range channels {
+			channel := channel
+			read(channel, func() ([]EventEntry, error) { return state.readWindowsChannel(ctx, channel) })
+		}
+	}
+
+	elapsed := now.Sub(state.last)
+	state.last = now
+	p.recordEventLog(source, channels, entries, elapsed, now)
+}
+
+// runEventLog 按 event_log_interval 读取系统日志，只支持 Linux（需要 journalctl）和 Windows
+// 启动前的事件不计入
+func (p *MonitorPlugin) runEventLog(stop <-chan struct{}) {
+	config := p.currentConfig()
+	if !plugin.ConfigBool(config, "event_log_enabled", true) {
+		return
+	}
+	switch runtime.GOOS {
+	case "linux":
+		if _, err := exec.LookPath("journalctl"); err != nil {
+			return
+		}
+	case "windows":
+	default:
+		return
+	}
+
+	commander, err := plugin.AgentCommander(p.ctx.Agent)
+	if err != nil {
+		p.ctx.Logger.Warnf("Event log collection disabled: %v", err)
+		return
+	}
+
+	state := &eventLogState{records: make(map[string]uint64), errs: make(map[string]string), last: time.Now(), commander: commander}
+	ticker := time.NewTicker(plugin.ConfigDuration(config, "event_log_interval", defaultEventLogInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			p.pollEventLog(state, now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// handleGetEventLog 处理获取最近错误事件的命令，按时间倒序返回
+func (p *MonitorPlugin) handleGetEventLog(args map[string]interface{}) (interface{}, error) {
+	level, _ := args["level"].(string)
+	if level != "" && !containsString(eventLevels, level) {
+		return nil, fmt.Errorf("invalid level: %q", level)
+	}
+	limit := maxEventEntries
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entries := make([]EventEntry, 0, len(p.eventEntries))
+	for i := len(p.eventEntries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if level == "" || p.eventEntries[i].Level == level {
+			entries = append(entries, p.eventEntries[i])
+		}
+	}
+	return map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	}, nil
+}
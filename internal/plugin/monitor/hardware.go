@@ -0,0 +1,329 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// defaultSmartInterval 默认的 SMART 采集间隔，smartctl 读取每块磁盘都需要时间
+	defaultSmartInterval = 30 * time.Minute
+	// hardwareCommandTimeout smartctl 和 nvidia-smi 的执行超时
+	hardwareCommandTimeout = 30 * time.Second
+	// gpuThermalThrottleMask nvidia-smi 降频原因中的软件和硬件温度降频位
+	gpuThermalThrottleMask = 0x20 | 0x40
+
+	hwmonRoot = "/sys/class/hwmon"
+	cpuRoot   = "/sys/devices/system/cpu"
+)
+
+// smartAttributeMetrics ATA SMART 属性 ID 对应的指标，使用原始值
+var smartAttributeMetrics = map[int]string{
+	5:   "smart_reallocated_sectors",
+	197: "smart_pending_sectors",
+	198: "smart_uncorrectable_sectors",
+}
+
+// smartctlOutput smartctl -j 输出中用到的字段（smartctl 7.0 及以上）
+type smartctlOutput struct {
+	Devices []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"devices"` // 仅 --scan 输出
+	Device struct {
+		Name string `json:"name"`
+	} `json:"device"`
+	ModelName   string `json:"model_name"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current *float64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours *float64 `json:"hours"`
+	} `json:"power_on_time"`
+	AtaSmartAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value float64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NvmeHealth *struct {
+		PercentageUsed float64 `json:"percentage_used"`
+		MediaErrors    float64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// parseSmartctl 解析 smartctl -a -j 的输出，没有 SMART 状态（如 USB 转接盘不支持）时返回 false
+func parseSmartctl(data []byte) ([]sample, bool) {
+	var out smartctlOutput
+	if err := json.Unmarshal(data, &out); err != nil || out.SmartStatus == nil || out.Device.Name == "" {
+		return nil, false
+	}
+
+	labels := map[string]string{"device": out.Device.Name, "model": out.ModelName}
+	healthy := 0.0
+	if out.SmartStatus.Passed {
+		healthy = 1
+	}
+	samples := []sample{{Name: "smart_healthy", Value: healthy, Labels: labels}}
+	if out.Temperature.Current != nil {
+		samples = append(samples, sample{Name: "smart_temperature", Value: *out.Temperature.Current, Unit: "celsius", Labels: labels})
+	}
+	if out.PowerOnTime.Hours != nil {
+		samples = append(samples, sample{Name: "smart_power_on_hours", Value: *out.PowerOnTime.Hours, Unit: "hours", Labels: labels})
+	}
+	for _, attr := range out.AtaSmartAttributes.Table {
+		if name, ok := smartAttributeMetrics[attr.ID]; ok {
+			samples = append(samples, sample{Name: name, Value: attr.Raw.Value, Unit: "count", Labels: labels})
+		}
+	}
+	if out.NvmeHealth != nil {
+		samples = append(samples,
+			sample{Name: "smart_wear_percent", Value: out.NvmeHealth.PercentageUsed, Unit: "percent", Labels: labels},
+			sample{Name: "smart_media_errors", Value: out.NvmeHealth.MediaErrors, Unit: "count", Labels: labels},
+		)
+	}
+	return samples, true
+}
+
+// commandOutput 通过 Agent 运行程序并返回标准输出
+func commandOutput(ctx context.Context, commander plugin.Commander, name string, args ...string) ([]byte, error) {
+	cmd, err := commander.Command(ctx, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.Output()
+}
+
+// runSmartctl 执行 smartctl，退出码的高位表示磁盘状态（如 SMART 失败）而不是执行失败，
+// 只要有输出就返回
+func runSmartctl(ctx context.Context, commander plugin.Commander, args ...string) ([]byte, error) {
+	out, err := commandOutput(ctx, commander, "smartctl", args...)
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && len(out) > 0) {
+		return nil, err
+	}
+	return out, nil
+}
+
+// smartSamples 扫描磁盘并读取 SMART 信息，未安装 smartctl 时返回 false
+// 处于待机状态的磁盘跳过，避免唤醒
+func smartSamples(ctx context.Context, commander plugin.Commander) ([]sample, bool, error) {
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return nil, false, nil
+	}
+	data, err := runSmartctl(ctx, commander, "--scan", "-j")
+	if err != nil {
+		return nil, true, err
+	}
+	var scan smartctlOutput
+	if err := json.Unmarshal(data, &scan); err != nil {
+		return nil, true, err
+	}
+
+	var samples []sample
+	for _, device := range scan.Devices {
+		data, err := runSmartctl(ctx, commander, "-a", "-j", "-n", "standby", "-d", device.Type, device.Name)
+		if err != nil {
+			continue
+		}
+		if deviceSamples, ok := parseSmartctl(data); ok {
+			samples = append(samples, deviceSamples...)
+		}
+	}
+	return samples, true, nil
+}
+
+// collectSmartMetrics 采集磁盘 SMART 指标
+func (p *MonitorPlugin) collectSmartMetrics() {
+	ctx, cancel := context.WithTimeout(context.Background(), hardwareCommandTimeout)
+	defer cancel()
+
+	commander, err := plugin.AgentCommander(p.ctx.Agent)
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to collect SMART data: %v", err)
+		return
+	}
+	samples, available, err := smartSamples(ctx, commander)
+	if !available {
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to collect SMART data: %v", err)
+		return
+	}
+	p.recordSamples("smart", samples, time.Now())
+}
+
+// collectSmart 启动时立即采集一次 SMART 指标，之后按 smart_interval 定期采集
+func (p *MonitorPlugin) collectSmart(stop <-chan struct{}) {
+	config := p.currentConfig()
+	if !plugin.ConfigBool(config, "smart_enabled", true) {
+		return
+	}
+	p.collectSmartMetrics()
+
+	ticker := time.NewTicker(plugin.ConfigDuration(config, "smart_interval", defaultSmartInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.collectSmartMetrics()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// parseNvidiaSmi 解析 nvidia-smi --query-gpu=index,name,temperature.gpu,fan.speed,clocks_throttle_reasons.active
+// --format=csv,noheader,nounits 的输出，不支持的字段（[N/A]）跳过
+func parseNvidiaSmi(data []byte) []sample {
+	var samples []sample
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 5 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		labels := map[string]string{"gpu": fields[0], "name": fields[1]}
+		if value, err := strconv.ParseFloat(fields[2], 64); err == nil {
+			samples = append(samples, sample{Name: "gpu_temperature", Value: value, Unit: "celsius", Labels: labels})
+		}
+		if value, err := strconv.ParseFloat(fields[3], 64); err == nil {
+			samples = append(samples, sample{Name: "gpu_fan_speed", Value: value, Unit: "percent", Labels: labels})
+		}
+		if reasons, err := strconv.ParseUint(strings.TrimPrefix(fields[4], "0x"), 16, 64); err == nil {
+			throttled := 0.0
+			if reasons&gpuThermalThrottleMask != 0 {
+				throttled = 1
+			}
+			samples = append(samples, sample{Name: "thermal_throttled", Value: throttled, Labels: map[string]string{"component": "gpu" + fields[0]}})
+		}
+	}
+	return samples
+}
+
+// gpuSamples 通过 nvidia-smi 采集 NVIDIA GPU 的温度、风扇和降频状态，未安装时返回空
+func gpuSamples(ctx context.Context, commander plugin.Commander) []sample {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return nil
+	}
+	out, err := commandOutput(ctx, commander, "nvidia-smi",
+		"--query-gpu=index,name,temperature.gpu,fan.speed,clocks_throttle_reasons.active",
+		"--format=csv,noheader,nounits")
+	if err != nil {
+		return nil
+	}
+	return parseNvidiaSmi(out)
+}
+
+// readSysfsNumber 读取 sysfs 中的整数文件
+func readSysfsNumber(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return value, err == nil
+}
+
+// fanSamples 读取 Linux hwmon 的风扇转速，传感器名为芯片名加风扇编号，如 nct6775/fan1
+func fanSamples(root string) []sample {
+	paths, _ := filepath.Glob(filepath.Join(root, "hwmon*", "fan*_input"))
+	var samples []sample
+	for _, path := range paths {
+		rpm, ok := readSysfsNumber(path)
+		if !ok {
+			continue
+		}
+		dir := filepath.Dir(path)
+		chip := filepath.Base(dir)
+		if name, err := os.ReadFile(filepath.Join(dir, "name")); err == nil {
+			chip = strings.TrimSpace(string(name))
+		}
+		fan := strings.TrimSuffix(filepath.Base(path), "_input")
+		samples = append(samples, sample{Name: "fan_speed", Value: float64(rpm), Unit: "rpm",
+			Labels: map[string]string{"sensor": chip + "/" + fan}})
+	}
+	return samples
+}
+
+// cpuThrottleCount 返回 Linux 各 CPU 核心因温度降频的累计次数，不支持时返回 false
+func cpuThrottleCount(root string) (uint64, bool) {
+	paths, _ := filepath.Glob(filepath.Join(root, "cpu[0-9]*", "thermal_throttle", "core_throttle_count"))
+	var total uint64
+	found := false
+	for _, path := range paths {
+		if count, ok := readSysfsNumber(path); ok {
+			total += count
+			found = true
+		}
+	}
+	return total, found
+}
+
+// sensorSamples 采集温度传感器、风扇和 CPU/GPU 降频状态，调用方需持有 p.collectMu
+// CPU 降频计数在两次采集之间增加时 thermal_throttled{component="cpu"} 为 1
+func (p *MonitorPlugin) sensorSamples(now time.Time) []sample {
+	var samples []sample
+
+	// 部分传感器读取失败时仍返回其余结果
+	temps, _ := host.SensorsTemperatures()
+	for _, temp := range temps {
+		if temp.Temperature <= 0 {
+			continue
+		}
+		labels := map[string]string{"sensor": temp.SensorKey}
+		samples = append(samples, sample{Name: "sensor_temperature", Value: temp.Temperature, Unit: "celsius", Labels: labels})
+		if temp.Critical > 0 {
+			samples = append(samples, sample{Name: "sensor_temperature_critical", Value: temp.Critical, Unit: "celsius", Labels: labels})
+		}
+	}
+
+	if runtime.GOOS == "linux" {
+		samples = append(samples, fanSamples(hwmonRoot)...)
+		if count, ok := cpuThrottleCount(cpuRoot); ok {
+			throttled := 0.0
+			if delta, ok := p.rate("cpu_throttle", count, now); ok && delta > 0 {
+				throttled = 1
+			}
+			samples = append(samples, sample{Name: "thermal_throttled", Value: throttled, Labels: map[string]string{"component": "cpu"}})
+		}
+	}
+
+	commander, err := plugin.AgentCommander(p.ctx.Agent)
+	if err != nil {
+		return samples
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hardwareCommandTimeout)
+	defer cancel()
+	return append(samples, gpuSamples(ctx, commander)...)
+}
+
+// collectSensorMetrics 采集硬件传感器指标
+func (p *MonitorPlugin) collectSensorMetrics() {
+	p.collectMu.Lock()
+	defer p.collectMu.Unlock()
+
+	now := time.Now()
+	p.recordSamples("sensors", p.sensorSamples(now), now)
+}
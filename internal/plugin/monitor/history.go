@@ -0,0 +1,427 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// historyFileName 指标历史文件，插件停止时保存，位于 Agent 数据目录
+const historyFileName = "monitor_history.gob"
+
+// maxQueryPoints 单个时间序列最多返回的点数，超过时自动增大步长
+const maxQueryPoints = 1000
+
+// historyAggregations 支持的聚合方式
+var historyAggregations = []string{"avg", "min", "max", "p95"}
+
+// historyTier 一种精度的保存策略
+type historyTier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// size 返回该精度需要的 bucket 数
+func (t historyTier) size() int {
+	return int(t.Retention / t.Resolution)
+}
+
+// historyTiers 根据配置返回保存策略：默认 24 小时 30 秒精度、retention_days 天 5 分钟精度
+func historyTiers(config map[string]interface{}) []historyTier {
+	tiers := []historyTier{
+		{
+			Resolution: plugin.ConfigDuration(config, "history_resolution", 30*time.Second),
+			Retention:  plugin.ConfigDuration(config, "history_retention", 24*time.Hour),
+		},
+		{
+			Resolution: plugin.ConfigDuration(config, "downsample_resolution", 5*time.Minute),
+			Retention:  time.Duration(plugin.ConfigInt(config, "retention_days", 7)) * 24 * time.Hour,
+		},
+	}
+
+	// 精度必须为整秒，保存时长不足一个 bucket 的层级不保存
+	valid := tiers[:0]
+	for _, tier := range tiers {
+		tier.Resolution = tier.Resolution.Truncate(time.Second)
+		if tier.Resolution > 0 && tier.size() > 0 {
+			valid = append(valid, tier)
+		}
+	}
+	return valid
+}
+
+// bucket 一个时间段内的聚合值
+type bucket struct {
+	T     int64 // 时间段起点（Unix 秒）
+	Sum   float64
+	Min   float64
+	Max   float64
+	Count int
+}
+
+func (b *bucket) add(v float64) {
+	b.Sum += v
+	b.Count++
+	b.Min = math.Min(b.Min, v)
+	b.Max = math.Max(b.Max, v)
+}
+
+func (b *bucket) merge(o bucket) {
+	b.Sum += o.Sum
+	b.Count += o.Count
+	b.Min = math.Min(b.Min, o.Min)
+	b.Max = math.Max(b.Max, o.Max)
+}
+
+func (b bucket) avg() float64 {
+	return b.Sum / float64(b.Count)
+}
+
+// ring 固定容量的环形缓冲区，按时间顺序保存一种精度的 bucket
+type ring struct {
+	Res     int64 // 精度（秒）
+	Buckets []bucket
+	Head    int // 容量已满后最旧 bucket 的位置
+}
+
+// add 将采样值计入所属的 bucket，早于最新 bucket 的采样被忽略
+func (r *ring) add(ts int64, v float64, size int) {
+	t := ts - ts%r.Res
+	if n := len(r.Buckets); n > 0 {
+		last := &r.Buckets[(r.Head+n-1)%n]
+		if t == last.T {
+			last.add(v)
+			return
+		}
+		if t < last.T {
+			return
+		}
+	}
+
+	b := bucket{T: t, Sum: v, Min: v, Max: v, Count: 1}
+	if len(r.Buckets) < size {
+		r.Buckets = append(r.Buckets, b)
+		return
+	}
+	r.Buckets[r.Head] = b
+	r.Head = (r.Head + 1) % len(r.Buckets)
+}
+
+// last 返回最新的 bucket
+func (r *ring) last() (bucket, bool) {
+	n := len(r.Buckets)
+	if n == 0 {
+		return bucket{}, false
+	}
+	return r.Buckets[(r.Head+n-1)%n], true
+}
+
+// each 按时间顺序遍历 [from, to] 内的 bucket
+func (r *ring) each(from, to int64, fn func(bucket)) {
+	n := len(r.Buckets)
+	for i := 0; i < n; i++ {
+		b := r.Buckets[(r.Head+i)%n]
+		if b.T >= from && b.T <= to {
+			fn(b)
+		}
+	}
+}
+
+// historySeries 一个时间序列在各精度下的历史
+type historySeries struct {
+	Name   string
+	Labels map[string]string
+	Rings  []*ring
+}
+
+// metricHistory 本地时间序列存储，每个时间序列每种精度一个环形缓冲区
+type metricHistory struct {
+	Tiers  []historyTier
+	Series map[string]*historySeries
+}
+
+func newMetricHistory(tiers []historyTier) *metricHistory {
+	return &metricHistory{Tiers: tiers, Series: make(map[string]*historySeries)}
+}
+
+// add 记录采样值，同时计入每种精度
+func (h *metricHistory) add(key string, s sample, now time.Time) {
+	series, exists := h.Series[key]
+	if !exists {
+		series = &historySeries{Name: s.Name, Labels: s.Labels, Rings: make([]*ring, len(h.Tiers))}
+		for i, tier := range h.Tiers {
+			series.Rings[i] = &ring{Res: int64(tier.Resolution / time.Second)}
+		}
+		h.Series[key] = series
+	}
+	for i, tier := range h.Tiers {
+		series.Rings[i].add(now.Unix(), s.Value, tier.size())
+	}
+}
+
+// prune 删除超过最长保存时间没有新数据的时间序列
+func (h *metricHistory) prune(now time.Time) {
+	if len(h.Tiers) == 0 {
+		return
+	}
+	longest := len(h.Tiers) - 1
+	cutoff := now.Add(-h.Tiers[longest].Retention).Unix()
+	for key, series := range h.Series {
+		if last, ok := series.Rings[longest].last(); !ok || last.T < cutoff {
+			delete(h.Series, key)
+		}
+	}
+}
+
+// historyQuery 历史查询条件
+type historyQuery struct {
+	Name        string
+	Labels      map[string]string
+	Start       time.Time
+	End         time.Time
+	Step        time.Duration
+	Aggregation string
+}
+
+// HistoryPoint 历史数据点
+type HistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// HistoryResult 一个时间序列的查询结果
+type HistoryResult struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	Points []HistoryPoint    `json:"points"`
+}
+
+// query 查询时间范围内的历史：使用保存时间覆盖起点的最高精度，按步长聚合
+// 步长为精度的整数倍；p95 为步长内各 bucket 平均值的 95 分位
+func (h *metricHistory) query(q historyQuery, now time.Time) ([]*HistoryResult, time.Duration) {
+	if len(h.Tiers) == 0 {
+		return nil, 0
+	}
+	tier := len(h.Tiers) - 1
+	for i, t := range h.Tiers {
+		if !q.Start.Before(now.Add(-t.Retention)) {
+			tier = i
+			break
+		}
+	}
+
+	res := h.Tiers[tier].Resolution
+	step := res
+	if q.Step > step {
+		step = (q.Step + res - 1) / res * res
+	}
+	if span := q.End.Sub(q.Start); span/step > maxQueryPoints {
+		step = (span/maxQueryPoints + res - 1) / res * res
+	}
+	stepSec := int64(step / time.Second)
+
+	keys := make([]string, 0)
+	for key, series := range h.Series {
+		if series.Name == q.Name && labelsMatch(series.Labels, q.Labels) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	results := make([]*HistoryResult, 0, len(keys))
+	for _, key := range keys {
+		series := h.Series[key]
+		result := &HistoryResult{Name: series.Name, Labels: series.Labels, Points: []HistoryPoint{}}
+
+		var group []bucket
+		flush := func() {
+			if len(group) > 0 {
+				t := group[0].T - group[0].T%stepSec
+				result.Points = append(result.Points, HistoryPoint{Timestamp: time.Unix(t, 0), Value: aggregate(group, q.Aggregation)})
+				group = group[:0]
+			}
+		}
+		series.Rings[tier].each(q.Start.Unix(), q.End.Unix(), func(b bucket) {
+			if len(group) > 0 && b.T/stepSec != group[0].T/stepSec {
+				flush()
+			}
+			group = append(group, b)
+		})
+		flush()
+		results = append(results, result)
+	}
+	return results, step
+}
+
+// aggregate 聚合一个步长内的 bucket
+func aggregate(buckets []bucket, aggregation string) float64 {
+	total := buckets[0]
+	for _, b := range buckets[1:] {
+		total.merge(b)
+	}
+	switch aggregation {
+	case "min":
+		return total.Min
+	case "max":
+		return total.Max
+	case "p95":
+		values := make([]float64, len(buckets))
+		for i, b := range buckets {
+			values[i] = b.avg()
+		}
+		return percentile(values, 0.95)
+	}
+	return total.avg()
+}
+
+// percentile 计算分位数（最近秩法）
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	rank := int(math.Ceil(p*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
+
+// labelsMatch 判断时间序列是否包含全部过滤标签
+func labelsMatch(labels, filter map[string]string) bool {
+	for key, value := range filter {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// handleQueryMetrics 处理查询指标历史命令
+// 时间范围使用 start/end（RFC3339），或 range 表示最近一段时间，默认最近 1 小时
+func (p *MonitorPlugin) handleQueryMetrics(args map[string]interface{}) (interface{}, error) {
+	now := time.Now()
+	q := historyQuery{End: now, Aggregation: "avg"}
+	q.Name, _ = args["name"].(string)
+	if q.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if v, ok := args["labels"].(map[string]interface{}); ok {
+		q.Labels = make(map[string]string, len(v))
+		for key, value := range v {
+			q.Labels[key] = fmt.Sprint(value)
+		}
+	}
+	if v, ok := args["aggregation"].(string); ok && v != "" {
+		if !containsString(historyAggregations, v) {
+			return nil, fmt.Errorf("invalid aggregation: %q", v)
+		}
+		q.Aggregation = v
+	}
+	if v, ok := args["step"].(string); ok && v != "" {
+		step, err := time.ParseDuration(v)
+		if err != nil || step <= 0 {
+			return nil, fmt.Errorf("invalid step: %q", v)
+		}
+		q.Step = step
+	}
+
+	if v, ok := args["end"].(string); ok && v != "" {
+		end, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end: %v", err)
+		}
+		q.End = end
+	}
+	if v, ok := args["start"].(string); ok && v != "" {
+		start, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start: %v", err)
+		}
+		q.Start = start
+	} else {
+		span := time.Hour
+		if v, ok := args["range"].(string); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid range: %q", v)
+			}
+			span = d
+		}
+		q.Start = q.End.Add(-span)
+	}
+	if !q.Start.Before(q.End) {
+		return nil, fmt.Errorf("start must be before end")
+	}
+
+	p.mu.RLock()
+	series, step := p.history.query(q, now)
+	p.mu.RUnlock()
+
+	return map[string]interface{}{
+		"series":      series,
+		"count":       len(series),
+		"start":       q.Start,
+		"end":         q.End,
+		"step":        step.String(),
+		"aggregation": q.Aggregation,
+	}, nil
+}
+
+// loadHistory 加载上次停止时保存的历史，保存策略改变时丢弃
+func (p *MonitorPlugin) loadHistory() error {
+	if p.historyFile == "" || !p.ctx.Agent.FileExists(p.historyFile) {
+		return nil
+	}
+	data, err := p.ctx.Agent.ReadFile(p.historyFile)
+	if err != nil {
+		return err
+	}
+	var saved metricHistory
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&saved); err != nil {
+		return fmt.Errorf("invalid metric history: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !sameTiers(saved.Tiers, p.history.Tiers) {
+		p.ctx.Logger.Info("History tiers changed, discarding saved metric history")
+		return nil
+	}
+	p.history.Series = saved.Series
+	if p.history.Series == nil {
+		p.history.Series = make(map[string]*historySeries)
+	}
+	p.history.prune(time.Now())
+	return nil
+}
+
+// saveHistory 保存历史，未配置数据目录时不保存
+func (p *MonitorPlugin) saveHistory() error {
+	if p.historyFile == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	p.mu.RLock()
+	err := gob.NewEncoder(&buf).Encode(p.history)
+	p.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return p.ctx.Agent.WriteFile(p.historyFile, buf.Bytes())
+}
+
+func sameTiers(a, b []historyTier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
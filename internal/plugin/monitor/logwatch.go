@@ -0,0 +1,410 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// logWatchesFileName 日志监控配置文件，位于 Agent 数据目录
+const logWatchesFileName = "monitor_log_watches.json"
+
+// 日志监控的限制：每次最多读取的字节数、不完整行的最大长度、告警附带的行数和每行长度
+const (
+	defaultLogPollInterval = 2 * time.Second
+	defaultLogWindow       = 5 * time.Minute
+	maxLogRead             = 1 << 20
+	maxLogPartial          = 64 << 10
+	maxLogLines            = 10
+	maxLogLineLength       = 1000
+)
+
+// LogWatch 日志监控：窗口内匹配 Pattern 的行数达到 Threshold 时告警
+type LogWatch struct {
+	Name      string   `json:"name"`
+	Path      string   `json:"path"`
+	Pattern   string   `json:"pattern"`          // 正则表达式
+	Window    string   `json:"window,omitempty"` // 计数窗口，默认 5m
+	Threshold int      `json:"threshold"`        // 默认 1
+	Severity  string   `json:"severity"`
+	Notify    []string `json:"notify,omitempty"` // 通知渠道，为空时发送到默认渠道
+}
+
+// LogWatchView 日志监控及其当前状态
+type LogWatchView struct {
+	*LogWatch
+	Matches   int      `json:"matches"` // 窗口内的匹配行数
+	LastLines []string `json:"last_lines"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// logMatchCount 一次读取中的匹配行数
+type logMatchCount struct {
+	at time.Time
+	n  int
+}
+
+// logWatchState 日志监控的运行状态
+// 文件位置只由监控协程访问，匹配计数和最近的行由 p.mu 保护
+type logWatchState struct {
+	watch *LogWatch
+	re    *regexp.Regexp
+
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+	opened  bool // 已读取过文件，之后新出现的文件从头读取
+
+	counts []logMatchCount
+	lines  []string
+	err    string
+}
+
+func (w *LogWatch) window() time.Duration {
+	if d, err := time.ParseDuration(w.Window); err == nil && d > 0 {
+		return d
+	}
+	return defaultLogWindow
+}
+
+// validate 校验配置并补充默认值
+func (w *LogWatch) validate() (*regexp.Regexp, error) {
+	if w.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if w.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	re, err := regexp.Compile(w.Pattern)
+	if err != nil || w.Pattern == "" {
+		return nil, fmt.Errorf("invalid pattern: %q", w.Pattern)
+	}
+	if w.Window != "" {
+		if d, err := time.ParseDuration(w.Window); err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid window: %q", w.Window)
+		}
+	}
+	if w.Threshold <= 0 {
+		w.Threshold = 1
+	}
+	if w.Severity == "" {
+		w.Severity = "warning"
+	}
+	if !containsString(ruleSeverities, w.Severity) {
+		return nil, fmt.Errorf("invalid severity: %q", w.Severity)
+	}
+	return re, nil
+}
+
+// read 读取文件新增的完整行并返回匹配的行
+// 首次读取时从文件末尾开始，文件被截断或轮转（路径指向新文件）后从头读取
+func (s *logWatchState) read() ([]string, error) {
+	info, err := os.Stat(s.watch.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.info, s.partial = nil, nil
+			s.opened = true
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	switch {
+	case s.info == nil && !s.opened:
+		s.offset = info.Size()
+	case s.info == nil, !os.SameFile(s.info, info), info.Size() < s.offset:
+		s.offset, s.partial = 0, nil
+	}
+	s.info, s.opened = info, true
+	if info.Size() == s.offset {
+		return nil, nil
+	}
+
+	f, err := os.Open(s.watch.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(s.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxLogRead))
+	if err != nil {
+		return nil, err
+	}
+	s.offset += int64(len(data))
+
+	data = append(s.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		s.partial = truncateBytes(data, maxLogPartial)
+		return nil, nil
+	}
+	s.partial = truncateBytes(append([]byte(nil), data[end+1:]...), maxLogPartial)
+
+	var matched []string
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		line = bytes.TrimRight(line, "\r")
+		if s.re.Match(line) {
+			matched = append(matched, string(truncateBytes(line, maxLogLineLength)))
+		}
+	}
+	return matched, nil
+}
+
+func truncateBytes(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
+
+// record 记录匹配行并返回窗口内的匹配数，调用方需持有 p.mu
+func (s *logWatchState) record(matched []string, now time.Time) int {
+	if len(matched) > 0 {
+		s.counts = append(s.counts, logMatchCount{at: now, n: len(matched)})
+		s.lines = append(s.lines, matched...)
+		if len(s.lines) > maxLogLines {
+			s.lines = s.lines[len(s.lines)-maxLogLines:]
+		}
+	}
+
+	cutoff := now.Add(-s.watch.window())
+	total := 0
+	kept := s.counts[:0]
+	for _, c := range s.counts {
+		if c.at.After(cutoff) {
+			kept = append(kept, c)
+			total += c.n
+		}
+	}
+	s.counts = kept
+	return total
+}
+
+// pollLogWatch 读取一个日志文件，更新匹配数指标，窗口内匹配数达到阈值时告警并附带最近的匹配行，
+// 窗口内匹配数回落到阈值以下时恢复告警
+func (p *MonitorPlugin) pollLogWatch(state *logWatchState, now time.Time) {
+	matched, err := state.read()
+
+	p.mu.Lock()
+	if current, exists := p.logWatches[state.watch.Name]; !exists || current != state {
+		p.mu.Unlock()
+		return
+	}
+	state.err = ""
+	if err != nil {
+		state.err = err.Error()
+	}
+	count := state.record(matched, now)
+	watch := state.watch
+	labels := map[string]string{"watch": watch.Name, "path": watch.Path}
+	id := metricKey("log_matches", labels)
+	if len(matched) > 0 && count >= watch.Threshold {
+		lines := append([]string(nil), state.lines...)
+		p.triggerAlertLocked(&AlertInfo{
+			ID:        id,
+			Name:      watch.Name,
+			Severity:  watch.Severity,
+			Status:    "active",
+			Message:   fmt.Sprintf("%s: %d lines matching %q in %s within %s", watch.Name, count, watch.Pattern, watch.Path, watch.window()),
+			Metric:    "log_matches",
+			Threshold: float64(watch.Threshold),
+			Current:   float64(count),
+			CreatedAt: now,
+			Labels:    labels,
+			Annotations: map[string]interface{}{
+				"pattern": watch.Pattern,
+				"window":  watch.window().String(),
+				"lines":   lines,
+			},
+			Notify: watch.Notify,
+		}, map[string]interface{}{
+			"watch": watch.Name,
+			"path":  watch.Path,
+			"lines": lines,
+		})
+	} else if alert, exists := p.alerts[id]; exists && alert.Status != "resolved" && count < watch.Threshold {
+		p.resolveAlertLocked(alert, now, "below threshold")
+	}
+	p.mu.Unlock()
+
+	p.recordSamples("log/"+watch.Name, []sample{{
+		Name:   "log_matches",
+		Value:  float64(count),
+		Unit:   "count",
+		Labels: labels,
+	}}, now)
+}
+
+// runLogWatches 每隔 log_poll_interval 读取全部监控的日志文件
+func (p *MonitorPlugin) runLogWatches(stop <-chan struct{}) {
+	ticker := time.NewTicker(plugin.ConfigDuration(p.currentConfig(), "log_poll_interval", defaultLogPollInterval))
+	defer ticker.Stop()
+
+	for {
+		p.mu.RLock()
+		states := make([]*logWatchState, 0, len(p.logWatches))
+		for _, state := range p.logWatches {
+			states = append(states, state)
+		}
+		p.mu.RUnlock()
+
+		now := time.Now()
+		for _, state := range states {
+			p.pollLogWatch(state, now)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// handleAddLogWatch 处理添加日志监控命令
+func (p *MonitorPlugin) handleAddLogWatch(args map[string]interface{}) (interface{}, error) {
+	watch := &LogWatch{}
+	watch.Name, _ = args["name"].(string)
+	watch.Path, _ = args["path"].(string)
+	watch.Pattern, _ = args["pattern"].(string)
+	watch.Window, _ = args["window"].(string)
+	watch.Severity, _ = args["severity"].(string)
+	if v, ok := args["threshold"].(float64); ok {
+		watch.Threshold = int(v)
+	}
+	if v, ok := args["notify"].([]interface{}); ok {
+		watch.Notify = toStrings(v)
+	}
+	re, err := watch.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if _, exists := p.logWatches[watch.Name]; exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("log watch %s already exists", watch.Name)
+	}
+	p.logWatches[watch.Name] = &logWatchState{watch: watch, re: re}
+	p.mu.Unlock()
+
+	if err := p.saveLogWatches(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save log watches: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    watch.Name,
+		"watch":   watch,
+		"message": "Log watch added successfully",
+	}, nil
+}
+
+// handleRemoveLogWatch 处理移除日志监控命令，同时删除其指标
+func (p *MonitorPlugin) handleRemoveLogWatch(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["name"].(string)
+
+	p.mu.Lock()
+	state, exists := p.logWatches[name]
+	if !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("log watch %s not found", name)
+	}
+	delete(p.logWatches, name)
+	id := metricKey("log_matches", map[string]string{"watch": name, "path": state.watch.Path})
+	if alert, exists := p.alerts[id]; exists && alert.Status != "resolved" {
+		p.resolveAlertLocked(alert, time.Now(), "log watch removed")
+	}
+	p.mu.Unlock()
+
+	p.recordSamples("log/"+name, nil, time.Now())
+	if err := p.saveLogWatches(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save log watches: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"message": "Log watch removed successfully",
+	}, nil
+}
+
+// handleGetLogWatches 处理获取日志监控命令，按名称排序
+func (p *MonitorPlugin) handleGetLogWatches(args map[string]interface{}) (interface{}, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	watches := make([]*LogWatchView, 0, len(p.logWatches))
+	for _, state := range p.logWatches {
+		view := &LogWatchView{LogWatch: state.watch, LastLines: append([]string{}, state.lines...), Error: state.err}
+		cutoff := now.Add(-state.watch.window())
+		for _, c := range state.counts {
+			if c.at.After(cutoff) {
+				view.Matches += c.n
+			}
+		}
+		watches = append(watches, view)
+	}
+	sort.Slice(watches, func(i, j int) bool { return watches[i].Name < watches[j].Name })
+
+	return map[string]interface{}{
+		"watches": watches,
+		"count":   len(watches),
+	}, nil
+}
+
+// loadLogWatches 从数据目录加载日志监控
+func (p *MonitorPlugin) loadLogWatches() error {
+	if p.logWatchesFile == "" || !p.ctx.Agent.FileExists(p.logWatchesFile) {
+		return nil
+	}
+	data, err := p.ctx.Agent.ReadFile(p.logWatchesFile)
+	if err != nil {
+		return err
+	}
+	var watches []*LogWatch
+	if err := json.Unmarshal(data, &watches); err != nil {
+		return fmt.Errorf("invalid log watches: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, watch := range watches {
+		re, err := watch.validate()
+		if err != nil {
+			p.ctx.Logger.Warnf("Skipping invalid log watch %s: %v", watch.Name, err)
+			continue
+		}
+		p.logWatches[watch.Name] = &logWatchState{watch: watch, re: re}
+	}
+	return nil
+}
+
+// saveLogWatches 保存日志监控，未配置数据目录时只保存在内存中
+func (p *MonitorPlugin) saveLogWatches() error {
+	if p.logWatchesFile == "" {
+		return nil
+	}
+
+	p.mu.RLock()
+	watches := make([]*LogWatch, 0, len(p.logWatches))
+	for _, state := range p.logWatches {
+		watches = append(watches, state.watch)
+	}
+	p.mu.RUnlock()
+	sort.Slice(watches, func(i, j int) bool { return watches[i].Name < watches[j].Name })
+
+	data, err := json.MarshalIndent(watches, "", "  ")
+	if err != nil {
+		return err
+	}
+	return p.ctx.Agent.WriteFile(p.logWatchesFile, data)
+}
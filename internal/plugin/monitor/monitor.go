@@ -2,6 +2,9 @@ package monitor
 
 import (
 	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,6 +20,45 @@ type MonitorPlugin struct {
 	alerts   map[string]*AlertInfo
 	mu       sync.RWMutex
 	stopChan chan struct{}
+
+	// 告警规则和条件成立但尚未触发的时间序列
+	rules     map[string]*MonitorRule
+	pending   map[string]pendingAlert
+	rulesFile string
+
+	// 指标历史，插件停止时保存到数据目录
+	history     *metricHistory
+	historyFile string
+
+	// 累计计数器的上次采样，用于计算磁盘和网络速率
+	counters  map[string]counterSample
+	collectMu sync.Mutex
+
+	// 服务检查，checkTransport 为 nil 时使用默认的 HTTP 传输
+	checks         map[string]*checkState
+	checksFile     string
+	checkTransport http.RoundTripper
+
+	// 日志监控
+	logWatches     map[string]*logWatchState
+	logWatchesFile string
+
+	// 告警通知渠道
+	notifiers     map[string]*notifierState
+	notifiersFile string
+	notifyClient  *http.Client
+
+	// 进程计数器的上次采样和最近一次采集的进程列表
+	procCounters map[int32]processCounters
+	processes    []*ProcessInfo
+	processesAt  time.Time
+
+	// 最近从系统日志读取的错误事件
+	eventEntries []EventEntry
+
+	// Prometheus 指标端点
+	server     *http.Server
+	serverAddr string
 }
 
 // MetricInfo 指标信息
@@ -32,38 +74,58 @@ type MetricInfo struct {
 
 // AlertInfo 告警信息
 type AlertInfo struct {
-	ID          string                 `json:"id"`
-	Name        string                 `json:"name"`
-	Severity    string                 `json:"severity"` // info, warning, error, critical
-	Status      string                 `json:"status"`   // active, resolved, acknowledged
-	Message     string                 `json:"message"`
-	Metric      string                 `json:"metric"`
-	Threshold   float64                `json:"threshold"`
-	Current     float64                `json:"current"`
-	CreatedAt   time.Time              `json:"created_at"`
-	ResolvedAt  time.Time              `json:"resolved_at,omitempty"`
-	Labels      map[string]string      `json:"labels"`
-	Annotations map[string]interface{} `json:"annotations"`
-}
-
-// MonitorRule 监控规则
+	ID               string                 `json:"id"`
+	Name             string                 `json:"name"`
+	Rule             string                 `json:"rule,omitempty"` // 触发告警的规则
+	Severity         string                 `json:"severity"`       // info, warning, error, critical
+	Status           string                 `json:"status"`         // active, resolved, acknowledged
+	Message          string                 `json:"message"`
+	Metric           string                 `json:"metric"`
+	Threshold        float64                `json:"threshold"`
+	Current          float64                `json:"current"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+	ResolvedAt       time.Time              `json:"resolved_at,omitempty"`
+	EscalatedAt      time.Time              `json:"escalated_at,omitempty"`
+	OriginalSeverity string                 `json:"original_severity,omitempty"` // 升级前的级别
+	Occurrences      int                    `json:"occurrences"`                 // 触发次数，冷却期内的重复触发计入同一告警
+	Labels           map[string]string      `json:"labels"`
+	Annotations      map[string]interface{} `json:"annotations"`
+	Notify           []string               `json:"notify,omitempty"` // 通知渠道，为空时发送到默认渠道
+
+	notified bool // 本次触发是否已发送通知，未通知的告警恢复时也不通知
+}
+
+// MonitorRule 监控规则，Labels 不为空时只匹配标签全部相同的时间序列，每个时间序列单独告警
 type MonitorRule struct {
-	Name      string            `json:"name"`
-	Metric    string            `json:"metric"`
-	Condition string            `json:"condition"` // >, <, >=, <=, ==, !=
-	Threshold float64           `json:"threshold"`
-	Duration  time.Duration     `json:"duration"`
-	Severity  string            `json:"severity"`
-	Labels    map[string]string `json:"labels"`
+	Name        string            `json:"name"`
+	Metric      string            `json:"metric"`
+	Condition   string            `json:"condition"` // >, <, >=, <=, ==, !=
+	Threshold   float64           `json:"threshold"`
+	Duration    string            `json:"duration,omitempty"` // 条件持续成立多久后触发，如 5m，为空时立即触发
+	Severity    string            `json:"severity"`
+	Labels      map[string]string `json:"labels"`
+	Description string            `json:"description,omitempty"`
+	Notify      []string          `json:"notify,omitempty"` // 通知渠道，为空时发送到默认渠道
+	// 告警持续多久未确认后提升一级，为空时使用插件的 escalate_after 配置
+	EscalateAfter string `json:"escalate_after,omitempty"`
 }
 
 // NewMonitorPlugin 创建系统监控插件
 func NewMonitorPlugin() *MonitorPlugin {
 	return &MonitorPlugin{
-		config:   make(map[string]interface{}),
-		metrics:  make(map[string]*MetricInfo),
-		alerts:   make(map[string]*AlertInfo),
-		stopChan: make(chan struct{}),
+		config:       make(map[string]interface{}),
+		metrics:      make(map[string]*MetricInfo),
+		alerts:       make(map[string]*AlertInfo),
+		stopChan:     make(chan struct{}),
+		counters:     make(map[string]counterSample),
+		rules:        make(map[string]*MonitorRule),
+		pending:      make(map[string]pendingAlert),
+		checks:       make(map[string]*checkState),
+		logWatches:   make(map[string]*logWatchState),
+		notifiers:    make(map[string]*notifierState),
+		notifyClient: &http.Client{Timeout: defaultNotifyTimeout},
+		history:      newMetricHistory(historyTiers(nil)),
 		status: &plugin.PluginStatus{
 			Status: "stopped",
 			Metrics: map[string]interface{}{
@@ -87,8 +149,40 @@ func (p *MonitorPlugin) Info() *plugin.PluginInfo {
 		Tags:        []string{"monitor", "alert", "metrics"},
 		Config: map[string]string{
 			"collect_interval": "30s",
-			"alert_cooldown":   "5m",
 			"retention_days":   "7",
+			// 告警恢复后 alert_cooldown 内再次触发不重复通知；告警持续 escalate_after 未确认时提升级别，为空不升级
+			"alert_cooldown": "5m",
+			"escalate_after": "",
+			// 指标历史：history_retention 内保存 history_resolution 精度，retention_days 天内保存 downsample_resolution 精度
+			"history_resolution":    "30s",
+			"history_retention":     "24h",
+			"downsample_resolution": "5m",
+			// 进程监控：process_watch 中的进程（逗号分隔）按进程名汇总 process_* 指标
+			"process_monitoring": "true",
+			"process_watch":      "",
+			// 硬件监控：温度传感器、风扇和降频状态随指标采集，SMART 需要安装 smartctl 并按 smart_interval 采集
+			"hardware_monitoring": "true",
+			"smart_enabled":       "true",
+			"smart_interval":      "30m",
+			// 系统日志错误率：Linux 读取 journald，Windows 读取 event_log_channels 中的事件日志通道，
+			// event_log_forward 为 true 时将事件转发到服务器
+			"event_log_enabled":     "true",
+			"event_log_interval":    "1m",
+			"event_log_channels":    "System,Application",
+			"event_log_forward":     "false",
+			"event_log_forward_max": "100",
+			// 日志监控读取文件的间隔
+			"log_poll_interval": "2s",
+			// Prometheus 指标端点，配置用户名后要求 Basic 认证
+			"prometheus_enabled":  "false",
+			"prometheus_listen":   defaultPrometheusListen,
+			"prometheus_username": "",
+			"prometheus_password": "",
+		},
+		// 告警规则保存在数据目录，采集 SMART、GPU 和系统日志时运行 smartctl、nvidia-smi、journalctl 和 wevtutil
+		Permissions: &plugin.PluginPermissions{
+			Exec:       true,
+			WritePaths: []string{plugin.PathDataDir},
 		},
 	}
 }
@@ -98,8 +192,34 @@ func (p *MonitorPlugin) Init(ctx *plugin.PluginContext) error {
 	p.ctx = ctx
 	p.status.Status = "initialized"
 
-	// 初始化默认监控规则
-	p.initDefaultRules()
+	// 加载告警规则，首次运行时使用默认规则
+	if dataDir, _ := ctx.Agent.GetConfig("agent.data_dir").(string); dataDir != "" {
+		p.rulesFile = filepath.Join(dataDir, rulesFileName)
+		p.historyFile = filepath.Join(dataDir, historyFileName)
+		p.checksFile = filepath.Join(dataDir, checksFileName)
+		p.logWatchesFile = filepath.Join(dataDir, logWatchesFileName)
+		p.notifiersFile = filepath.Join(dataDir, notifiersFileName)
+	}
+	if err := p.loadRules(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load monitor rules: %v", err)
+	}
+	if err := p.loadChecks(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load service checks: %v", err)
+	}
+	if err := p.loadLogWatches(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load log watches: %v", err)
+	}
+	if err := p.loadNotifiers(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load notifiers: %v", err)
+	}
+
+	// 按配置的保存策略加载指标历史
+	p.mu.Lock()
+	p.history = newMetricHistory(historyTiers(p.config))
+	p.mu.Unlock()
+	if err := p.loadHistory(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load metric history: %v", err)
+	}
 
 	p.ctx.Logger.Info("System monitor plugin initialized")
 	return nil
@@ -107,14 +227,35 @@ func (p *MonitorPlugin) Init(ctx *plugin.PluginContext) error {
 
 // Start 启动插件
 func (p *MonitorPlugin) Start() error {
+	// 先启动指标端点，监听失败时插件不启动
+	if err := p.startPrometheus(); err != nil {
+		return err
+	}
+
 	p.status.Status = "running"
 	p.status.StartTime = time.Now()
 
+	// 修改指标端点配置后插件会被重启，每次启动使用新的停止信号
+	stop := make(chan struct{})
+	p.stopChan = stop
+
 	// 启动监控收集
-	go p.collectMetrics()
+	go p.collectMetrics(stop)
 
 	// 启动告警检查
-	go p.checkAlerts()
+	go p.checkAlerts(stop)
+
+	// 启动磁盘 SMART 采集
+	go p.collectSmart(stop)
+
+	// 启动服务检查调度
+	go p.runChecks(stop)
+
+	// 启动日志监控
+	go p.runLogWatches(stop)
+
+	// 启动系统日志错误统计
+	go p.runEventLog(stop)
 
 	p.ctx.Logger.Info("System monitor plugin started")
 	return nil
@@ -124,6 +265,11 @@ func (p *MonitorPlugin) Start() error {
 func (p *MonitorPlugin) Stop() error {
 	p.status.Status = "stopped"
 	close(p.stopChan)
+	p.stopPrometheus()
+
+	if err := p.saveHistory(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save metric history: %v", err)
+	}
 
 	p.ctx.Logger.Info("System monitor plugin stopped")
 	return nil
@@ -134,10 +280,40 @@ func (p *MonitorPlugin) HandleCommand(command string, args map[string]interface{
 	switch command {
 	case "get_metrics":
 		return p.handleGetMetrics(args)
+	case "query_metrics":
+		return p.handleQueryMetrics(args)
+	case "top_processes":
+		return p.handleTopProcesses(args)
+	case "get_event_log":
+		return p.handleGetEventLog(args)
+	case "add_check":
+		return p.handleAddCheck(args)
+	case "remove_check":
+		return p.handleRemoveCheck(args)
+	case "get_checks":
+		return p.handleGetChecks(args)
+	case "run_check":
+		return p.handleRunCheck(args)
+	case "add_log_watch":
+		return p.handleAddLogWatch(args)
+	case "remove_log_watch":
+		return p.handleRemoveLogWatch(args)
+	case "get_log_watches":
+		return p.handleGetLogWatches(args)
+	case "add_notifier":
+		return p.handleAddNotifier(args)
+	case "remove_notifier":
+		return p.handleRemoveNotifier(args)
+	case "get_notifiers":
+		return p.handleGetNotifiers(args)
+	case "test_notifier":
+		return p.handleTestNotifier(args)
 	case "get_alerts":
 		return p.handleGetAlerts(args)
 	case "add_rule":
 		return p.handleAddRule(args)
+	case "update_rule":
+		return p.handleUpdateRule(args)
 	case "remove_rule":
 		return p.handleRemoveRule(args)
 	case "acknowledge_alert":
@@ -151,6 +327,100 @@ func (p *MonitorPlugin) HandleCommand(command string, args map[string]interface{
 	}
 }
 
+// CommandSchemas 返回命令参数声明，插件管理器据此校验参数
+func (p *MonitorPlugin) CommandSchemas() map[string]*plugin.CommandSchema {
+	return monitorCommandSchemas
+}
+
+var monitorCommandSchemas = map[string]*plugin.CommandSchema{
+	"get_metrics": {Args: map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Description: "只返回指定名称的指标"}}},
+	"query_metrics": {Args: map[string]plugin.ArgSchema{
+		"name":        {Type: plugin.ArgString, Required: true},
+		"labels":      {Type: plugin.ArgObject, Description: "只返回标签全部相同的时间序列"},
+		"start":       {Type: plugin.ArgString, Description: "起始时间（RFC3339）"},
+		"end":         {Type: plugin.ArgString, Description: "结束时间（RFC3339），默认当前时间"},
+		"range":       {Type: plugin.ArgString, Description: "未指定 start 时查询最近一段时间，默认 1h"},
+		"step":        {Type: plugin.ArgString, Description: "聚合步长，默认为数据精度"},
+		"aggregation": {Type: plugin.ArgString, Default: "avg", Enum: historyAggregations},
+	}},
+	"top_processes": {Args: map[string]plugin.ArgSchema{
+		"sort_by": {Type: plugin.ArgString, Default: "cpu", Enum: processSortKeys},
+		"limit":   {Type: plugin.ArgInteger, Default: 10},
+		"name":    {Type: plugin.ArgString, Description: "只返回指定名称的进程"},
+	}},
+	"get_event_log": {Args: map[string]plugin.ArgSchema{
+		"level": {Type: plugin.ArgString, Enum: eventLevels},
+		"limit": {Type: plugin.ArgInteger, Default: maxEventEntries},
+	}},
+	"add_check": {Args: map[string]plugin.ArgSchema{
+		"name":          {Type: plugin.ArgString, Required: true},
+		"type":          {Type: plugin.ArgString, Required: true, Enum: checkTypes},
+		"target":        {Type: plugin.ArgString, Required: true, Description: "http 为 URL，tcp 为 host:port，icmp 为主机名或 IP"},
+		"interval":      {Type: plugin.ArgString, Default: "1m"},
+		"timeout":       {Type: plugin.ArgString, Default: "10s"},
+		"method":        {Type: plugin.ArgString, Description: "http 请求方法，默认 GET"},
+		"expect_status": {Type: plugin.ArgInteger, Description: "http 期望的状态码，默认小于 400 即成功"},
+	}},
+	"remove_check": {Args: map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Required: true}}},
+	"run_check":    {Args: map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Required: true}}},
+	"add_log_watch": {Args: map[string]plugin.ArgSchema{
+		"name":      {Type: plugin.ArgString, Required: true},
+		"path":      {Type: plugin.ArgString, Required: true},
+		"pattern":   {Type: plugin.ArgString, Required: true, Description: "正则表达式"},
+		"window":    {Type: plugin.ArgString, Default: "5m", Description: "计数窗口"},
+		"threshold": {Type: plugin.ArgInteger, Default: 1, Description: "窗口内匹配行数达到该值时告警"},
+		"severity":  {Type: plugin.ArgString, Default: "warning", Enum: ruleSeverities},
+		"notify":    {Type: plugin.ArgArray, Description: "通知渠道名称，默认发送到默认渠道"},
+	}},
+	"remove_log_watch": {Args: map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Required: true}}},
+	"add_notifier": {Args: map[string]plugin.ArgSchema{
+		"name":         {Type: plugin.ArgString, Required: true},
+		"type":         {Type: plugin.ArgString, Required: true, Enum: notifierTypes},
+		"default":      {Type: plugin.ArgBool, Description: "规则未指定 notify 时发送到该渠道"},
+		"severities":   {Type: plugin.ArgArray, Description: "只发送这些级别的告警"},
+		"template":     {Type: plugin.ArgString, Description: "消息模板（text/template）"},
+		"max_per_hour": {Type: plugin.ArgInteger, Default: defaultNotifyMaxPerHour},
+		"url":          {Type: plugin.ArgString},
+		"headers":      {Type: plugin.ArgObject},
+		"routing_key":  {Type: plugin.ArgString},
+		"smtp_host":    {Type: plugin.ArgString},
+		"smtp_port":    {Type: plugin.ArgInteger},
+		"username":     {Type: plugin.ArgString},
+		"password":     {Type: plugin.ArgString},
+		"from":         {Type: plugin.ArgString},
+		"to":           {Type: plugin.ArgArray},
+	}},
+	"remove_notifier": {Args: map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Required: true}}},
+	"test_notifier":   {Args: map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Required: true}}},
+	"add_rule": {Args: map[string]plugin.ArgSchema{
+		"name":           {Type: plugin.ArgString, Required: true},
+		"metric":         {Type: plugin.ArgString, Required: true},
+		"condition":      {Type: plugin.ArgString, Required: true, Enum: ruleConditions},
+		"threshold":      {Type: plugin.ArgNumber, Required: true},
+		"duration":       {Type: plugin.ArgString, Description: "条件持续成立多久后触发，如 5m，默认立即触发"},
+		"severity":       {Type: plugin.ArgString, Default: "warning", Enum: ruleSeverities},
+		"labels":         {Type: plugin.ArgObject, Description: "只匹配标签全部相同的时间序列"},
+		"description":    {Type: plugin.ArgString},
+		"notify":         {Type: plugin.ArgArray, Description: "通知渠道名称，默认发送到默认渠道"},
+		"escalate_after": {Type: plugin.ArgString, Description: "告警持续多久未确认后提升一级，默认使用 escalate_after 配置"},
+	}},
+	"update_rule": {Args: map[string]plugin.ArgSchema{
+		"name":           {Type: plugin.ArgString, Required: true},
+		"metric":         {Type: plugin.ArgString},
+		"condition":      {Type: plugin.ArgString, Enum: ruleConditions},
+		"threshold":      {Type: plugin.ArgNumber},
+		"duration":       {Type: plugin.ArgString},
+		"severity":       {Type: plugin.ArgString, Enum: ruleSeverities},
+		"labels":         {Type: plugin.ArgObject},
+		"description":    {Type: plugin.ArgString},
+		"notify":         {Type: plugin.ArgArray},
+		"escalate_after": {Type: plugin.ArgString},
+	}},
+	"remove_rule":       {Args: map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Required: true}}},
+	"acknowledge_alert": {Args: map[string]plugin.ArgSchema{"id": {Type: plugin.ArgString, Required: true}}},
+	"resolve_alert":     {Args: map[string]plugin.ArgSchema{"id": {Type: plugin.ArgString, Required: true}}},
+}
+
 // HandleEvent 处理事件
 func (p *MonitorPlugin) HandleEvent(eventType string, data map[string]interface{}) error {
 	switch eventType {
@@ -171,6 +441,7 @@ func (p *MonitorPlugin) Status() *plugin.PluginStatus {
 	defer p.mu.RUnlock()
 
 	p.status.Metrics["total_metrics"] = len(p.metrics)
+	p.status.Metrics["history_series"] = len(p.history.Series)
 
 	activeAlerts := 0
 	for _, alert := range p.alerts {
@@ -195,23 +466,43 @@ func (p *MonitorPlugin) Health() error {
 
 // GetConfig 获取配置
 func (p *MonitorPlugin) GetConfig() map[string]interface{} {
-	return p.config
+	return p.currentConfig()
 }
 
-// SetConfig 设置配置
+// SetConfig 设置配置，采集 goroutine 可能正在读取配置
 func (p *MonitorPlugin) SetConfig(config map[string]interface{}) error {
+	p.mu.Lock()
 	p.config = config
+	p.mu.Unlock()
 	return nil
 }
 
-// handleGetMetrics 处理获取指标命令
+// currentConfig 返回当前配置，SetConfig 整体替换配置而不修改原 map，返回值可在锁外读取。
+// 已持有 p.mu 的调用方直接读取 p.config
+func (p *MonitorPlugin) currentConfig() map[string]interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.config
+}
+
+// handleGetMetrics 处理获取指标命令，name 只返回指定名称的时间序列
 func (p *MonitorPlugin) handleGetMetrics(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["name"].(string)
+
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	metrics := make([]*MetricInfo, 0, len(p.metrics))
-	for _, metric := range p.metrics {
-		metrics = append(metrics, metric)
+	keys := make([]string, 0, len(p.metrics))
+	for key, metric := range p.metrics {
+		if name == "" || metric.Name == name {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	metrics := make([]*MetricInfo, 0, len(keys))
+	for _, key := range keys {
+		metrics = append(metrics, p.metrics[key])
 	}
 
 	return map[string]interface{}{
@@ -236,72 +527,6 @@ func (p *MonitorPlugin) handleGetAlerts(args map[string]interface{}) (interface{
 	}, nil
 }
 
-// handleAddRule 处理添加规则命令
-func (p *MonitorPlugin) handleAddRule(args map[string]interface{}) (interface{}, error) {
-	name, ok := args["name"].(string)
-	if !ok {
-		return nil, fmt.Errorf("name is required")
-	}
-
-	metric, ok := args["metric"].(string)
-	if !ok {
-		return nil, fmt.Errorf("metric is required")
-	}
-
-	condition, ok := args["condition"].(string)
-	if !ok {
-		return nil, fmt.Errorf("condition is required")
-	}
-
-	threshold, ok := args["threshold"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("threshold is required")
-	}
-
-	severity, _ := args["severity"].(string)
-	if severity == "" {
-		severity = "warning"
-	}
-
-	// 创建监控规则
-	_ = &MonitorRule{
-		Name:      name,
-		Metric:    metric,
-		Condition: condition,
-		Threshold: threshold,
-		Severity:  severity,
-		Duration:  5 * time.Minute, // 默认5分钟
-		Labels:    make(map[string]string),
-	}
-
-	// 添加到规则列表
-	p.mu.Lock()
-	// 这里应该添加到规则列表，暂时跳过
-	p.mu.Unlock()
-
-	return map[string]interface{}{
-		"name":    name,
-		"message": "Rule added successfully",
-	}, nil
-}
-
-// handleRemoveRule 处理移除规则命令
-func (p *MonitorPlugin) handleRemoveRule(args map[string]interface{}) (interface{}, error) {
-	name, ok := args["name"].(string)
-	if !ok {
-		return nil, fmt.Errorf("name is required")
-	}
-
-	p.mu.Lock()
-	// 这里应该从规则列表中移除，暂时跳过
-	p.mu.Unlock()
-
-	return map[string]interface{}{
-		"name":    name,
-		"message": "Rule removed successfully",
-	}, nil
-}
-
 // handleAcknowledgeAlert 处理确认告警命令
 func (p *MonitorPlugin) handleAcknowledgeAlert(args map[string]interface{}) (interface{}, error) {
 	id, ok := args["id"].(string)
@@ -339,8 +564,9 @@ func (p *MonitorPlugin) handleResolveAlert(args map[string]interface{}) (interfa
 		return nil, fmt.Errorf("alert not found")
 	}
 
-	alert.Status = "resolved"
-	alert.ResolvedAt = time.Now()
+	if alert.Status != "resolved" {
+		p.resolveAlertLocked(alert, time.Now(), "manual")
+	}
 	p.mu.Unlock()
 
 	return map[string]interface{}{
@@ -349,200 +575,67 @@ func (p *MonitorPlugin) handleResolveAlert(args map[string]interface{}) (interfa
 	}, nil
 }
 
-// handleGetRules 处理获取规则命令
-func (p *MonitorPlugin) handleGetRules(args map[string]interface{}) (interface{}, error) {
-	// 返回监控规则列表
-	rules := []*MonitorRule{
-		{
-			Name:      "high_cpu_usage",
-			Metric:    "cpu_usage",
-			Condition: ">",
-			Threshold: 80.0,
-			Severity:  "warning",
-		},
-		{
-			Name:      "high_memory_usage",
-			Metric:    "memory_usage",
-			Condition: ">",
-			Threshold: 85.0,
-			Severity:  "warning",
-		},
-		{
-			Name:      "low_disk_space",
-			Metric:    "disk_usage",
-			Condition: ">",
-			Threshold: 90.0,
-			Severity:  "error",
-		},
+// collectMetrics 启动时立即采集一次，之后按 collect_interval 定期采集
+func (p *MonitorPlugin) collectMetrics(stop <-chan struct{}) {
+	collect := func() {
+		p.collectSystemMetrics()
+		config := p.currentConfig()
+		if plugin.ConfigBool(config, "process_monitoring", true) {
+			p.collectProcessMetrics()
+		}
+		if plugin.ConfigBool(config, "hardware_monitoring", true) {
+			p.collectSensorMetrics()
+		}
 	}
+	collect()
 
-	return map[string]interface{}{
-		"rules": rules,
-		"count": len(rules),
-	}, nil
-}
-
-// collectMetrics 收集指标
-func (p *MonitorPlugin) collectMetrics() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(plugin.ConfigDuration(p.currentConfig(), "collect_interval", defaultCollectInterval))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			p.collectSystemMetrics()
-		case <-p.stopChan:
+			collect()
+		case <-stop:
 			return
 		}
 	}
 }
 
-// collectSystemMetrics 收集系统指标
-func (p *MonitorPlugin) collectSystemMetrics() {
-	// 获取系统信息
-	sysInfo, err := p.ctx.Agent.GetSystemInfo()
-	if err != nil {
-		p.ctx.Logger.Errorf("Failed to get system info: %v", err)
-		return
-	}
-
-	now := time.Now()
-
-	// 收集CPU使用率
-	if cpuCount, ok := sysInfo["cpu_count"].(int); ok {
-		p.updateMetric("cpu_count", float64(cpuCount), "count", now)
+// updateMetricLocked 更新指标，调用方需持有 p.mu
+func (p *MonitorPlugin) updateMetricLocked(key string, s sample, source string, timestamp time.Time) {
+	labels := s.Labels
+	if labels == nil {
+		labels = make(map[string]string)
 	}
-
-	// 收集内存使用率
-	if memoryTotal, ok := sysInfo["memory_total"].(int64); ok {
-		p.updateMetric("memory_total", float64(memoryTotal), "bytes", now)
-	}
-
-	// 模拟其他指标
-	p.updateMetric("cpu_usage", 45.2, "percent", now)
-	p.updateMetric("memory_usage", 67.8, "percent", now)
-	p.updateMetric("disk_usage", 23.4, "percent", now)
-	p.updateMetric("network_in", 1024.5, "bytes/s", now)
-	p.updateMetric("network_out", 512.3, "bytes/s", now)
-}
-
-// updateMetric 更新指标
-func (p *MonitorPlugin) updateMetric(name string, value float64, unit string, timestamp time.Time) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	metric := &MetricInfo{
-		Name:      name,
-		Value:     value,
-		Unit:      unit,
+		Name:      s.Name,
+		Value:     s.Value,
+		Unit:      s.Unit,
 		Type:      "gauge",
 		Timestamp: timestamp,
-		Labels:    make(map[string]string),
-		Metadata:  make(map[string]interface{}),
-	}
-
-	p.metrics[name] = metric
-
-	// 检查告警规则
-	p.checkMetricAlerts(name, value)
-}
-
-// checkMetricAlerts 检查指标告警
-func (p *MonitorPlugin) checkMetricAlerts(metricName string, value float64) {
-	// 简单的告警检查逻辑
-	switch metricName {
-	case "cpu_usage":
-		if value > 80.0 {
-			p.createAlert("high_cpu_usage", "High CPU Usage", "warning", metricName, 80.0, value)
-		}
-	case "memory_usage":
-		if value > 85.0 {
-			p.createAlert("high_memory_usage", "High Memory Usage", "warning", metricName, 85.0, value)
-		}
-	case "disk_usage":
-		if value > 90.0 {
-			p.createAlert("low_disk_space", "Low Disk Space", "error", metricName, 90.0, value)
-		}
-	}
-}
-
-// createAlert 创建告警
-func (p *MonitorPlugin) createAlert(id, name, severity, metric string, threshold, current float64) {
-	// 检查是否已存在相同告警
-	if existing, exists := p.alerts[id]; exists && existing.Status == "active" {
-		return
+		Labels:    labels,
+		Metadata:  map[string]interface{}{"source": source},
 	}
 
-	alert := &AlertInfo{
-		ID:        id,
-		Name:      name,
-		Severity:  severity,
-		Status:    "active",
-		Message:   fmt.Sprintf("%s: current value %.2f exceeds threshold %.2f", name, current, threshold),
-		Metric:    metric,
-		Threshold: threshold,
-		Current:   current,
-		CreatedAt: time.Now(),
-		Labels:    make(map[string]string),
-		Annotations: map[string]interface{}{
-			"description": fmt.Sprintf("Metric %s is above threshold", metric),
-		},
-	}
-
-	p.alerts[id] = alert
-
-	// 发送告警事件
-	p.ctx.Agent.NotifyEvent("alert_triggered", map[string]interface{}{
-		"alert_id": id,
-		"name":     name,
-		"severity": severity,
-		"message":  alert.Message,
-	})
-
-	p.ctx.Logger.Warnf("Alert triggered: %s", alert.Message)
+	p.metrics[key] = metric
 }
 
 // checkAlerts 检查告警
-func (p *MonitorPlugin) checkAlerts() {
+func (p *MonitorPlugin) checkAlerts(stop <-chan struct{}) {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			p.resolveStaleAlerts()
-		case <-p.stopChan:
+			p.maintainAlerts(time.Now())
+		case <-stop:
 			return
 		}
 	}
 }
 
-// resolveStaleAlerts 解决过期告警
-func (p *MonitorPlugin) resolveStaleAlerts() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	now := time.Now()
-	for id, alert := range p.alerts {
-		if alert.Status == "active" && now.Sub(alert.CreatedAt) > 30*time.Minute {
-			alert.Status = "resolved"
-			alert.ResolvedAt = now
-
-			p.ctx.Agent.NotifyEvent("alert_resolved", map[string]interface{}{
-				"alert_id": id,
-				"name":     alert.Name,
-			})
-
-			p.ctx.Logger.Infof("Alert resolved: %s", alert.Name)
-		}
-	}
-}
-
-// initDefaultRules 初始化默认监控规则
-func (p *MonitorPlugin) initDefaultRules() {
-	// 这里可以初始化一些默认的监控规则
-}
-
 // 事件处理方法
 func (p *MonitorPlugin) handleMetricUpdated(data map[string]interface{}) error {
 	p.ctx.Logger.Info("Metric updated event received")
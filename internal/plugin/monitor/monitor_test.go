@@ -0,0 +1,966 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/plugin"
+	"assistant_agent/internal/plugin/plugintest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPlugin 创建使用模拟 Agent 初始化的监控插件
+func newTestPlugin(t *testing.T, agent *plugintest.Agent, config map[string]interface{}) *MonitorPlugin {
+	return plugintest.InitPlugin(t, NewMonitorPlugin(), agent, config)
+}
+
+// metricValue 返回时间序列的当前值
+func metricValue(t *testing.T, p *MonitorPlugin, key string) float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	metric, ok := p.metrics[key]
+	require.True(t, ok, "metric %s not found", key)
+	return metric.Value
+}
+
+func TestMetricHelpers(t *testing.T) {
+	assert.Equal(t, "cpu_usage", metricKey("cpu_usage", nil))
+	assert.Equal(t, `partition_usage{device="/dev/sda1",mount="/"}`,
+		metricKey("partition_usage", map[string]string{"mount": "/", "device": "/dev/sda1"}))
+
+	rate, ok := counterRate(1000, 4000, 2*time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, 1500.0, rate)
+	_, ok = counterRate(4000, 1000, time.Second)
+	assert.False(t, ok)
+}
+
+func TestCollectSystemMetrics(t *testing.T) {
+	agent := &plugintest.Agent{}
+	agent.SetSystemInfo(map[string]interface{}{
+		"cpu_usage": 12.5, "memory_usage": 40.0, "disk_usage": 91.0,
+		"connections": map[string]int{"ESTABLISHED": 3, "LISTEN": 2},
+	})
+	p := newTestPlugin(t, agent, nil)
+
+	p.collectSystemMetrics()
+	assert.Equal(t, 12.5, metricValue(t, p, "cpu_usage"))
+	assert.Equal(t, 91.0, metricValue(t, p, "disk_usage"))
+	assert.Equal(t, 3.0, metricValue(t, p, `tcp_connections{state="ESTABLISHED"}`))
+	assert.Equal(t, 5.0, metricValue(t, p, "tcp_connections_total"))
+	metricValue(t, p, `cpu_core_usage{core="0"}`)
+	metricValue(t, p, "memory_total")
+
+	// 速率在第二次采集时才有值
+	time.Sleep(20 * time.Millisecond)
+	p.collectSystemMetrics()
+	metricValue(t, p, `network_interface_in{interface="lo"}`)
+
+	result, err := p.HandleCommand("get_metrics", map[string]interface{}{"name": "cpu_usage"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["count"])
+
+	// 不再采集到的时间序列被删除
+	agent.SetSystemInfo(map[string]interface{}{"cpu_usage": 20.0})
+	p.collectSystemMetrics()
+	p.mu.RLock()
+	_, exists := p.metrics["disk_usage"]
+	p.mu.RUnlock()
+	assert.False(t, exists)
+}
+
+func TestAlertRules(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+
+	// 默认规则
+	result, err := p.HandleCommand("get_rules", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 7, result.(map[string]interface{})["count"])
+
+	// 条件持续成立 5 分钟后才触发
+	now := time.Now()
+	cpu := func(value float64, at time.Time) {
+		p.recordSamples("test", []sample{{Name: "cpu_usage", Value: value}}, at)
+	}
+	cpu(95, now)
+	cpu(95, now.Add(4*time.Minute))
+	assert.Empty(t, agent.Events("alert_triggered"))
+	cpu(95, now.Add(5*time.Minute))
+	require.Len(t, agent.Events("alert_triggered"), 1)
+	assert.Equal(t, "high_cpu_usage", agent.Events("alert_triggered")[0].Data["rule"])
+
+	// 条件中断后重新计时
+	cpu(10, now.Add(6*time.Minute))
+	cpu(95, now.Add(7*time.Minute))
+	p.mu.RLock()
+	assert.Equal(t, now.Add(7*time.Minute), p.pending["high_cpu_usage"].Since)
+	p.mu.RUnlock()
+
+	// 标签匹配，每个时间序列单独告警
+	_, err = p.HandleCommand("add_rule", map[string]interface{}{
+		"name": "root_full", "metric": "partition_usage", "condition": ">=", "threshold": 95.0,
+		"labels": map[string]interface{}{"mount": "/"},
+	})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("add_rule", map[string]interface{}{"name": "root_full", "metric": "x", "condition": ">", "threshold": 1.0})
+	assert.Error(t, err)
+	p.recordSamples("disk", []sample{
+		{Name: "partition_usage", Value: 96, Labels: map[string]string{"mount": "/"}},
+		{Name: "partition_usage", Value: 99, Labels: map[string]string{"mount": "/data"}},
+	}, now)
+	fired := agent.Events("alert_triggered")
+	require.Len(t, fired, 2)
+	assert.Equal(t, `root_full{mount="/"}`, fired[1].Data["alert_id"])
+
+	// 更新只修改提供的字段
+	_, err = p.HandleCommand("update_rule", map[string]interface{}{"name": "root_full", "threshold": 90.0, "duration": "10m"})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("update_rule", map[string]interface{}{"name": "root_full", "duration": "soon"})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("update_rule", map[string]interface{}{"name": "missing"})
+	assert.Error(t, err)
+
+	// 规则持久化到数据目录
+	reloaded := newTestPlugin(t, &plugintest.Agent{DataDir: agent.DataDir}, nil)
+	rule := reloaded.rules["root_full"]
+	require.NotNil(t, rule)
+	assert.Equal(t, 90.0, rule.Threshold)
+	assert.Equal(t, "10m", rule.Duration)
+	assert.Equal(t, map[string]string{"mount": "/"}, rule.Labels)
+
+	_, err = p.HandleCommand("remove_rule", map[string]interface{}{"name": "high_cpu_usage"})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("remove_rule", map[string]interface{}{"name": "high_cpu_usage"})
+	assert.Error(t, err)
+	reloaded = newTestPlugin(t, &plugintest.Agent{DataDir: agent.DataDir}, nil)
+	assert.Len(t, reloaded.rules, 7)
+	assert.NotContains(t, reloaded.rules, "high_cpu_usage")
+}
+
+func TestPrometheusEndpoint(t *testing.T) {
+	agent := &plugintest.Agent{Status: map[string]interface{}{
+		"agent_id":  "agent-1",
+		"uptime":    120.0,
+		"connected": true,
+		"plugins": map[string]*plugin.PluginStatus{
+			"software": {Status: "running", Metrics: map[string]interface{}{"installed": 12, "state": "idle"}},
+		},
+	}}
+	p := newTestPlugin(t, agent, map[string]interface{}{
+		"prometheus_enabled":  "true",
+		"prometheus_listen":   "127.0.0.1:0",
+		"prometheus_username": "prom",
+		"prometheus_password": "secret",
+	})
+	p.recordSamples("test", []sample{
+		{Name: "cpu_usage", Value: 12.5, Unit: "percent"},
+		{Name: "disk_usage", Value: 95, Unit: "percent"},
+		{Name: "partition_usage", Value: 40, Labels: map[string]string{"mount": `C:\`}},
+		{Name: "partition_usage", Value: 95, Labels: map[string]string{"mount": "/"}},
+	}, time.Now())
+
+	require.NoError(t, p.startPrometheus())
+	defer p.stopPrometheus()
+	url := "http://" + p.serverAddr + prometheusPath
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.SetBasicAuth("prom", "secret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, prometheusContentType, resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	text := string(body)
+
+	assert.Contains(t, text, "# HELP assistant_agent_cpu_usage cpu_usage (percent)\n# TYPE assistant_agent_cpu_usage gauge\nassistant_agent_cpu_usage 12.5\n")
+	assert.Contains(t, text, `assistant_agent_partition_usage{mount="/"} 95`)
+	assert.Contains(t, text, `assistant_agent_partition_usage{mount="C:\\"} 40`)
+	assert.Contains(t, text, `assistant_agent_alerts_active{severity="error"} 1`)
+	assert.Contains(t, text, `assistant_agent_info{agent_id="agent-1"} 1`)
+	assert.Contains(t, text, "assistant_agent_connected 1\n")
+	assert.Contains(t, text, `assistant_agent_plugin_running{plugin="software"} 1`)
+	assert.Contains(t, text, `assistant_agent_plugin_metric{metric="installed",plugin="software"} 12`)
+	assert.NotContains(t, text, `metric="state"`)
+
+	// 修改配置后插件重启，端点随插件启停
+	p.stopPrometheus()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, p.Start())
+		assert.NotEmpty(t, p.serverAddr)
+		require.NoError(t, p.Stop())
+		assert.Nil(t, p.server)
+	}
+
+	// 未启用时不监听
+	disabled := newTestPlugin(t, &plugintest.Agent{}, nil)
+	require.NoError(t, disabled.startPrometheus())
+	assert.Nil(t, disabled.server)
+}
+
+func TestPrometheusHelpers(t *testing.T) {
+	assert.Equal(t, "disk_read_rate", sanitizeName("disk_read_rate"))
+	assert.Equal(t, "__a_b", sanitizeName("9.a-b"))
+	assert.Equal(t, `{a="x\"y\\z\n",b="1"}`, formatLabels(map[string]string{"b": "1", "a": "x\"y\\z\n"}))
+
+	// JSON 解码后的插件状态
+	statuses := pluginStatuses(map[string]interface{}{"file": map[string]interface{}{"status": "stopped"}})
+	require.Contains(t, statuses, "file")
+	assert.Equal(t, "stopped", statuses["file"].Status)
+
+	rec := httptest.NewRecorder()
+	p := newTestPlugin(t, &plugintest.Agent{}, nil)
+	p.prometheusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, prometheusPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestMetricHistory(t *testing.T) {
+	// 环形缓冲区写满后覆盖最旧的 bucket，同一 bucket 内的采样合并
+	r := &ring{Res: 10}
+	for ts := int64(0); ts < 50; ts += 5 {
+		r.add(ts, float64(ts), 3)
+	}
+	r.add(12, 99, 3) // 早于最新 bucket，忽略
+	var got []bucket
+	r.each(0, 100, func(b bucket) { got = append(got, b) })
+	require.Len(t, got, 3)
+	assert.Equal(t, bucket{T: 20, Sum: 45, Min: 20, Max: 25, Count: 2}, got[0])
+	assert.Equal(t, int64(40), got[2].T)
+
+	assert.Equal(t, 95.0, percentile([]float64{5, 1, 100, 95, 50, 20, 30, 40, 60, 70, 80, 90, 10, 15, 25, 35, 45, 55, 65, 75}, 0.95))
+
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{
+		"history_resolution":    "30s",
+		"history_retention":     "1h",
+		"downsample_resolution": "5m",
+		"retention_days":        "1",
+	})
+	require.Len(t, p.history.Tiers, 2)
+	assert.Equal(t, 120, p.history.Tiers[0].size())
+
+	// 最近 2 小时每 30 秒一个采样，值为距起点的分钟数
+	now := time.Now().Truncate(time.Hour)
+	start := now.Add(-2 * time.Hour)
+	for ts := start; !ts.After(now); ts = ts.Add(30 * time.Second) {
+		p.recordSamples("test", []sample{
+			{Name: "partition_usage", Value: ts.Sub(start).Minutes(), Labels: map[string]string{"mount": "/"}},
+			{Name: "partition_usage", Value: 1, Labels: map[string]string{"mount": "/data"}},
+		}, ts)
+	}
+
+	// 最近 10 分钟使用 30 秒精度
+	series, step := p.history.query(historyQuery{Name: "partition_usage", Labels: map[string]string{"mount": "/"},
+		Start: now.Add(-10 * time.Minute), End: now, Aggregation: "avg"}, now)
+	require.Len(t, series, 1)
+	assert.Equal(t, 30*time.Second, step)
+	assert.Len(t, series[0].Points, 21)
+	assert.Equal(t, 120.0, series[0].Points[20].Value)
+
+	// 2 小时前超出高精度保存时间，使用 5 分钟精度；步长向上取整为精度的倍数
+	// 第二个点为第 10 到 20 分钟，包含平均值 12.25 和 17.25 的两个 bucket
+	for _, tc := range []struct {
+		aggregation string
+		value       float64
+	}{{"avg", 14.75}, {"min", 10}, {"max", 19.5}, {"p95", 17.25}} {
+		series, step = p.history.query(historyQuery{Name: "partition_usage", Labels: map[string]string{"mount": "/"},
+			Start: start, End: now, Step: 7 * time.Minute, Aggregation: tc.aggregation}, now)
+		assert.Equal(t, 10*time.Minute, step)
+		require.Len(t, series[0].Points, 13)
+		assert.Equal(t, tc.value, series[0].Points[1].Value, tc.aggregation)
+	}
+
+	result, err := p.HandleCommand("query_metrics", map[string]interface{}{"name": "partition_usage", "range": "5m", "aggregation": "max"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.(map[string]interface{})["count"])
+	_, err = p.HandleCommand("query_metrics", map[string]interface{}{"name": "partition_usage", "aggregation": "median"})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("query_metrics", map[string]interface{}{"name": "partition_usage", "start": "yesterday"})
+	assert.Error(t, err)
+
+	// 历史在插件停止时保存，重启后恢复
+	require.NoError(t, p.saveHistory())
+	reloaded := newTestPlugin(t, &plugintest.Agent{DataDir: agent.DataDir}, p.config)
+	assert.Len(t, reloaded.history.Series, 2)
+	changed := newTestPlugin(t, &plugintest.Agent{DataDir: agent.DataDir}, map[string]interface{}{"history_resolution": "1m"})
+	assert.Empty(t, changed.history.Series)
+}
+
+func TestProcessMonitoring(t *testing.T) {
+	procs := []*ProcessInfo{
+		{PID: 1, Name: "postgres", CPUPercent: 10, MemoryRSS: 6 << 30, ReadRate: 100},
+		{PID: 2, Name: "postgres", CPUPercent: 5, MemoryRSS: 3 << 30, WriteRate: 50},
+		{PID: 3, Name: "nginx", CPUPercent: 30, MemoryRSS: 1 << 20},
+	}
+	samples := processSamples(procs, []string{"postgres", "redis-server"})
+	assert.Equal(t, sample{Name: "process_total", Value: 3, Unit: "count"}, samples[0])
+	byKey := make(map[string]float64)
+	for _, s := range samples {
+		byKey[metricKey(s.Name, s.Labels)] = s.Value
+	}
+	assert.Equal(t, 2.0, byKey[`process_count{process="postgres"}`])
+	assert.Equal(t, 15.0, byKey[`process_cpu_usage{process="postgres"}`])
+	assert.Equal(t, float64(9<<30), byKey[`process_memory_rss{process="postgres"}`])
+	assert.Equal(t, 0.0, byKey[`process_count{process="redis-server"}`])
+
+	// 针对进程的规则：RSS 超过 8GB、进程未运行
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{"process_watch": "nginx, postgres"})
+	for _, args := range []map[string]interface{}{
+		{"name": "postgres_rss", "metric": "process_memory_rss", "condition": ">", "threshold": float64(8 << 30), "labels": map[string]interface{}{"process": "postgres"}},
+		{"name": "redis_down", "metric": "process_count", "condition": "==", "threshold": 0.0, "labels": map[string]interface{}{"process": "redis-server"}},
+	} {
+		_, err := p.HandleCommand("add_rule", args)
+		require.NoError(t, err)
+	}
+	watched := p.watchedProcesses()
+	assert.Equal(t, []string{"nginx", "postgres", "redis-server"}, watched)
+	p.recordSamples("process", processSamples(procs, watched), time.Now())
+	fired := make(map[string]bool)
+	for _, event := range agent.Events("alert_triggered") {
+		fired[event.Data["rule"].(string)] = true
+	}
+	assert.Equal(t, map[string]bool{"postgres_rss": true, "redis_down": true}, fired)
+
+	// top_processes 按内存排序并截断
+	p.processes, p.processesAt = procs, time.Now()
+	result, err := p.HandleCommand("top_processes", map[string]interface{}{"sort_by": "memory", "limit": 2.0})
+	require.NoError(t, err)
+	top := result.(map[string]interface{})["processes"].([]ProcessInfo)
+	require.Len(t, top, 2)
+	assert.Equal(t, int32(1), top[0].PID)
+	assert.Equal(t, 3, result.(map[string]interface{})["total"])
+	_, err = p.HandleCommand("top_processes", map[string]interface{}{"sort_by": "threads"})
+	assert.Error(t, err)
+
+	// 真实采集：第二次采集后有 CPU 使用率，能找到测试进程本身
+	p.collectProcessMetrics()
+	time.Sleep(20 * time.Millisecond)
+	p.collectProcessMetrics()
+	p.mu.RLock()
+	var self *ProcessInfo
+	for _, proc := range p.processes {
+		if int(proc.PID) == os.Getpid() {
+			self = proc
+		}
+	}
+	p.mu.RUnlock()
+	require.NotNil(t, self)
+	assert.NotZero(t, self.MemoryRSS)
+	assert.NotZero(t, metricValue(t, p, "process_total"))
+}
+
+func TestHardwareMetrics(t *testing.T) {
+	ata := `{
+  "device": {"name": "/dev/sda", "type": "sat"},
+  "model_name": "WDC WD40EFRX",
+  "smart_status": {"passed": false},
+  "temperature": {"current": 41},
+  "power_on_time": {"hours": 31000},
+  "ata_smart_attributes": {"table": [
+    {"id": 5, "name": "Reallocated_Sector_Ct", "raw": {"value": 8}},
+    {"id": 9, "name": "Power_On_Hours", "raw": {"value": 31000}},
+    {"id": 197, "name": "Current_Pending_Sector", "raw": {"value": 2}}
+  ]}
+}`
+	samples, ok := parseSmartctl([]byte(ata))
+	require.True(t, ok)
+	values := make(map[string]float64)
+	for _, s := range samples {
+		assert.Equal(t, map[string]string{"device": "/dev/sda", "model": "WDC WD40EFRX"}, s.Labels)
+		values[s.Name] = s.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"smart_healthy": 0, "smart_temperature": 41, "smart_power_on_hours": 31000,
+		"smart_reallocated_sectors": 8, "smart_pending_sectors": 2,
+	}, values)
+
+	nvme := `{"device": {"name": "/dev/nvme0"}, "model_name": "Samsung SSD 980", "smart_status": {"passed": true},
+  "nvme_smart_health_information_log": {"percentage_used": 3, "media_errors": 0}}`
+	samples, ok = parseSmartctl([]byte(nvme))
+	require.True(t, ok)
+	require.Len(t, samples, 3)
+	assert.Equal(t, sample{Name: "smart_wear_percent", Value: 3, Unit: "percent", Labels: samples[0].Labels}, samples[1])
+
+	_, ok = parseSmartctl([]byte(`{"device": {"name": "/dev/sdb"}}`))
+	assert.False(t, ok)
+	_, ok = parseSmartctl([]byte("not json"))
+	assert.False(t, ok)
+
+	gpus := parseNvidiaSmi([]byte("0, NVIDIA GeForce RTX 3080, 83, 75, 0x0000000000000020\n1, Tesla T4, 40, [N/A], 0x0000000000000001\n"))
+	require.Len(t, gpus, 5)
+	assert.Equal(t, sample{Name: "thermal_throttled", Value: 1, Labels: map[string]string{"component": "gpu0"}}, gpus[2])
+	assert.Equal(t, "gpu_temperature", gpus[3].Name)
+	assert.Equal(t, 0.0, gpus[4].Value)
+
+	// sysfs 风扇转速和 CPU 降频计数
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "hwmon2"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "hwmon2", "name"), []byte("nct6775\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "hwmon2", "fan1_input"), []byte("1180\n"), 0644))
+	assert.Equal(t, []sample{{Name: "fan_speed", Value: 1180, Unit: "rpm", Labels: map[string]string{"sensor": "nct6775/fan1"}}}, fanSamples(root))
+	for i, count := range []string{"3", "4"} {
+		dir := filepath.Join(root, "cpu"+strconv.Itoa(i), "thermal_throttle")
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "core_throttle_count"), []byte(count), 0644))
+	}
+	count, ok := cpuThrottleCount(root)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(7), count)
+	_, ok = cpuThrottleCount(filepath.Join(root, "missing"))
+	assert.False(t, ok)
+
+	// 默认规则：SMART 失败和温度降频
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+	samples, _ = parseSmartctl([]byte(ata))
+	p.recordSamples("smart", samples, time.Now())
+	p.recordSamples("sensors", gpus, time.Now())
+	severities := make(map[string]interface{})
+	for _, event := range agent.Events("alert_triggered") {
+		severities[event.Data["alert_id"].(string)] = event.Data["severity"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		`disk_smart_failing{device="/dev/sda",model="WDC WD40EFRX"}`:   "critical",
+		`disk_pending_sectors{device="/dev/sda",model="WDC WD40EFRX"}`: "warning",
+		`thermal_throttling{component="gpu0"}`:                         "warning",
+	}, severities)
+}
+
+func TestEventLog(t *testing.T) {
+	journal := `{"__CURSOR":"s=a;i=1","__REALTIME_TIMESTAMP":"1700000000000000","PRIORITY":"3","SYSLOG_IDENTIFIER":"sshd","MESSAGE":"error: kex_exchange_identification"}
+{"__CURSOR":"s=a;i=2","__REALTIME_TIMESTAMP":"1700000001000000","PRIORITY":"2","_SYSTEMD_UNIT":"kernel","MESSAGE":[1,2,3]}
+not json
+`
+	entries, cursor := parseJournal([]byte(journal))
+	require.Len(t, entries, 2)
+	assert.Equal(t, "s=a;i=2", cursor)
+	assert.Equal(t, EventEntry{Time: time.Unix(1700000000, 0), Source: "journald", Channel: "journal", Level: "error",
+		Provider: "sshd", Message: "error: kex_exchange_identification"}, entries[0])
+	assert.Equal(t, "critical", entries[1].Level)
+	assert.Equal(t, "kernel", entries[1].Provider)
+	assert.Empty(t, entries[1].Message)
+
+	wevtutil := `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System><Provider Name='Service Control Manager'/>` +
+		`<EventID Qualifiers='49152'>7000</EventID><Level>2</Level><TimeCreated SystemTime='2024-01-02T03:04:05.1234567Z'/>` +
+		`<EventRecordID>812</EventRecordID><Channel>System</Channel></System>` +
+		`<RenderingInfo Culture='en-US'><Message>The Foo service failed to start.</Message><Level>Error</Level></RenderingInfo></Event>` +
+		`<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System><Provider Name='Kernel-Power'/>` +
+		`<EventID>41</EventID><Level>1</Level><TimeCreated SystemTime='2024-01-02T03:05:00Z'/><EventRecordID>815</EventRecordID>` +
+		`<Channel>System</Channel></System></Event>`
+	entries, maxRecord, err := parseWevtutil([]byte(wevtutil))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(815), maxRecord)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Service Control Manager", entries[0].Provider)
+	assert.Equal(t, 7000, entries[0].EventID)
+	assert.Equal(t, "The Foo service failed to start.", entries[0].Message)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 123456700, time.UTC), entries[0].Time)
+	assert.Equal(t, "critical", entries[1].Level)
+	_, _, err = parseWevtutil([]byte("<Event><System>"))
+	assert.Error(t, err)
+
+	// 错误率按分钟计算，没有事件的通道和级别输出 0
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{"event_log_forward": "true", "event_log_forward_max": "1"})
+	_, err = p.HandleCommand("add_rule", map[string]interface{}{
+		"name": "event_errors", "metric": "event_log_error_rate", "condition": ">=", "threshold": 0.5,
+		"labels": map[string]interface{}{"level": "critical"},
+	})
+	require.NoError(t, err)
+	p.recordEventLog("eventlog", []string{"System", "Application"}, entries, 2*time.Minute, time.Now())
+	assert.Equal(t, 0.5, metricValue(t, p, `event_log_error_rate{channel="System",level="error",source="eventlog"}`))
+	assert.Equal(t, 0.5, metricValue(t, p, `event_log_error_rate{channel="System",level="critical",source="eventlog"}`))
+	assert.Equal(t, 0.0, metricValue(t, p, `event_log_error_rate{channel="Application",level="error",source="eventlog"}`))
+	require.Len(t, agent.Events("alert_triggered"), 1)
+
+	// 转发的事件数受 event_log_forward_max 限制
+	forwarded := agent.Events("event_log_entries")
+	require.Len(t, forwarded, 1)
+	assert.Len(t, forwarded[0].Data["entries"], 1)
+	assert.Equal(t, 2, forwarded[0].Data["count"])
+	assert.Equal(t, true, forwarded[0].Data["truncated"])
+
+	// 最近的事件按时间倒序返回，事件消失后告警恢复
+	p.recordEventLog("eventlog", []string{"System", "Application"}, nil, time.Minute, time.Now())
+	assert.Len(t, agent.Events("alert_resolved"), 1)
+	result, err := p.HandleCommand("get_event_log", map[string]interface{}{"level": "critical"})
+	require.NoError(t, err)
+	recent := result.(map[string]interface{})["entries"].([]EventEntry)
+	require.Len(t, recent, 1)
+	assert.Equal(t, "Kernel-Power", recent[0].Provider)
+	_, err = p.HandleCommand("get_event_log", map[string]interface{}{"level": "debug"})
+	assert.Error(t, err)
+}
+
+func TestServiceChecks(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	p.checkTransport = srv.Client().Transport
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	closed.Close()
+	defer listener.Close()
+
+	for _, args := range []map[string]interface{}{
+		{"name": "web", "type": "http", "target": srv.URL + "/"},
+		{"name": "web_down", "type": "http", "target": srv.URL + "/down", "interval": "1h"},
+		{"name": "web_503", "type": "http", "target": srv.URL + "/down", "expect_status": 503.0},
+		{"name": "port", "type": "tcp", "target": listener.Addr().String()},
+		{"name": "port_closed", "type": "tcp", "target": closedAddr, "timeout": "2s"},
+	} {
+		_, err := p.HandleCommand("add_check", args)
+		require.NoError(t, err, args["name"])
+	}
+	for _, args := range []map[string]interface{}{
+		{"name": "web", "type": "http", "target": srv.URL},
+		{"name": "bad_url", "type": "http", "target": "ftp://example.com"},
+		{"name": "bad_addr", "type": "tcp", "target": "example.com"},
+		{"name": "bad_type", "type": "dns", "target": "example.com"},
+	} {
+		_, err := p.HandleCommand("add_check", args)
+		assert.Error(t, err, args["name"])
+	}
+
+	run := func(name string) *CheckResult {
+		result, err := p.HandleCommand("run_check", map[string]interface{}{"name": name})
+		require.NoError(t, err)
+		return result.(map[string]interface{})["result"].(*CheckResult)
+	}
+
+	result := run("web")
+	assert.True(t, result.Up, result.Error)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.False(t, result.CertExpiry.IsZero())
+	assert.Greater(t, metricValue(t, p, metricKey("check_cert_expiry_days", map[string]string{"check": "web", "type": "http", "target": srv.URL + "/"})), 0.0)
+	assert.True(t, run("web_503").Up)
+	assert.True(t, run("port").Up)
+	assert.False(t, run("port_closed").Up)
+
+	// 连续失败 3 次触发默认规则
+	downLabels := map[string]string{"check": "web_down", "type": "http", "target": srv.URL + "/down"}
+	for i := 1; i <= 3; i++ {
+		result = run("web_down")
+		assert.False(t, result.Up)
+		assert.Equal(t, i, result.Failures)
+	}
+	assert.Equal(t, 0.0, metricValue(t, p, metricKey("check_up", downLabels)))
+	fired := agent.Events("alert_triggered")
+	require.Len(t, fired, 1)
+	assert.Equal(t, "service_check_failing", fired[0].Data["rule"])
+
+	// 删除检查同时删除其指标，检查持久化到数据目录
+	_, err = p.HandleCommand("remove_check", map[string]interface{}{"name": "web_down"})
+	require.NoError(t, err)
+	p.mu.RLock()
+	_, exists := p.metrics[metricKey("check_up", downLabels)]
+	p.mu.RUnlock()
+	assert.False(t, exists)
+
+	reloaded := newTestPlugin(t, &plugintest.Agent{DataDir: agent.DataDir}, nil)
+	result2, err := reloaded.HandleCommand("get_checks", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4, result2.(map[string]interface{})["count"])
+	assert.Equal(t, defaultCheckInterval, p.checks["port"].check.interval())
+}
+
+func TestPingICMP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := pingICMP(ctx, "127.0.0.1")
+	if err != nil && strings.Contains(err.Error(), "failed to open icmp socket") {
+		t.Skipf("icmp not permitted: %v", err)
+	}
+	assert.NoError(t, err)
+}
+
+func TestLogWatch(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("java.lang.OutOfMemoryError: old\n"), 0644))
+
+	_, err := p.HandleCommand("add_log_watch", map[string]interface{}{
+		"name": "oom", "path": path, "pattern": "OutOfMemoryError|Killed process", "threshold": 2.0, "window": "1m", "severity": "critical",
+	})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("add_log_watch", map[string]interface{}{"name": "bad", "path": path, "pattern": "("})
+	assert.Error(t, err)
+
+	appendLog := func(text string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = f.WriteString(text)
+		require.NoError(t, err)
+		f.Close()
+	}
+	state := p.logWatches["oom"]
+	now := time.Now()
+
+	// 已有内容不计入，只计新增的完整行
+	p.pollLogWatch(state, now)
+	assert.Equal(t, 0.0, metricValue(t, p, `log_matches{path="`+path+`",watch="oom"}`))
+	appendLog("INFO ok\nERROR java.lang.OutOfMemoryError: Java heap space\nKilled process 42")
+	p.pollLogWatch(state, now.Add(time.Second))
+	assert.Empty(t, agent.Events("alert_triggered"))
+
+	// 不完整的行补全后匹配，窗口内达到阈值时告警并附带匹配行
+	appendLog(" (java)\n")
+	p.pollLogWatch(state, now.Add(2*time.Second))
+	fired := agent.Events("alert_triggered")
+	require.Len(t, fired, 1)
+	assert.Equal(t, "critical", fired[0].Data["severity"])
+	assert.Equal(t, []string{"ERROR java.lang.OutOfMemoryError: Java heap space", "Killed process 42 (java)"}, fired[0].Data["lines"])
+
+	// 窗口过后重新计数
+	p.pollLogWatch(state, now.Add(2*time.Minute))
+	assert.Equal(t, 0.0, metricValue(t, p, `log_matches{path="`+path+`",watch="oom"}`))
+
+	// 文件轮转后从头读取新文件
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, os.WriteFile(path, []byte("OutOfMemoryError again\n"), 0644))
+	p.pollLogWatch(state, now.Add(3*time.Minute))
+	assert.Equal(t, 1.0, metricValue(t, p, `log_matches{path="`+path+`",watch="oom"}`))
+
+	result, err := p.HandleCommand("get_log_watches", nil)
+	require.NoError(t, err)
+	views := result.(map[string]interface{})["watches"].([]*LogWatchView)
+	require.Len(t, views, 1)
+	assert.Equal(t, "OutOfMemoryError again", views[0].LastLines[len(views[0].LastLines)-1])
+
+	reloaded := newTestPlugin(t, &plugintest.Agent{DataDir: agent.DataDir}, nil)
+	assert.Contains(t, reloaded.logWatches, "oom")
+	_, err = p.HandleCommand("remove_log_watch", map[string]interface{}{"name": "oom"})
+	require.NoError(t, err)
+	assert.Empty(t, p.logWatches)
+}
+
+func TestAlertLifecycle(t *testing.T) {
+	events := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		events <- fmt.Sprint(body["event"], "/", body["severity"])
+	}))
+	defer srv.Close()
+	next := func() string {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification not received")
+		}
+		return ""
+	}
+	none := func() {
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected notification %s", event)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{"alert_cooldown": "5m", "escalate_after": "10m"})
+	_, err := p.HandleCommand("add_notifier", map[string]interface{}{"name": "hook", "type": "webhook", "url": srv.URL, "default": true})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("add_rule", map[string]interface{}{"name": "load", "metric": "load_1", "condition": ">", "threshold": 4.0})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("update_rule", map[string]interface{}{"name": "load", "escalate_after": "soon"})
+	assert.Error(t, err)
+
+	now := time.Now()
+	load := func(value float64, minutes int) {
+		p.recordSamples("test", []sample{{Name: "load_1", Value: value}}, now.Add(time.Duration(minutes)*time.Minute))
+	}
+
+	// 条件持续成立时不重复触发，条件消失后自动恢复
+	load(9, 0)
+	load(9, 1)
+	require.Len(t, agent.Events("alert_triggered"), 1)
+	assert.Equal(t, "triggered/warning", next())
+	load(1, 2)
+	resolved := agent.Events("alert_resolved")
+	require.Len(t, resolved, 1)
+	assert.Equal(t, "condition cleared", resolved[0].Data["reason"])
+	assert.Equal(t, "resolved/warning", next())
+
+	// 冷却期内再次触发重新激活原告警，不再通知
+	load(9, 3)
+	fired := agent.Events("alert_triggered")
+	require.Len(t, fired, 2)
+	assert.Equal(t, true, fired[1].Data["suppressed"])
+	assert.Equal(t, 2, fired[1].Data["occurrences"])
+	load(1, 4)
+	assert.Len(t, agent.Events("alert_resolved"), 2)
+	none()
+
+	// 冷却期之后作为新的告警通知
+	load(9, 10)
+	fired = agent.Events("alert_triggered")
+	require.Len(t, fired, 3)
+	assert.Equal(t, false, fired[2].Data["suppressed"])
+	assert.Equal(t, 3, fired[2].Data["occurrences"])
+	assert.Equal(t, "triggered/warning", next())
+
+	// 持续未确认时每 10 分钟提升一级，直到 critical
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+	p.maintainAlerts(at(15))
+	assert.Empty(t, agent.Events("alert_escalated"))
+	p.maintainAlerts(at(20))
+	require.Len(t, agent.Events("alert_escalated"), 1)
+	assert.Equal(t, "escalated/error", next())
+	p.maintainAlerts(at(30))
+	p.maintainAlerts(at(45))
+	assert.Len(t, agent.Events("alert_escalated"), 2)
+	assert.Equal(t, "escalated/critical", next())
+	p.mu.RLock()
+	alert := p.alerts["load"]
+	assert.Equal(t, "critical", alert.Severity)
+	assert.Equal(t, "warning", alert.OriginalSeverity)
+	p.mu.RUnlock()
+
+	// 已确认的告警在删除规则时恢复
+	_, err = p.HandleCommand("acknowledge_alert", map[string]interface{}{"id": "load"})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("remove_rule", map[string]interface{}{"name": "load"})
+	require.NoError(t, err)
+	load(9, 61)
+	resolved = agent.Events("alert_resolved")
+	require.Len(t, resolved, 3)
+	assert.Equal(t, "rule removed", resolved[2].Data["reason"])
+	assert.Equal(t, "resolved/critical", next())
+
+	// 恢复超过 24 小时的告警被删除
+	p.maintainAlerts(at(61).Add(25 * time.Hour))
+	p.mu.RLock()
+	assert.Empty(t, p.alerts)
+	p.mu.RUnlock()
+}
+
+// fakeSMTPServer 接受一个连接并记录收到的邮件内容
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO":
+				fmt.Fprint(conn, "250 localhost\r\n")
+			case "DATA":
+				fmt.Fprint(conn, "354 go ahead\r\n")
+				var body strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					body.WriteString(line)
+				}
+				mails <- body.String()
+				fmt.Fprint(conn, "250 queued\r\n")
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	}()
+	return listener.Addr().String(), mails
+}
+
+func TestNotifiers(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	bodies := make(chan map[string]interface{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- r
+		bodies <- body
+		if r.URL.Path == "/pd" {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer srv.Close()
+	next := func() (string, map[string]interface{}) {
+		select {
+		case r := <-received:
+			return r.URL.Path, <-bodies
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification not received")
+		}
+		return "", nil
+	}
+
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+	for _, args := range []map[string]interface{}{
+		{"name": "ops", "type": "slack", "url": srv.URL + "/slack", "default": true, "severities": []interface{}{"error", "critical"},
+			"template": "{{.Severity}}|{{.Event}}|{{.Name}}"},
+		{"name": "hook", "type": "webhook", "url": srv.URL + "/hook", "headers": map[string]interface{}{"X-Token": "abc"}, "max_per_hour": 1.0},
+		{"name": "pd", "type": "pagerduty", "url": srv.URL + "/pd", "routing_key": "secret-key"},
+	} {
+		_, err := p.HandleCommand("add_notifier", args)
+		require.NoError(t, err, args["name"])
+	}
+	for _, args := range []map[string]interface{}{
+		{"name": "bad", "type": "sms"},
+		{"name": "bad", "type": "slack"},
+		{"name": "bad", "type": "slack", "url": srv.URL, "template": "{{.Nope"},
+		{"name": "bad", "type": "email", "smtp_host": "localhost"},
+	} {
+		_, err := p.HandleCommand("add_notifier", args)
+		assert.Error(t, err)
+	}
+
+	// 规则指定渠道时只发送到指定渠道
+	_, err := p.HandleCommand("add_rule", map[string]interface{}{
+		"name": "load", "metric": "load_1", "condition": ">", "threshold": 4.0, "notify": []interface{}{"hook", "pd"},
+	})
+	require.NoError(t, err)
+	p.recordSamples("test", []sample{{Name: "load_1", Value: 9}}, time.Now())
+	got := make(map[string]map[string]interface{})
+	for i := 0; i < 2; i++ {
+		path, body := next()
+		got[path] = body
+	}
+	assert.Equal(t, "triggered", got["/hook"]["event"])
+	assert.Equal(t, "load", got["/hook"]["alert"].(map[string]interface{})["rule"])
+	assert.Equal(t, "trigger", got["/pd"]["event_action"])
+	assert.Equal(t, "secret-key", got["/pd"]["routing_key"])
+
+	// 解决告警时 PagerDuty 收到 resolve，webhook 超过每小时上限
+	_, err = p.HandleCommand("resolve_alert", map[string]interface{}{"id": "load"})
+	require.NoError(t, err)
+	path, body := next()
+	assert.Equal(t, "/pd", path)
+	assert.Equal(t, "resolve", body["event_action"])
+	assert.Equal(t, got["/pd"]["dedup_key"], body["dedup_key"])
+
+	// 未指定渠道的规则发送到默认渠道，按级别过滤并使用模板
+	p.recordSamples("test", []sample{{Name: "disk_usage", Value: 95}, {Name: "memory_usage", Value: 99}}, time.Now())
+	path, body = next()
+	assert.Equal(t, "/slack", path)
+	assert.Equal(t, "error|triggered|Low Disk Space", body["text"])
+	select {
+	case r := <-received:
+		t.Fatalf("unexpected notification to %s", r.URL.Path)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 统计在发送完成后更新
+	var views []*NotifierView
+	require.Eventually(t, func() bool {
+		result, err := p.HandleCommand("get_notifiers", nil)
+		require.NoError(t, err)
+		views = result.(map[string]interface{})["notifiers"].([]*NotifierView)
+		return views[0].Stats.Sent == 1 && views[1].Stats.Sent == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "hook", views[0].Name)
+	assert.Equal(t, 1, views[0].Stats.Suppressed)
+	assert.Equal(t, "******", views[2].RoutingKey)
+
+	// 邮件渠道和持久化
+	addr, mails := fakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.Atoi(port)
+	_, err = p.HandleCommand("add_notifier", map[string]interface{}{
+		"name": "mail", "type": "email", "smtp_host": host, "smtp_port": float64(portNum),
+		"from": "agent@example.com", "to": []interface{}{"ops@example.com"},
+	})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("test_notifier", map[string]interface{}{"name": "mail"})
+	require.NoError(t, err)
+	mail := <-mails
+	assert.Contains(t, mail, "To: ops@example.com\r\n")
+	assert.Contains(t, mail, "Subject: [INFO] Test Notification on ")
+
+	reloaded := newTestPlugin(t, &plugintest.Agent{DataDir: agent.DataDir}, nil)
+	assert.Len(t, reloaded.notifiers, 4)
+	assert.Equal(t, "secret-key", reloaded.notifiers["pd"].config.RoutingKey)
+}
+
+func TestSetConfigWhileCollecting(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"process_watch": "nginx"})
+
+	// 插件管理器更新配置时采集 goroutine 仍在读取配置，需配合 -race 运行
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.watchedProcesses()
+			p.eventLogChannels()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, p.SetConfig(map[string]interface{}{"process_watch": "postgres"}))
+	}
+	<-done
+	assert.Equal(t, []string{"postgres"}, p.watchedProcesses())
+}
+
+// deniedCommander 模拟没有执行权限的插件
+type deniedCommander struct{}
+
+func (deniedCommander) Command(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	return nil, plugin.ErrPermissionDenied
+}
+
+func TestHardwareCommandsUseAgent(t *testing.T) {
+	// 采集工具通过 Agent 运行，需要声明执行权限
+	info := NewMonitorPlugin().Info()
+	require.NotNil(t, info.Permissions)
+	assert.True(t, info.Permissions.Exec)
+
+	_, err := commandOutput(context.Background(), deniedCommander{}, "nvidia-smi", "--query-gpu=name")
+	assert.ErrorIs(t, err, plugin.ErrPermissionDenied)
+	_, err = runSmartctl(context.Background(), deniedCommander{}, "--scan", "-j")
+	assert.ErrorIs(t, err, plugin.ErrPermissionDenied)
+}
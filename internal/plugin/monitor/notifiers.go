@@ -0,0 +1,588 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// notifiersFileName 告警通知渠道配置文件，位于 Agent 数据目录
+const notifiersFileName = "monitor_notifiers.json"
+
+// 通知默认值
+const (
+	defaultNotifyMaxPerHour = 30
+	defaultNotifyTimeout    = 10 * time.Second
+	defaultNotifyTemplate   = `[{{.Severity | upper}}] {{if eq .Event "resolved"}}RESOLVED {{else if eq .Event "escalated"}}ESCALATED {{end}}{{.Name}} on {{.Host}}: {{.Message}}`
+	pagerDutyEventsURL      = "https://events.pagerduty.com/v2/enqueue"
+)
+
+// notifierFactories 通知渠道类型及其构造函数，新增渠道在此注册
+var notifierFactories = map[string]func(config *NotifierConfig, client *http.Client) (notifier, error){
+	"email":     newEmailNotifier,
+	"slack":     newChatNotifier,
+	"teams":     newChatNotifier,
+	"webhook":   newWebhookNotifier,
+	"pagerduty": newPagerDutyNotifier,
+}
+
+// notifierTypes 支持的通知渠道类型
+var notifierTypes = []string{"email", "slack", "teams", "webhook", "pagerduty"}
+
+// notifier 通知渠道
+type notifier interface {
+	send(ctx context.Context, n *Notification) error
+}
+
+// NotifierConfig 通知渠道配置，不同类型使用不同的字段
+type NotifierConfig struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`                 // email, slack, teams, webhook, pagerduty
+	Default    bool              `json:"default,omitempty"`    // 规则未指定 notify 时发送到默认渠道
+	Severities []string          `json:"severities,omitempty"` // 只发送这些级别的告警，为空时发送全部
+	Template   string            `json:"template,omitempty"`   // 消息模板（text/template），字段见 Notification
+	MaxPerHour int               `json:"max_per_hour,omitempty"`
+	URL        string            `json:"url,omitempty"`     // slack、teams、webhook 的地址，pagerduty 可覆盖默认地址
+	Headers    map[string]string `json:"headers,omitempty"` // webhook 附加的请求头
+	RoutingKey string            `json:"routing_key,omitempty"`
+	SMTPHost   string            `json:"smtp_host,omitempty"`
+	SMTPPort   int               `json:"smtp_port,omitempty"` // 默认 587，465 使用 TLS 连接
+	Username   string            `json:"username,omitempty"`
+	Password   string            `json:"password,omitempty"`
+	From       string            `json:"from,omitempty"`
+	To         []string          `json:"to,omitempty"`
+}
+
+// Notification 发送给通知渠道的告警，也是消息模板的数据
+type Notification struct {
+	Event    string     `json:"event"` // triggered, escalated, resolved, test
+	Host     string     `json:"host"`
+	Name     string     `json:"name"`
+	Severity string     `json:"severity"`
+	Message  string     `json:"message"`
+	Alert    *AlertInfo `json:"alert"`
+	Text     string     `json:"text"` // 按模板生成的消息
+}
+
+// NotifierStats 通知渠道的发送统计
+type NotifierStats struct {
+	Sent       int       `json:"sent"`
+	Failed     int       `json:"failed"`
+	Suppressed int       `json:"suppressed"` // 超过每小时上限未发送的数量
+	LastError  string    `json:"last_error,omitempty"`
+	LastSentAt time.Time `json:"last_sent_at,omitempty"`
+}
+
+// NotifierView 通知渠道及其统计，不包括密码等凭据
+type NotifierView struct {
+	*NotifierConfig
+	Stats NotifierStats `json:"stats"`
+}
+
+// notifierState 通知渠道的运行状态
+type notifierState struct {
+	config *NotifierConfig
+	sender notifier
+	tmpl   *template.Template
+	sent   []time.Time // 最近一小时的发送时间
+	stats  NotifierStats
+}
+
+var templateFuncs = template.FuncMap{"upper": strings.ToUpper}
+
+// validate 校验配置并创建通知渠道
+func (c *NotifierConfig) validate(client *http.Client) (*notifierState, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	factory, ok := notifierFactories[c.Type]
+	if !ok {
+		return nil, fmt.Errorf("invalid notifier type: %q", c.Type)
+	}
+	for _, severity := range c.Severities {
+		if !containsString(ruleSeverities, severity) {
+			return nil, fmt.Errorf("invalid severity: %q", severity)
+		}
+	}
+	text := c.Template
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+	tmpl, err := template.New(c.Name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	sender, err := factory(c, client)
+	if err != nil {
+		return nil, err
+	}
+	return &notifierState{config: c, sender: sender, tmpl: tmpl}, nil
+}
+
+// allow 判断是否未超过每小时上限并记录本次发送，调用方需持有 p.mu
+func (s *notifierState) allow(now time.Time) bool {
+	limit := s.config.MaxPerHour
+	if limit <= 0 {
+		limit = defaultNotifyMaxPerHour
+	}
+	cutoff := now.Add(-time.Hour)
+	kept := s.sent[:0]
+	for _, t := range s.sent {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.sent = kept
+	if len(s.sent) >= limit {
+		s.stats.Suppressed++
+		return false
+	}
+	s.sent = append(s.sent, now)
+	return true
+}
+
+// render 按模板生成消息，模板执行失败时使用告警消息
+func (s *notifierState) render(n Notification) *Notification {
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, &n); err != nil {
+		buf.Reset()
+		buf.WriteString(n.Message)
+	}
+	n.Text = buf.String()
+	return &n
+}
+
+// notifyLocked 将告警事件发送到告警指定的渠道，未指定时发送到默认渠道，调用方需持有 p.mu
+// 发送在后台进行，不阻塞告警评估，返回是否有渠道发送了通知
+func (p *MonitorPlugin) notifyLocked(alert *AlertInfo, event string) bool {
+	if len(p.notifiers) == 0 {
+		return false
+	}
+	var targets []*notifierState
+	if len(alert.Notify) > 0 {
+		for _, name := range alert.Notify {
+			if state, exists := p.notifiers[name]; exists {
+				targets = append(targets, state)
+			} else {
+				p.ctx.Logger.Warnf("Alert %s routed to unknown notifier %s", alert.ID, name)
+			}
+		}
+	} else {
+		for _, state := range p.notifiers {
+			if state.config.Default {
+				targets = append(targets, state)
+			}
+		}
+	}
+
+	host, _ := os.Hostname()
+	// 发送在锁外进行，复制告警避免与后续更新竞争
+	copied := *alert
+	copied.Annotations = make(map[string]interface{}, len(alert.Annotations))
+	for key, value := range alert.Annotations {
+		copied.Annotations[key] = value
+	}
+	base := Notification{Event: event, Host: host, Name: alert.Name, Severity: alert.Severity, Message: alert.Message, Alert: &copied}
+	now := time.Now()
+	sent := false
+	for _, state := range targets {
+		if len(state.config.Severities) > 0 && !containsString(state.config.Severities, alert.Severity) {
+			continue
+		}
+		if !state.allow(now) {
+			continue
+		}
+		go p.deliver(state, state.render(base))
+		sent = true
+	}
+	return sent
+}
+
+// deliver 发送通知并更新统计
+func (p *MonitorPlugin) deliver(state *notifierState, n *Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultNotifyTimeout)
+	defer cancel()
+	err := state.sender.send(ctx, n)
+
+	p.mu.Lock()
+	if err != nil {
+		state.stats.Failed++
+		state.stats.LastError = err.Error()
+	} else {
+		state.stats.Sent++
+		state.stats.LastSentAt = time.Now()
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to send alert %s via %s: %v", n.Alert.ID, state.config.Name, err)
+	}
+	return err
+}
+
+// postJSON 发送 JSON 请求，状态码不是 2xx 时返回错误
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// chatNotifier Slack 和 Teams 的 Incoming Webhook，两者都接受 {"text": ...}
+type chatNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newChatNotifier(config *NotifierConfig, client *http.Client) (notifier, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("url is required for %s notifier", config.Type)
+	}
+	return &chatNotifier{url: config.URL, client: client}, nil
+}
+
+func (c *chatNotifier) send(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, c.client, c.url, nil, map[string]string{"text": n.Text})
+}
+
+// webhookNotifier 通用 HTTP Webhook，请求体为完整的 Notification
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhookNotifier(config *NotifierConfig, client *http.Client) (notifier, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("url is required for webhook notifier")
+	}
+	return &webhookNotifier{url: config.URL, headers: config.Headers, client: client}, nil
+}
+
+func (w *webhookNotifier) send(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, w.client, w.url, w.headers, n)
+}
+
+// pagerDutyNotifier PagerDuty Events API v2，告警 ID 和主机名作为 dedup_key，告警解决时发送 resolve
+type pagerDutyNotifier struct {
+	url        string
+	routingKey string
+	client     *http.Client
+}
+
+func newPagerDutyNotifier(config *NotifierConfig, client *http.Client) (notifier, error) {
+	if config.RoutingKey == "" {
+		return nil, fmt.Errorf("routing_key is required for pagerduty notifier")
+	}
+	url := config.URL
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+	return &pagerDutyNotifier{url: url, routingKey: config.RoutingKey, client: client}, nil
+}
+
+func (d *pagerDutyNotifier) send(ctx context.Context, n *Notification) error {
+	action := "trigger"
+	if n.Event == "resolved" {
+		action = "resolve"
+	}
+	summary := n.Text
+	if len(summary) > 1024 {
+		summary = summary[:1024]
+	}
+	severity := n.Severity
+	if severity != "info" && severity != "warning" && severity != "error" && severity != "critical" {
+		severity = "error"
+	}
+	return postJSON(ctx, d.client, d.url, nil, map[string]interface{}{
+		"routing_key":  d.routingKey,
+		"event_action": action,
+		"dedup_key":    n.Host + "/" + n.Alert.ID,
+		"payload": map[string]interface{}{
+			"summary":        summary,
+			"source":         n.Host,
+			"severity":       severity,
+			"custom_details": n.Alert,
+		},
+	})
+}
+
+// emailNotifier 通过 SMTP 发送邮件，587 等端口在服务器支持时使用 STARTTLS，465 使用 TLS 连接
+type emailNotifier struct {
+	config *NotifierConfig
+}
+
+func newEmailNotifier(config *NotifierConfig, client *http.Client) (notifier, error) {
+	if config.SMTPHost == "" || config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("smtp_host, from and to are required for email notifier")
+	}
+	return &emailNotifier{config: config}, nil
+}
+
+func (e *emailNotifier) send(ctx context.Context, n *Notification) error {
+	port := e.config.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(e.config.SMTPHost, strconv.Itoa(port))
+
+	subject := n.Text
+	if i := strings.IndexByte(subject, '\n'); i >= 0 {
+		subject = subject[:i]
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Text, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	var dialer net.Dialer
+	var conn net.Conn
+	var err error
+	if port == 465 {
+		conn, err = (&tls.Dialer{NetDialer: &dialer, Config: &tls.Config{ServerName: e.config.SMTPHost}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, e.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && port != 465 {
+		if err := client.StartTLS(&tls.Config{ServerName: e.config.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if e.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.SMTPHost)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.config.From); err != nil {
+		return err
+	}
+	for _, to := range e.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// notifierConfigFromArgs 从命令参数构造通知渠道配置
+func notifierConfigFromArgs(args map[string]interface{}) (*NotifierConfig, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	var config NotifierConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid notifier: %v", err)
+	}
+	return &config, nil
+}
+
+// handleAddNotifier 处理添加通知渠道命令，同名渠道被替换
+func (p *MonitorPlugin) handleAddNotifier(args map[string]interface{}) (interface{}, error) {
+	config, err := notifierConfigFromArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	state, err := config.validate(p.notifyClient)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	_, replaced := p.notifiers[config.Name]
+	p.notifiers[config.Name] = state
+	p.mu.Unlock()
+
+	if err := p.saveNotifiers(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save notifiers: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":     config.Name,
+		"replaced": replaced,
+		"message":  "Notifier added successfully",
+	}, nil
+}
+
+// handleRemoveNotifier 处理移除通知渠道命令
+func (p *MonitorPlugin) handleRemoveNotifier(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["name"].(string)
+
+	p.mu.Lock()
+	if _, exists := p.notifiers[name]; !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("notifier %s not found", name)
+	}
+	delete(p.notifiers, name)
+	p.mu.Unlock()
+
+	if err := p.saveNotifiers(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save notifiers: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"message": "Notifier removed successfully",
+	}, nil
+}
+
+// handleGetNotifiers 处理获取通知渠道命令，密码和 routing_key 不返回
+func (p *MonitorPlugin) handleGetNotifiers(args map[string]interface{}) (interface{}, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	notifiers := make([]*NotifierView, 0, len(p.notifiers))
+	for _, state := range p.notifiers {
+		config := *state.config
+		if config.Password != "" {
+			config.Password = "******"
+		}
+		if config.RoutingKey != "" {
+			config.RoutingKey = "******"
+		}
+		notifiers = append(notifiers, &NotifierView{NotifierConfig: &config, Stats: state.stats})
+	}
+	sort.Slice(notifiers, func(i, j int) bool { return notifiers[i].Name < notifiers[j].Name })
+
+	return map[string]interface{}{
+		"notifiers": notifiers,
+		"count":     len(notifiers),
+	}, nil
+}
+
+// handleTestNotifier 处理测试通知渠道命令，同步发送一条测试通知，不受每小时上限限制
+func (p *MonitorPlugin) handleTestNotifier(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["name"].(string)
+
+	p.mu.RLock()
+	state, exists := p.notifiers[name]
+	p.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("notifier %s not found", name)
+	}
+
+	host, _ := os.Hostname()
+	alert := &AlertInfo{
+		ID:        "test",
+		Name:      "Test Notification",
+		Severity:  "info",
+		Status:    "active",
+		Message:   "This is a test notification from assistant_agent",
+		CreatedAt: time.Now(),
+	}
+	n := state.render(Notification{Event: "test", Host: host, Name: alert.Name, Severity: alert.Severity, Message: alert.Message, Alert: alert})
+	if err := p.deliver(state, n); err != nil {
+		return nil, fmt.Errorf("failed to send test notification: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"text":    n.Text,
+		"message": "Test notification sent",
+	}, nil
+}
+
+// loadNotifiers 从数据目录加载通知渠道
+func (p *MonitorPlugin) loadNotifiers() error {
+	if p.notifiersFile == "" || !p.ctx.Agent.FileExists(p.notifiersFile) {
+		return nil
+	}
+	data, err := p.ctx.Agent.ReadFile(p.notifiersFile)
+	if err != nil {
+		return err
+	}
+	var configs []*NotifierConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return fmt.Errorf("invalid notifiers: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, config := range configs {
+		state, err := config.validate(p.notifyClient)
+		if err != nil {
+			p.ctx.Logger.Warnf("Skipping invalid notifier %s: %v", config.Name, err)
+			continue
+		}
+		p.notifiers[config.Name] = state
+	}
+	return nil
+}
+
+// saveNotifiers 保存通知渠道，未配置数据目录时只保存在内存中
+func (p *MonitorPlugin) saveNotifiers() error {
+	if p.notifiersFile == "" {
+		return nil
+	}
+
+	p.mu.RLock()
+	configs := make([]*NotifierConfig, 0, len(p.notifiers))
+	for _, state := range p.notifiers {
+		configs = append(configs, state.config)
+	}
+	p.mu.RUnlock()
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+
+	data, err := json.MarshalIndent(configs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return p.ctx.Agent.WriteFile(p.notifiersFile, data)
+}
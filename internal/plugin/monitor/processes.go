@@ -0,0 +1,244 @@
+package monitor
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// processSortKeys top_processes 支持的排序方式
+var processSortKeys = []string{"cpu", "memory", "io"}
+
+// ProcessInfo 进程资源占用，CPU 使用率和 IO 速率为相邻两次采集之间的平均值
+type ProcessInfo struct {
+	PID           int32   `json:"pid"`
+	Name          string  `json:"name"`
+	Username      string  `json:"username,omitempty"`
+	Cmdline       string  `json:"cmdline,omitempty"`
+	CPUPercent    float64 `json:"cpu_percent"` // 多核进程可超过 100
+	MemoryRSS     uint64  `json:"memory_rss"`
+	MemoryPercent float64 `json:"memory_percent"`
+	ReadRate      float64 `json:"read_rate"`  // 字节/秒
+	WriteRate     float64 `json:"write_rate"` // 字节/秒
+	Threads       int32   `json:"threads"`
+}
+
+// processCounters 进程累计计数器的上次采样，创建时间用于识别 PID 复用
+type processCounters struct {
+	created int64
+	cpu     float64
+	read    uint64
+	write   uint64
+	at      time.Time
+}
+
+// scanProcesses 采集全部进程的资源占用，调用方需持有 p.collectMu
+// 无权限读取的信息（如其他用户进程的 IO）记为 0
+func (p *MonitorPlugin) scanProcesses(now time.Time) ([]*ProcessInfo, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+	var totalMemory uint64
+	if vm, err := mem.VirtualMemory(); err == nil {
+		totalMemory = vm.Total
+	}
+
+	counters := make(map[int32]processCounters, len(procs))
+	result := make([]*ProcessInfo, 0, len(procs))
+	for _, proc := range procs {
+		name, err := proc.Name()
+		if err != nil {
+			continue
+		}
+		info := &ProcessInfo{PID: proc.Pid, Name: name}
+		cur := processCounters{at: now}
+		cur.created, _ = proc.CreateTime()
+
+		if times, err := proc.Times(); err == nil {
+			cur.cpu = times.User + times.System
+		}
+		if memInfo, err := proc.MemoryInfo(); err == nil {
+			info.MemoryRSS = memInfo.RSS
+			if totalMemory > 0 {
+				info.MemoryPercent = float64(memInfo.RSS) / float64(totalMemory) * 100
+			}
+		}
+		if io, err := proc.IOCounters(); err == nil {
+			cur.read, cur.write = io.ReadBytes, io.WriteBytes
+		}
+		info.Threads, _ = proc.NumThreads()
+
+		if prev, ok := p.procCounters[proc.Pid]; ok && prev.created == cur.created {
+			if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+				if cur.cpu >= prev.cpu {
+					info.CPUPercent = (cur.cpu - prev.cpu) / elapsed * 100
+				}
+				if rate, ok := counterRate(prev.read, cur.read, now.Sub(prev.at)); ok {
+					info.ReadRate = rate
+				}
+				if rate, ok := counterRate(prev.write, cur.write, now.Sub(prev.at)); ok {
+					info.WriteRate = rate
+				}
+			}
+		}
+		counters[proc.Pid] = cur
+		result = append(result, info)
+	}
+
+	// 只保留仍在运行的进程
+	p.procCounters = counters
+	return result, nil
+}
+
+// processNameMatches 判断进程名是否匹配，Windows 上忽略大小写和 .exe 后缀
+func processNameMatches(name, target string) bool {
+	if runtime.GOOS != "windows" {
+		return name == target
+	}
+	trim := func(s string) string { return strings.TrimSuffix(strings.ToLower(s), ".exe") }
+	return trim(name) == trim(target)
+}
+
+// processSamples 按进程名汇总受监控进程的指标，未运行的进程 process_count 为 0
+func processSamples(procs []*ProcessInfo, watched []string) []sample {
+	samples := []sample{{Name: "process_total", Value: float64(len(procs)), Unit: "count"}}
+	for _, name := range watched {
+		var count, cpu, rss, read, write float64
+		for _, proc := range procs {
+			if processNameMatches(proc.Name, name) {
+				count++
+				cpu += proc.CPUPercent
+				rss += float64(proc.MemoryRSS)
+				read += proc.ReadRate
+				write += proc.WriteRate
+			}
+		}
+		labels := map[string]string{"process": name}
+		samples = append(samples,
+			sample{Name: "process_count", Value: count, Unit: "count", Labels: labels},
+			sample{Name: "process_cpu_usage", Value: cpu, Unit: "percent", Labels: labels},
+			sample{Name: "process_memory_rss", Value: rss, Unit: "bytes", Labels: labels},
+			sample{Name: "process_read_rate", Value: read, Unit: "bytes/s", Labels: labels},
+			sample{Name: "process_write_rate", Value: write, Unit: "bytes/s", Labels: labels},
+		)
+	}
+	return samples
+}
+
+// watchedProcesses 返回需要单独采集指标的进程名：process_watch 配置（逗号分隔）
+// 和针对 process_* 指标、带 process 标签的告警规则
+func (p *MonitorPlugin) watchedProcesses() []string {
+	set := make(map[string]bool)
+	if list, ok := p.currentConfig()["process_watch"].(string); ok {
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				set[name] = true
+			}
+		}
+	}
+
+	p.mu.RLock()
+	for _, rule := range p.rules {
+		if name := rule.Labels["process"]; name != "" && strings.HasPrefix(rule.Metric, "process_") {
+			set[name] = true
+		}
+	}
+	p.mu.RUnlock()
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectProcessMetrics 采集进程指标并保存最近一次的进程列表供 top_processes 使用
+func (p *MonitorPlugin) collectProcessMetrics() {
+	p.collectMu.Lock()
+	defer p.collectMu.Unlock()
+
+	now := time.Now()
+	procs, err := p.scanProcesses(now)
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to list processes: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	p.processes = procs
+	p.processesAt = now
+	p.mu.Unlock()
+
+	p.recordSamples("process", processSamples(procs, p.watchedProcesses()), now)
+}
+
+// handleTopProcesses 处理获取资源占用最高进程的命令，使用最近一次采集的结果
+func (p *MonitorPlugin) handleTopProcesses(args map[string]interface{}) (interface{}, error) {
+	sortBy := "cpu"
+	if v, ok := args["sort_by"].(string); ok && v != "" {
+		if !containsString(processSortKeys, v) {
+			return nil, fmt.Errorf("invalid sort_by: %q", v)
+		}
+		sortBy = v
+	}
+	limit := 10
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+	name, _ := args["name"].(string)
+
+	p.mu.RLock()
+	procs, collectedAt := p.processes, p.processesAt
+	p.mu.RUnlock()
+
+	// 尚未采集过时立即采集一次，此时没有 CPU 和 IO 速率
+	if collectedAt.IsZero() {
+		p.collectProcessMetrics()
+		p.mu.RLock()
+		procs, collectedAt = p.processes, p.processesAt
+		p.mu.RUnlock()
+	}
+
+	top := make([]ProcessInfo, 0, len(procs))
+	for _, proc := range procs {
+		if name == "" || processNameMatches(proc.Name, name) {
+			top = append(top, *proc)
+		}
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		switch sortBy {
+		case "memory":
+			return top[i].MemoryRSS > top[j].MemoryRSS
+		case "io":
+			return top[i].ReadRate+top[i].WriteRate > top[j].ReadRate+top[j].WriteRate
+		}
+		return top[i].CPUPercent > top[j].CPUPercent
+	})
+	total := len(top)
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	// 用户名和命令行只为返回的进程查询
+	for i := range top {
+		if proc, err := process.NewProcess(top[i].PID); err == nil {
+			top[i].Username, _ = proc.Username()
+			top[i].Cmdline, _ = proc.Cmdline()
+		}
+	}
+
+	return map[string]interface{}{
+		"processes":    top,
+		"count":        len(top),
+		"total":        total,
+		"sort_by":      sortBy,
+		"collected_at": collectedAt,
+	}, nil
+}
@@ -0,0 +1,311 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// 指标端点默认配置
+const (
+	defaultPrometheusListen = "127.0.0.1:9273"
+	prometheusPath          = "/metrics"
+	prometheusPrefix        = "assistant_agent_"
+	prometheusContentType   = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// startPrometheus 按配置启动 Prometheus 指标端点，监听失败时返回错误
+func (p *MonitorPlugin) startPrometheus() error {
+	config := p.currentConfig()
+	if !plugin.ConfigBool(config, "prometheus_enabled", false) {
+		return nil
+	}
+
+	listen := plugin.ConfigString(config, "prometheus_listen", defaultPrometheusListen)
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to start metrics endpoint on %s: %v", listen, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(prometheusPath, p.prometheusHandler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	p.mu.Lock()
+	p.server = server
+	p.serverAddr = listener.Addr().String()
+	p.mu.Unlock()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			p.ctx.Logger.Errorf("Metrics endpoint stopped: %v", err)
+		}
+	}()
+
+	p.ctx.Logger.Infof("Prometheus metrics endpoint listening on http://%s%s", listener.Addr(), prometheusPath)
+	return nil
+}
+
+// stopPrometheus 关闭指标端点，等待正在处理的抓取请求完成
+func (p *MonitorPlugin) stopPrometheus() {
+	p.mu.Lock()
+	server := p.server
+	p.server = nil
+	p.serverAddr = ""
+	p.mu.Unlock()
+
+	if server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		p.ctx.Logger.Warnf("Failed to stop metrics endpoint: %v", err)
+	}
+}
+
+// prometheusHandler 返回指标端点的处理函数，配置了用户名时要求 Basic 认证
+func (p *MonitorPlugin) prometheusHandler() http.Handler {
+	config := p.currentConfig()
+	username := plugin.ConfigString(config, "prometheus_username", "")
+	password := plugin.ConfigString(config, "prometheus_password", "")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if username != "" {
+			user, pass, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="assistant_agent"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", prometheusContentType)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if err := p.writePrometheus(w); err != nil {
+			p.ctx.Logger.Debugf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+// promFamily 同名指标的全部时间序列
+type promFamily struct {
+	name   string
+	help   string
+	typ    string
+	series []promSeries
+}
+
+type promSeries struct {
+	labels map[string]string
+	value  float64
+}
+
+// writePrometheus 以 Prometheus 文本格式输出采集的指标、告警数、Agent 和插件状态
+func (p *MonitorPlugin) writePrometheus(w io.Writer) error {
+	// Agent 状态中包括本插件的状态，需在持有 p.mu 之前获取
+	families := agentFamilies(p.ctx.Agent.GetStatus())
+
+	p.mu.RLock()
+	families = append(families, p.metricFamiliesLocked()...)
+	families = append(families, p.alertFamiliesLocked())
+	p.mu.RUnlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, family := range families {
+		if len(family.series) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", family.name, escapeHelp(family.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", family.name, family.typ)
+		sort.Slice(family.series, func(i, j int) bool {
+			return formatLabels(family.series[i].labels) < formatLabels(family.series[j].labels)
+		})
+		for _, s := range family.series {
+			fmt.Fprintf(bw, "%s%s %s\n", family.name, formatLabels(s.labels), strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	return bw.Flush()
+}
+
+// metricFamiliesLocked 将采集的时间序列按指标名分组，调用方需持有 p.mu
+func (p *MonitorPlugin) metricFamiliesLocked() []*promFamily {
+	byName := make(map[string]*promFamily)
+	for _, metric := range p.metrics {
+		name := prometheusPrefix + sanitizeName(metric.Name)
+		family, exists := byName[name]
+		if !exists {
+			help := metric.Name
+			if metric.Unit != "" {
+				help += " (" + metric.Unit + ")"
+			}
+			typ := "gauge"
+			if metric.Type == "counter" {
+				typ = "counter"
+			}
+			family = &promFamily{name: name, help: help, typ: typ}
+			byName[name] = family
+		}
+		family.series = append(family.series, promSeries{labels: metric.Labels, value: metric.Value})
+	}
+
+	families := make([]*promFamily, 0, len(byName))
+	for _, family := range byName {
+		families = append(families, family)
+	}
+	return families
+}
+
+// alertFamiliesLocked 按级别统计未解决的告警数，调用方需持有 p.mu
+func (p *MonitorPlugin) alertFamiliesLocked() *promFamily {
+	counts := make(map[string]int, len(ruleSeverities))
+	for _, severity := range ruleSeverities {
+		counts[severity] = 0
+	}
+	for _, alert := range p.alerts {
+		if alert.Status != "resolved" {
+			counts[alert.Severity]++
+		}
+	}
+
+	family := &promFamily{name: prometheusPrefix + "alerts_active", help: "Unresolved alerts by severity", typ: "gauge"}
+	for severity, count := range counts {
+		family.series = append(family.series, promSeries{labels: map[string]string{"severity": severity}, value: float64(count)})
+	}
+	return family
+}
+
+// agentFamilies 将 Agent 状态转换为指标：运行时间、连接状态、待发送消息数和各插件的状态
+func agentFamilies(status map[string]interface{}) []*promFamily {
+	if status == nil {
+		return nil
+	}
+	gauge := func(name, help string) *promFamily {
+		return &promFamily{name: prometheusPrefix + name, help: help, typ: "gauge"}
+	}
+
+	info := gauge("info", "Agent information")
+	agentID, _ := status["agent_id"].(string)
+	info.series = append(info.series, promSeries{labels: map[string]string{"agent_id": agentID}, value: 1})
+
+	uptime := gauge("uptime_seconds", "Seconds since the agent started")
+	if v, ok := toFloat(status["uptime"]); ok {
+		uptime.series = append(uptime.series, promSeries{value: v})
+	}
+
+	connected := gauge("connected", "Whether the agent is connected to the server")
+	if isConnected, ok := status["connected"].(bool); ok {
+		value := 0.0
+		if isConnected {
+			value = 1
+		}
+		connected.series = append(connected.series, promSeries{value: value})
+	}
+
+	pendingMessages := gauge("pending_messages", "Messages queued while disconnected")
+	if v, ok := toFloat(status["pending_messages"]); ok {
+		pendingMessages.series = append(pendingMessages.series, promSeries{value: v})
+	}
+
+	pluginUp := gauge("plugin_running", "Whether the plugin is running")
+	pluginMetric := gauge("plugin_metric", "Numeric metrics reported in plugin status")
+	for name, ps := range pluginStatuses(status["plugins"]) {
+		if ps == nil {
+			continue
+		}
+		value := 0.0
+		if ps.Status == "running" {
+			value = 1
+		}
+		pluginUp.series = append(pluginUp.series, promSeries{labels: map[string]string{"plugin": name}, value: value})
+		for key, raw := range ps.Metrics {
+			if v, ok := toFloat(raw); ok {
+				pluginMetric.series = append(pluginMetric.series, promSeries{
+					labels: map[string]string{"plugin": name, "metric": key},
+					value:  v,
+				})
+			}
+		}
+	}
+
+	return []*promFamily{info, uptime, connected, pendingMessages, pluginUp, pluginMetric}
+}
+
+// pluginStatuses 解析 Agent 状态中的插件状态，外部插件进程收到的是 JSON 解码后的 map
+func pluginStatuses(raw interface{}) map[string]*plugin.PluginStatus {
+	if statuses, ok := raw.(map[string]*plugin.PluginStatus); ok {
+		return statuses
+	}
+	var statuses map[string]*plugin.PluginStatus
+	if data, err := json.Marshal(raw); err == nil {
+		json.Unmarshal(data, &statuses)
+	}
+	return statuses
+}
+
+// sanitizeName 将指标名或标签名中 Prometheus 不允许的字符替换为下划线
+func sanitizeName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// formatLabels 格式化标签，按名称排序并转义标签值
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(sanitizeName(key))
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(labels[key]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeHelp 转义 HELP 文本中的反斜杠和换行
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
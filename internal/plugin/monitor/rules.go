@@ -0,0 +1,408 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// rulesFileName 告警规则文件，位于 Agent 数据目录
+const rulesFileName = "monitor_rules.json"
+
+// ruleConditions 支持的比较条件
+var ruleConditions = []string{">", "<", ">=", "<=", "==", "!="}
+
+// ruleSeverities 支持的告警级别
+var ruleSeverities = []string{"info", "warning", "error", "critical"}
+
+// defaultRules 没有保存的规则时使用的默认规则
+func defaultRules() []*MonitorRule {
+	return []*MonitorRule{
+		{Name: "high_cpu_usage", Metric: "cpu_usage", Condition: ">", Threshold: 80, Duration: "5m", Severity: "warning",
+			Description: "High CPU Usage"},
+		{Name: "high_memory_usage", Metric: "memory_usage", Condition: ">", Threshold: 85, Duration: "5m", Severity: "warning",
+			Description: "High Memory Usage"},
+		{Name: "low_disk_space", Metric: "disk_usage", Condition: ">", Threshold: 90, Severity: "error",
+			Description: "Low Disk Space"},
+		{Name: "service_check_failing", Metric: "check_failures", Condition: ">=", Threshold: 3, Severity: "error",
+			Description: "Service Check Failing"},
+		{Name: "disk_smart_failing", Metric: "smart_healthy", Condition: "<", Threshold: 1, Severity: "critical",
+			Description: "Disk SMART Health Failing"},
+		{Name: "disk_pending_sectors", Metric: "smart_pending_sectors", Condition: ">", Threshold: 0, Severity: "warning",
+			Description: "Disk Pending Sectors"},
+		{Name: "thermal_throttling", Metric: "thermal_throttled", Condition: ">", Threshold: 0, Severity: "warning",
+			Description: "Thermal Throttling"},
+	}
+}
+
+// pendingAlert 条件成立但尚未触发告警的时间序列
+type pendingAlert struct {
+	Rule  string
+	Since time.Time
+}
+
+// compare 按条件比较指标值和阈值
+func compare(condition string, value, threshold float64) bool {
+	switch condition {
+	case ">":
+		return value > threshold
+	case "<":
+		return value < threshold
+	case ">=":
+		return value >= threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+// matches 判断时间序列是否匹配规则，规则的标签必须全部相同
+func (r *MonitorRule) matches(metric *MetricInfo) bool {
+	return metric.Name == r.Metric && labelsMatch(metric.Labels, r.Labels)
+}
+
+// forDuration 返回条件需要持续的时间
+func (r *MonitorRule) forDuration() time.Duration {
+	d, _ := time.ParseDuration(r.Duration)
+	return d
+}
+
+// validate 校验规则并补充默认值
+func (r *MonitorRule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.Metric == "" {
+		return fmt.Errorf("metric is required")
+	}
+	if !containsString(ruleConditions, r.Condition) {
+		return fmt.Errorf("invalid condition: %q", r.Condition)
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	if !containsString(ruleSeverities, r.Severity) {
+		return fmt.Errorf("invalid severity: %q", r.Severity)
+	}
+	if r.Duration != "" {
+		if d, err := time.ParseDuration(r.Duration); err != nil || d < 0 {
+			return fmt.Errorf("invalid duration: %q", r.Duration)
+		}
+	}
+	if r.EscalateAfter != "" {
+		if d, err := time.ParseDuration(r.EscalateAfter); err != nil || d <= 0 {
+			return fmt.Errorf("invalid escalate_after: %q", r.EscalateAfter)
+		}
+	}
+	if r.Labels == nil {
+		r.Labels = make(map[string]string)
+	}
+	return nil
+}
+
+// applyRuleArgs 将命令参数写入规则，未提供的字段保持不变
+func applyRuleArgs(rule *MonitorRule, args map[string]interface{}) {
+	if v, ok := args["metric"].(string); ok {
+		rule.Metric = v
+	}
+	if v, ok := args["condition"].(string); ok {
+		rule.Condition = v
+	}
+	if v, ok := args["threshold"].(float64); ok {
+		rule.Threshold = v
+	}
+	if v, ok := args["duration"].(string); ok {
+		rule.Duration = v
+	}
+	if v, ok := args["severity"].(string); ok {
+		rule.Severity = v
+	}
+	if v, ok := args["escalate_after"].(string); ok {
+		rule.EscalateAfter = v
+	}
+	if v, ok := args["description"].(string); ok {
+		rule.Description = v
+	}
+	if v, ok := args["notify"].([]interface{}); ok {
+		rule.Notify = toStrings(v)
+	}
+	if v, ok := args["labels"].(map[string]interface{}); ok {
+		rule.Labels = make(map[string]string, len(v))
+		for key, value := range v {
+			rule.Labels[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// evaluateRulesLocked 评估全部规则：条件成立的时间序列进入 pending，持续 duration 后触发告警，
+// 条件不再成立、时间序列消失或规则被删除时恢复告警，调用方需持有 p.mu
+func (p *MonitorPlugin) evaluateRulesLocked(now time.Time) {
+	seen := make(map[string]bool)
+	for _, rule := range p.rules {
+		for key, metric := range p.metrics {
+			if !rule.matches(metric) {
+				continue
+			}
+			id := metricKey(rule.Name, metric.Labels)
+			if !compare(rule.Condition, metric.Value, rule.Threshold) {
+				continue
+			}
+			seen[id] = true
+			state, pending := p.pending[id]
+			if !pending {
+				state = pendingAlert{Rule: rule.Name, Since: now}
+				p.pending[id] = state
+			}
+			if now.Sub(state.Since) >= rule.forDuration() {
+				p.fireAlertLocked(id, rule, key, metric, now)
+			}
+		}
+	}
+
+	// 条件不再成立或时间序列已消失
+	for id := range p.pending {
+		if !seen[id] {
+			delete(p.pending, id)
+		}
+	}
+	for id, alert := range p.alerts {
+		if alert.Rule == "" || alert.Status == "resolved" || seen[id] {
+			continue
+		}
+		reason := "condition cleared"
+		if _, exists := p.rules[alert.Rule]; !exists {
+			reason = "rule removed"
+		}
+		p.resolveAlertLocked(alert, now, reason)
+	}
+}
+
+// fireAlertLocked 规则条件满足时触发告警
+func (p *MonitorPlugin) fireAlertLocked(id string, rule *MonitorRule, series string, metric *MetricInfo, now time.Time) {
+	name := rule.Description
+	if name == "" {
+		name = rule.Name
+	}
+	p.triggerAlertLocked(&AlertInfo{
+		ID:        id,
+		Name:      name,
+		Rule:      rule.Name,
+		Severity:  rule.Severity,
+		Status:    "active",
+		Message:   fmt.Sprintf("%s: %s is %.2f (%s %g)", name, series, metric.Value, rule.Condition, rule.Threshold),
+		Metric:    rule.Metric,
+		Threshold: rule.Threshold,
+		Current:   metric.Value,
+		CreatedAt: now,
+		Labels:    metric.Labels,
+		Annotations: map[string]interface{}{
+			"condition": rule.Condition,
+			"duration":  rule.Duration,
+		},
+		Notify: rule.Notify,
+	}, map[string]interface{}{
+		"rule":   rule.Name,
+		"labels": metric.Labels,
+	})
+}
+
+// handleAddRule 处理添加规则命令
+func (p *MonitorPlugin) handleAddRule(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["name"].(string)
+	rule := &MonitorRule{Name: name}
+	applyRuleArgs(rule, args)
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if _, exists := p.rules[name]; exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("rule %s already exists", name)
+	}
+	p.rules[name] = rule
+	p.mu.Unlock()
+
+	if err := p.saveRules(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save monitor rules: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"rule":    rule,
+		"message": "Rule added successfully",
+	}, nil
+}
+
+// handleUpdateRule 处理更新规则命令，只修改提供的字段，pending 状态重新计时
+func (p *MonitorPlugin) handleUpdateRule(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["name"].(string)
+
+	p.mu.Lock()
+	existing, exists := p.rules[name]
+	if !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("rule %s not found", name)
+	}
+	rule := *existing
+	rule.Labels = existing.Labels
+	applyRuleArgs(&rule, args)
+	if err := rule.validate(); err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.rules[name] = &rule
+	p.clearPendingLocked(name)
+	p.mu.Unlock()
+
+	if err := p.saveRules(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save monitor rules: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"rule":    &rule,
+		"message": "Rule updated successfully",
+	}, nil
+}
+
+// handleRemoveRule 处理移除规则命令
+func (p *MonitorPlugin) handleRemoveRule(args map[string]interface{}) (interface{}, error) {
+	name, ok := args["name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	p.mu.Lock()
+	if _, exists := p.rules[name]; !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("rule %s not found", name)
+	}
+	delete(p.rules, name)
+	p.clearPendingLocked(name)
+	p.mu.Unlock()
+
+	if err := p.saveRules(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save monitor rules: %v", err)
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"message": "Rule removed successfully",
+	}, nil
+}
+
+// clearPendingLocked 清除规则的 pending 状态
+func (p *MonitorPlugin) clearPendingLocked(rule string) {
+	for id, state := range p.pending {
+		if state.Rule == rule {
+			delete(p.pending, id)
+		}
+	}
+}
+
+// RuleView 规则及其当前状态
+type RuleView struct {
+	*MonitorRule
+	Pending int `json:"pending"` // 条件成立但未满 duration 的时间序列数
+	Firing  int `json:"firing"`  // 活动告警数
+}
+
+// handleGetRules 处理获取规则命令，按名称排序
+func (p *MonitorPlugin) handleGetRules(args map[string]interface{}) (interface{}, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	rules := make([]*RuleView, 0, len(p.rules))
+	for _, rule := range p.rules {
+		view := &RuleView{MonitorRule: rule}
+		for _, alert := range p.alerts {
+			if alert.Rule == rule.Name && alert.Status != "resolved" {
+				view.Firing++
+			}
+		}
+		for id, state := range p.pending {
+			if alert, exists := p.alerts[id]; state.Rule == rule.Name && (!exists || alert.Status == "resolved") {
+				view.Pending++
+			}
+		}
+		rules = append(rules, view)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+
+	return map[string]interface{}{
+		"rules": rules,
+		"count": len(rules),
+	}, nil
+}
+
+// loadRules 从数据目录加载规则，文件不存在时使用默认规则
+func (p *MonitorPlugin) loadRules() error {
+	var rules []*MonitorRule
+	if p.rulesFile != "" && p.ctx.Agent.FileExists(p.rulesFile) {
+		data, err := p.ctx.Agent.ReadFile(p.rulesFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return fmt.Errorf("invalid monitor rules: %v", err)
+		}
+	} else {
+		rules = defaultRules()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			p.ctx.Logger.Warnf("Skipping invalid monitor rule %s: %v", rule.Name, err)
+			continue
+		}
+		p.rules[rule.Name] = rule
+	}
+	return nil
+}
+
+// saveRules 保存规则，未配置数据目录时只保存在内存中
+func (p *MonitorPlugin) saveRules() error {
+	if p.rulesFile == "" {
+		return nil
+	}
+
+	p.mu.RLock()
+	rules := make([]*MonitorRule, 0, len(p.rules))
+	for _, rule := range p.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	data, err := json.MarshalIndent(rules, "", "  ")
+	p.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return p.ctx.Agent.WriteFile(p.rulesFile, data)
+}
+
+// toStrings 将数组参数转换为字符串列表
+func toStrings(values []interface{}) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, fmt.Sprint(value))
+	}
+	return result
+}
+
+// containsString 判断字符串是否在列表中
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package password
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultAttachmentMaxSize 单个附件默认最大字节数
+	defaultAttachmentMaxSize = 1024 * 1024
+	// defaultAttachmentMaxCount 每个条目默认最多附件数
+	defaultAttachmentMaxCount = 10
+	// attachmentDirName 附件目录，与密码库文件位于同一数据目录
+	attachmentDirName = "password_attachments"
+)
+
+// Attachment 条目附件，内容使用附件独立的密钥加密后单独保存，密钥随条目一起加密保存在密码库中
+type Attachment struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int       `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Key         []byte    `json:"key,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// publicAttachments 返回不含密钥的附件列表，用于返回给调用方
+func publicAttachments(attachments []Attachment) []Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+	result := make([]Attachment, len(attachments))
+	for i, attachment := range attachments {
+		attachment.Key = nil
+		result[i] = attachment
+	}
+	return result
+}
+
+// zeroAttachments 清零附件密钥
+func zeroAttachments(attachments []Attachment) {
+	for _, attachment := range attachments {
+		zero(attachment.Key)
+	}
+}
+
+// attachmentDir 返回附件目录
+func (p *PasswordPlugin) attachmentDir() string {
+	return filepath.Join(filepath.Dir(p.dataFile), attachmentDirName)
+}
+
+// attachmentPath 返回附件文件路径
+func (p *PasswordPlugin) attachmentPath(id string) string {
+	return filepath.Join(p.attachmentDir(), id+".enc")
+}
+
+// removeAttachmentFiles 删除附件文件
+func (p *PasswordPlugin) removeAttachmentFiles(attachments []Attachment) {
+	for _, attachment := range attachments {
+		if err := p.files.Remove(p.attachmentPath(attachment.ID)); err != nil && !os.IsNotExist(err) {
+			p.ctx.Logger.Warnf("Failed to remove attachment %s: %v", attachment.ID, err)
+		}
+	}
+}
+
+// handleAddAttachment 处理添加附件命令，data 为 base64 编码的文件内容
+func (p *PasswordPlugin) handleAddAttachment(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(filepath.Base(name))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return nil, fmt.Errorf("name is required")
+	}
+	contentType, _ := args["content_type"].(string)
+	encoded, _ := args["data"].(string)
+
+	maxSize := p.configInt("attachment_max_size", defaultAttachmentMaxSize)
+	if base64.StdEncoding.DecodedLen(len(encoded)) > maxSize+2 {
+		return nil, fmt.Errorf("attachment exceeds the maximum size of %d bytes", maxSize)
+	}
+	content, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attachment data: %v", err)
+	}
+	if len(content) > maxSize {
+		return nil, fmt.Errorf("attachment exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	key, err := newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encrypt(key, content)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	attachment := Attachment{
+		ID:          p.generateID(),
+		Name:        name,
+		ContentType: contentType,
+		Size:        len(content),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Key:         key,
+		CreatedAt:   time.Now(),
+	}
+
+	p.mu.Lock()
+	entry, exists := p.passwords[id]
+	if !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("password not found")
+	}
+	if maxCount := p.configInt("attachment_max_count", defaultAttachmentMaxCount); len(entry.Attachments) >= maxCount {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("entry already has the maximum of %d attachments", maxCount)
+	}
+
+	// 先写入附件文件，成功后再加入条目
+	path := p.attachmentPath(attachment.ID)
+	if err := p.files.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("failed to create attachment directory: %v", err)
+	}
+	if err := p.writeFile(path, sealed); err != nil {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("failed to write attachment: %v", err)
+	}
+	entry.Attachments = append(entry.Attachments, attachment)
+	entry.UpdatedAt = attachment.CreatedAt
+	p.mu.Unlock()
+
+	// 保存到文件
+	if err := p.savePasswords(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save password: %v", err)
+	}
+
+	p.ctx.Logger.Infof("Attachment %s added to password %s", name, id)
+
+	return map[string]interface{}{
+		"id":            id,
+		"attachment_id": attachment.ID,
+		"name":          name,
+		"size":          attachment.Size,
+		"sha256":        attachment.SHA256,
+		"message":       "Attachment added successfully",
+	}, nil
+}
+
+// findAttachment 查找条目附件，调用方需持有锁
+func (p *PasswordPlugin) findAttachment(id, attachmentID string) (*PasswordEntry, int, error) {
+	entry, exists := p.passwords[id]
+	if !exists {
+		return nil, -1, fmt.Errorf("password not found")
+	}
+	for i := range entry.Attachments {
+		if entry.Attachments[i].ID == attachmentID {
+			return entry, i, nil
+		}
+	}
+	return nil, -1, fmt.Errorf("attachment not found")
+}
+
+// handleGetAttachment 处理获取附件命令，解密后校验 SHA-256，返回 base64 编码的内容
+func (p *PasswordPlugin) handleGetAttachment(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+	attachmentID, ok := args["attachment_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("attachment_id is required")
+	}
+
+	p.mu.RLock()
+	entry, index, err := p.findAttachment(id, attachmentID)
+	var attachment Attachment
+	if err == nil {
+		attachment = entry.Attachments[index]
+		attachment.Key = append([]byte(nil), attachment.Key...)
+	}
+	p.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(attachment.Key)
+
+	sealed, err := p.ctx.Agent.ReadFile(p.attachmentPath(attachmentID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %v", err)
+	}
+	content, err := decrypt(attachment.Key, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt attachment: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != attachment.SHA256 {
+		return nil, fmt.Errorf("attachment checksum mismatch")
+	}
+
+	return map[string]interface{}{
+		"id":            id,
+		"attachment_id": attachmentID,
+		"name":          attachment.Name,
+		"content_type":  attachment.ContentType,
+		"size":          len(content),
+		"data":          base64.StdEncoding.EncodeToString(content),
+	}, nil
+}
+
+// handleDeleteAttachment 处理删除附件命令
+func (p *PasswordPlugin) handleDeleteAttachment(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+	attachmentID, ok := args["attachment_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("attachment_id is required")
+	}
+
+	p.mu.Lock()
+	entry, index, err := p.findAttachment(id, attachmentID)
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	removed := entry.Attachments[index]
+	entry.Attachments = append(entry.Attachments[:index:index], entry.Attachments[index+1:]...)
+	entry.UpdatedAt = time.Now()
+	p.mu.Unlock()
+
+	// 先保存密码库再删除文件，保存失败时附件仍可恢复
+	if err := p.savePasswords(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save password: %v", err)
+	} else {
+		p.removeAttachmentFiles([]Attachment{removed})
+	}
+	zero(removed.Key)
+
+	p.ctx.Logger.Infof("Attachment %s deleted from password %s", removed.Name, id)
+
+	return map[string]interface{}{
+		"id":            id,
+		"attachment_id": attachmentID,
+		"message":       "Attachment deleted successfully",
+	}, nil
+}
@@ -0,0 +1,438 @@
+package password
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupVersion 备份文件格式版本
+const backupVersion = 1
+
+const (
+	// defaultBackupInterval 默认定时备份间隔
+	defaultBackupInterval = 24 * time.Hour
+	// defaultBackupRetention 默认保留的备份数
+	defaultBackupRetention = 7
+	// backupDirName 未配置 backup_dir 时使用的备份目录，位于数据目录中
+	backupDirName = "password_backups"
+	// backupPrefix 和 backupSuffix 备份文件名的前缀和后缀，中间为 UTC 时间
+	backupPrefix = "passwords-"
+	backupSuffix = ".bak"
+	// backupTimeFormat 备份文件名中的时间格式，按文件名排序即按时间排序
+	backupTimeFormat = "20060102T150405.000Z"
+)
+
+// backupFile 备份文件，包含加密的密码库文件和附件文件，内容本身已加密，不再额外加密
+type backupFile struct {
+	Version     int               `json:"version"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Vault       []byte            `json:"vault"`
+	Attachments map[string][]byte `json:"attachments,omitempty"`
+	Checksum    string            `json:"checksum"`
+}
+
+// backupInfo 备份文件信息
+type backupInfo struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Checksum  string    `json:"checksum,omitempty"`
+}
+
+// checksum 计算密码库和附件内容的 SHA-256，附件按 ID 排序
+func (b *backupFile) checksum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "vault:%d:", len(b.Vault))
+	h.Write(b.Vault)
+
+	ids := make([]string, 0, len(b.Attachments))
+	for id := range b.Attachments {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(h, "attachment:%s:%d:", id, len(b.Attachments[id]))
+		h.Write(b.Attachments[id])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseBackup 解析备份文件并校验格式版本和校验和
+func parseBackup(data []byte) (*backupFile, error) {
+	var backup backupFile
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("invalid backup file: %v", err)
+	}
+	if backup.Version < 1 || backup.Version > backupVersion {
+		return nil, fmt.Errorf("unsupported backup version: %d", backup.Version)
+	}
+	if backup.Checksum != backup.checksum() {
+		return nil, fmt.Errorf("backup checksum mismatch")
+	}
+	return &backup, nil
+}
+
+// backupDir 返回备份目录，未配置 backup_dir 时使用数据目录下的 password_backups
+func (p *PasswordPlugin) backupDir() string {
+	if dir, ok := p.config["backup_dir"].(string); ok && dir != "" {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(p.dataFile), backupDirName)
+}
+
+// backupInterval 返回定时备份间隔
+func (p *PasswordPlugin) backupInterval() time.Duration {
+	if value, ok := p.config["backup_interval"].(string); ok && value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		p.ctx.Logger.Warnf("Invalid backup_interval %q, using %s", value, defaultBackupInterval)
+	}
+	return defaultBackupInterval
+}
+
+// readBackupSource 读取密码库文件和附件文件，调用方需持有 saveMu 和读锁
+func (p *PasswordPlugin) readBackupSource() (*backupFile, error) {
+	if !p.ctx.Agent.FileExists(p.dataFile) {
+		return nil, fmt.Errorf("password vault has not been saved yet")
+	}
+	vault, err := p.ctx.Agent.ReadFile(p.dataFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password vault: %v", err)
+	}
+	backup := &backupFile{
+		Version:     backupVersion,
+		Vault:       vault,
+		Attachments: make(map[string][]byte),
+	}
+
+	dir := p.attachmentDir()
+	files, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read attachments: %v", err)
+	}
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".enc")
+		if !ok || file.IsDir() {
+			continue
+		}
+		data, err := p.ctx.Agent.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %v", id, err)
+		}
+		backup.Attachments[id] = data
+	}
+	backup.Checksum = backup.checksum()
+	return backup, nil
+}
+
+// createBackup 将密码库和附件写入备份目录，清理超出保留数的旧备份
+// 配置 backup_upload_dir 时请求文件传输插件将备份上传到服务器的该目录
+// skipUnchanged 为 true 且内容与上次备份相同时不创建备份，返回 nil
+func (p *PasswordPlugin) createBackup(skipUnchanged bool) (*backupInfo, error) {
+	p.saveMu.Lock()
+	p.mu.RLock()
+	backup, err := p.readBackupSource()
+	p.mu.RUnlock()
+	p.saveMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	p.backupMu.Lock()
+	defer p.backupMu.Unlock()
+
+	if skipUnchanged && backup.Checksum == p.lastBackupChecksum {
+		return nil, nil
+	}
+
+	dir := p.backupDir()
+	if err := p.files.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	// 备份文件名精确到毫秒，同一毫秒内的多次备份（如恢复前的自动备份）顺延，避免覆盖
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	name := backupPrefix + now.Format(backupTimeFormat) + backupSuffix
+	for p.ctx.Agent.FileExists(filepath.Join(dir, name)) {
+		now = now.Add(time.Millisecond)
+		name = backupPrefix + now.Format(backupTimeFormat) + backupSuffix
+	}
+	backup.CreatedAt = now
+	data, err := json.Marshal(backup)
+	if err != nil {
+		return nil, err
+	}
+	info := &backupInfo{
+		Name:      name,
+		Path:      filepath.Join(dir, name),
+		Size:      int64(len(data)),
+		CreatedAt: now,
+		Checksum:  backup.Checksum,
+	}
+	if err := p.writeFile(info.Path, data); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %v", err)
+	}
+	p.lastBackupChecksum = backup.Checksum
+	p.lastBackup = now
+
+	p.pruneBackups(dir)
+
+	if uploadDir, ok := p.config["backup_upload_dir"].(string); ok && uploadDir != "" {
+		p.ctx.Agent.NotifyEvent("file_upload_requested", map[string]interface{}{
+			"source":      info.Path,
+			"destination": path.Join(uploadDir, name),
+			"requester":   "password-manager",
+		})
+	}
+
+	p.ctx.Logger.Infof("Password vault backed up to %s", info.Path)
+	return info, nil
+}
+
+// listBackups 返回备份目录中的备份文件，按时间倒序
+func (p *PasswordPlugin) listBackups(dir string) ([]*backupInfo, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []*backupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]*backupInfo, 0)
+	for _, file := range files {
+		stamp, ok := strings.CutPrefix(file.Name(), backupPrefix)
+		if !ok || file.IsDir() {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, backupSuffix)
+		if !ok {
+			continue
+		}
+		createdAt, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		info := &backupInfo{Name: file.Name(), Path: filepath.Join(dir, file.Name()), CreatedAt: createdAt}
+		if stat, err := file.Info(); err == nil {
+			info.Size = stat.Size()
+		}
+		backups = append(backups, info)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// pruneBackups 删除超出 backup_retention 的旧备份，backup_retention 不大于 0 时保留全部
+func (p *PasswordPlugin) pruneBackups(dir string) {
+	retention := p.configInt("backup_retention", defaultBackupRetention)
+	if retention <= 0 {
+		return
+	}
+	backups, err := p.listBackups(dir)
+	if err != nil {
+		p.ctx.Logger.Warnf("Failed to list password backups: %v", err)
+		return
+	}
+	for _, backup := range backups[min(retention, len(backups)):] {
+		if err := p.files.Remove(backup.Path); err != nil {
+			p.ctx.Logger.Warnf("Failed to remove old backup %s: %v", backup.Name, err)
+		}
+	}
+}
+
+// backupLoop 按 backup_interval 定时备份，内容与上次备份相同时跳过
+func (p *PasswordPlugin) backupLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.backupInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := p.createBackup(true); err != nil {
+				p.ctx.Logger.Errorf("Scheduled password backup failed: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// handleBackupNow 处理立即备份命令
+func (p *PasswordPlugin) handleBackupNow(args map[string]interface{}) (interface{}, error) {
+	info, err := p.createBackup(false)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"backup":  info,
+		"message": "Password vault backed up successfully",
+	}, nil
+}
+
+// handleListBackups 处理列出备份命令
+func (p *PasswordPlugin) handleListBackups(args map[string]interface{}) (interface{}, error) {
+	backups, err := p.listBackups(p.backupDir())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"backups": backups,
+		"count":   len(backups),
+	}, nil
+}
+
+// kdfEqual 判断两组主密钥派生参数是否相同
+func kdfEqual(a, b kdfParams) bool {
+	return a.Algorithm == b.Algorithm && bytes.Equal(a.Salt, b.Salt) &&
+		a.Time == b.Time && a.Memory == b.Memory && a.Threads == b.Threads
+}
+
+// verifyBackup 校验备份并解密其中的密码库，所有条目和附件都能解密且附件校验和一致时才返回
+// 未提供主密码时使用当前主密钥，只适用于主密码未更换过的备份
+func (p *PasswordPlugin) verifyBackup(data []byte, masterPassword string) (*backupFile, *openedVault, error) {
+	backup, err := parseBackup(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var file vaultFile
+	if err := json.Unmarshal(backup.Vault, &file); err != nil {
+		return nil, nil, fmt.Errorf("invalid vault in backup: %v", err)
+	}
+	if file.Version < 2 || file.Version > vaultVersion {
+		return nil, nil, fmt.Errorf("unsupported password vault version in backup: %d", file.Version)
+	}
+
+	var key []byte
+	if masterPassword != "" {
+		if key, err = file.KDF.deriveKey(masterPassword); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		p.mu.RLock()
+		if p.masterKey != nil && kdfEqual(p.kdf, file.KDF) {
+			key = append([]byte(nil), p.masterKey...)
+		}
+		p.mu.RUnlock()
+		if key == nil {
+			return nil, nil, fmt.Errorf("master_password is required to restore this backup")
+		}
+	}
+
+	vault, err := openVaultFile(&file, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, entry := range vault.entries {
+		for _, attachment := range entry.Attachments {
+			sealed, ok := backup.Attachments[attachment.ID]
+			if !ok {
+				return nil, nil, fmt.Errorf("attachment %s of %s is missing from backup", attachment.Name, entry.Title)
+			}
+			content, err := decrypt(attachment.Key, sealed)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to decrypt attachment %s of %s: %v", attachment.Name, entry.Title, err)
+			}
+			sum := sha256.Sum256(content)
+			if hex.EncodeToString(sum[:]) != attachment.SHA256 {
+				return nil, nil, fmt.Errorf("attachment %s of %s checksum mismatch", attachment.Name, entry.Title)
+			}
+		}
+	}
+	return backup, vault, nil
+}
+
+// handleRestore 处理恢复备份命令，校验通过后先备份当前密码库，再替换密码库和附件文件
+// 恢复后密码库使用备份时的主密码解锁
+func (p *PasswordPlugin) handleRestore(args map[string]interface{}) (interface{}, error) {
+	name, _ := args["backup"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("backup is required")
+	}
+	masterPassword, _ := args["master_password"].(string)
+
+	// 只允许恢复备份目录中的文件
+	backupPath := filepath.Join(p.backupDir(), filepath.Base(name))
+	data, err := p.ctx.Agent.ReadFile(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %v", err)
+	}
+	backup, vault, err := p.verifyBackup(data, masterPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	// 保留当前密码库，恢复出错时可以回退
+	var previous *backupInfo
+	if p.ctx.Agent.FileExists(p.dataFile) {
+		if previous, err = p.createBackup(false); err != nil {
+			return nil, fmt.Errorf("failed to back up current vault before restore: %v", err)
+		}
+	}
+
+	if err := p.writeRestoredFiles(backup); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.clearVaultLocked()
+	p.mu.Unlock()
+	p.installVault(vault)
+	p.resetLockTimer()
+
+	p.ctx.Logger.Infof("Password vault restored from %s", filepath.Base(name))
+
+	result := map[string]interface{}{
+		"backup":     filepath.Base(name),
+		"created_at": backup.CreatedAt,
+		"count":      len(vault.entries),
+		"message":    "Password vault restored successfully",
+	}
+	if previous != nil {
+		result["previous_backup"] = previous.Name
+	}
+	return result, nil
+}
+
+// writeRestoredFiles 写入备份中的附件和密码库文件，删除备份中没有的附件文件
+func (p *PasswordPlugin) writeRestoredFiles(backup *backupFile) error {
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	dir := p.attachmentDir()
+	if len(backup.Attachments) > 0 {
+		if err := p.files.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create attachment directory: %v", err)
+		}
+	}
+	for id, data := range backup.Attachments {
+		if err := p.writeFile(p.attachmentPath(id), data); err != nil {
+			return fmt.Errorf("failed to restore attachment %s: %v", id, err)
+		}
+	}
+	if err := p.writeFile(p.dataFile, backup.Vault); err != nil {
+		return fmt.Errorf("failed to restore password vault: %v", err)
+	}
+
+	files, _ := os.ReadDir(dir)
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".enc")
+		if _, exists := backup.Attachments[id]; ok && !exists {
+			p.files.Remove(filepath.Join(dir, file.Name()))
+		}
+	}
+	return nil
+}
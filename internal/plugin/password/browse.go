@@ -0,0 +1,296 @@
+package password
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 列表排序字段
+const (
+	SortTitle     = "title"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortLastUsed  = "last_used"
+	SortStrength  = "strength"
+)
+
+const (
+	// defaultPageSize list 和 search 默认每页条目数
+	defaultPageSize = 100
+	// maxPageSize 每页最多条目数
+	maxPageSize = 1000
+)
+
+var (
+	sortFields = []string{SortTitle, SortCreatedAt, SortUpdatedAt, SortLastUsed, SortStrength}
+	sortOrders = []string{"asc", "desc"}
+)
+
+// listOptions list 和 search 的过滤、排序和分页参数
+type listOptions struct {
+	folder      string
+	hasFolder   bool
+	recursive   bool
+	favorite    bool
+	hasFavorite bool
+	sort        string
+	desc        bool
+	limit       int
+	offset      int
+}
+
+// parseListOptions 解析过滤、排序和分页参数
+func parseListOptions(args map[string]interface{}) (*listOptions, error) {
+	opts := &listOptions{sort: SortTitle, recursive: true, limit: defaultPageSize}
+
+	if folder, ok := args["folder"].(string); ok {
+		opts.folder, opts.hasFolder = normalizeFolder(folder), true
+	}
+	if recursive, ok := args["recursive"].(bool); ok {
+		opts.recursive = recursive
+	}
+	opts.favorite, opts.hasFavorite = args["favorite"].(bool)
+
+	if field, ok := args["sort"].(string); ok && field != "" {
+		if !containsString(sortFields, field) {
+			return nil, fmt.Errorf("invalid sort field: %s", field)
+		}
+		opts.sort = field
+	}
+	if order, ok := args["order"].(string); ok && order != "" {
+		if !containsString(sortOrders, order) {
+			return nil, fmt.Errorf("invalid sort order: %s", order)
+		}
+		opts.desc = order == "desc"
+	}
+
+	if limit, ok := args["limit"].(float64); ok {
+		if limit < 1 || limit > maxPageSize {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		opts.limit = int(limit)
+	}
+	if offset, ok := args["offset"].(float64); ok {
+		if offset < 0 {
+			return nil, fmt.Errorf("offset must not be negative")
+		}
+		opts.offset = int(offset)
+	}
+	return opts, nil
+}
+
+// normalizeFolder 规范化文件夹路径：以 / 分隔层级，去掉首尾和重复的分隔符
+func normalizeFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(folder, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// inFolder 判断条目文件夹是否在 folder 下，recursive 为 true 时包含子文件夹
+func inFolder(entryFolder, folder string, recursive bool) bool {
+	if entryFolder == folder {
+		return true
+	}
+	if !recursive {
+		return false
+	}
+	return folder == "" || strings.HasPrefix(entryFolder, folder+"/")
+}
+
+// matches 判断条目是否满足文件夹和收藏过滤条件
+func (o *listOptions) matches(entry *PasswordEntry) bool {
+	if o.hasFolder && !inFolder(entry.Folder, o.folder, o.recursive) {
+		return false
+	}
+	if o.hasFavorite && entry.Favorite != o.favorite {
+		return false
+	}
+	return true
+}
+
+// less 按排序字段比较条目，相同时按标题和 ID 排序保证分页稳定
+func (o *listOptions) less(a, b *PasswordEntry) bool {
+	var cmp int
+	switch o.sort {
+	case SortCreatedAt:
+		cmp = compareTime(a.CreatedAt, b.CreatedAt)
+	case SortUpdatedAt:
+		cmp = compareTime(a.UpdatedAt, b.UpdatedAt)
+	case SortLastUsed:
+		cmp = compareTime(a.LastUsed, b.LastUsed)
+	case SortStrength:
+		cmp = a.Strength - b.Strength
+	}
+	if o.desc {
+		cmp = -cmp
+	}
+	if cmp != 0 {
+		return cmp < 0
+	}
+
+	titleA, titleB := strings.ToLower(a.Title), strings.ToLower(b.Title)
+	if titleA != titleB {
+		if o.sort == SortTitle && o.desc {
+			return titleA > titleB
+		}
+		return titleA < titleB
+	}
+	return a.ID < b.ID
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// queryEntries 按过滤条件查询条目，排序分页后以 key 返回不含密码和历史的副本
+// 结果包含匹配总数和按分类统计的数量（未分类的条目计入空字符串）
+func (p *PasswordPlugin) queryEntries(key string, opts *listOptions, match func(*PasswordEntry) bool) map[string]interface{} {
+	p.mu.RLock()
+	entries := make([]*PasswordEntry, 0, len(p.passwords))
+	for _, entry := range p.passwords {
+		if !opts.matches(entry) || (match != nil && !match(entry)) {
+			continue
+		}
+		// 不返回实际密码
+		safeEntry := *entry
+		safeEntry.Password = "***"
+		safeEntry.History = nil
+		safeEntry.Attachments = publicAttachments(entry.Attachments)
+		entries = append(entries, &safeEntry)
+	}
+	p.mu.RUnlock()
+
+	categories := make(map[string]int)
+	for _, entry := range entries {
+		categories[entry.Category]++
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return opts.less(entries[i], entries[j]) })
+
+	total := len(entries)
+	start := opts.offset
+	if start > total {
+		start = total
+	}
+	end := start + opts.limit
+	if end > total {
+		end = total
+	}
+	page := entries[start:end]
+
+	return map[string]interface{}{
+		"count":      len(page),
+		"total":      total,
+		"offset":     opts.offset,
+		"limit":      opts.limit,
+		"has_more":   end < total,
+		"categories": categories,
+		key:          page,
+	}
+}
+
+// folderInfo 文件夹及其条目数
+type folderInfo struct {
+	Path      string `json:"path"`
+	Count     int    `json:"count"`     // 直接位于该文件夹的条目数
+	Total     int    `json:"total"`     // 包含子文件夹的条目数
+	Favorites int    `json:"favorites"` // 包含子文件夹的收藏条目数
+}
+
+// handleListFolders 处理列出文件夹命令，文件夹由条目路径生成，包含所有上级文件夹
+func (p *PasswordPlugin) handleListFolders(args map[string]interface{}) (interface{}, error) {
+	folders := make(map[string]*folderInfo)
+	folderFor := func(path string) *folderInfo {
+		info, ok := folders[path]
+		if !ok {
+			info = &folderInfo{Path: path}
+			folders[path] = info
+		}
+		return info
+	}
+
+	p.mu.RLock()
+	for _, entry := range p.passwords {
+		if entry.Folder == "" {
+			continue
+		}
+		folderFor(entry.Folder).Count++
+		parts := strings.Split(entry.Folder, "/")
+		for i := range parts {
+			info := folderFor(strings.Join(parts[:i+1], "/"))
+			info.Total++
+			if entry.Favorite {
+				info.Favorites++
+			}
+		}
+	}
+	p.mu.RUnlock()
+
+	result := make([]*folderInfo, 0, len(folders))
+	for _, info := range folders {
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+
+	return map[string]interface{}{
+		"folders": result,
+		"count":   len(result),
+	}, nil
+}
+
+// handleRenameFolder 处理重命名文件夹命令，子文件夹一并移动
+func (p *PasswordPlugin) handleRenameFolder(args map[string]interface{}) (interface{}, error) {
+	from, _ := args["from"].(string)
+	to, _ := args["to"].(string)
+	from, to = normalizeFolder(from), normalizeFolder(to)
+	if from == "" {
+		return nil, fmt.Errorf("from is required")
+	}
+	if to == from || strings.HasPrefix(to, from+"/") {
+		return nil, fmt.Errorf("cannot move folder %s into itself", from)
+	}
+
+	now := time.Now()
+	moved := 0
+
+	p.mu.Lock()
+	for _, entry := range p.passwords {
+		if !inFolder(entry.Folder, from, true) {
+			continue
+		}
+		entry.Folder = normalizeFolder(to + strings.TrimPrefix(entry.Folder, from))
+		entry.UpdatedAt = now
+		moved++
+	}
+	p.mu.Unlock()
+
+	if moved == 0 {
+		return nil, fmt.Errorf("folder not found: %s", from)
+	}
+
+	// 保存到文件
+	if err := p.savePasswords(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save passwords: %v", err)
+	}
+
+	p.ctx.Logger.Infof("Password folder %s renamed to %s", from, to)
+
+	return map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"moved":   moved,
+		"message": "Folder renamed successfully",
+	}, nil
+}
@@ -0,0 +1,452 @@
+package password
+
+import (
+	"bytes"
+	crypto_rand "crypto/rand"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 导入导出格式
+const (
+	FormatJSON         = "json"          // 主密钥加密的 JSON，用于在 Agent 之间迁移
+	FormatKeePassXML   = "keepass_xml"   // KeePass 2.x XML
+	FormatBitwardenCSV = "bitwarden_csv" // Bitwarden CSV
+	FormatLastPassCSV  = "lastpass_csv"  // LastPass CSV
+)
+
+// 导入时与已有条目重复的处理方式，标题、用户名和 URL 都相同（或 ID 相同）视为重复
+const (
+	DuplicateSkip      = "skip"      // 跳过重复条目
+	DuplicateOverwrite = "overwrite" // 用导入的数据更新已有条目
+	DuplicateKeep      = "keep"      // 作为新条目导入
+)
+
+var (
+	dataFormats       = []string{FormatJSON, FormatKeePassXML, FormatBitwardenCSV, FormatLastPassCSV}
+	duplicatePolicies = []string{DuplicateSkip, DuplicateOverwrite, DuplicateKeep}
+)
+
+// entryFields 可映射的条目字段
+var entryFields = []string{"title", "username", "password", "url", "notes", "category", "folder", "favorite", "description"}
+
+// csvLayout CSV 格式的列定义
+type csvLayout struct {
+	header  []string
+	columns map[string]string // 条目字段 → 列名
+	fixed   map[string]string // 导出时填写固定值的列
+}
+
+var csvLayouts = map[string]csvLayout{
+	FormatBitwardenCSV: {
+		header: []string{"folder", "favorite", "type", "name", "notes", "fields", "reprompt",
+			"login_uri", "login_username", "login_password", "login_totp"},
+		columns: map[string]string{
+			"title":    "name",
+			"username": "login_username",
+			"password": "login_password",
+			"url":      "login_uri",
+			"notes":    "notes",
+			"folder":   "folder",
+			"favorite": "favorite",
+		},
+		fixed: map[string]string{"type": "login", "reprompt": "0"},
+	},
+	FormatLastPassCSV: {
+		header: []string{"url", "username", "password", "totp", "extra", "name", "grouping", "fav"},
+		columns: map[string]string{
+			"title":    "name",
+			"username": "username",
+			"password": "password",
+			"url":      "url",
+			"notes":    "extra",
+			"folder":   "grouping",
+			"favorite": "fav",
+		},
+	},
+}
+
+// getField 读取条目字段
+func getField(entry *PasswordEntry, field string) string {
+	switch field {
+	case "title":
+		return entry.Title
+	case "username":
+		return entry.Username
+	case "password":
+		return entry.Password
+	case "url":
+		return entry.URL
+	case "notes":
+		return entry.Notes
+	case "category":
+		return entry.Category
+	case "folder":
+		return entry.Folder
+	case "favorite":
+		if entry.Favorite {
+			return "1"
+		}
+		return "0"
+	case "description":
+		return entry.Description
+	}
+	return ""
+}
+
+// setField 设置条目字段
+func setField(entry *PasswordEntry, field, value string) {
+	switch field {
+	case "title":
+		entry.Title = value
+	case "username":
+		entry.Username = value
+	case "password":
+		entry.Password = value
+	case "url":
+		entry.URL = value
+	case "notes":
+		entry.Notes = value
+	case "category":
+		entry.Category = value
+	case "folder":
+		entry.Folder = normalizeFolder(value)
+	case "favorite":
+		entry.Favorite = value == "1" || strings.EqualFold(value, "true")
+	case "description":
+		entry.Description = value
+	}
+}
+
+// parseMapping 解析 mapping 参数（条目字段 → 列名），覆盖格式默认的列
+func parseMapping(layout csvLayout, value interface{}) (map[string]string, error) {
+	columns := make(map[string]string, len(layout.columns))
+	for field, column := range layout.columns {
+		columns[field] = column
+	}
+	if value == nil {
+		return columns, nil
+	}
+
+	mapping, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mapping must be an object")
+	}
+	for field, column := range mapping {
+		if !containsString(entryFields, field) {
+			return nil, fmt.Errorf("unknown field in mapping: %s", field)
+		}
+		name, ok := column.(string)
+		if !ok {
+			return nil, fmt.Errorf("mapping column for %s must be a string", field)
+		}
+		if name == "" {
+			delete(columns, field)
+		} else {
+			columns[field] = name
+		}
+	}
+	return columns, nil
+}
+
+// decodeCSV 按列映射解析 CSV，第一行为表头
+func decodeCSV(data string, columns map[string]string) ([]*PasswordEntry, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(data, "\ufeff")))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("csv header is missing")
+	}
+
+	index := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		index[strings.TrimSpace(name)] = i
+	}
+	for field, column := range columns {
+		if _, ok := index[column]; !ok && field == "title" {
+			return nil, fmt.Errorf("csv column %s not found", column)
+		}
+	}
+
+	entries := make([]*PasswordEntry, 0, len(records)-1)
+	for _, record := range records[1:] {
+		entry := &PasswordEntry{}
+		for field, column := range columns {
+			if i, ok := index[column]; ok && i < len(record) {
+				setField(entry, field, record[i])
+			}
+		}
+		if entry.Title == "" && entry.Username == "" && entry.Password == "" && entry.URL == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// encodeCSV 按格式的列定义导出 CSV
+func encodeCSV(entries []*PasswordEntry, layout csvLayout) (string, error) {
+	fields := make(map[string]string, len(layout.columns))
+	for field, column := range layout.columns {
+		fields[column] = field
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(layout.header); err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		record := make([]string, len(layout.header))
+		for i, column := range layout.header {
+			if field, ok := fields[column]; ok {
+				record[i] = getField(entry, field)
+			} else {
+				record[i] = layout.fixed[column]
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+	return buf.String(), writer.Error()
+}
+
+// KeePass 2.x XML 结构，只包含导入导出用到的元素
+type keepassFile struct {
+	XMLName xml.Name    `xml:"KeePassFile"`
+	Meta    keepassMeta `xml:"Meta"`
+	Root    keepassRoot `xml:"Root"`
+}
+
+type keepassMeta struct {
+	Generator         string `xml:"Generator"`
+	RecycleBinEnabled string `xml:"RecycleBinEnabled,omitempty"`
+	RecycleBinUUID    string `xml:"RecycleBinUUID,omitempty"`
+}
+
+type keepassRoot struct {
+	Groups []*keepassGroup `xml:"Group"`
+}
+
+type keepassGroup struct {
+	UUID    string          `xml:"UUID"`
+	Name    string          `xml:"Name"`
+	Entries []*keepassEntry `xml:"Entry"`
+	Groups  []*keepassGroup `xml:"Group"`
+}
+
+type keepassEntry struct {
+	UUID    string          `xml:"UUID"`
+	Tags    string          `xml:"Tags,omitempty"`
+	Times   keepassTimes    `xml:"Times"`
+	Strings []keepassString `xml:"String"`
+}
+
+type keepassTimes struct {
+	CreationTime         string `xml:"CreationTime,omitempty"`
+	LastModificationTime string `xml:"LastModificationTime,omitempty"`
+	LastAccessTime       string `xml:"LastAccessTime,omitempty"`
+	ExpiryTime           string `xml:"ExpiryTime,omitempty"`
+	Expires              string `xml:"Expires"`
+}
+
+type keepassString struct {
+	Key   string       `xml:"Key"`
+	Value keepassValue `xml:"Value"`
+}
+
+type keepassValue struct {
+	Text            string `xml:",chardata"`
+	Protected       string `xml:"Protected,attr,omitempty"`
+	ProtectInMemory string `xml:"ProtectInMemory,attr,omitempty"`
+}
+
+// keepassKeys KeePass 标准字段与条目字段的对应关系
+var keepassKeys = map[string]string{
+	"Title":    "title",
+	"UserName": "username",
+	"Password": "password",
+	"URL":      "url",
+	"Notes":    "notes",
+}
+
+// decodeKeePassXML 解析 KeePass 2.x XML，分组路径作为文件夹，回收站中的条目不导入
+// 非标准字段追加到备注中
+func decodeKeePassXML(data string) ([]*PasswordEntry, error) {
+	var file keepassFile
+	if err := xml.Unmarshal([]byte(data), &file); err != nil {
+		return nil, fmt.Errorf("invalid keepass xml: %v", err)
+	}
+
+	recycleBin := ""
+	if !strings.EqualFold(file.Meta.RecycleBinEnabled, "False") {
+		recycleBin = file.Meta.RecycleBinUUID
+	}
+
+	var entries []*PasswordEntry
+	var walk func(group *keepassGroup, path []string) error
+	walk = func(group *keepassGroup, path []string) error {
+		if recycleBin != "" && group.UUID == recycleBin {
+			return nil
+		}
+		for _, item := range group.Entries {
+			entry, err := item.toEntry(normalizeFolder(strings.Join(path, "/")))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		for _, child := range group.Groups {
+			if err := walk(child, append(path, child.Name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// 顶层分组是数据库根分组，不计入文件夹
+	for _, group := range file.Root.Groups {
+		if err := walk(group, nil); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// toEntry 转换为密码条目
+func (e *keepassEntry) toEntry(folder string) (*PasswordEntry, error) {
+	entry := &PasswordEntry{Folder: folder}
+	var extra []string
+	for _, s := range e.Strings {
+		if strings.EqualFold(s.Value.Protected, "True") {
+			return nil, fmt.Errorf("protected values are not supported, export the database as KeePass XML (2.x)")
+		}
+		if field, ok := keepassKeys[s.Key]; ok {
+			setField(entry, field, s.Value.Text)
+		} else if s.Value.Text != "" {
+			extra = append(extra, s.Key+": "+s.Value.Text)
+		}
+	}
+	if len(extra) > 0 {
+		entry.Notes = strings.TrimSpace(entry.Notes + "\n" + strings.Join(extra, "\n"))
+	}
+
+	if e.Tags != "" {
+		for _, tag := range strings.FieldsFunc(e.Tags, func(r rune) bool { return r == ';' || r == ',' }) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+	}
+	entry.CreatedAt, _ = time.Parse(time.RFC3339, e.Times.CreationTime)
+	if strings.EqualFold(e.Times.Expires, "True") {
+		entry.ExpiresAt, _ = time.Parse(time.RFC3339, e.Times.ExpiryTime)
+	}
+	return entry, nil
+}
+
+// encodeKeePassXML 导出为 KeePass 2.x XML，文件夹按 / 拆分为分组
+func encodeKeePassXML(entries []*PasswordEntry) (string, error) {
+	root := &keepassGroup{UUID: keepassUUID(""), Name: "Assistant Agent"}
+	groups := map[string]*keepassGroup{"": root}
+
+	var groupFor func(path string) *keepassGroup
+	groupFor = func(path string) *keepassGroup {
+		if group, ok := groups[path]; ok {
+			return group
+		}
+		parent, name := "", path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent, name = path[:i], path[i+1:]
+		}
+		group := &keepassGroup{UUID: keepassUUID(""), Name: name}
+		parentGroup := groupFor(parent)
+		parentGroup.Groups = append(parentGroup.Groups, group)
+		groups[path] = group
+		return group
+	}
+
+	sorted := make([]*PasswordEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Title < sorted[j].Title })
+
+	for _, entry := range sorted {
+		item := &keepassEntry{
+			UUID: keepassUUID(entry.ID),
+			Tags: strings.Join(entry.Tags, ";"),
+			Times: keepassTimes{
+				CreationTime:         keepassTime(entry.CreatedAt),
+				LastModificationTime: keepassTime(entry.UpdatedAt),
+				LastAccessTime:       keepassTime(entry.LastUsed),
+				Expires:              "False",
+			},
+		}
+		if !entry.ExpiresAt.IsZero() {
+			item.Times.Expires = "True"
+			item.Times.ExpiryTime = keepassTime(entry.ExpiresAt)
+		}
+		for _, key := range []string{"Title", "UserName", "Password", "URL", "Notes"} {
+			value := keepassValue{Text: getField(entry, keepassKeys[key])}
+			if key == "Password" {
+				value.ProtectInMemory = "True"
+			}
+			item.Strings = append(item.Strings, keepassString{Key: key, Value: value})
+		}
+		group := groupFor(normalizeFolder(entry.Folder))
+		group.Entries = append(group.Entries, item)
+	}
+
+	file := keepassFile{
+		Meta: keepassMeta{Generator: "Assistant Agent"},
+		Root: keepassRoot{Groups: []*keepassGroup{root}},
+	}
+	data, err := xml.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(data), nil
+}
+
+// keepassUUID 将十六进制条目 ID 转换为 KeePass 使用的 base64 UUID，ID 无效时生成随机 UUID
+func keepassUUID(id string) string {
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != 16 {
+		b = make([]byte, 16)
+		crypto_rand.Read(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func keepassTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// duplicateKey 重复检测使用的键：标题、用户名和 URL，忽略大小写和 URL 末尾的 /
+func duplicateKey(entry *PasswordEntry) string {
+	url := strings.TrimRight(strings.ToLower(strings.TrimSpace(entry.URL)), "/")
+	return strings.ToLower(strings.TrimSpace(entry.Title)) + "\x00" +
+		strings.ToLower(strings.TrimSpace(entry.Username)) + "\x00" + url
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package password
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultHistorySize 每个条目默认保留的历史密码数
+	defaultHistorySize = 10
+	// defaultReuseHistory no-reuse 标签未指定数量时禁止重复使用的最近密码数
+	defaultReuseHistory = 5
+	// ReuseTag 带有该标签（或 no-reuse:N）的条目禁止重复使用最近 N 个密码
+	ReuseTag = "no-reuse"
+)
+
+// PasswordVersion 条目的历史密码，随条目一起加密保存
+type PasswordVersion struct {
+	Version    int       `json:"version"`
+	Password   string    `json:"password"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// currentVersion 返回条目当前密码的版本号，旧数据没有版本号时为 1
+func currentVersion(entry *PasswordEntry) int {
+	if entry.PasswordVersion == 0 {
+		return 1
+	}
+	return entry.PasswordVersion
+}
+
+// reuseLimit 返回条目禁止重复使用的最近密码数，没有 no-reuse 标签时返回 0
+func (p *PasswordPlugin) reuseLimit(entry *PasswordEntry) int {
+	for _, tag := range entry.Tags {
+		if tag == ReuseTag {
+			return p.configInt("reuse_history", defaultReuseHistory)
+		}
+		if value, ok := strings.CutPrefix(tag, ReuseTag+":"); ok {
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// checkReuse 检查新密码是否为当前密码或最近 limit 个历史密码之一
+func checkReuse(entry *PasswordEntry, password string, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	if entry.Password == password {
+		return fmt.Errorf("password must differ from the last %d passwords", limit)
+	}
+	for i := len(entry.History) - 1; i >= 0 && i >= len(entry.History)-(limit-1); i-- {
+		if entry.History[i].Password == password {
+			return fmt.Errorf("password must differ from the last %d passwords", limit)
+		}
+	}
+	return nil
+}
+
+// setPasswordLocked 更新条目密码并将原密码保存到历史，调用方需持有写锁
+// enforce 为 true 时按条目的重复使用策略检查新密码
+func (p *PasswordPlugin) setPasswordLocked(entry *PasswordEntry, password string, now time.Time, enforce bool) error {
+	if enforce {
+		if err := checkReuse(entry, password, p.reuseLimit(entry)); err != nil {
+			return err
+		}
+	}
+	if password == entry.Password {
+		return nil
+	}
+
+	version := currentVersion(entry)
+	if entry.Password != "" {
+		entry.History = append(entry.History, PasswordVersion{
+			Version:    version,
+			Password:   entry.Password,
+			ReplacedAt: now,
+		})
+		if size := p.configInt("history_size", defaultHistorySize); size >= 0 && len(entry.History) > size {
+			entry.History = append([]PasswordVersion(nil), entry.History[len(entry.History)-size:]...)
+		}
+	}
+
+	entry.Password = password
+	entry.PasswordVersion = version + 1
+	entry.Strength = p.calculatePasswordStrength(password)
+	return nil
+}
+
+// handleGetHistory 处理获取历史密码命令，按版本倒序返回，reveal 为 true 时返回密码明文
+func (p *PasswordPlugin) handleGetHistory(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+	reveal, _ := args["reveal"].(bool)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, exists := p.passwords[id]
+	if !exists {
+		return nil, fmt.Errorf("password not found")
+	}
+
+	versions := make([]PasswordVersion, 0, len(entry.History))
+	for i := len(entry.History) - 1; i >= 0; i-- {
+		version := entry.History[i]
+		if !reveal {
+			version.Password = "***"
+		}
+		versions = append(versions, version)
+	}
+
+	return map[string]interface{}{
+		"id":              id,
+		"current_version": currentVersion(entry),
+		"history":         versions,
+		"count":           len(versions),
+	}, nil
+}
+
+// handleRevert 处理恢复历史密码命令，当前密码保存到历史，恢复的密码成为新版本
+func (p *PasswordPlugin) handleRevert(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+	target, ok := args["version"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("version is required")
+	}
+
+	p.mu.Lock()
+	entry, exists := p.passwords[id]
+	if !exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("password not found")
+	}
+
+	password := ""
+	found := false
+	for _, version := range entry.History {
+		if version.Version == int(target) {
+			password, found = version.Password, true
+			break
+		}
+	}
+	if !found {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("password version %d not found", int(target))
+	}
+
+	now := time.Now()
+	if err := p.setPasswordLocked(entry, password, now, true); err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	entry.UpdatedAt = now
+	version := entry.PasswordVersion
+	title := entry.Title
+	p.mu.Unlock()
+
+	// 保存到文件
+	if err := p.savePasswords(); err != nil {
+		p.ctx.Logger.Errorf("Failed to save password: %v", err)
+	}
+
+	p.ctx.Logger.Infof("Password %s reverted to version %d", title, int(target))
+
+	return map[string]interface{}{
+		"id":      id,
+		"version": version,
+		"message": "Password reverted successfully",
+	}, nil
+}
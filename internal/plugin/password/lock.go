@@ -0,0 +1,213 @@
+package password
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// errVaultLocked 密码库已锁定，需要先通过 unlock 命令解锁
+var errVaultLocked = errors.New("password vault is locked")
+
+// 默认自动锁定时间（秒）
+const defaultLockTimeout = 300
+
+// lockFreeCommands 密码库锁定时仍可执行的命令，这些命令不访问密码库
+var lockFreeCommands = map[string]bool{
+	"unlock":         true,
+	"lock":           true,
+	"generate":       true,
+	"check_strength": true,
+	// 备份和恢复只读写加密后的文件，恢复时通过 master_password 解密备份
+	"backup_now":   true,
+	"list_backups": true,
+	"restore":      true,
+}
+
+// unlock 使用主密码解锁密码库，密码库文件存在时解密校验主密码，旧格式的密码库解锁后按当前格式重新保存
+func (p *PasswordPlugin) unlock(masterPassword string) (int, error) {
+	if masterPassword == "" {
+		return 0, fmt.Errorf("master_password is required")
+	}
+
+	// 已解锁时只校验主密码
+	p.mu.RLock()
+	unlocked, kdf := p.masterKey != nil, p.kdf
+	p.mu.RUnlock()
+	if unlocked {
+		key, err := kdf.deriveKey(masterPassword)
+		if err != nil {
+			return 0, err
+		}
+		p.mu.RLock()
+		match := keysEqual(p.masterKey, key)
+		count := len(p.passwords)
+		p.mu.RUnlock()
+		if !match {
+			return 0, fmt.Errorf("invalid master password")
+		}
+		p.resetLockTimer()
+		return count, nil
+	}
+
+	vault, err := p.openVault(masterPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	p.installVault(vault)
+
+	if vault.migrated {
+		if err := p.savePasswords(); err != nil {
+			p.ctx.Logger.Errorf("Failed to migrate password vault: %v", err)
+		} else {
+			p.ctx.Logger.Info("Password vault migrated to per-entry encryption")
+		}
+	}
+
+	p.resetLockTimer()
+	p.ctx.Logger.Info("Password vault unlocked")
+	return len(vault.entries), nil
+}
+
+// installVault 使用解锁后的密码库替换内存中的密钥和条目
+func (p *PasswordPlugin) installVault(vault *openedVault) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.masterKey, p.kdf, p.dataKeys = vault.key, vault.kdf, vault.dataKeys
+	p.shareKey = vault.shareKey
+	p.passwords = make(map[string]*PasswordEntry, len(vault.entries))
+	for _, entry := range vault.entries {
+		p.passwords[entry.ID] = entry
+	}
+}
+
+// lock 锁定密码库，清零内存中的主密钥和解密后的条目
+func (p *PasswordPlugin) lock(reason string) {
+	p.mu.Lock()
+	if p.lockTimer != nil {
+		p.lockTimer.Stop()
+		p.lockTimer = nil
+	}
+	if p.masterKey == nil {
+		p.mu.Unlock()
+		return
+	}
+	p.clearVaultLocked()
+	p.mu.Unlock()
+
+	p.ctx.Logger.Infof("Password vault locked: %s", reason)
+	p.ctx.Agent.NotifyEvent("password_vault_locked", map[string]interface{}{
+		"reason": reason,
+	})
+}
+
+// clearVaultLocked 清零内存中的主密钥、数据密钥和解密后的条目，调用方需持有写锁
+func (p *PasswordPlugin) clearVaultLocked() {
+	zero(p.masterKey)
+	p.masterKey = nil
+	for _, key := range p.dataKeys {
+		zero(key)
+	}
+	p.dataKeys = nil
+	p.shareKey = nil
+	for id, entry := range p.passwords {
+		zeroAttachments(entry.Attachments)
+		*entry = PasswordEntry{}
+		delete(p.passwords, id)
+	}
+}
+
+// isLocked 返回密码库是否已锁定
+func (p *PasswordPlugin) isLocked() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.masterKey == nil
+}
+
+// touch 检查密码库已解锁并重新计算自动锁定时间，每个访问密码库的命令执行前调用
+func (p *PasswordPlugin) touch() error {
+	if p.isLocked() {
+		return errVaultLocked
+	}
+	p.resetLockTimer()
+	return nil
+}
+
+// resetLockTimer 按 auto_lock 和 lock_timeout 配置重新开始自动锁定计时
+func (p *PasswordPlugin) resetLockTimer() {
+	timeout := time.Duration(p.configInt("lock_timeout", defaultLockTimeout)) * time.Second
+	enabled := p.configBool("auto_lock", true) && timeout > 0
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.masterKey == nil || !enabled {
+		if p.lockTimer != nil {
+			p.lockTimer.Stop()
+			p.lockTimer = nil
+		}
+		return
+	}
+	if p.lockTimer != nil {
+		p.lockTimer.Reset(timeout)
+		return
+	}
+	p.lockTimer = time.AfterFunc(timeout, func() {
+		p.lock("inactivity timeout")
+	})
+}
+
+// currentKey 返回当前主密钥，密码库锁定时返回 errVaultLocked
+func (p *PasswordPlugin) currentKey() ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.masterKey == nil {
+		return nil, errVaultLocked
+	}
+	// 返回副本，锁定时清零主密钥不影响正在进行的加解密
+	return append([]byte(nil), p.masterKey...), nil
+}
+
+// keysEqual 以固定时间比较密钥
+func keysEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// handleUnlock 处理解锁命令
+func (p *PasswordPlugin) handleUnlock(args map[string]interface{}) (interface{}, error) {
+	masterPassword, _ := args["master_password"].(string)
+	count, err := p.unlock(masterPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"locked":  false,
+		"count":   count,
+		"message": "Password vault unlocked",
+	}, nil
+}
+
+// handleLock 处理锁定命令
+func (p *PasswordPlugin) handleLock(args map[string]interface{}) (interface{}, error) {
+	p.lock("manual")
+	return map[string]interface{}{
+		"locked":  true,
+		"message": "Password vault locked",
+	}, nil
+}
+
+// configBool 读取布尔配置，配置值可以是布尔值或字符串
+func (p *PasswordPlugin) configBool(key string, defaultValue bool) bool {
+	return plugin.ConfigBool(p.config, key, defaultValue)
+}
+
+// configInt 读取整数配置，配置值可以是数字或字符串
+func (p *PasswordPlugin) configInt(key string, defaultValue int) int {
+	return plugin.ConfigInt(p.config, key, defaultValue)
+}
@@ -3,8 +3,8 @@ package password
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdh"
 	crypto_rand "crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -16,9 +16,8 @@ import (
 	"sync"
 	"time"
 
+	"assistant_agent/internal/fsutil"
 	"assistant_agent/internal/plugin"
-
-	"golang.org/x/crypto/pbkdf2"
 )
 
 // PasswordPlugin 密码管理插件
@@ -31,6 +30,25 @@ type PasswordPlugin struct {
 	dataFile  string
 	mu        sync.RWMutex
 	stopChan  chan struct{}
+
+	// 自动锁定计时器，密码库解锁且 auto_lock 开启时有效
+	lockTimer *time.Timer
+
+	// 主密钥派生参数和每个条目的数据密钥，锁定时清零
+	kdf      kdfParams
+	dataKeys map[string][]byte
+	saveMu   sync.Mutex
+
+	// 接收分享使用的 X25519 私钥，保存在密码库中
+	shareKey *ecdh.PrivateKey
+
+	// 最近一次备份的时间和校验和，定时备份内容未变化时跳过
+	backupMu           sync.Mutex
+	lastBackup         time.Time
+	lastBackupChecksum string
+
+	// 备份和附件目录的创建、删除经由受限的 Agent 文件接口
+	files plugin.FileSystem
 }
 
 // PasswordEntry 密码条目
@@ -42,6 +60,8 @@ type PasswordEntry struct {
 	URL         string    `json:"url"`
 	Description string    `json:"description"`
 	Category    string    `json:"category"`
+	Folder      string    `json:"folder,omitempty"` // 以 / 分隔的层级路径
+	Favorite    bool      `json:"favorite,omitempty"`
 	Tags        []string  `json:"tags"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -49,6 +69,13 @@ type PasswordEntry struct {
 	ExpiresAt   time.Time `json:"expires_at"`
 	Strength    int       `json:"strength"` // 1-10
 	Notes       string    `json:"notes"`
+
+	// 密码版本号和历史密码，历史只通过 get_history 返回
+	PasswordVersion int               `json:"password_version,omitempty"`
+	History         []PasswordVersion `json:"history,omitempty"`
+
+	// 附件元数据，返回给调用方时不包含附件密钥
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 // PasswordRequest 密码请求
@@ -90,6 +117,12 @@ func NewPasswordPlugin() *PasswordPlugin {
 
 // Info 返回插件信息
 func (p *PasswordPlugin) Info() *plugin.PluginInfo {
+	// 配置了数据目录以外的备份目录时同样需要写入权限
+	writePaths := []string{plugin.PathDataDir}
+	if dir := plugin.ConfigString(p.config, "backup_dir", ""); dir != "" {
+		writePaths = append(writePaths, dir)
+	}
+
 	return &plugin.PluginInfo{
 		Name:        "password-manager",
 		Version:     "1.0.0",
@@ -99,10 +132,23 @@ func (p *PasswordPlugin) Info() *plugin.PluginInfo {
 		Homepage:    "https://github.com/assistant-agent/plugins",
 		Tags:        []string{"password", "security", "encryption"},
 		Config: map[string]string{
-			"master_password": "",
-			"auto_lock":       "true",
-			"lock_timeout":    "300",
-			"backup_enabled":  "true",
+			"master_password":      "",
+			"auto_lock":            "true",
+			"lock_timeout":         "300",
+			"backup_enabled":       "true",
+			"backup_interval":      "24h",
+			"backup_dir":           "", // 为空时使用数据目录下的 password_backups
+			"backup_retention":     "7",
+			"backup_upload_dir":    "", // 服务器上的备份目录，为空时不上传
+			"history_size":         "10",
+			"reuse_history":        "5",
+			"attachment_max_size":  "1048576",
+			"attachment_max_count": "10",
+		},
+		// 密码库只保存在数据目录和备份目录，不允许执行命令，通过服务器分享条目
+		Permissions: &plugin.PluginPermissions{
+			WritePaths: writePaths,
+			Server:     true,
 		},
 	}
 }
@@ -112,17 +158,28 @@ func (p *PasswordPlugin) Init(ctx *plugin.PluginContext) error {
 	p.ctx = ctx
 	p.status.Status = "initialized"
 
-	// 设置数据文件路径
-	p.dataFile = filepath.Join(ctx.Agent.GetConfig("data_dir").(string), "passwords.enc")
+	// 设置数据文件路径，密码库位于 Agent 数据目录（插件权限只允许访问该目录）
+	dataDir, _ := ctx.Agent.GetConfig("agent.data_dir").(string)
+	if dataDir == "" {
+		return fmt.Errorf("agent data directory is not configured")
+	}
+	p.dataFile = filepath.Join(dataDir, "passwords.enc")
 
-	// 初始化主密钥
-	if err := p.initializeMasterKey(); err != nil {
-		return fmt.Errorf("failed to initialize master key: %w", err)
+	files, err := plugin.AgentFS(ctx.Agent)
+	if err != nil {
+		return err
 	}
+	p.files = files
 
-	// 加载密码数据
-	if err := p.loadPasswords(); err != nil {
-		p.ctx.Logger.Warnf("Failed to load passwords: %v", err)
+	// 配置或环境变量提供主密码时自动解锁，否则密码库保持锁定，需要通过 unlock 命令解锁
+	masterPassword, _ := p.config["master_password"].(string)
+	if masterPassword == "" {
+		masterPassword = os.Getenv("PASSWORD_MASTER_KEY")
+	}
+	if masterPassword == "" {
+		p.ctx.Logger.Info("Password vault is locked, waiting for unlock")
+	} else if _, err := p.unlock(masterPassword); err != nil {
+		p.ctx.Logger.Warnf("Failed to unlock password vault: %v", err)
 	}
 
 	p.ctx.Logger.Info("Password plugin initialized")
@@ -134,8 +191,12 @@ func (p *PasswordPlugin) Start() error {
 	p.status.Status = "running"
 	p.status.StartTime = time.Now()
 
-	// 启动后台任务
-	go p.backgroundTask()
+	// 启动后台任务，修改配置后插件会被重启，每次启动使用新的停止信号
+	p.stopChan = make(chan struct{})
+	go p.backgroundTask(p.stopChan)
+	if p.configBool("backup_enabled", true) {
+		go p.backupLoop(p.stopChan)
+	}
 
 	p.ctx.Logger.Info("Password plugin started")
 	return nil
@@ -146,9 +207,18 @@ func (p *PasswordPlugin) Stop() error {
 	p.status.Status = "stopped"
 	close(p.stopChan)
 
-	// 保存密码数据
-	if err := p.savePasswords(); err != nil {
-		p.ctx.Logger.Errorf("Failed to save passwords: %v", err)
+	p.mu.Lock()
+	if p.lockTimer != nil {
+		p.lockTimer.Stop()
+		p.lockTimer = nil
+	}
+	p.mu.Unlock()
+
+	// 保存密码数据，锁定时内存中没有可保存的数据
+	if !p.isLocked() {
+		if err := p.savePasswords(); err != nil {
+			p.ctx.Logger.Errorf("Failed to save passwords: %v", err)
+		}
 	}
 
 	p.ctx.Logger.Info("Password plugin stopped")
@@ -157,7 +227,32 @@ func (p *PasswordPlugin) Stop() error {
 
 // HandleCommand 处理命令
 func (p *PasswordPlugin) HandleCommand(command string, args map[string]interface{}) (interface{}, error) {
+	// 密码库锁定时只允许不访问密码库的命令
+	if !lockFreeCommands[command] {
+		if err := p.touch(); err != nil {
+			return nil, err
+		}
+	}
+
 	switch command {
+	case "unlock":
+		return p.handleUnlock(args)
+	case "lock":
+		return p.handleLock(args)
+	case "rotate_master_key":
+		return p.handleRotateMasterKey(args)
+	case "get_history":
+		return p.handleGetHistory(args)
+	case "revert":
+		return p.handleRevert(args)
+	case "share_key":
+		return p.handleShareKey(args)
+	case "share":
+		return p.handleShare(args)
+	case "receive_share":
+		return p.handleReceiveShare(args)
+	case "revoke_share":
+		return p.handleRevokeShare(args)
 	case "add":
 		return p.handleAdd(args)
 	case "get":
@@ -170,6 +265,22 @@ func (p *PasswordPlugin) HandleCommand(command string, args map[string]interface
 		return p.handleList(args)
 	case "search":
 		return p.handleSearch(args)
+	case "backup_now":
+		return p.handleBackupNow(args)
+	case "list_backups":
+		return p.handleListBackups(args)
+	case "restore":
+		return p.handleRestore(args)
+	case "add_attachment":
+		return p.handleAddAttachment(args)
+	case "get_attachment":
+		return p.handleGetAttachment(args)
+	case "delete_attachment":
+		return p.handleDeleteAttachment(args)
+	case "list_folders":
+		return p.handleListFolders(args)
+	case "rename_folder":
+		return p.handleRenameFolder(args)
 	case "generate":
 		return p.handleGenerate(args)
 	case "check_strength":
@@ -183,6 +294,136 @@ func (p *PasswordPlugin) HandleCommand(command string, args map[string]interface
 	}
 }
 
+// CommandSchemas 返回命令参数声明，插件管理器据此校验参数
+func (p *PasswordPlugin) CommandSchemas() map[string]*plugin.CommandSchema {
+	return passwordCommandSchemas
+}
+
+var (
+	optionalString = plugin.ArgSchema{Type: plugin.ArgString}
+	requiredString = plugin.ArgSchema{Type: plugin.ArgString, Required: true}
+	dataFormat     = plugin.ArgSchema{Type: plugin.ArgString, Default: FormatJSON, Enum: dataFormats}
+
+	passwordCommandSchemas = map[string]*plugin.CommandSchema{
+		"unlock": {Args: map[string]plugin.ArgSchema{"master_password": requiredString}},
+		"lock":   {},
+		"rotate_master_key": {Args: map[string]plugin.ArgSchema{
+			"current_password": requiredString,
+			"new_password":     requiredString,
+			"rotate_data_keys": {Type: plugin.ArgBool, Default: false},
+		}},
+		"add": {Args: map[string]plugin.ArgSchema{
+			"title":       requiredString,
+			"username":    optionalString,
+			"password":    optionalString,
+			"url":         optionalString,
+			"description": optionalString,
+			"category":    optionalString,
+			"folder":      {Type: plugin.ArgString, Description: "以 / 分隔的文件夹路径"},
+			"favorite":    {Type: plugin.ArgBool, Default: false},
+			"tags":        {Type: plugin.ArgAny},
+			"notes":       {Type: plugin.ArgString, Default: ""},
+			"expires_at":  {Type: plugin.ArgString, Description: "RFC3339 时间"},
+		}},
+		"get":    {Args: map[string]plugin.ArgSchema{"id": requiredString}},
+		"delete": {Args: map[string]plugin.ArgSchema{"id": requiredString}},
+		"get_history": {Args: map[string]plugin.ArgSchema{
+			"id":     requiredString,
+			"reveal": {Type: plugin.ArgBool, Default: false},
+		}},
+		"revert": {Args: map[string]plugin.ArgSchema{
+			"id":      requiredString,
+			"version": {Type: plugin.ArgInteger, Required: true},
+		}},
+		"update": {Args: map[string]plugin.ArgSchema{
+			"id":          requiredString,
+			"title":       optionalString,
+			"username":    optionalString,
+			"password":    optionalString,
+			"url":         optionalString,
+			"description": optionalString,
+			"category":    optionalString,
+			"folder":      optionalString,
+			"favorite":    {Type: plugin.ArgBool},
+			"notes":       optionalString,
+		}},
+		"list": {Args: listArgs(nil)},
+		"search": {Args: listArgs(map[string]plugin.ArgSchema{
+			"query":    optionalString,
+			"category": optionalString,
+			"tags":     {Type: plugin.ArgAny},
+		})},
+		"list_folders": {},
+		"backup_now":   {},
+		"list_backups": {},
+		"restore": {Args: map[string]plugin.ArgSchema{
+			"backup":          {Type: plugin.ArgString, Required: true, Description: "备份目录中的文件名"},
+			"master_password": {Type: plugin.ArgString, Description: "备份时的主密码，与当前主密码相同时可省略"},
+		}},
+		"add_attachment": {Args: map[string]plugin.ArgSchema{
+			"id":           requiredString,
+			"name":         requiredString,
+			"data":         {Type: plugin.ArgString, Required: true, Description: "base64 编码的文件内容"},
+			"content_type": optionalString,
+		}},
+		"get_attachment": {Args: map[string]plugin.ArgSchema{
+			"id":            requiredString,
+			"attachment_id": requiredString,
+		}},
+		"delete_attachment": {Args: map[string]plugin.ArgSchema{
+			"id":            requiredString,
+			"attachment_id": requiredString,
+		}},
+		"rename_folder": {Args: map[string]plugin.ArgSchema{
+			"from": requiredString,
+			"to":   {Type: plugin.ArgString, Default: "", Description: "为空时移动到根目录"},
+		}},
+		"generate": {Args: map[string]plugin.ArgSchema{
+			"length":            {Type: plugin.ArgInteger, Default: 16.0},
+			"include_uppercase": {Type: plugin.ArgBool},
+			"include_lowercase": {Type: plugin.ArgBool},
+			"include_numbers":   {Type: plugin.ArgBool},
+			"include_symbols":   {Type: plugin.ArgBool},
+		}},
+		"check_strength": {Args: map[string]plugin.ArgSchema{"password": requiredString}},
+		"share": {Args: map[string]plugin.ArgSchema{
+			"id":                    requiredString,
+			"recipient":             requiredString,
+			"recipient_key":         {Type: plugin.ArgString, Description: "接收方分享公钥（base64）"},
+			"recipient_fingerprint": {Type: plugin.ArgString, Description: "接收方公钥指纹（share_key 返回），用于核对从服务器查询的公钥"},
+			"expires_in":            {Type: plugin.ArgString, Default: "24h"},
+			"one_time":              {Type: plugin.ArgBool, Default: false},
+		}},
+		"receive_share": {Args: map[string]plugin.ArgSchema{
+			"share_id": requiredString,
+			"save":     {Type: plugin.ArgBool, Default: false},
+		}},
+		"revoke_share": {Args: map[string]plugin.ArgSchema{"share_id": requiredString}},
+		"export":       {Args: map[string]plugin.ArgSchema{"format": dataFormat}},
+		"import": {Args: map[string]plugin.ArgSchema{
+			"data":         requiredString,
+			"format":       dataFormat,
+			"on_duplicate": {Type: plugin.ArgString, Default: DuplicateSkip, Enum: duplicatePolicies},
+			"mapping":      {Type: plugin.ArgAny, Description: "CSV 列映射：条目字段 → 列名"},
+		}},
+	}
+)
+
+// listArgs 在 args 中加入 list 和 search 共用的过滤、排序和分页参数
+func listArgs(args map[string]plugin.ArgSchema) map[string]plugin.ArgSchema {
+	if args == nil {
+		args = make(map[string]plugin.ArgSchema)
+	}
+	args["folder"] = plugin.ArgSchema{Type: plugin.ArgString, Description: "只返回该文件夹下的条目"}
+	args["recursive"] = plugin.ArgSchema{Type: plugin.ArgBool, Default: true, Description: "是否包含子文件夹"}
+	args["favorite"] = plugin.ArgSchema{Type: plugin.ArgBool, Description: "按收藏过滤"}
+	args["sort"] = plugin.ArgSchema{Type: plugin.ArgString, Default: SortTitle, Enum: sortFields}
+	args["order"] = plugin.ArgSchema{Type: plugin.ArgString, Default: "asc", Enum: sortOrders}
+	args["limit"] = plugin.ArgSchema{Type: plugin.ArgInteger, Default: float64(defaultPageSize)}
+	args["offset"] = plugin.ArgSchema{Type: plugin.ArgInteger, Default: 0.0}
+	return args
+}
+
 // HandleEvent 处理事件
 func (p *PasswordPlugin) HandleEvent(eventType string, data map[string]interface{}) error {
 	switch eventType {
@@ -202,6 +443,12 @@ func (p *PasswordPlugin) Status() *plugin.PluginStatus {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
+	p.status.Metrics["locked"] = p.masterKey == nil
+	p.backupMu.Lock()
+	if !p.lastBackup.IsZero() {
+		p.status.Metrics["last_backup"] = p.lastBackup
+	}
+	p.backupMu.Unlock()
 	p.status.Metrics["total_passwords"] = len(p.passwords)
 
 	weakCount := 0
@@ -254,6 +501,9 @@ func (p *PasswordPlugin) handleAdd(args map[string]interface{}) (interface{}, er
 	url, _ := args["url"].(string)
 	description, _ := args["description"].(string)
 	category, _ := args["category"].(string)
+	notes, _ := args["notes"].(string)
+	folder, _ := args["folder"].(string)
+	favorite, _ := args["favorite"].(bool)
 
 	// 生成密码ID
 	id := p.generateID()
@@ -267,11 +517,13 @@ func (p *PasswordPlugin) handleAdd(args map[string]interface{}) (interface{}, er
 		URL:         url,
 		Description: description,
 		Category:    category,
+		Folder:      normalizeFolder(folder),
+		Favorite:    favorite,
 		Tags:        p.parseTags(args["tags"]),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 		Strength:    p.calculatePasswordStrength(password),
-		Notes:       args["notes"].(string),
+		Notes:       notes,
 	}
 
 	// 设置过期时间
@@ -307,18 +559,21 @@ func (p *PasswordPlugin) handleGet(args map[string]interface{}) (interface{}, er
 		return nil, fmt.Errorf("id is required")
 	}
 
-	p.mu.RLock()
+	p.mu.Lock()
 	entry, exists := p.passwords[id]
-	p.mu.RUnlock()
-
 	if !exists {
+		p.mu.Unlock()
 		return nil, fmt.Errorf("password not found")
 	}
 
-	// 更新最后使用时间
+	// 更新最后使用时间，返回副本，锁定密码库时清零条目不影响已返回的结果
 	entry.LastUsed = time.Now()
+	result := *entry
+	result.History = nil
+	result.Attachments = publicAttachments(entry.Attachments)
+	p.mu.Unlock()
 
-	return entry, nil
+	return &result, nil
 }
 
 // handleUpdate 处理更新密码命令
@@ -328,6 +583,8 @@ func (p *PasswordPlugin) handleUpdate(args map[string]interface{}) (interface{},
 		return nil, fmt.Errorf("id is required")
 	}
 
+	now := time.Now()
+
 	p.mu.Lock()
 	entry, exists := p.passwords[id]
 	if !exists {
@@ -335,6 +592,14 @@ func (p *PasswordPlugin) handleUpdate(args map[string]interface{}) (interface{},
 		return nil, fmt.Errorf("password not found")
 	}
 
+	// 先更新密码，违反重复使用策略时不修改其他字段
+	if password, ok := args["password"].(string); ok {
+		if err := p.setPasswordLocked(entry, password, now, true); err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+	}
+
 	// 更新字段
 	if title, ok := args["title"].(string); ok {
 		entry.Title = title
@@ -342,10 +607,6 @@ func (p *PasswordPlugin) handleUpdate(args map[string]interface{}) (interface{},
 	if username, ok := args["username"].(string); ok {
 		entry.Username = username
 	}
-	if password, ok := args["password"].(string); ok {
-		entry.Password = password
-		entry.Strength = p.calculatePasswordStrength(password)
-	}
 	if url, ok := args["url"].(string); ok {
 		entry.URL = url
 	}
@@ -358,8 +619,14 @@ func (p *PasswordPlugin) handleUpdate(args map[string]interface{}) (interface{},
 	if notes, ok := args["notes"].(string); ok {
 		entry.Notes = notes
 	}
+	if folder, ok := args["folder"].(string); ok {
+		entry.Folder = normalizeFolder(folder)
+	}
+	if favorite, ok := args["favorite"].(bool); ok {
+		entry.Favorite = favorite
+	}
 
-	entry.UpdatedAt = time.Now()
+	entry.UpdatedAt = now
 	p.mu.Unlock()
 
 	// 保存到文件
@@ -392,10 +659,13 @@ func (p *PasswordPlugin) handleDelete(args map[string]interface{}) (interface{},
 	delete(p.passwords, id)
 	p.mu.Unlock()
 
-	// 保存到文件
+	// 保存到文件，保存成功后删除附件文件
 	if err := p.savePasswords(); err != nil {
 		p.ctx.Logger.Errorf("Failed to save passwords: %v", err)
+	} else {
+		p.removeAttachmentFiles(entry.Attachments)
 	}
+	zeroAttachments(entry.Attachments)
 
 	p.ctx.Logger.Infof("Password deleted: %s", entry.Title)
 
@@ -405,63 +675,39 @@ func (p *PasswordPlugin) handleDelete(args map[string]interface{}) (interface{},
 	}, nil
 }
 
-// handleList 处理列表命令
+// handleList 处理列表命令，支持按文件夹和收藏过滤、排序和分页
 func (p *PasswordPlugin) handleList(args map[string]interface{}) (interface{}, error) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
-	entries := make([]*PasswordEntry, 0, len(p.passwords))
-	for _, entry := range p.passwords {
-		// 不返回实际密码
-		safeEntry := *entry
-		safeEntry.Password = "***"
-		entries = append(entries, &safeEntry)
+	opts, err := parseListOptions(args)
+	if err != nil {
+		return nil, err
 	}
-
-	return map[string]interface{}{
-		"passwords": entries,
-		"count":     len(entries),
-	}, nil
+	return p.queryEntries("passwords", opts, nil), nil
 }
 
-// handleSearch 处理搜索命令
+// handleSearch 处理搜索命令，过滤、排序和分页参数与 list 相同
 func (p *PasswordPlugin) handleSearch(args map[string]interface{}) (interface{}, error) {
 	query, _ := args["query"].(string)
 	category, _ := args["category"].(string)
 	tags := p.parseTags(args["tags"])
 
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	opts, err := parseListOptions(args)
+	if err != nil {
+		return nil, err
+	}
 
-	var results []*PasswordEntry
-	for _, entry := range p.passwords {
+	return p.queryEntries("results", opts, func(entry *PasswordEntry) bool {
 		// 检查查询条件
-		if query != "" {
-			if !p.matchesQuery(entry, query) {
-				continue
-			}
+		if query != "" && !p.matchesQuery(entry, query) {
+			return false
 		}
-
 		if category != "" && entry.Category != category {
-			continue
+			return false
 		}
-
-		if len(tags) > 0 {
-			if !p.matchesTags(entry, tags) {
-				continue
-			}
+		if len(tags) > 0 && !p.matchesTags(entry, tags) {
+			return false
 		}
-
-		// 不返回实际密码
-		safeEntry := *entry
-		safeEntry.Password = "***"
-		results = append(results, &safeEntry)
-	}
-
-	return map[string]interface{}{
-		"results": results,
-		"count":   len(results),
-	}, nil
+		return true
+	}), nil
 }
 
 // handleGenerate 处理生成密码命令
@@ -503,25 +749,33 @@ func (p *PasswordPlugin) handleCheckStrength(args map[string]interface{}) (inter
 }
 
 // handleExport 处理导出命令
+// json 格式使用主密钥加密后 base64 编码，其他格式返回明文，用于迁移到其他密码管理器
 func (p *PasswordPlugin) handleExport(args map[string]interface{}) (interface{}, error) {
 	format, _ := args["format"].(string)
 	if format == "" {
-		format = "json"
+		format = FormatJSON
 	}
 
 	p.mu.RLock()
 	entries := make([]*PasswordEntry, 0, len(p.passwords))
 	for _, entry := range p.passwords {
-		entries = append(entries, entry)
+		// 附件文件不随导出迁移
+		copied := *entry
+		copied.Attachments = nil
+		entries = append(entries, &copied)
 	}
 	p.mu.RUnlock()
 
-	var data []byte
+	var text string
 	var err error
 
 	switch format {
-	case "json":
-		data, err = json.MarshalIndent(entries, "", "  ")
+	case FormatJSON:
+		text, err = p.exportEncrypted(entries)
+	case FormatKeePassXML:
+		text, err = encodeKeePassXML(entries)
+	case FormatBitwardenCSV, FormatLastPassCSV:
+		text, err = encodeCSV(entries, csvLayouts[format])
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
@@ -529,47 +783,93 @@ func (p *PasswordPlugin) handleExport(args map[string]interface{}) (interface{},
 	if err != nil {
 		return nil, err
 	}
-
-	// 加密导出数据
-	encryptedData, err := p.encrypt(data)
-	if err != nil {
-		return nil, err
+	if format != FormatJSON {
+		p.ctx.Logger.Warnf("Password vault exported in plaintext format %s", format)
 	}
 
 	return map[string]interface{}{
-		"data":   base64.StdEncoding.EncodeToString(encryptedData),
+		"data":   text,
 		"format": format,
 		"count":  len(entries),
 	}, nil
 }
 
-// handleImport 处理导入命令
-func (p *PasswordPlugin) handleImport(args map[string]interface{}) (interface{}, error) {
-	data, ok := args["data"].(string)
-	if !ok {
-		return nil, fmt.Errorf("data is required")
+// exportEncrypted 导出为主密钥加密的 JSON
+func (p *PasswordPlugin) exportEncrypted(entries []*PasswordEntry) (string, error) {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return "", err
 	}
 
-	format, _ := args["format"].(string)
-	if format == "" {
-		format = "json"
+	// 加密导出数据
+	key, err := p.currentKey()
+	if err != nil {
+		return "", err
 	}
+	encryptedData, err := encrypt(key, data)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encryptedData), nil
+}
 
-	// 解密数据
+// importEncrypted 导入主密钥加密的 JSON
+func (p *PasswordPlugin) importEncrypted(data string) ([]*PasswordEntry, error) {
 	encryptedData, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedData, err := p.decrypt(encryptedData)
+	key, err := p.currentKey()
 	if err != nil {
 		return nil, err
 	}
+	decryptedData, err := decrypt(key, encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*PasswordEntry
+	if err := json.Unmarshal(decryptedData, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// handleImport 处理导入命令
+// on_duplicate 决定与已有条目重复时跳过、更新还是作为新条目导入，CSV 格式可通过 mapping 指定列名
+func (p *PasswordPlugin) handleImport(args map[string]interface{}) (interface{}, error) {
+	data, ok := args["data"].(string)
+	if !ok {
+		return nil, fmt.Errorf("data is required")
+	}
+
+	format, _ := args["format"].(string)
+	if format == "" {
+		format = FormatJSON
+	}
+	policy, _ := args["on_duplicate"].(string)
+	if policy == "" {
+		policy = DuplicateSkip
+	}
+	if !containsString(duplicatePolicies, policy) {
+		return nil, fmt.Errorf("invalid on_duplicate: %s", policy)
+	}
 
 	var entries []*PasswordEntry
+	var err error
+
 	switch format {
-	case "json":
-		err = json.Unmarshal(decryptedData, &entries)
+	case FormatJSON:
+		entries, err = p.importEncrypted(data)
+	case FormatKeePassXML:
+		entries, err = decodeKeePassXML(data)
+	case FormatBitwardenCSV, FormatLastPassCSV:
+		var columns map[string]string
+		columns, err = parseMapping(csvLayouts[format], args["mapping"])
+		if err == nil {
+			entries, err = decodeCSV(data, columns)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
@@ -578,117 +878,119 @@ func (p *PasswordPlugin) handleImport(args map[string]interface{}) (interface{},
 		return nil, err
 	}
 
-	// 导入密码
-	imported := 0
-	for _, entry := range entries {
-		if entry.ID == "" {
-			entry.ID = p.generateID()
-		}
-		if entry.CreatedAt.IsZero() {
-			entry.CreatedAt = time.Now()
-		}
-		entry.UpdatedAt = time.Now()
-
-		p.mu.Lock()
-		p.passwords[entry.ID] = entry
-		p.mu.Unlock()
-		imported++
-	}
+	result := p.importEntries(entries, policy)
 
 	// 保存到文件
 	if err := p.savePasswords(); err != nil {
 		p.ctx.Logger.Errorf("Failed to save imported passwords: %v", err)
 	}
 
-	return map[string]interface{}{
-		"imported": imported,
-		"message":  "Import completed successfully",
-	}, nil
+	p.ctx.Logger.Infof("Imported %d passwords from %s (%d updated, %d duplicates skipped)",
+		result["imported"], format, result["updated"], result["skipped"])
+	result["format"] = format
+	result["message"] = "Import completed successfully"
+	return result, nil
 }
 
-// 辅助方法
-
-// initializeMasterKey 初始化主密钥
-func (p *PasswordPlugin) initializeMasterKey() error {
-	// 从配置或环境变量获取主密码
-	masterPassword := p.config["master_password"].(string)
-	if masterPassword == "" {
-		masterPassword = os.Getenv("PASSWORD_MASTER_KEY")
-	}
-
-	if masterPassword == "" {
-		// 生成随机主密钥
-		key := make([]byte, 32)
-		if _, err := rand.Read(key); err != nil {
-			return err
-		}
-		p.masterKey = key
-	} else {
-		// 从密码派生密钥
-		salt := []byte("assistant_agent_salt")
-		p.masterKey = pbkdf2.Key([]byte(masterPassword), salt, 10000, 32, sha256.New)
-	}
+// importEntries 将条目加入密码库，按 policy 处理 ID 相同或标题、用户名和 URL 都相同的重复条目
+func (p *PasswordPlugin) importEntries(entries []*PasswordEntry, policy string) map[string]interface{} {
+	now := time.Now()
 
-	return nil
-}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-// loadPasswords 加载密码数据
-func (p *PasswordPlugin) loadPasswords() error {
-	if !p.ctx.Agent.FileExists(p.dataFile) {
-		return nil
+	existing := make(map[string]*PasswordEntry, len(p.passwords))
+	for _, entry := range p.passwords {
+		existing[duplicateKey(entry)] = entry
 	}
 
-	data, err := p.ctx.Agent.ReadFile(p.dataFile)
-	if err != nil {
-		return err
-	}
+	imported, updated := 0, 0
+	duplicates := make([]string, 0)
+	for _, entry := range entries {
+		if entry.Title == "" {
+			entry.Title = entry.URL
+		}
+		// 附件文件只存在于本地，导入的条目不带附件
+		entry.Attachments = nil
+		duplicate := p.passwords[entry.ID]
+		if duplicate == nil {
+			duplicate = existing[duplicateKey(entry)]
+		}
 
-	// 解密数据
-	decryptedData, err := p.decrypt(data)
-	if err != nil {
-		return err
-	}
+		if duplicate != nil {
+			switch policy {
+			case DuplicateSkip:
+				duplicates = append(duplicates, entry.Title)
+				continue
+			case DuplicateOverwrite:
+				// 保留已有条目的历史，原密码加入历史
+				password := entry.Password
+				entry.ID = duplicate.ID
+				entry.CreatedAt = duplicate.CreatedAt
+				entry.Password = duplicate.Password
+				entry.PasswordVersion = duplicate.PasswordVersion
+				entry.History = duplicate.History
+				entry.Attachments = duplicate.Attachments
+				p.setPasswordLocked(entry, password, now, false)
+				updated++
+			case DuplicateKeep:
+				entry.ID = ""
+			}
+		}
 
-	var entries []*PasswordEntry
-	if err := json.Unmarshal(decryptedData, &entries); err != nil {
-		return err
-	}
+		if entry.ID == "" {
+			entry.ID = p.generateID()
+		}
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = now
+		}
+		entry.UpdatedAt = now
+		entry.Strength = p.calculatePasswordStrength(entry.Password)
 
-	p.mu.Lock()
-	for _, entry := range entries {
 		p.passwords[entry.ID] = entry
+		existing[duplicateKey(entry)] = entry
+		if duplicate == nil || policy == DuplicateKeep {
+			imported++
+		}
 	}
-	p.mu.Unlock()
 
-	return nil
+	return map[string]interface{}{
+		"imported":   imported,
+		"updated":    updated,
+		"skipped":    len(duplicates),
+		"duplicates": duplicates,
+	}
 }
 
+// 辅助方法
+
 // savePasswords 保存密码数据
 func (p *PasswordPlugin) savePasswords() error {
-	p.mu.RLock()
-	entries := make([]*PasswordEntry, 0, len(p.passwords))
-	for _, entry := range p.passwords {
-		entries = append(entries, entry)
-	}
-	p.mu.RUnlock()
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
 
-	data, err := json.Marshal(entries)
+	// 每个条目用各自的数据密钥加密
+	p.mu.Lock()
+	data, err := p.sealVaultLocked()
+	p.mu.Unlock()
 	if err != nil {
 		return err
 	}
 
-	// 加密数据
-	encryptedData, err := p.encrypt(data)
-	if err != nil {
-		return err
-	}
+	return p.writeFile(p.dataFile, data)
+}
 
-	return p.ctx.Agent.WriteFile(p.dataFile, encryptedData)
+// writeFile 通过 Agent 文件接口原子地写入文件（权限 0600），保存到一半崩溃时原文件保持完整
+func (p *PasswordPlugin) writeFile(path string, data []byte) error {
+	return fsutil.WriteAtomic(p.files, path, 0600, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
 }
 
-// encrypt 加密数据
-func (p *PasswordPlugin) encrypt(data []byte) ([]byte, error) {
-	block, err := aes.NewCipher(p.masterKey)
+// encrypt 使用密钥加密数据
+func encrypt(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -706,9 +1008,9 @@ func (p *PasswordPlugin) encrypt(data []byte) ([]byte, error) {
 	return gcm.Seal(nonce, nonce, data, nil), nil
 }
 
-// decrypt 解密数据
-func (p *PasswordPlugin) decrypt(data []byte) ([]byte, error) {
-	block, err := aes.NewCipher(p.masterKey)
+// decrypt 使用密钥解密数据
+func decrypt(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -920,7 +1222,7 @@ func (p *PasswordPlugin) matchesTags(entry *PasswordEntry, tags []string) bool {
 }
 
 // backgroundTask 后台任务
-func (p *PasswordPlugin) backgroundTask() {
+func (p *PasswordPlugin) backgroundTask(stop <-chan struct{}) {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
 
@@ -929,7 +1231,7 @@ func (p *PasswordPlugin) backgroundTask() {
 		case <-ticker.C:
 			// 检查过期密码
 			p.checkExpiredPasswords()
-		case <-p.stopChan:
+		case <-stop:
 			return
 		}
 	}
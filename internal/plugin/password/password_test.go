@@ -0,0 +1,946 @@
+package password
+
+import (
+	"crypto/ecdh"
+	crypto_rand "crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/plugin/plugintest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPlugin 创建使用模拟 Agent 初始化的密码管理插件
+func newTestPlugin(t *testing.T, agent *plugintest.Agent, config map[string]interface{}) *PasswordPlugin {
+	return plugintest.InitPlugin(t, NewPasswordPlugin(), agent, config)
+}
+
+func TestPasswordPluginStartsLocked(t *testing.T) {
+	t.Setenv("PASSWORD_MASTER_KEY", "")
+	p := newTestPlugin(t, &plugintest.Agent{}, nil)
+
+	for _, command := range []string{"list", "get", "search", "export"} {
+		_, err := p.HandleCommand(command, map[string]interface{}{"id": "x"})
+		assert.ErrorIs(t, err, errVaultLocked, command)
+	}
+
+	// 不访问密码库的命令在锁定时可用
+	_, err := p.HandleCommand("generate", map[string]interface{}{"length": 12.0})
+	assert.NoError(t, err)
+	assert.True(t, p.Status().Metrics["locked"].(bool))
+}
+
+func TestPasswordPluginVaultWrittenAtomically(t *testing.T) {
+	t.Setenv("PASSWORD_MASTER_KEY", "")
+	p := newTestPlugin(t, &plugintest.Agent{}, nil)
+	_, err := p.HandleCommand("unlock", map[string]interface{}{"master_password": "secret"})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("add", map[string]interface{}{"title": "db", "password": "p@ss"})
+	require.NoError(t, err)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(p.dataFile)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	saved, err := os.ReadFile(p.dataFile)
+	require.NoError(t, err)
+
+	// 写入失败时原密码库保持完整
+	require.NoError(t, os.Mkdir(p.dataFile+".tmp", 0700))
+	_, err = p.HandleCommand("add", map[string]interface{}{"title": "web", "password": "x"})
+	require.NoError(t, err)
+	assert.Error(t, p.savePasswords())
+	current, err := os.ReadFile(p.dataFile)
+	require.NoError(t, err)
+	assert.Equal(t, saved, current)
+}
+
+func TestPasswordPluginUnlockLock(t *testing.T) {
+	t.Setenv("PASSWORD_MASTER_KEY", "")
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+
+	// 密码库不存在时首次解锁设置主密码
+	_, err := p.HandleCommand("unlock", map[string]interface{}{"master_password": "secret"})
+	require.NoError(t, err)
+
+	result, err := p.HandleCommand("add", map[string]interface{}{"title": "db", "password": "p@ss"})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+
+	p.mu.RLock()
+	entry := p.passwords[id]
+	key := p.masterKey
+	p.mu.RUnlock()
+
+	_, err = p.HandleCommand("lock", nil)
+	require.NoError(t, err)
+	_, err = p.HandleCommand("get", map[string]interface{}{"id": id})
+	assert.ErrorIs(t, err, errVaultLocked)
+
+	// 锁定后主密钥和条目被清零
+	assert.Equal(t, make([]byte, len(key)), key)
+	assert.Empty(t, entry.Password)
+	assert.Empty(t, p.passwords)
+	assert.NotEmpty(t, agent.Events("password_vault_locked"))
+
+	_, err = p.HandleCommand("unlock", map[string]interface{}{"master_password": "wrong"})
+	assert.Error(t, err)
+
+	result, err = p.HandleCommand("unlock", map[string]interface{}{"master_password": "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["count"])
+
+	result, err = p.HandleCommand("get", map[string]interface{}{"id": id})
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss", result.(*PasswordEntry).Password)
+}
+
+func TestPasswordPluginConfiguredMasterPassword(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret"})
+	_, err := p.HandleCommand("add", map[string]interface{}{"title": "db", "password": "p@ss"})
+	require.NoError(t, err)
+
+	// 主密码不正确时保持锁定
+	p = newTestPlugin(t, agent, map[string]interface{}{"master_password": "wrong"})
+	_, err = p.HandleCommand("list", nil)
+	assert.ErrorIs(t, err, errVaultLocked)
+
+	p = newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret"})
+	result, err := p.HandleCommand("list", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["count"])
+}
+
+func TestPasswordPluginAutoLock(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{
+		"master_password": "secret",
+		"auto_lock":       "true",
+		"lock_timeout":    1,
+	})
+	assert.False(t, p.isLocked())
+
+	assert.Eventually(t, p.isLocked, 3*time.Second, 50*time.Millisecond)
+	_, err := p.HandleCommand("list", nil)
+	assert.ErrorIs(t, err, errVaultLocked)
+}
+
+func TestPasswordPluginAutoLockDisabled(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{
+		"master_password": "secret",
+		"auto_lock":       false,
+		"lock_timeout":    1,
+	})
+
+	time.Sleep(1500 * time.Millisecond)
+	assert.False(t, p.isLocked())
+}
+
+// readVaultFile 读取密码库文件
+func readVaultFile(t *testing.T, p *PasswordPlugin) vaultFile {
+	data, err := os.ReadFile(p.dataFile)
+	require.NoError(t, err)
+	var file vaultFile
+	require.NoError(t, json.Unmarshal(data, &file))
+	return file
+}
+
+func TestPasswordPluginPerEntryEncryption(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+	for _, title := range []string{"db", "mail"} {
+		_, err := p.HandleCommand("add", map[string]interface{}{"title": title, "password": "p@ss"})
+		require.NoError(t, err)
+	}
+
+	file := readVaultFile(t, p)
+	assert.Equal(t, vaultVersion, file.Version)
+	assert.Equal(t, "argon2id", file.KDF.Algorithm)
+	require.Len(t, file.Entries, 2)
+	assert.NotEqual(t, file.Entries[0].Key, file.Entries[1].Key)
+
+	// 每个密码库使用随机盐
+	other := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+	require.NoError(t, other.savePasswords())
+	assert.NotEqual(t, file.KDF.Salt, readVaultFile(t, other).KDF.Salt)
+}
+
+func TestPasswordPluginLegacyVaultMigration(t *testing.T) {
+	agent := &plugintest.Agent{DataDir: t.TempDir()}
+	entries, err := json.Marshal([]*PasswordEntry{{ID: "legacy", Title: "db", Password: "p@ss"}})
+	require.NoError(t, err)
+	data, err := encrypt(legacyKey("secret"), entries)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(agent.DataDir, "passwords.enc"), data, 0600))
+
+	p := newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret"})
+	result, err := p.HandleCommand("get", map[string]interface{}{"id": "legacy"})
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss", result.(*PasswordEntry).Password)
+	assert.Equal(t, vaultVersion, readVaultFile(t, p).Version)
+
+	p = newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret"})
+	_, err = p.HandleCommand("get", map[string]interface{}{"id": "legacy"})
+	assert.NoError(t, err)
+}
+
+func TestPasswordPluginRotateMasterKey(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret"})
+	result, err := p.HandleCommand("add", map[string]interface{}{"title": "db", "password": "p@ss"})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+	before := readVaultFile(t, p)
+	dataKey := append([]byte(nil), p.dataKeys[id]...)
+
+	_, err = p.HandleCommand("rotate_master_key", map[string]interface{}{
+		"current_password": "wrong",
+		"new_password":     "changed",
+	})
+	assert.Error(t, err)
+
+	_, err = p.HandleCommand("rotate_master_key", map[string]interface{}{
+		"current_password": "secret",
+		"new_password":     "changed",
+	})
+	require.NoError(t, err)
+
+	after := readVaultFile(t, p)
+	assert.NotEqual(t, before.KDF.Salt, after.KDF.Salt)
+	// 数据密钥不变，由新主密钥重新加密
+	assert.Equal(t, dataKey, p.dataKeys[id])
+	unwrapped, err := decrypt(p.masterKey, after.Entries[0].Key)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	_, err = p.HandleCommand("rotate_master_key", map[string]interface{}{
+		"current_password": "changed",
+		"new_password":     "changed",
+		"rotate_data_keys": true,
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, dataKey, p.dataKeys[id])
+
+	// 旧主密码不能再解锁
+	p.lock("test")
+	_, err = p.HandleCommand("unlock", map[string]interface{}{"master_password": "secret"})
+	assert.Error(t, err)
+
+	p = newTestPlugin(t, agent, map[string]interface{}{"master_password": "changed"})
+	result, err = p.HandleCommand("get", map[string]interface{}{"id": id})
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss", result.(*PasswordEntry).Password)
+}
+
+const keepassXML = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Meta>
+		<Generator>KeePass</Generator>
+		<RecycleBinEnabled>True</RecycleBinEnabled>
+		<RecycleBinUUID>cmVjeWNsZWJpbjAwMDAwMA==</RecycleBinUUID>
+	</Meta>
+	<Root>
+		<Group>
+			<UUID>cm9vdDAwMDAwMDAwMDAwMA==</UUID>
+			<Name>Database</Name>
+			<Group>
+				<UUID>d29yazAwMDAwMDAwMDAwMA==</UUID>
+				<Name>Work</Name>
+				<Group>
+					<UUID>c2VydmVyczAwMDAwMDAwMA==</UUID>
+					<Name>Servers</Name>
+					<Entry>
+						<UUID>ZW50cnkwMDAwMDAwMDAwMA==</UUID>
+						<Tags>prod;db</Tags>
+						<Times>
+							<CreationTime>2023-01-02T03:04:05Z</CreationTime>
+							<ExpiryTime>2030-01-01T00:00:00Z</ExpiryTime>
+							<Expires>True</Expires>
+						</Times>
+						<String><Key>Title</Key><Value>db01</Value></String>
+						<String><Key>UserName</Key><Value>admin</Value></String>
+						<String><Key>Password</Key><Value ProtectInMemory="True">s3cret!</Value></String>
+						<String><Key>URL</Key><Value>ssh://db01</Value></String>
+						<String><Key>Notes</Key><Value>primary</Value></String>
+						<String><Key>Port</Key><Value>2222</Value></String>
+					</Entry>
+				</Group>
+			</Group>
+			<Group>
+				<UUID>cmVjeWNsZWJpbjAwMDAwMA==</UUID>
+				<Name>Recycle Bin</Name>
+				<Entry>
+					<UUID>ZGVsZXRlZDAwMDAwMDAwMA==</UUID>
+					<Times><Expires>False</Expires></Times>
+					<String><Key>Title</Key><Value>deleted</Value></String>
+				</Entry>
+			</Group>
+		</Group>
+	</Root>
+</KeePassFile>`
+
+// findEntry 按标题查找条目
+func findEntry(p *PasswordPlugin, title string) *PasswordEntry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, entry := range p.passwords {
+		if entry.Title == title {
+			return entry
+		}
+	}
+	return nil
+}
+
+func TestPasswordPluginImportKeePassXML(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+
+	result, err := p.HandleCommand("import", map[string]interface{}{"data": keepassXML, "format": FormatKeePassXML})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["imported"])
+
+	entry := findEntry(p, "db01")
+	require.NotNil(t, entry)
+	assert.Equal(t, "admin", entry.Username)
+	assert.Equal(t, "s3cret!", entry.Password)
+	assert.Equal(t, "ssh://db01", entry.URL)
+	assert.Equal(t, "Work/Servers", entry.Folder)
+	assert.Equal(t, []string{"prod", "db"}, entry.Tags)
+	assert.Equal(t, "primary\nPort: 2222", entry.Notes)
+	assert.Equal(t, 2030, entry.ExpiresAt.Year())
+	assert.Nil(t, findEntry(p, "deleted"))
+
+	// 导出后可以重新导入
+	exported, err := p.HandleCommand("export", map[string]interface{}{"format": FormatKeePassXML})
+	require.NoError(t, err)
+	entries, err := decodeKeePassXML(exported.(map[string]interface{})["data"].(string))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Work/Servers", entries[0].Folder)
+	assert.Equal(t, "s3cret!", entries[0].Password)
+}
+
+func TestPasswordPluginImportCSV(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+
+	bitwarden := "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+		"Work,1,login,mail,\"multi\nline\",,0,https://mail.example.com,alice,pw1,\n"
+	_, err := p.HandleCommand("import", map[string]interface{}{"data": bitwarden, "format": FormatBitwardenCSV})
+	require.NoError(t, err)
+	entry := findEntry(p, "mail")
+	require.NotNil(t, entry)
+	assert.Equal(t, "Work", entry.Folder)
+	assert.True(t, entry.Favorite)
+	assert.Equal(t, "multi\nline", entry.Notes)
+	assert.Equal(t, "pw1", entry.Password)
+
+	// 自定义列映射
+	lastpass := "url,username,password,totp,extra,name,grouping,fav,comment\n" +
+		"https://git.example.com,bob,pw2,,,git,Dev,0,team account\n"
+	_, err = p.HandleCommand("import", map[string]interface{}{
+		"data":    lastpass,
+		"format":  FormatLastPassCSV,
+		"mapping": map[string]interface{}{"description": "comment"},
+	})
+	require.NoError(t, err)
+	entry = findEntry(p, "git")
+	require.NotNil(t, entry)
+	assert.Equal(t, "bob", entry.Username)
+	assert.Equal(t, "team account", entry.Description)
+
+	exported, err := p.HandleCommand("export", map[string]interface{}{"format": FormatBitwardenCSV})
+	require.NoError(t, err)
+	entries, err := decodeCSV(exported.(map[string]interface{})["data"].(string), csvLayouts[FormatBitwardenCSV].columns)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	_, err = p.HandleCommand("import", map[string]interface{}{
+		"data":    lastpass,
+		"format":  FormatLastPassCSV,
+		"mapping": map[string]interface{}{"secret": "password"},
+	})
+	assert.Error(t, err)
+}
+
+func TestPasswordPluginListPaging(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+	for i, title := range []string{"delta", "Alpha", "charlie", "bravo", "echo"} {
+		args := map[string]interface{}{"title": title, "password": "p@ss", "category": "web"}
+		if i%2 == 0 {
+			args["category"] = "db"
+			args["favorite"] = true
+		}
+		_, err := p.HandleCommand("add", args)
+		require.NoError(t, err)
+	}
+	titles := func(result interface{}, key string) []string {
+		var titles []string
+		for _, entry := range result.(map[string]interface{})[key].([]*PasswordEntry) {
+			titles = append(titles, entry.Title)
+		}
+		return titles
+	}
+
+	result, err := p.HandleCommand("list", map[string]interface{}{"limit": 2.0, "offset": 1.0})
+	require.NoError(t, err)
+	list := result.(map[string]interface{})
+	assert.Equal(t, []string{"bravo", "charlie"}, titles(result, "passwords"))
+	assert.Equal(t, 5, list["total"])
+	assert.Equal(t, true, list["has_more"])
+	assert.Equal(t, map[string]int{"db": 3, "web": 2}, list["categories"])
+	assert.Equal(t, "***", list["passwords"].([]*PasswordEntry)[0].Password)
+
+	result, err = p.HandleCommand("list", map[string]interface{}{"sort": "title", "order": "desc", "offset": 4.0})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alpha"}, titles(result, "passwords"))
+	assert.Equal(t, false, result.(map[string]interface{})["has_more"])
+
+	result, err = p.HandleCommand("search", map[string]interface{}{"query": "a", "favorite": true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"charlie", "delta"}, titles(result, "results"))
+	assert.Equal(t, map[string]int{"db": 2}, result.(map[string]interface{})["categories"])
+
+	_, err = p.HandleCommand("list", map[string]interface{}{"limit": 0.0})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("list", map[string]interface{}{"sort": "password"})
+	assert.Error(t, err)
+}
+
+func TestPasswordPluginFolders(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+	for title, folder := range map[string]string{"mail": "", "web01": "Work/Servers/", "vpn": " Work ", "bank": "Personal"} {
+		_, err := p.HandleCommand("add", map[string]interface{}{"title": title, "folder": folder})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "Work/Servers", findEntry(p, "web01").Folder)
+	assert.Equal(t, "Work", findEntry(p, "vpn").Folder)
+
+	count := func(args map[string]interface{}) int {
+		result, err := p.HandleCommand("list", args)
+		require.NoError(t, err)
+		return result.(map[string]interface{})["total"].(int)
+	}
+	assert.Equal(t, 2, count(map[string]interface{}{"folder": "Work"}))
+	assert.Equal(t, 1, count(map[string]interface{}{"folder": "Work", "recursive": false}))
+	assert.Equal(t, 1, count(map[string]interface{}{"folder": "", "recursive": false}))
+	assert.Equal(t, 4, count(map[string]interface{}{"folder": "/"}))
+
+	result, err := p.HandleCommand("list_folders", nil)
+	require.NoError(t, err)
+	folders := result.(map[string]interface{})["folders"].([]*folderInfo)
+	require.Len(t, folders, 3)
+	assert.Equal(t, folderInfo{Path: "Work", Count: 1, Total: 2}, *folders[1])
+	assert.Equal(t, folderInfo{Path: "Work/Servers", Count: 1, Total: 1}, *folders[2])
+
+	result, err = p.HandleCommand("rename_folder", map[string]interface{}{"from": "Work", "to": "Archive/Work"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.(map[string]interface{})["moved"])
+	assert.Equal(t, "Archive/Work/Servers", findEntry(p, "web01").Folder)
+
+	_, err = p.HandleCommand("rename_folder", map[string]interface{}{"from": "Archive", "to": "Archive/Old"})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("rename_folder", map[string]interface{}{"from": "Missing", "to": "Other"})
+	assert.Error(t, err)
+}
+
+func TestPasswordPluginAttachments(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{
+		"master_password":      "secret",
+		"attachment_max_size":  16,
+		"attachment_max_count": 2,
+	})
+	result, err := p.HandleCommand("add", map[string]interface{}{"title": "server", "password": "p@ss"})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+
+	content := []byte("-----BEGIN KEY-")
+	result, err = p.HandleCommand("add_attachment", map[string]interface{}{
+		"id":   id,
+		"name": "../id_rsa",
+		"data": base64.StdEncoding.EncodeToString(content),
+	})
+	require.NoError(t, err)
+	attachmentID := result.(map[string]interface{})["attachment_id"].(string)
+
+	// 附件文件加密保存，返回的条目不包含附件密钥
+	sealed, err := os.ReadFile(p.attachmentPath(attachmentID))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), string(content))
+	result, err = p.HandleCommand("get", map[string]interface{}{"id": id})
+	require.NoError(t, err)
+	attachments := result.(*PasswordEntry).Attachments
+	require.Len(t, attachments, 1)
+	assert.Equal(t, "id_rsa", attachments[0].Name)
+	assert.Nil(t, attachments[0].Key)
+
+	// 锁定后重新解锁仍可读取
+	_, err = p.HandleCommand("lock", nil)
+	require.NoError(t, err)
+	_, err = p.HandleCommand("unlock", map[string]interface{}{"master_password": "secret"})
+	require.NoError(t, err)
+	result, err = p.HandleCommand("get_attachment", map[string]interface{}{"id": id, "attachment_id": attachmentID})
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(content), result.(map[string]interface{})["data"])
+
+	// 大小和数量限制
+	_, err = p.HandleCommand("add_attachment", map[string]interface{}{
+		"id":   id,
+		"name": "big",
+		"data": base64.StdEncoding.EncodeToString(make([]byte, 17)),
+	})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("add_attachment", map[string]interface{}{"id": id, "name": "codes", "data": "MTIz"})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("add_attachment", map[string]interface{}{"id": id, "name": "more", "data": "MTIz"})
+	assert.Error(t, err)
+
+	_, err = p.HandleCommand("delete_attachment", map[string]interface{}{"id": id, "attachment_id": attachmentID})
+	require.NoError(t, err)
+	assert.NoFileExists(t, p.attachmentPath(attachmentID))
+	_, err = p.HandleCommand("get_attachment", map[string]interface{}{"id": id, "attachment_id": attachmentID})
+	assert.Error(t, err)
+
+	// 删除条目时删除附件文件
+	remaining := findEntry(p, "server").Attachments[0].ID
+	_, err = p.HandleCommand("delete", map[string]interface{}{"id": id})
+	require.NoError(t, err)
+	assert.NoFileExists(t, p.attachmentPath(remaining))
+}
+
+func TestPasswordPluginAttachmentTampered(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+	result, err := p.HandleCommand("add", map[string]interface{}{"title": "server"})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+	result, err = p.HandleCommand("add_attachment", map[string]interface{}{"id": id, "name": "codes", "data": "MTIz"})
+	require.NoError(t, err)
+	attachmentID := result.(map[string]interface{})["attachment_id"].(string)
+
+	path := p.attachmentPath(attachmentID)
+	sealed, err := os.ReadFile(path)
+	require.NoError(t, err)
+	sealed[len(sealed)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, sealed, 0600))
+
+	_, err = p.HandleCommand("get_attachment", map[string]interface{}{"id": id, "attachment_id": attachmentID})
+	assert.Error(t, err)
+}
+
+func TestPasswordPluginBackupRestore(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{
+		"master_password":   "secret",
+		"backup_upload_dir": "/backups",
+	})
+	result, err := p.HandleCommand("add", map[string]interface{}{"title": "db", "password": "p@ss"})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+	result, err = p.HandleCommand("add_attachment", map[string]interface{}{"id": id, "name": "codes", "data": "MTIz"})
+	require.NoError(t, err)
+	attachmentID := result.(map[string]interface{})["attachment_id"].(string)
+
+	result, err = p.HandleCommand("backup_now", nil)
+	require.NoError(t, err)
+	backup := result.(map[string]interface{})["backup"].(*backupInfo)
+	assert.FileExists(t, backup.Path)
+	assert.NotEmpty(t, agent.Events("file_upload_requested"))
+
+	_, err = p.HandleCommand("delete", map[string]interface{}{"id": id})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("add", map[string]interface{}{"title": "other"})
+	require.NoError(t, err)
+
+	result, err = p.HandleCommand("restore", map[string]interface{}{"backup": backup.Name})
+	require.NoError(t, err)
+	restored := result.(map[string]interface{})
+	assert.Equal(t, 1, restored["count"])
+	assert.NotEmpty(t, restored["previous_backup"])
+	assert.NotNil(t, findEntry(p, "db"))
+	assert.Nil(t, findEntry(p, "other"))
+	result, err = p.HandleCommand("get_attachment", map[string]interface{}{"id": id, "attachment_id": attachmentID})
+	require.NoError(t, err)
+	assert.Equal(t, "MTIz", result.(map[string]interface{})["data"])
+
+	result, err = p.HandleCommand("list_backups", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.(map[string]interface{})["count"])
+
+	// 恢复后的密码库可以用主密码重新解锁
+	p = newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret"})
+	assert.NotNil(t, findEntry(p, "db"))
+}
+
+func TestPasswordPluginRestoreValidation(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret"})
+	_, err := p.HandleCommand("add", map[string]interface{}{"title": "db", "password": "p@ss"})
+	require.NoError(t, err)
+	result, err := p.HandleCommand("backup_now", nil)
+	require.NoError(t, err)
+	backup := result.(map[string]interface{})["backup"].(*backupInfo)
+
+	// 内容被修改的备份不能恢复
+	data, err := os.ReadFile(backup.Path)
+	require.NoError(t, err)
+	var file backupFile
+	require.NoError(t, json.Unmarshal(data, &file))
+	file.Vault[len(file.Vault)-2] ^= 0x01
+	tampered, err := json.Marshal(file)
+	require.NoError(t, err)
+	tamperedPath := filepath.Join(filepath.Dir(backup.Path), backupPrefix+"tampered"+backupSuffix)
+	require.NoError(t, os.WriteFile(tamperedPath, tampered, 0600))
+	_, err = p.HandleCommand("restore", map[string]interface{}{"backup": filepath.Base(tamperedPath)})
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	// 更换主密码后需要提供备份时的主密码
+	_, err = p.HandleCommand("rotate_master_key", map[string]interface{}{"current_password": "secret", "new_password": "new"})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("restore", map[string]interface{}{"backup": backup.Name})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("restore", map[string]interface{}{"backup": backup.Name, "master_password": "wrong"})
+	assert.Error(t, err)
+
+	// 锁定时提供主密码也可以恢复
+	_, err = p.HandleCommand("lock", nil)
+	require.NoError(t, err)
+	_, err = p.HandleCommand("restore", map[string]interface{}{"backup": backup.Name, "master_password": "secret"})
+	require.NoError(t, err)
+	assert.False(t, p.isLocked())
+	_, err = p.HandleCommand("unlock", map[string]interface{}{"master_password": "secret"})
+	assert.NoError(t, err)
+}
+
+func TestPasswordPluginBackupRetention(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{
+		"master_password":  "secret",
+		"backup_retention": 2,
+	})
+	_, err := p.HandleCommand("backup_now", nil)
+	assert.Error(t, err, "vault has not been saved yet")
+
+	_, err = p.HandleCommand("add", map[string]interface{}{"title": "db"})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = p.HandleCommand("backup_now", nil)
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+	backups, err := p.listBackups(p.backupDir())
+	require.NoError(t, err)
+	assert.Len(t, backups, 2)
+
+	// 定时备份在内容未变化时跳过
+	info, err := p.createBackup(true)
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func TestPasswordPluginImportDuplicates(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+	csvData := func(password string) string {
+		return "url,username,password,totp,extra,name,grouping,fav\nhttps://example.com/,alice," + password + ",,,site,,0\n"
+	}
+
+	_, err := p.HandleCommand("import", map[string]interface{}{"data": csvData("old"), "format": FormatLastPassCSV})
+	require.NoError(t, err)
+	id := findEntry(p, "site").ID
+
+	// 默认跳过重复条目，URL 末尾的 / 和大小写不影响判断
+	result, err := p.HandleCommand("import", map[string]interface{}{
+		"data":   strings.Replace(csvData("new"), "https://example.com/", "HTTPS://example.com", 1),
+		"format": FormatLastPassCSV,
+	})
+	require.NoError(t, err)
+	info := result.(map[string]interface{})
+	assert.Equal(t, 0, info["imported"])
+	assert.Equal(t, 1, info["skipped"])
+	assert.Equal(t, "old", findEntry(p, "site").Password)
+
+	result, err = p.HandleCommand("import", map[string]interface{}{
+		"data": csvData("new"), "format": FormatLastPassCSV, "on_duplicate": DuplicateOverwrite,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["updated"])
+	assert.Equal(t, id, findEntry(p, "site").ID)
+	assert.Equal(t, "new", findEntry(p, "site").Password)
+
+	result, err = p.HandleCommand("import", map[string]interface{}{
+		"data": csvData("new"), "format": FormatLastPassCSV, "on_duplicate": DuplicateKeep,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["imported"])
+	assert.Len(t, p.passwords, 2)
+}
+
+func TestPasswordPluginHistory(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret", "history_size": "2"})
+	result, err := p.HandleCommand("add", map[string]interface{}{"title": "db", "password": "v1"})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+
+	for _, password := range []string{"v2", "v3", "v4"} {
+		_, err := p.HandleCommand("update", map[string]interface{}{"id": id, "password": password})
+		require.NoError(t, err)
+	}
+
+	// 只保留最近 history_size 个历史密码，默认不返回明文
+	result, err = p.HandleCommand("get_history", map[string]interface{}{"id": id})
+	require.NoError(t, err)
+	info := result.(map[string]interface{})
+	assert.Equal(t, 4, info["current_version"])
+	history := info["history"].([]PasswordVersion)
+	require.Len(t, history, 2)
+	assert.Equal(t, 3, history[0].Version)
+	assert.Equal(t, "***", history[0].Password)
+
+	result, err = p.HandleCommand("get_history", map[string]interface{}{"id": id, "reveal": true})
+	require.NoError(t, err)
+	assert.Equal(t, "v3", result.(map[string]interface{})["history"].([]PasswordVersion)[0].Password)
+
+	// 列表和 get 不返回历史
+	got, err := p.HandleCommand("get", map[string]interface{}{"id": id})
+	require.NoError(t, err)
+	assert.Empty(t, got.(*PasswordEntry).History)
+
+	result, err = p.HandleCommand("revert", map[string]interface{}{"id": id, "version": float64(2)})
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.(map[string]interface{})["version"])
+	_, err = p.HandleCommand("revert", map[string]interface{}{"id": id, "version": float64(1)})
+	assert.Error(t, err)
+
+	// 历史随密码库加密保存
+	p = newTestPlugin(t, agent, map[string]interface{}{"master_password": "secret"})
+	got, err = p.HandleCommand("get", map[string]interface{}{"id": id})
+	require.NoError(t, err)
+	assert.Equal(t, "v2", got.(*PasswordEntry).Password)
+	result, err = p.HandleCommand("get_history", map[string]interface{}{"id": id, "reveal": true})
+	require.NoError(t, err)
+	assert.Equal(t, "v4", result.(map[string]interface{})["history"].([]PasswordVersion)[0].Password)
+}
+
+func TestPasswordPluginReusePolicy(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"master_password": "secret"})
+	result, err := p.HandleCommand("add", map[string]interface{}{
+		"title":    "vpn",
+		"password": "v1",
+		"tags":     []interface{}{"no-reuse:2"},
+	})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+
+	_, err = p.HandleCommand("update", map[string]interface{}{"id": id, "password": "v2", "title": "vpn2"})
+	require.NoError(t, err)
+
+	// 最近 2 个密码（当前密码和上一个）不能再使用，失败时不修改其他字段
+	_, err = p.HandleCommand("update", map[string]interface{}{"id": id, "password": "v1", "title": "changed"})
+	assert.Error(t, err)
+	assert.Equal(t, "vpn2", findEntry(p, "vpn2").Title)
+	_, err = p.HandleCommand("revert", map[string]interface{}{"id": id, "version": float64(1)})
+	assert.Error(t, err)
+
+	_, err = p.HandleCommand("update", map[string]interface{}{"id": id, "password": "v3"})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("update", map[string]interface{}{"id": id, "password": "v1"})
+	assert.NoError(t, err)
+
+	// 没有标签的条目不受限制
+	result, err = p.HandleCommand("add", map[string]interface{}{"title": "wiki", "password": "w1"})
+	require.NoError(t, err)
+	other := result.(map[string]interface{})["id"].(string)
+	_, err = p.HandleCommand("update", map[string]interface{}{"id": other, "password": "w2"})
+	require.NoError(t, err)
+	_, err = p.HandleCommand("revert", map[string]interface{}{"id": other, "version": float64(1)})
+	assert.NoError(t, err)
+}
+
+// mockShareServer 模拟服务器保存分享公钥和分享，一次性分享获取后删除
+type mockShareServer struct {
+	mu     sync.Mutex
+	keys   map[string]string
+	shares map[string]map[string]interface{}
+}
+
+func newMockShareServer() *mockShareServer {
+	return &mockShareServer{keys: make(map[string]string), shares: make(map[string]map[string]interface{})}
+}
+
+// Handle 实现 plugintest.Server，请求数据按 JSON 编码后处理，与真实传输一致
+func (s *mockShareServer) Handle(agent *plugintest.Agent, msgType string, request interface{}) (interface{}, error) {
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	agentID := agent.ID
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch msgType {
+	case msgSharePublishKey:
+		s.keys[agentID] = data["public_key"].(string)
+		return map[string]interface{}{}, nil
+	case msgShareLookupKey:
+		key, ok := s.keys[data["recipient"].(string)]
+		if !ok {
+			return nil, fmt.Errorf("recipient not found")
+		}
+		return map[string]interface{}{"public_key": key}, nil
+	case msgShare:
+		id := fmt.Sprintf("share-%d", len(s.shares)+1)
+		s.shares[id] = data
+		return map[string]interface{}{"share_id": id}, nil
+	case msgShareFetch:
+		id := data["share_id"].(string)
+		share, ok := s.shares[id]
+		if !ok {
+			return nil, fmt.Errorf("share not found")
+		}
+		if share["one_time"] == true {
+			delete(s.shares, id)
+		}
+		return share, nil
+	case msgShareRevoke:
+		delete(s.shares, data["share_id"].(string))
+		return map[string]interface{}{}, nil
+	}
+	return nil, fmt.Errorf("unknown message type %s", msgType)
+}
+
+func TestPasswordPluginShare(t *testing.T) {
+	server := newMockShareServer()
+	alice := newTestPlugin(t, &plugintest.Agent{ID: "alice", Server: server}, map[string]interface{}{"master_password": "a"})
+	bobAgent := &plugintest.Agent{ID: "bob", Server: server}
+	bob := newTestPlugin(t, bobAgent, map[string]interface{}{"master_password": "b"})
+
+	// 接收方先上报分享公钥，公钥保存在密码库中
+	result, err := bob.HandleCommand("share_key", nil)
+	require.NoError(t, err)
+	assert.True(t, result.(map[string]interface{})["published"].(bool))
+	bob = newTestPlugin(t, bobAgent, map[string]interface{}{"master_password": "b"})
+	again, err := bob.HandleCommand("share_key", nil)
+	require.NoError(t, err)
+	assert.Equal(t, result.(map[string]interface{})["public_key"], again.(map[string]interface{})["public_key"])
+
+	result, err = alice.HandleCommand("add", map[string]interface{}{"title": "db", "username": "root", "password": "p@ss"})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+	_, err = alice.HandleCommand("update", map[string]interface{}{"id": id, "password": "p@ss2"})
+	require.NoError(t, err)
+
+	// 没有公钥或指纹时不信任服务器返回的公钥
+	_, err = alice.HandleCommand("share", map[string]interface{}{"id": id, "recipient": "bob"})
+	assert.ErrorContains(t, err, "recipient_fingerprint")
+
+	// 服务器返回的公钥与通过其他渠道获得的指纹不一致时拒绝分享
+	fingerprint := again.(map[string]interface{})["fingerprint"].(string)
+	assert.True(t, strings.HasPrefix(fingerprint, "SHA256:"))
+	bobKey := server.keys["bob"]
+	forged, err := ecdh.X25519().GenerateKey(crypto_rand.Reader)
+	require.NoError(t, err)
+	server.keys["bob"] = base64.StdEncoding.EncodeToString(forged.PublicKey().Bytes())
+	_, err = alice.HandleCommand("share", map[string]interface{}{"id": id, "recipient": "bob", "recipient_fingerprint": fingerprint})
+	assert.ErrorContains(t, err, "does not match")
+	server.keys["bob"] = bobKey
+
+	result, err = alice.HandleCommand("share", map[string]interface{}{"id": id, "recipient": "bob", "recipient_fingerprint": fingerprint})
+	require.NoError(t, err)
+	shareID := result.(map[string]interface{})["share_id"].(string)
+
+	// 服务器只能看到密文
+	raw, err := json.Marshal(server.shares[shareID])
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "p@ss2")
+
+	// 其他 Agent 无法解密
+	eve := newTestPlugin(t, &plugintest.Agent{ID: "eve", Server: server}, map[string]interface{}{"master_password": "e"})
+	_, err = eve.HandleCommand("receive_share", map[string]interface{}{"share_id": shareID})
+	assert.Error(t, err)
+
+	result, err = bob.HandleCommand("receive_share", map[string]interface{}{"share_id": shareID, "save": true})
+	require.NoError(t, err)
+	info := result.(map[string]interface{})
+	assert.Equal(t, "alice", info["sender"])
+	assert.True(t, info["saved"].(bool))
+	entry := findEntry(bob, "db")
+	require.NotNil(t, entry)
+	assert.Equal(t, "p@ss2", entry.Password)
+	assert.Empty(t, entry.History)
+
+	_, err = alice.HandleCommand("revoke_share", map[string]interface{}{"share_id": shareID})
+	require.NoError(t, err)
+	_, err = bob.HandleCommand("receive_share", map[string]interface{}{"share_id": shareID})
+	assert.Error(t, err)
+}
+
+func TestPasswordPluginShareOneTimeAndExpiry(t *testing.T) {
+	server := newMockShareServer()
+	alice := newTestPlugin(t, &plugintest.Agent{ID: "alice", Server: server}, map[string]interface{}{"master_password": "a"})
+	bob := newTestPlugin(t, &plugintest.Agent{ID: "bob", Server: server}, map[string]interface{}{"master_password": "b"})
+	key, err := bob.HandleCommand("share_key", nil)
+	require.NoError(t, err)
+
+	result, err := alice.HandleCommand("add", map[string]interface{}{"title": "db", "password": "p@ss"})
+	require.NoError(t, err)
+	id := result.(map[string]interface{})["id"].(string)
+
+	// 一次性分享只能查看一次，不保存到密码库
+	result, err = alice.HandleCommand("share", map[string]interface{}{
+		"id":            id,
+		"recipient":     "bob",
+		"recipient_key": key.(map[string]interface{})["public_key"],
+		"one_time":      true,
+	})
+	require.NoError(t, err)
+	shareID := result.(map[string]interface{})["share_id"].(string)
+	result, err = bob.HandleCommand("receive_share", map[string]interface{}{"share_id": shareID, "save": true})
+	require.NoError(t, err)
+	info := result.(map[string]interface{})
+	assert.Equal(t, "p@ss", info["entry"].(*PasswordEntry).Password)
+	assert.False(t, info["saved"].(bool))
+	assert.Nil(t, findEntry(bob, "db"))
+	_, err = bob.HandleCommand("receive_share", map[string]interface{}{"share_id": shareID})
+	assert.Error(t, err)
+
+	// 过期的分享即使服务器仍返回也会被拒绝
+	result, err = alice.HandleCommand("share", map[string]interface{}{
+		"id":                    id,
+		"recipient":             "bob",
+		"recipient_fingerprint": key.(map[string]interface{})["fingerprint"],
+		"expires_in":            "1ms",
+	})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = bob.HandleCommand("receive_share", map[string]interface{}{"share_id": result.(map[string]interface{})["share_id"]})
+	assert.ErrorContains(t, err, "expired")
+
+	_, err = alice.HandleCommand("share", map[string]interface{}{"id": id, "recipient": "nobody", "recipient_fingerprint": "SHA256:x"})
+	assert.Error(t, err)
+	_, err = alice.HandleCommand("share", map[string]interface{}{"id": id, "recipient": "bob", "recipient_key": key.(map[string]interface{})["public_key"], "expires_in": "9999h"})
+	assert.Error(t, err)
+}
+
+func TestPasswordPluginRestart(t *testing.T) {
+	t.Setenv("PASSWORD_MASTER_KEY", "")
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"backup_enabled": false})
+
+	// 修改配置时插件管理器会先停止再启动插件，多次重启不能重复关闭停止信号
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Start())
+		assert.NotPanics(t, func() { require.NoError(t, p.Stop()) })
+	}
+}
@@ -0,0 +1,372 @@
+package password
+
+import (
+	"crypto/ecdh"
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// 分享条目时与服务器交互的消息类型
+const (
+	msgSharePublishKey = "password_share_key"        // 上报本 Agent 的分享公钥
+	msgShareLookupKey  = "password_share_lookup_key" // 查询接收方的分享公钥
+	msgShare           = "password_share"            // 上传加密的分享
+	msgShareFetch      = "password_share_fetch"      // 获取分享，一次性分享获取后由服务器删除
+	msgShareRevoke     = "password_share_revoke"     // 撤销分享
+)
+
+const (
+	// defaultShareTTL 分享默认有效期
+	defaultShareTTL = 24 * time.Hour
+	// maxShareTTL 分享最长有效期
+	maxShareTTL = 30 * 24 * time.Hour
+	// shareTimeout 调用服务器的超时时间
+	shareTimeout = 30 * time.Second
+)
+
+// shareInfo 派生分享加密密钥时使用的上下文
+var shareInfo = []byte("assistant_agent password share v1")
+
+// shareEnvelope 通过服务器传递的分享，有效期和一次性标记同时保存在密文中，服务器无法修改
+type shareEnvelope struct {
+	ShareID      string    `json:"share_id,omitempty"`
+	Recipient    string    `json:"recipient"`
+	EphemeralKey []byte    `json:"ephemeral_key"`
+	Ciphertext   []byte    `json:"ciphertext"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	OneTime      bool      `json:"one_time"`
+}
+
+// sharePayload 分享的明文内容
+type sharePayload struct {
+	Entry     *PasswordEntry `json:"entry"`
+	Sender    string         `json:"sender"`
+	Recipient string         `json:"recipient"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	OneTime   bool           `json:"one_time"`
+}
+
+// shareKeyFingerprint 分享公钥的指纹（SHA256: 加 base64 编码的 SHA-256），
+// 用于通过服务器以外的渠道核对接收方公钥
+func shareKeyFingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// shareKey 派生 AES 密钥，绑定临时公钥和接收方公钥
+func shareKey(secret, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte(nil), ephemeral...), recipient...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, shareInfo), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// sealShare 用接收方公钥加密分享：生成临时 X25519 密钥对，ECDH 后经 HKDF 派生 AES-GCM 密钥
+func sealShare(recipientKey *ecdh.PublicKey, payload *sharePayload) (ephemeral, ciphertext []byte, err error) {
+	priv, err := ecdh.X25519().GenerateKey(crypto_rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := priv.ECDH(recipientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeral = priv.PublicKey().Bytes()
+	key, err := shareKey(secret, ephemeral, recipientKey.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zero(key)
+
+	plain, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err = encrypt(key, plain)
+	return ephemeral, ciphertext, err
+}
+
+// openShare 用本 Agent 的分享私钥解密分享
+func openShare(priv *ecdh.PrivateKey, envelope *shareEnvelope) (*sharePayload, error) {
+	ephemeral, err := ecdh.X25519().NewPublicKey(envelope.EphemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid share: %v", err)
+	}
+	secret, err := priv.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid share: %v", err)
+	}
+	key, err := shareKey(secret, envelope.EphemeralKey, priv.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+
+	plain, err := decrypt(key, envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("share is not addressed to this agent or has been tampered with")
+	}
+	var payload sharePayload
+	if err := json.Unmarshal(plain, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Entry == nil {
+		return nil, fmt.Errorf("invalid share: entry is missing")
+	}
+	return &payload, nil
+}
+
+// ensureShareKey 返回分享私钥，不存在时生成并保存到密码库
+func (p *PasswordPlugin) ensureShareKey() (*ecdh.PrivateKey, error) {
+	p.mu.Lock()
+	if p.masterKey == nil {
+		p.mu.Unlock()
+		return nil, errVaultLocked
+	}
+	if p.shareKey != nil {
+		key := p.shareKey
+		p.mu.Unlock()
+		return key, nil
+	}
+	key, err := ecdh.X25519().GenerateKey(crypto_rand.Reader)
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.shareKey = key
+	p.mu.Unlock()
+
+	if err := p.savePasswords(); err != nil {
+		return nil, fmt.Errorf("failed to save share key: %v", err)
+	}
+	return key, nil
+}
+
+// callServer 调用服务器并将响应解析到 result
+func (p *PasswordPlugin) callServer(msgType string, data interface{}, result interface{}) error {
+	resp, err := p.ctx.Agent.CallServer(msgType, data, shareTimeout)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("invalid %s response: %v", msgType, err)
+	}
+	return nil
+}
+
+// handleShareKey 处理获取分享公钥命令，同时上报给服务器供其他 Agent 查询
+func (p *PasswordPlugin) handleShareKey(args map[string]interface{}) (interface{}, error) {
+	key, err := p.ensureShareKey()
+	if err != nil {
+		return nil, err
+	}
+	publicKey := base64.StdEncoding.EncodeToString(key.PublicKey().Bytes())
+	fingerprint := shareKeyFingerprint(key.PublicKey().Bytes())
+
+	published := true
+	if err := p.callServer(msgSharePublishKey, map[string]interface{}{"public_key": publicKey}, nil); err != nil {
+		p.ctx.Logger.Warnf("Failed to publish share key: %v", err)
+		published = false
+	}
+
+	return map[string]interface{}{
+		"public_key":  publicKey,
+		"fingerprint": fingerprint,
+		"published":   published,
+	}, nil
+}
+
+// handleShare 处理分享条目命令，条目用接收方公钥加密后通过服务器传递
+func (p *PasswordPlugin) handleShare(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+	recipient, ok := args["recipient"].(string)
+	if !ok || recipient == "" {
+		return nil, fmt.Errorf("recipient is required")
+	}
+	oneTime, _ := args["one_time"].(bool)
+
+	ttl := defaultShareTTL
+	if value, ok := args["expires_in"].(string); ok && value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid expires_in: %s", value)
+		}
+		ttl = d
+	}
+	if ttl > maxShareTTL {
+		return nil, fmt.Errorf("expires_in must not exceed %s", maxShareTTL)
+	}
+
+	// 服务器可能替换查询到的公钥，只有提供了通过其他渠道获得的指纹时才向服务器查询，
+	// 并在加密前核对指纹
+	encodedKey, _ := args["recipient_key"].(string)
+	fingerprint, _ := args["recipient_fingerprint"].(string)
+	if encodedKey == "" && fingerprint == "" {
+		return nil, fmt.Errorf("recipient_key or recipient_fingerprint is required")
+	}
+	if encodedKey == "" {
+		var lookup struct {
+			PublicKey string `json:"public_key"`
+		}
+		if err := p.callServer(msgShareLookupKey, map[string]interface{}{"recipient": recipient}, &lookup); err != nil {
+			return nil, fmt.Errorf("failed to look up share key of %s: %v", recipient, err)
+		}
+		encodedKey = lookup.PublicKey
+	}
+	rawKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient key: %v", err)
+	}
+	recipientKey, err := ecdh.X25519().NewPublicKey(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient key: %v", err)
+	}
+	if fingerprint != "" && shareKeyFingerprint(rawKey) != fingerprint {
+		return nil, fmt.Errorf("share key of %s does not match recipient_fingerprint", recipient)
+	}
+
+	p.mu.RLock()
+	entry, exists := p.passwords[id]
+	var shared PasswordEntry
+	if exists {
+		shared = *entry
+	}
+	p.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("password not found")
+	}
+
+	// 只分享当前密码，不包含历史、附件和使用记录
+	shared.ID = ""
+	shared.History = nil
+	shared.Attachments = nil
+	shared.PasswordVersion = 0
+	shared.LastUsed = time.Time{}
+
+	sender, _ := p.ctx.Agent.GetConfig("agent.id").(string)
+	payload := &sharePayload{
+		Entry:     &shared,
+		Sender:    sender,
+		Recipient: recipient,
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+		OneTime:   oneTime,
+	}
+	ephemeral, ciphertext, err := sealShare(recipientKey, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := &shareEnvelope{
+		Recipient:    recipient,
+		EphemeralKey: ephemeral,
+		Ciphertext:   ciphertext,
+		ExpiresAt:    payload.ExpiresAt,
+		OneTime:      oneTime,
+	}
+	var created struct {
+		ShareID string `json:"share_id"`
+	}
+	if err := p.callServer(msgShare, envelope, &created); err != nil {
+		return nil, fmt.Errorf("failed to upload share: %v", err)
+	}
+
+	p.ctx.Logger.Infof("Password %s shared with %s", shared.Title, recipient)
+
+	return map[string]interface{}{
+		"share_id":   created.ShareID,
+		"recipient":  recipient,
+		"expires_at": payload.ExpiresAt,
+		"one_time":   oneTime,
+		"message":    "Password shared successfully",
+	}, nil
+}
+
+// handleReceiveShare 处理接收分享命令，save 为 true 时将条目保存到密码库
+// 一次性分享由服务器在获取后删除，只返回条目不保存
+func (p *PasswordPlugin) handleReceiveShare(args map[string]interface{}) (interface{}, error) {
+	shareID, ok := args["share_id"].(string)
+	if !ok || shareID == "" {
+		return nil, fmt.Errorf("share_id is required")
+	}
+	save, _ := args["save"].(bool)
+
+	priv, err := p.ensureShareKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope shareEnvelope
+	if err := p.callServer(msgShareFetch, map[string]interface{}{"share_id": shareID}, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to fetch share: %v", err)
+	}
+	payload, err := openShare(priv, &envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	// 以密文中的有效期和一次性标记为准
+	if time.Now().After(payload.ExpiresAt) {
+		return nil, fmt.Errorf("share %s has expired", shareID)
+	}
+
+	result := map[string]interface{}{
+		"share_id":   shareID,
+		"sender":     payload.Sender,
+		"entry":      payload.Entry,
+		"expires_at": payload.ExpiresAt,
+		"one_time":   payload.OneTime,
+	}
+
+	switch {
+	case save && payload.OneTime:
+		result["saved"] = false
+		result["message"] = "One-time shares can only be viewed"
+	case save:
+		entry := *payload.Entry
+		imported := p.importEntries([]*PasswordEntry{&entry}, DuplicateKeep)
+		if err := p.savePasswords(); err != nil {
+			p.ctx.Logger.Errorf("Failed to save shared password: %v", err)
+		}
+		result["saved"] = imported["imported"] == 1
+		result["id"] = entry.ID
+	}
+
+	p.ctx.Logger.Infof("Received shared password %s from %s", payload.Entry.Title, payload.Sender)
+	return result, nil
+}
+
+// handleRevokeShare 处理撤销分享命令
+func (p *PasswordPlugin) handleRevokeShare(args map[string]interface{}) (interface{}, error) {
+	shareID, ok := args["share_id"].(string)
+	if !ok || shareID == "" {
+		return nil, fmt.Errorf("share_id is required")
+	}
+
+	if err := p.callServer(msgShareRevoke, map[string]interface{}{"share_id": shareID}, nil); err != nil {
+		return nil, fmt.Errorf("failed to revoke share: %v", err)
+	}
+
+	return map[string]interface{}{
+		"share_id": shareID,
+		"message":  "Share revoked successfully",
+	}, nil
+}
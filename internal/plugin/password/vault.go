@@ -0,0 +1,341 @@
+package password
+
+import (
+	"crypto/ecdh"
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// vaultVersion 当前密码库文件格式版本，旧版本文件是整体加密的条目列表
+const vaultVersion = 2
+
+// vaultCheck 用主密钥加密保存，解锁时解密校验主密码
+var vaultCheck = []byte("assistant_agent_password_vault")
+
+// kdfParams 主密钥派生参数，每个密码库使用随机盐
+type kdfParams struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"` // KiB
+	Threads   uint8  `json:"threads"`
+}
+
+// vaultFile 密码库文件，每个条目使用独立的数据密钥加密，数据密钥由主密钥加密保存
+type vaultFile struct {
+	Version  int            `json:"version"`
+	KDF      kdfParams      `json:"kdf"`
+	Check    []byte         `json:"check"`
+	ShareKey []byte         `json:"share_key,omitempty"` // 主密钥加密的分享私钥
+	Entries  []*sealedEntry `json:"entries"`
+}
+
+// sealedEntry 加密后的密码条目
+type sealedEntry struct {
+	ID   string `json:"id"`
+	Key  []byte `json:"key"`  // 主密钥加密的数据密钥
+	Data []byte `json:"data"` // 数据密钥加密的条目
+}
+
+// openedVault 解锁后的密码库
+type openedVault struct {
+	key      []byte
+	kdf      kdfParams
+	entries  []*PasswordEntry
+	dataKeys map[string][]byte
+	shareKey *ecdh.PrivateKey
+	migrated bool // 从旧格式读取，需要按当前格式重新保存
+}
+
+// newKDFParams 生成使用随机盐的 Argon2id 参数
+func newKDFParams() (kdfParams, error) {
+	salt := make([]byte, 16)
+	if _, err := crypto_rand.Read(salt); err != nil {
+		return kdfParams{}, err
+	}
+	return kdfParams{
+		Algorithm: "argon2id",
+		Salt:      salt,
+		Time:      3,
+		Memory:    64 * 1024,
+		Threads:   4,
+	}, nil
+}
+
+// deriveKey 从主密码派生主密钥
+func (k kdfParams) deriveKey(masterPassword string) ([]byte, error) {
+	if k.Algorithm != "argon2id" {
+		return nil, fmt.Errorf("unsupported key derivation algorithm: %s", k.Algorithm)
+	}
+	return argon2.IDKey([]byte(masterPassword), k.Salt, k.Time, k.Memory, k.Threads, 32), nil
+}
+
+// legacyKey 旧格式密码库使用固定盐的 PBKDF2 密钥
+func legacyKey(masterPassword string) []byte {
+	salt := []byte("assistant_agent_salt")
+	return pbkdf2.Key([]byte(masterPassword), salt, 10000, 32, sha256.New)
+}
+
+// newDataKey 生成条目数据密钥
+func newDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := crypto_rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// openVault 用主密码读取并解密密码库文件，文件不存在时创建新的派生参数
+func (p *PasswordPlugin) openVault(masterPassword string) (*openedVault, error) {
+	vault := &openedVault{dataKeys: make(map[string][]byte)}
+
+	if !p.ctx.Agent.FileExists(p.dataFile) {
+		kdf, err := newKDFParams()
+		if err != nil {
+			return nil, err
+		}
+		key, err := kdf.deriveKey(masterPassword)
+		if err != nil {
+			return nil, err
+		}
+		vault.key, vault.kdf = key, kdf
+		return vault, nil
+	}
+
+	data, err := p.ctx.Agent.ReadFile(p.dataFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version == 0 {
+		return openLegacyVault(data, masterPassword)
+	}
+	if file.Version > vaultVersion {
+		return nil, fmt.Errorf("unsupported password vault version: %d", file.Version)
+	}
+
+	key, err := file.KDF.deriveKey(masterPassword)
+	if err != nil {
+		return nil, err
+	}
+	return openVaultFile(&file, key)
+}
+
+// openVaultFile 用主密钥解密当前格式的密码库，校验值和所有条目都必须能解密
+func openVaultFile(file *vaultFile, key []byte) (*openedVault, error) {
+	// 解密校验值失败说明主密码错误
+	if _, err := decrypt(key, file.Check); err != nil {
+		return nil, fmt.Errorf("invalid master password")
+	}
+	vault := &openedVault{key: key, kdf: file.KDF, dataKeys: make(map[string][]byte)}
+
+	if len(file.ShareKey) > 0 {
+		raw, err := decrypt(key, file.ShareKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap share key: %v", err)
+		}
+		vault.shareKey, err = ecdh.X25519().NewPrivateKey(raw)
+		zero(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid share key: %v", err)
+		}
+	}
+
+	for _, sealed := range file.Entries {
+		dataKey, err := decrypt(key, sealed.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap key of entry %s: %v", sealed.ID, err)
+		}
+		plain, err := decrypt(dataKey, sealed.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt entry %s: %v", sealed.ID, err)
+		}
+		var entry PasswordEntry
+		if err := json.Unmarshal(plain, &entry); err != nil {
+			return nil, fmt.Errorf("invalid entry %s: %v", sealed.ID, err)
+		}
+		vault.entries = append(vault.entries, &entry)
+		vault.dataKeys[entry.ID] = dataKey
+	}
+	return vault, nil
+}
+
+// openLegacyVault 读取旧格式密码库，解锁后按当前格式重新保存
+func openLegacyVault(data []byte, masterPassword string) (*openedVault, error) {
+	plain, err := decrypt(legacyKey(masterPassword), data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master password")
+	}
+
+	vault := &openedVault{dataKeys: make(map[string][]byte), migrated: true}
+	if err := json.Unmarshal(plain, &vault.entries); err != nil {
+		return nil, err
+	}
+
+	vault.kdf, err = newKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	vault.key, err = vault.kdf.deriveKey(masterPassword)
+	if err != nil {
+		return nil, err
+	}
+	return vault, nil
+}
+
+// sealVaultLocked 按当前格式加密密码库，没有数据密钥的条目生成新密钥，调用方需持有写锁
+func (p *PasswordPlugin) sealVaultLocked() ([]byte, error) {
+	if p.masterKey == nil {
+		return nil, errVaultLocked
+	}
+
+	check, err := encrypt(p.masterKey, vaultCheck)
+	if err != nil {
+		return nil, err
+	}
+	file := vaultFile{
+		Version: vaultVersion,
+		KDF:     p.kdf,
+		Check:   check,
+		Entries: make([]*sealedEntry, 0, len(p.passwords)),
+	}
+	if p.shareKey != nil {
+		if file.ShareKey, err = encrypt(p.masterKey, p.shareKey.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	dataKeys := make(map[string][]byte, len(p.passwords))
+	for id, entry := range p.passwords {
+		dataKey := p.dataKeys[id]
+		if dataKey == nil {
+			if dataKey, err = newDataKey(); err != nil {
+				return nil, err
+			}
+		}
+		dataKeys[id] = dataKey
+
+		plain, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		sealedData, err := encrypt(dataKey, plain)
+		if err != nil {
+			return nil, err
+		}
+		wrappedKey, err := encrypt(p.masterKey, dataKey)
+		if err != nil {
+			return nil, err
+		}
+		file.Entries = append(file.Entries, &sealedEntry{ID: id, Key: wrappedKey, Data: sealedData})
+	}
+
+	// 已删除条目的数据密钥清零
+	for id, key := range p.dataKeys {
+		if _, ok := dataKeys[id]; !ok {
+			zero(key)
+		}
+	}
+	p.dataKeys = dataKeys
+
+	return json.Marshal(file)
+}
+
+// rotateMasterKey 校验当前主密码后用新主密码和新盐派生主密钥，重新加密所有数据密钥并保存
+// rotateDataKeys 为 true 时同时为每个条目生成新的数据密钥，保存失败时恢复原密钥
+func (p *PasswordPlugin) rotateMasterKey(currentPassword, newPassword string, rotateDataKeys bool) error {
+	if newPassword == "" {
+		return fmt.Errorf("new_password is required")
+	}
+
+	p.mu.RLock()
+	kdf := p.kdf
+	p.mu.RUnlock()
+
+	currentKey, err := kdf.deriveKey(currentPassword)
+	if err != nil {
+		return err
+	}
+	newKDF, err := newKDFParams()
+	if err != nil {
+		return err
+	}
+	newKey, err := newKDF.deriveKey(newPassword)
+	if err != nil {
+		return err
+	}
+
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	p.mu.Lock()
+	if p.masterKey == nil {
+		p.mu.Unlock()
+		return errVaultLocked
+	}
+	if !keysEqual(p.masterKey, currentKey) {
+		p.mu.Unlock()
+		return fmt.Errorf("invalid master password")
+	}
+
+	oldKey, oldKDF, oldDataKeys := p.masterKey, p.kdf, p.dataKeys
+	p.masterKey, p.kdf = newKey, newKDF
+	if rotateDataKeys {
+		p.dataKeys = make(map[string][]byte)
+	}
+	data, err := p.sealVaultLocked()
+	if err == nil {
+		err = p.writeFile(p.dataFile, data)
+	}
+	if err != nil {
+		// 保存失败时文件仍使用原密钥，恢复内存中的密钥
+		p.masterKey, p.kdf, p.dataKeys = oldKey, oldKDF, oldDataKeys
+		p.mu.Unlock()
+		return fmt.Errorf("failed to save rotated vault: %v", err)
+	}
+	zero(oldKey)
+	if rotateDataKeys {
+		for _, key := range oldDataKeys {
+			zero(key)
+		}
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// handleRotateMasterKey 处理更换主密码命令
+func (p *PasswordPlugin) handleRotateMasterKey(args map[string]interface{}) (interface{}, error) {
+	currentPassword, ok := args["current_password"].(string)
+	if !ok {
+		return nil, fmt.Errorf("current_password is required")
+	}
+	newPassword, _ := args["new_password"].(string)
+	rotateDataKeys, _ := args["rotate_data_keys"].(bool)
+
+	if err := p.rotateMasterKey(currentPassword, newPassword, rotateDataKeys); err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	count := len(p.passwords)
+	p.mu.RUnlock()
+
+	p.ctx.Logger.Info("Password vault master key rotated")
+	return map[string]interface{}{
+		"count":   count,
+		"message": "Master key rotated successfully",
+	}, nil
+}
+
+// zero 清零密钥
+func zero(key []byte) {
+	for i := range key {
+		key[i] = 0
+	}
+}
@@ -0,0 +1,136 @@
+// Package plugintest 提供插件测试共用的模拟 Agent、日志器和初始化方法
+package plugintest
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/plugin"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Logger 丢弃所有日志的日志器
+type Logger struct{}
+
+func (l *Logger) Debug(args ...interface{})                 {}
+func (l *Logger) Info(args ...interface{})                  {}
+func (l *Logger) Warn(args ...interface{})                  {}
+func (l *Logger) Error(args ...interface{})                 {}
+func (l *Logger) Debugf(format string, args ...interface{}) {}
+func (l *Logger) Infof(format string, args ...interface{})  {}
+func (l *Logger) Warnf(format string, args ...interface{})  {}
+func (l *Logger) Errorf(format string, args ...interface{}) {}
+
+// Event 插件通过 NotifyEvent 发送的事件
+type Event struct {
+	Type string
+	Data map[string]interface{}
+}
+
+// Server 模拟服务器，处理插件通过 CallServer 发送的请求
+type Server interface {
+	Handle(agent *Agent, msgType string, data interface{}) (interface{}, error)
+}
+
+// Agent 模拟 Agent 接口，直接访问本地文件和程序，不受插件权限限制，记录插件发送的事件。
+// 未实现的 AgentInterface 方法调用时 panic
+type Agent struct {
+	plugin.AgentInterface
+	plugin.LocalFS
+	plugin.LocalCommander
+	DataDir string
+	TempDir string
+	ID      string
+	Server  Server                 // 处理 CallServer，未设置时返回错误
+	Status  map[string]interface{} // GetStatus 返回值
+
+	mu      sync.Mutex
+	sysInfo map[string]interface{}
+	events  []Event
+}
+
+// SetSystemInfo 设置 GetSystemInfo 返回的系统信息
+func (a *Agent) SetSystemInfo(info map[string]interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sysInfo = info
+}
+
+func (a *Agent) GetSystemInfo() (map[string]interface{}, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sysInfo, nil
+}
+
+func (a *Agent) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (a *Agent) WriteFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0600)
+}
+
+func (a *Agent) FileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (a *Agent) GetConfig(key string) interface{} {
+	switch key {
+	case "agent.data_dir":
+		return a.DataDir
+	case "agent.temp_dir":
+		return a.TempDir
+	case "agent.id":
+		return a.ID
+	}
+	return nil
+}
+
+func (a *Agent) GetStatus() map[string]interface{} {
+	return a.Status
+}
+
+func (a *Agent) CallServer(msgType string, data interface{}, timeout time.Duration) (interface{}, error) {
+	if a.Server == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return a.Server.Handle(a, msgType, data)
+}
+
+func (a *Agent) NotifyEvent(eventType string, data map[string]interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, Event{Type: eventType, Data: data})
+	return nil
+}
+
+// Events 返回指定类型的事件
+func (a *Agent) Events(eventType string) []Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var result []Event
+	for _, event := range a.events {
+		if event.Type == eventType {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// InitPlugin 使用模拟 Agent 初始化插件。Agent 没有数据目录时使用临时目录，config 不为空时先应用配置
+func InitPlugin[P plugin.Plugin](t testing.TB, p P, agent *Agent, config map[string]interface{}) P {
+	t.Helper()
+	if agent.DataDir == "" {
+		agent.DataDir = t.TempDir()
+	}
+	if config != nil {
+		require.NoError(t, p.SetConfig(config))
+	}
+	require.NoError(t, p.Init(&plugin.PluginContext{Agent: agent, Logger: &Logger{}}))
+	return p
+}
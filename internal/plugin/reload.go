@@ -0,0 +1,168 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"assistant_agent/internal/logger"
+)
+
+// ReloadResult 外部插件重新加载结果
+type ReloadResult struct {
+	Loaded    []string          `json:"loaded"`
+	Reloaded  []string          `json:"reloaded"`
+	Removed   []string          `json:"removed"`
+	Unchanged []string          `json:"unchanged"`
+	Errors    map[string]string `json:"errors,omitempty"` // 文件名或插件名 -> 错误信息
+}
+
+// SetExternalDir 设置外部插件目录
+func (m *Manager) SetExternalDir(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.extDir = dir
+}
+
+// ReloadExternalPlugins 扫描外部插件目录，启动新增的插件，重启文件发生变化的插件，
+// 停止文件已删除的插件
+func (m *Manager) ReloadExternalPlugins() (*ReloadResult, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	m.mu.RLock()
+	dir := m.extDir
+	loaded := make(map[string]*ExternalPlugin)
+	for _, instance := range m.plugins {
+		if external, ok := instance.Plugin.(*ExternalPlugin); ok {
+			loaded[external.Path()] = external
+		}
+	}
+	m.mu.RUnlock()
+
+	if dir == "" {
+		return nil, fmt.Errorf("external plugin directory is not configured")
+	}
+
+	paths, err := discoverExternalPlugins(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReloadResult{
+		Loaded:    make([]string, 0),
+		Reloaded:  make([]string, 0),
+		Removed:   make([]string, 0),
+		Unchanged: make([]string, 0),
+		Errors:    make(map[string]string),
+	}
+
+	// 文件已删除的插件
+	for path, external := range loaded {
+		if _, exists := paths[path]; exists {
+			continue
+		}
+		name := external.Info().Name
+		if err := m.Unregister(name); err != nil {
+			result.Errors[name] = err.Error()
+			continue
+		}
+		result.Removed = append(result.Removed, name)
+	}
+
+	for path := range paths {
+		external, exists := loaded[path]
+		if exists && !external.Changed() {
+			result.Unchanged = append(result.Unchanged, external.Info().Name)
+			continue
+		}
+
+		// 文件发生变化，先卸载旧版本
+		if exists {
+			if err := m.Unregister(external.Info().Name); err != nil {
+				result.Errors[external.Info().Name] = err.Error()
+				continue
+			}
+		}
+
+		name, err := m.loadExternal(path)
+		if err != nil {
+			logger.Errorf("Failed to load external plugin %s: %v", path, err)
+			result.Errors[filepath.Base(path)] = err.Error()
+			continue
+		}
+		if exists {
+			result.Reloaded = append(result.Reloaded, name)
+		} else {
+			result.Loaded = append(result.Loaded, name)
+		}
+	}
+
+	for _, names := range [][]string{result.Loaded, result.Reloaded, result.Removed, result.Unchanged} {
+		sort.Strings(names)
+	}
+
+	logger.Infof("External plugins reloaded: %d loaded, %d reloaded, %d removed, %d failed",
+		len(result.Loaded), len(result.Reloaded), len(result.Removed), len(result.Errors))
+	return result, nil
+}
+
+// loadExternal 启动外部插件进程，注册并启动插件
+func (m *Manager) loadExternal(path string) (string, error) {
+	external, err := LaunchExternalPlugin(path)
+	if err != nil {
+		return "", err
+	}
+
+	name := external.Info().Name
+	if err := m.Register(external); err != nil {
+		external.Close()
+		return "", fmt.Errorf("failed to register plugin %s: %w", name, err)
+	}
+	if err := m.StartPlugin(name); err != nil {
+		m.Unregister(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// discoverExternalPlugins 列出目录中的可执行文件
+func discoverExternalPlugins(dir string) (map[string]bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]bool{}, nil
+		}
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if strings.HasSuffix(name, ".so") {
+			logger.Warnf("Skipping %s: Go .so plugins are not supported, build the plugin as an executable", name)
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if runtime.GOOS == "windows" {
+			if !strings.EqualFold(filepath.Ext(name), ".exe") {
+				continue
+			}
+		} else if info.Mode()&0111 == 0 {
+			continue
+		}
+
+		paths[filepath.Join(dir, name)] = true
+	}
+	return paths, nil
+}
@@ -0,0 +1,321 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/executor"
+)
+
+// PluginPermissions 插件权限声明，插件管理器通过包装 AgentInterface 强制执行，未声明的能力均被拒绝
+// 获取系统信息、读写状态、发送事件和读取非安全配置始终允许
+type PluginPermissions struct {
+	Exec        bool     `json:"exec"`         // 允许 ExecuteCommand、ExecuteScript、运行程序和重启 Agent
+	ReadPaths   []string `json:"read_paths"`   // 允许读取的目录，可写目录同样可读
+	WritePaths  []string `json:"write_paths"`  // 允许写入的目录
+	ConfigWrite bool     `json:"config_write"` // 允许 SetConfig
+	Server      bool     `json:"server"`       // 允许 CallServer
+}
+
+// 权限声明中可使用的目录占位符
+const (
+	PathDataDir = "${data_dir}"
+	PathWorkDir = "${work_dir}"
+	PathTempDir = "${temp_dir}"
+	PathExecDir = "${exec_dir}" // Agent 可执行文件所在目录
+)
+
+// pluginPermissions 计算插件的有效权限，配置中的权限覆盖插件声明
+// 返回 nil 表示插件未声明权限且未配置，按没有任何权限处理
+func (m *Manager) pluginPermissions(name string, info *PluginInfo) *PluginPermissions {
+	if override, ok := m.config.Security.PluginPermissions[name]; ok {
+		return &PluginPermissions{
+			Exec:        override.Exec,
+			ReadPaths:   override.ReadPaths,
+			WritePaths:  override.WritePaths,
+			ConfigWrite: override.ConfigWrite,
+			Server:      override.Server,
+		}
+	}
+	if info == nil {
+		return nil
+	}
+	return info.Permissions
+}
+
+// sandboxAgent 按插件权限限制 AgentInterface 的调用
+type sandboxAgent struct {
+	AgentInterface
+	name        string
+	permissions *PluginPermissions
+	readDirs    []string
+	writeDirs   []string
+}
+
+// newSandboxAgent 创建受限的 AgentInterface，permissions 为 nil 时拒绝所有受限的能力
+func newSandboxAgent(agent AgentInterface, name string, permissions *PluginPermissions, cfg config.AgentConfig) AgentInterface {
+	if permissions == nil {
+		permissions = &PluginPermissions{}
+	}
+
+	sandbox := &sandboxAgent{
+		AgentInterface: agent,
+		name:           name,
+		permissions:    permissions,
+		writeDirs:      resolveSandboxDirs(permissions.WritePaths, cfg),
+	}
+	sandbox.readDirs = append(resolveSandboxDirs(permissions.ReadPaths, cfg), sandbox.writeDirs...)
+	return sandbox
+}
+
+// resolveSandboxDirs 展开目录占位符并转换为绝对路径，忽略未配置的目录
+func resolveSandboxDirs(paths []string, cfg config.AgentConfig) []string {
+	execDir := ""
+	if exe, err := os.Executable(); err == nil {
+		execDir = filepath.Dir(exe)
+	}
+	replacer := strings.NewReplacer(
+		PathDataDir, cfg.DataDir,
+		PathWorkDir, cfg.WorkDir,
+		PathTempDir, cfg.TempDir,
+		PathExecDir, execDir,
+	)
+
+	dirs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		expanded := replacer.Replace(path)
+		if expanded == "" {
+			continue
+		}
+		dirs = append(dirs, resolvePath(expanded))
+	}
+	return dirs
+}
+
+// resolvePath 返回绝对路径，已存在的部分解析符号链接，防止通过链接逃逸出允许的目录
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = filepath.Clean(path)
+	}
+
+	// 从完整路径开始向上查找第一个存在的目录并解析链接
+	rest := ""
+	current := abs
+	for {
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(current), rest)
+		current = parent
+	}
+}
+
+// pathAllowed 检查路径是否位于允许的目录中
+func pathAllowed(path string, dirs []string) bool {
+	resolved := resolvePath(path)
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, resolved)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))) {
+			return true
+		}
+	}
+	return false
+}
+
+// deny 生成权限错误
+func (a *sandboxAgent) deny(action string) error {
+	return fmt.Errorf("%w: plugin %s is not allowed to %s", ErrPermissionDenied, a.name, action)
+}
+
+func (a *sandboxAgent) ExecuteCommand(command string, args []string, timeout time.Duration) (string, error) {
+	if !a.permissions.Exec {
+		return "", a.deny("execute commands")
+	}
+	return a.AgentInterface.ExecuteCommand(command, args, timeout)
+}
+
+func (a *sandboxAgent) ExecuteScript(ref string, args []string, timeout time.Duration) (string, error) {
+	if !a.permissions.Exec {
+		return "", a.deny("execute scripts")
+	}
+	return a.AgentInterface.ExecuteScript(ref, args, timeout)
+}
+
+func (a *sandboxAgent) ExecuteCommandContext(ctx context.Context, command string, args []string, timeout time.Duration) (string, error) {
+	if !a.permissions.Exec {
+		return "", a.deny("execute commands")
+	}
+	return a.AgentInterface.ExecuteCommandContext(ctx, command, args, timeout)
+}
+
+func (a *sandboxAgent) ExecuteScriptContext(ctx context.Context, ref string, args []string, timeout time.Duration) (string, error) {
+	if !a.permissions.Exec {
+		return "", a.deny("execute scripts")
+	}
+	return a.AgentInterface.ExecuteScriptContext(ctx, ref, args, timeout)
+}
+
+func (a *sandboxAgent) RunCommand(ctx context.Context, cmd *executor.Command) (*executor.Result, error) {
+	if !a.permissions.Exec {
+		return nil, a.deny("execute commands")
+	}
+	return a.AgentInterface.RunCommand(ctx, cmd)
+}
+
+func (a *sandboxAgent) Command(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	if !a.permissions.Exec {
+		return nil, a.deny("run " + name)
+	}
+	commander, err := AgentCommander(a.AgentInterface)
+	if err != nil {
+		return nil, err
+	}
+	return commander.Command(ctx, name, args...)
+}
+
+func (a *sandboxAgent) ReadFile(path string) ([]byte, error) {
+	if !pathAllowed(path, a.readDirs) {
+		return nil, a.deny("read " + path)
+	}
+	return a.AgentInterface.ReadFile(path)
+}
+
+func (a *sandboxAgent) WriteFile(path string, data []byte) error {
+	if !pathAllowed(path, a.writeDirs) {
+		return a.deny("write " + path)
+	}
+	return a.AgentInterface.WriteFile(path, data)
+}
+
+// FileExists 不允许读取的路径视为不存在
+func (a *sandboxAgent) FileExists(path string) bool {
+	if !pathAllowed(path, a.readDirs) {
+		return false
+	}
+	return a.AgentInterface.FileExists(path)
+}
+
+// writeFlags 打开文件时需要写权限的标志
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_TRUNC | os.O_APPEND
+
+func (a *sandboxAgent) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	if flag&writeFlags != 0 {
+		if !pathAllowed(path, a.writeDirs) {
+			return nil, a.deny("write " + path)
+		}
+	} else if !pathAllowed(path, a.readDirs) {
+		return nil, a.deny("read " + path)
+	}
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return nil, err
+	}
+	return fs.OpenFile(path, flag, perm)
+}
+
+func (a *sandboxAgent) Stat(path string) (os.FileInfo, error) {
+	if !pathAllowed(path, a.readDirs) {
+		return nil, a.deny("read " + path)
+	}
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(path)
+}
+
+func (a *sandboxAgent) Rename(oldPath, newPath string) error {
+	for _, path := range []string{oldPath, newPath} {
+		if !pathAllowed(path, a.writeDirs) {
+			return a.deny("write " + path)
+		}
+	}
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return err
+	}
+	return fs.Rename(oldPath, newPath)
+}
+
+func (a *sandboxAgent) Remove(path string) error {
+	if !pathAllowed(path, a.writeDirs) {
+		return a.deny("write " + path)
+	}
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return err
+	}
+	return fs.Remove(path)
+}
+
+func (a *sandboxAgent) MkdirAll(path string, perm os.FileMode) error {
+	if !pathAllowed(path, a.writeDirs) {
+		return a.deny("write " + path)
+	}
+	fs, err := AgentFS(a.AgentInterface)
+	if err != nil {
+		return err
+	}
+	return fs.MkdirAll(path, perm)
+}
+
+// SetGauge 和 IncCounter 不需要权限，直接转发
+func (a *sandboxAgent) SetGauge(name string, value float64) {
+	if stats, err := AgentStats(a.AgentInterface); err == nil {
+		stats.SetGauge(name, value)
+	}
+}
+
+func (a *sandboxAgent) IncCounter(name string, delta float64) {
+	if stats, err := AgentStats(a.AgentInterface); err == nil {
+		stats.IncCounter(name, delta)
+	}
+}
+
+// GetConfig 受限插件不能读取安全配置（令牌、证书等）
+func (a *sandboxAgent) GetConfig(key string) interface{} {
+	if strings.HasPrefix(key, "security.") {
+		return nil
+	}
+	return a.AgentInterface.GetConfig(key)
+}
+
+func (a *sandboxAgent) SetConfig(key string, value interface{}) error {
+	if !a.permissions.ConfigWrite {
+		return a.deny("change config")
+	}
+	return a.AgentInterface.SetConfig(key, value)
+}
+
+func (a *sandboxAgent) CallServer(msgType string, data interface{}, timeout time.Duration) (interface{}, error) {
+	if !a.permissions.Server {
+		return nil, a.deny("call the server")
+	}
+	return a.AgentInterface.CallServer(msgType, data, timeout)
+}
+
+// Restart replace 通常会执行新的可执行文件，需要执行权限
+func (a *sandboxAgent) Restart(replace func() error) error {
+	if !a.permissions.Exec {
+		return a.deny("restart the agent")
+	}
+	restarter, err := AgentRestarter(a.AgentInterface)
+	if err != nil {
+		return err
+	}
+	return restarter.Restart(replace)
+}
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandboxAgent(t *testing.T) {
+	dataDir := t.TempDir()
+	workDir := t.TempDir()
+	outside := t.TempDir()
+	cfg := config.AgentConfig{DataDir: dataDir, WorkDir: workDir}
+
+	mockAgent := &MockAgent{config: make(map[string]interface{})}
+	agent := newSandboxAgent(mockAgent, "file-transfer", &PluginPermissions{
+		ReadPaths:  []string{PathDataDir},
+		WritePaths: []string{PathWorkDir},
+	}, cfg)
+
+	// 可写目录同样可读，其他目录不可访问
+	_, err := agent.ReadFile(filepath.Join(dataDir, "a.txt"))
+	assert.NoError(t, err)
+	_, err = agent.ReadFile(filepath.Join(workDir, "sub", "b.txt"))
+	assert.NoError(t, err)
+	_, err = agent.ReadFile(filepath.Join(outside, "c.txt"))
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, err = agent.ReadFile(filepath.Join(dataDir, "..", filepath.Base(outside), "c.txt"))
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+
+	assert.NoError(t, agent.WriteFile(filepath.Join(workDir, "out.txt"), nil))
+	assert.True(t, errors.Is(agent.WriteFile(filepath.Join(dataDir, "out.txt"), nil), ErrPermissionDenied))
+	assert.True(t, agent.FileExists(filepath.Join(dataDir, "a.txt")))
+	assert.False(t, agent.FileExists(filepath.Join(outside, "c.txt")))
+
+	// 流式文件访问按打开标志检查读写权限，底层 Agent 不支持时返回错误
+	_, err = agent.(FileSystem).OpenFile(filepath.Join(dataDir, "a.txt"), os.O_RDONLY, 0)
+	assert.False(t, errors.Is(err, ErrPermissionDenied))
+	fsAgent := newSandboxAgent(&struct {
+		*MockAgent
+		LocalFS
+	}{MockAgent: mockAgent}, "file-transfer", &PluginPermissions{
+		ReadPaths:  []string{PathDataDir},
+		WritePaths: []string{PathWorkDir},
+	}, cfg).(FileSystem)
+	f, err := fsAgent.OpenFile(filepath.Join(workDir, "stream.txt"), os.O_WRONLY|os.O_CREATE, 0644)
+	require.NoError(t, err)
+	f.Close()
+	_, err = fsAgent.OpenFile(filepath.Join(dataDir, "stream.txt"), os.O_WRONLY|os.O_CREATE, 0644)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, err = fsAgent.OpenFile(filepath.Join(outside, "c.txt"), os.O_RDONLY, 0)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.True(t, errors.Is(fsAgent.Rename(filepath.Join(workDir, "stream.txt"), filepath.Join(dataDir, "stream.txt")), ErrPermissionDenied))
+	assert.NoError(t, fsAgent.Rename(filepath.Join(workDir, "stream.txt"), filepath.Join(workDir, "done.txt")))
+	_, err = fsAgent.Stat(filepath.Join(workDir, "done.txt"))
+	assert.NoError(t, err)
+
+	// 未声明的能力被拒绝
+	_, err = agent.ExecuteCommand("whoami", nil, time.Second)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, err = agent.ExecuteScript("backup", nil, time.Second)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, err = agent.CallServer("query", nil, time.Second)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.True(t, errors.Is(agent.SetConfig("agent.name", "x"), ErrPermissionDenied))
+	assert.True(t, errors.Is(agent.(Restarter).Restart(func() error { return nil }), ErrPermissionDenied))
+
+	// 安全配置不可读，其他配置不受限制
+	mockAgent.config["security.token"] = "secret"
+	mockAgent.config["agent.name"] = "edge"
+	assert.Nil(t, agent.GetConfig("security.token"))
+	assert.Equal(t, "edge", agent.GetConfig("agent.name"))
+}
+
+func TestSandboxAgentSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+	workDir := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(workDir, "link")))
+
+	agent := newSandboxAgent(&MockAgent{}, "file-transfer", &PluginPermissions{
+		WritePaths: []string{PathWorkDir},
+	}, config.AgentConfig{WorkDir: workDir})
+
+	err := agent.WriteFile(filepath.Join(workDir, "link", "escape.txt"), nil)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+
+	// ${exec_dir} 展开为 Agent 可执行文件所在的目录，供更新插件替换可执行文件
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	assert.Equal(t, []string{resolvePath(filepath.Dir(exe))}, resolveSandboxDirs([]string{PathExecDir}, config.AgentConfig{}))
+}
+
+func TestManagerPluginPermissions(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	// 未声明权限的插件没有任何受限的能力
+	mockAgent := &MockAgent{config: make(map[string]interface{})}
+	legacy := newSandboxAgent(mockAgent, "legacy", nil, config.AgentConfig{})
+	_, err := legacy.ExecuteCommand("whoami", nil, time.Second)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.True(t, errors.Is(legacy.WriteFile(filepath.Join(t.TempDir(), "a.txt"), nil), ErrPermissionDenied))
+	_, err = legacy.(Commander).Command(context.Background(), "whoami")
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+
+	cfg := &config.Config{}
+	cfg.Security.PluginPermissions = map[string]config.PluginPermissionConfig{
+		"scheduler": {Exec: false},
+	}
+	manager := NewManager(mockAgent, cfg)
+
+	declared := newSubscriberPlugin("scheduler")
+	declared.info.Permissions = &PluginPermissions{Exec: true}
+	require.NoError(t, manager.Register(declared))
+	require.NoError(t, manager.StartPlugin("scheduler"))
+
+	// 配置中的权限覆盖插件声明
+	_, err = declared.ctx.Agent.ExecuteCommand("whoami", nil, time.Second)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+
+	delete(cfg.Security.PluginPermissions, "scheduler")
+	require.NoError(t, manager.StopPlugin("scheduler"))
+	require.NoError(t, manager.StartPlugin("scheduler"))
+	output, err := declared.ctx.Agent.ExecuteCommand("whoami", nil, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "command executed", output)
+}
@@ -0,0 +1,267 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 任务链中每个任务的执行状态
+const (
+	ChainSuccess    = "success"
+	ChainFailed     = "failed"
+	ChainSkipped    = "skipped"    // 依赖未成功、任务已禁用或达到并发限制
+	ChainSuppressed = "suppressed" // 处于维护模式或禁止执行时间段
+)
+
+// parseDependsOn 解析 depends_on 参数
+func parseDependsOn(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		deps := make([]string, 0, len(v))
+		for _, item := range v {
+			dep, ok := item.(string)
+			if !ok || dep == "" {
+				return nil, fmt.Errorf("depends_on must be a list of task ids")
+			}
+			deps = append(deps, dep)
+		}
+		return deps, nil
+	default:
+		return nil, fmt.Errorf("depends_on must be a list of task ids")
+	}
+}
+
+// validateDependenciesLocked 校验依赖的任务存在且不形成环，调用方需持有锁
+func (p *SchedulerPlugin) validateDependenciesLocked(id string, deps []string) error {
+	for _, dep := range deps {
+		if dep == id {
+			return fmt.Errorf("task cannot depend on itself")
+		}
+		if _, exists := p.tasks[dep]; !exists {
+			return fmt.Errorf("dependency %s not found", dep)
+		}
+	}
+
+	// 从依赖出发沿 DependsOn 向上查找，能回到 id 说明存在环
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(current string) bool
+	visit = func(current string) bool {
+		path = append(path, current)
+		if current == id {
+			return true
+		}
+		if !visited[current] {
+			visited[current] = true
+			if task, exists := p.tasks[current]; exists {
+				for _, dep := range task.DependsOn {
+					if visit(dep) {
+						return true
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	for _, dep := range deps {
+		path = path[:0]
+		if visit(dep) {
+			return fmt.Errorf("dependency cycle detected: %s -> %s", id, strings.Join(path, " -> "))
+		}
+	}
+	return nil
+}
+
+// dependentsLocked 返回直接依赖 id 的任务 ID，按 ID 排序，调用方需持有锁
+func (p *SchedulerPlugin) dependentsLocked(id string) []string {
+	dependents := make([]string, 0)
+	for _, task := range p.tasks {
+		if containsString(task.DependsOn, id) {
+			dependents = append(dependents, task.ID)
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// chainLocked 返回以 root 为起点的任务链：root 及所有直接或间接依赖它的任务，按拓扑顺序排列
+func (p *SchedulerPlugin) chainLocked(root *TaskInfo) []*TaskInfo {
+	inChain := map[string]bool{root.ID: true}
+	queue := []string{root.ID}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, id := range p.dependentsLocked(current) {
+			if !inChain[id] {
+				inChain[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(inChain))
+	for id := range inChain {
+		if id != root.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	// 依赖都已排在前面的任务才能加入，root 始终排在第一位
+	order := []*TaskInfo{root}
+	placed := map[string]bool{root.ID: true}
+	for len(order) < len(inChain) {
+		progressed := false
+		for _, id := range ids {
+			task := p.tasks[id]
+			if placed[id] || task == nil {
+				continue
+			}
+			ready := true
+			for _, dep := range task.DependsOn {
+				if inChain[dep] && !placed[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				order = append(order, task)
+				placed[id] = true
+				progressed = true
+			}
+		}
+		if !progressed {
+			break
+		}
+	}
+	return order
+}
+
+// runChain 执行 root 及依赖它的任务，任务的所有依赖最近一次都成功执行后才会执行
+// scheduled 表示按计划触发，处于维护模式或禁止执行时间段的任务被抑制
+func (p *SchedulerPlugin) runChain(root *TaskInfo, scheduled bool) map[string]string {
+	p.mu.RLock()
+	order := p.chainLocked(root)
+	p.mu.RUnlock()
+
+	// 没有依赖它的任务时直接执行
+	if len(order) == 1 {
+		if !p.suppressed(root, scheduled) {
+			p.executeTask(root)
+		}
+		return nil
+	}
+
+	results := make(map[string]string, len(order))
+	for _, task := range order {
+		if task != root && !p.dependenciesSucceeded(task, results) {
+			results[task.ID] = ChainSkipped
+			p.mu.Lock()
+			p.lastResults[task.ID] = ChainSkipped
+			p.mu.Unlock()
+			continue
+		}
+		if p.suppressed(task, scheduled) {
+			results[task.ID] = ChainSuppressed
+			continue
+		}
+
+		switch result := p.executeTask(task); {
+		case result == nil:
+			results[task.ID] = ChainSkipped
+		case result.Success:
+			results[task.ID] = ChainSuccess
+		default:
+			results[task.ID] = ChainFailed
+		}
+	}
+
+	p.ctx.Agent.NotifyEvent("chain_completed", map[string]interface{}{
+		"root":    root.ID,
+		"name":    root.Name,
+		"results": results,
+	})
+	return results
+}
+
+// suppressed 按计划触发时检查任务是否被抑制，被抑制时记录到执行历史
+func (p *SchedulerPlugin) suppressed(task *TaskInfo, scheduled bool) bool {
+	if !scheduled {
+		return false
+	}
+	now := time.Now()
+	reason := p.suppressReason(task, now)
+	if reason == "" {
+		return false
+	}
+	p.suppressTask(task, reason, now)
+	return true
+}
+
+// dependenciesSucceeded 检查任务已启用且所有依赖最近一次成功执行，
+// 本轮任务链中的依赖按本轮结果判断，其他依赖（如另一个起点任务）按其最近一次的结果判断
+func (p *SchedulerPlugin) dependenciesSucceeded(task *TaskInfo, results map[string]string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if !task.Enabled {
+		return false
+	}
+	for _, dep := range task.DependsOn {
+		result, ok := results[dep]
+		if !ok {
+			result = p.lastResults[dep]
+		}
+		if result != ChainSuccess {
+			return false
+		}
+	}
+	return true
+}
+
+// handleRunChain 处理立即执行任务链命令
+func (p *SchedulerPlugin) handleRunChain(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	p.mu.RLock()
+	task, exists := p.tasks[id]
+	if !exists {
+		p.mu.RUnlock()
+		return nil, fmt.Errorf("task not found")
+	}
+	order := p.chainLocked(task)
+	p.mu.RUnlock()
+
+	ids := make([]string, 0, len(order))
+	for _, t := range order {
+		ids = append(ids, t.ID)
+	}
+
+	go p.runChain(task, false)
+
+	return map[string]interface{}{
+		"id":      id,
+		"tasks":   ids,
+		"message": "Chain execution started",
+	}, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
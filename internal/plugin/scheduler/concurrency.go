@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+)
+
+// 任务执行重叠策略，任务正在执行的实例数达到 max_concurrent 时生效
+const (
+	OverlapSkip         = "skip"          // 跳过本次执行
+	OverlapQueue        = "queue"         // 等待正在执行的实例结束后执行
+	OverlapKillPrevious = "kill-previous" // 终止正在执行的实例后执行
+)
+
+// taskRun 正在执行的任务实例
+type taskRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// validateOverlapPolicy 校验重叠策略，空值表示默认的 skip
+func validateOverlapPolicy(policy string) error {
+	switch policy {
+	case "", OverlapSkip, OverlapQueue, OverlapKillPrevious:
+		return nil
+	default:
+		return fmt.Errorf("invalid overlap_policy: %s", policy)
+	}
+}
+
+// acquireRun 按任务的并发限制和重叠策略登记一次执行，返回 nil 表示本次执行被跳过
+func (p *SchedulerPlugin) acquireRun(task *TaskInfo) *taskRun {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for task.MaxConcurrent > 0 && len(p.running[task.ID]) >= task.MaxConcurrent {
+		if p.stopping {
+			return nil
+		}
+
+		switch task.OverlapPolicy {
+		case OverlapQueue:
+			p.runDone.Wait()
+		case OverlapKillPrevious:
+			for _, run := range p.running[task.ID] {
+				run.cancel()
+			}
+			p.runDone.Wait()
+		default:
+			return nil
+		}
+	}
+	if p.stopping {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &taskRun{ctx: ctx, cancel: cancel}
+	p.running[task.ID] = append(p.running[task.ID], run)
+	return run
+}
+
+// releaseRun 结束一次执行并唤醒等待中的执行
+func (p *SchedulerPlugin) releaseRun(task *TaskInfo, run *taskRun) {
+	run.cancel()
+
+	p.mu.Lock()
+	runs := p.running[task.ID]
+	for i, r := range runs {
+		if r == run {
+			runs = append(runs[:i], runs[i+1:]...)
+			break
+		}
+	}
+	if len(runs) == 0 {
+		delete(p.running, task.ID)
+	} else {
+		p.running[task.ID] = runs
+	}
+	p.runDone.Broadcast()
+	p.mu.Unlock()
+}
+
+// acquireSlot 获取全局执行名额，名额数由 max_concurrent_tasks 配置，执行被取消时返回 false
+func (p *SchedulerPlugin) acquireSlot(run *taskRun) bool {
+	if p.slots == nil {
+		return true
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	case <-run.ctx.Done():
+		return false
+	}
+}
+
+// releaseSlot 释放全局执行名额
+func (p *SchedulerPlugin) releaseSlot() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+// cancelRuns 终止所有正在执行的任务并唤醒等待中的执行
+func (p *SchedulerPlugin) cancelRuns() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stopping = true
+	for _, runs := range p.running {
+		for _, run := range runs {
+			run.cancel()
+		}
+	}
+	p.runDone.Broadcast()
+}
+
+// skipTask 记录被跳过的执行并发送 task_skipped 事件
+func (p *SchedulerPlugin) skipTask(task *TaskInfo) {
+	p.mu.Lock()
+	task.SkippedCount++
+	p.mu.Unlock()
+
+	p.ctx.Logger.Warnf("Task %s skipped: concurrency limit reached", task.Name)
+	p.ctx.Agent.NotifyEvent("task_skipped", map[string]interface{}{
+		"task_id": task.ID,
+		"name":    task.Name,
+	})
+}
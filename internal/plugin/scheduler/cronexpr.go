@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"assistant_agent/internal/plugin"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// defaultNextRuns validate_expr 默认返回的触发时间数
+	defaultNextRuns = 5
+	// maxNextRuns validate_expr 最多返回的触发时间数
+	maxNextRuns = 100
+)
+
+// newCronParser 创建 cron 表达式解析器
+// 启用秒字段时同时接受 6 字段（秒 分 时 日 月 周）和 5 字段表达式，5 字段表达式的秒数为 0
+func newCronParser(secondsEnabled bool) cron.Parser {
+	fields := cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor
+	if secondsEnabled {
+		fields |= cron.SecondOptional
+	}
+	return cron.NewParser(fields)
+}
+
+// configureParser 按 seconds_enabled 配置创建解析器和调度器，解析和调度使用同一解析器
+func (p *SchedulerPlugin) configureParser() {
+	p.parser = newCronParser(p.configBool("seconds_enabled", true))
+	p.scheduler = cron.New(cron.WithParser(p.parser))
+}
+
+// parseCronExpr 校验 cron 表达式
+func (p *SchedulerPlugin) parseCronExpr(expr string) (cron.Schedule, error) {
+	schedule, err := p.parser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %v", err)
+	}
+	return schedule, nil
+}
+
+// handleValidateExpr 处理校验 cron 表达式命令，返回接下来的触发时间
+func (p *SchedulerPlugin) handleValidateExpr(args map[string]interface{}) (interface{}, error) {
+	expr, ok := args["expr"].(string)
+	if !ok {
+		return nil, fmt.Errorf("expr is required")
+	}
+
+	count := intArg(args, "count", defaultNextRuns)
+	if count <= 0 || count > maxNextRuns {
+		return nil, fmt.Errorf("count must be between 1 and %d", maxNextRuns)
+	}
+
+	schedule, err := p.parseCronExpr(expr)
+	if err != nil {
+		return map[string]interface{}{
+			"expr":  expr,
+			"valid": false,
+			"error": err.Error(),
+		}, nil
+	}
+
+	next := make([]time.Time, 0, count)
+	t := time.Now()
+	for len(next) < count {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+		next = append(next, t)
+	}
+
+	return map[string]interface{}{
+		"expr":      expr,
+		"valid":     true,
+		"next_runs": next,
+	}, nil
+}
+
+// configBool 读取布尔配置，配置值可以是布尔值或字符串
+func (p *SchedulerPlugin) configBool(key string, defaultValue bool) bool {
+	p.configMu.RLock()
+	defer p.configMu.RUnlock()
+	return plugin.ConfigBool(p.config, key, defaultValue)
+}
@@ -0,0 +1,179 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// defaultHistorySize 每个任务默认保留的执行记录数
+	defaultHistorySize = 100
+	// defaultHistoryLimit get_task_history 默认每页记录数
+	defaultHistoryLimit = 20
+	// historyFileName 执行历史在数据目录中的文件名
+	historyFileName = "scheduler_history.json"
+)
+
+// loadHistory 从数据目录加载执行历史，并清理超过保留期限的记录
+func (p *SchedulerPlugin) loadHistory() error {
+	if p.historyFile == "" || !p.ctx.Agent.FileExists(p.historyFile) {
+		return nil
+	}
+
+	data, err := p.ctx.Agent.ReadFile(p.historyFile)
+	if err != nil {
+		return err
+	}
+
+	history := make(map[string][]*TaskResult)
+	if err := json.Unmarshal(data, &history); err != nil {
+		return fmt.Errorf("invalid task history: %v", err)
+	}
+
+	p.mu.Lock()
+	p.history = history
+	p.pruneHistoryLocked(time.Now())
+	p.mu.Unlock()
+
+	return nil
+}
+
+// saveHistory 保存执行历史，未配置数据目录时只保存在内存中
+func (p *SchedulerPlugin) saveHistory() {
+	if p.historyFile == "" {
+		return
+	}
+
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	p.mu.RLock()
+	data, err := json.Marshal(p.history)
+	p.mu.RUnlock()
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to encode task history: %v", err)
+		return
+	}
+
+	if err := p.ctx.Agent.WriteFile(p.historyFile, data); err != nil {
+		p.ctx.Logger.Errorf("Failed to save task history: %v", err)
+	}
+}
+
+// recordResult 记录任务执行结果，超过 history_size 的旧记录被丢弃
+func (p *SchedulerPlugin) recordResult(taskID string, result *TaskResult) {
+	size := p.configInt("history_size", defaultHistorySize)
+
+	p.mu.Lock()
+	results := append(p.history[taskID], result)
+	if size > 0 && len(results) > size {
+		results = append([]*TaskResult(nil), results[len(results)-size:]...)
+	}
+	p.history[taskID] = results
+	p.pruneHistoryLocked(time.Now())
+	p.mu.Unlock()
+
+	p.saveHistory()
+}
+
+// pruneHistoryLocked 删除早于 retention_days 的执行记录，调用方需持有写锁
+func (p *SchedulerPlugin) pruneHistoryLocked(now time.Time) {
+	days := p.configInt("retention_days", 30)
+	if days <= 0 {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -days)
+
+	for taskID, results := range p.history {
+		kept := results[:0]
+		for _, result := range results {
+			if !result.StartTime.Before(cutoff) {
+				kept = append(kept, result)
+			}
+		}
+		if len(kept) == 0 {
+			delete(p.history, taskID)
+		} else {
+			p.history[taskID] = kept
+		}
+	}
+}
+
+// handleGetTaskHistory 处理获取任务执行历史命令，按时间倒序分页返回
+func (p *SchedulerPlugin) handleGetTaskHistory(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	offset := intArg(args, "offset", 0)
+	limit := intArg(args, "limit", defaultHistoryLimit)
+	if offset < 0 || limit <= 0 {
+		return nil, fmt.Errorf("invalid offset or limit")
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// 任务删除前的历史同样可以查询
+	results, hasHistory := p.history[id]
+	if _, exists := p.tasks[id]; !exists && !hasHistory {
+		return nil, fmt.Errorf("task not found")
+	}
+
+	page := make([]*TaskResult, 0, limit)
+	for i := len(results) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, results[i])
+	}
+
+	return map[string]interface{}{
+		"id":      id,
+		"total":   len(results),
+		"offset":  offset,
+		"limit":   limit,
+		"history": page,
+	}, nil
+}
+
+// configInt 读取整数配置，配置值可以是数值或数字字符串
+func (p *SchedulerPlugin) configInt(key string, defaultValue int) int {
+	p.configMu.RLock()
+	defer p.configMu.RUnlock()
+	return plugin.ConfigInt(p.config, key, defaultValue)
+}
+
+// intArg 读取整数参数
+func intArg(args map[string]interface{}, key string, defaultValue int) int {
+	if n, ok := toInt(args[key]); ok {
+		return n
+	}
+	return defaultValue
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// historyPath 执行历史文件路径，数据目录为空时不持久化
+func historyPath(dataDir string) string {
+	if dataDir == "" {
+		return ""
+	}
+	return filepath.Join(dataDir, historyFileName)
+}
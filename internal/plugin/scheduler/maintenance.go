@@ -0,0 +1,247 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// BlackoutWindow 禁止按计划执行任务的时间段，按 Agent 本地时间计算，End 早于 Start 时跨越午夜
+type BlackoutWindow struct {
+	Start string   `json:"start"`          // HH:MM
+	End   string   `json:"end"`            // HH:MM
+	Days  []string `json:"days,omitempty"` // mon、tue ... sun，为空表示每天，跨午夜时按开始当天计算
+}
+
+// maintenanceState 调度器维护模式，维护期间所有按计划触发的任务都被抑制
+type maintenanceState struct {
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until,omitempty"` // 零值表示直到手动关闭
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// validate 校验时间段
+func (w BlackoutWindow) validate() error {
+	start, err := plugin.ParseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := plugin.ParseClock(w.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("blackout window start and end must differ")
+	}
+	for _, day := range w.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid weekday: %s", day)
+		}
+	}
+	return nil
+}
+
+// contains 判断时间是否落在时间段内
+func (w BlackoutWindow) contains(t time.Time) bool {
+	start, err := plugin.ParseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := plugin.ParseClock(w.End)
+	if err != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case start < end:
+		if minute < start || minute >= end {
+			return false
+		}
+	case minute >= start:
+		// 跨午夜时间段的前半部分
+	case minute < end:
+		// 跨午夜时间段的后半部分属于前一天开始的时间段
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (w BlackoutWindow) String() string {
+	if len(w.Days) == 0 {
+		return w.Start + "-" + w.End
+	}
+	return w.Start + "-" + w.End + " " + strings.Join(w.Days, ",")
+}
+
+// parseBlackoutWindows 解析 blackout_windows 参数
+func parseBlackoutWindows(value interface{}) ([]BlackoutWindow, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		if value == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("blackout_windows must be a list")
+	}
+
+	windows := make([]BlackoutWindow, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("blackout window must be an object")
+		}
+		window := BlackoutWindow{}
+		window.Start, _ = fields["start"].(string)
+		window.End, _ = fields["end"].(string)
+		if days, ok := fields["days"].([]interface{}); ok {
+			for _, day := range days {
+				if d, ok := day.(string); ok {
+					window.Days = append(window.Days, d)
+				}
+			}
+		}
+		if err := window.validate(); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// suppressReason 返回按计划触发的任务被抑制的原因，可以执行时返回空字符串
+func (p *SchedulerPlugin) suppressReason(task *TaskInfo, now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.maintenance != nil {
+		if p.maintenance.Until.IsZero() || now.Before(p.maintenance.Until) {
+			return "maintenance mode"
+		}
+		// 维护模式到期自动关闭
+		p.maintenance = nil
+	}
+
+	for _, window := range task.BlackoutWindows {
+		if window.contains(now) {
+			return "blackout window " + window.String()
+		}
+	}
+	return ""
+}
+
+// suppressTask 记录被抑制的触发，保存到执行历史并发送 task_suppressed 事件
+func (p *SchedulerPlugin) suppressTask(task *TaskInfo, reason string, now time.Time) {
+	p.mu.Lock()
+	task.SuppressedCount++
+	p.lastResults[task.ID] = ChainSuppressed
+	p.mu.Unlock()
+
+	p.recordResult(task.ID, &TaskResult{
+		StartTime:  now,
+		EndTime:    now,
+		ExitCode:   -1,
+		Error:      "suppressed: " + reason,
+		Suppressed: true,
+	})
+
+	p.ctx.Logger.Infof("Task %s suppressed: %s", task.Name, reason)
+	p.ctx.Agent.NotifyEvent("task_suppressed", map[string]interface{}{
+		"task_id": task.ID,
+		"name":    task.Name,
+		"reason":  reason,
+	})
+}
+
+// handleSetMaintenance 处理开启或关闭维护模式命令
+func (p *SchedulerPlugin) handleSetMaintenance(args map[string]interface{}) (interface{}, error) {
+	enabled, ok := args["enabled"].(bool)
+	if !ok {
+		return nil, fmt.Errorf("enabled is required")
+	}
+
+	if !enabled {
+		p.mu.Lock()
+		p.maintenance = nil
+		p.mu.Unlock()
+		p.ctx.Logger.Info("Scheduler maintenance mode disabled")
+		return p.handleGetMaintenance(nil)
+	}
+
+	now := time.Now()
+	state := &maintenanceState{Since: now}
+	state.Reason, _ = args["reason"].(string)
+
+	// until 或 duration 设置自动结束时间
+	until, hasUntil := args["until"].(string)
+	duration, hasDuration := args["duration"].(string)
+	switch {
+	case hasUntil && hasDuration:
+		return nil, fmt.Errorf("until and duration are mutually exclusive")
+	case hasUntil:
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until: %v", err)
+		}
+		state.Until = t
+	case hasDuration:
+		d, err := time.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration: %s", duration)
+		}
+		state.Until = now.Add(d)
+	}
+	if !state.Until.IsZero() && !state.Until.After(now) {
+		return nil, fmt.Errorf("maintenance end time is in the past")
+	}
+
+	p.mu.Lock()
+	p.maintenance = state
+	p.mu.Unlock()
+
+	p.ctx.Logger.Infof("Scheduler maintenance mode enabled: %s", state.Reason)
+	return p.handleGetMaintenance(nil)
+}
+
+// handleGetMaintenance 处理查询维护模式命令
+func (p *SchedulerPlugin) handleGetMaintenance(args map[string]interface{}) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.maintenance
+	if state != nil && !state.Until.IsZero() && !time.Now().Before(state.Until) {
+		p.maintenance = nil
+		state = nil
+	}
+	if state == nil {
+		return map[string]interface{}{"enabled": false}, nil
+	}
+
+	result := map[string]interface{}{
+		"enabled": true,
+		"reason":  state.Reason,
+		"since":   state.Since,
+	}
+	if !state.Until.IsZero() {
+		result["until"] = state.Until
+	}
+	return result, nil
+}
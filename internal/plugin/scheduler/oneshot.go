@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// onceSchedule 只在指定时间触发一次的调度，实现 cron.Schedule
+type onceSchedule struct {
+	at time.Time
+}
+
+// Next 返回触发时间，已触发后返回零值，调度器不再执行
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if t.Before(s.at) {
+		return s.at
+	}
+	return time.Time{}
+}
+
+// parseRunAt 解析 run_at（RFC3339 时间）或 delay（如 15m）参数，都未设置时返回 nil
+func parseRunAt(args map[string]interface{}, now time.Time) (*time.Time, error) {
+	runAt, hasRunAt := args["run_at"].(string)
+	delay, hasDelay := args["delay"].(string)
+	if hasRunAt && hasDelay {
+		return nil, fmt.Errorf("run_at and delay are mutually exclusive")
+	}
+
+	var at time.Time
+	switch {
+	case hasRunAt:
+		parsed, err := time.Parse(time.RFC3339, runAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid run_at: %v", err)
+		}
+		at = parsed
+	case hasDelay:
+		duration, err := time.ParseDuration(delay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay: %v", err)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("delay must be positive")
+		}
+		at = now.Add(duration)
+	default:
+		return nil, nil
+	}
+
+	if !at.After(now) {
+		return nil, fmt.Errorf("run_at %s is in the past", at.Format(time.RFC3339))
+	}
+	return &at, nil
+}
+
+// removeCompletedTask 一次性任务执行后从任务列表中删除，执行历史保留
+func (p *SchedulerPlugin) removeCompletedTask(task *TaskInfo) {
+	p.mu.Lock()
+	// 仍被其他任务依赖时保留
+	if len(p.dependentsLocked(task.ID)) > 0 {
+		p.mu.Unlock()
+		return
+	}
+	if p.tasks[task.ID] == task {
+		if task.EntryID != 0 {
+			p.scheduler.Remove(task.EntryID)
+			task.EntryID = 0
+		}
+		delete(p.tasks, task.ID)
+		delete(p.lastResults, task.ID)
+	}
+	p.mu.Unlock()
+
+	p.ctx.Logger.Infof("One-shot task %s completed and removed", task.Name)
+}
@@ -1,10 +1,14 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"assistant_agent/internal/container"
+	"assistant_agent/internal/executor"
 	"assistant_agent/internal/plugin"
 
 	"github.com/robfig/cron/v3"
@@ -12,13 +16,28 @@ import (
 
 // SchedulerPlugin 定时任务调度器插件
 type SchedulerPlugin struct {
-	ctx       *plugin.PluginContext
-	config    map[string]interface{}
-	status    *plugin.PluginStatus
-	scheduler *cron.Cron
-	tasks     map[string]*TaskInfo
-	mu        sync.RWMutex
-	stopChan  chan struct{}
+	ctx        *plugin.PluginContext
+	config     map[string]interface{}
+	status     *plugin.PluginStatus
+	scheduler  *cron.Cron
+	parser     cron.Parser
+	containers *container.Manager
+	tasks      map[string]*TaskInfo
+	mu         sync.RWMutex
+	stopChan   chan struct{}
+
+	history     map[string][]*TaskResult // 按任务 ID 保存的执行历史，按时间顺序
+	lastResults map[string]string        // 按任务 ID 保存最近一次的结果（ChainSuccess 等），跨任务链判断依赖
+	historyFile string
+	saveMu      sync.Mutex
+	configMu    sync.RWMutex
+
+	running  map[string][]*taskRun // 按任务 ID 保存正在执行的实例
+	runDone  *sync.Cond            // 任务实例结束时广播，与 mu 配合使用
+	slots    chan struct{}         // 全局执行名额，为 nil 时不限制
+	stopping bool
+
+	maintenance *maintenanceState // 为 nil 表示未处于维护模式
 }
 
 // TaskInfo 任务信息
@@ -27,7 +46,9 @@ type TaskInfo struct {
 	Name         string                 `json:"name"`
 	Description  string                 `json:"description"`
 	CronExpr     string                 `json:"cron_expr"`
+	RunAt        *time.Time             `json:"run_at,omitempty"` // 一次性任务的执行时间，设置后忽略 CronExpr
 	Command      string                 `json:"command"`
+	Script       string                 `json:"script,omitempty"` // 脚本库引用 name@version，设置后忽略 Command
 	Args         []string               `json:"args"`
 	Type         string                 `json:"type"` // shell, powershell, container
 	Enabled      bool                   `json:"enabled"`
@@ -40,6 +61,20 @@ type TaskInfo struct {
 	LastResult   *TaskResult            `json:"last_result,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata"`
 	EntryID      cron.EntryID           `json:"entry_id"`
+
+	MaxConcurrent int    `json:"max_concurrent"`           // 同时执行的实例数上限，0 表示不限制
+	OverlapPolicy string `json:"overlap_policy,omitempty"` // 达到上限时的策略：skip、queue、kill-previous
+	SkippedCount  int64  `json:"skipped_count"`
+
+	DependsOn []string `json:"depends_on,omitempty"` // 依赖的任务 ID，设置后由依赖的任务成功执行后触发
+
+	Timeout    int      `json:"timeout,omitempty"`     // 超时时间（秒），0 表示使用插件配置 default_timeout
+	Env        []string `json:"env,omitempty"`         // 环境变量，格式为 KEY=VALUE
+	WorkingDir string   `json:"working_dir,omitempty"` // 工作目录，为空时使用 Agent 工作目录
+	Confirmed  bool     `json:"confirmed,omitempty"`   // 已确认执行命中高危规则的命令，修改命令或脚本后需重新确认
+
+	BlackoutWindows []BlackoutWindow `json:"blackout_windows,omitempty"` // 禁止按计划执行的时间段
+	SuppressedCount int64            `json:"suppressed_count"`
 }
 
 // TaskResult 任务执行结果
@@ -51,6 +86,8 @@ type TaskResult struct {
 	Output    string    `json:"output"`
 	Error     string    `json:"error,omitempty"`
 	Success   bool      `json:"success"`
+
+	Suppressed bool `json:"suppressed,omitempty"` // 因维护模式或禁止执行时间段未执行
 }
 
 // TaskRequest 任务请求
@@ -58,20 +95,37 @@ type TaskRequest struct {
 	Name        string            `json:"name"`
 	Description string            `json:"description"`
 	CronExpr    string            `json:"cron_expr"`
+	RunAt       string            `json:"run_at,omitempty"` // RFC3339 时间，与 CronExpr 和 Delay 互斥
+	Delay       string            `json:"delay,omitempty"`  // 延迟执行时间，如 15m
 	Command     string            `json:"command"`
+	Script      string            `json:"script,omitempty"`
 	Args        []string          `json:"args"`
 	Type        string            `json:"type"`
 	Enabled     bool              `json:"enabled"`
 	Metadata    map[string]string `json:"metadata"`
+
+	MaxConcurrent int    `json:"max_concurrent"`
+	OverlapPolicy string `json:"overlap_policy,omitempty"`
+
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	Timeout    int      `json:"timeout,omitempty"`
+	Env        []string `json:"env,omitempty"`
+	WorkingDir string   `json:"working_dir,omitempty"`
+
+	BlackoutWindows []BlackoutWindow `json:"blackout_windows,omitempty"`
 }
 
 // NewSchedulerPlugin 创建定时任务调度器插件
 func NewSchedulerPlugin() *SchedulerPlugin {
-	return &SchedulerPlugin{
-		config:    make(map[string]interface{}),
-		tasks:     make(map[string]*TaskInfo),
-		stopChan:  make(chan struct{}),
-		scheduler: cron.New(cron.WithSeconds()),
+	p := &SchedulerPlugin{
+		running:     make(map[string][]*taskRun),
+		config:      make(map[string]interface{}),
+		tasks:       make(map[string]*TaskInfo),
+		history:     make(map[string][]*TaskResult),
+		lastResults: make(map[string]string),
+		stopChan:    make(chan struct{}),
+		parser:      newCronParser(true),
 		status: &plugin.PluginStatus{
 			Status: "stopped",
 			Metrics: map[string]interface{}{
@@ -79,15 +133,19 @@ func NewSchedulerPlugin() *SchedulerPlugin {
 				"active_tasks":     0,
 				"enabled_tasks":    0,
 				"total_executions": 0,
+				"running_tasks":    0,
 			},
 		},
 	}
+	p.runDone = sync.NewCond(&p.mu)
+	p.scheduler = cron.New(cron.WithParser(p.parser))
+	return p
 }
 
 // Info 返回插件信息
 func (p *SchedulerPlugin) Info() *plugin.PluginInfo {
 	return &plugin.PluginInfo{
-		Name:        "task-scheduler",
+		Name:        plugin.SchedulerPluginName,
 		Version:     "1.0.0",
 		Description: "Cron-based task scheduler plugin",
 		Author:      "Assistant Agent Team",
@@ -98,6 +156,12 @@ func (p *SchedulerPlugin) Info() *plugin.PluginInfo {
 			"max_concurrent_tasks": "10",
 			"default_timeout":      "300",
 			"retention_days":       "30",
+			"history_size":         "100",
+			"seconds_enabled":      "true",
+		},
+		Permissions: &plugin.PluginPermissions{
+			Exec:       true,
+			WritePaths: []string{plugin.PathDataDir},
 		},
 	}
 }
@@ -109,6 +173,18 @@ func (p *SchedulerPlugin) Init(ctx *plugin.PluginContext) error {
 
 	// 设置默认配置
 	p.setDefaultConfig()
+	p.configureParser()
+
+	// container 类型任务通过容器运行时执行
+	runtime, _ := ctx.Agent.GetConfig("agent.container_runtime").(string)
+	p.containers = container.NewManager(runtime)
+
+	// 执行历史保存在数据目录中
+	dataDir, _ := ctx.Agent.GetConfig("agent.data_dir").(string)
+	p.historyFile = historyPath(dataDir)
+	if err := p.loadHistory(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load task history: %v", err)
+	}
 
 	p.ctx.Logger.Info("Task scheduler plugin initialized")
 	return nil
@@ -119,6 +195,15 @@ func (p *SchedulerPlugin) Start() error {
 	p.status.Status = "running"
 	p.status.StartTime = time.Now()
 
+	// 全局并发名额，修改配置后插件会被重启，每次启动使用新的停止信号
+	p.mu.Lock()
+	p.stopping = false
+	p.stopChan = make(chan struct{})
+	if limit := p.configInt("max_concurrent_tasks", 10); limit > 0 {
+		p.slots = make(chan struct{}, limit)
+	}
+	p.mu.Unlock()
+
 	// 启动调度器
 	p.scheduler.Start()
 
@@ -133,8 +218,9 @@ func (p *SchedulerPlugin) Start() error {
 func (p *SchedulerPlugin) Stop() error {
 	p.status.Status = "stopped"
 
-	// 停止调度器
+	// 停止调度器并终止正在执行的任务
 	p.scheduler.Stop()
+	p.cancelRuns()
 	close(p.stopChan)
 
 	p.ctx.Logger.Info("Task scheduler plugin stopped")
@@ -164,11 +250,100 @@ func (p *SchedulerPlugin) HandleCommand(command string, args map[string]interfac
 		return p.handleGetTaskStatus(args)
 	case "get_next_runs":
 		return p.handleGetNextRuns(args)
+	case "get_task_history":
+		return p.handleGetTaskHistory(args)
+	case "run_chain":
+		return p.handleRunChain(args)
+	case "set_maintenance":
+		return p.handleSetMaintenance(args)
+	case "get_maintenance":
+		return p.handleGetMaintenance(args)
+	case "validate_expr":
+		return p.handleValidateExpr(args)
 	default:
 		return nil, plugin.ErrInvalidCommand
 	}
 }
 
+// CommandSchemas 返回命令参数声明，插件管理器据此校验参数
+func (p *SchedulerPlugin) CommandSchemas() map[string]*plugin.CommandSchema {
+	return schedulerCommandSchemas
+}
+
+var (
+	overlapPolicies = []string{OverlapSkip, OverlapQueue, OverlapKillPrevious}
+	taskTypes       = []string{"shell", "powershell", "container"}
+
+	taskIDArgs = map[string]plugin.ArgSchema{"id": {Type: plugin.ArgString, Required: true}}
+
+	schedulerCommandSchemas = map[string]*plugin.CommandSchema{
+		"add_task": {Args: map[string]plugin.ArgSchema{
+			"name":        {Type: plugin.ArgString, Required: true},
+			"cron_expr":   {Type: plugin.ArgString},
+			"run_at":      {Type: plugin.ArgString, Description: "一次性执行时间（RFC3339）"},
+			"delay":       {Type: plugin.ArgString, Description: "延迟一次性执行，如 15m"},
+			"command":     {Type: plugin.ArgString},
+			"script":      {Type: plugin.ArgString, Description: "脚本库中的脚本名，代替 command"},
+			"description": {Type: plugin.ArgString},
+			"type":        {Type: plugin.ArgString, Default: "shell", Enum: taskTypes},
+			"enabled":     {Type: plugin.ArgBool},
+			"args":        {Type: plugin.ArgArray},
+
+			"max_concurrent": {Type: plugin.ArgInteger, Description: "同时执行的实例数上限，0 表示不限制"},
+			"overlap_policy": {Type: plugin.ArgString, Enum: overlapPolicies},
+			"depends_on":     {Type: plugin.ArgArray, Description: "依赖的任务 ID，代替 cron_expr"},
+			"timeout":        {Type: plugin.ArgInteger, Description: "超时时间（秒）"},
+			"env":            {Type: plugin.ArgArray, Description: "环境变量，格式为 KEY=VALUE"},
+			"working_dir":    {Type: plugin.ArgString},
+
+			"blackout_windows": {Type: plugin.ArgArray, Description: "禁止执行的时间段，如 [{start: \"09:00\", end: \"18:00\"}]"},
+		}},
+		"update_task": {Args: map[string]plugin.ArgSchema{
+			"id":          {Type: plugin.ArgString, Required: true},
+			"name":        {Type: plugin.ArgString},
+			"cron_expr":   {Type: plugin.ArgString},
+			"run_at":      {Type: plugin.ArgString},
+			"delay":       {Type: plugin.ArgString},
+			"command":     {Type: plugin.ArgString},
+			"script":      {Type: plugin.ArgString},
+			"description": {Type: plugin.ArgString},
+			"type":        {Type: plugin.ArgString, Enum: taskTypes},
+
+			"max_concurrent": {Type: plugin.ArgInteger},
+			"overlap_policy": {Type: plugin.ArgString, Enum: overlapPolicies},
+			"depends_on":     {Type: plugin.ArgArray},
+			"timeout":        {Type: plugin.ArgInteger},
+			"env":            {Type: plugin.ArgArray},
+			"working_dir":    {Type: plugin.ArgString},
+
+			"blackout_windows": {Type: plugin.ArgArray},
+		}},
+		"remove_task":     {Args: taskIDArgs},
+		"enable_task":     {Args: taskIDArgs},
+		"disable_task":    {Args: taskIDArgs},
+		"run_task":        {Args: taskIDArgs},
+		"get_task":        {Args: taskIDArgs},
+		"get_task_status": {Args: taskIDArgs},
+		"get_next_runs":   {Args: taskIDArgs},
+		"run_chain":       {Args: taskIDArgs},
+		"validate_expr": {Args: map[string]plugin.ArgSchema{
+			"expr":  {Type: plugin.ArgString, Required: true},
+			"count": {Type: plugin.ArgInteger, Default: float64(defaultNextRuns)},
+		}},
+		"set_maintenance": {Args: map[string]plugin.ArgSchema{
+			"enabled":  {Type: plugin.ArgBool, Required: true},
+			"reason":   {Type: plugin.ArgString},
+			"until":    {Type: plugin.ArgString, Description: "维护结束时间（RFC3339）"},
+			"duration": {Type: plugin.ArgString, Description: "维护时长，如 2h"},
+		}},
+		"get_task_history": {Args: map[string]plugin.ArgSchema{
+			"id":     {Type: plugin.ArgString, Required: true},
+			"offset": {Type: plugin.ArgInteger, Default: float64(0)},
+			"limit":  {Type: plugin.ArgInteger, Default: float64(defaultHistoryLimit)},
+		}},
+	}
+)
+
 // HandleEvent 处理事件
 func (p *SchedulerPlugin) HandleEvent(eventType string, data map[string]interface{}) error {
 	switch eventType {
@@ -207,6 +382,13 @@ func (p *SchedulerPlugin) Status() *plugin.PluginStatus {
 	p.status.Metrics["active_tasks"] = activeCount
 	p.status.Metrics["enabled_tasks"] = enabledCount
 	p.status.Metrics["total_executions"] = totalExecutions
+	p.status.Metrics["maintenance"] = p.maintenance != nil
+
+	runningTasks := 0
+	for _, runs := range p.running {
+		runningTasks += len(runs)
+	}
+	p.status.Metrics["running_tasks"] = runningTasks
 
 	return p.status
 }
@@ -221,11 +403,15 @@ func (p *SchedulerPlugin) Health() error {
 
 // GetConfig 获取配置
 func (p *SchedulerPlugin) GetConfig() map[string]interface{} {
+	p.configMu.RLock()
+	defer p.configMu.RUnlock()
 	return p.config
 }
 
 // SetConfig 设置配置
 func (p *SchedulerPlugin) SetConfig(config map[string]interface{}) error {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
 	p.config = config
 	return nil
 }
@@ -237,13 +423,29 @@ func (p *SchedulerPlugin) handleAddTask(args map[string]interface{}) (interface{
 		return nil, fmt.Errorf("name is required")
 	}
 
-	cronExpr, ok := args["cron_expr"].(string)
-	if !ok {
-		return nil, fmt.Errorf("cron_expr is required")
+	// 按 cron 表达式周期执行，或通过 run_at、delay 执行一次
+	cronExpr, _ := args["cron_expr"].(string)
+	runAt, err := parseRunAt(args, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	dependsOn, err := parseDependsOn(args["depends_on"])
+	if err != nil {
+		return nil, err
+	}
+	if cronExpr != "" && runAt != nil {
+		return nil, fmt.Errorf("cron_expr cannot be combined with run_at or delay")
+	}
+	// 有依赖的任务由依赖的任务触发，不能再设置调度时间
+	hasSchedule := cronExpr != "" || runAt != nil
+	if hasSchedule == (len(dependsOn) > 0) {
+		return nil, fmt.Errorf("exactly one of cron_expr, run_at, delay or depends_on is required")
 	}
 
-	command, ok := args["command"].(string)
-	if !ok {
+	// 可通过 script 引用脚本库中的脚本代替内联命令
+	command, _ := args["command"].(string)
+	script, _ := args["script"].(string)
+	if command == "" && script == "" {
 		return nil, fmt.Errorf("command is required")
 	}
 
@@ -252,12 +454,41 @@ func (p *SchedulerPlugin) handleAddTask(args map[string]interface{}) (interface{
 	if taskType == "" {
 		taskType = "shell"
 	}
+	if !containsString(taskTypes, taskType) {
+		return nil, fmt.Errorf("unsupported task type: %s", taskType)
+	}
+
+	timeout := intArg(args, "timeout", 0)
+	if timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+	env, err := parseEnv(args["env"])
+	if err != nil {
+		return nil, err
+	}
+	workingDir, _ := args["working_dir"].(string)
+	confirmed, _ := args["confirmed"].(bool)
+	blackoutWindows, err := parseBlackoutWindows(args["blackout_windows"])
+	if err != nil {
+		return nil, err
+	}
 
 	enabled, _ := args["enabled"].(bool)
 
+	maxConcurrent := intArg(args, "max_concurrent", 0)
+	if maxConcurrent < 0 {
+		return nil, fmt.Errorf("max_concurrent must not be negative")
+	}
+	overlapPolicy, _ := args["overlap_policy"].(string)
+	if err := validateOverlapPolicy(overlapPolicy); err != nil {
+		return nil, err
+	}
+
 	// 验证cron表达式
-	if _, err := cron.ParseStandard(cronExpr); err != nil {
-		return nil, fmt.Errorf("invalid cron expression: %v", err)
+	if cronExpr != "" {
+		if _, err := p.parseCronExpr(cronExpr); err != nil {
+			return nil, err
+		}
 	}
 
 	// 创建任务
@@ -267,7 +498,9 @@ func (p *SchedulerPlugin) handleAddTask(args map[string]interface{}) (interface{
 		Name:         name,
 		Description:  description,
 		CronExpr:     cronExpr,
+		RunAt:        runAt,
 		Command:      command,
+		Script:       script,
 		Type:         taskType,
 		Enabled:      enabled,
 		Status:       "active",
@@ -275,6 +508,17 @@ func (p *SchedulerPlugin) handleAddTask(args map[string]interface{}) (interface{
 		SuccessCount: 0,
 		FailureCount: 0,
 		Metadata:     make(map[string]interface{}),
+
+		MaxConcurrent: maxConcurrent,
+		OverlapPolicy: overlapPolicy,
+		DependsOn:     dependsOn,
+
+		Timeout:    timeout,
+		Env:        env,
+		WorkingDir: workingDir,
+		Confirmed:  confirmed,
+
+		BlackoutWindows: blackoutWindows,
 	}
 
 	// 处理参数
@@ -290,6 +534,10 @@ func (p *SchedulerPlugin) handleAddTask(args map[string]interface{}) (interface{
 
 	// 添加到任务列表
 	p.mu.Lock()
+	if err := p.validateDependenciesLocked(taskID, dependsOn); err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
 	p.tasks[taskID] = task
 	p.mu.Unlock()
 
@@ -321,6 +569,23 @@ func (p *SchedulerPlugin) handleUpdateTask(args map[string]interface{}) (interfa
 		return nil, fmt.Errorf("task not found")
 	}
 
+	// 设置依赖后任务改为由依赖的任务触发
+	var dependsOn []string
+	if value, ok := args["depends_on"]; ok {
+		deps, err := parseDependsOn(value)
+		if err == nil {
+			err = p.validateDependenciesLocked(id, deps)
+		}
+		if err == nil && len(deps) > 0 && (args["cron_expr"] != nil || args["run_at"] != nil || args["delay"] != nil) {
+			err = fmt.Errorf("depends_on cannot be combined with cron_expr, run_at or delay")
+		}
+		if err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		dependsOn = deps
+	}
+
 	// 更新字段
 	if name, ok := args["name"].(string); ok {
 		task.Name = name
@@ -329,22 +594,103 @@ func (p *SchedulerPlugin) handleUpdateTask(args map[string]interface{}) (interfa
 		task.Description = description
 	}
 	if cronExpr, ok := args["cron_expr"].(string); ok {
-		if _, err := cron.ParseStandard(cronExpr); err != nil {
+		if _, err := p.parseCronExpr(cronExpr); err != nil {
 			p.mu.Unlock()
-			return nil, fmt.Errorf("invalid cron expression: %v", err)
+			return nil, err
 		}
 		task.CronExpr = cronExpr
+		task.RunAt = nil
+		task.DependsOn = nil
+	}
+	runAt, err := parseRunAt(args, time.Now())
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	if runAt != nil {
+		if _, ok := args["cron_expr"]; ok {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("cron_expr cannot be combined with run_at or delay")
+		}
+		task.RunAt = runAt
+		task.CronExpr = ""
+		task.DependsOn = nil
+	}
+	if len(dependsOn) > 0 {
+		task.DependsOn = dependsOn
+		task.CronExpr = ""
+		task.RunAt = nil
 	}
 	if command, ok := args["command"].(string); ok {
 		task.Command = command
 	}
+	if script, ok := args["script"].(string); ok {
+		task.Script = script
+	}
+	// 确认只对确认时的命令有效，修改命令或脚本时需重新携带 confirmed
+	_, commandChanged := args["command"]
+	_, scriptChanged := args["script"]
+	if confirmed, ok := args["confirmed"].(bool); ok || commandChanged || scriptChanged {
+		task.Confirmed = confirmed
+	}
 	if taskType, ok := args["type"].(string); ok {
+		if !containsString(taskTypes, taskType) {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("unsupported task type: %s", taskType)
+		}
 		task.Type = taskType
 	}
+	if _, ok := args["timeout"]; ok {
+		timeout := intArg(args, "timeout", 0)
+		if timeout < 0 {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("timeout must not be negative")
+		}
+		task.Timeout = timeout
+	}
+	if value, ok := args["env"]; ok {
+		env, err := parseEnv(value)
+		if err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		task.Env = env
+	}
+	if workingDir, ok := args["working_dir"].(string); ok {
+		task.WorkingDir = workingDir
+	}
+	if value, ok := args["blackout_windows"]; ok {
+		windows, err := parseBlackoutWindows(value)
+		if err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		task.BlackoutWindows = windows
+	}
+	if _, ok := args["max_concurrent"]; ok {
+		maxConcurrent := intArg(args, "max_concurrent", 0)
+		if maxConcurrent < 0 {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("max_concurrent must not be negative")
+		}
+		task.MaxConcurrent = maxConcurrent
+		// 放宽限制后唤醒排队中的执行
+		p.runDone.Broadcast()
+	}
+	if overlapPolicy, ok := args["overlap_policy"].(string); ok {
+		if err := validateOverlapPolicy(overlapPolicy); err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		task.OverlapPolicy = overlapPolicy
+	}
 
 	// 如果任务已启用，需要重新添加到调度器
-	if task.Enabled && task.EntryID != 0 {
-		p.scheduler.Remove(task.EntryID)
+	if task.Enabled {
+		if task.EntryID != 0 {
+			p.scheduler.Remove(task.EntryID)
+			task.EntryID = 0
+		}
 		if err := p.addToScheduler(task); err != nil {
 			p.mu.Unlock()
 			return nil, err
@@ -373,13 +719,20 @@ func (p *SchedulerPlugin) handleRemoveTask(args map[string]interface{}) (interfa
 		return nil, fmt.Errorf("task not found")
 	}
 
+	// 被其他任务依赖时不能删除
+	if dependents := p.dependentsLocked(id); len(dependents) > 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("task is a dependency of %s", strings.Join(dependents, ", "))
+	}
+
 	// 从调度器中移除
 	if task.EntryID != 0 {
 		p.scheduler.Remove(task.EntryID)
 	}
 
-	// 从任务列表中移除
+	// 从任务列表中移除，执行历史保留到超过 retention_days 后清理
 	delete(p.tasks, id)
+	delete(p.lastResults, id)
 	p.mu.Unlock()
 
 	return map[string]interface{}{
@@ -537,11 +890,29 @@ func (p *SchedulerPlugin) handleGetTaskStatus(args map[string]interface{}) (inte
 
 // addToScheduler 添加任务到调度器
 func (p *SchedulerPlugin) addToScheduler(task *TaskInfo) error {
-	entryID, err := p.scheduler.AddFunc(task.CronExpr, func() {
-		p.executeTask(task)
-	})
-	if err != nil {
-		return err
+	// 有依赖的任务由依赖的任务触发
+	if task.CronExpr == "" && task.RunAt == nil {
+		return nil
+	}
+
+	var entryID cron.EntryID
+	if task.RunAt != nil {
+		if !task.RunAt.After(time.Now()) {
+			return fmt.Errorf("run_at %s is in the past", task.RunAt.Format(time.RFC3339))
+		}
+		// 一次性任务执行后自动删除
+		entryID = p.scheduler.Schedule(onceSchedule{at: *task.RunAt}, cron.FuncJob(func() {
+			p.runChain(task, true)
+			p.removeCompletedTask(task)
+		}))
+	} else {
+		var err error
+		entryID, err = p.scheduler.AddFunc(task.CronExpr, func() {
+			p.runChain(task, true)
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	task.EntryID = entryID
@@ -553,8 +924,22 @@ func (p *SchedulerPlugin) addToScheduler(task *TaskInfo) error {
 	return nil
 }
 
-// executeTask 执行任务
-func (p *SchedulerPlugin) executeTask(task *TaskInfo) {
+// executeTask 执行任务，返回执行结果，本次执行被跳过时返回 nil
+func (p *SchedulerPlugin) executeTask(task *TaskInfo) *TaskResult {
+	// 按任务的重叠策略和全局并发数限制执行
+	run := p.acquireRun(task)
+	if run == nil {
+		p.skipTask(task)
+		return nil
+	}
+	defer p.releaseRun(task, run)
+
+	if !p.acquireSlot(run) {
+		p.skipTask(task)
+		return nil
+	}
+	defer p.releaseSlot()
+
 	startTime := time.Now()
 
 	// 更新任务状态
@@ -575,8 +960,7 @@ func (p *SchedulerPlugin) executeTask(task *TaskInfo) {
 		StartTime: startTime,
 	}
 
-	// 通过执行器插件执行命令
-	execResult, err := p.ctx.Agent.ExecuteCommand(task.Command, task.Args, 5*time.Minute)
+	execResult, exitCode, err := p.runTask(run.ctx, task)
 
 	result.EndTime = time.Now()
 	result.Duration = result.EndTime.Sub(startTime).Seconds()
@@ -584,7 +968,8 @@ func (p *SchedulerPlugin) executeTask(task *TaskInfo) {
 	if err != nil {
 		result.Success = false
 		result.Error = err.Error()
-		result.ExitCode = -1
+		result.Output = execResult
+		result.ExitCode = exitCode
 
 		p.mu.Lock()
 		task.FailureCount++
@@ -618,13 +1003,124 @@ func (p *SchedulerPlugin) executeTask(task *TaskInfo) {
 	// 更新任务结果
 	p.mu.Lock()
 	task.LastResult = result
+	if result.Success {
+		p.lastResults[task.ID] = ChainSuccess
+	} else {
+		p.lastResults[task.ID] = ChainFailed
+	}
 	p.mu.Unlock()
 
+	p.recordResult(task.ID, result)
+
 	// 计算下次运行时间
 	if task.EntryID != 0 {
 		entry := p.scheduler.Entry(task.EntryID)
 		task.NextRun = entry.Next
 	}
+
+	return result
+}
+
+// runTask 按任务类型执行任务，返回输出和退出码，执行失败或无法执行时退出码为 -1
+// shell、powershell 类型通过 Agent 执行器执行，container 类型以 Command 为镜像、Args 为容器命令运行一次性容器
+// ctx 取消时终止任务
+func (p *SchedulerPlugin) runTask(ctx context.Context, task *TaskInfo) (string, int, error) {
+	timeout := p.taskTimeout(task)
+
+	// 脚本库中的脚本由 Agent 解析并校验摘要后执行，类型由脚本决定
+	if task.Type != "container" || task.Script != "" {
+		result, err := p.ctx.Agent.RunCommand(ctx, &executor.Command{
+			ID:         fmt.Sprintf("%s_%d", task.ID, time.Now().UnixNano()),
+			Type:       executor.CommandType(task.Type),
+			Script:     task.Command,
+			ScriptRef:  task.Script,
+			Args:       task.Args,
+			Env:        task.Env,
+			WorkingDir: task.WorkingDir,
+			Timeout:    int(timeout.Seconds()),
+			Confirmed:  task.Confirmed,
+		})
+		if err != nil {
+			return "", -1, err
+		}
+
+		output := result.Stdout
+		if result.Output != "" {
+			output = result.Output
+		}
+		if !result.Success {
+			exitCode := result.ExitCode
+			if exitCode == 0 {
+				exitCode = -1
+			}
+			if stderr := strings.TrimSpace(result.Stderr); stderr != "" {
+				return output, exitCode, fmt.Errorf("%s: %s", result.Error, stderr)
+			}
+			return output, exitCode, fmt.Errorf("%s", result.Error)
+		}
+		return output, result.ExitCode, nil
+	}
+
+	if p.containers == nil {
+		return "", -1, fmt.Errorf("container manager not available")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := p.containers.Run(ctx, &container.CreateOptions{
+		Image:      task.Command,
+		Command:    task.Args,
+		Env:        task.Env,
+		WorkingDir: task.WorkingDir,
+		Labels:     map[string]string{"assistant_agent.task": task.ID},
+	})
+	if err != nil {
+		if result != nil {
+			if result.Stderr != "" {
+				return result.Stdout, result.ExitCode, fmt.Errorf("%v: %s", err, result.Stderr)
+			}
+			return result.Stdout, result.ExitCode, err
+		}
+		return "", -1, err
+	}
+	return result.Stdout, result.ExitCode, nil
+}
+
+// taskTimeout 任务超时时间，未设置时使用插件配置 default_timeout（秒）
+func (p *SchedulerPlugin) taskTimeout(task *TaskInfo) time.Duration {
+	seconds := task.Timeout
+	if seconds <= 0 {
+		seconds = p.configInt("default_timeout", 300)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// parseEnv 解析 env 参数，格式为 KEY=VALUE 的列表
+func parseEnv(value interface{}) ([]string, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []interface{}:
+		items = v
+	default:
+		return nil, fmt.Errorf("env must be a list of KEY=VALUE")
+	}
+
+	env := make([]string, 0, len(items))
+	for _, item := range items {
+		entry, ok := item.(string)
+		if !ok || strings.Index(entry, "=") <= 0 {
+			return nil, fmt.Errorf("invalid env entry: %v", item)
+		}
+		env = append(env, entry)
+	}
+	return env, nil
 }
 
 // restoreEnabledTasks 恢复已启用的任务
@@ -658,6 +1154,14 @@ func (p *SchedulerPlugin) setDefaultConfig() {
 	if _, ok := p.config["retention_days"]; !ok {
 		p.config["retention_days"] = 30
 	}
+
+	if _, ok := p.config["history_size"]; !ok {
+		p.config["history_size"] = defaultHistorySize
+	}
+
+	if _, ok := p.config["seconds_enabled"]; !ok {
+		p.config["seconds_enabled"] = true
+	}
 }
 
 // generateID 生成唯一ID
@@ -1,12 +1,87 @@
 package scheduler
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
+	"assistant_agent/internal/container"
+	"assistant_agent/internal/executor"
+	"assistant_agent/internal/plugin"
+	"assistant_agent/internal/plugin/plugintest"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// MockAgent 模拟 Agent 接口，文件读写使用真实文件系统，命令执行返回预设结果
+type MockAgent struct {
+	plugin.AgentInterface
+	dataDir string
+	output  string
+	err     error
+	started chan string   // 命令开始执行时写入命令
+	release chan struct{} // 设置后命令阻塞到关闭或 ctx 取消
+	fail    string        // 执行该命令时返回失败结果
+	last    *executor.Command
+}
+
+func (a *MockAgent) RunCommand(ctx context.Context, cmd *executor.Command) (*executor.Result, error) {
+	a.last = cmd
+	if a.started != nil {
+		a.started <- cmd.Script
+	}
+	if a.release != nil {
+		select {
+		case <-a.release:
+		case <-ctx.Done():
+			return &executor.Result{ID: cmd.ID, Error: "command canceled", ExitCode: -1}, nil
+		}
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	if cmd.Script == a.fail {
+		return &executor.Result{ID: cmd.ID, Error: "exit status 2", ExitCode: 2, Stderr: "failed\n"}, nil
+	}
+	return &executor.Result{ID: cmd.ID, Success: true, Stdout: a.output}, nil
+}
+
+func (a *MockAgent) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (a *MockAgent) WriteFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0600)
+}
+
+func (a *MockAgent) FileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (a *MockAgent) GetConfig(key string) interface{} {
+	if key == "agent.data_dir" {
+		return a.dataDir
+	}
+	return nil
+}
+
+func (a *MockAgent) NotifyEvent(eventType string, data map[string]interface{}) error {
+	return nil
+}
+
+// newTestScheduler 创建使用模拟 Agent 初始化的调度器插件
+func newTestScheduler(t *testing.T, agent *MockAgent) *SchedulerPlugin {
+	p := NewSchedulerPlugin()
+	require.NoError(t, p.Init(&plugin.PluginContext{Agent: agent, Logger: &plugintest.Logger{}}))
+	return p
+}
+
 func TestNewSchedulerPlugin(t *testing.T) {
 	plugin := NewSchedulerPlugin()
 	assert.NotNil(t, plugin)
@@ -151,3 +226,613 @@ func TestSchedulerPluginGenerateID(t *testing.T) {
 	assert.NotEmpty(t, id2)
 	assert.NotEqual(t, id1, id2)
 }
+
+func TestSchedulerPluginContainerTask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake container runtime requires sh")
+	}
+
+	// 模拟容器运行时，输出收到的参数
+	fakeRuntime := filepath.Join(t.TempDir(), "docker")
+	require.NoError(t, os.WriteFile(fakeRuntime, []byte("#!/bin/sh\necho \"$@\"\n"), 0755))
+
+	plugin := NewSchedulerPlugin()
+	plugin.containers = container.NewManager(fakeRuntime)
+
+	output, exitCode, err := plugin.runTask(context.Background(), &TaskInfo{
+		ID:      "task_1",
+		Type:    "container",
+		Command: "alpine:3",
+		Args:    []string{"echo", "hello"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "run --rm --label assistant_agent.task=task_1 alpine:3 echo hello\n", output)
+	assert.Equal(t, 0, exitCode)
+}
+
+func TestSchedulerPluginTaskHistory(t *testing.T) {
+	agent := &MockAgent{dataDir: t.TempDir(), output: "ok"}
+	p := newTestScheduler(t, agent)
+	p.config["history_size"] = 3
+
+	result, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name":      "nightly",
+		"cron_expr": "0 2 * * *",
+		"command":   "backup",
+	})
+	require.NoError(t, err)
+	taskID := result.(map[string]interface{})["id"].(string)
+	task := p.tasks[taskID]
+
+	// 执行 4 次，最后一次失败，只保留最近 3 条
+	for i := 0; i < 3; i++ {
+		p.executeTask(task)
+	}
+	agent.err = assert.AnError
+	p.executeTask(task)
+
+	result, err = p.HandleCommand("get_task_history", map[string]interface{}{"id": taskID, "limit": 2})
+	require.NoError(t, err)
+	page := result.(map[string]interface{})
+	assert.Equal(t, 3, page["total"])
+	history := page["history"].([]*TaskResult)
+	require.Len(t, history, 2)
+	assert.False(t, history[0].Success, "newest result first")
+	assert.True(t, history[1].Success)
+
+	result, err = p.HandleCommand("get_task_history", map[string]interface{}{"id": taskID, "offset": 2, "limit": 2})
+	require.NoError(t, err)
+	assert.Len(t, result.(map[string]interface{})["history"], 1)
+
+	// 重新启动后从数据目录恢复历史
+	restarted := newTestScheduler(t, agent)
+	result, err = restarted.HandleCommand("get_task_history", map[string]interface{}{"id": taskID})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.(map[string]interface{})["total"])
+
+	_, err = restarted.HandleCommand("get_task_history", map[string]interface{}{"id": "missing"})
+	assert.Error(t, err)
+
+	// 删除任务后历史仍可查询
+	_, err = p.HandleCommand("remove_task", map[string]interface{}{"id": taskID})
+	require.NoError(t, err)
+	result, err = p.HandleCommand("get_task_history", map[string]interface{}{"id": taskID})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.(map[string]interface{})["total"])
+}
+
+func TestSchedulerPluginHistoryRetention(t *testing.T) {
+	p := NewSchedulerPlugin()
+	p.setDefaultConfig()
+	p.config["retention_days"] = "7"
+
+	now := time.Now()
+	p.history["task_1"] = []*TaskResult{
+		{StartTime: now.AddDate(0, 0, -8)},
+		{StartTime: now.AddDate(0, 0, -1)},
+	}
+	p.history["task_2"] = []*TaskResult{{StartTime: now.AddDate(0, 0, -30)}}
+
+	p.pruneHistoryLocked(now)
+	assert.Len(t, p.history["task_1"], 1)
+	assert.NotContains(t, p.history, "task_2")
+}
+
+// newBlockingTask 添加一个命令会阻塞到 agent.release 关闭的任务
+func newBlockingTask(t *testing.T, p *SchedulerPlugin, command string, args map[string]interface{}) *TaskInfo {
+	taskArgs := map[string]interface{}{"name": command, "cron_expr": "0 2 * * *", "command": command}
+	for key, value := range args {
+		taskArgs[key] = value
+	}
+	result, err := p.HandleCommand("add_task", taskArgs)
+	require.NoError(t, err)
+	return p.tasks[result.(map[string]interface{})["id"].(string)]
+}
+
+func waitStarted(t *testing.T, agent *MockAgent) string {
+	select {
+	case command := <-agent.started:
+		return command
+	case <-time.After(5 * time.Second):
+		t.Fatal("task did not start")
+		return ""
+	}
+}
+
+func assertNotStarted(t *testing.T, agent *MockAgent) {
+	select {
+	case command := <-agent.started:
+		t.Fatalf("task %s started while limit reached", command)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSchedulerPluginOverlapPolicy(t *testing.T) {
+	t.Run("skip", func(t *testing.T) {
+		agent := &MockAgent{started: make(chan string, 4), release: make(chan struct{})}
+		p := newTestScheduler(t, agent)
+		task := newBlockingTask(t, p, "slow", map[string]interface{}{"max_concurrent": 1})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() { defer wg.Done(); p.executeTask(task) }()
+		waitStarted(t, agent)
+
+		p.executeTask(task)
+		close(agent.release)
+		wg.Wait()
+
+		assert.Equal(t, int64(1), task.RunCount)
+		assert.Equal(t, int64(1), task.SkippedCount)
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		agent := &MockAgent{started: make(chan string, 4), release: make(chan struct{})}
+		p := newTestScheduler(t, agent)
+		task := newBlockingTask(t, p, "slow", map[string]interface{}{"max_concurrent": 1, "overlap_policy": OverlapQueue})
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); p.executeTask(task) }()
+		waitStarted(t, agent)
+		go func() { defer wg.Done(); p.executeTask(task) }()
+		assertNotStarted(t, agent)
+
+		close(agent.release)
+		waitStarted(t, agent)
+		wg.Wait()
+
+		assert.Equal(t, int64(2), task.SuccessCount)
+		assert.Equal(t, int64(0), task.SkippedCount)
+	})
+
+	t.Run("kill-previous", func(t *testing.T) {
+		agent := &MockAgent{started: make(chan string, 4), release: make(chan struct{})}
+		p := newTestScheduler(t, agent)
+		task := newBlockingTask(t, p, "slow", map[string]interface{}{"max_concurrent": 1, "overlap_policy": OverlapKillPrevious})
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); p.executeTask(task) }()
+		waitStarted(t, agent)
+		go func() { defer wg.Done(); p.executeTask(task) }()
+		waitStarted(t, agent)
+
+		close(agent.release)
+		wg.Wait()
+
+		assert.Equal(t, int64(1), task.FailureCount, "previous run is canceled")
+		assert.Equal(t, int64(1), task.SuccessCount)
+	})
+}
+
+func TestSchedulerPluginGlobalConcurrency(t *testing.T) {
+	agent := &MockAgent{started: make(chan string, 4), release: make(chan struct{})}
+	p := newTestScheduler(t, agent)
+	p.config["max_concurrent_tasks"] = 1
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	first := newBlockingTask(t, p, "first", nil)
+	second := newBlockingTask(t, p, "second", nil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); p.executeTask(first) }()
+	assert.Equal(t, "first", waitStarted(t, agent))
+	go func() { defer wg.Done(); p.executeTask(second) }()
+	assertNotStarted(t, agent)
+
+	close(agent.release)
+	assert.Equal(t, "second", waitStarted(t, agent))
+	wg.Wait()
+}
+
+func TestSchedulerPluginInvalidOverlapPolicy(t *testing.T) {
+	p := newTestScheduler(t, &MockAgent{})
+	_, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name":           "task",
+		"cron_expr":      "0 2 * * *",
+		"command":        "true",
+		"overlap_policy": "parallel",
+	})
+	assert.Error(t, err)
+}
+
+func TestSchedulerPluginOneShotTask(t *testing.T) {
+	agent := &MockAgent{output: "done"}
+	p := newTestScheduler(t, agent)
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	result, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name":    "once",
+		"delay":   "100ms",
+		"command": "echo once",
+		"enabled": true,
+	})
+	require.NoError(t, err)
+	taskID := result.(map[string]interface{})["id"].(string)
+
+	// 执行后任务被删除，执行历史保留
+	assert.Eventually(t, func() bool {
+		_, err := p.HandleCommand("get_task", map[string]interface{}{"id": taskID})
+		return err != nil
+	}, 5*time.Second, 20*time.Millisecond)
+
+	result, err = p.HandleCommand("get_task_history", map[string]interface{}{"id": taskID})
+	require.NoError(t, err)
+	history := result.(map[string]interface{})["history"].([]*TaskResult)
+	require.Len(t, history, 1)
+	assert.Equal(t, "done", history[0].Output)
+}
+
+func TestSchedulerPluginOneShotValidation(t *testing.T) {
+	p := newTestScheduler(t, &MockAgent{})
+
+	tests := []map[string]interface{}{
+		{"run_at": time.Now().Add(-time.Hour).Format(time.RFC3339)},
+		{"delay": "soon"},
+		{"delay": "15m", "cron_expr": "0 0 2 * * *"},
+		{"delay": "15m", "run_at": time.Now().Add(time.Hour).Format(time.RFC3339)},
+		{},
+	}
+	for _, args := range tests {
+		args["name"] = "once"
+		args["command"] = "true"
+		_, err := p.HandleCommand("add_task", args)
+		assert.Error(t, err, "args: %v", args)
+	}
+
+	runAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	result, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name":    "once",
+		"command": "true",
+		"run_at":  runAt.Format(time.RFC3339),
+	})
+	require.NoError(t, err)
+	task := p.tasks[result.(map[string]interface{})["id"].(string)]
+	require.NotNil(t, task.RunAt)
+	assert.True(t, runAt.Equal(*task.RunAt))
+}
+
+// addChainTask 添加任务，deps 为空时添加未启用的 cron 任务作为任务链起点
+func addChainTask(t *testing.T, p *SchedulerPlugin, command string, deps ...string) string {
+	args := map[string]interface{}{"name": command, "command": command}
+	if len(deps) == 0 {
+		args["cron_expr"] = "0 2 * * *"
+	} else {
+		args["enabled"] = true
+		list := make([]interface{}, len(deps))
+		for i, dep := range deps {
+			list[i] = dep
+		}
+		args["depends_on"] = list
+	}
+	result, err := p.HandleCommand("add_task", args)
+	require.NoError(t, err)
+	return result.(map[string]interface{})["id"].(string)
+}
+
+func TestSchedulerPluginTaskChain(t *testing.T) {
+	agent := &MockAgent{started: make(chan string, 8)}
+	p := newTestScheduler(t, agent)
+
+	backup := addChainTask(t, p, "backup")
+	compress := addChainTask(t, p, "compress", backup)
+	upload := addChainTask(t, p, "upload", compress)
+	notify := addChainTask(t, p, "notify", backup, upload)
+
+	result, err := p.HandleCommand("run_chain", map[string]interface{}{"id": backup})
+	require.NoError(t, err)
+	assert.Equal(t, []string{backup, compress, upload, notify}, result.(map[string]interface{})["tasks"])
+
+	results := p.runChain(p.tasks[backup], false)
+	assert.Equal(t, map[string]string{
+		backup: ChainSuccess, compress: ChainSuccess, upload: ChainSuccess, notify: ChainSuccess,
+	}, results)
+
+	// 中间任务失败时后续任务被跳过
+	agent.fail = "compress"
+	results = p.runChain(p.tasks[backup], false)
+	assert.Equal(t, ChainFailed, results[compress])
+	assert.Equal(t, ChainSkipped, results[upload])
+	assert.Equal(t, ChainSkipped, results[notify])
+
+	// 被依赖的任务不能删除
+	_, err = p.HandleCommand("remove_task", map[string]interface{}{"id": compress})
+	assert.Error(t, err)
+}
+
+func TestSchedulerPluginChainAcrossRoots(t *testing.T) {
+	agent := &MockAgent{started: make(chan string, 16)}
+	p := newTestScheduler(t, agent)
+
+	backup := addChainTask(t, p, "backup")
+	export := addChainTask(t, p, "export")
+	report := addChainTask(t, p, "report", backup, export)
+
+	// 另一个起点任务从未执行过时跳过
+	results := p.runChain(p.tasks[backup], false)
+	assert.Equal(t, ChainSkipped, results[report])
+
+	// 不在本轮任务链中的依赖按最近一次的结果判断
+	results = p.runChain(p.tasks[export], false)
+	assert.Equal(t, ChainSuccess, results[report])
+
+	agent.fail = "backup"
+	results = p.runChain(p.tasks[backup], false)
+	assert.Equal(t, ChainSkipped, results[report])
+	agent.fail = ""
+	results = p.runChain(p.tasks[export], false)
+	assert.Equal(t, ChainSkipped, results[report])
+}
+
+func TestSchedulerPluginOneShotDependency(t *testing.T) {
+	p := newTestScheduler(t, &MockAgent{})
+
+	result, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name": "migrate", "command": "migrate", "delay": "1h",
+	})
+	require.NoError(t, err)
+	migrate := result.(map[string]interface{})["id"].(string)
+	verify := addChainTask(t, p, "verify", migrate)
+
+	// 仍被依赖的一次性任务执行后保留，结果供依赖它的任务判断
+	p.removeCompletedTask(p.tasks[migrate])
+	assert.Contains(t, p.tasks, migrate)
+
+	_, err = p.HandleCommand("remove_task", map[string]interface{}{"id": verify})
+	require.NoError(t, err)
+	p.removeCompletedTask(p.tasks[migrate])
+	assert.NotContains(t, p.tasks, migrate)
+}
+
+func TestSchedulerPluginDependencyValidation(t *testing.T) {
+	p := newTestScheduler(t, &MockAgent{})
+
+	a := addChainTask(t, p, "a")
+	b := addChainTask(t, p, "b", a)
+	c := addChainTask(t, p, "c", b)
+
+	// a -> c 形成环
+	_, err := p.HandleCommand("update_task", map[string]interface{}{"id": a, "depends_on": []interface{}{c}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle")
+
+	_, err = p.HandleCommand("update_task", map[string]interface{}{"id": b, "depends_on": []interface{}{b}})
+	assert.Error(t, err)
+
+	_, err = p.HandleCommand("add_task", map[string]interface{}{
+		"name": "d", "command": "d", "depends_on": []interface{}{"missing"},
+	})
+	assert.Error(t, err)
+
+	// 依赖和调度时间互斥
+	_, err = p.HandleCommand("add_task", map[string]interface{}{
+		"name": "d", "command": "d", "cron_expr": "0 2 * * *", "depends_on": []interface{}{a},
+	})
+	assert.Error(t, err)
+}
+
+func TestSchedulerPluginTaskConfirmed(t *testing.T) {
+	agent := &MockAgent{output: "ok"}
+	p := newTestScheduler(t, agent)
+
+	// 添加任务时确认的高危命令在每次执行时携带确认
+	result, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name": "reboot", "cron_expr": "0 3 * * 0", "command": "reboot", "confirmed": true,
+	})
+	require.NoError(t, err)
+	task := p.tasks[result.(map[string]interface{})["id"].(string)]
+
+	require.NotNil(t, p.executeTask(task))
+	assert.True(t, agent.last.Confirmed)
+
+	// 修改命令后需重新确认
+	_, err = p.HandleCommand("update_task", map[string]interface{}{"id": task.ID, "command": "shutdown -h now"})
+	require.NoError(t, err)
+	p.executeTask(task)
+	assert.False(t, agent.last.Confirmed)
+
+	_, err = p.HandleCommand("update_task", map[string]interface{}{"id": task.ID, "confirmed": true})
+	require.NoError(t, err)
+	p.executeTask(task)
+	assert.True(t, agent.last.Confirmed)
+}
+
+func TestSchedulerPluginTaskCommand(t *testing.T) {
+	agent := &MockAgent{output: "ok"}
+	p := newTestScheduler(t, agent)
+
+	result, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name":        "report",
+		"cron_expr":   "0 2 * * *",
+		"command":     "Get-Date",
+		"type":        "powershell",
+		"timeout":     30,
+		"env":         []interface{}{"REPORT_DIR=/tmp/reports"},
+		"working_dir": "/srv",
+	})
+	require.NoError(t, err)
+	task := p.tasks[result.(map[string]interface{})["id"].(string)]
+
+	require.NotNil(t, p.executeTask(task))
+	require.NotNil(t, agent.last)
+	assert.Equal(t, executor.CommandTypePowerShell, agent.last.Type)
+	assert.Equal(t, "Get-Date", agent.last.Script)
+	assert.Equal(t, 30, agent.last.Timeout)
+	assert.Equal(t, []string{"REPORT_DIR=/tmp/reports"}, agent.last.Env)
+	assert.Equal(t, "/srv", agent.last.WorkingDir)
+	assert.False(t, agent.last.Confirmed)
+
+	// 未设置超时时使用 default_timeout，失败时记录退出码和错误输出
+	_, err = p.HandleCommand("update_task", map[string]interface{}{"id": task.ID, "timeout": 0})
+	require.NoError(t, err)
+	agent.fail = "Get-Date"
+	taskResult := p.executeTask(task)
+	assert.Equal(t, 300, agent.last.Timeout)
+	assert.False(t, taskResult.Success)
+	assert.Equal(t, 2, taskResult.ExitCode)
+	assert.Equal(t, "exit status 2: failed", taskResult.Error)
+
+	_, err = p.HandleCommand("update_task", map[string]interface{}{"id": task.ID, "env": []interface{}{"INVALID"}})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("update_task", map[string]interface{}{"id": task.ID, "type": "batch"})
+	assert.Error(t, err)
+}
+
+func TestBlackoutWindowContains(t *testing.T) {
+	at := func(weekday time.Weekday, clock string) time.Time {
+		// 2024-01-07 为周日
+		parsed, err := time.Parse("15:04", clock)
+		require.NoError(t, err)
+		return time.Date(2024, 1, 7+int(weekday), parsed.Hour(), parsed.Minute(), 0, 0, time.Local)
+	}
+
+	business := BlackoutWindow{Start: "09:00", End: "18:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}}
+	assert.True(t, business.contains(at(time.Monday, "09:00")))
+	assert.True(t, business.contains(at(time.Friday, "17:59")))
+	assert.False(t, business.contains(at(time.Monday, "18:00")))
+	assert.False(t, business.contains(at(time.Saturday, "12:00")))
+
+	// 跨午夜的时间段，后半部分按开始当天计算
+	night := BlackoutWindow{Start: "22:00", End: "06:00", Days: []string{"fri"}}
+	assert.True(t, night.contains(at(time.Friday, "23:30")))
+	assert.True(t, night.contains(at(time.Saturday, "05:00")))
+	assert.False(t, night.contains(at(time.Friday, "05:00")))
+	assert.False(t, night.contains(at(time.Saturday, "12:00")))
+
+	assert.Error(t, BlackoutWindow{Start: "9am", End: "18:00"}.validate())
+	assert.Error(t, BlackoutWindow{Start: "09:00", End: "09:00"}.validate())
+	assert.Error(t, BlackoutWindow{Start: "09:00", End: "18:00", Days: []string{"someday"}}.validate())
+}
+
+func TestSchedulerPluginMaintenanceMode(t *testing.T) {
+	agent := &MockAgent{output: "ok"}
+	p := newTestScheduler(t, agent)
+	task := newBlockingTask(t, p, "patch", nil)
+
+	result, err := p.HandleCommand("set_maintenance", map[string]interface{}{
+		"enabled": true, "reason": "release freeze", "duration": "1h",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, true, result.(map[string]interface{})["enabled"])
+
+	// 按计划触发被抑制并记录到执行历史，手动执行不受影响
+	p.runChain(task, true)
+	assert.Equal(t, int64(0), task.RunCount)
+	assert.Equal(t, int64(1), task.SuppressedCount)
+	require.Len(t, p.history[task.ID], 1)
+	assert.True(t, p.history[task.ID][0].Suppressed)
+	assert.Contains(t, p.history[task.ID][0].Error, "maintenance mode")
+
+	p.runChain(task, false)
+	assert.Equal(t, int64(1), task.RunCount)
+
+	_, err = p.HandleCommand("set_maintenance", map[string]interface{}{"enabled": false})
+	require.NoError(t, err)
+	p.runChain(task, true)
+	assert.Equal(t, int64(2), task.RunCount)
+
+	// 维护模式到期后自动关闭
+	p.maintenance = &maintenanceState{Since: time.Now().Add(-time.Hour), Until: time.Now().Add(-time.Minute)}
+	result, err = p.HandleCommand("get_maintenance", nil)
+	require.NoError(t, err)
+	assert.Equal(t, false, result.(map[string]interface{})["enabled"])
+}
+
+func TestSchedulerPluginBlackoutWindow(t *testing.T) {
+	agent := &MockAgent{output: "ok"}
+	p := newTestScheduler(t, agent)
+
+	// 覆盖全天的时间段
+	now := time.Now()
+	start := now.Add(-time.Minute).Format("15:04")
+	end := now.Add(-2 * time.Minute).Format("15:04")
+	task := newBlockingTask(t, p, "patch", map[string]interface{}{
+		"blackout_windows": []interface{}{map[string]interface{}{"start": start, "end": end}},
+	})
+
+	p.runChain(task, true)
+	assert.Equal(t, int64(0), task.RunCount)
+	assert.Equal(t, int64(1), task.SuppressedCount)
+
+	_, err := p.HandleCommand("update_task", map[string]interface{}{
+		"id":               task.ID,
+		"blackout_windows": []interface{}{map[string]interface{}{"start": "25:00", "end": "06:00"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestSchedulerPluginCronFields(t *testing.T) {
+	p := newTestScheduler(t, &MockAgent{})
+
+	for _, expr := range []string{"*/30 * * * * *", "0 2 * * *", "@hourly"} {
+		result, err := p.HandleCommand("add_task", map[string]interface{}{
+			"name":      expr,
+			"command":   "echo",
+			"cron_expr": expr,
+			"enabled":   true,
+		})
+		require.NoError(t, err, expr)
+		id := result.(map[string]interface{})["id"].(string)
+		assert.NotZero(t, p.tasks[id].EntryID, expr)
+	}
+
+	_, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name": "bad", "command": "echo", "cron_expr": "* * * *",
+	})
+	assert.Error(t, err)
+}
+
+func TestSchedulerPluginSecondsDisabled(t *testing.T) {
+	p := NewSchedulerPlugin()
+	require.NoError(t, p.SetConfig(map[string]interface{}{"seconds_enabled": "false"}))
+	require.NoError(t, p.Init(&plugin.PluginContext{Agent: &MockAgent{}, Logger: &plugintest.Logger{}}))
+
+	_, err := p.HandleCommand("add_task", map[string]interface{}{
+		"name": "seconds", "command": "echo", "cron_expr": "*/30 * * * * *",
+	})
+	assert.Error(t, err)
+
+	_, err = p.HandleCommand("add_task", map[string]interface{}{
+		"name": "minutes", "command": "echo", "cron_expr": "0 2 * * *",
+	})
+	assert.NoError(t, err)
+}
+
+func TestSchedulerPluginValidateExpr(t *testing.T) {
+	p := newTestScheduler(t, &MockAgent{})
+
+	result, err := p.HandleCommand("validate_expr", map[string]interface{}{
+		"expr":  "*/10 * * * * *",
+		"count": float64(3),
+	})
+	require.NoError(t, err)
+	info := result.(map[string]interface{})
+	assert.True(t, info["valid"].(bool))
+	next := info["next_runs"].([]time.Time)
+	require.Len(t, next, 3)
+	assert.Equal(t, 10*time.Second, next[1].Sub(next[0]))
+	assert.Zero(t, next[0].Second()%10)
+
+	result, err = p.HandleCommand("validate_expr", map[string]interface{}{"expr": "not a cron"})
+	require.NoError(t, err)
+	info = result.(map[string]interface{})
+	assert.False(t, info["valid"].(bool))
+	assert.NotEmpty(t, info["error"])
+
+	_, err = p.HandleCommand("validate_expr", map[string]interface{}{"expr": "@daily", "count": float64(0)})
+	assert.Error(t, err)
+}
+
+func TestSchedulerPluginRestart(t *testing.T) {
+	p := newTestScheduler(t, &MockAgent{})
+
+	// 修改配置时插件管理器会先停止再启动插件，多次重启不能重复关闭停止信号
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Start())
+		assert.NotPanics(t, func() { require.NoError(t, p.Stop()) })
+	}
+}
@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ArgType 命令参数类型
+type ArgType string
+
+const (
+	ArgString  ArgType = "string"
+	ArgNumber  ArgType = "number"  // 数值统一转换为 float64，与 JSON 解码结果一致
+	ArgInteger ArgType = "integer" // 整数，同样保存为 float64
+	ArgBool    ArgType = "boolean"
+	ArgObject  ArgType = "object" // map[string]interface{}
+	ArgArray   ArgType = "array"  // []interface{}
+	ArgAny     ArgType = "any"
+)
+
+// ArgSchema 命令参数声明
+type ArgSchema struct {
+	Type        ArgType     `json:"type"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"` // 未传入参数时使用的默认值
+	Enum        []string    `json:"enum,omitempty"`    // 字符串参数的可选值
+	Description string      `json:"description,omitempty"`
+}
+
+// CommandSchema 插件命令声明
+type CommandSchema struct {
+	Description string               `json:"description,omitempty"`
+	Args        map[string]ArgSchema `json:"args,omitempty"`
+}
+
+// CommandSchemaProvider 可选接口，插件声明命令参数后由插件管理器在调用前校验和转换参数
+// 未声明的命令和参数原样传给插件
+type CommandSchemaProvider interface {
+	CommandSchemas() map[string]*CommandSchema
+}
+
+// FieldError 单个参数的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError 命令参数校验失败
+type ValidationError struct {
+	Plugin  string       `json:"plugin"`
+	Command string       `json:"command"`
+	Fields  []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return fmt.Sprintf("invalid arguments for %s.%s: %s", e.Plugin, e.Command, strings.Join(messages, "; "))
+}
+
+// Unwrap 使 errors.Is(err, ErrInvalidArguments) 成立
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidArguments
+}
+
+// Validate 按声明校验参数并转换类型、填充默认值，返回新的参数，不修改传入的参数
+func (s *CommandSchema) Validate(args map[string]interface{}) (map[string]interface{}, []FieldError) {
+	result := make(map[string]interface{}, len(args)+len(s.Args))
+	for key, value := range args {
+		result[key] = value
+	}
+
+	names := make([]string, 0, len(s.Args))
+	for name := range s.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]FieldError, 0)
+	for _, name := range names {
+		arg := s.Args[name]
+		value, exists := result[name]
+		if !exists || value == nil {
+			if arg.Required {
+				errs = append(errs, FieldError{Field: name, Message: "is required"})
+			} else if arg.Default != nil {
+				result[name] = arg.Default
+			}
+			continue
+		}
+
+		converted, err := coerceArg(arg, value)
+		if err != nil {
+			errs = append(errs, FieldError{Field: name, Message: err.Error()})
+			continue
+		}
+		result[name] = converted
+	}
+
+	return result, errs
+}
+
+// coerceArg 将参数转换为声明的类型，可无损转换的字符串和数值会被转换
+func coerceArg(arg ArgSchema, value interface{}) (interface{}, error) {
+	switch arg.Type {
+	case ArgString:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got %T", value)
+		}
+		if len(arg.Enum) > 0 && !containsString(arg.Enum, str) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(arg.Enum, ", "))
+		}
+		return str, nil
+	case ArgNumber, ArgInteger:
+		number, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("expected %s, got %T", arg.Type, value)
+		}
+		if arg.Type == ArgInteger && number != math.Trunc(number) {
+			return nil, fmt.Errorf("expected integer, got %v", number)
+		}
+		return number, nil
+	case ArgBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("expected boolean, got %T", value)
+	case ArgObject:
+		if object, ok := value.(map[string]interface{}); ok {
+			return object, nil
+		}
+		return nil, fmt.Errorf("expected object, got %T", value)
+	case ArgArray:
+		switch v := value.(type) {
+		case []interface{}:
+			return v, nil
+		case []string:
+			list := make([]interface{}, len(v))
+			for i, item := range v {
+				list[i] = item
+			}
+			return list, nil
+		}
+		return nil, fmt.Errorf("expected array, got %T", value)
+	default:
+		return value, nil
+	}
+}
+
+// toFloat 将数值或数字字符串转换为 float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCommand 按插件声明校验命令参数，插件未声明该命令时原样返回
+func validateCommand(name string, p Plugin, command string, args map[string]interface{}) (map[string]interface{}, error) {
+	provider, ok := p.(CommandSchemaProvider)
+	if !ok {
+		return args, nil
+	}
+	schema, ok := provider.CommandSchemas()[command]
+	if !ok || schema == nil {
+		return args, nil
+	}
+
+	validated, errs := schema.Validate(args)
+	if len(errs) > 0 {
+		return nil, &ValidationError{Plugin: name, Command: command, Fields: errs}
+	}
+	return validated, nil
+}
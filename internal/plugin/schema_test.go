@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"assistant_agent/internal/config"
+	"assistant_agent/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandSchemaValidate(t *testing.T) {
+	schema := &CommandSchema{Args: map[string]ArgSchema{
+		"title":    {Type: ArgString, Required: true},
+		"notes":    {Type: ArgString, Default: ""},
+		"length":   {Type: ArgInteger, Default: 16.0},
+		"ratio":    {Type: ArgNumber},
+		"enabled":  {Type: ArgBool},
+		"severity": {Type: ArgString, Enum: []string{"warning", "critical"}},
+		"tags":     {Type: ArgArray},
+		"labels":   {Type: ArgObject},
+	}}
+
+	// 填充默认值并转换类型，未声明的参数原样保留
+	args := map[string]interface{}{
+		"title":   "db",
+		"ratio":   "0.5",
+		"enabled": "true",
+		"tags":    []string{"prod"},
+		"extra":   1,
+	}
+	validated, errs := schema.Validate(args)
+	require.Empty(t, errs)
+	assert.Equal(t, map[string]interface{}{
+		"title":   "db",
+		"notes":   "",
+		"length":  16.0,
+		"ratio":   0.5,
+		"enabled": true,
+		"tags":    []interface{}{"prod"},
+		"extra":   1,
+	}, validated)
+	assert.Equal(t, "0.5", args["ratio"])
+
+	// 逐项返回错误，按参数名排序
+	_, errs = schema.Validate(map[string]interface{}{
+		"length":   12.5,
+		"enabled":  "maybe",
+		"severity": "info",
+		"labels":   "a=b",
+	})
+	assert.Equal(t, []FieldError{
+		{Field: "enabled", Message: "expected boolean, got string"},
+		{Field: "labels", Message: "expected object, got string"},
+		{Field: "length", Message: "expected integer, got 12.5"},
+		{Field: "severity", Message: "must be one of warning, critical"},
+		{Field: "title", Message: "is required"},
+	}, errs)
+}
+
+// schemaPlugin 声明命令参数的插件
+type schemaPlugin struct {
+	MockPlugin
+}
+
+func (p *schemaPlugin) CommandSchemas() map[string]*CommandSchema {
+	return map[string]*CommandSchema{
+		"add": {Args: map[string]ArgSchema{
+			"title": {Type: ArgString, Required: true},
+			"notes": {Type: ArgString, Default: ""},
+		}},
+	}
+}
+
+func TestManagerSendCommandValidation(t *testing.T) {
+	config.Init()
+	logger.Init()
+
+	manager := NewManager(&MockAgent{config: make(map[string]interface{})}, &config.Config{})
+	require.NoError(t, manager.Register(&schemaPlugin{MockPlugin{
+		info:   &PluginInfo{Name: "password-manager", Version: "1.0.0"},
+		status: &PluginStatus{Status: "stopped"},
+	}}))
+	require.NoError(t, manager.StartPlugin("password-manager"))
+
+	_, err := manager.SendCommand("password-manager", "add", map[string]interface{}{"title": 42})
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.True(t, errors.Is(err, ErrInvalidArguments))
+	assert.Equal(t, "add", validationErr.Command)
+	assert.Equal(t, []FieldError{{Field: "title", Message: "expected string, got int"}}, validationErr.Fields)
+	assert.EqualError(t, err, "invalid arguments for password-manager.add: title: expected string, got int")
+
+	// 插件收到填充默认值后的参数
+	result, err := manager.SendCommand("password-manager", "add", map[string]interface{}{"title": "db"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"title": "db", "notes": ""}, result.(map[string]interface{})["args"])
+
+	// 未声明的命令不校验
+	_, err = manager.SendCommand("password-manager", "list", nil)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,324 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/executor"
+	"assistant_agent/internal/plugin/pb"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ServeExternal 在外部插件进程中运行插件，供独立编译的插件在 main 中调用
+// 完成握手后阻塞，直到 Agent 关闭插件进程的标准输入
+func ServeExternal(p Plugin) error {
+	token := os.Getenv(ExternalTokenEnv)
+	if token == "" {
+		return fmt.Errorf("plugin must be launched by assistant agent (%s not set)", ExternalTokenEnv)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	remote := &pluginServer{plugin: p, token: token}
+	server := grpclib.NewServer(grpclib.UnaryInterceptor(tokenInterceptor(token)))
+	pb.RegisterPluginServer(server, remote)
+
+	// Agent 关闭标准输入或退出时结束插件
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		remote.close()
+		server.Stop()
+	}()
+
+	fmt.Printf("%d|tcp|%s\n", ExternalProtocolVersion, listener.Addr().String())
+	return server.Serve(listener)
+}
+
+// pluginServer 插件进程侧的服务，将调用转发给插件实现
+type pluginServer struct {
+	pb.UnimplementedPluginServer
+	plugin Plugin
+	token  string
+	host   *grpclib.ClientConn
+	mu     sync.Mutex
+}
+
+func (s *pluginServer) Invoke(ctx context.Context, req *pb.InvokeRequest) (*pb.InvokeResponse, error) {
+	return handleInvoke(ctx, s.handle, req)
+}
+
+// handle 按方法名调用插件
+func (s *pluginServer) handle(ctx context.Context, method string, payload []byte) (interface{}, error) {
+	switch method {
+	case "Info":
+		return s.plugin.Info(), nil
+	case "CommandSchemas":
+		if provider, ok := s.plugin.(CommandSchemaProvider); ok {
+			return provider.CommandSchemas(), nil
+		}
+		return nil, nil
+	case "Init":
+		var args struct {
+			HostAddress string `json:"host_address"`
+		}
+		if err := json.Unmarshal(payload, &args); err != nil {
+			return nil, fmt.Errorf("invalid Init arguments: %v", err)
+		}
+		agent, err := s.connectHost(args.HostAddress)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.plugin.Init(&PluginContext{
+			Agent:  agent,
+			Logger: &stderrLogger{},
+			Events: &remoteEvents{agent: agent},
+		})
+	case "Start":
+		return nil, s.plugin.Start()
+	case "Stop":
+		return nil, s.plugin.Stop()
+	case "HandleCommand":
+		var args struct {
+			Command string                 `json:"command"`
+			Args    map[string]interface{} `json:"args"`
+		}
+		if err := json.Unmarshal(payload, &args); err != nil {
+			return nil, fmt.Errorf("invalid HandleCommand arguments: %v", err)
+		}
+		return s.plugin.HandleCommand(args.Command, args.Args)
+	case "HandleEvent":
+		var args struct {
+			EventType string                 `json:"event_type"`
+			Data      map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(payload, &args); err != nil {
+			return nil, fmt.Errorf("invalid HandleEvent arguments: %v", err)
+		}
+		return nil, s.plugin.HandleEvent(args.EventType, args.Data)
+	case "Status":
+		return s.plugin.Status(), nil
+	case "Health":
+		return nil, s.plugin.Health()
+	case "GetConfig":
+		return s.plugin.GetConfig(), nil
+	case "SetConfig":
+		var config map[string]interface{}
+		if err := json.Unmarshal(payload, &config); err != nil {
+			return nil, fmt.Errorf("invalid SetConfig arguments: %v", err)
+		}
+		return nil, s.plugin.SetConfig(config)
+	default:
+		return nil, fmt.Errorf("unknown plugin method: %s", method)
+	}
+}
+
+// connectHost 连接 Agent 的回调服务，重复初始化时替换旧连接
+func (s *pluginServer) connectHost(address string) (*remoteAgent, error) {
+	conn, err := grpclib.Dial(address, grpclib.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to agent: %v", err)
+	}
+
+	s.mu.Lock()
+	if s.host != nil {
+		s.host.Close()
+	}
+	s.host = conn
+	s.mu.Unlock()
+
+	return &remoteAgent{client: pb.NewPluginHostClient(conn), token: s.token}, nil
+}
+
+// close 关闭与 Agent 的连接
+func (s *pluginServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.host != nil {
+		s.host.Close()
+		s.host = nil
+	}
+}
+
+// remoteAgent 外部插件进程中的 AgentInterface 实现，调用转发到 Agent
+type remoteAgent struct {
+	client pb.PluginHostClient
+	token  string
+}
+
+// call 调用 Agent 方法，timeout 为 0 时使用默认超时
+func (a *remoteAgent) call(timeout time.Duration, method string, args, result interface{}) error {
+	return a.callContext(context.Background(), timeout, method, args, result)
+}
+
+// callContext 调用 Agent 方法，ctx 取消时中止调用，Agent 侧随之取消对应的命令
+func (a *remoteAgent) callContext(parent context.Context, timeout time.Duration, method string, args, result interface{}) error {
+	if timeout <= 0 {
+		timeout = externalCallTimeout
+	} else {
+		// 留出 Agent 处理和返回结果的时间
+		timeout += externalCallTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	return invoke(ctx, a.client, a.token, method, args, result)
+}
+
+func (a *remoteAgent) GetSystemInfo() (map[string]interface{}, error) {
+	var info map[string]interface{}
+	err := a.call(0, "GetSystemInfo", nil, &info)
+	return info, err
+}
+
+func (a *remoteAgent) ExecuteCommand(command string, args []string, timeout time.Duration) (string, error) {
+	return a.ExecuteCommandContext(context.Background(), command, args, timeout)
+}
+
+func (a *remoteAgent) ExecuteCommandContext(ctx context.Context, command string, args []string, timeout time.Duration) (string, error) {
+	var output string
+	err := a.callContext(ctx, timeout, "ExecuteCommand", map[string]interface{}{
+		"command":    command,
+		"args":       args,
+		"timeout_ms": timeout.Milliseconds(),
+	}, &output)
+	return output, err
+}
+
+func (a *remoteAgent) ExecuteScript(ref string, args []string, timeout time.Duration) (string, error) {
+	return a.ExecuteScriptContext(context.Background(), ref, args, timeout)
+}
+
+func (a *remoteAgent) ExecuteScriptContext(ctx context.Context, ref string, args []string, timeout time.Duration) (string, error) {
+	var output string
+	err := a.callContext(ctx, timeout, "ExecuteScript", map[string]interface{}{
+		"ref":        ref,
+		"args":       args,
+		"timeout_ms": timeout.Milliseconds(),
+	}, &output)
+	return output, err
+}
+
+func (a *remoteAgent) RunCommand(ctx context.Context, cmd *executor.Command) (*executor.Result, error) {
+	var result executor.Result
+	timeout := time.Duration(cmd.Timeout) * time.Second
+	if err := a.callContext(ctx, timeout, "RunCommand", map[string]interface{}{"cmd": cmd}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (a *remoteAgent) ReadFile(path string) ([]byte, error) {
+	var data []byte
+	err := a.call(0, "ReadFile", map[string]interface{}{"path": path}, &data)
+	return data, err
+}
+
+func (a *remoteAgent) WriteFile(path string, data []byte) error {
+	return a.call(0, "WriteFile", map[string]interface{}{"path": path, "data": data}, nil)
+}
+
+func (a *remoteAgent) FileExists(path string) bool {
+	var exists bool
+	if err := a.call(0, "FileExists", map[string]interface{}{"path": path}, &exists); err != nil {
+		return false
+	}
+	return exists
+}
+
+func (a *remoteAgent) GetConfig(key string) interface{} {
+	var value interface{}
+	if err := a.call(0, "GetConfig", map[string]interface{}{"key": key}, &value); err != nil {
+		return nil
+	}
+	return value
+}
+
+func (a *remoteAgent) SetConfig(key string, value interface{}) error {
+	return a.call(0, "SetConfig", map[string]interface{}{"key": key, "value": value}, nil)
+}
+
+func (a *remoteAgent) GetStatus() map[string]interface{} {
+	var status map[string]interface{}
+	if err := a.call(0, "GetStatus", nil, &status); err != nil {
+		return nil
+	}
+	return status
+}
+
+func (a *remoteAgent) SetStatus(key string, value interface{}) error {
+	return a.call(0, "SetStatus", map[string]interface{}{"key": key, "value": value}, nil)
+}
+
+func (a *remoteAgent) NotifyEvent(eventType string, data map[string]interface{}) error {
+	return a.call(0, "NotifyEvent", map[string]interface{}{"event_type": eventType, "event_data": data}, nil)
+}
+
+func (a *remoteAgent) CallServer(msgType string, data interface{}, timeout time.Duration) (interface{}, error) {
+	var result interface{}
+	err := a.call(timeout, "CallServer", map[string]interface{}{
+		"msg_type":   msgType,
+		"payload":    data,
+		"timeout_ms": timeout.Milliseconds(),
+	}, &result)
+	return result, err
+}
+
+// SetGauge 和 IncCounter 通过回调转发给 Agent，失败时忽略
+func (a *remoteAgent) SetGauge(name string, value float64) {
+	a.call(0, "SetGauge", map[string]interface{}{"key": name, "value": value}, nil)
+}
+
+func (a *remoteAgent) IncCounter(name string, delta float64) {
+	a.call(0, "IncCounter", map[string]interface{}{"key": name, "value": delta}, nil)
+}
+
+// remoteEvents 外部插件进程中的事件订阅，订阅关系由 Agent 维护
+type remoteEvents struct {
+	agent *remoteAgent
+}
+
+func (e *remoteEvents) Subscribe(eventTypes ...string) error {
+	return e.agent.call(0, "Subscribe", map[string]interface{}{"events": eventTypes}, nil)
+}
+
+func (e *remoteEvents) Unsubscribe(eventTypes ...string) error {
+	return e.agent.call(0, "Unsubscribe", map[string]interface{}{"events": eventTypes}, nil)
+}
+
+// stderrLogger 外部插件进程的日志，写入标准错误后由 Agent 转发到日志
+type stderrLogger struct{}
+
+func (l *stderrLogger) Debug(args ...interface{}) { l.write("DEBUG", fmt.Sprint(args...)) }
+func (l *stderrLogger) Info(args ...interface{})  { l.write("INFO", fmt.Sprint(args...)) }
+func (l *stderrLogger) Warn(args ...interface{})  { l.write("WARN", fmt.Sprint(args...)) }
+func (l *stderrLogger) Error(args ...interface{}) { l.write("ERROR", fmt.Sprint(args...)) }
+
+func (l *stderrLogger) Debugf(format string, args ...interface{}) {
+	l.write("DEBUG", fmt.Sprintf(format, args...))
+}
+
+func (l *stderrLogger) Infof(format string, args ...interface{}) {
+	l.write("INFO", fmt.Sprintf(format, args...))
+}
+
+func (l *stderrLogger) Warnf(format string, args ...interface{}) {
+	l.write("WARN", fmt.Sprintf(format, args...))
+}
+
+func (l *stderrLogger) Errorf(format string, args ...interface{}) {
+	l.write("ERROR", fmt.Sprintf(format, args...))
+}
+
+func (l *stderrLogger) write(level, message string) {
+	fmt.Fprintf(os.Stderr, "[%s] %s\n", level, message)
+}
@@ -0,0 +1,262 @@
+package software
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// PackageTypeFile 从 URL 或本地文件安装
+	PackageTypeFile = "file"
+	// defaultMaxDownloadSize 默认安装包最大字节数
+	defaultMaxDownloadSize = 1024 * 1024 * 1024
+	// defaultDownloadTimeout 默认下载超时时间
+	defaultDownloadTimeout = 30 * time.Minute
+	// exitRebootRequired msiexec 和多数 Windows 安装程序表示安装成功但需要重启的退出码
+	exitRebootRequired = 3010
+)
+
+// formatOS 各安装包格式适用的操作系统
+var formatOS = map[string]string{
+	"msi": "windows",
+	"exe": "windows",
+	"pkg": "darwin",
+	"dmg": "darwin",
+	"deb": "linux",
+	"rpm": "linux",
+}
+
+// prepareFileInstall 校验文件安装请求，未指定格式时根据文件扩展名推断
+func prepareFileInstall(req *InstallRequest, goos string) error {
+	if req.Source == "" {
+		return fmt.Errorf("source is required for file packages")
+	}
+	req.SHA256 = strings.ToLower(strings.TrimSpace(req.SHA256))
+	if sum, err := hex.DecodeString(req.SHA256); err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("sha256 must be a 64-character hex digest")
+	}
+
+	if req.Format == "" {
+		name := req.Source
+		if u, err := url.Parse(req.Source); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+			name = u.Path
+		}
+		req.Format = strings.TrimPrefix(strings.ToLower(path.Ext(filepath.ToSlash(name))), ".")
+	}
+	req.Format = strings.ToLower(req.Format)
+
+	target, ok := formatOS[req.Format]
+	if !ok {
+		return fmt.Errorf("unsupported package format: %q", req.Format)
+	}
+	if target != goos {
+		return fmt.Errorf("%s packages cannot be installed on %s", req.Format, goos)
+	}
+	return nil
+}
+
+// fileInstallArgs 生成安装包的安装命令，silentArgs 追加在命令末尾
+// msi 未指定参数时使用 /qn /norestart 静默安装；dmg 需要先挂载，不在此处理
+func fileInstallArgs(format, file string, silentArgs []string) ([]string, error) {
+	var argv []string
+	switch format {
+	case "msi":
+		if len(silentArgs) == 0 {
+			silentArgs = []string{"/qn", "/norestart"}
+		}
+		argv = []string{"msiexec", "/i", file}
+	case "exe":
+		argv = []string{file}
+	case "pkg":
+		argv = []string{"installer", "-pkg", file, "-target", "/"}
+	case "deb":
+		argv = []string{"dpkg", "-i", file}
+	case "rpm":
+		argv = []string{"rpm", "-U", "--replacepkgs", file}
+	default:
+		return nil, fmt.Errorf("unsupported package format: %q", format)
+	}
+	return append(argv, silentArgs...), nil
+}
+
+// downloadArtifact 下载或复制安装包到临时目录，同时计算 SHA-256 并更新作业进度
+// 校验失败时删除文件
+func (p *SoftwarePlugin) downloadArtifact(ctx context.Context, job *Job, req *InstallRequest) (string, error) {
+	var body io.ReadCloser
+	var total int64
+
+	u, err := url.Parse(req.Source)
+	switch {
+	case err == nil && (u.Scheme == "http" || u.Scheme == "https"):
+		ctx, cancel := context.WithTimeout(ctx, plugin.ConfigDuration(p.config, "download_timeout", defaultDownloadTimeout))
+		defer cancel()
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, req.Source, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			return "", fmt.Errorf("failed to download %s: %v", req.Source, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("failed to download %s: %s", req.Source, resp.Status)
+		}
+		body, total = resp.Body, resp.ContentLength
+	case err == nil && u.Scheme == "file":
+		body, err = os.Open(u.Path)
+		if err != nil {
+			return "", err
+		}
+	default:
+		body, err = os.Open(req.Source)
+		if err != nil {
+			return "", err
+		}
+	}
+	defer body.Close()
+
+	maxSize := int64(plugin.ConfigInt(p.config, "max_download_size", defaultMaxDownloadSize))
+	if total > maxSize {
+		return "", fmt.Errorf("package exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	tempDir, _ := p.ctx.Agent.GetConfig("agent.temp_dir").(string)
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	// 安装包可能很大，直接写入临时文件而不经过内存；exe 安装包需要可执行权限才能直接运行（Windows 上忽略）
+	perm := os.FileMode(0600)
+	if req.Format == "exe" {
+		perm = 0700
+	}
+	name := filepath.Join(tempDir, fmt.Sprintf("%s-%d.%s", job.ID, time.Now().UnixNano(), req.Format))
+	file, err := p.files.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return "", fmt.Errorf("failed to create download file: %v", err)
+	}
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), &progressReader{
+		reader: io.LimitReader(body, maxSize+1),
+		total:  total,
+		update: func(percent int) { p.setJobProgress(job, percent) },
+	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err != nil:
+		err = fmt.Errorf("failed to download %s: %v", req.Source, err)
+	case written > maxSize:
+		err = fmt.Errorf("package exceeds the maximum size of %d bytes", maxSize)
+	case hex.EncodeToString(hash.Sum(nil)) != req.SHA256:
+		err = fmt.Errorf("checksum mismatch: expected %s, got %s", req.SHA256, hex.EncodeToString(hash.Sum(nil)))
+	}
+	if err != nil {
+		p.files.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// progressReader 按已读取的字节数报告下载进度，下载占安装进度的前一半
+type progressReader struct {
+	reader io.Reader
+	total  int64
+	read   int64
+	update func(percent int)
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.read += int64(n)
+	if r.total > 0 {
+		r.update(int(min(r.read*50/r.total, 50)))
+	}
+	return n, err
+}
+
+// setJobProgress 更新作业进度
+func (p *SoftwarePlugin) setJobProgress(job *Job, percent int) {
+	p.jobsMu.Lock()
+	job.Progress = percent
+	p.jobsMu.Unlock()
+}
+
+// installFile 下载并校验安装包后安装
+func (p *SoftwarePlugin) installFile(ctx context.Context, job *Job, req *InstallRequest) error {
+	file, err := p.downloadArtifact(ctx, job, req)
+	if err != nil {
+		return err
+	}
+	defer p.files.Remove(file)
+	p.setJobProgress(job, 50)
+
+	if req.Format == "dmg" {
+		return p.installDMG(ctx, job, file, req.SilentArgs)
+	}
+
+	argv, err := fileInstallArgs(req.Format, file, req.SilentArgs)
+	if err != nil {
+		return err
+	}
+	err = p.runJobCommand(ctx, job, argv)
+	if err != nil && (req.Format == "msi" || req.Format == "exe") && job.ExitCode == exitRebootRequired {
+		p.ctx.Logger.Warnf("Installation of %s requires a reboot to complete", req.Name)
+		return nil
+	}
+	return err
+}
+
+// installDMG 挂载磁盘映像，安装其中的 .pkg 或将 .app 复制到 /Applications，最后卸载映像
+func (p *SoftwarePlugin) installDMG(ctx context.Context, job *Job, file string, silentArgs []string) error {
+	tempDir, _ := p.ctx.Agent.GetConfig("agent.temp_dir").(string)
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	mountPoint := filepath.Join(tempDir, "dmg-"+job.ID)
+	if err := p.files.MkdirAll(mountPoint, 0700); err != nil {
+		return err
+	}
+	defer p.files.Remove(mountPoint)
+
+	if err := p.runJobCommand(ctx, job, []string{"hdiutil", "attach", "-nobrowse", "-readonly", "-mountpoint", mountPoint, file}); err != nil {
+		return err
+	}
+	// 作业被取消时仍需卸载映像
+	defer func() {
+		if cmd, err := p.commander.Command(context.Background(), "hdiutil", "detach", mountPoint, "-force"); err == nil {
+			cmd.Run()
+		}
+	}()
+
+	entries, err := os.ReadDir(mountPoint)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".pkg") {
+			argv, _ := fileInstallArgs("pkg", filepath.Join(mountPoint, entry.Name()), silentArgs)
+			return p.runJobCommand(ctx, job, argv)
+		}
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".app") {
+			return p.runJobCommand(ctx, job, []string{"ditto", filepath.Join(mountPoint, entry.Name()), filepath.Join("/Applications", entry.Name())})
+		}
+	}
+	return fmt.Errorf("disk image contains no .pkg or .app")
+}
@@ -0,0 +1,448 @@
+package software
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// inventoryFileName 软件清单文件，位于 Agent 数据目录
+	inventoryFileName = "software_inventory.json"
+	// defaultScanTimeout 默认单个包管理器的扫描超时时间
+	defaultScanTimeout = 5 * time.Minute
+)
+
+// inventoryScanner 软件清单扫描器，每个扫描器对应一种包管理器或注册表
+type inventoryScanner struct {
+	Name    string
+	Command string // 扫描依赖的命令，不存在时跳过该扫描器；为空表示总是可用
+	Collect func(ctx context.Context, p *SoftwarePlugin) ([]*SoftwareInfo, error)
+}
+
+// inventoryFile 持久化的软件清单
+type inventoryFile struct {
+	ScannedAt time.Time       `json:"scanned_at"`
+	Software  []*SoftwareInfo `json:"software"`
+}
+
+// commandScanner 执行命令并解析输出的扫描器
+func commandScanner(name string, argv []string, parse func([]byte) []*SoftwareInfo) inventoryScanner {
+	return inventoryScanner{
+		Name:    name,
+		Command: argv[0],
+		Collect: func(ctx context.Context, p *SoftwarePlugin) ([]*SoftwareInfo, error) {
+			out, err := p.runScan(ctx, argv)
+			if err != nil {
+				return nil, err
+			}
+			return parse(out), nil
+		},
+	}
+}
+
+// platformScanners 返回当前操作系统的扫描器
+func platformScanners(goos string) []inventoryScanner {
+	switch goos {
+	case "linux":
+		return []inventoryScanner{
+			commandScanner("dpkg", []string{"dpkg-query", "-W", "-f", "${Package}\t${Version}\t${Installed-Size}\t${db:Status-Status}\t${binary:Summary}\n"}, parseDpkg),
+			commandScanner("rpm", []string{"rpm", "-qa", "--queryformat", "%{NAME}\t%{VERSION}-%{RELEASE}\t%{SIZE}\t%{INSTALLTIME}\t%{SUMMARY}\n"}, parseRpm),
+			commandScanner("pacman", []string{"pacman", "-Q"}, parsePacman),
+		}
+	case "darwin":
+		return []inventoryScanner{
+			commandScanner("brew", []string{"brew", "list", "--formula", "--versions"}, parseBrew),
+			commandScanner("brew-cask", []string{"brew", "list", "--cask", "--versions"}, parseBrew),
+		}
+	case "windows":
+		return []inventoryScanner{
+			// choco 2.x 的 list 只列出本地安装的包
+			commandScanner("chocolatey", []string{"choco", "list", "--limit-output"}, parseChoco),
+			{Name: "winget", Command: "winget", Collect: collectWinget},
+			{Name: "registry", Collect: func(ctx context.Context, p *SoftwarePlugin) ([]*SoftwareInfo, error) {
+				return scanRegistry()
+			}},
+		}
+	}
+	return nil
+}
+
+// splitFields 按制表符拆分行，不足 n 列时补空字符串
+func splitFields(line string, n int) []string {
+	fields := strings.SplitN(line, "\t", n)
+	for len(fields) < n {
+		fields = append(fields, "")
+	}
+	return fields
+}
+
+// scanLines 返回输出中的非空行
+func scanLines(out []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// parseDpkg 解析 dpkg-query 输出，Installed-Size 的单位为 KiB，只保留已安装的包
+func parseDpkg(out []byte) []*SoftwareInfo {
+	var result []*SoftwareInfo
+	for _, line := range scanLines(out) {
+		fields := splitFields(line, 5)
+		if fields[0] == "" || (fields[3] != "" && fields[3] != "installed") {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		result = append(result, &SoftwareInfo{
+			Name:        fields[0],
+			Version:     fields[1],
+			PackageType: "dpkg",
+			Description: fields[4],
+			Size:        size * 1024,
+		})
+	}
+	return result
+}
+
+// parseRpm 解析 rpm 查询输出，跳过导入的 GPG 公钥
+func parseRpm(out []byte) []*SoftwareInfo {
+	var result []*SoftwareInfo
+	for _, line := range scanLines(out) {
+		fields := splitFields(line, 5)
+		if fields[0] == "" || fields[0] == "gpg-pubkey" {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		info := &SoftwareInfo{
+			Name:        fields[0],
+			Version:     fields[1],
+			PackageType: "rpm",
+			Description: fields[4],
+			Size:        size,
+		}
+		if ts, err := strconv.ParseInt(fields[3], 10, 64); err == nil && ts > 0 {
+			info.InstallTime = time.Unix(ts, 0)
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// parsePacman 解析 pacman -Q 输出（名称 版本）
+func parsePacman(out []byte) []*SoftwareInfo {
+	var result []*SoftwareInfo
+	for _, line := range scanLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		result = append(result, &SoftwareInfo{Name: fields[0], Version: fields[1], PackageType: "pacman"})
+	}
+	return result
+}
+
+// parseBrew 解析 brew list --versions 输出（名称 版本...），安装了多个版本时取最后一个
+func parseBrew(out []byte) []*SoftwareInfo {
+	var result []*SoftwareInfo
+	for _, line := range scanLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		info := &SoftwareInfo{Name: fields[0], PackageType: "brew"}
+		if len(fields) > 1 {
+			info.Version = fields[len(fields)-1]
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// parseChoco 解析 choco list --limit-output 输出（名称|版本）
+func parseChoco(out []byte) []*SoftwareInfo {
+	var result []*SoftwareInfo
+	for _, line := range scanLines(out) {
+		name, version, ok := strings.Cut(line, "|")
+		if !ok || name == "" {
+			continue
+		}
+		result = append(result, &SoftwareInfo{Name: name, Version: version, PackageType: "chocolatey"})
+	}
+	return result
+}
+
+// parseWingetExport 解析 winget export 生成的 JSON
+func parseWingetExport(data []byte) ([]*SoftwareInfo, error) {
+	var export struct {
+		Sources []struct {
+			Packages []struct {
+				PackageIdentifier string `json:"PackageIdentifier"`
+				Version           string `json:"Version"`
+			} `json:"Packages"`
+		} `json:"Sources"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid winget export: %v", err)
+	}
+
+	var result []*SoftwareInfo
+	for _, source := range export.Sources {
+		for _, pkg := range source.Packages {
+			if pkg.PackageIdentifier == "" {
+				continue
+			}
+			result = append(result, &SoftwareInfo{Name: pkg.PackageIdentifier, Version: pkg.Version, PackageType: "winget"})
+		}
+	}
+	return result, nil
+}
+
+// collectWinget 通过 winget export 导出已安装的包，winget list 只有表格输出
+func collectWinget(ctx context.Context, p *SoftwarePlugin) ([]*SoftwareInfo, error) {
+	data, err := wingetExport(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return parseWingetExport(data)
+}
+
+// wingetExport 执行 winget export 并返回导出的 JSON
+func wingetExport(ctx context.Context, p *SoftwarePlugin) ([]byte, error) {
+	tempDir, _ := p.ctx.Agent.GetConfig("agent.temp_dir").(string)
+	path := filepath.Join(tempDir, fmt.Sprintf("winget-export-%d.json", time.Now().UnixNano()))
+	cmd, err := p.commander.Command(ctx, "winget", "export", "-o", path, "--include-versions",
+		"--accept-source-agreements", "--disable-interactivity")
+	if err != nil {
+		return nil, err
+	}
+	// 部分包在源中不可用时 winget 返回非零退出码，但仍会导出其余的包
+	runErr := cmd.Run()
+	defer p.files.Remove(path)
+
+	if !p.ctx.Agent.FileExists(path) {
+		if runErr != nil {
+			return nil, fmt.Errorf("winget failed: %v", runErr)
+		}
+		return nil, fmt.Errorf("winget did not produce an export")
+	}
+	return p.ctx.Agent.ReadFile(path)
+}
+
+// scanResult 一次扫描的结果
+type scanResult struct {
+	Software  []*SoftwareInfo
+	Sources   map[string]int
+	Errors    map[string]string
+	ScannedAt time.Time
+}
+
+// scanInventory 依次执行可用的扫描器，单个扫描器失败不影响其他扫描器
+func (p *SoftwarePlugin) scanInventory(ctx context.Context) *scanResult {
+	result := &scanResult{
+		Sources:   make(map[string]int),
+		Errors:    make(map[string]string),
+		ScannedAt: time.Now(),
+	}
+	timeout := plugin.ConfigDuration(p.config, "scan_timeout", defaultScanTimeout)
+
+	for _, scanner := range p.scanners {
+		if scanner.Command != "" && !p.hasCommand(scanner.Command) {
+			continue
+		}
+		scanCtx, cancel := context.WithTimeout(ctx, timeout)
+		found, err := scanner.Collect(scanCtx, p)
+		cancel()
+		if err != nil {
+			p.ctx.Logger.Warnf("Software inventory scanner %s failed: %v", scanner.Name, err)
+			result.Errors[scanner.Name] = err.Error()
+			continue
+		}
+		for _, info := range found {
+			info.Source = scanner.Name
+		}
+		result.Sources[scanner.Name] = len(found)
+		result.Software = append(result.Software, found...)
+	}
+	return result
+}
+
+// managerFor 将扫描来源转换为可用于卸载和更新的包管理器类型
+func (p *SoftwarePlugin) managerFor(packageType string) string {
+	switch packageType {
+	case "dpkg":
+		if p.hasCommand("apt-get") {
+			return "apt"
+		}
+	case "rpm":
+		if p.hasCommand("dnf") {
+			return "dnf"
+		}
+		if p.hasCommand("yum") {
+			return "yum"
+		}
+	}
+	return packageType
+}
+
+// mergeInventory 用扫描结果替换未通过 Agent 安装的软件，通过 Agent 安装的软件保留并更新版本
+// 只移除扫描成功的来源中已不存在的软件，扫描失败时保留上次的结果。返回新增和移除的软件数
+func (p *SoftwarePlugin) mergeInventory(result *scanResult) (added, removed int) {
+	found := make(map[string]*SoftwareInfo, len(result.Software))
+	for _, info := range result.Software {
+		// 同名软件以先执行的扫描器为准
+		if _, exists := found[info.Name]; exists {
+			continue
+		}
+		info.PackageType = p.managerFor(info.PackageType)
+		info.Status = "installed"
+		info.LastUpdated = result.ScannedAt
+		if info.Path == "" {
+			info.Path = p.findExecutable(info.Name)
+		}
+		found[info.Name] = info
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for name, info := range p.installed {
+		if _, scanned := result.Sources[info.Source]; info.Managed || !scanned {
+			continue
+		}
+		if _, exists := found[name]; !exists {
+			delete(p.installed, name)
+			removed++
+		}
+	}
+	for name, info := range found {
+		existing, exists := p.installed[name]
+		switch {
+		case !exists:
+			p.installed[name] = info
+			added++
+		case existing.Managed:
+			// 安装中或失败的状态由作业更新
+			if existing.Status == "installed" {
+				existing.Version = info.Version
+				if info.Size > 0 {
+					existing.Size = info.Size
+				}
+			}
+		default:
+			if existing.InstallTime.IsZero() || !info.InstallTime.IsZero() {
+				existing.InstallTime = info.InstallTime
+			}
+			existing.Version, existing.Size, existing.Description = info.Version, info.Size, info.Description
+			existing.PackageType, existing.Path, existing.Status = info.PackageType, info.Path, info.Status
+			existing.Source = info.Source
+		}
+	}
+	p.lastScan = result.ScannedAt
+	return added, removed
+}
+
+// refreshInventory 扫描并合并软件清单，结果保存到数据目录
+func (p *SoftwarePlugin) refreshInventory(ctx context.Context) map[string]interface{} {
+	p.scanMu.Lock()
+	defer p.scanMu.Unlock()
+
+	result := p.scanInventory(ctx)
+	added, removed := p.mergeInventory(result)
+	p.saveInstalledSoftware()
+
+	p.mu.RLock()
+	count := len(p.installed)
+	p.mu.RUnlock()
+
+	p.ctx.Logger.Infof("Software inventory scanned: %d packages, %d added, %d removed", count, added, removed)
+
+	response := map[string]interface{}{
+		"count":      count,
+		"added":      added,
+		"removed":    removed,
+		"sources":    result.Sources,
+		"scanned_at": result.ScannedAt,
+	}
+	if len(result.Errors) > 0 {
+		response["errors"] = result.Errors
+	}
+	return response
+}
+
+// handleScan 处理扫描命令
+func (p *SoftwarePlugin) handleScan(args map[string]interface{}) (interface{}, error) {
+	return p.refreshInventory(context.Background()), nil
+}
+
+// loadInstalledSoftware 从数据目录加载软件清单
+func (p *SoftwarePlugin) loadInstalledSoftware() error {
+	if p.inventoryFile == "" || !p.ctx.Agent.FileExists(p.inventoryFile) {
+		return nil
+	}
+
+	data, err := p.ctx.Agent.ReadFile(p.inventoryFile)
+	if err != nil {
+		return err
+	}
+	var file inventoryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid software inventory: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, info := range file.Software {
+		if info.Name == "" {
+			continue
+		}
+		// 上次退出时未完成的安装视为失败
+		if info.Status == "installing" {
+			info.Status = "failed"
+		}
+		p.installed[info.Name] = info
+	}
+	p.lastScan = file.ScannedAt
+	return nil
+}
+
+// saveInstalledSoftware 保存软件清单，未配置数据目录时只保存在内存中
+func (p *SoftwarePlugin) saveInstalledSoftware() {
+	if p.inventoryFile == "" {
+		return
+	}
+
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	p.mu.RLock()
+	file := inventoryFile{ScannedAt: p.lastScan, Software: make([]*SoftwareInfo, 0, len(p.installed))}
+	for _, info := range p.installed {
+		file.Software = append(file.Software, info)
+	}
+	sort.Slice(file.Software, func(i, j int) bool { return file.Software[i].Name < file.Software[j].Name })
+	data, err := json.MarshalIndent(file, "", "  ")
+	p.mu.RUnlock()
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to encode software inventory: %v", err)
+		return
+	}
+
+	if err := p.ctx.Agent.WriteFile(p.inventoryFile, data); err != nil {
+		p.ctx.Logger.Errorf("Failed to save software inventory: %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package software
+
+// scanRegistry 只有 Windows 有注册表
+func scanRegistry() ([]*SoftwareInfo, error) {
+	return nil, nil
+}
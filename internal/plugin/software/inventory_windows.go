@@ -0,0 +1,75 @@
+//go:build windows
+
+package software
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// uninstallKeys 注册表中记录已安装程序的位置，包括 32 位程序和当前用户安装的程序
+var uninstallKeys = []struct {
+	root registry.Key
+	path string
+}{
+	{registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`},
+	{registry.LOCAL_MACHINE, `SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`},
+	{registry.CURRENT_USER, `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`},
+}
+
+// scanRegistry 读取注册表 Uninstall 键，跳过系统组件和更新补丁
+func scanRegistry() ([]*SoftwareInfo, error) {
+	var result []*SoftwareInfo
+	for _, location := range uninstallKeys {
+		key, err := registry.OpenKey(location.root, location.path, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		names, err := key.ReadSubKeyNames(-1)
+		key.Close()
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if info := readUninstallEntry(location.root, location.path+`\`+name); info != nil {
+				result = append(result, info)
+			}
+		}
+	}
+	return result, nil
+}
+
+// readUninstallEntry 读取单个已安装程序，没有显示名称的条目返回 nil
+func readUninstallEntry(root registry.Key, path string) *SoftwareInfo {
+	key, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+
+	name, _, err := key.GetStringValue("DisplayName")
+	if err != nil || name == "" {
+		return nil
+	}
+	if component, _, err := key.GetIntegerValue("SystemComponent"); err == nil && component == 1 {
+		return nil
+	}
+	if parent, _, err := key.GetStringValue("ParentKeyName"); err == nil && parent != "" {
+		return nil
+	}
+
+	info := &SoftwareInfo{Name: name, PackageType: "registry"}
+	info.Version, _, _ = key.GetStringValue("DisplayVersion")
+	info.Path, _, _ = key.GetStringValue("InstallLocation")
+	info.Description, _, _ = key.GetStringValue("Publisher")
+	if size, _, err := key.GetIntegerValue("EstimatedSize"); err == nil {
+		info.Size = int64(size) * 1024
+	}
+	if date, _, err := key.GetStringValue("InstallDate"); err == nil {
+		if t, err := time.ParseInLocation("20060102", date, time.Local); err == nil {
+			info.InstallTime = t
+		}
+	}
+	return info
+}
@@ -0,0 +1,343 @@
+package software
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// 作业状态
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+const (
+	// defaultMaxConcurrentJobs 默认同时运行的作业数，多数包管理器同一时间只允许一个进程持有锁
+	defaultMaxConcurrentJobs = 1
+	// defaultJobHistory 默认保留的已结束作业数
+	defaultJobHistory = 100
+	// maxJobOutput 每个作业保留的输出字节数，超出时丢弃最早的输出
+	maxJobOutput = 256 * 1024
+	// jobWaitDelay 命令被终止后等待输出管道关闭的时间
+	jobWaitDelay = 5 * time.Second
+)
+
+// errJobCanceled 作业被取消
+var errJobCanceled = errors.New("job canceled")
+
+// progressPattern 从包管理器输出中提取百分比进度
+var progressPattern = regexp.MustCompile(`(\d{1,3})(?:\.\d+)?\s?%`)
+
+// Job 安装、卸载、更新等异步作业，记录状态和包管理器输出
+type Job struct {
+	ID          string    `json:"id"`
+	Action      string    `json:"action"`
+	Package     string    `json:"package"`
+	PackageType string    `json:"package_type,omitempty"`
+	State       string    `json:"state"`
+	Progress    int       `json:"progress"` // 0-100，从输出中解析，无法解析时只在结束时设为 100
+	Command     string    `json:"command,omitempty"`
+	ExitCode    int       `json:"exit_code"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+	SnapshotID  string    `json:"snapshot_id,omitempty"` // 作业执行前创建的快照，可用于回滚
+
+	output    []byte
+	truncated bool
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// JobView 返回给调用方的作业快照
+type JobView struct {
+	Job
+	Output          string `json:"output,omitempty"`
+	OutputTruncated bool   `json:"output_truncated,omitempty"`
+}
+
+// finished 返回作业是否已结束
+func (j *Job) finished() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCanceled
+}
+
+// jobFunc 作业的执行函数，通过 runJobCommand 执行包管理器命令
+type jobFunc func(ctx context.Context, job *Job) error
+
+// jobWriter 将命令输出追加到作业，同时解析进度
+type jobWriter struct {
+	p   *SoftwarePlugin
+	job *Job
+}
+
+func (w *jobWriter) Write(b []byte) (int, error) {
+	w.p.jobsMu.Lock()
+	defer w.p.jobsMu.Unlock()
+
+	job := w.job
+	job.output = append(job.output, b...)
+	if len(job.output) > maxJobOutput {
+		job.output = append([]byte(nil), job.output[len(job.output)-maxJobOutput:]...)
+		job.truncated = true
+	}
+
+	if matches := progressPattern.FindAllSubmatch(b, -1); len(matches) > 0 {
+		if value, err := strconv.Atoi(string(matches[len(matches)-1][1])); err == nil && value <= 100 {
+			job.Progress = value
+		}
+	}
+	return len(b), nil
+}
+
+// newJobID 生成作业 ID
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("job_%x", b)
+}
+
+// startJob 创建作业并排队执行，同一软件包同时只能有一个未结束的作业
+func (p *SoftwarePlugin) startJob(action, name, packageType string, run jobFunc) (*Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:          newJobID(),
+		Action:      action,
+		Package:     name,
+		PackageType: packageType,
+		State:       JobPending,
+		CreatedAt:   time.Now(),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	p.jobsMu.Lock()
+	for _, existing := range p.jobs {
+		if existing.Package == name && !existing.finished() {
+			p.jobsMu.Unlock()
+			cancel()
+			return nil, fmt.Errorf("job %s is already %s for %s", existing.ID, existing.State, name)
+		}
+	}
+	p.jobs[job.ID] = job
+	p.jobsMu.Unlock()
+
+	go p.runJob(ctx, job, run)
+	return job, nil
+}
+
+// runJob 等待空闲的执行槽后执行作业，结束后发送 software_job_completed 或 software_job_failed 事件
+func (p *SoftwarePlugin) runJob(ctx context.Context, job *Job, run jobFunc) {
+	defer close(job.done)
+	defer job.cancel()
+
+	err := errJobCanceled
+	select {
+	case p.jobSlots <- struct{}{}:
+		p.jobsMu.Lock()
+		job.State = JobRunning
+		job.StartedAt = time.Now()
+		p.jobsMu.Unlock()
+
+		err = run(ctx, job)
+		<-p.jobSlots
+	case <-ctx.Done():
+	}
+
+	p.jobsMu.Lock()
+	job.FinishedAt = time.Now()
+	switch {
+	case err == nil:
+		job.State = JobSucceeded
+		job.Progress = 100
+	case errors.Is(err, errJobCanceled):
+		job.State = JobCanceled
+		job.Error = errJobCanceled.Error()
+	default:
+		job.State = JobFailed
+		job.Error = err.Error()
+	}
+	view := p.jobViewLocked(job, 20)
+	p.pruneJobsLocked()
+	p.jobsMu.Unlock()
+
+	eventType := "software_job_completed"
+	if job.State != JobSucceeded {
+		eventType = "software_job_failed"
+	}
+	p.ctx.Logger.Infof("Software job %s (%s %s) %s", job.ID, job.Action, job.Package, view.State)
+	p.ctx.Agent.NotifyEvent(eventType, map[string]interface{}{
+		"job_id":      job.ID,
+		"action":      job.Action,
+		"package":     job.Package,
+		"state":       view.State,
+		"exit_code":   view.ExitCode,
+		"error":       view.Error,
+		"output":      view.Output,
+		"snapshot_id": view.SnapshotID,
+	})
+}
+
+// runJobCommand 在作业中执行命令，输出写入作业，ctx 取消时终止命令
+func (p *SoftwarePlugin) runJobCommand(ctx context.Context, job *Job, argv []string) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	writer := &jobWriter{p: p, job: job}
+	cmd, err := p.commander.Command(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	// 取消后子进程可能仍持有输出管道，最多再等待 jobWaitDelay
+	cmd.WaitDelay = jobWaitDelay
+
+	p.jobsMu.Lock()
+	if job.Command != "" {
+		job.Command += "; "
+	}
+	job.Command += strings.Join(argv, " ")
+	p.jobsMu.Unlock()
+
+	err = cmd.Run()
+
+	p.jobsMu.Lock()
+	if cmd.ProcessState != nil {
+		job.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	p.jobsMu.Unlock()
+
+	if ctx.Err() != nil {
+		return errJobCanceled
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %v", argv[0], err)
+	}
+	return nil
+}
+
+// pruneJobsLocked 只保留最近 job_history 个已结束的作业，调用方需持有 jobsMu
+func (p *SoftwarePlugin) pruneJobsLocked() {
+	limit := plugin.ConfigInt(p.config, "job_history", defaultJobHistory)
+	finished := make([]*Job, 0)
+	for _, job := range p.jobs {
+		if job.finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= limit {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].FinishedAt.After(finished[j].FinishedAt) })
+	for _, job := range finished[limit:] {
+		delete(p.jobs, job.ID)
+	}
+}
+
+// jobViewLocked 返回作业快照，tail 大于 0 时只返回最后 tail 行输出，调用方需持有 jobsMu
+func (p *SoftwarePlugin) jobViewLocked(job *Job, tail int) *JobView {
+	output := string(job.output)
+	if tail > 0 {
+		lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+		if len(lines) > tail {
+			output = strings.Join(lines[len(lines)-tail:], "\n")
+		}
+	}
+	view := &JobView{Job: *job, Output: output, OutputTruncated: job.truncated}
+	view.output, view.cancel, view.done = nil, nil, nil
+	return view
+}
+
+// handleGetJob 处理获取作业命令
+func (p *SoftwarePlugin) handleGetJob(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+	tail, _ := args["tail"].(float64)
+
+	p.jobsMu.Lock()
+	defer p.jobsMu.Unlock()
+
+	job, exists := p.jobs[id]
+	if !exists {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	return p.jobViewLocked(job, int(tail)), nil
+}
+
+// handleListJobs 处理列出作业命令，按创建时间倒序，不返回输出
+func (p *SoftwarePlugin) handleListJobs(args map[string]interface{}) (interface{}, error) {
+	state, _ := args["state"].(string)
+	name, _ := args["package"].(string)
+	action, _ := args["action"].(string)
+
+	p.jobsMu.Lock()
+	jobs := make([]*JobView, 0, len(p.jobs))
+	for _, job := range p.jobs {
+		if (state != "" && job.State != state) || (name != "" && job.Package != name) ||
+			(action != "" && job.Action != action) {
+			continue
+		}
+		view := p.jobViewLocked(job, 0)
+		view.Output = ""
+		jobs = append(jobs, view)
+	}
+	p.jobsMu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+
+	return map[string]interface{}{
+		"jobs":  jobs,
+		"count": len(jobs),
+	}, nil
+}
+
+// handleCancelJob 处理取消作业命令，排队中的作业直接取消，运行中的作业终止包管理器进程
+func (p *SoftwarePlugin) handleCancelJob(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	p.jobsMu.Lock()
+	job, exists := p.jobs[id]
+	if !exists {
+		p.jobsMu.Unlock()
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	if job.finished() {
+		state := job.State
+		p.jobsMu.Unlock()
+		return nil, fmt.Errorf("job %s has already %s", id, state)
+	}
+	p.jobsMu.Unlock()
+
+	job.cancel()
+	<-job.done
+
+	// 取消前作业可能已经结束，返回实际状态
+	p.jobsMu.Lock()
+	state := job.State
+	p.jobsMu.Unlock()
+
+	return map[string]interface{}{
+		"id":      id,
+		"state":   state,
+		"message": "Job canceled",
+	}, nil
+}
@@ -0,0 +1,473 @@
+package software
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// manifestFileName 期望状态清单文件，位于 Agent 数据目录
+	manifestFileName = "software_manifest.json"
+	// defaultReconcileInterval 默认对账间隔
+	defaultReconcileInterval = 30 * time.Minute
+)
+
+// 偏差类型，即对账时执行的操作
+const (
+	DriftInstall   = "install"
+	DriftUpgrade   = "upgrade"
+	DriftDowngrade = "downgrade"
+	DriftRemove    = "remove"
+)
+
+// DesiredPackage 清单中的软件包，Version 为空表示任意版本，否则固定到该版本
+type DesiredPackage struct {
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	PackageType string `json:"package_type,omitempty"`
+	Source      string `json:"source,omitempty"`
+	// package_type 为 file 时使用
+	SHA256     string   `json:"sha256,omitempty"`
+	Format     string   `json:"format,omitempty"`
+	SilentArgs []string `json:"silent_args,omitempty"`
+}
+
+// Manifest 服务器下发的期望状态清单
+type Manifest struct {
+	Packages         []DesiredPackage `json:"packages"`
+	RemoveExtraneous bool             `json:"remove_extraneous"` // 卸载不在清单中的、通过 Agent 安装的软件
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+// Drift 实际状态与清单的偏差
+type Drift struct {
+	Name             string `json:"name"`
+	Action           string `json:"action"`
+	PackageType      string `json:"package_type,omitempty"`
+	DesiredVersion   string `json:"desired_version,omitempty"`
+	InstalledVersion string `json:"installed_version,omitempty"`
+}
+
+// find 返回清单中的软件包
+func (m *Manifest) find(name string) (DesiredPackage, bool) {
+	for _, pkg := range m.Packages {
+		if pkg.Name == name {
+			return pkg, true
+		}
+	}
+	return DesiredPackage{}, false
+}
+
+// parseManifest 解析 set_manifest 参数
+func parseManifest(args map[string]interface{}) (*Manifest, error) {
+	raw, err := json.Marshal(args["packages"])
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{UpdatedAt: time.Now()}
+	if err := json.Unmarshal(raw, &manifest.Packages); err != nil {
+		return nil, fmt.Errorf("invalid packages: %v", err)
+	}
+	manifest.RemoveExtraneous, _ = args["remove_extraneous"].(bool)
+
+	seen := make(map[string]bool)
+	for i := range manifest.Packages {
+		pkg := &manifest.Packages[i]
+		pkg.Name = strings.TrimSpace(pkg.Name)
+		pkg.Version = strings.TrimSpace(pkg.Version)
+		if pkg.Name == "" {
+			return nil, fmt.Errorf("package %d has no name", i)
+		}
+		if seen[pkg.Name] {
+			return nil, fmt.Errorf("package %s is listed more than once", pkg.Name)
+		}
+		seen[pkg.Name] = true
+	}
+	return manifest, nil
+}
+
+// versionMatches 判断已安装版本是否满足期望版本，忽略 epoch 和发行版修订号，如 1:2.3-1ubuntu1 满足 2.3
+func versionMatches(installed, desired string) bool {
+	if installed == desired {
+		return true
+	}
+	if i := strings.Index(installed, ":"); i >= 0 && !strings.Contains(desired, ":") {
+		installed = installed[i+1:]
+	}
+	return installed == desired || strings.HasPrefix(installed, desired+"-")
+}
+
+// versionPartPattern 版本号中的数字段和字母段
+var versionPartPattern = regexp.MustCompile(`\d+|[A-Za-z]+`)
+
+// compareVersions 逐段比较版本号，数字段按数值比较，返回 -1、0 或 1
+func compareVersions(a, b string) int {
+	partsA := versionPartPattern.FindAllString(a, -1)
+	partsB := versionPartPattern.FindAllString(b, -1)
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		x, errX := strconv.Atoi(partsA[i])
+		y, errY := strconv.Atoi(partsB[i])
+		switch {
+		case errX == nil && errY == nil:
+			if x != y {
+				return compareInts(x, y)
+			}
+		case partsA[i] != partsB[i]:
+			return strings.Compare(partsA[i], partsB[i])
+		}
+	}
+	return compareInts(len(partsA), len(partsB))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// versionChangeArgs 生成升级或降级到指定版本的命令
+func versionChangeArgs(manager, name, version string, downgrade bool) ([]string, error) {
+	switch manager {
+	case "apt":
+		return []string{"apt-get", "install", "-y", "--allow-downgrades", name + "=" + version}, nil
+	case "yum", "dnf":
+		if downgrade {
+			return []string{manager, "downgrade", "-y", name + "-" + version}, nil
+		}
+		return []string{manager, "install", "-y", name + "-" + version}, nil
+	case "chocolatey":
+		return []string{"choco", "upgrade", name, "-y", "--version", version, "--allow-downgrade"}, nil
+	case "winget":
+		return []string{"winget", "install", name, "--version", version, "--force"}, nil
+	}
+	return nil, fmt.Errorf("changing the version is not supported for %s packages", manager)
+}
+
+// hasActiveJob 返回软件包是否有未结束的作业
+func (p *SoftwarePlugin) hasActiveJob(name string) bool {
+	p.jobsMu.Lock()
+	defer p.jobsMu.Unlock()
+	for _, job := range p.jobs {
+		if job.Package == name && !job.finished() {
+			return true
+		}
+	}
+	return false
+}
+
+// computeDrift 比较已安装软件与清单，跳过正在执行作业的软件包
+func (p *SoftwarePlugin) computeDrift(manifest *Manifest) []Drift {
+	p.mu.RLock()
+	var drift []Drift
+	for _, pkg := range manifest.Packages {
+		info, exists := p.installed[pkg.Name]
+		switch {
+		case !exists || info.Status == "failed":
+			drift = append(drift, Drift{Name: pkg.Name, Action: DriftInstall, PackageType: pkg.PackageType, DesiredVersion: pkg.Version})
+		case info.Status != "installed":
+			continue
+		case pkg.Version != "" && !versionMatches(info.Version, pkg.Version):
+			action := DriftUpgrade
+			if compareVersions(info.Version, pkg.Version) > 0 {
+				action = DriftDowngrade
+			}
+			drift = append(drift, Drift{
+				Name:             pkg.Name,
+				Action:           action,
+				PackageType:      info.PackageType,
+				DesiredVersion:   pkg.Version,
+				InstalledVersion: info.Version,
+			})
+		}
+	}
+
+	// 只卸载通过 Agent 安装的软件，扫描发现的系统软件不受清单管理
+	if manifest.RemoveExtraneous {
+		for name, info := range p.installed {
+			if _, desired := manifest.find(name); !desired && info.Managed && info.Status == "installed" {
+				drift = append(drift, Drift{Name: name, Action: DriftRemove, PackageType: info.PackageType, InstalledVersion: info.Version})
+			}
+		}
+	}
+	p.mu.RUnlock()
+
+	return p.pendingDrift(drift)
+}
+
+// pendingDrift 去掉已有未结束作业的软件包并按名称排序
+func (p *SoftwarePlugin) pendingDrift(drift []Drift) []Drift {
+	result := drift[:0]
+	for _, d := range drift {
+		if !p.hasActiveJob(d.Name) {
+			result = append(result, d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// startVersionChange 创建升级或降级到指定版本的作业
+func (p *SoftwarePlugin) startVersionChange(d Drift) (*Job, error) {
+	p.mu.RLock()
+	info, exists := p.installed[d.Name]
+	p.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("software %s is not installed", d.Name)
+	}
+
+	argv, err := versionChangeArgs(info.PackageType, d.Name, d.DesiredVersion, d.Action == DriftDowngrade)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.startJob(d.Action, d.Name, info.PackageType, func(ctx context.Context, job *Job) error {
+		if err := p.runJobCommand(ctx, job, argv); err != nil {
+			p.ctx.Logger.Errorf("Failed to %s %s to %s: %v", d.Action, d.Name, d.DesiredVersion, err)
+			return fmt.Errorf("%s failed: %v", d.Action, err)
+		}
+		// 清单中的软件由 Agent 管理
+		p.mu.Lock()
+		info.Version = d.DesiredVersion
+		info.LastUpdated = time.Now()
+		info.Managed = true
+		p.mu.Unlock()
+		p.saveInstalledSoftware()
+		p.ctx.Logger.Infof("Successfully changed %s to version %s", d.Name, d.DesiredVersion)
+		return nil
+	})
+}
+
+// startDriftJob 创建消除偏差的作业
+func (p *SoftwarePlugin) startDriftJob(manifest *Manifest, d Drift) (*Job, error) {
+	switch d.Action {
+	case DriftInstall:
+		pkg, _ := manifest.find(d.Name)
+		return p.startInstall(&InstallRequest{
+			Name:        pkg.Name,
+			Version:     pkg.Version,
+			PackageType: pkg.PackageType,
+			Source:      pkg.Source,
+			SHA256:      pkg.SHA256,
+			Format:      pkg.Format,
+			SilentArgs:  pkg.SilentArgs,
+		})
+	case DriftUpgrade, DriftDowngrade:
+		return p.startVersionChange(d)
+	case DriftRemove:
+		return p.startUninstall(d.Name)
+	}
+	return nil, fmt.Errorf("unknown drift action: %s", d.Action)
+}
+
+// startDriftJobs 为每项偏差创建作业，返回作业 ID 或创建失败的原因
+func (p *SoftwarePlugin) startDriftJobs(manifest *Manifest, drift []Drift) []map[string]interface{} {
+	actions := make([]map[string]interface{}, 0, len(drift))
+	for _, d := range drift {
+		action := map[string]interface{}{"name": d.Name, "action": d.Action}
+		if job, err := p.startDriftJob(manifest, d); err != nil {
+			p.ctx.Logger.Warnf("Failed to %s %s: %v", d.Action, d.Name, err)
+			action["error"] = err.Error()
+		} else {
+			action["job_id"] = job.ID
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// reconcile 扫描已安装软件并与清单对账，发现偏差时发送 software_drift_detected 事件
+// dryRun 为 true 时只报告偏差，不执行操作
+func (p *SoftwarePlugin) reconcile(ctx context.Context, manifest *Manifest, dryRun bool) map[string]interface{} {
+	p.reconcileMu.Lock()
+	defer p.reconcileMu.Unlock()
+
+	if len(p.scanners) > 0 {
+		p.refreshInventory(ctx)
+	}
+
+	drift := p.computeDrift(manifest)
+	if !dryRun {
+		p.mu.Lock()
+		p.lastReconcile = time.Now()
+		p.driftCount = len(drift)
+		p.mu.Unlock()
+	}
+
+	if len(drift) > 0 {
+		p.ctx.Logger.Infof("Software drift detected: %d packages", len(drift))
+		p.ctx.Agent.NotifyEvent("software_drift_detected", map[string]interface{}{
+			"drift":   drift,
+			"count":   len(drift),
+			"dry_run": dryRun,
+		})
+	}
+
+	actions := make([]map[string]interface{}, 0, len(drift))
+	if !dryRun {
+		actions = p.startDriftJobs(manifest, drift)
+	}
+
+	return map[string]interface{}{
+		"in_sync": len(drift) == 0,
+		"drift":   drift,
+		"actions": actions,
+		"dry_run": dryRun,
+	}
+}
+
+// reconcileLoop 定期对账
+func (p *SoftwarePlugin) reconcileLoop(ctx context.Context) {
+	ticker := time.NewTicker(plugin.ConfigDuration(p.config, "reconcile_interval", defaultReconcileInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.RLock()
+			manifest := p.manifest
+			p.mu.RUnlock()
+			if manifest != nil {
+				p.reconcile(ctx, manifest, false)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleSetManifest 处理设置清单命令，保存后立即对账；dry_run 只报告新清单的偏差，不保存
+func (p *SoftwarePlugin) handleSetManifest(args map[string]interface{}) (interface{}, error) {
+	manifest, err := parseManifest(args)
+	if err != nil {
+		return nil, err
+	}
+	dryRun, _ := args["dry_run"].(bool)
+
+	if !dryRun {
+		p.mu.Lock()
+		p.manifest = manifest
+		p.mu.Unlock()
+		if err := p.saveManifest(); err != nil {
+			p.ctx.Logger.Errorf("Failed to save software manifest: %v", err)
+		}
+		p.ctx.Logger.Infof("Software manifest updated: %d packages", len(manifest.Packages))
+	}
+
+	result := p.reconcile(context.Background(), manifest, dryRun)
+	result["packages"] = len(manifest.Packages)
+	return result, nil
+}
+
+// handleGetManifest 处理获取清单命令
+func (p *SoftwarePlugin) handleGetManifest(args map[string]interface{}) (interface{}, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.manifest == nil {
+		return nil, fmt.Errorf("no manifest is configured")
+	}
+	return map[string]interface{}{
+		"manifest":       p.manifest,
+		"last_reconcile": p.lastReconcile,
+		"drift_count":    p.driftCount,
+	}, nil
+}
+
+// handleClearManifest 处理清除清单命令，已安装的软件保持不变
+func (p *SoftwarePlugin) handleClearManifest(args map[string]interface{}) (interface{}, error) {
+	p.mu.Lock()
+	p.manifest = nil
+	p.driftCount = 0
+	p.mu.Unlock()
+
+	if err := p.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to remove software manifest: %v", err)
+	}
+
+	p.ctx.Logger.Info("Software manifest cleared")
+	return map[string]interface{}{"message": "Manifest cleared"}, nil
+}
+
+// handleReconcile 处理对账命令
+func (p *SoftwarePlugin) handleReconcile(args map[string]interface{}) (interface{}, error) {
+	dryRun, _ := args["dry_run"].(bool)
+
+	p.mu.RLock()
+	manifest := p.manifest
+	p.mu.RUnlock()
+	if manifest == nil {
+		return nil, fmt.Errorf("no manifest is configured")
+	}
+
+	return p.reconcile(context.Background(), manifest, dryRun), nil
+}
+
+// pinnedVersion 返回清单固定的版本
+func (p *SoftwarePlugin) pinnedVersion(name string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.manifest == nil {
+		return ""
+	}
+	pkg, _ := p.manifest.find(name)
+	return pkg.Version
+}
+
+// loadManifest 从数据目录加载清单
+func (p *SoftwarePlugin) loadManifest() error {
+	if p.manifestFile == "" || !p.ctx.Agent.FileExists(p.manifestFile) {
+		return nil
+	}
+
+	data, err := p.ctx.Agent.ReadFile(p.manifestFile)
+	if err != nil {
+		return err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid software manifest: %v", err)
+	}
+
+	p.mu.Lock()
+	p.manifest = &manifest
+	p.mu.Unlock()
+	return nil
+}
+
+// saveManifest 保存清单，清单被清除时删除文件
+func (p *SoftwarePlugin) saveManifest() error {
+	if p.manifestFile == "" {
+		return nil
+	}
+
+	p.mu.RLock()
+	manifest := p.manifest
+	p.mu.RUnlock()
+
+	if manifest == nil {
+		if err := p.files.Remove(p.manifestFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return p.ctx.Agent.WriteFile(p.manifestFile, data)
+}
@@ -0,0 +1,396 @@
+package software
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// 服务操作
+const (
+	ServiceStart   = "start"
+	ServiceStop    = "stop"
+	ServiceRestart = "restart"
+	ServiceEnable  = "enable"
+	ServiceDisable = "disable"
+)
+
+// 服务状态
+const (
+	ServiceRunning  = "running"
+	ServiceStopped  = "stopped"
+	ServiceStarting = "starting"
+	ServiceStopping = "stopping"
+	ServiceFailed   = "failed"
+)
+
+// defaultServiceTimeout 默认服务操作超时时间
+const defaultServiceTimeout = time.Minute
+
+// ServiceInfo 系统服务信息
+type ServiceInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+	Description string `json:"description,omitempty"`
+	State       string `json:"state"`                // running, stopped, starting, stopping, failed
+	Enabled     bool   `json:"enabled"`              // 是否随系统启动
+	StartType   string `json:"start_type,omitempty"` // 服务管理器的原始启动类型，如 enabled、static、auto、manual
+	PID         int    `json:"pid,omitempty"`
+	Manager     string `json:"manager"` // systemd, launchd, scm
+}
+
+// serviceManager 系统服务管理器，Command 为空时不检测命令是否存在
+type serviceManager struct {
+	Name    string
+	Command string
+	List    func(ctx context.Context, p *SoftwarePlugin) ([]*ServiceInfo, error)
+	Get     func(ctx context.Context, p *SoftwarePlugin, name string) (*ServiceInfo, error)
+	Control func(ctx context.Context, p *SoftwarePlugin, name, action string) error
+}
+
+// platformServiceManager 返回当前操作系统的服务管理器
+func platformServiceManager(goos string) *serviceManager {
+	switch goos {
+	case "linux":
+		return &serviceManager{Name: "systemd", Command: "systemctl", List: systemdList, Get: systemdGet, Control: systemdControl}
+	case "darwin":
+		return &serviceManager{Name: "launchd", Command: "launchctl", List: launchdList, Get: launchdGet, Control: launchdControl}
+	case "windows":
+		return &serviceManager{Name: "scm", List: scmListServices, Get: scmGetService, Control: scmControlService}
+	}
+	return nil
+}
+
+// validateServiceName 校验服务名称，避免被当作命令选项或路径
+func validateServiceName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("service name is required")
+	}
+	if strings.HasPrefix(name, "-") || strings.ContainsAny(name, "/\\\x00\n\r\t") {
+		return fmt.Errorf("invalid service name: %q", name)
+	}
+	return nil
+}
+
+// systemdUnit 未指定单元类型时补充 .service 后缀
+func systemdUnit(name string) string {
+	for _, suffix := range []string{".service", ".socket", ".timer"} {
+		if strings.HasSuffix(name, suffix) {
+			return name
+		}
+	}
+	return name + ".service"
+}
+
+// systemdState 将 systemd 的 ActiveState 转换为服务状态
+func systemdState(active string) string {
+	switch active {
+	case "active", "reloading":
+		return ServiceRunning
+	case "inactive":
+		return ServiceStopped
+	case "activating":
+		return ServiceStarting
+	case "deactivating":
+		return ServiceStopping
+	case "failed":
+		return ServiceFailed
+	}
+	return active
+}
+
+// systemdEnabled 判断单元文件状态是否表示随系统启动
+func systemdEnabled(state string) bool {
+	return state == "enabled" || state == "enabled-runtime"
+}
+
+// systemdList 列出已加载的服务和已安装但未加载的服务单元
+func systemdList(ctx context.Context, p *SoftwarePlugin) ([]*ServiceInfo, error) {
+	units, err := p.runScan(ctx, []string{"systemctl", "list-units", "--type=service", "--all", "--no-legend", "--no-pager", "--plain"})
+	if err != nil {
+		return nil, err
+	}
+	files, err := p.runScan(ctx, []string{"systemctl", "list-unit-files", "--type=service", "--no-legend", "--no-pager"})
+	if err != nil {
+		return nil, err
+	}
+	return mergeSystemdUnits(parseSystemdUnits(units), parseSystemdUnitFiles(files)), nil
+}
+
+// parseSystemdUnits 解析 systemctl list-units 输出（单元 加载状态 活动状态 子状态 描述），跳过未找到的单元
+func parseSystemdUnits(out []byte) []*ServiceInfo {
+	var result []*ServiceInfo
+	for _, line := range scanLines(out) {
+		// 失败的单元前面带有 ● 标记
+		fields := strings.Fields(strings.TrimPrefix(line, "●"))
+		if len(fields) < 4 || fields[1] == "not-found" {
+			continue
+		}
+		result = append(result, &ServiceInfo{
+			Name:        fields[0],
+			Description: strings.Join(fields[4:], " "),
+			State:       systemdState(fields[2]),
+			Manager:     "systemd",
+		})
+	}
+	return result
+}
+
+// parseSystemdUnitFiles 解析 systemctl list-unit-files 输出，返回单元文件状态，跳过模板单元
+func parseSystemdUnitFiles(out []byte) map[string]string {
+	result := make(map[string]string)
+	for _, line := range scanLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.Contains(fields[0], "@.") {
+			continue
+		}
+		result[fields[0]] = fields[1]
+	}
+	return result
+}
+
+// mergeSystemdUnits 合并单元状态和单元文件状态，未加载的单元视为已停止
+func mergeSystemdUnits(units []*ServiceInfo, files map[string]string) []*ServiceInfo {
+	seen := make(map[string]bool, len(units))
+	for _, unit := range units {
+		seen[unit.Name] = true
+		unit.StartType = files[unit.Name]
+		unit.Enabled = systemdEnabled(unit.StartType)
+	}
+	for name, state := range files {
+		if !seen[name] {
+			units = append(units, &ServiceInfo{Name: name, State: ServiceStopped, StartType: state, Enabled: systemdEnabled(state), Manager: "systemd"})
+		}
+	}
+	return units
+}
+
+// systemdGet 通过 systemctl show 查询单个服务
+func systemdGet(ctx context.Context, p *SoftwarePlugin, name string) (*ServiceInfo, error) {
+	out, err := p.runScan(ctx, []string{"systemctl", "show", systemdUnit(name), "--no-pager",
+		"--property=Id,Description,LoadState,ActiveState,UnitFileState,MainPID"})
+	if err != nil {
+		return nil, err
+	}
+	return parseSystemctlShow(out, name)
+}
+
+// parseSystemctlShow 解析 systemctl show 的 key=value 输出
+func parseSystemctlShow(out []byte, name string) (*ServiceInfo, error) {
+	props := make(map[string]string)
+	for _, line := range scanLines(out) {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			props[key] = value
+		}
+	}
+	if props["LoadState"] == "not-found" || props["Id"] == "" {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+
+	info := &ServiceInfo{
+		Name:        props["Id"],
+		Description: props["Description"],
+		State:       systemdState(props["ActiveState"]),
+		StartType:   props["UnitFileState"],
+		Enabled:     systemdEnabled(props["UnitFileState"]),
+		Manager:     "systemd",
+	}
+	info.PID, _ = strconv.Atoi(props["MainPID"])
+	return info, nil
+}
+
+// systemdControl 执行 systemctl start/stop/restart/enable/disable
+func systemdControl(ctx context.Context, p *SoftwarePlugin, name, action string) error {
+	_, err := p.runScan(ctx, []string{"systemctl", action, systemdUnit(name)})
+	return err
+}
+
+// launchdList 列出 system 域的 launchd 服务
+func launchdList(ctx context.Context, p *SoftwarePlugin) ([]*ServiceInfo, error) {
+	out, err := p.runScan(ctx, []string{"launchctl", "list"})
+	if err != nil {
+		return nil, err
+	}
+	services := parseLaunchctlList(out)
+
+	// 查询失败时按默认启用处理
+	if disabledOut, err := p.runScan(ctx, []string{"launchctl", "print-disabled", "system"}); err == nil {
+		disabled := parseLaunchdDisabled(disabledOut)
+		for _, service := range services {
+			service.Enabled = !disabled[service.Name]
+		}
+	}
+	return services, nil
+}
+
+// parseLaunchctlList 解析 launchctl list 输出（PID 退出状态 标签），PID 为 - 表示未运行
+func parseLaunchctlList(out []byte) []*ServiceInfo {
+	var result []*ServiceInfo
+	for _, line := range scanLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] == "PID" {
+			continue
+		}
+		info := &ServiceInfo{Name: fields[2], State: ServiceStopped, Enabled: true, Manager: "launchd"}
+		if pid, err := strconv.Atoi(fields[0]); err == nil {
+			info.State, info.PID = ServiceRunning, pid
+		} else if fields[1] != "0" && fields[1] != "-" {
+			// 未运行且上次退出状态非零
+			info.State = ServiceFailed
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// parseLaunchdDisabled 解析 launchctl print-disabled 输出，如 "com.example.agent" => disabled
+// 旧版本 macOS 输出 true/false
+func parseLaunchdDisabled(out []byte) map[string]bool {
+	result := make(map[string]bool)
+	for _, line := range scanLines(out) {
+		label, value, ok := strings.Cut(line, "=>")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		result[strings.Trim(strings.TrimSpace(label), `"`)] = value == "disabled" || value == "true"
+	}
+	return result
+}
+
+// launchdGet 从服务列表中查找单个服务
+func launchdGet(ctx context.Context, p *SoftwarePlugin, name string) (*ServiceInfo, error) {
+	services, err := launchdList(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		if service.Name == name {
+			return service, nil
+		}
+	}
+	return nil, fmt.Errorf("service %s not found", name)
+}
+
+// launchdControl 控制 system 域的 launchd 服务，enable/disable 在下次加载时生效
+func launchdControl(ctx context.Context, p *SoftwarePlugin, name, action string) error {
+	target := "system/" + name
+	var argv []string
+	switch action {
+	case ServiceStart:
+		argv = []string{"launchctl", "kickstart", target}
+	case ServiceStop:
+		argv = []string{"launchctl", "kill", "SIGTERM", target}
+	case ServiceRestart:
+		argv = []string{"launchctl", "kickstart", "-k", target}
+	case ServiceEnable, ServiceDisable:
+		argv = []string{"launchctl", action, target}
+	default:
+		return fmt.Errorf("unsupported service action: %s", action)
+	}
+	_, err := p.runScan(ctx, argv)
+	return err
+}
+
+// serviceManagerFor 返回可用的服务管理器
+func (p *SoftwarePlugin) serviceManagerFor() (*serviceManager, error) {
+	if p.services == nil || (p.services.Command != "" && !p.hasCommand(p.services.Command)) {
+		return nil, fmt.Errorf("no supported service manager found")
+	}
+	return p.services, nil
+}
+
+// handleListServices 处理列出服务命令，name 按子串匹配服务名称和显示名称
+func (p *SoftwarePlugin) handleListServices(args map[string]interface{}) (interface{}, error) {
+	manager, err := p.serviceManagerFor()
+	if err != nil {
+		return nil, err
+	}
+	state, _ := args["state"].(string)
+	name, _ := args["name"].(string)
+	name = strings.ToLower(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), plugin.ConfigDuration(p.config, "service_timeout", defaultServiceTimeout))
+	defer cancel()
+	services, err := manager.List(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %v", err)
+	}
+
+	filtered := make([]*ServiceInfo, 0, len(services))
+	for _, service := range services {
+		if state != "" && service.State != state {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(service.Name), name) &&
+			!strings.Contains(strings.ToLower(service.DisplayName), name) {
+			continue
+		}
+		filtered = append(filtered, service)
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Name < filtered[j].Name })
+
+	return map[string]interface{}{
+		"services": filtered,
+		"count":    len(filtered),
+		"manager":  manager.Name,
+	}, nil
+}
+
+// handleGetService 处理查询服务命令
+func (p *SoftwarePlugin) handleGetService(args map[string]interface{}) (interface{}, error) {
+	manager, err := p.serviceManagerFor()
+	if err != nil {
+		return nil, err
+	}
+	name, _ := args["name"].(string)
+	if err := validateServiceName(name); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), plugin.ConfigDuration(p.config, "service_timeout", defaultServiceTimeout))
+	defer cancel()
+	return manager.Get(ctx, p, name)
+}
+
+// handleServiceAction 处理启动、停止、重启、启用和禁用服务命令，成功后返回服务的当前状态
+func (p *SoftwarePlugin) handleServiceAction(action string, args map[string]interface{}) (interface{}, error) {
+	manager, err := p.serviceManagerFor()
+	if err != nil {
+		return nil, err
+	}
+	name, _ := args["name"].(string)
+	if err := validateServiceName(name); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), plugin.ConfigDuration(p.config, "service_timeout", defaultServiceTimeout))
+	defer cancel()
+	if err := manager.Control(ctx, p, name, action); err != nil {
+		p.ctx.Logger.Errorf("Failed to %s service %s: %v", action, name, err)
+		return nil, fmt.Errorf("failed to %s service %s: %v", action, name, err)
+	}
+	p.ctx.Logger.Infof("Service %s: %s", name, action)
+
+	result := map[string]interface{}{
+		"name":   name,
+		"action": action,
+	}
+	event := map[string]interface{}{
+		"name":    name,
+		"action":  action,
+		"manager": manager.Name,
+	}
+	if service, err := manager.Get(ctx, p, name); err == nil {
+		result["service"] = service
+		event["state"] = service.State
+		event["enabled"] = service.Enabled
+	}
+	p.ctx.Agent.NotifyEvent("software_service_changed", event)
+	return result, nil
+}
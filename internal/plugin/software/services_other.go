@@ -0,0 +1,23 @@
+//go:build !windows
+
+package software
+
+import (
+	"context"
+	"fmt"
+)
+
+// errNoSCM 服务控制管理器只在 Windows 上可用
+var errNoSCM = fmt.Errorf("service control manager is only available on windows")
+
+func scmListServices(ctx context.Context, p *SoftwarePlugin) ([]*ServiceInfo, error) {
+	return nil, errNoSCM
+}
+
+func scmGetService(ctx context.Context, p *SoftwarePlugin, name string) (*ServiceInfo, error) {
+	return nil, errNoSCM
+}
+
+func scmControlService(ctx context.Context, p *SoftwarePlugin, name, action string) error {
+	return errNoSCM
+}
@@ -0,0 +1,184 @@
+//go:build windows
+
+package software
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// scmState 将服务控制管理器的状态转换为服务状态
+func scmState(state svc.State) string {
+	switch state {
+	case svc.Running:
+		return ServiceRunning
+	case svc.Stopped:
+		return ServiceStopped
+	case svc.StartPending, svc.ContinuePending:
+		return ServiceStarting
+	case svc.StopPending, svc.PausePending:
+		return ServiceStopping
+	case svc.Paused:
+		return "paused"
+	}
+	return fmt.Sprintf("unknown(%d)", state)
+}
+
+// 驱动程序的启动类型，mgr 包没有定义
+const (
+	windowsBootStart   = 0
+	windowsSystemStart = 1
+)
+
+// scmStartType 返回启动类型名称，自动启动、引导和系统驱动视为随系统启动
+func scmStartType(config mgr.Config) (string, bool) {
+	switch config.StartType {
+	case mgr.StartAutomatic:
+		if config.DelayedAutoStart {
+			return "delayed-auto", true
+		}
+		return "auto", true
+	case mgr.StartManual:
+		return "manual", false
+	case mgr.StartDisabled:
+		return "disabled", false
+	case windowsBootStart:
+		return "boot", true
+	case windowsSystemStart:
+		return "system", true
+	}
+	return fmt.Sprintf("unknown(%d)", config.StartType), false
+}
+
+// scmListServices 列出服务控制管理器中的全部服务，跳过无法打开的服务
+func scmListServices(ctx context.Context, p *SoftwarePlugin) ([]*ServiceInfo, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to service control manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	names, err := m.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	var result []*ServiceInfo
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if info, err := queryService(m, name); err == nil {
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
+
+// scmGetService 查询单个服务
+func scmGetService(ctx context.Context, p *SoftwarePlugin, name string) (*ServiceInfo, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to service control manager: %v", err)
+	}
+	defer m.Disconnect()
+	return queryService(m, name)
+}
+
+// queryService 读取服务的状态和配置
+func queryService(m *mgr.Mgr, name string) (*ServiceInfo, error) {
+	s, err := m.OpenService(name)
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found: %v", name, err)
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ServiceInfo{
+		Name:        name,
+		DisplayName: config.DisplayName,
+		Description: config.Description,
+		State:       scmState(status.State),
+		PID:         int(status.ProcessId),
+		Manager:     "scm",
+	}
+	info.StartType, info.Enabled = scmStartType(config)
+	return info, nil
+}
+
+// scmControlService 启动、停止、重启服务或修改启动类型，停止时等待服务进入已停止状态
+func scmControlService(ctx context.Context, p *SoftwarePlugin, name, action string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service control manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s not found: %v", name, err)
+	}
+	defer s.Close()
+
+	switch action {
+	case ServiceStart:
+		return s.Start()
+	case ServiceStop:
+		return stopService(ctx, s)
+	case ServiceRestart:
+		if err := stopService(ctx, s); err != nil {
+			return err
+		}
+		return s.Start()
+	case ServiceEnable, ServiceDisable:
+		config, err := s.Config()
+		if err != nil {
+			return err
+		}
+		if action == ServiceEnable {
+			config.StartType = mgr.StartAutomatic
+		} else {
+			config.StartType = mgr.StartDisabled
+		}
+		return s.UpdateConfig(config)
+	}
+	return fmt.Errorf("unsupported service action: %s", action)
+}
+
+// stopService 发送停止控制并等待服务停止，服务已停止时直接返回
+func stopService(ctx context.Context, s *mgr.Service) error {
+	status, err := s.Query()
+	if err != nil {
+		return err
+	}
+	if status.State != svc.Stopped && status.State != svc.StopPending {
+		if status, err = s.Control(svc.Stop); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(300 * time.Millisecond)
+	defer ticker.Stop()
+	for status.State != svc.Stopped {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for service to stop")
+		case <-ticker.C:
+		}
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
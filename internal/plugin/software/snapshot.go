@@ -0,0 +1,380 @@
+package software
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// snapshotsFileName 软件包快照文件，位于 Agent 数据目录
+	snapshotsFileName = "software_snapshots.json"
+	// defaultSnapshotRetention 默认保留的快照数
+	defaultSnapshotRetention = 5
+)
+
+// SnapshotPackage 快照中的软件包
+type SnapshotPackage struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	PackageType string `json:"package_type"`
+	Source      string `json:"source,omitempty"`
+	Managed     bool   `json:"managed"`
+}
+
+// Snapshot 安装或更新前的软件包集合，rollback 按快照恢复
+type Snapshot struct {
+	ID        string            `json:"id"`
+	Reason    string            `json:"reason,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	Packages  []SnapshotPackage `json:"packages"`
+	// 创建快照时扫描成功的扫描器，回滚时只卸载这些来源中新增的软件
+	Sources []string `json:"sources,omitempty"`
+	// 包管理器的原生导出，如 dpkg 选择列表、Brewfile、winget 导出，用于人工恢复
+	Exports map[string]string `json:"exports,omitempty"`
+}
+
+// snapshotExporter 包管理器原生导出
+type snapshotExporter struct {
+	Name    string
+	Command string
+	Export  func(ctx context.Context, p *SoftwarePlugin) ([]byte, error)
+}
+
+// platformSnapshotExporters 返回当前操作系统的原生导出
+func platformSnapshotExporters(goos string) []snapshotExporter {
+	switch goos {
+	case "linux":
+		return []snapshotExporter{
+			{Name: "dpkg-selections", Command: "dpkg", Export: func(ctx context.Context, p *SoftwarePlugin) ([]byte, error) {
+				return p.runScan(ctx, []string{"dpkg", "--get-selections"})
+			}},
+		}
+	case "darwin":
+		return []snapshotExporter{
+			{Name: "Brewfile", Command: "brew", Export: func(ctx context.Context, p *SoftwarePlugin) ([]byte, error) {
+				return p.runScan(ctx, []string{"brew", "bundle", "dump", "--file=-"})
+			}},
+		}
+	case "windows":
+		return []snapshotExporter{
+			{Name: "winget-export", Command: "winget", Export: wingetExport},
+		}
+	}
+	return nil
+}
+
+// newSnapshotID 生成快照 ID
+func newSnapshotID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("snap_%x", b)
+}
+
+// createSnapshot 扫描已安装软件后记录软件包集合和原生导出，超过保留数时删除最旧的快照
+func (p *SoftwarePlugin) createSnapshot(ctx context.Context, reason string) (*Snapshot, error) {
+	snapshot := &Snapshot{ID: newSnapshotID(), Reason: reason, Exports: make(map[string]string)}
+
+	if len(p.scanners) > 0 {
+		scan := p.refreshInventory(ctx)
+		if sources, ok := scan["sources"].(map[string]int); ok {
+			for source := range sources {
+				snapshot.Sources = append(snapshot.Sources, source)
+			}
+			sort.Strings(snapshot.Sources)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	timeout := plugin.ConfigDuration(p.config, "scan_timeout", defaultScanTimeout)
+	for _, exporter := range p.snapshotExporters {
+		if exporter.Command != "" && !p.hasCommand(exporter.Command) {
+			continue
+		}
+		exportCtx, cancel := context.WithTimeout(ctx, timeout)
+		data, err := exporter.Export(exportCtx, p)
+		cancel()
+		if err != nil {
+			p.ctx.Logger.Warnf("Software snapshot export %s failed: %v", exporter.Name, err)
+			continue
+		}
+		snapshot.Exports[exporter.Name] = string(data)
+	}
+
+	p.mu.Lock()
+	for _, info := range p.installed {
+		if info.Status != "installed" {
+			continue
+		}
+		snapshot.Packages = append(snapshot.Packages, SnapshotPackage{
+			Name:        info.Name,
+			Version:     info.Version,
+			PackageType: info.PackageType,
+			Source:      info.Source,
+			Managed:     info.Managed,
+		})
+	}
+	sort.Slice(snapshot.Packages, func(i, j int) bool { return snapshot.Packages[i].Name < snapshot.Packages[j].Name })
+	snapshot.CreatedAt = time.Now()
+
+	p.snapshots = append(p.snapshots, snapshot)
+	if retention := max(1, plugin.ConfigInt(p.config, "snapshot_retention", defaultSnapshotRetention)); len(p.snapshots) > retention {
+		p.snapshots = append([]*Snapshot(nil), p.snapshots[len(p.snapshots)-retention:]...)
+	}
+	p.mu.Unlock()
+
+	p.saveSnapshots()
+	p.ctx.Logger.Infof("Software snapshot %s created: %d packages", snapshot.ID, len(snapshot.Packages))
+	return snapshot, nil
+}
+
+// snapshotForJob 在作业执行前创建快照并记录到作业，快照失败时不再执行作业
+func (p *SoftwarePlugin) snapshotForJob(ctx context.Context, job *Job, reason string) error {
+	snapshot, err := p.createSnapshot(ctx, reason)
+	if err != nil {
+		return fmt.Errorf("snapshot failed: %v", err)
+	}
+	p.jobsMu.Lock()
+	job.SnapshotID = snapshot.ID
+	p.jobsMu.Unlock()
+	return nil
+}
+
+// findSnapshotLocked 按 ID 查找快照，id 为空时返回最新的快照，调用方需持有 p.mu
+func (p *SoftwarePlugin) findSnapshotLocked(id string) (*Snapshot, error) {
+	if id == "" {
+		if len(p.snapshots) == 0 {
+			return nil, fmt.Errorf("no snapshots available")
+		}
+		return p.snapshots[len(p.snapshots)-1], nil
+	}
+	for _, snapshot := range p.snapshots {
+		if snapshot.ID == id {
+			return snapshot, nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %s not found", id)
+}
+
+// rollbackDrift 计算恢复到快照需要的操作：安装快照后被卸载的软件、恢复版本不同的软件，
+// 卸载快照后新增的软件（只限快照时扫描过的来源和通过 Agent 安装的软件）
+func (p *SoftwarePlugin) rollbackDrift(snapshot *Snapshot) []Drift {
+	p.mu.RLock()
+	var drift []Drift
+	inSnapshot := make(map[string]bool, len(snapshot.Packages))
+	for _, pkg := range snapshot.Packages {
+		inSnapshot[pkg.Name] = true
+		info, exists := p.installed[pkg.Name]
+		switch {
+		case !exists || info.Status == "failed":
+			drift = append(drift, Drift{Name: pkg.Name, Action: DriftInstall, PackageType: pkg.PackageType, DesiredVersion: pkg.Version})
+		case info.Status != "installed" || info.Version == pkg.Version:
+			continue
+		default:
+			action := DriftUpgrade
+			if compareVersions(info.Version, pkg.Version) >= 0 {
+				action = DriftDowngrade
+			}
+			drift = append(drift, Drift{
+				Name:             pkg.Name,
+				Action:           action,
+				PackageType:      info.PackageType,
+				DesiredVersion:   pkg.Version,
+				InstalledVersion: info.Version,
+			})
+		}
+	}
+
+	for name, info := range p.installed {
+		if inSnapshot[name] || info.Status != "installed" {
+			continue
+		}
+		if info.Managed || containsString(snapshot.Sources, info.Source) {
+			drift = append(drift, Drift{Name: name, Action: DriftRemove, PackageType: info.PackageType, InstalledVersion: info.Version})
+		}
+	}
+	p.mu.RUnlock()
+
+	return p.pendingDrift(drift)
+}
+
+// rollback 扫描已安装软件后按快照恢复软件包集合，dryRun 时只返回需要执行的操作
+func (p *SoftwarePlugin) rollback(ctx context.Context, id string, dryRun bool) (map[string]interface{}, error) {
+	p.reconcileMu.Lock()
+	defer p.reconcileMu.Unlock()
+
+	p.mu.RLock()
+	snapshot, err := p.findSnapshotLocked(id)
+	p.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.scanners) > 0 {
+		p.refreshInventory(ctx)
+	}
+	drift := p.rollbackDrift(snapshot)
+
+	// 快照中的软件包按快照时的版本和包类型重新安装
+	manifest := &Manifest{Packages: make([]DesiredPackage, 0, len(snapshot.Packages))}
+	for _, pkg := range snapshot.Packages {
+		manifest.Packages = append(manifest.Packages, DesiredPackage{Name: pkg.Name, Version: pkg.Version, PackageType: pkg.PackageType})
+	}
+
+	actions := make([]map[string]interface{}, 0, len(drift))
+	if !dryRun {
+		p.ctx.Logger.Infof("Rolling back to software snapshot %s: %d changes", snapshot.ID, len(drift))
+		actions = p.startDriftJobs(manifest, drift)
+		p.ctx.Agent.NotifyEvent("software_rollback_started", map[string]interface{}{
+			"snapshot_id": snapshot.ID,
+			"drift":       drift,
+			"actions":     actions,
+		})
+	}
+
+	return map[string]interface{}{
+		"snapshot_id": snapshot.ID,
+		"drift":       drift,
+		"actions":     actions,
+		"dry_run":     dryRun,
+	}, nil
+}
+
+// snapshotSummary 返回不含软件包列表和导出内容的快照摘要
+func snapshotSummary(snapshot *Snapshot) map[string]interface{} {
+	exports := make([]string, 0, len(snapshot.Exports))
+	for name := range snapshot.Exports {
+		exports = append(exports, name)
+	}
+	sort.Strings(exports)
+	return map[string]interface{}{
+		"id":            snapshot.ID,
+		"reason":        snapshot.Reason,
+		"created_at":    snapshot.CreatedAt,
+		"package_count": len(snapshot.Packages),
+		"exports":       exports,
+	}
+}
+
+// handleCreateSnapshot 处理创建快照命令
+func (p *SoftwarePlugin) handleCreateSnapshot(args map[string]interface{}) (interface{}, error) {
+	reason, _ := args["reason"].(string)
+	snapshot, err := p.createSnapshot(context.Background(), reason)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotSummary(snapshot), nil
+}
+
+// handleListSnapshots 处理列出快照命令，最新的快照在前
+func (p *SoftwarePlugin) handleListSnapshots(args map[string]interface{}) (interface{}, error) {
+	p.mu.RLock()
+	snapshots := make([]map[string]interface{}, 0, len(p.snapshots))
+	for i := len(p.snapshots) - 1; i >= 0; i-- {
+		snapshots = append(snapshots, snapshotSummary(p.snapshots[i]))
+	}
+	p.mu.RUnlock()
+
+	return map[string]interface{}{
+		"snapshots": snapshots,
+		"count":     len(snapshots),
+	}, nil
+}
+
+// handleGetSnapshot 处理查询快照命令，include_exports 为 true 时返回原生导出内容
+func (p *SoftwarePlugin) handleGetSnapshot(args map[string]interface{}) (interface{}, error) {
+	id, _ := args["id"].(string)
+	includeExports, _ := args["include_exports"].(bool)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	snapshot, err := p.findSnapshotLocked(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := *snapshot
+	if !includeExports {
+		result.Exports = nil
+	}
+	return &result, nil
+}
+
+// handleDeleteSnapshot 处理删除快照命令
+func (p *SoftwarePlugin) handleDeleteSnapshot(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["id"].(string)
+	if !ok || id == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	p.mu.Lock()
+	index := -1
+	for i, snapshot := range p.snapshots {
+		if snapshot.ID == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("snapshot %s not found", id)
+	}
+	p.snapshots = append(p.snapshots[:index:index], p.snapshots[index+1:]...)
+	p.mu.Unlock()
+
+	p.saveSnapshots()
+	return map[string]interface{}{"id": id, "status": "deleted"}, nil
+}
+
+// handleRollback 处理回滚命令，未指定 id 时回滚到最新的快照
+func (p *SoftwarePlugin) handleRollback(args map[string]interface{}) (interface{}, error) {
+	id, _ := args["id"].(string)
+	dryRun, _ := args["dry_run"].(bool)
+	return p.rollback(context.Background(), id, dryRun)
+}
+
+// loadSnapshots 从数据目录加载快照
+func (p *SoftwarePlugin) loadSnapshots() error {
+	if p.snapshotsFile == "" || !p.ctx.Agent.FileExists(p.snapshotsFile) {
+		return nil
+	}
+
+	data, err := p.ctx.Agent.ReadFile(p.snapshotsFile)
+	if err != nil {
+		return err
+	}
+	var snapshots []*Snapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return fmt.Errorf("invalid software snapshots: %v", err)
+	}
+
+	p.mu.Lock()
+	p.snapshots = snapshots
+	p.mu.Unlock()
+	return nil
+}
+
+// saveSnapshots 保存快照，未配置数据目录时只保存在内存中
+func (p *SoftwarePlugin) saveSnapshots() {
+	if p.snapshotsFile == "" {
+		return
+	}
+
+	p.mu.RLock()
+	data, err := json.MarshalIndent(p.snapshots, "", "  ")
+	p.mu.RUnlock()
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to encode software snapshots: %v", err)
+		return
+	}
+
+	if err := p.ctx.Agent.WriteFile(p.snapshotsFile, data); err != nil {
+		p.ctx.Logger.Errorf("Failed to save software snapshots: %v", err)
+	}
+}
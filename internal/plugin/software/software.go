@@ -1,10 +1,13 @@
 package software
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -19,6 +22,44 @@ type SoftwarePlugin struct {
 	installed map[string]*SoftwareInfo
 	mu        sync.RWMutex
 	stopChan  chan struct{}
+
+	// 异步作业，jobSlots 限制同时运行的作业数
+	jobs     map[string]*Job
+	jobsMu   sync.Mutex
+	jobSlots chan struct{}
+
+	// 软件清单扫描和持久化
+	scanners      []inventoryScanner
+	scanMu        sync.Mutex
+	saveMu        sync.Mutex
+	inventoryFile string
+	lastScan      time.Time
+
+	// 期望状态清单和对账
+	manifest      *Manifest
+	manifestFile  string
+	reconcileMu   sync.Mutex
+	lastReconcile time.Time
+	driftCount    int
+
+	// 可用更新
+	updateScanners  []updateScanner
+	updates         map[string]*UpdateInfo
+	updateMu        sync.Mutex
+	updatesFile     string
+	lastUpdateCheck time.Time
+
+	// 系统服务管理器（systemd、launchd、Windows 服务控制管理器）
+	services *serviceManager
+
+	// 安装和更新前的软件包快照
+	snapshots         []*Snapshot
+	snapshotsFile     string
+	snapshotExporters []snapshotExporter
+
+	// 包管理器命令和安装包文件经由受限的 Agent 接口
+	commander plugin.Commander
+	files     plugin.FileSystem
 }
 
 // SoftwareInfo 软件信息
@@ -32,6 +73,8 @@ type SoftwareInfo struct {
 	Description string    `json:"description"`
 	Size        int64     `json:"size"`
 	LastUpdated time.Time `json:"last_updated"`
+	Managed     bool      `json:"managed"`          // 是否通过 Agent 安装，其余软件来自清单扫描
+	Source      string    `json:"source,omitempty"` // 扫描到该软件的扫描器，如 dpkg、registry
 }
 
 // InstallRequest 安装请求
@@ -41,6 +84,14 @@ type InstallRequest struct {
 	PackageType string            `json:"package_type"`
 	Source      string            `json:"source"`
 	Options     map[string]string `json:"options"`
+
+	// package_type 为 file 时使用：安装包的 SHA-256、格式（msi、exe、pkg、dmg、deb、rpm）和静默安装参数
+	SHA256     string   `json:"sha256,omitempty"`
+	Format     string   `json:"format,omitempty"`
+	SilentArgs []string `json:"silent_args,omitempty"`
+
+	// 安装前创建快照，可通过 rollback 恢复
+	Snapshot bool `json:"snapshot,omitempty"`
 }
 
 // UninstallRequest 卸载请求
@@ -56,6 +107,14 @@ func NewSoftwarePlugin() *SoftwarePlugin {
 		config:    make(map[string]interface{}),
 		installed: make(map[string]*SoftwareInfo),
 		stopChan:  make(chan struct{}),
+		jobs:      make(map[string]*Job),
+		scanners:  platformScanners(runtime.GOOS),
+		updates:   make(map[string]*UpdateInfo),
+
+		updateScanners: platformUpdateScanners(runtime.GOOS),
+		services:       platformServiceManager(runtime.GOOS),
+
+		snapshotExporters: platformSnapshotExporters(runtime.GOOS),
 		status: &plugin.PluginStatus{
 			Status: "stopped",
 			Metrics: map[string]interface{}{
@@ -75,11 +134,35 @@ func (p *SoftwarePlugin) Info() *plugin.PluginInfo {
 		Author:      "Assistant Agent Team",
 		License:     "MIT",
 		Homepage:    "https://github.com/assistant-agent/plugins",
-		Tags:        []string{"software", "installation", "package-management"},
+		Tags:        []string{"software", "installation", "package-management", "services"},
 		Config: map[string]string{
 			"package_manager": "auto",
 			"install_dir":     "/usr/local",
 			"backup_enabled":  "true",
+			// 同时运行的安装、卸载、更新作业数和保留的已结束作业数
+			"max_concurrent_jobs": "1",
+			"job_history":         "100",
+			// 启动时扫描已安装软件，scan_timeout 为单个包管理器的扫描超时时间
+			"scan_on_startup": "true",
+			"scan_timeout":    "5m",
+			// 按期望状态清单对账的间隔
+			"reconcile_interval": "30m",
+			// package_type 为 file 时安装包的最大字节数和下载超时时间
+			"max_download_size": "1073741824",
+			"download_timeout":  "30m",
+			// 定期检查可用更新，只读取包管理器缓存的仓库元数据
+			"update_check_enabled":  "true",
+			"update_check_interval": "1h",
+			// 单次服务查询或操作的超时时间
+			"service_timeout": "1m",
+			// 安装和更新前默认是否创建快照，以及保留的快照数
+			"snapshot_before_changes": "false",
+			"snapshot_retention":      "5",
+		},
+		// 软件清单保存在数据目录，安装包、磁盘映像挂载点和 winget 导出文件位于临时目录
+		Permissions: &plugin.PluginPermissions{
+			Exec:       true,
+			WritePaths: []string{plugin.PathDataDir, plugin.PathTempDir},
 		},
 	}
 }
@@ -88,9 +171,39 @@ func (p *SoftwarePlugin) Info() *plugin.PluginInfo {
 func (p *SoftwarePlugin) Init(ctx *plugin.PluginContext) error {
 	p.ctx = ctx
 	p.status.Status = "initialized"
+	p.jobSlots = make(chan struct{}, max(1, plugin.ConfigInt(p.config, "max_concurrent_jobs", defaultMaxConcurrentJobs)))
 
-	// 加载已安装软件列表
-	p.loadInstalledSoftware()
+	commander, err := plugin.AgentCommander(ctx.Agent)
+	if err != nil {
+		return err
+	}
+	p.commander = commander
+	files, err := plugin.AgentFS(ctx.Agent)
+	if err != nil {
+		return err
+	}
+	p.files = files
+
+	// 加载上次保存的软件清单
+	dataDir, _ := ctx.Agent.GetConfig("agent.data_dir").(string)
+	if dataDir != "" {
+		p.inventoryFile = filepath.Join(dataDir, inventoryFileName)
+		p.manifestFile = filepath.Join(dataDir, manifestFileName)
+		p.updatesFile = filepath.Join(dataDir, updatesFileName)
+		p.snapshotsFile = filepath.Join(dataDir, snapshotsFileName)
+	}
+	if err := p.loadInstalledSoftware(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load software inventory: %v", err)
+	}
+	if err := p.loadManifest(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load software manifest: %v", err)
+	}
+	if err := p.loadUpdates(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load software updates: %v", err)
+	}
+	if err := p.loadSnapshots(); err != nil {
+		p.ctx.Logger.Warnf("Failed to load software snapshots: %v", err)
+	}
 
 	p.ctx.Logger.Info("Software plugin initialized")
 	return nil
@@ -101,8 +214,28 @@ func (p *SoftwarePlugin) Start() error {
 	p.status.Status = "running"
 	p.status.StartTime = time.Now()
 
+	// 插件停止时中断扫描、对账和更新检查，修改配置后插件会被重启，每次启动使用新的停止信号
+	stop := make(chan struct{})
+	p.stopChan = stop
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
 	// 启动后台任务
-	go p.backgroundTask()
+	go p.backgroundTask(ctx)
+
+	// 有清单时启动即对账（对账前会扫描），否则只扫描已安装软件
+	p.mu.RLock()
+	manifest := p.manifest
+	p.mu.RUnlock()
+	if manifest != nil {
+		go p.reconcile(ctx, manifest, false)
+	} else if plugin.ConfigBool(p.config, "scan_on_startup", true) {
+		go p.refreshInventory(ctx)
+	}
+	go p.reconcileLoop(ctx)
 
 	p.ctx.Logger.Info("Software plugin started")
 	return nil
@@ -135,11 +268,135 @@ func (p *SoftwarePlugin) HandleCommand(command string, args map[string]interface
 		return p.handleUpdate(args)
 	case "search":
 		return p.handleSearch(args)
+	case "scan":
+		return p.handleScan(args)
+	case "set_manifest":
+		return p.handleSetManifest(args)
+	case "get_manifest":
+		return p.handleGetManifest(args)
+	case "clear_manifest":
+		return p.handleClearManifest(args)
+	case "reconcile":
+		return p.handleReconcile(args)
+	case "list_updates":
+		return p.handleListUpdates(args)
+	case "check_updates":
+		return p.handleCheckUpdates(args)
+	case "create_snapshot":
+		return p.handleCreateSnapshot(args)
+	case "list_snapshots":
+		return p.handleListSnapshots(args)
+	case "get_snapshot":
+		return p.handleGetSnapshot(args)
+	case "delete_snapshot":
+		return p.handleDeleteSnapshot(args)
+	case "rollback":
+		return p.handleRollback(args)
+	case "list_services":
+		return p.handleListServices(args)
+	case "get_service":
+		return p.handleGetService(args)
+	case "start_service":
+		return p.handleServiceAction(ServiceStart, args)
+	case "stop_service":
+		return p.handleServiceAction(ServiceStop, args)
+	case "restart_service":
+		return p.handleServiceAction(ServiceRestart, args)
+	case "enable_service":
+		return p.handleServiceAction(ServiceEnable, args)
+	case "disable_service":
+		return p.handleServiceAction(ServiceDisable, args)
+	case "get_job":
+		return p.handleGetJob(args)
+	case "list_jobs":
+		return p.handleListJobs(args)
+	case "cancel_job":
+		return p.handleCancelJob(args)
 	default:
 		return nil, plugin.ErrInvalidCommand
 	}
 }
 
+// CommandSchemas 返回命令参数声明，插件管理器据此校验参数
+func (p *SoftwarePlugin) CommandSchemas() map[string]*plugin.CommandSchema {
+	return softwareCommandSchemas
+}
+
+var (
+	packageNameArgs = map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Required: true}}
+	snapshotArg     = plugin.ArgSchema{Type: plugin.ArgBool, Description: "执行前创建快照，默认为 snapshot_before_changes 配置"}
+	serviceNameArgs = map[string]plugin.ArgSchema{"name": {Type: plugin.ArgString, Required: true, Description: "systemd 单元名（默认补充 .service）、launchd 标签或 Windows 服务名"}}
+
+	softwareCommandSchemas = map[string]*plugin.CommandSchema{
+		"install": {Args: map[string]plugin.ArgSchema{
+			"name":         {Type: plugin.ArgString, Required: true},
+			"version":      {Type: plugin.ArgString},
+			"package_type": {Type: plugin.ArgString},
+			"source":       {Type: plugin.ArgString, Description: "package_type 为 file 时为安装包的 URL 或本地路径"},
+			"sha256":       {Type: plugin.ArgString, Description: "安装包的 SHA-256，package_type 为 file 时必填"},
+			"format":       {Type: plugin.ArgString, Enum: []string{"msi", "exe", "pkg", "dmg", "deb", "rpm"}, Description: "安装包格式，默认根据扩展名推断"},
+			"silent_args":  {Type: plugin.ArgArray, Description: "追加到安装命令的静默安装参数"},
+			"snapshot":     snapshotArg,
+		}},
+		"uninstall": {Args: packageNameArgs},
+		"info":      {Args: packageNameArgs},
+		"update": {Args: map[string]plugin.ArgSchema{
+			"name":     {Type: plugin.ArgString, Required: true},
+			"snapshot": snapshotArg,
+		}},
+		"search": {Args: map[string]plugin.ArgSchema{"query": {Type: plugin.ArgString, Required: true}}},
+		"list": {Args: map[string]plugin.ArgSchema{
+			"package_type": {Type: plugin.ArgString},
+			"managed":      {Type: plugin.ArgBool, Description: "true 只列出通过 Agent 安装的软件，false 只列出扫描发现的软件"},
+		}},
+		"scan": {},
+		"set_manifest": {Args: map[string]plugin.ArgSchema{
+			"packages":          {Type: plugin.ArgArray, Required: true, Description: "期望安装的软件包，每项包含 name、version、package_type、source"},
+			"remove_extraneous": {Type: plugin.ArgBool, Default: false, Description: "卸载不在清单中的、通过 Agent 安装的软件"},
+			"dry_run":           {Type: plugin.ArgBool, Default: false, Description: "只报告偏差，不保存清单也不执行操作"},
+		}},
+		"get_manifest":   {},
+		"clear_manifest": {},
+		"reconcile":      {Args: map[string]plugin.ArgSchema{"dry_run": {Type: plugin.ArgBool, Default: false}}},
+		"list_updates": {Args: map[string]plugin.ArgSchema{
+			"security": {Type: plugin.ArgBool, Default: false, Description: "只返回安全更新"},
+			"name":     {Type: plugin.ArgString},
+		}},
+		"check_updates":   {},
+		"create_snapshot": {Args: map[string]plugin.ArgSchema{"reason": {Type: plugin.ArgString}}},
+		"list_snapshots":  {},
+		"get_snapshot": {Args: map[string]plugin.ArgSchema{
+			"id":              {Type: plugin.ArgString, Description: "默认为最新的快照"},
+			"include_exports": {Type: plugin.ArgBool, Default: false, Description: "返回包管理器原生导出内容"},
+		}},
+		"delete_snapshot": {Args: map[string]plugin.ArgSchema{"id": {Type: plugin.ArgString, Required: true}}},
+		"rollback": {Args: map[string]plugin.ArgSchema{
+			"id":      {Type: plugin.ArgString, Description: "默认为最新的快照"},
+			"dry_run": {Type: plugin.ArgBool, Default: false, Description: "只返回需要执行的操作"},
+		}},
+		"list_services": {Args: map[string]plugin.ArgSchema{
+			"state": {Type: plugin.ArgString, Enum: []string{ServiceRunning, ServiceStopped, ServiceStarting, ServiceStopping, ServiceFailed}},
+			"name":  {Type: plugin.ArgString, Description: "按子串匹配服务名称或显示名称"},
+		}},
+		"get_service":     {Args: serviceNameArgs},
+		"start_service":   {Args: serviceNameArgs},
+		"stop_service":    {Args: serviceNameArgs},
+		"restart_service": {Args: serviceNameArgs},
+		"enable_service":  {Args: serviceNameArgs},
+		"disable_service": {Args: serviceNameArgs},
+		"get_job": {Args: map[string]plugin.ArgSchema{
+			"id":   {Type: plugin.ArgString, Required: true},
+			"tail": {Type: plugin.ArgInteger, Default: 0.0, Description: "只返回最后 N 行输出，0 返回全部"},
+		}},
+		"list_jobs": {Args: map[string]plugin.ArgSchema{
+			"state":   {Type: plugin.ArgString, Enum: []string{JobPending, JobRunning, JobSucceeded, JobFailed, JobCanceled}},
+			"package": {Type: plugin.ArgString},
+			"action":  {Type: plugin.ArgString},
+		}},
+		"cancel_job": {Args: map[string]plugin.ArgSchema{"id": {Type: plugin.ArgString, Required: true}}},
+	}
+)
+
 // HandleEvent 处理事件
 func (p *SoftwarePlugin) HandleEvent(eventType string, data map[string]interface{}) error {
 	switch eventType {
@@ -167,6 +424,26 @@ func (p *SoftwarePlugin) Status() *plugin.PluginStatus {
 	}
 	p.status.Metrics["total_size"] = totalSize
 
+	active := 0
+	p.jobsMu.Lock()
+	for _, job := range p.jobs {
+		if !job.finished() {
+			active++
+		}
+	}
+	p.jobsMu.Unlock()
+	p.status.Metrics["active_jobs"] = active
+	p.status.Metrics["drift_count"] = p.driftCount
+
+	security := 0
+	for _, update := range p.updates {
+		if update.Security {
+			security++
+		}
+	}
+	p.status.Metrics["updates_available"] = len(p.updates)
+	p.status.Metrics["security_updates"] = security
+
 	return p.status
 }
 
@@ -196,48 +473,91 @@ func (p *SoftwarePlugin) handleInstall(args map[string]interface{}) (interface{}
 		return nil, fmt.Errorf("name is required")
 	}
 
-	version, _ := args["version"].(string)
-	packageType, _ := args["package_type"].(string)
-	source, _ := args["source"].(string)
+	req := &InstallRequest{Name: name}
+	req.Version, _ = args["version"].(string)
+	req.PackageType, _ = args["package_type"].(string)
+	req.Source, _ = args["source"].(string)
+	req.SHA256, _ = args["sha256"].(string)
+	req.Format, _ = args["format"].(string)
+	req.Snapshot = p.wantSnapshot(args)
+	if silentArgs, ok := args["silent_args"].([]interface{}); ok {
+		for _, arg := range silentArgs {
+			req.SilentArgs = append(req.SilentArgs, fmt.Sprint(arg))
+		}
+	}
 
-	// 检查是否已安装
-	p.mu.RLock()
-	if _, exists := p.installed[name]; exists {
-		p.mu.RUnlock()
-		return nil, fmt.Errorf("software %s is already installed", name)
+	job, err := p.startInstall(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"job_id":  job.ID,
+		"status":  "installing",
+		"message": "Installation started",
+	}, nil
+}
+
+// startInstall 创建安装作业
+func (p *SoftwarePlugin) startInstall(req *InstallRequest) (*Job, error) {
+	name := req.Name
+	if req.PackageType == PackageTypeFile {
+		if err := prepareFileInstall(req, runtime.GOOS); err != nil {
+			return nil, err
+		}
 	}
-	p.mu.RUnlock()
 
 	// 创建软件信息
 	info := &SoftwareInfo{
 		Name:        name,
-		Version:     version,
-		PackageType: packageType,
+		Version:     req.Version,
+		PackageType: req.PackageType,
 		InstallTime: time.Now(),
 		Status:      "installing",
+		Managed:     true,
 	}
 
-	// 添加到已安装列表
+	// 检查是否已安装，安装失败的软件可以重新安装
 	p.mu.Lock()
+	if existing, exists := p.installed[name]; exists && existing.Status != "failed" {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("software %s is already installed", name)
+	}
 	p.installed[name] = info
 	p.mu.Unlock()
 
 	// 执行安装
-	go func() {
-		if err := p.performInstall(info, source); err != nil {
-			p.ctx.Logger.Errorf("Failed to install %s: %v", name, err)
+	job, err := p.startJob("install", name, req.PackageType, func(ctx context.Context, job *Job) error {
+		var err error
+		if req.Snapshot {
+			err = p.snapshotForJob(ctx, job, "install "+name)
+		}
+		if err == nil {
+			err = p.performInstall(ctx, job, info, req)
+		}
+		p.mu.Lock()
+		if err != nil {
 			info.Status = "failed"
 		} else {
 			info.Status = "installed"
+		}
+		p.mu.Unlock()
+		p.saveInstalledSoftware()
+		if err != nil {
+			p.ctx.Logger.Errorf("Failed to install %s: %v", name, err)
+		} else {
 			p.ctx.Logger.Infof("Successfully installed %s", name)
 		}
-	}()
-
-	return map[string]interface{}{
-		"name":    name,
-		"status":  "installing",
-		"message": "Installation started",
-	}, nil
+		return err
+	})
+	if err != nil {
+		p.mu.Lock()
+		delete(p.installed, name)
+		p.mu.Unlock()
+		return nil, err
+	}
+	return job, nil
 }
 
 // handleUninstall 处理卸载命令
@@ -247,6 +567,21 @@ func (p *SoftwarePlugin) handleUninstall(args map[string]interface{}) (interface
 		return nil, fmt.Errorf("name is required")
 	}
 
+	job, err := p.startUninstall(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"name":    name,
+		"job_id":  job.ID,
+		"status":  "uninstalling",
+		"message": "Uninstallation started",
+	}, nil
+}
+
+// startUninstall 创建卸载作业
+func (p *SoftwarePlugin) startUninstall(name string) (*Job, error) {
 	p.mu.RLock()
 	info, exists := p.installed[name]
 	p.mu.RUnlock()
@@ -256,37 +591,42 @@ func (p *SoftwarePlugin) handleUninstall(args map[string]interface{}) (interface
 	}
 
 	// 执行卸载
-	go func() {
-		if err := p.performUninstall(info); err != nil {
+	return p.startJob("uninstall", name, info.PackageType, func(ctx context.Context, job *Job) error {
+		if err := p.performUninstall(ctx, job, info); err != nil {
 			p.ctx.Logger.Errorf("Failed to uninstall %s: %v", name, err)
-		} else {
-			p.mu.Lock()
-			delete(p.installed, name)
-			p.mu.Unlock()
-			p.ctx.Logger.Infof("Successfully uninstalled %s", name)
+			return err
 		}
-	}()
-
-	return map[string]interface{}{
-		"name":    name,
-		"status":  "uninstalling",
-		"message": "Uninstallation started",
-	}, nil
+		p.mu.Lock()
+		delete(p.installed, name)
+		p.mu.Unlock()
+		p.saveInstalledSoftware()
+		p.ctx.Logger.Infof("Successfully uninstalled %s", name)
+		return nil
+	})
 }
 
 // handleList 处理列表命令
 func (p *SoftwarePlugin) handleList(args map[string]interface{}) (interface{}, error) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	packageType, _ := args["package_type"].(string)
+	managed, hasManaged := args["managed"].(bool)
 
+	p.mu.RLock()
 	softwareList := make([]*SoftwareInfo, 0, len(p.installed))
 	for _, info := range p.installed {
+		if (packageType != "" && info.PackageType != packageType) || (hasManaged && info.Managed != managed) {
+			continue
+		}
 		softwareList = append(softwareList, info)
 	}
+	lastScan := p.lastScan
+	p.mu.RUnlock()
+
+	sort.Slice(softwareList, func(i, j int) bool { return softwareList[i].Name < softwareList[j].Name })
 
 	return map[string]interface{}{
-		"software": softwareList,
-		"count":    len(softwareList),
+		"software":   softwareList,
+		"count":      len(softwareList),
+		"scanned_at": lastScan,
 	}, nil
 }
 
@@ -322,19 +662,36 @@ func (p *SoftwarePlugin) handleUpdate(args map[string]interface{}) (interface{},
 	if !exists {
 		return nil, fmt.Errorf("software %s is not installed", name)
 	}
+	if version := p.pinnedVersion(name); version != "" {
+		return nil, fmt.Errorf("software %s is pinned to version %s by the manifest", name, version)
+	}
 
 	// 执行更新
-	go func() {
-		if err := p.performUpdate(info); err != nil {
+	snapshot := p.wantSnapshot(args)
+	job, err := p.startJob("update", name, info.PackageType, func(ctx context.Context, job *Job) error {
+		if snapshot {
+			if err := p.snapshotForJob(ctx, job, "update "+name); err != nil {
+				p.ctx.Logger.Errorf("Failed to update %s: %v", name, err)
+				return err
+			}
+		}
+		if err := p.performUpdate(ctx, job, info); err != nil {
 			p.ctx.Logger.Errorf("Failed to update %s: %v", name, err)
-		} else {
-			info.LastUpdated = time.Now()
-			p.ctx.Logger.Infof("Successfully updated %s", name)
+			return err
 		}
-	}()
+		p.mu.Lock()
+		info.LastUpdated = time.Now()
+		p.mu.Unlock()
+		p.ctx.Logger.Infof("Successfully updated %s", name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return map[string]interface{}{
 		"name":    name,
+		"job_id":  job.ID,
 		"status":  "updating",
 		"message": "Update started",
 	}, nil
@@ -366,259 +723,232 @@ func (p *SoftwarePlugin) handleSearch(args map[string]interface{}) (interface{},
 }
 
 // performInstall 执行安装
-func (p *SoftwarePlugin) performInstall(info *SoftwareInfo, source string) error {
-	// 根据操作系统和包类型选择安装方法
-	switch runtime.GOOS {
-	case "linux":
-		return p.installOnLinux(info, source)
-	case "windows":
-		return p.installOnWindows(info, source)
-	case "darwin":
-		return p.installOnMacOS(info, source)
-	default:
-		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
-	}
-}
-
-// installOnLinux Linux 安装
-func (p *SoftwarePlugin) installOnLinux(info *SoftwareInfo, source string) error {
-	var cmd *exec.Cmd
-
-	switch info.PackageType {
-	case "apt":
-		cmd = exec.Command("apt-get", "install", "-y", info.Name)
-	case "yum":
-		cmd = exec.Command("yum", "install", "-y", info.Name)
-	case "dnf":
-		cmd = exec.Command("dnf", "install", "-y", info.Name)
-	case "pacman":
-		cmd = exec.Command("pacman", "-S", "--noconfirm", info.Name)
-	default:
-		// 尝试自动检测包管理器
-		if p.hasCommand("apt-get") {
-			cmd = exec.Command("apt-get", "install", "-y", info.Name)
-		} else if p.hasCommand("yum") {
-			cmd = exec.Command("yum", "install", "-y", info.Name)
-		} else if p.hasCommand("dnf") {
-			cmd = exec.Command("dnf", "install", "-y", info.Name)
-		} else {
-			return fmt.Errorf("no supported package manager found")
+func (p *SoftwarePlugin) performInstall(ctx context.Context, job *Job, info *SoftwareInfo, req *InstallRequest) error {
+	if req.PackageType == PackageTypeFile {
+		if err := p.installFile(ctx, job, req); err != nil {
+			return fmt.Errorf("installation failed: %v", err)
 		}
+		return nil
 	}
 
-	output, err := cmd.CombinedOutput()
+	manager, err := p.resolveManager(info.PackageType)
 	if err != nil {
-		return fmt.Errorf("installation failed: %v, output: %s", err, string(output))
+		return err
 	}
-
-	// 更新软件信息
-	info.Path = p.findExecutable(info.Name)
-	info.Size = p.getFileSize(info.Path)
-
-	return nil
-}
-
-// installOnWindows Windows 安装
-func (p *SoftwarePlugin) installOnWindows(info *SoftwareInfo, source string) error {
-	var cmd *exec.Cmd
-
-	switch info.PackageType {
-	case "chocolatey":
-		cmd = exec.Command("choco", "install", info.Name, "-y")
-	case "winget":
-		cmd = exec.Command("winget", "install", info.Name)
-	case "scoop":
-		cmd = exec.Command("scoop", "install", info.Name)
-	default:
-		// 尝试自动检测包管理器
-		if p.hasCommand("choco") {
-			cmd = exec.Command("choco", "install", info.Name, "-y")
-		} else if p.hasCommand("winget") {
-			cmd = exec.Command("winget", "install", info.Name)
-		} else if p.hasCommand("scoop") {
-			cmd = exec.Command("scoop", "install", info.Name)
-		} else {
-			return fmt.Errorf("no supported package manager found")
-		}
+	argv, err := installArgs(manager, info.Name, info.Version)
+	if err != nil {
+		return err
 	}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("installation failed: %v, output: %s", err, string(output))
+	// 记录实际使用的包管理器，卸载和更新时使用
+	p.mu.Lock()
+	info.PackageType = manager
+	p.mu.Unlock()
+
+	if err := p.runJobCommand(ctx, job, argv); err != nil {
+		return fmt.Errorf("installation failed: %v", err)
 	}
 
 	// 更新软件信息
-	info.Path = p.findExecutable(info.Name)
-	info.Size = p.getFileSize(info.Path)
+	path := p.findExecutable(info.Name)
+	size := p.getFileSize(path)
+	p.mu.Lock()
+	info.Path, info.Size = path, size
+	p.mu.Unlock()
 
 	return nil
 }
 
-// installOnMacOS macOS 安装
-func (p *SoftwarePlugin) installOnMacOS(info *SoftwareInfo, source string) error {
-	var cmd *exec.Cmd
+// osManagers 各操作系统支持的包管理器，未指定包类型时按顺序检测，值为包类型和检测的命令
+var osManagers = map[string][][2]string{
+	"linux":   {{"apt", "apt-get"}, {"yum", "yum"}, {"dnf", "dnf"}, {"pacman", ""}},
+	"windows": {{"chocolatey", "choco"}, {"winget", "winget"}, {"scoop", "scoop"}},
+	"darwin":  {{"brew", "brew"}, {"port", "port"}},
+}
 
-	switch info.PackageType {
-	case "brew":
-		cmd = exec.Command("brew", "install", info.Name)
-	case "port":
-		cmd = exec.Command("port", "install", info.Name)
-	default:
-		// 尝试自动检测包管理器
-		if p.hasCommand("brew") {
-			cmd = exec.Command("brew", "install", info.Name)
-		} else if p.hasCommand("port") {
-			cmd = exec.Command("port", "install", info.Name)
-		} else {
-			return fmt.Errorf("no supported package manager found")
+// resolveManager 返回安装使用的包管理器，未指定或当前系统不支持时自动检测
+func (p *SoftwarePlugin) resolveManager(packageType string) (string, error) {
+	managers, ok := osManagers[runtime.GOOS]
+	if !ok {
+		return "", fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	for _, manager := range managers {
+		if manager[0] == packageType {
+			return packageType, nil
 		}
 	}
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("installation failed: %v, output: %s", err, string(output))
+	for _, manager := range managers {
+		if manager[1] != "" && p.hasCommand(manager[1]) {
+			return manager[0], nil
+		}
 	}
-
-	// 更新软件信息
-	info.Path = p.findExecutable(info.Name)
-	info.Size = p.getFileSize(info.Path)
-
-	return nil
+	return "", fmt.Errorf("no supported package manager found")
 }
 
-// performUninstall 执行卸载
-func (p *SoftwarePlugin) performUninstall(info *SoftwareInfo) error {
-	var cmd *exec.Cmd
+// installArgs 生成安装命令，version 不为空时安装指定版本
+func installArgs(manager, name, version string) ([]string, error) {
+	switch manager {
+	case "apt":
+		if version != "" {
+			return []string{"apt-get", "install", "-y", "--allow-downgrades", name + "=" + version}, nil
+		}
+		return []string{"apt-get", "install", "-y", name}, nil
+	case "yum", "dnf":
+		if version != "" {
+			return []string{manager, "install", "-y", name + "-" + version}, nil
+		}
+		return []string{manager, "install", "-y", name}, nil
+	case "chocolatey":
+		if version != "" {
+			return []string{"choco", "install", name, "-y", "--version", version}, nil
+		}
+		return []string{"choco", "install", name, "-y"}, nil
+	case "winget":
+		if version != "" {
+			return []string{"winget", "install", name, "--version", version}, nil
+		}
+		return []string{"winget", "install", name}, nil
+	case "scoop":
+		if version != "" {
+			return []string{"scoop", "install", name + "@" + version}, nil
+		}
+		return []string{"scoop", "install", name}, nil
+	case "pacman", "brew", "port":
+		if version != "" {
+			return nil, fmt.Errorf("installing a specific version is not supported for %s packages", manager)
+		}
+		switch manager {
+		case "pacman":
+			return []string{"pacman", "-S", "--noconfirm", name}, nil
+		default:
+			return []string{manager, "install", name}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported package type: %s", manager)
+}
 
+// uninstallCommand 生成卸载命令
+func uninstallCommand(info *SoftwareInfo) []string {
 	switch runtime.GOOS {
 	case "linux":
 		switch info.PackageType {
 		case "apt":
-			cmd = exec.Command("apt-get", "remove", "-y", info.Name)
+			return []string{"apt-get", "remove", "-y", info.Name}
 		case "yum":
-			cmd = exec.Command("yum", "remove", "-y", info.Name)
+			return []string{"yum", "remove", "-y", info.Name}
 		case "dnf":
-			cmd = exec.Command("dnf", "remove", "-y", info.Name)
+			return []string{"dnf", "remove", "-y", info.Name}
 		case "pacman":
-			cmd = exec.Command("pacman", "-R", "--noconfirm", info.Name)
+			return []string{"pacman", "-R", "--noconfirm", info.Name}
 		}
 	case "windows":
 		switch info.PackageType {
 		case "chocolatey":
-			cmd = exec.Command("choco", "uninstall", info.Name, "-y")
+			return []string{"choco", "uninstall", info.Name, "-y"}
 		case "winget":
-			cmd = exec.Command("winget", "uninstall", info.Name)
+			return []string{"winget", "uninstall", info.Name}
 		case "scoop":
-			cmd = exec.Command("scoop", "uninstall", info.Name)
+			return []string{"scoop", "uninstall", info.Name}
 		}
 	case "darwin":
 		switch info.PackageType {
 		case "brew":
-			cmd = exec.Command("brew", "uninstall", info.Name)
+			return []string{"brew", "uninstall", info.Name}
 		case "port":
-			cmd = exec.Command("port", "uninstall", info.Name)
+			return []string{"port", "uninstall", info.Name}
 		}
 	}
+	return nil
+}
 
-	if cmd == nil {
+// performUninstall 执行卸载
+func (p *SoftwarePlugin) performUninstall(ctx context.Context, job *Job, info *SoftwareInfo) error {
+	argv := uninstallCommand(info)
+	if argv == nil {
 		return fmt.Errorf("unsupported package type: %s", info.PackageType)
 	}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("uninstallation failed: %v, output: %s", err, string(output))
+	if err := p.runJobCommand(ctx, job, argv); err != nil {
+		return fmt.Errorf("uninstallation failed: %v", err)
 	}
-
 	return nil
 }
 
-// performUpdate 执行更新
-func (p *SoftwarePlugin) performUpdate(info *SoftwareInfo) error {
-	var cmd *exec.Cmd
-
+// updateCommand 生成更新命令
+func updateCommand(info *SoftwareInfo) []string {
 	switch runtime.GOOS {
 	case "linux":
 		switch info.PackageType {
 		case "apt":
-			cmd = exec.Command("apt-get", "upgrade", "-y", info.Name)
+			return []string{"apt-get", "install", "--only-upgrade", "-y", info.Name}
 		case "yum":
-			cmd = exec.Command("yum", "update", "-y", info.Name)
+			return []string{"yum", "update", "-y", info.Name}
 		case "dnf":
-			cmd = exec.Command("dnf", "update", "-y", info.Name)
+			return []string{"dnf", "update", "-y", info.Name}
 		case "pacman":
-			cmd = exec.Command("pacman", "-Syu", "--noconfirm", info.Name)
+			return []string{"pacman", "-Syu", "--noconfirm", info.Name}
 		}
 	case "windows":
 		switch info.PackageType {
 		case "chocolatey":
-			cmd = exec.Command("choco", "upgrade", info.Name, "-y")
+			return []string{"choco", "upgrade", info.Name, "-y"}
 		case "winget":
-			cmd = exec.Command("winget", "upgrade", info.Name)
+			return []string{"winget", "upgrade", info.Name}
 		case "scoop":
-			cmd = exec.Command("scoop", "update", info.Name)
+			return []string{"scoop", "update", info.Name}
 		}
 	case "darwin":
 		switch info.PackageType {
 		case "brew":
-			cmd = exec.Command("brew", "upgrade", info.Name)
+			return []string{"brew", "upgrade", info.Name}
 		case "port":
-			cmd = exec.Command("port", "upgrade", info.Name)
+			return []string{"port", "upgrade", info.Name}
 		}
 	}
+	return nil
+}
 
-	if cmd == nil {
+// performUpdate 执行更新
+func (p *SoftwarePlugin) performUpdate(ctx context.Context, job *Job, info *SoftwareInfo) error {
+	argv := updateCommand(info)
+	if argv == nil {
 		return fmt.Errorf("unsupported package type: %s", info.PackageType)
 	}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("update failed: %v, output: %s", err, string(output))
+	if err := p.runJobCommand(ctx, job, argv); err != nil {
+		return fmt.Errorf("update failed: %v", err)
 	}
-
 	return nil
 }
 
 // backgroundTask 后台任务
-func (p *SoftwarePlugin) backgroundTask() {
-	ticker := time.NewTicker(1 * time.Hour)
+func (p *SoftwarePlugin) backgroundTask(ctx context.Context) {
+	if !plugin.ConfigBool(p.config, "update_check_enabled", true) {
+		return
+	}
+
+	// 启动时检查一次，之后定期检查软件更新
+	p.checkForUpdates(ctx)
+
+	ticker := time.NewTicker(plugin.ConfigDuration(p.config, "update_check_interval", defaultUpdateCheckInterval))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			// 定期检查软件更新
-			p.checkForUpdates()
-		case <-p.stopChan:
+			p.checkForUpdates(ctx)
+		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-// checkForUpdates 检查更新
-func (p *SoftwarePlugin) checkForUpdates() {
-	p.mu.RLock()
-	softwareList := make([]*SoftwareInfo, 0, len(p.installed))
-	for _, info := range p.installed {
-		softwareList = append(softwareList, info)
-	}
-	p.mu.RUnlock()
-
-	for range softwareList {
-		// 这里应该检查每个软件的更新
-		// 暂时跳过
+// wantSnapshot 返回安装或更新前是否创建快照，参数未指定时使用 snapshot_before_changes 配置
+func (p *SoftwarePlugin) wantSnapshot(args map[string]interface{}) bool {
+	if snapshot, ok := args["snapshot"].(bool); ok {
+		return snapshot
 	}
-}
-
-// loadInstalledSoftware 加载已安装软件列表
-func (p *SoftwarePlugin) loadInstalledSoftware() {
-	// 从文件或数据库加载已安装软件列表
-	// 暂时跳过
-}
-
-// saveInstalledSoftware 保存已安装软件列表
-func (p *SoftwarePlugin) saveInstalledSoftware() {
-	// 保存到文件或数据库
-	// 暂时跳过
+	return plugin.ConfigBool(p.config, "snapshot_before_changes", false)
 }
 
 // hasCommand 检查命令是否存在
@@ -664,3 +994,13 @@ func (p *SoftwarePlugin) handlePackageUpdateAvailable(data map[string]interface{
 	p.ctx.Logger.Info("Package update available event received")
 	return nil
 }
+
+// containsString 判断字符串是否在列表中
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
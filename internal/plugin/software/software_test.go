@@ -0,0 +1,696 @@
+package software
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"assistant_agent/internal/plugin/plugintest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPlugin 创建使用模拟 Agent 初始化的软件管理插件
+func newTestPlugin(t *testing.T, agent *plugintest.Agent, config map[string]interface{}) *SoftwarePlugin {
+	p := NewSoftwarePlugin()
+	p.scanners = nil
+	p.updateScanners = nil
+	p.snapshotExporters = nil
+	return plugintest.InitPlugin(t, p, agent, config)
+}
+
+// shellJob 返回执行 shell 脚本的作业函数
+func shellJob(p *SoftwarePlugin, script string) jobFunc {
+	return func(ctx context.Context, job *Job) error {
+		return p.runJobCommand(ctx, job, []string{"sh", "-c", script})
+	}
+}
+
+// waitJob 等待作业结束并返回快照
+func waitJob(t *testing.T, p *SoftwarePlugin, job *Job) *JobView {
+	select {
+	case <-job.done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("job %s did not finish", job.ID)
+	}
+	result, err := p.HandleCommand("get_job", map[string]interface{}{"id": job.ID})
+	require.NoError(t, err)
+	return result.(*JobView)
+}
+
+func TestSoftwareJobSucceeded(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+
+	job, err := p.startJob("install", "demo", "apt", shellJob(p, "echo 'Unpacking 45%'; echo 'Setting up demo'"))
+	require.NoError(t, err)
+
+	view := waitJob(t, p, job)
+	assert.Equal(t, JobSucceeded, view.State)
+	assert.Equal(t, 100, view.Progress)
+	assert.Equal(t, 0, view.ExitCode)
+	assert.Contains(t, view.Command, "sh -c")
+	assert.Contains(t, view.Output, "Unpacking 45%")
+	assert.Contains(t, view.Output, "Setting up demo")
+
+	// tail 只返回最后几行
+	result, err := p.HandleCommand("get_job", map[string]interface{}{"id": job.ID, "tail": 1.0})
+	require.NoError(t, err)
+	assert.Equal(t, "Setting up demo", result.(*JobView).Output)
+
+	events := agent.Events("software_job_completed")
+	require.Len(t, events, 1)
+	assert.Equal(t, job.ID, events[0].Data["job_id"])
+	assert.Equal(t, "demo", events[0].Data["package"])
+}
+
+func TestSoftwareJobFailed(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+
+	job, err := p.startJob("install", "demo", "apt", shellJob(p, "echo 'E: Unable to locate package demo' >&2; exit 100"))
+	require.NoError(t, err)
+
+	view := waitJob(t, p, job)
+	assert.Equal(t, JobFailed, view.State)
+	assert.Equal(t, 100, view.ExitCode)
+	assert.NotEmpty(t, view.Error)
+	assert.Contains(t, view.Output, "Unable to locate package")
+
+	events := agent.Events("software_job_failed")
+	require.Len(t, events, 1)
+	assert.Equal(t, JobFailed, events[0].Data["state"])
+	assert.Contains(t, events[0].Data["output"], "Unable to locate package")
+}
+
+func TestSoftwareJobCancel(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+
+	running, err := p.startJob("install", "slow", "apt", shellJob(p, "exec sleep 30"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		p.jobsMu.Lock()
+		defer p.jobsMu.Unlock()
+		return running.State == JobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// 默认只有一个执行槽，第二个作业排队
+	queued, err := p.startJob("install", "queued", "apt", shellJob(p, "true"))
+	require.NoError(t, err)
+
+	result, err := p.HandleCommand("list_jobs", map[string]interface{}{"state": JobPending})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["count"])
+
+	// 取消排队中的作业
+	result, err = p.HandleCommand("cancel_job", map[string]interface{}{"id": queued.ID})
+	require.NoError(t, err)
+	assert.Equal(t, JobCanceled, result.(map[string]interface{})["state"])
+
+	// 取消运行中的作业终止进程
+	result, err = p.HandleCommand("cancel_job", map[string]interface{}{"id": running.ID})
+	require.NoError(t, err)
+	assert.Equal(t, JobCanceled, result.(map[string]interface{})["state"])
+	assert.Len(t, agent.Events("software_job_failed"), 2)
+
+	_, err = p.HandleCommand("cancel_job", map[string]interface{}{"id": running.ID})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("cancel_job", map[string]interface{}{"id": "missing"})
+	assert.Error(t, err)
+}
+
+func TestSoftwareJobDuplicateAndHistory(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"job_history": "2"})
+
+	job, err := p.startJob("install", "demo", "apt", shellJob(p, "exec sleep 30"))
+	require.NoError(t, err)
+
+	// 同一软件包已有未结束的作业
+	_, err = p.startJob("update", "demo", "apt", shellJob(p, "true"))
+	assert.Error(t, err)
+
+	_, err = p.HandleCommand("cancel_job", map[string]interface{}{"id": job.ID})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		next, err := p.startJob("update", "demo", "apt", shellJob(p, "true"))
+		require.NoError(t, err)
+		waitJob(t, p, next)
+	}
+
+	// 只保留最近 job_history 个已结束的作业
+	result, err := p.HandleCommand("list_jobs", map[string]interface{}{"package": "demo"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.(map[string]interface{})["count"])
+	_, err = p.HandleCommand("get_job", map[string]interface{}{"id": job.ID})
+	assert.Error(t, err)
+}
+
+func TestInventoryParsers(t *testing.T) {
+	dpkg := parseDpkg([]byte("bash\t5.2.15-2\t7164\tinstalled\tGNU Bourne Again SHell\n" +
+		"oldpkg\t1.0\t10\tconfig-files\tRemoved package\n"))
+	require.Len(t, dpkg, 1)
+	assert.Equal(t, "bash", dpkg[0].Name)
+	assert.Equal(t, "5.2.15-2", dpkg[0].Version)
+	assert.Equal(t, int64(7164*1024), dpkg[0].Size)
+	assert.Equal(t, "GNU Bourne Again SHell", dpkg[0].Description)
+
+	rpm := parseRpm([]byte("gpg-pubkey\tabc-123\t0\t1700000000\tgpg(Key)\n" +
+		"curl\t8.2.1-1.fc39\t796000\t1700000000\tA utility for getting files\n"))
+	require.Len(t, rpm, 1)
+	assert.Equal(t, "curl", rpm[0].Name)
+	assert.Equal(t, time.Unix(1700000000, 0), rpm[0].InstallTime)
+
+	brew := parseBrew([]byte("git 2.42.0 2.43.0\nwget 1.21.4\n"))
+	require.Len(t, brew, 2)
+	assert.Equal(t, "2.43.0", brew[0].Version)
+
+	choco := parseChoco([]byte("chocolatey|2.2.2\ngit|2.43.0\n"))
+	require.Len(t, choco, 2)
+	assert.Equal(t, "git", choco[1].Name)
+
+	winget, err := parseWingetExport([]byte(`{"Sources":[{"Packages":[{"PackageIdentifier":"Git.Git","Version":"2.43.0"}]}]}`))
+	require.NoError(t, err)
+	require.Len(t, winget, 1)
+	assert.Equal(t, "Git.Git", winget[0].Name)
+	assert.Equal(t, "winget", winget[0].PackageType)
+}
+
+// staticScanner 返回固定结果的扫描器
+func staticScanner(name string, software ...*SoftwareInfo) inventoryScanner {
+	return inventoryScanner{Name: name, Collect: func(ctx context.Context, _ *SoftwarePlugin) ([]*SoftwareInfo, error) {
+		result := make([]*SoftwareInfo, len(software))
+		for i, info := range software {
+			copied := *info
+			result[i] = &copied
+		}
+		return result, nil
+	}}
+}
+
+func TestInventoryScanAndPersist(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+
+	// 通过 Agent 安装的软件不会被扫描结果移除
+	p.installed["agent-tool"] = &SoftwareInfo{Name: "agent-tool", Status: "installed", Managed: true}
+	p.scanners = []inventoryScanner{
+		staticScanner("pacman", &SoftwareInfo{Name: "bash", Version: "5.2", PackageType: "pacman"},
+			&SoftwareInfo{Name: "vim", Version: "9.0", PackageType: "pacman"}),
+		{Name: "broken", Collect: func(ctx context.Context, _ *SoftwarePlugin) ([]*SoftwareInfo, error) {
+			return nil, assert.AnError
+		}},
+	}
+
+	result, err := p.HandleCommand("scan", nil)
+	require.NoError(t, err)
+	scan := result.(map[string]interface{})
+	assert.Equal(t, 3, scan["count"])
+	assert.Equal(t, 2, scan["added"])
+	assert.Equal(t, 2, scan["sources"].(map[string]int)["pacman"])
+	assert.Contains(t, scan["errors"], "broken")
+
+	result, err = p.HandleCommand("list", map[string]interface{}{"managed": false})
+	require.NoError(t, err)
+	list := result.(map[string]interface{})
+	assert.Equal(t, 2, list["count"])
+	assert.Equal(t, "bash", list["software"].([]*SoftwareInfo)[0].Name)
+
+	// 扫描失败时保留上次的结果
+	p.scanners = []inventoryScanner{{Name: "pacman", Collect: func(ctx context.Context, _ *SoftwarePlugin) ([]*SoftwareInfo, error) {
+		return nil, assert.AnError
+	}}}
+	result, err = p.HandleCommand("scan", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.(map[string]interface{})["removed"])
+	assert.Equal(t, 3, result.(map[string]interface{})["count"])
+
+	// 再次扫描时移除已不存在的软件
+	p.scanners = []inventoryScanner{staticScanner("pacman", &SoftwareInfo{Name: "bash", Version: "5.3", PackageType: "pacman"})}
+	result, err = p.HandleCommand("scan", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["removed"])
+
+	// 重新启动后从数据目录加载清单
+	restarted := newTestPlugin(t, agent, nil)
+	result, err = restarted.HandleCommand("info", map[string]interface{}{"name": "bash"})
+	require.NoError(t, err)
+	assert.Equal(t, "5.3", result.(*SoftwareInfo).Version)
+	_, err = restarted.HandleCommand("info", map[string]interface{}{"name": "agent-tool"})
+	assert.NoError(t, err)
+	_, err = restarted.HandleCommand("info", map[string]interface{}{"name": "vim"})
+	assert.Error(t, err)
+}
+
+func TestVersionCompare(t *testing.T) {
+	assert.True(t, versionMatches("2.43.0", "2.43.0"))
+	assert.True(t, versionMatches("1:2.3-1ubuntu1", "2.3"))
+	assert.False(t, versionMatches("2.30", "2.3"))
+
+	assert.Equal(t, -1, compareVersions("1.9.0", "1.10.0"))
+	assert.Equal(t, 1, compareVersions("2.0.1", "2.0"))
+	assert.Equal(t, 0, compareVersions("1.2.3", "1.2.3"))
+	assert.Equal(t, -1, compareVersions("1.0.0-alpha", "1.0.0-beta"))
+}
+
+func TestManifestReconcile(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+	p.installed["git"] = &SoftwareInfo{Name: "git", Version: "2.43.0", PackageType: "pacman", Status: "installed"}
+	p.installed["curl"] = &SoftwareInfo{Name: "curl", Version: "8.5.0", PackageType: "pacman", Status: "installed"}
+	p.installed["old-tool"] = &SoftwareInfo{Name: "old-tool", Version: "1.0", PackageType: "pacman", Status: "installed", Managed: true}
+	p.installed["system-lib"] = &SoftwareInfo{Name: "system-lib", Version: "1.0", PackageType: "pacman", Status: "installed"}
+
+	packages := []interface{}{
+		map[string]interface{}{"name": "git", "version": "2.40.0"},
+		map[string]interface{}{"name": "curl"},
+		map[string]interface{}{"name": "htop", "package_type": "pacman"},
+	}
+
+	// dry_run 只报告偏差，不保存清单
+	result, err := p.HandleCommand("set_manifest", map[string]interface{}{
+		"packages": packages, "remove_extraneous": true, "dry_run": true,
+	})
+	require.NoError(t, err)
+	plan := result.(map[string]interface{})
+	assert.False(t, plan["in_sync"].(bool))
+	assert.Equal(t, []Drift{
+		{Name: "git", Action: DriftDowngrade, PackageType: "pacman", DesiredVersion: "2.40.0", InstalledVersion: "2.43.0"},
+		{Name: "htop", Action: DriftInstall, PackageType: "pacman"},
+		{Name: "old-tool", Action: DriftRemove, PackageType: "pacman", InstalledVersion: "1.0"},
+	}, plan["drift"])
+	assert.Empty(t, plan["actions"])
+	require.Len(t, agent.Events("software_drift_detected"), 1)
+	_, err = p.HandleCommand("get_manifest", nil)
+	assert.Error(t, err)
+
+	// 不支持固定版本的包管理器在对账时报告错误
+	result, err = p.HandleCommand("set_manifest", map[string]interface{}{
+		"packages": packages[:1],
+	})
+	require.NoError(t, err)
+	actions := result.(map[string]interface{})["actions"].([]map[string]interface{})
+	require.Len(t, actions, 1)
+	assert.Contains(t, actions[0]["error"], "not supported")
+
+	// 固定版本的软件不能直接更新
+	_, err = p.HandleCommand("update", map[string]interface{}{"name": "git"})
+	assert.ErrorContains(t, err, "pinned")
+
+	// 重新启动后加载清单
+	restarted := newTestPlugin(t, agent, nil)
+	result, err = restarted.HandleCommand("get_manifest", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "git", result.(map[string]interface{})["manifest"].(*Manifest).Packages[0].Name)
+
+	_, err = restarted.HandleCommand("clear_manifest", nil)
+	require.NoError(t, err)
+	_, err = restarted.HandleCommand("reconcile", nil)
+	assert.Error(t, err)
+	assert.False(t, agent.FileExists(restarted.manifestFile))
+}
+
+func TestParseManifestValidation(t *testing.T) {
+	_, err := parseManifest(map[string]interface{}{"packages": []interface{}{map[string]interface{}{"version": "1.0"}}})
+	assert.Error(t, err)
+
+	_, err = parseManifest(map[string]interface{}{"packages": []interface{}{
+		map[string]interface{}{"name": "git"}, map[string]interface{}{"name": "git"},
+	}})
+	assert.Error(t, err)
+}
+
+func TestPrepareFileInstall(t *testing.T) {
+	sum := sha256.Sum256([]byte("installer"))
+	digest := hex.EncodeToString(sum[:])
+
+	req := &InstallRequest{Source: "https://example.com/downloads/tool.MSI?token=abc", SHA256: strings.ToUpper(digest)}
+	require.NoError(t, prepareFileInstall(req, "windows"))
+	assert.Equal(t, "msi", req.Format)
+	assert.Equal(t, digest, req.SHA256)
+
+	req = &InstallRequest{Source: `C:\Downloads\setup.exe`, SHA256: digest}
+	require.NoError(t, prepareFileInstall(req, "windows"))
+	assert.Equal(t, "exe", req.Format)
+
+	err := prepareFileInstall(&InstallRequest{Source: "https://example.com/tool.deb", SHA256: digest}, "darwin")
+	assert.ErrorContains(t, err, "cannot be installed")
+	err = prepareFileInstall(&InstallRequest{Source: "https://example.com/tool.deb", SHA256: "abc"}, "linux")
+	assert.ErrorContains(t, err, "sha256")
+	err = prepareFileInstall(&InstallRequest{Source: "https://example.com/tool.zip", SHA256: digest}, "linux")
+	assert.ErrorContains(t, err, "unsupported package format")
+
+	argv, err := fileInstallArgs("msi", "tool.msi", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"msiexec", "/i", "tool.msi", "/qn", "/norestart"}, argv)
+	argv, err = fileInstallArgs("exe", "setup.exe", []string{"/S"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"setup.exe", "/S"}, argv)
+}
+
+func TestDownloadArtifact(t *testing.T) {
+	content := []byte(strings.Repeat("package-data", 1024))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	agent := &plugintest.Agent{TempDir: t.TempDir()}
+	p := newTestPlugin(t, agent, nil)
+	sum := sha256.Sum256(content)
+	job := &Job{ID: "job_test"}
+
+	req := &InstallRequest{Source: server.URL + "/tool.deb", SHA256: hex.EncodeToString(sum[:])}
+	require.NoError(t, prepareFileInstall(req, "linux"))
+	file, err := p.downloadArtifact(context.Background(), job, req)
+	require.NoError(t, err)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+	assert.Equal(t, 50, job.Progress)
+
+	// 本地文件同样校验 SHA-256，校验失败时删除下载的文件
+	local := filepath.Join(t.TempDir(), "tool.deb")
+	require.NoError(t, os.WriteFile(local, []byte("tampered"), 0600))
+	req = &InstallRequest{Source: local, SHA256: hex.EncodeToString(sum[:])}
+	require.NoError(t, prepareFileInstall(req, "linux"))
+	_, err = p.downloadArtifact(context.Background(), job, req)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	entries, err := os.ReadDir(agent.TempDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// 超过最大字节数时中止下载
+	require.NoError(t, p.SetConfig(map[string]interface{}{"max_download_size": "100"}))
+	req = &InstallRequest{Source: server.URL + "/tool.deb", SHA256: hex.EncodeToString(sum[:]), Format: "deb"}
+	_, err = p.downloadArtifact(context.Background(), job, req)
+	assert.ErrorContains(t, err, "maximum size")
+}
+
+func TestUpdateParsers(t *testing.T) {
+	apt := parseAptUpgradable([]byte("Listing...\n" +
+		"openssl/stable-security 3.0.11-1~deb12u2 amd64 [upgradable from: 3.0.11-1~deb12u1]\n" +
+		"vim/stable 2:9.0.1378-2+b1 amd64 [upgradable from: 2:9.0.1378-2]\n"))
+	require.Len(t, apt, 2)
+	assert.Equal(t, "openssl", apt[0].Name)
+	assert.Equal(t, "3.0.11-1~deb12u1", apt[0].CurrentVersion)
+	assert.Equal(t, "3.0.11-1~deb12u2", apt[0].AvailableVersion)
+	assert.True(t, apt[0].Security)
+	assert.False(t, apt[1].Security)
+
+	dnf := parseCheckUpdate([]byte("\nopenssl-libs.x86_64   1:3.0.9-2.fc38   updates\n"+
+		"curl.x86_64   8.0.1-5.fc38   updates\nObsoleting Packages\nold.noarch  1.0-1  updates\n"), "dnf")
+	require.Len(t, dnf, 2)
+	assert.Equal(t, "openssl-libs", dnf[0].Name)
+	applyUpdateInfo(dnf, []byte("CVE-2023-2650 Moderate/Sec. openssl-libs-1:3.0.9-2.fc38.x86_64\n"+
+		"CVE-2023-0464 Important/Sec. openssl-libs-1:3.0.9-2.fc38.x86_64\n"))
+	assert.True(t, dnf[0].Security)
+	assert.Equal(t, "Important", dnf[0].Severity)
+	assert.Equal(t, []string{"CVE-2023-2650", "CVE-2023-0464"}, dnf[0].CVEs)
+	assert.False(t, dnf[1].Security)
+
+	pacman := parsePacmanUpdates([]byte("linux 6.6.1.arch1-1 -> 6.6.2.arch1-1\n"))
+	require.Len(t, pacman, 1)
+	assert.Equal(t, "6.6.2.arch1-1", pacman[0].AvailableVersion)
+
+	brew, err := parseBrewOutdated([]byte(`{"formulae":[{"name":"git","installed_versions":["2.42.0"],"current_version":"2.43.0"}],` +
+		`"casks":[{"name":"firefox","installed_versions":"119.0","current_version":"120.0"}]}`))
+	require.NoError(t, err)
+	require.Len(t, brew, 2)
+	assert.Equal(t, "2.42.0", brew[0].CurrentVersion)
+	assert.Equal(t, "119.0", brew[1].CurrentVersion)
+
+	choco := parseChocoOutdated([]byte("git|2.42.0|2.43.0|false\n"))
+	require.Len(t, choco, 1)
+	assert.Equal(t, "2.43.0", choco[0].AvailableVersion)
+
+	winget := parseWingetUpgrade([]byte("Name               Id                 Version      Available    Source\r\n" +
+		"-----------------------------------------------------------------------\r\n" +
+		"Git                Git.Git            2.42.0       2.43.0       winget\r\n" +
+		"Microsoft Edge     Microsoft.Edge     119.0.2151   120.0.2210   winget\r\n" +
+		"2 upgrades available.\r\n"))
+	require.Len(t, winget, 2)
+	assert.Equal(t, "Git.Git", winget[0].Name)
+	assert.Equal(t, "2.42.0", winget[0].CurrentVersion)
+	assert.Equal(t, "120.0.2210", winget[1].AvailableVersion)
+	assert.Equal(t, "winget", winget[1].Repository)
+}
+
+// staticUpdateScanner 返回固定结果的更新扫描器，err 不为空时扫描失败
+func staticUpdateScanner(name string, err error, updates ...UpdateInfo) updateScanner {
+	return updateScanner{Name: name, Collect: func(ctx context.Context, _ *SoftwarePlugin) ([]*UpdateInfo, error) {
+		if err != nil {
+			return nil, err
+		}
+		result := make([]*UpdateInfo, len(updates))
+		for i := range updates {
+			update := updates[i]
+			result[i] = &update
+		}
+		return result, nil
+	}}
+}
+
+func TestCheckForUpdates(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+	p.updateScanners = []updateScanner{
+		staticUpdateScanner("apt", nil,
+			UpdateInfo{Name: "vim", CurrentVersion: "9.0", AvailableVersion: "9.1", PackageType: "apt"},
+			UpdateInfo{Name: "openssl", CurrentVersion: "3.0.1", AvailableVersion: "3.0.2", PackageType: "apt", Security: true}),
+		staticUpdateScanner("brew", nil, UpdateInfo{Name: "git", CurrentVersion: "2.42.0", AvailableVersion: "2.43.0", PackageType: "brew"}),
+	}
+
+	result, err := p.HandleCommand("check_updates", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.(map[string]interface{})["new"])
+	events := agent.Events("package_update_available")
+	require.Len(t, events, 3)
+	assert.Equal(t, "openssl", events[1].Data["name"])
+	assert.Equal(t, true, events[1].Data["security"])
+
+	// 安全更新排在前面
+	result, err = p.HandleCommand("list_updates", nil)
+	require.NoError(t, err)
+	updates := result.(map[string]interface{})["updates"].([]*UpdateInfo)
+	require.Len(t, updates, 3)
+	assert.Equal(t, "openssl", updates[0].Name)
+	result, err = p.HandleCommand("list_updates", map[string]interface{}{"security": true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["count"])
+
+	// 已知的更新不重复发送事件，扫描失败的来源保留上次的结果
+	p.updateScanners = []updateScanner{
+		staticUpdateScanner("apt", nil,
+			UpdateInfo{Name: "vim", CurrentVersion: "9.0", AvailableVersion: "9.2", PackageType: "apt"}),
+		staticUpdateScanner("brew", assert.AnError),
+	}
+	result, err = p.HandleCommand("check_updates", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.(map[string]interface{})["count"])
+	assert.Equal(t, 1, result.(map[string]interface{})["new"])
+	assert.Contains(t, result.(map[string]interface{})["errors"], "brew")
+	assert.Len(t, agent.Events("package_update_available"), 4)
+
+	// 重新启动后加载上次检查的结果
+	restarted := newTestPlugin(t, agent, nil)
+	result, err = restarted.HandleCommand("list_updates", map[string]interface{}{"name": "vim"})
+	require.NoError(t, err)
+	assert.Equal(t, "9.2", result.(map[string]interface{})["updates"].([]*UpdateInfo)[0].AvailableVersion)
+}
+
+func TestServiceParsers(t *testing.T) {
+	units := parseSystemdUnits([]byte("cron.service loaded active running Regular background program processing daemon\n" +
+		"● nginx.service loaded failed failed A high performance web server\n" +
+		"ghost.service not-found inactive dead ghost.service\n"))
+	files := parseSystemdUnitFiles([]byte("cron.service enabled enabled\nnginx.service disabled enabled\n" +
+		"getty@.service enabled enabled\nssh.service enabled enabled\n"))
+	services := mergeSystemdUnits(units, files)
+	require.Len(t, services, 3)
+	assert.Equal(t, ServiceInfo{Name: "cron.service", Description: "Regular background program processing daemon",
+		State: ServiceRunning, Enabled: true, StartType: "enabled", Manager: "systemd"}, *services[0])
+	assert.Equal(t, ServiceFailed, services[1].State)
+	assert.False(t, services[1].Enabled)
+	assert.Equal(t, "ssh.service", services[2].Name)
+	assert.Equal(t, ServiceStopped, services[2].State)
+
+	info, err := parseSystemctlShow([]byte("Id=cron.service\nDescription=Cron\nLoadState=loaded\nActiveState=active\n"+
+		"UnitFileState=enabled\nMainPID=612\n"), "cron")
+	require.NoError(t, err)
+	assert.Equal(t, 612, info.PID)
+	assert.True(t, info.Enabled)
+	_, err = parseSystemctlShow([]byte("Id=nope.service\nLoadState=not-found\n"), "nope")
+	assert.Error(t, err)
+	assert.Equal(t, "nginx.service", systemdUnit("nginx"))
+	assert.Equal(t, "logrotate.timer", systemdUnit("logrotate.timer"))
+
+	launchd := parseLaunchctlList([]byte("PID\tStatus\tLabel\n412\t0\tcom.example.agent\n-\t78\tcom.example.broken\n-\t0\tcom.example.idle\n"))
+	require.Len(t, launchd, 3)
+	assert.Equal(t, ServiceRunning, launchd[0].State)
+	assert.Equal(t, 412, launchd[0].PID)
+	assert.Equal(t, ServiceFailed, launchd[1].State)
+	assert.Equal(t, ServiceStopped, launchd[2].State)
+	disabled := parseLaunchdDisabled([]byte("disabled services = {\n\t\"com.example.agent\" => disabled\n\t\"com.example.idle\" => enabled\n\t\"com.apple.old\" => true\n}\n"))
+	assert.Equal(t, map[string]bool{"com.example.agent": true, "com.example.idle": false, "com.apple.old": true}, disabled)
+}
+
+func TestServiceCommands(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, nil)
+
+	services := map[string]*ServiceInfo{
+		"nginx": {Name: "nginx", State: ServiceStopped, Manager: "fake"},
+		"cron":  {Name: "cron", State: ServiceRunning, Enabled: true, Manager: "fake"},
+	}
+	var calls []string
+	p.services = &serviceManager{
+		Name: "fake",
+		List: func(ctx context.Context, _ *SoftwarePlugin) ([]*ServiceInfo, error) {
+			var result []*ServiceInfo
+			for _, service := range services {
+				result = append(result, service)
+			}
+			return result, nil
+		},
+		Get: func(ctx context.Context, _ *SoftwarePlugin, name string) (*ServiceInfo, error) {
+			if service, ok := services[name]; ok {
+				return service, nil
+			}
+			return nil, fmt.Errorf("service %s not found", name)
+		},
+		Control: func(ctx context.Context, _ *SoftwarePlugin, name, action string) error {
+			service, ok := services[name]
+			if !ok {
+				return fmt.Errorf("service %s not found", name)
+			}
+			calls = append(calls, action+" "+name)
+			switch action {
+			case ServiceStart, ServiceRestart:
+				service.State = ServiceRunning
+			case ServiceStop:
+				service.State = ServiceStopped
+			case ServiceEnable, ServiceDisable:
+				service.Enabled = action == ServiceEnable
+			}
+			return nil
+		},
+	}
+
+	result, err := p.HandleCommand("list_services", map[string]interface{}{"state": ServiceRunning})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["count"])
+
+	result, err = p.HandleCommand("start_service", map[string]interface{}{"name": "nginx"})
+	require.NoError(t, err)
+	assert.Equal(t, ServiceRunning, result.(map[string]interface{})["service"].(*ServiceInfo).State)
+	_, err = p.HandleCommand("enable_service", map[string]interface{}{"name": "nginx"})
+	require.NoError(t, err)
+	assert.True(t, services["nginx"].Enabled)
+	assert.Equal(t, []string{"start nginx", "enable nginx"}, calls)
+
+	events := agent.Events("software_service_changed")
+	require.Len(t, events, 2)
+	assert.Equal(t, true, events[1].Data["enabled"])
+
+	_, err = p.HandleCommand("stop_service", map[string]interface{}{"name": "missing"})
+	assert.Error(t, err)
+	_, err = p.HandleCommand("stop_service", map[string]interface{}{"name": "--all"})
+	assert.Error(t, err)
+	assert.Len(t, calls, 2)
+}
+
+func TestSnapshotRollback(t *testing.T) {
+	agent := &plugintest.Agent{}
+	p := newTestPlugin(t, agent, map[string]interface{}{"snapshot_retention": "2"})
+	p.scanners = []inventoryScanner{staticScanner("pacman",
+		&SoftwareInfo{Name: "git", Version: "2.40.0", PackageType: "pacman"},
+		&SoftwareInfo{Name: "curl", Version: "8.5.0", PackageType: "pacman"},
+	)}
+	p.snapshotExporters = []snapshotExporter{{Name: "pacman-list", Export: func(ctx context.Context, _ *SoftwarePlugin) ([]byte, error) {
+		return []byte("git 2.40.0\ncurl 8.5.0\n"), nil
+	}}}
+
+	result, err := p.HandleCommand("create_snapshot", map[string]interface{}{"reason": "before upgrade"})
+	require.NoError(t, err)
+	summary := result.(map[string]interface{})
+	assert.Equal(t, 2, summary["package_count"])
+	assert.Equal(t, []string{"pacman-list"}, summary["exports"])
+	id := summary["id"].(string)
+
+	// 快照后升级了 git、卸载了 curl，并新增了依赖和通过 Agent 安装的软件
+	p.scanners = []inventoryScanner{staticScanner("pacman",
+		&SoftwareInfo{Name: "git", Version: "2.43.0", PackageType: "pacman"},
+		&SoftwareInfo{Name: "new-dep", Version: "1.0", PackageType: "pacman"},
+	)}
+	p.installed["tool"] = &SoftwareInfo{Name: "tool", Version: "1.0", PackageType: "pacman", Status: "installed", Managed: true}
+
+	result, err = p.HandleCommand("rollback", map[string]interface{}{"dry_run": true})
+	require.NoError(t, err)
+	plan := result.(map[string]interface{})
+	assert.Equal(t, id, plan["snapshot_id"])
+	assert.Equal(t, []Drift{
+		{Name: "curl", Action: DriftInstall, PackageType: "pacman", DesiredVersion: "8.5.0"},
+		{Name: "git", Action: DriftDowngrade, PackageType: "pacman", DesiredVersion: "2.40.0", InstalledVersion: "2.43.0"},
+		{Name: "new-dep", Action: DriftRemove, PackageType: "pacman", InstalledVersion: "1.0"},
+		{Name: "tool", Action: DriftRemove, PackageType: "pacman", InstalledVersion: "1.0"},
+	}, plan["drift"])
+	assert.Empty(t, plan["actions"])
+	assert.Empty(t, agent.Events("software_rollback_started"))
+
+	// 作业执行前创建的快照记录在作业中
+	job, err := p.startJob("update", "git", "pacman", func(ctx context.Context, job *Job) error {
+		return p.snapshotForJob(ctx, job, "update git")
+	})
+	require.NoError(t, err)
+	view := waitJob(t, p, job)
+	assert.Equal(t, JobSucceeded, view.State)
+	assert.NotEmpty(t, view.SnapshotID)
+
+	// 只保留最新的 snapshot_retention 个快照
+	_, err = p.HandleCommand("create_snapshot", nil)
+	require.NoError(t, err)
+	result, err = p.HandleCommand("list_snapshots", nil)
+	require.NoError(t, err)
+	snapshots := result.(map[string]interface{})["snapshots"].([]map[string]interface{})
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, view.SnapshotID, snapshots[1]["id"])
+	_, err = p.HandleCommand("get_snapshot", map[string]interface{}{"id": id})
+	assert.Error(t, err)
+
+	// 重新启动后加载快照
+	restarted := newTestPlugin(t, agent, nil)
+	result, err = restarted.HandleCommand("get_snapshot", map[string]interface{}{"id": view.SnapshotID, "include_exports": true})
+	require.NoError(t, err)
+	snapshot := result.(*Snapshot)
+	assert.Equal(t, "update git", snapshot.Reason)
+	assert.Contains(t, snapshot.Exports["pacman-list"], "git 2.40.0")
+	assert.Equal(t, []string{"pacman"}, snapshot.Sources)
+
+	_, err = restarted.HandleCommand("delete_snapshot", map[string]interface{}{"id": view.SnapshotID})
+	require.NoError(t, err)
+	result, err = restarted.HandleCommand("list_snapshots", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(map[string]interface{})["count"])
+}
+
+func TestSoftwarePluginRestart(t *testing.T) {
+	p := newTestPlugin(t, &plugintest.Agent{}, map[string]interface{}{"scan_on_startup": false})
+
+	// 修改配置时插件管理器会先停止再启动插件，多次重启不能重复关闭停止信号
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Start())
+		assert.NotPanics(t, func() { require.NoError(t, p.Stop()) })
+	}
+}
@@ -0,0 +1,559 @@
+package software
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"assistant_agent/internal/plugin"
+)
+
+const (
+	// updatesFileName 可用更新文件，位于 Agent 数据目录
+	updatesFileName = "software_updates.json"
+	// defaultUpdateCheckInterval 默认检查更新的间隔
+	defaultUpdateCheckInterval = time.Hour
+)
+
+// UpdateInfo 软件包的可用更新，Security、Severity 和 CVEs 只在包管理器提供时填写
+type UpdateInfo struct {
+	Name             string    `json:"name"`
+	CurrentVersion   string    `json:"current_version"`
+	AvailableVersion string    `json:"available_version"`
+	PackageType      string    `json:"package_type"`
+	Repository       string    `json:"repository,omitempty"`
+	Security         bool      `json:"security"`
+	Severity         string    `json:"severity,omitempty"`
+	CVEs             []string  `json:"cves,omitempty"`
+	Pinned           bool      `json:"pinned"` // 清单固定了版本，update 命令不会更新
+	Source           string    `json:"source"` // 检测到该更新的扫描器
+	DetectedAt       time.Time `json:"detected_at"`
+}
+
+// updateScanner 可用更新扫描器
+type updateScanner struct {
+	Name    string
+	Command string
+	Collect func(ctx context.Context, p *SoftwarePlugin) ([]*UpdateInfo, error)
+}
+
+// updatesFile 持久化的可用更新
+type updatesFile struct {
+	CheckedAt time.Time     `json:"checked_at"`
+	Updates   []*UpdateInfo `json:"updates"`
+}
+
+// runScan 通过 Agent 执行扫描命令，okCodes 中的非零退出码同样视为成功
+func (p *SoftwarePlugin) runScan(ctx context.Context, argv []string, okCodes ...int) ([]byte, error) {
+	cmd, err := p.commander.Command(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		for _, code := range okCodes {
+			if exitErr.ExitCode() == code {
+				return out, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v", argv[0], err)
+	}
+	return out, nil
+}
+
+// platformUpdateScanners 返回当前操作系统的更新扫描器
+func platformUpdateScanners(goos string) []updateScanner {
+	switch goos {
+	case "linux":
+		return []updateScanner{
+			{Name: "apt", Command: "apt", Collect: func(ctx context.Context, p *SoftwarePlugin) ([]*UpdateInfo, error) {
+				out, err := p.runScan(ctx, []string{"apt", "list", "--upgradable"})
+				if err != nil {
+					return nil, err
+				}
+				return parseAptUpgradable(out), nil
+			}},
+			{Name: "dnf", Command: "dnf", Collect: rpmUpdates("dnf")},
+			{Name: "yum", Command: "yum", Collect: rpmUpdates("yum")},
+			{Name: "pacman", Command: "pacman", Collect: func(ctx context.Context, p *SoftwarePlugin) ([]*UpdateInfo, error) {
+				// 没有可用更新时 pacman -Qu 返回 1
+				out, err := p.runScan(ctx, []string{"pacman", "-Qu"}, 1)
+				if err != nil {
+					return nil, err
+				}
+				return parsePacmanUpdates(out), nil
+			}},
+		}
+	case "darwin":
+		return []updateScanner{
+			{Name: "brew", Command: "brew", Collect: func(ctx context.Context, p *SoftwarePlugin) ([]*UpdateInfo, error) {
+				out, err := p.runScan(ctx, []string{"brew", "outdated", "--json=v2"})
+				if err != nil {
+					return nil, err
+				}
+				return parseBrewOutdated(out)
+			}},
+		}
+	case "windows":
+		return []updateScanner{
+			{Name: "chocolatey", Command: "choco", Collect: func(ctx context.Context, p *SoftwarePlugin) ([]*UpdateInfo, error) {
+				out, err := p.runScan(ctx, []string{"choco", "outdated", "--limit-output"})
+				if err != nil {
+					return nil, err
+				}
+				return parseChocoOutdated(out), nil
+			}},
+			{Name: "winget", Command: "winget", Collect: func(ctx context.Context, p *SoftwarePlugin) ([]*UpdateInfo, error) {
+				// winget upgrade 没有机器可读的输出，按表头的列位置解析
+				out, err := p.runScan(ctx, []string{"winget", "upgrade", "--accept-source-agreements", "--disable-interactivity"})
+				if err != nil {
+					return nil, err
+				}
+				return parseWingetUpgrade(out), nil
+			}},
+		}
+	}
+	return nil
+}
+
+// aptUpgradablePattern apt list --upgradable 的输出行，如 bash/stable-security 5.2.15-2+b2 amd64 [upgradable from: 5.2.15-2]
+var aptUpgradablePattern = regexp.MustCompile(`^([^/\s]+)/(\S+)\s+(\S+)\s+\S+\s+\[upgradable from:\s+([^\]]+)\]`)
+
+// parseAptUpgradable 解析 apt list --upgradable 输出，来自 security 仓库的更新标记为安全更新
+func parseAptUpgradable(out []byte) []*UpdateInfo {
+	var result []*UpdateInfo
+	for _, line := range scanLines(out) {
+		m := aptUpgradablePattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		result = append(result, &UpdateInfo{
+			Name:             m[1],
+			Repository:       m[2],
+			AvailableVersion: m[3],
+			CurrentVersion:   m[4],
+			PackageType:      "apt",
+			Security:         strings.Contains(m[2], "-security"),
+		})
+	}
+	return result
+}
+
+// rpmUpdates 通过 check-update 检测更新，并通过 updateinfo 获取 CVE 和严重程度
+func rpmUpdates(manager string) func(ctx context.Context, p *SoftwarePlugin) ([]*UpdateInfo, error) {
+	return func(ctx context.Context, p *SoftwarePlugin) ([]*UpdateInfo, error) {
+		// 有可用更新时 check-update 返回 100
+		out, err := p.runScan(ctx, []string{manager, "check-update", "-q"}, 100)
+		if err != nil {
+			return nil, err
+		}
+		updates := parseCheckUpdate(out, manager)
+
+		// 仓库不提供 updateinfo 时只返回版本信息
+		if advisories, err := p.runScan(ctx, []string{manager, "updateinfo", "list", "cves", "-q"}); err == nil {
+			applyUpdateInfo(updates, advisories)
+		}
+
+		// check-update 不输出当前版本，从软件清单中补充
+		p.mu.RLock()
+		for _, update := range updates {
+			if info, exists := p.installed[update.Name]; exists {
+				update.CurrentVersion = info.Version
+			}
+		}
+		p.mu.RUnlock()
+		return updates, nil
+	}
+}
+
+// parseCheckUpdate 解析 yum/dnf check-update 输出（名称.架构 版本 仓库），忽略 Obsoleting 部分
+func parseCheckUpdate(out []byte, manager string) []*UpdateInfo {
+	var result []*UpdateInfo
+	for _, line := range scanLines(out) {
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.Contains(fields[0], ".") {
+			continue
+		}
+		name := fields[0][:strings.LastIndex(fields[0], ".")]
+		result = append(result, &UpdateInfo{
+			Name:             name,
+			AvailableVersion: fields[1],
+			Repository:       fields[2],
+			PackageType:      manager,
+		})
+	}
+	return result
+}
+
+// applyUpdateInfo 解析 updateinfo list cves 输出（CVE 严重程度/类型 NEVRA），合并到对应软件包的更新
+func applyUpdateInfo(updates []*UpdateInfo, out []byte) {
+	byName := make(map[string]*UpdateInfo, len(updates))
+	for _, update := range updates {
+		byName[update.Name] = update
+	}
+
+	for _, line := range scanLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], "CVE-") {
+			continue
+		}
+		update, exists := byName[nevraName(fields[2])]
+		if !exists {
+			continue
+		}
+		severity, kind, _ := strings.Cut(fields[1], "/")
+		if strings.HasPrefix(kind, "Sec") {
+			update.Security = true
+		}
+		if severity != "" && severityRank(severity) > severityRank(update.Severity) {
+			update.Severity = severity
+		}
+		if !containsString(update.CVEs, fields[0]) {
+			update.CVEs = append(update.CVEs, fields[0])
+		}
+	}
+}
+
+// nevraName 从 name-[epoch:]version-release.arch 中取出名称
+func nevraName(nevra string) string {
+	name := nevra
+	for i := 0; i < 2; i++ {
+		if idx := strings.LastIndex(name, "-"); idx > 0 {
+			name = name[:idx]
+		}
+	}
+	return name
+}
+
+// severityRank 严重程度排序，未知的严重程度最低
+func severityRank(severity string) int {
+	switch strings.ToLower(severity) {
+	case "low":
+		return 1
+	case "moderate", "medium":
+		return 2
+	case "important", "high":
+		return 3
+	case "critical":
+		return 4
+	}
+	return 0
+}
+
+// parsePacmanUpdates 解析 pacman -Qu 输出（名称 当前版本 -> 新版本）
+func parsePacmanUpdates(out []byte) []*UpdateInfo {
+	var result []*UpdateInfo
+	for _, line := range scanLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] != "->" {
+			continue
+		}
+		result = append(result, &UpdateInfo{
+			Name:             fields[0],
+			CurrentVersion:   fields[1],
+			AvailableVersion: fields[3],
+			PackageType:      "pacman",
+		})
+	}
+	return result
+}
+
+// parseBrewOutdated 解析 brew outdated --json=v2 输出，包括 formula 和 cask
+func parseBrewOutdated(out []byte) ([]*UpdateInfo, error) {
+	type outdated struct {
+		Name              string      `json:"name"`
+		InstalledVersions interface{} `json:"installed_versions"` // formula 为数组，旧版本 brew 的 cask 为字符串
+		CurrentVersion    string      `json:"current_version"`
+	}
+	var report struct {
+		Formulae []outdated `json:"formulae"`
+		Casks    []outdated `json:"casks"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("invalid brew outdated output: %v", err)
+	}
+
+	var result []*UpdateInfo
+	for _, pkg := range append(report.Formulae, report.Casks...) {
+		update := &UpdateInfo{Name: pkg.Name, AvailableVersion: pkg.CurrentVersion, PackageType: "brew"}
+		switch v := pkg.InstalledVersions.(type) {
+		case string:
+			update.CurrentVersion = v
+		case []interface{}:
+			if len(v) > 0 {
+				update.CurrentVersion = fmt.Sprint(v[len(v)-1])
+			}
+		}
+		result = append(result, update)
+	}
+	return result, nil
+}
+
+// parseChocoOutdated 解析 choco outdated --limit-output 输出（名称|当前版本|可用版本|是否固定）
+func parseChocoOutdated(out []byte) []*UpdateInfo {
+	var result []*UpdateInfo
+	for _, line := range scanLines(out) {
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 || fields[0] == "" {
+			continue
+		}
+		result = append(result, &UpdateInfo{
+			Name:             fields[0],
+			CurrentVersion:   fields[1],
+			AvailableVersion: fields[2],
+			PackageType:      "chocolatey",
+		})
+	}
+	return result
+}
+
+// parseWingetUpgrade 解析 winget upgrade 的表格输出，列位置由表头确定
+func parseWingetUpgrade(out []byte) []*UpdateInfo {
+	lines := strings.Split(strings.ReplaceAll(string(out), "\r", ""), "\n")
+
+	header := -1
+	for i, line := range lines {
+		if strings.Contains(line, "Id") && strings.Contains(line, "Available") && i+1 < len(lines) &&
+			strings.HasPrefix(strings.TrimSpace(lines[i+1]), "---") {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil
+	}
+
+	// 按字符而不是字节计算列位置，名称可能包含非 ASCII 字符
+	headerRunes := []rune(lines[header])
+	column := func(name string) int {
+		idx := strings.Index(lines[header], name)
+		if idx < 0 {
+			return -1
+		}
+		return utf8.RuneCountInString(lines[header][:idx])
+	}
+	idCol, versionCol, availableCol, sourceCol := column("Id"), column("Version"), column("Available"), column("Source")
+	if idCol < 0 || versionCol < 0 || availableCol < 0 {
+		return nil
+	}
+	if sourceCol < 0 {
+		sourceCol = len(headerRunes)
+	}
+	cell := func(row []rune, start, end int) string {
+		if start >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(string(row[start:min(end, len(row))]))
+	}
+
+	var result []*UpdateInfo
+	for _, line := range lines[header+2:] {
+		row := []rune(line)
+		// 表格后是统计行，如 "3 upgrades available."
+		if len(row) < availableCol || strings.TrimSpace(line) == "" {
+			break
+		}
+		id := cell(row, idCol, versionCol)
+		if id == "" {
+			continue
+		}
+		result = append(result, &UpdateInfo{
+			Name:             id,
+			CurrentVersion:   cell(row, versionCol, availableCol),
+			AvailableVersion: cell(row, availableCol, sourceCol),
+			Repository:       cell(row, sourceCol, len(row)),
+			PackageType:      "winget",
+		})
+	}
+	return result
+}
+
+// checkForUpdates 执行可用的更新扫描器，为新发现的更新发送 package_update_available 事件
+// 扫描失败的来源保留上次的结果
+func (p *SoftwarePlugin) checkForUpdates(ctx context.Context) map[string]interface{} {
+	p.updateMu.Lock()
+	defer p.updateMu.Unlock()
+
+	now := time.Now()
+	timeout := plugin.ConfigDuration(p.config, "scan_timeout", defaultScanTimeout)
+	found := make(map[string]*UpdateInfo)
+	scanned := make(map[string]bool)
+	errs := make(map[string]string)
+
+	for _, scanner := range p.updateScanners {
+		if scanner.Command != "" && !p.hasCommand(scanner.Command) {
+			continue
+		}
+		scanCtx, cancel := context.WithTimeout(ctx, timeout)
+		updates, err := scanner.Collect(scanCtx, p)
+		cancel()
+		if err != nil {
+			p.ctx.Logger.Warnf("Software update scanner %s failed: %v", scanner.Name, err)
+			errs[scanner.Name] = err.Error()
+			continue
+		}
+		scanned[scanner.Name] = true
+		for _, update := range updates {
+			if _, exists := found[update.Name]; exists {
+				continue
+			}
+			update.Source = scanner.Name
+			update.DetectedAt = now
+			update.Pinned = p.pinnedVersion(update.Name) != ""
+			found[update.Name] = update
+		}
+	}
+
+	p.mu.Lock()
+	var added []*UpdateInfo
+	for name, update := range p.updates {
+		if _, exists := found[name]; !exists && !scanned[update.Source] {
+			found[name] = update
+		}
+	}
+	for name, update := range found {
+		previous, exists := p.updates[name]
+		if exists && previous.AvailableVersion == update.AvailableVersion {
+			update.DetectedAt = previous.DetectedAt
+			continue
+		}
+		added = append(added, update)
+	}
+	p.updates = found
+	p.lastUpdateCheck = now
+	count := len(found)
+	p.mu.Unlock()
+
+	p.saveUpdates()
+
+	sort.Slice(added, func(i, j int) bool { return added[i].Name < added[j].Name })
+	for _, update := range added {
+		p.ctx.Agent.NotifyEvent("package_update_available", map[string]interface{}{
+			"name":              update.Name,
+			"current_version":   update.CurrentVersion,
+			"available_version": update.AvailableVersion,
+			"package_type":      update.PackageType,
+			"repository":        update.Repository,
+			"security":          update.Security,
+			"severity":          update.Severity,
+			"cves":              update.CVEs,
+			"pinned":            update.Pinned,
+		})
+	}
+	if len(added) > 0 {
+		p.ctx.Logger.Infof("Software updates available: %d packages, %d new", count, len(added))
+	}
+
+	result := map[string]interface{}{
+		"count":      count,
+		"new":        len(added),
+		"checked_at": now,
+	}
+	if len(errs) > 0 {
+		result["errors"] = errs
+	}
+	return result
+}
+
+// handleCheckUpdates 处理检查更新命令
+func (p *SoftwarePlugin) handleCheckUpdates(args map[string]interface{}) (interface{}, error) {
+	return p.checkForUpdates(context.Background()), nil
+}
+
+// handleListUpdates 处理列出可用更新命令，security 为 true 时只返回安全更新
+func (p *SoftwarePlugin) handleListUpdates(args map[string]interface{}) (interface{}, error) {
+	securityOnly, _ := args["security"].(bool)
+	name, _ := args["name"].(string)
+
+	p.mu.RLock()
+	updates := make([]*UpdateInfo, 0, len(p.updates))
+	for _, update := range p.updates {
+		if (securityOnly && !update.Security) || (name != "" && update.Name != name) {
+			continue
+		}
+		updates = append(updates, update)
+	}
+	checkedAt := p.lastUpdateCheck
+	p.mu.RUnlock()
+
+	// 安全更新和严重程度高的排在前面
+	sort.Slice(updates, func(i, j int) bool {
+		a, b := updates[i], updates[j]
+		if a.Security != b.Security {
+			return a.Security
+		}
+		if ra, rb := severityRank(a.Severity), severityRank(b.Severity); ra != rb {
+			return ra > rb
+		}
+		return a.Name < b.Name
+	})
+
+	return map[string]interface{}{
+		"updates":    updates,
+		"count":      len(updates),
+		"checked_at": checkedAt,
+	}, nil
+}
+
+// loadUpdates 从数据目录加载上次检查的结果
+func (p *SoftwarePlugin) loadUpdates() error {
+	if p.updatesFile == "" || !p.ctx.Agent.FileExists(p.updatesFile) {
+		return nil
+	}
+
+	data, err := p.ctx.Agent.ReadFile(p.updatesFile)
+	if err != nil {
+		return err
+	}
+	var file updatesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid software updates: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, update := range file.Updates {
+		if update.Name != "" {
+			p.updates[update.Name] = update
+		}
+	}
+	p.lastUpdateCheck = file.CheckedAt
+	return nil
+}
+
+// saveUpdates 保存可用更新，未配置数据目录时只保存在内存中
+func (p *SoftwarePlugin) saveUpdates() {
+	if p.updatesFile == "" {
+		return
+	}
+
+	p.mu.RLock()
+	file := updatesFile{CheckedAt: p.lastUpdateCheck, Updates: make([]*UpdateInfo, 0, len(p.updates))}
+	for _, update := range p.updates {
+		file.Updates = append(file.Updates, update)
+	}
+	sort.Slice(file.Updates, func(i, j int) bool { return file.Updates[i].Name < file.Updates[j].Name })
+	data, err := json.MarshalIndent(file, "", "  ")
+	p.mu.RUnlock()
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to encode software updates: %v", err)
+		return
+	}
+
+	if err := p.ctx.Agent.WriteFile(p.updatesFile, data); err != nil {
+		p.ctx.Logger.Errorf("Failed to save software updates: %v", err)
+	}
+}
@@ -1,9 +1,18 @@
 package plugin
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
 	"time"
+
+	"assistant_agent/internal/executor"
 )
 
+// SchedulerPluginName 定时任务调度器插件的名称，其他插件按此名称查询调度器状态
+const SchedulerPluginName = "task-scheduler"
+
 // PluginInfo 插件信息
 type PluginInfo struct {
 	Name        string            `json:"name"`
@@ -14,6 +23,9 @@ type PluginInfo struct {
 	Homepage    string            `json:"homepage"`
 	Tags        []string          `json:"tags"`
 	Config      map[string]string `json:"config"`
+
+	// Permissions 插件所需权限，为空时没有任何受限的能力
+	Permissions *PluginPermissions `json:"permissions,omitempty"`
 }
 
 // PluginStatus 插件状态
@@ -30,6 +42,7 @@ type PluginStatus struct {
 type PluginContext struct {
 	Agent  AgentInterface
 	Logger Logger
+	Events EventSubscriber
 }
 
 // Logger 日志接口
@@ -48,6 +61,13 @@ type Logger interface {
 type AgentInterface interface {
 	GetSystemInfo() (map[string]interface{}, error)
 	ExecuteCommand(command string, args []string, timeout time.Duration) (string, error)
+	ExecuteScript(ref string, args []string, timeout time.Duration) (string, error)
+	// ExecuteCommandContext 和 ExecuteScriptContext 在 ctx 取消时终止命令
+	ExecuteCommandContext(ctx context.Context, command string, args []string, timeout time.Duration) (string, error)
+	ExecuteScriptContext(ctx context.Context, ref string, args []string, timeout time.Duration) (string, error)
+	// RunCommand 按插件构造的命令执行，返回完整的执行结果，命令失败时 error 为 nil；
+	// 需要执行命中高危规则的命令时由插件设置 cmd.Confirmed
+	RunCommand(ctx context.Context, cmd *executor.Command) (*executor.Result, error)
 	ReadFile(path string) ([]byte, error)
 	WriteFile(path string, data []byte) error
 	FileExists(path string) bool
@@ -56,6 +76,102 @@ type AgentInterface interface {
 	GetStatus() map[string]interface{}
 	SetStatus(key string, value interface{}) error
 	NotifyEvent(eventType string, data map[string]interface{}) error
+	CallServer(msgType string, data interface{}, timeout time.Duration) (interface{}, error)
+}
+
+// FileSystem 可选接口，AgentInterface 实现后插件可以流式读写文件，不必一次读入内存
+// 受限插件的路径同样按读写权限检查
+type FileSystem interface {
+	OpenFile(path string, flag int, perm os.FileMode) (*os.File, error)
+	Stat(path string) (os.FileInfo, error)
+	Rename(oldPath, newPath string) error
+	Remove(path string) error
+	MkdirAll(path string, perm os.FileMode) error
+}
+
+// AgentFS 返回 Agent 的文件系统接口，Agent 不支持时返回错误
+func AgentFS(agent AgentInterface) (FileSystem, error) {
+	fs, ok := agent.(FileSystem)
+	if !ok {
+		return nil, fmt.Errorf("agent does not support file system access")
+	}
+	return fs, nil
+}
+
+// Commander 可选接口，AgentInterface 实现后插件可以直接运行程序（不经过 shell 和命令历史），
+// 用于采集工具、包管理器等需要流式读取输出或按退出码判断结果的场景；受限插件需要执行权限
+type Commander interface {
+	Command(ctx context.Context, name string, args ...string) (*exec.Cmd, error)
+}
+
+// AgentCommander 返回 Agent 的程序执行接口，Agent 不支持时返回错误
+func AgentCommander(agent AgentInterface) (Commander, error) {
+	commander, ok := agent.(Commander)
+	if !ok {
+		return nil, fmt.Errorf("agent does not support running programs")
+	}
+	return commander, nil
+}
+
+// Stats 可选接口，AgentInterface 实现后插件可以发布统计数据，随 Agent 状态摘要和心跳上报。
+// 插件发布的名称会加上 "<插件名>." 前缀
+type Stats interface {
+	SetGauge(name string, value float64)
+	IncCounter(name string, delta float64)
+}
+
+// AgentStats 返回 Agent 的统计接口，Agent 不支持时返回错误
+func AgentStats(agent AgentInterface) (Stats, error) {
+	stats, ok := agent.(Stats)
+	if !ok {
+		return nil, fmt.Errorf("agent does not support statistics")
+	}
+	return stats, nil
+}
+
+// Restarter 可选接口，AgentInterface 实现后插件可以重启 Agent：
+// 先停止 Agent（插件、状态、日志），再执行 replace（如用新版本替换当前进程）
+type Restarter interface {
+	Restart(replace func() error) error
+}
+
+// AgentRestarter 返回 Agent 的重启接口，Agent 不支持时返回错误
+func AgentRestarter(agent AgentInterface) (Restarter, error) {
+	restarter, ok := agent.(Restarter)
+	if !ok {
+		return nil, fmt.Errorf("agent does not support restart")
+	}
+	return restarter, nil
+}
+
+// LocalFS 直接访问本地文件系统的 FileSystem 实现
+type LocalFS struct{}
+
+func (LocalFS) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag, perm)
+}
+
+func (LocalFS) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (LocalFS) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (LocalFS) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (LocalFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// LocalCommander 直接创建本地进程的 Commander 实现
+type LocalCommander struct{}
+
+func (LocalCommander) Command(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	return exec.CommandContext(ctx, name, args...), nil
 }
 
 // Plugin 插件接口
@@ -72,6 +188,11 @@ type Plugin interface {
 	SetConfig(config map[string]interface{}) error
 }
 
+// ConfigValidator 可选接口，插件实现后在配置更新前校验新配置
+type ConfigValidator interface {
+	ValidateConfig(config map[string]interface{}) error
+}
+
 // PluginManager 插件管理器接口
 type PluginManager interface {
 	Register(plugin Plugin) error
@@ -85,6 +206,7 @@ type PluginManager interface {
 	StartAll() error
 	StopAll() error
 	GetAllPluginStatus() map[string]*PluginStatus
+	UpdatePluginConfig(pluginName string, config map[string]interface{}, restart bool) (map[string]interface{}, error)
 	RegisterFactory(pluginType string, factory PluginFactory)
 	CreatePlugin(pluginType string, config map[string]interface{}) (Plugin, error)
 }
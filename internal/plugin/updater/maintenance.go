@@ -0,0 +1,279 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// 自动更新推迟的原因，作为 update_deferred 事件的 reason
+const (
+	deferOutsideWindow = "outside_window" // 不在维护时间段内
+	deferTasksRunning  = "tasks_running"  // 维护时间段内有正在执行的任务
+	deferWindowMissed  = "window_missed"  // 维护时间段结束时任务仍未结束
+)
+
+// autoUpdateTick 自动更新检查的间隔
+const autoUpdateTick = time.Minute
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// maintenanceWindow 允许自动安装更新的时间段，按 Agent 本地时间计算，end 早于 start 时跨越午夜
+type maintenanceWindow struct {
+	start, end int                   // 从零点开始的分钟数
+	days       map[time.Weekday]bool // 为空表示每天，跨午夜时按开始当天计算
+}
+
+// parseDays 解析星期，如 "sat" 或 "mon-fri"
+func parseDays(value string) (map[time.Weekday]bool, error) {
+	first, last, isRange := strings.Cut(strings.ToLower(value), "-")
+	from, ok := weekdays[first]
+	if !ok {
+		return nil, fmt.Errorf("invalid weekday: %s", first)
+	}
+	to := from
+	if isRange {
+		if to, ok = weekdays[last]; !ok {
+			return nil, fmt.Errorf("invalid weekday: %s", last)
+		}
+	}
+	days := map[time.Weekday]bool{}
+	for day := from; ; day = (day + 1) % 7 {
+		days[day] = true
+		if day == to {
+			return days, nil
+		}
+	}
+}
+
+// parseMaintenanceWindows 解析逗号分隔的维护时间段，每段为 "[星期] HH:MM-HH:MM"，星期为单日或范围，
+// 如 "02:00-04:00,sat-sun 10:00-14:00"，空字符串表示不限制
+func parseMaintenanceWindows(value string) ([]maintenanceWindow, error) {
+	var windows []maintenanceWindow
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		window := maintenanceWindow{}
+		clock := item
+		if days, rest, ok := strings.Cut(item, " "); ok {
+			parsed, err := parseDays(days)
+			if err != nil {
+				return nil, err
+			}
+			window.days = parsed
+			clock = rest
+		}
+		startText, endText, ok := strings.Cut(clock, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid maintenance window %q, expected [days] HH:MM-HH:MM", item)
+		}
+		var err error
+		if window.start, err = plugin.ParseClock(startText); err != nil {
+			return nil, err
+		}
+		if window.end, err = plugin.ParseClock(endText); err != nil {
+			return nil, err
+		}
+		if window.start == window.end {
+			return nil, fmt.Errorf("maintenance window %q start and end must differ", item)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// onDay 判断时间段是否在星期 day 开始
+func (w maintenanceWindow) onDay(day time.Weekday) bool {
+	return len(w.days) == 0 || w.days[day]
+}
+
+// contains 判断时间是否落在时间段内
+func (w maintenanceWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case w.start < w.end:
+		if minute < w.start || minute >= w.end {
+			return false
+		}
+	case minute >= w.start:
+		// 跨午夜时间段的前半部分
+	case minute < w.end:
+		// 跨午夜时间段的后半部分属于前一天开始的时间段
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return w.onDay(day)
+}
+
+// inMaintenanceWindow 判断时间是否落在任一时间段内，没有时间段时始终允许
+func inMaintenanceWindow(windows []maintenanceWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextMaintenanceWindow 返回 t 之后最近的时间段开始时间，没有时间段时返回零值
+func nextMaintenanceWindow(windows []maintenanceWindow, t time.Time) time.Time {
+	var next time.Time
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for _, w := range windows {
+		for offset := 0; offset <= 7; offset++ {
+			day := midnight.AddDate(0, 0, offset)
+			start := day.Add(time.Duration(w.start) * time.Minute)
+			if start.After(t) && w.onDay(day.Weekday()) {
+				if next.IsZero() || start.Before(next) {
+					next = start
+				}
+				break
+			}
+		}
+	}
+	return next
+}
+
+// agentBusy 返回 Agent 正在执行的命令数和调度器正在执行的任务数
+func (p *UpdaterPlugin) agentBusy() (commands, tasks int) {
+	status := p.ctx.Agent.GetStatus()
+	running, _ := status["running_commands"].(int)
+	queued, _ := status["queued_commands"].(int)
+	commands = max(running, queued)
+	if plugins, ok := status["plugins"].(map[string]*plugin.PluginStatus); ok {
+		if scheduler := plugins[plugin.SchedulerPluginName]; scheduler != nil {
+			tasks, _ = scheduler.Metrics["running_tasks"].(int)
+		}
+	}
+	return commands, tasks
+}
+
+// autoUpdateLoop 开启 auto_update 时定期检查是否可以自动安装发现的更新
+func (p *UpdaterPlugin) autoUpdateLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(autoUpdateTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.tryAutoUpdate(time.Now())
+		}
+	}
+}
+
+// tryAutoUpdate 在维护时间段内且没有正在执行的任务时下载并安装最近一次检查发现的更新，
+// 否则推迟并发送 update_deferred 事件（同一版本的同一原因只发送一次）
+func (p *UpdaterPlugin) tryAutoUpdate(now time.Time) {
+	if !p.configBool("auto_update", false) {
+		return
+	}
+	p.mu.RLock()
+	update := p.latest
+	attempted := p.autoAttempted
+	p.mu.RUnlock()
+	if update == nil || update.Version == attempted {
+		return
+	}
+
+	windows, err := parseMaintenanceWindows(p.configString("maintenance_windows", ""))
+	if err != nil {
+		p.ctx.Logger.Warnf("Invalid maintenance_windows, auto update disabled: %v", err)
+		return
+	}
+
+	if !inMaintenanceWindow(windows, now) {
+		reason := deferOutsideWindow
+		// 维护时间段内因任务推迟，时间段结束时仍未安装
+		if previous := p.deferredReason(update.Version); previous == deferTasksRunning || previous == deferWindowMissed {
+			reason = deferWindowMissed
+		}
+		p.deferUpdate(update, reason, nextMaintenanceWindow(windows, now), nil)
+		return
+	}
+
+	if p.configBool("require_idle", true) {
+		if commands, tasks := p.agentBusy(); commands > 0 || tasks > 0 {
+			p.deferUpdate(update, deferTasksRunning, time.Time{}, map[string]interface{}{
+				"running_commands": commands,
+				"running_tasks":    tasks,
+			})
+			return
+		}
+	}
+
+	p.ctx.Logger.Infof("Auto updating to %s", update.Version)
+	p.mu.Lock()
+	p.autoAttempted = update.Version
+	p.mu.Unlock()
+	if err := p.autoInstall(update); err != nil {
+		p.updateMetrics("failed_updates", 1)
+		p.ctx.Logger.Errorf("Auto update to %s failed: %v", update.Version, err)
+		p.ctx.Agent.NotifyEvent("update_failed", map[string]interface{}{
+			"version": update.Version,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// autoInstall 下载、安装更新并重启 Agent
+func (p *UpdaterPlugin) autoInstall(update *UpdateInfo) error {
+	path, _, err := p.downloadUpdate(update)
+	if err != nil {
+		return err
+	}
+	state, err := p.installUpdate(path, update)
+	if err != nil {
+		return err
+	}
+	p.updateMetrics("successful_updates", 1)
+	p.scheduleRestart(state.Executable, state.Version)
+	return nil
+}
+
+// deferredReason 返回版本最近一次推迟的原因
+func (p *UpdaterPlugin) deferredReason(version string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.deferred.version != version {
+		return ""
+	}
+	return p.deferred.reason
+}
+
+// deferUpdate 记录推迟原因，原因变化时发送 update_deferred 事件
+func (p *UpdaterPlugin) deferUpdate(update *UpdateInfo, reason string, next time.Time, details map[string]interface{}) {
+	p.mu.Lock()
+	changed := p.deferred.version != update.Version || p.deferred.reason != reason
+	p.deferred.version, p.deferred.reason = update.Version, reason
+	p.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	p.ctx.Logger.Infof("Auto update to %s deferred: %s", update.Version, reason)
+	event := map[string]interface{}{
+		"version": update.Version,
+		"reason":  reason,
+	}
+	if !next.IsZero() {
+		event["next_window"] = next
+	}
+	for key, value := range details {
+		event[key] = value
+	}
+	p.ctx.Agent.NotifyEvent("update_deferred", event)
+}
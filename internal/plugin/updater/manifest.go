@@ -0,0 +1,307 @@
+package updater
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const (
+	defaultCheckInterval = time.Hour
+	defaultCheckTimeout  = 30 * time.Second
+	// defaultDownloadTimeout 下载更新文件或补丁的超时，服务器无响应时不会一直阻塞
+	defaultDownloadTimeout = 30 * time.Minute
+	maxManifestSize        = 1024 * 1024
+)
+
+// updateChannels 更新渠道，按稳定程度排列，订阅某个渠道的 Agent 同时接收更稳定渠道的版本
+var updateChannels = []string{"stable", "beta", "canary"}
+
+// UpdateManifest update_url 返回的更新清单，格式为 JSON 或 TOML（Content-Type 含 toml 或 URL 以 .toml 结尾）。
+// 顶层的版本属于 stable 渠道，channels 按渠道提供版本
+type UpdateManifest struct {
+	Release
+	Channels map[string]*Release `json:"channels" toml:"channels"`
+}
+
+// Release 一个渠道的版本
+type Release struct {
+	Version     string                     `json:"version" toml:"version"`
+	ReleaseDate time.Time                  `json:"release_date" toml:"release_date"`
+	Changelog   string                     `json:"changelog" toml:"changelog"`
+	Platforms   map[string]PlatformRelease `json:"platforms" toml:"platforms"` // 键为 <os>-<arch>，如 linux-amd64
+	Rollout     *int                       `json:"rollout" toml:"rollout"`     // 灰度发布的 Agent 百分比，未设置时为 100
+}
+
+// PlatformRelease 某个平台的安装文件，url 可以是相对清单地址的路径
+type PlatformRelease struct {
+	URL       string `json:"url" toml:"url"`
+	Checksum  string `json:"checksum" toml:"checksum"` // SHA-256（十六进制）
+	Size      int64  `json:"size" toml:"size"`
+	Signature string `json:"signature" toml:"signature"` // 对版本、平台和 SHA-256 的 Ed25519 签名（base64）
+	// Patches 从旧版本升级的 bsdiff 补丁，键为旧版本
+	Patches map[string]PatchRelease `json:"patches" toml:"patches"`
+}
+
+// PatchRelease 从某个旧版本生成安装文件的 bsdiff 补丁，url 可以是相对清单地址的路径
+type PatchRelease struct {
+	URL      string `json:"url" toml:"url"`
+	Checksum string `json:"checksum" toml:"checksum"` // 补丁文件的 SHA-256（十六进制），可选
+	Size     int64  `json:"size" toml:"size"`
+}
+
+// platformKey 返回当前平台在清单中的键
+func platformKey() string {
+	return runtime.GOOS + "-" + runtime.GOARCH
+}
+
+// validChannel 判断是否为支持的更新渠道
+func validChannel(channel string) bool {
+	for _, c := range updateChannels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutBucket 把 Agent ID 和版本映射到 0-99，每个版本灰度到的 Agent 不同，同一 Agent 的结果不变
+func rolloutBucket(agentID, version string) int {
+	sum := sha256.Sum256([]byte(agentID + "/" + version))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// inRollout 判断 Agent 是否在版本的灰度范围内，未知 Agent ID 时只接收全量发布的版本
+func (r *Release) inRollout(agentID string) bool {
+	if r.Rollout == nil || *r.Rollout >= 100 {
+		return true
+	}
+	return agentID != "" && rolloutBucket(agentID, r.Version) < *r.Rollout
+}
+
+// manifestURL 在 update_url 上附加当前平台、版本和渠道，服务器可以据此只返回对应的清单
+func manifestURL(updateURL, version, channel string) (*url.URL, error) {
+	u, err := url.Parse(updateURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid update_url %q", updateURL)
+	}
+	query := u.Query()
+	query.Set("os", runtime.GOOS)
+	query.Set("arch", runtime.GOARCH)
+	query.Set("version", version)
+	query.Set("channel", channel)
+	u.RawQuery = query.Encode()
+	return u, nil
+}
+
+// parseManifest 按 Content-Type 或扩展名解析清单
+func parseManifest(data []byte, contentType, name string) (*UpdateManifest, error) {
+	manifest := &UpdateManifest{}
+	var err error
+	if strings.Contains(contentType, "toml") || strings.HasSuffix(name, ".toml") {
+		err = toml.Unmarshal(data, manifest)
+	} else {
+		err = json.Unmarshal(data, manifest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid update manifest: %v", err)
+	}
+	if manifest.Version == "" && len(manifest.Channels) == 0 {
+		return nil, fmt.Errorf("invalid update manifest: version is required")
+	}
+	for name, release := range manifest.Channels {
+		if !validChannel(name) || release == nil || release.Version == "" {
+			return nil, fmt.Errorf("invalid update manifest: invalid channel %q", name)
+		}
+	}
+	return manifest, nil
+}
+
+// channel 返回渠道的版本，顶层版本属于 stable 渠道
+func (m *UpdateManifest) channel(name string) *Release {
+	if release := m.Channels[name]; release != nil {
+		return release
+	}
+	if name == "stable" && m.Version != "" {
+		return &m.Release
+	}
+	return nil
+}
+
+// release 返回订阅的渠道及更稳定的渠道中，当前平台可用且 Agent 在灰度范围内的最新版本，没有时返回 nil。
+// current 为 Agent 当前版本，用于选择差分补丁
+func (m *UpdateManifest) release(base *url.URL, channel, agentID, current string) (*UpdateInfo, error) {
+	var best *UpdateInfo
+	for _, name := range updateChannels {
+		if release := m.channel(name); release != nil && release.inRollout(agentID) {
+			update, err := release.update(base, name, current)
+			if err != nil {
+				return nil, err
+			}
+			if update != nil && (best == nil || compareVersionStrings(update.Version, best.Version) > 0) {
+				best = update
+			}
+		}
+		if name == channel {
+			break
+		}
+	}
+	return best, nil
+}
+
+// update 返回版本中当前平台的更新，没有提供当前平台时返回 nil
+func (r *Release) update(base *url.URL, channel, current string) (*UpdateInfo, error) {
+	platform, ok := r.Platforms[platformKey()]
+	if !ok {
+		return nil, nil
+	}
+	ref, err := url.Parse(platform.URL)
+	if err != nil || platform.URL == "" {
+		return nil, fmt.Errorf("invalid update url %q for %s", platform.URL, platformKey())
+	}
+	update := &UpdateInfo{
+		Version:     r.Version,
+		URL:         base.ResolveReference(ref).String(),
+		Checksum:    strings.ToLower(platform.Checksum),
+		ReleaseDate: r.ReleaseDate,
+		Changelog:   r.Changelog,
+		Size:        platform.Size,
+		Signature:   platform.Signature,
+		Channel:     channel,
+	}
+	if patch, ok := platform.Patches[current]; ok {
+		ref, err := url.Parse(patch.URL)
+		if err != nil || patch.URL == "" {
+			return nil, fmt.Errorf("invalid patch url %q for %s", patch.URL, platformKey())
+		}
+		update.Patch = &PatchInfo{
+			From:     current,
+			URL:      base.ResolveReference(ref).String(),
+			Checksum: strings.ToLower(patch.Checksum),
+			Size:     patch.Size,
+		}
+	}
+	return update, nil
+}
+
+// fetchManifest 从 update_url 获取更新清单
+func (p *UpdaterPlugin) fetchManifest(ctx context.Context, updateURL, channel string) (*UpdateManifest, *url.URL, error) {
+	u, err := manifestURL(updateURL, p.currentVersion, channel)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/toml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("update server returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) > maxManifestSize {
+		return nil, nil, fmt.Errorf("update manifest exceeds %d bytes", maxManifestSize)
+	}
+	manifest, err := parseManifest(data, resp.Header.Get("Content-Type"), path.Base(u.Path))
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, u, nil
+}
+
+// checkLoop 每隔 check_interval 检查一次更新，check_interval 为 0 时不自动检查
+func (p *UpdaterPlugin) checkLoop(stop <-chan struct{}) {
+	interval := p.checkInterval()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, _, err := p.isUpdateAvailable(); err != nil {
+			p.ctx.Logger.Warnf("Failed to check for updates: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkInterval 返回 check_interval 配置，值为秒数或时长字符串（如 "6h"）
+func (p *UpdaterPlugin) checkInterval() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	switch v := p.config["check_interval"].(type) {
+	case int:
+		return time.Duration(v) * time.Second
+	case float64:
+		return time.Duration(v) * time.Second
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return time.Duration(n) * time.Second
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return defaultCheckInterval
+}
+
+// versionPartPattern 版本号中的数字段和字母段
+var versionPartPattern = regexp.MustCompile(`\d+|[A-Za-z]+`)
+
+// compareVersionStrings 逐段比较版本号，忽略开头的 v，数字段按数值比较，返回 -1、0 或 1
+func compareVersionStrings(a, b string) int {
+	partsA := versionPartPattern.FindAllString(strings.TrimPrefix(a, "v"), -1)
+	partsB := versionPartPattern.FindAllString(strings.TrimPrefix(b, "v"), -1)
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		x, errX := strconv.Atoi(partsA[i])
+		y, errY := strconv.Atoi(partsB[i])
+		switch {
+		case errX == nil && errY == nil:
+			if x != y {
+				return compareInts(x, y)
+			}
+		case partsA[i] != partsB[i]:
+			return strings.Compare(partsA[i], partsB[i])
+		}
+	}
+	return compareInts(len(partsA), len(partsB))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+package updater
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"assistant_agent/internal/plugin"
+)
+
+// bsdiffMagic bsdiff 4.x 补丁文件头
+const bsdiffMagic = "BSDIFF40"
+
+// maxPatchedSize 补丁生成的文件大小上限，防止损坏的补丁写满磁盘
+const maxPatchedSize = 1024 * 1024 * 1024
+
+// offtin 解析 bsdiff 的 8 字节整数（小端，最高位为符号位）
+func offtin(b []byte) int64 {
+	v := int64(binary.LittleEndian.Uint64(b) &^ (1 << 63))
+	if b[7]&0x80 != 0 {
+		v = -v
+	}
+	return v
+}
+
+// bspatch 把 bsdiff 补丁应用到 old，结果写入 out。补丁由控制块、差异块和新增块三段 bzip2 数据组成，
+// 按块流式处理，内存占用与文件大小无关。size 大于 0 时要求结果大小一致
+func bspatch(old io.ReaderAt, oldSize int64, patch io.ReaderAt, patchSize int64, out io.Writer, size int64) error {
+	header := make([]byte, 32)
+	if _, err := patch.ReadAt(header, 0); err != nil || string(header[:8]) != bsdiffMagic {
+		return fmt.Errorf("not a bsdiff patch")
+	}
+	ctrlLen, diffLen, newSize := offtin(header[8:]), offtin(header[16:]), offtin(header[24:])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || 32+ctrlLen+diffLen > patchSize {
+		return fmt.Errorf("corrupt patch header")
+	}
+	if newSize > maxPatchedSize || (size > 0 && newSize != size) {
+		return fmt.Errorf("patch produces %d bytes, expected %d", newSize, size)
+	}
+	ctrl := bzip2.NewReader(io.NewSectionReader(patch, 32, ctrlLen))
+	diff := bzip2.NewReader(io.NewSectionReader(patch, 32+ctrlLen, diffLen))
+	extra := bzip2.NewReader(io.NewSectionReader(patch, 32+ctrlLen+diffLen, patchSize-32-ctrlLen-diffLen))
+
+	buf := make([]byte, 32*1024)
+	oldBuf := make([]byte, len(buf))
+	entry := make([]byte, 24)
+	var newPos, oldPos int64
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, entry); err != nil {
+			return fmt.Errorf("corrupt patch: %v", err)
+		}
+		// 每条控制记录：从差异块读 add 字节与旧文件相加，从新增块复制 copy 字节，旧文件位置再移动 seek
+		add, copyLen, seek := offtin(entry), offtin(entry[8:]), offtin(entry[16:])
+		if add < 0 || copyLen < 0 || newPos+add+copyLen > newSize {
+			return fmt.Errorf("corrupt patch: invalid control entry")
+		}
+		for add > 0 {
+			n := int(min(add, int64(len(buf))))
+			if _, err := io.ReadFull(diff, buf[:n]); err != nil {
+				return fmt.Errorf("corrupt patch: %v", err)
+			}
+			if err := readOld(old, oldSize, oldPos, oldBuf[:n]); err != nil {
+				return err
+			}
+			for i := 0; i < n; i++ {
+				buf[i] += oldBuf[i]
+			}
+			if _, err := out.Write(buf[:n]); err != nil {
+				return err
+			}
+			add -= int64(n)
+			oldPos += int64(n)
+			newPos += int64(n)
+		}
+		if _, err := io.CopyN(out, extra, copyLen); err != nil {
+			return fmt.Errorf("corrupt patch: %v", err)
+		}
+		newPos += copyLen
+		oldPos += seek
+	}
+	return nil
+}
+
+// readOld 读取旧文件 pos 开始的 len(buf) 字节，超出文件范围的部分为 0
+func readOld(old io.ReaderAt, oldSize, pos int64, buf []byte) error {
+	for i := range buf {
+		buf[i] = 0
+	}
+	start, end := max(pos, 0), min(pos+int64(len(buf)), oldSize)
+	if start >= end {
+		return nil
+	}
+	if _, err := old.ReadAt(buf[start-pos:end-pos], start); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read current executable: %v", err)
+	}
+	return nil
+}
+
+// applyPatchFile 把补丁应用到 oldPath，通过 files 生成 target，失败时删除 target
+func applyPatchFile(files plugin.FileSystem, oldPath, patchPath, target string, size int64) error {
+	old, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	oldInfo, err := old.Stat()
+	if err != nil {
+		return err
+	}
+	patch, err := os.Open(patchPath)
+	if err != nil {
+		return err
+	}
+	defer patch.Close()
+	patchInfo, err := patch.Stat()
+	if err != nil {
+		return err
+	}
+
+	file, err := files.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	err = bspatch(old, oldInfo.Size(), patch, patchInfo.Size(), w, size)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		files.Remove(target)
+	}
+	return err
+}
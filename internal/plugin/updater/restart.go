@@ -0,0 +1,241 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"assistant_agent/internal/plugin"
+)
+
+// updateStateFileName 安装后等待确认的更新，新版本启动后据此做健康检查或回滚
+const updateStateFileName = "update_state.json"
+
+const (
+	defaultRestartDelay      = 2 * time.Second
+	defaultHealthCheckWindow = 2 * time.Minute
+	// maxUpdateStarts 新版本在健康检查通过前启动超过该次数时视为崩溃循环，直接回滚
+	maxUpdateStarts = 3
+)
+
+// updateState 已安装但尚未确认健康的更新
+type updateState struct {
+	Version         string    `json:"version"`
+	PreviousVersion string    `json:"previous_version"`
+	Executable      string    `json:"executable"`
+	Backup          string    `json:"backup"`
+	InstalledAt     time.Time `json:"installed_at"`
+	Starts          int       `json:"starts"` // 新版本的启动次数
+}
+
+// loadUpdateState 读取等待确认的更新，没有时返回 nil
+func (p *UpdaterPlugin) loadUpdateState() (*updateState, error) {
+	data, err := os.ReadFile(p.stateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &updateState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid update state: %v", err)
+	}
+	return state, nil
+}
+
+// saveUpdateState 保存等待确认的更新
+func (p *UpdaterPlugin) saveUpdateState(state *updateState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	file, err := p.files.OpenFile(p.stateFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// clearUpdateState 删除等待确认的更新
+func (p *UpdaterPlugin) clearUpdateState() {
+	if err := p.files.Remove(p.stateFile); err != nil && !os.IsNotExist(err) {
+		p.ctx.Logger.Warnf("Failed to remove update state: %v", err)
+	}
+}
+
+// resumeUpdateState 在新版本启动时检查等待确认的更新，返回需要做健康检查的更新。
+// 启动次数超过 maxUpdateStarts 时直接回滚
+func (p *UpdaterPlugin) resumeUpdateState() *updateState {
+	state, err := p.loadUpdateState()
+	if err != nil {
+		p.ctx.Logger.Warnf("Failed to load update state: %v", err)
+		return nil
+	}
+	// 版本不同表示 Agent 尚未重启到新版本
+	if state == nil || state.Version != p.currentVersion {
+		return nil
+	}
+
+	state.Starts++
+	if state.Starts > maxUpdateStarts {
+		p.rollback(state, fmt.Sprintf("version %s restarted %d times without becoming healthy", state.Version, state.Starts-1))
+		return nil
+	}
+	if err := p.saveUpdateState(state); err != nil {
+		p.ctx.Logger.Warnf("Failed to save update state: %v", err)
+	}
+	return state
+}
+
+// healthLoop 在 health_check_window 内等待 Agent 连接到服务器，成功时确认更新，超时后回滚
+func (p *UpdaterPlugin) healthLoop(state *updateState, stop <-chan struct{}) {
+	window := p.configDuration("health_check_window", defaultHealthCheckWindow)
+	deadline := time.NewTimer(window)
+	defer deadline.Stop()
+	ticker := time.NewTicker(min(window/10, 5*time.Second))
+	defer ticker.Stop()
+
+	for {
+		if p.agentHealthy() {
+			p.commitUpdate(state)
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-deadline.C:
+			p.rollback(state, fmt.Sprintf("version %s did not become healthy within %s", state.Version, window))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// agentHealthy 判断 Agent 是否已连接到服务器，WebSocket 和 gRPC 传输层都会上报 connected
+func (p *UpdaterPlugin) agentHealthy() bool {
+	connected, _ := p.ctx.Agent.GetStatus()["connected"].(bool)
+	return connected
+}
+
+// commitUpdate 确认更新成功，发送 update_completed 事件
+func (p *UpdaterPlugin) commitUpdate(state *updateState) {
+	p.mu.Lock()
+	p.pending = nil
+	p.mu.Unlock()
+	p.clearUpdateState()
+	p.ctx.Logger.Infof("Update to %s verified healthy", state.Version)
+	p.ctx.Agent.NotifyEvent("update_completed", map[string]interface{}{
+		"version":          state.Version,
+		"previous_version": state.PreviousVersion,
+	})
+}
+
+// rollback 用备份恢复旧版本并重启，发送 update_rolled_back 事件
+func (p *UpdaterPlugin) rollback(state *updateState, reason string) {
+	p.ctx.Logger.Errorf("Rolling back update: %s", reason)
+	p.mu.Lock()
+	p.pending = nil
+	p.mu.Unlock()
+	p.clearUpdateState()
+	p.updateMetrics("failed_updates", 1)
+
+	// 正在运行的可执行文件不能覆盖（Windows），先重命名再恢复备份
+	err := p.files.Rename(state.Executable, state.Executable+".failed")
+	if err == nil {
+		if err = p.files.Rename(state.Backup, state.Executable); err != nil {
+			p.files.Rename(state.Executable+".failed", state.Executable)
+		}
+	}
+	event := map[string]interface{}{
+		"version":          state.Version,
+		"previous_version": state.PreviousVersion,
+		"reason":           reason,
+	}
+	if err != nil {
+		p.ctx.Logger.Errorf("Failed to restore %s: %v", state.Backup, err)
+		event["error"] = err.Error()
+		p.ctx.Agent.NotifyEvent("update_failed", event)
+		return
+	}
+	p.ctx.Agent.NotifyEvent("update_rolled_back", event)
+	p.scheduleRestart(state.Executable, state.PreviousVersion)
+}
+
+// scheduleRestart 发送 update_restarting 事件，restart_delay 后重启 Agent
+func (p *UpdaterPlugin) scheduleRestart(exe, version string) {
+	delay := p.configDuration("restart_delay", defaultRestartDelay)
+	p.ctx.Agent.NotifyEvent("update_restarting", map[string]interface{}{
+		"version": version,
+		"delay":   delay.String(),
+	})
+	time.AfterFunc(delay, func() {
+		p.ctx.Logger.Infof("Restarting agent to run version %s", version)
+		if err := p.restart(exe); err != nil {
+			p.ctx.Logger.Errorf("Failed to restart agent: %v", err)
+		}
+	})
+}
+
+// restartAgent 按 restart_mode 重启 Agent：
+// exec 在 Unix 上原地替换进程（PID 不变），在 Windows 上启动新进程后退出；
+// service 通过服务管理器重启 service_name；none 不重启，由外部负责
+func (p *UpdaterPlugin) restartAgent(exe string) error {
+	switch mode := p.configString("restart_mode", "exec"); mode {
+	case "none":
+		return nil
+	case "service":
+		name := p.configString("service_name", "")
+		if name == "" {
+			return fmt.Errorf("service_name is required when restart_mode is service")
+		}
+		cmd, err := p.serviceRestartCommand(name)
+		if err != nil {
+			return err
+		}
+		return startDetached(cmd)
+	case "exec":
+		// 先停止 Agent（插件、状态、日志）再替换进程，重启经由 Agent 以便检查插件的执行权限
+		restarter, err := plugin.AgentRestarter(p.ctx.Agent)
+		if err != nil {
+			return err
+		}
+		return restarter.Restart(func() error { return execSelf(exe) })
+	default:
+		return fmt.Errorf("unknown restart_mode %q", mode)
+	}
+}
+
+// serviceRestartCommand 通过 Agent 创建重启服务的命令，命令不等待服务停止，避免随服务一起被终止
+func (p *UpdaterPlugin) serviceRestartCommand(name string) (*exec.Cmd, error) {
+	commander, err := plugin.AgentCommander(p.ctx.Agent)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	switch runtime.GOOS {
+	case "windows":
+		return commander.Command(ctx, "cmd", "/C", "net stop "+name+" & net start "+name)
+	case "darwin":
+		return commander.Command(ctx, "launchctl", "kickstart", "-k", "system/"+name)
+	default:
+		return commander.Command(ctx, "systemctl", "--no-block", "restart", name)
+	}
+}
+
+// updateStatePath 返回保存更新状态的路径，未配置数据目录时保存在下载目录
+func updateStatePath(dataDir, downloadDir string) string {
+	if dataDir == "" {
+		dataDir = downloadDir
+	}
+	return filepath.Join(dataDir, updateStateFileName)
+}
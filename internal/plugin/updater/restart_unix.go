@@ -0,0 +1,23 @@
+//go:build !windows
+
+package updater
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// execSelf 用新的可执行文件替换当前进程，保留参数、环境变量和 PID，服务管理器不会认为进程退出
+func execSelf(exe string) error {
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
+
+// startDetached 在新的会话中启动命令，不等待结束
+func startDetached(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package updater
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const (
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+)
+
+// execSelf Windows 不能原地替换进程，启动新版本后退出当前进程
+func execSelf(exe string) error {
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = os.Environ()
+	if err := startDetached(cmd); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
+
+// startDetached 在独立的进程组中启动命令，不等待结束
+func startDetached(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: createNewProcessGroup | detachedProcess}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,12 +16,23 @@ import (
 
 // UpdateInfo 更新信息
 type UpdateInfo struct {
-	Version     string    `json:"version"`
-	URL         string    `json:"url"`
-	Checksum    string    `json:"checksum"`
-	ReleaseDate time.Time `json:"release_date"`
-	Changelog   string    `json:"changelog"`
-	Size        int64     `json:"size"`
+	Version     string     `json:"version"`
+	URL         string     `json:"url"`
+	Checksum    string     `json:"checksum"`
+	ReleaseDate time.Time  `json:"release_date"`
+	Changelog   string     `json:"changelog"`
+	Size        int64      `json:"size"`
+	Signature   string     `json:"signature,omitempty"` // 对版本、平台和 SHA-256 的 Ed25519 签名（base64）
+	Channel     string     `json:"channel,omitempty"`   // 版本所在的渠道
+	Patch       *PatchInfo `json:"patch,omitempty"`     // 从当前版本升级的差分补丁
+}
+
+// PatchInfo 差分更新的补丁
+type PatchInfo struct {
+	From     string `json:"from"` // 补丁适用的旧版本
+	URL      string `json:"url"`
+	Checksum string `json:"checksum,omitempty"`
+	Size     int64  `json:"size"`
 }
 
 // UpdaterPlugin 自动更新插件
@@ -29,10 +41,21 @@ type UpdaterPlugin struct {
 	config         map[string]interface{}
 	status         *plugin.PluginStatus
 	currentVersion string
-	updateURL      string
 	downloadDir    string
 	mu             sync.RWMutex
 	stopChan       chan struct{}
+	latest         *UpdateInfo // 最近一次检查发现的更新
+	lastCheck      time.Time
+	notified       string                           // 已发送 update_available 事件的版本
+	downloads      map[string]*UpdateInfo           // 已下载并校验的更新文件
+	executable     func() (string, error)           // 返回当前可执行文件路径
+	restart        func(exe string) error           // 重启 Agent 运行 exe
+	stateFile      string                           // 等待确认的更新
+	pending        *updateState                     // 新版本启动后等待健康检查的更新
+	autoAttempted  string                           // 已尝试自动安装的版本，失败后不再重试
+	deferred       struct{ version, reason string } // 最近一次推迟自动更新的版本和原因
+
+	files plugin.FileSystem // 下载、安装和回滚经由受限的 Agent 文件接口
 }
 
 // UpdateRequest 更新请求
@@ -43,19 +66,26 @@ type UpdateRequest struct {
 
 // NewUpdaterPlugin 创建自动更新插件
 func NewUpdaterPlugin() *UpdaterPlugin {
-	return &UpdaterPlugin{
-		config:   make(map[string]interface{}),
-		stopChan: make(chan struct{}),
+	p := &UpdaterPlugin{
+		config:     make(map[string]interface{}),
+		stopChan:   make(chan struct{}),
+		downloads:  make(map[string]*UpdateInfo),
+		executable: os.Executable,
 		status: &plugin.PluginStatus{
 			Status: "stopped",
 			Metrics: map[string]interface{}{
 				"total_checks":       0,
+				"failed_checks":      0,
 				"available_updates":  0,
 				"successful_updates": 0,
 				"failed_updates":     0,
+				"patched_downloads":  0,
+				"patch_failures":     0,
 			},
 		},
 	}
+	p.restart = p.restartAgent
+	return p
 }
 
 // Info 返回插件信息
@@ -69,10 +99,36 @@ func (p *UpdaterPlugin) Info() *plugin.PluginInfo {
 		Homepage:    "https://github.com/assistant-agent/plugins",
 		Tags:        []string{"updater", "update", "version"},
 		Config: map[string]string{
-			"update_url":     "https://api.example.com/updates",
+			// update_url 返回 JSON 或 TOML 格式的更新清单，为空时不检查更新；
+			// check_interval 为自动检查的间隔（秒或时长字符串，0 不自动检查）
+			"update_url":     "",
 			"check_interval": "3600",
 			"auto_update":    "false",
-			"download_dir":   "./downloads",
+			// 下载目录相对于数据目录，不能是绝对路径或数据目录以外的路径
+			"download_dir": "downloads",
+			// 更新文件的 SHA-256 和签名在下载后和安装前校验，签名公钥在构建时嵌入；
+			// allow_unsigned 允许没有嵌入公钥的开发版本跳过签名校验
+			"allow_unsigned": "false",
+			// 订阅的更新渠道：stable、beta 或 canary，同时接收更稳定渠道的版本
+			"channel": "stable",
+			// 清单提供从当前版本升级的补丁时先下载补丁生成新版本，失败时下载完整文件
+			"patch_updates": "true",
+			// 安装后 restart_delay 重启 Agent（restart_mode：exec、service 或 none），新版本在
+			// health_check_window 内没有连接到服务器时恢复 .backup 并重启回旧版本
+			"restart_mode":        "exec",
+			"service_name":        "",
+			"restart_delay":       "2s",
+			"health_check_window": "2m",
+			// auto_update 开启时在 maintenance_windows（如 "02:00-04:00,sat-sun 10:00-14:00"，为空表示任意时间）
+			// 内自动安装发现的更新；require_idle 要求没有正在执行的命令和计划任务，否则推迟并发送 update_deferred 事件
+			"maintenance_windows": "",
+			"require_idle":        "true",
+		},
+		// 数据目录（包括其中的下载目录）保存更新文件和状态，安装时替换 Agent 可执行文件，
+		// 重启时执行新版本或服务管理命令。写权限不随服务器可以下发的 download_dir 变化
+		Permissions: &plugin.PluginPermissions{
+			Exec:       true,
+			WritePaths: []string{plugin.PathDataDir, plugin.PathExecDir},
 		},
 	}
 }
@@ -88,13 +144,24 @@ func (p *UpdaterPlugin) Init(ctx *plugin.PluginContext) error {
 	// 获取当前版本
 	p.currentVersion = p.getCurrentVersion()
 
+	files, err := plugin.AgentFS(ctx.Agent)
+	if err != nil {
+		return err
+	}
+	p.files = files
+
 	// 创建下载目录
-	downloadDir := p.getDownloadDir()
-	if err := os.MkdirAll(downloadDir, 0755); err != nil {
+	dataDir, _ := ctx.Agent.GetConfig("agent.data_dir").(string)
+	downloadDir := p.getDownloadDir(dataDir)
+	if err := p.files.MkdirAll(downloadDir, 0755); err != nil {
 		return fmt.Errorf("failed to create download directory: %v", err)
 	}
 	p.downloadDir = downloadDir
 
+	// 刚更新到新版本时启动后做健康检查
+	p.stateFile = updateStatePath(dataDir, downloadDir)
+	p.pending = p.resumeUpdateState()
+
 	p.ctx.Logger.Info("Updater plugin initialized")
 	return nil
 }
@@ -112,6 +179,14 @@ func (p *UpdaterPlugin) Start() error {
 	p.status.StartTime = time.Now()
 	p.status.LastUpdated = time.Now()
 
+	// 每次启动使用新的停止信号
+	p.stopChan = make(chan struct{})
+	go p.checkLoop(p.stopChan)
+	go p.autoUpdateLoop(p.stopChan)
+	if p.pending != nil {
+		go p.healthLoop(p.pending, p.stopChan)
+	}
+
 	p.ctx.Logger.Info("Updater plugin started")
 	return nil
 }
@@ -155,6 +230,19 @@ func (p *UpdaterPlugin) HandleCommand(command string, args map[string]interface{
 	}
 }
 
+// CommandSchemas 返回命令参数声明，插件管理器据此校验参数
+func (p *UpdaterPlugin) CommandSchemas() map[string]*plugin.CommandSchema {
+	return updaterCommandSchemas
+}
+
+var updaterCommandSchemas = map[string]*plugin.CommandSchema{
+	"download_update": {Args: map[string]plugin.ArgSchema{"update": {Type: plugin.ArgAny, Description: "check_update 返回的更新信息，默认使用最近一次检查发现的更新"}}},
+	"install_update": {Args: map[string]plugin.ArgSchema{
+		"filepath": {Type: plugin.ArgString, Required: true},
+		"restart":  {Type: plugin.ArgBool, Default: true, Description: "安装后重启 Agent 并做健康检查"},
+	}},
+}
+
 // HandleEvent 处理事件
 func (p *UpdaterPlugin) HandleEvent(eventType string, data map[string]interface{}) error {
 	p.ctx.Logger.Debugf("Handling event: %s", eventType)
@@ -187,6 +275,25 @@ func (p *UpdaterPlugin) Health() error {
 	return fmt.Errorf("plugin is not running")
 }
 
+// ValidateConfig 校验更新渠道配置
+func (p *UpdaterPlugin) ValidateConfig(config map[string]interface{}) error {
+	// 下载目录只能位于数据目录下，服务器下发的配置不能把写入位置指向其他目录
+	if dir, ok := config["download_dir"].(string); ok && dir != "" {
+		if filepath.IsAbs(dir) || !filepath.IsLocal(dir) {
+			return fmt.Errorf("download_dir must be a relative path inside the data directory: %s", dir)
+		}
+	}
+	if channel, ok := config["channel"].(string); ok && !validChannel(channel) {
+		return fmt.Errorf("invalid channel %q, expected stable, beta or canary", channel)
+	}
+	if windows, ok := config["maintenance_windows"].(string); ok {
+		if _, err := parseMaintenanceWindows(windows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetConfig 获取配置
 func (p *UpdaterPlugin) GetConfig() map[string]interface{} {
 	p.mu.RLock()
@@ -213,14 +320,10 @@ func (p *UpdaterPlugin) handleCheckUpdate(args map[string]interface{}) (interfac
 
 	available, updateInfo, err := p.isUpdateAvailable()
 	if err != nil {
-		p.updateMetrics("failed_checks", 1)
 		return nil, fmt.Errorf("failed to check update: %v", err)
 	}
 
-	p.updateMetrics("total_checks", 1)
-
 	if available && updateInfo != nil {
-		p.updateMetrics("available_updates", 1)
 		return map[string]interface{}{
 			"available": true,
 			"update":    updateInfo,
@@ -235,14 +338,14 @@ func (p *UpdaterPlugin) handleCheckUpdate(args map[string]interface{}) (interfac
 
 // handleDownloadUpdate 处理下载更新命令
 func (p *UpdaterPlugin) handleDownloadUpdate(args map[string]interface{}) (interface{}, error) {
-	updateInfo, ok := args["update"].(*UpdateInfo)
-	if !ok {
-		return nil, fmt.Errorf("invalid update info")
+	updateInfo, err := p.updateArg(args)
+	if err != nil {
+		return nil, err
 	}
 
 	p.ctx.Logger.Infof("Downloading update version %s", updateInfo.Version)
 
-	filepath, err := p.downloadUpdate(updateInfo)
+	filepath, patched, err := p.downloadUpdate(updateInfo)
 	if err != nil {
 		return nil, fmt.Errorf("failed to download update: %v", err)
 	}
@@ -250,6 +353,7 @@ func (p *UpdaterPlugin) handleDownloadUpdate(args map[string]interface{}) (inter
 	return map[string]interface{}{
 		"filepath": filepath,
 		"size":     updateInfo.Size,
+		"patched":  patched,
 	}, nil
 }
 
@@ -262,7 +366,16 @@ func (p *UpdaterPlugin) handleInstallUpdate(args map[string]interface{}) (interf
 
 	p.ctx.Logger.Info("Installing update...")
 
-	err := p.installUpdate(filepath)
+	// 只安装通过 download_update 下载的更新，安装前重新校验
+	p.mu.RLock()
+	update := p.downloads[filepath]
+	p.mu.RUnlock()
+	if update == nil {
+		p.updateMetrics("failed_updates", 1)
+		return nil, fmt.Errorf("%s was not downloaded by download_update", filepath)
+	}
+
+	state, err := p.installUpdate(filepath, update)
 	if err != nil {
 		p.updateMetrics("failed_updates", 1)
 		return nil, fmt.Errorf("failed to install update: %v", err)
@@ -270,9 +383,18 @@ func (p *UpdaterPlugin) handleInstallUpdate(args map[string]interface{}) (interf
 
 	p.updateMetrics("successful_updates", 1)
 
+	// 不重启时新版本在 Agent 下次启动后生效
+	if restart, ok := args["restart"].(bool); ok && !restart {
+		return map[string]interface{}{
+			"status":  "success",
+			"message": "Update installed, it takes effect after the agent restarts",
+		}, nil
+	}
+	p.scheduleRestart(state.Executable, state.Version)
+
 	return map[string]interface{}{
 		"status":  "success",
-		"message": "Update installed successfully",
+		"message": "Update installed, restarting agent",
 	}, nil
 }
 
@@ -283,53 +405,98 @@ func (p *UpdaterPlugin) handleGetStatus(args map[string]interface{}) (interface{
 
 // handleGetVersion 处理获取版本命令
 func (p *UpdaterPlugin) handleGetVersion(args map[string]interface{}) (interface{}, error) {
-	return map[string]interface{}{
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := map[string]interface{}{
 		"current_version": p.getCurrentVersion(),
-		"update_url":      p.updateURL,
-	}, nil
+		"update_url":      p.config["update_url"],
+	}
+	if !p.lastCheck.IsZero() {
+		result["last_check"] = p.lastCheck
+	}
+	if p.latest != nil {
+		result["latest_version"] = p.latest.Version
+	}
+	return result, nil
 }
 
-// checkUpdate 检查更新
+// checkUpdate 从 update_url 获取更新清单，返回订阅渠道中当前平台的最新版本，未配置 update_url 或清单没有当前平台时返回 nil
 func (p *UpdaterPlugin) checkUpdate() (*UpdateInfo, error) {
-	// 这里实现检查更新的逻辑
-	// 可以调用远程 API 获取最新版本信息
-	p.ctx.Logger.Debug("Checking for updates...")
+	p.mu.RLock()
+	updateURL, _ := p.config["update_url"].(string)
+	channel, _ := p.config["channel"].(string)
+	p.mu.RUnlock()
+	if updateURL == "" {
+		p.ctx.Logger.Debug("update_url is not configured, skipping update check")
+		return nil, nil
+	}
+	if channel == "" {
+		channel = "stable"
+	}
 
-	// 模拟检查更新
-	// 在实际实现中，这里应该调用远程 API
-	return nil, nil
+	p.ctx.Logger.Debug("Checking for updates...")
+	manifest, base, err := p.fetchManifest(context.Background(), updateURL, channel)
+	if err != nil {
+		return nil, err
+	}
+	// 灰度发布按 Agent ID 选择 Agent
+	agentID, _ := p.ctx.Agent.GetConfig("agent.id").(string)
+	update, err := manifest.release(base, channel, agentID, p.currentVersion)
+	if err == nil && update == nil {
+		p.ctx.Logger.Debugf("Update manifest has no release for %s on channel %s", platformKey(), channel)
+	}
+	return update, err
 }
 
-// isUpdateAvailable 检查是否有可用更新
+// isUpdateAvailable 检查是否有可用更新，发现新版本时发送 update_available 事件（每个版本一次）
 func (p *UpdaterPlugin) isUpdateAvailable() (bool, *UpdateInfo, error) {
 	update, err := p.checkUpdate()
 	if err != nil {
+		p.updateMetrics("failed_checks", 1)
 		return false, nil, err
 	}
-
-	if update == nil {
-		return false, nil, nil
-	}
+	p.updateMetrics("total_checks", 1)
 
 	// 比较版本号
-	return p.compareVersions(update.Version, p.currentVersion) > 0, update, nil
-}
-
-// compareVersions 比较版本号
-func (p *UpdaterPlugin) compareVersions(v1, v2 string) int {
-	// 简单的版本号比较
-	// 在实际实现中，应该使用更复杂的版本号比较逻辑
-	if v1 == v2 {
-		return 0
+	available := update != nil && p.compareVersions(update.Version, p.currentVersion) > 0
+	p.mu.Lock()
+	p.lastCheck = time.Now()
+	p.latest = nil
+	if available {
+		p.latest = update
 	}
-	if v1 > v2 {
-		return 1
+	notify := available && p.notified != update.Version
+	if notify {
+		p.notified = update.Version
 	}
-	return -1
+	p.mu.Unlock()
+
+	if notify {
+		p.updateMetrics("available_updates", 1)
+		p.ctx.Logger.Infof("Update available: %s -> %s", p.currentVersion, update.Version)
+		p.ctx.Agent.NotifyEvent("update_available", map[string]interface{}{
+			"current_version": p.currentVersion,
+			"version":         update.Version,
+			"url":             update.URL,
+			"checksum":        update.Checksum,
+			"size":            update.Size,
+			"release_date":    update.ReleaseDate,
+			"changelog":       update.Changelog,
+			"channel":         update.Channel,
+		})
+	}
+	return available, update, nil
+}
+
+// compareVersions 比较版本号，数字段按数值比较（1.10.0 比 1.9.0 新）
+func (p *UpdaterPlugin) compareVersions(v1, v2 string) int {
+	return compareVersionStrings(v1, v2)
 }
 
-// downloadUpdate 下载更新
-func (p *UpdaterPlugin) downloadUpdate(update *UpdateInfo) (string, error) {
+// downloadUpdate 下载更新，校验 SHA-256 和签名后返回文件路径，校验失败时删除文件。
+// 有差分补丁时先用补丁生成新版本（patched 为 true），补丁失败时下载完整文件
+func (p *UpdaterPlugin) downloadUpdate(update *UpdateInfo) (string, bool, error) {
 	p.ctx.Logger.Infof("Downloading update version %s", update.Version)
 
 	// 创建下载文件路径
@@ -339,75 +506,155 @@ func (p *UpdaterPlugin) downloadUpdate(update *UpdateInfo) (string, error) {
 	}
 	filepath := filepath.Join(p.downloadDir, filename)
 
-	// 下载文件
-	resp, err := http.Get(update.URL)
+	patched := false
+	if update.Patch != nil && p.configBool("patch_updates", true) {
+		if err := p.downloadPatch(update, filepath); err != nil {
+			p.updateMetrics("patch_failures", 1)
+			p.ctx.Logger.Warnf("Patch update from %s failed, downloading full update: %v", update.Patch.From, err)
+		} else {
+			p.updateMetrics("patched_downloads", 1)
+			patched = true
+		}
+	}
+
+	if !patched {
+		if err := p.downloadFile(update.URL, filepath); err != nil {
+			return "", false, err
+		}
+		if err := p.verifyUpdate(filepath, update); err != nil {
+			p.files.Remove(filepath)
+			return "", false, err
+		}
+	}
+
+	p.mu.Lock()
+	p.downloads[filepath] = update
+	p.mu.Unlock()
+
+	p.ctx.Logger.Infof("Update downloaded to: %s", filepath)
+	return filepath, patched, nil
+}
+
+// downloadPatch 下载补丁并应用到当前可执行文件生成 target，结果按完整文件的 SHA-256 和签名校验
+func (p *UpdaterPlugin) downloadPatch(update *UpdateInfo, target string) error {
+	patchPath := target + ".patch"
+	defer p.files.Remove(patchPath)
+	if err := p.downloadFile(update.Patch.URL, patchPath); err != nil {
+		return err
+	}
+	if update.Patch.Checksum != "" {
+		sum, err := fileSHA256(patchPath)
+		if err != nil {
+			return err
+		}
+		if sum != update.Patch.Checksum {
+			return fmt.Errorf("patch checksum mismatch: expected %s, got %s", update.Patch.Checksum, sum)
+		}
+	}
+
+	currentExe, err := p.executable()
+	if err != nil {
+		return fmt.Errorf("failed to get current executable path: %v", err)
+	}
+	if err := applyPatchFile(p.files, currentExe, patchPath, target, update.Size); err != nil {
+		return fmt.Errorf("failed to apply patch: %v", err)
+	}
+	if err := p.verifyUpdate(target, update); err != nil {
+		p.files.Remove(target)
+		return err
+	}
+	return nil
+}
+
+// downloadFile 下载 url 到 path，失败时删除 path
+func (p *UpdaterPlugin) downloadFile(url, path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDownloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download update: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to download update: %v", err)
+		return fmt.Errorf("failed to download update: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("download failed with status: %d", resp.StatusCode)
+		return fmt.Errorf("download failed with status: %d", resp.StatusCode)
 	}
 
 	// 创建文件
-	file, err := os.Create(filepath)
+	file, err := p.files.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %v", err)
+		return fmt.Errorf("failed to create file: %v", err)
 	}
-	defer file.Close()
 
 	// 写入文件
 	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to write file: %v", err)
+		p.files.Remove(path)
+		return fmt.Errorf("failed to write file: %v", err)
 	}
-
-	p.ctx.Logger.Infof("Update downloaded to: %s", filepath)
-	return filepath, nil
+	return nil
 }
 
-// installUpdate 安装更新
-func (p *UpdaterPlugin) installUpdate(filepath string) error {
+// installUpdate 重新校验更新文件后替换当前可执行文件，校验失败时拒绝安装，
+// 成功后保存等待新版本确认的更新状态
+func (p *UpdaterPlugin) installUpdate(filepath string, update *UpdateInfo) (*updateState, error) {
 	p.ctx.Logger.Info("Installing update...")
 
+	// 下载后文件可能被修改
+	if err := p.verifyUpdate(filepath, update); err != nil {
+		return nil, err
+	}
+
 	// 获取当前可执行文件路径
-	currentExe, err := os.Executable()
+	currentExe, err := p.executable()
 	if err != nil {
-		return fmt.Errorf("failed to get current executable path: %v", err)
+		return nil, fmt.Errorf("failed to get current executable path: %v", err)
 	}
 
 	// 创建备份
 	backupPath := currentExe + ".backup"
-	if err := os.Rename(currentExe, backupPath); err != nil {
-		return fmt.Errorf("failed to create backup: %v", err)
+	if err := p.files.Rename(currentExe, backupPath); err != nil {
+		return nil, fmt.Errorf("failed to create backup: %v", err)
 	}
 
-	// 复制新文件
-	if err := copyFile(filepath, currentExe); err != nil {
+	// 复制新文件，创建时即带执行权限
+	if err := copyFile(p.files, filepath, currentExe); err != nil {
 		// 恢复备份
-		os.Rename(backupPath, currentExe)
-		return fmt.Errorf("failed to install update: %v", err)
+		p.files.Rename(backupPath, currentExe)
+		return nil, fmt.Errorf("failed to install update: %v", err)
 	}
 
-	// 设置执行权限
-	if err := os.Chmod(currentExe, 0755); err != nil {
-		p.ctx.Logger.Warnf("Failed to set executable permissions: %v", err)
+	state := &updateState{
+		Version:         update.Version,
+		PreviousVersion: p.currentVersion,
+		Executable:      currentExe,
+		Backup:          backupPath,
+		InstalledAt:     time.Now(),
+	}
+	if err := p.saveUpdateState(state); err != nil {
+		p.ctx.Logger.Warnf("Failed to save update state, the update cannot be rolled back automatically: %v", err)
 	}
 
 	p.ctx.Logger.Info("Update installed successfully")
-	return nil
+	return state, nil
 }
 
-// copyFile 复制文件
-func copyFile(src, dst string) error {
+// copyFile 复制文件，目标文件通过 files 创建并带有执行权限
+func copyFile(files plugin.FileSystem, src, dst string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
+	destFile, err := files.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
 		return err
 	}
@@ -417,29 +664,59 @@ func copyFile(src, dst string) error {
 	return err
 }
 
-// getCurrentVersion 获取当前版本
+// getCurrentVersion 获取当前版本，来自 Agent 的 agent.version 配置
 func (p *UpdaterPlugin) getCurrentVersion() string {
-	// 这里应该从配置或编译信息中获取版本
+	if version, ok := p.ctx.Agent.GetConfig("agent.version").(string); ok && version != "" {
+		return version
+	}
 	return "1.0.0"
 }
 
-// getDownloadDir 获取下载目录
-func (p *UpdaterPlugin) getDownloadDir() string {
-	if dir, ok := p.config["download_dir"].(string); ok && dir != "" {
+// getDownloadDir 获取下载目录，相对路径位于数据目录下
+func (p *UpdaterPlugin) getDownloadDir(dataDir string) string {
+	dir := p.configString("download_dir", "downloads")
+	if dir == "" {
+		dir = "downloads"
+	}
+	if filepath.IsAbs(dir) {
 		return dir
 	}
-	return "./downloads"
+	return filepath.Join(dataDir, dir)
+}
+
+// configBool 读取布尔配置，配置值可以是布尔值或字符串
+func (p *UpdaterPlugin) configBool(key string, defaultValue bool) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return plugin.ConfigBool(p.config, key, defaultValue)
+}
+
+// configString 读取字符串配置
+func (p *UpdaterPlugin) configString(key, defaultValue string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return plugin.ConfigString(p.config, key, defaultValue)
+}
+
+// configDuration 读取时长配置，如 "2m"
+func (p *UpdaterPlugin) configDuration(key string, defaultValue time.Duration) time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return plugin.ConfigDuration(p.config, key, defaultValue)
 }
 
 // setDefaultConfig 设置默认配置
 func (p *UpdaterPlugin) setDefaultConfig() {
 	defaults := map[string]interface{}{
-		"update_url":     "https://api.example.com/updates",
+		"update_url":     "",
 		"check_interval": 3600,
 		"auto_update":    false,
-		"download_dir":   "./downloads",
+		"download_dir":   "downloads",
+		"channel":        "stable",
 	}
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	for key, value := range defaults {
 		if _, exists := p.config[key]; !exists {
 			p.config[key] = value
@@ -1,31 +1,64 @@
 package updater
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"assistant_agent/internal/executor"
 	"assistant_agent/internal/plugin"
+	"assistant_agent/internal/plugin/plugintest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// MockLogger 模拟日志器
-type MockLogger struct{}
+// MockAgent 模拟 Agent 接口，记录插件发送的事件
+type MockAgent struct {
+	plugin.LocalFS
+	plugin.LocalCommander
+	id        string
+	version   string
+	dataDir   string
+	connected bool
+
+	mu           sync.Mutex
+	events       []mockEvent
+	commands     int // 正在执行的命令数
+	runningTasks int // 调度器正在执行的任务数
+}
 
-func (l *MockLogger) Debug(args ...interface{})                 {}
-func (l *MockLogger) Info(args ...interface{})                  {}
-func (l *MockLogger) Warn(args ...interface{})                  {}
-func (l *MockLogger) Error(args ...interface{})                 {}
-func (l *MockLogger) Debugf(format string, args ...interface{}) {}
-func (l *MockLogger) Infof(format string, args ...interface{})  {}
-func (l *MockLogger) Warnf(format string, args ...interface{})  {}
-func (l *MockLogger) Errorf(format string, args ...interface{}) {}
+type mockEvent struct {
+	Type string
+	Data map[string]interface{}
+}
 
-// MockAgent 模拟 Agent 接口
-type MockAgent struct{}
+// eventsOf 返回指定类型的事件
+func (a *MockAgent) eventsOf(eventType string) []mockEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var result []mockEvent
+	for _, event := range a.events {
+		if event.Type == eventType {
+			result = append(result, event)
+		}
+	}
+	return result
+}
 
 func (a *MockAgent) GetSystemInfo() (map[string]interface{}, error) {
 	return map[string]interface{}{}, nil
@@ -35,6 +68,26 @@ func (a *MockAgent) ExecuteCommand(command string, args []string, timeout time.D
 	return "", nil
 }
 
+func (a *MockAgent) ExecuteScript(ref string, args []string, timeout time.Duration) (string, error) {
+	return "", nil
+}
+
+func (a *MockAgent) ExecuteCommandContext(ctx context.Context, command string, args []string, timeout time.Duration) (string, error) {
+	return "", nil
+}
+
+func (a *MockAgent) ExecuteScriptContext(ctx context.Context, ref string, args []string, timeout time.Duration) (string, error) {
+	return "", nil
+}
+
+func (a *MockAgent) RunCommand(ctx context.Context, cmd *executor.Command) (*executor.Result, error) {
+	return &executor.Result{ID: cmd.ID, Success: true}, nil
+}
+
+func (a *MockAgent) CallServer(msgType string, data interface{}, timeout time.Duration) (interface{}, error) {
+	return nil, nil
+}
+
 func (a *MockAgent) ReadFile(path string) ([]byte, error) {
 	return []byte{}, nil
 }
@@ -48,6 +101,14 @@ func (a *MockAgent) FileExists(path string) bool {
 }
 
 func (a *MockAgent) GetConfig(key string) interface{} {
+	switch {
+	case key == "agent.id" && a.id != "":
+		return a.id
+	case key == "agent.version" && a.version != "":
+		return a.version
+	case key == "agent.data_dir" && a.dataDir != "":
+		return a.dataDir
+	}
 	return nil
 }
 
@@ -56,7 +117,17 @@ func (a *MockAgent) SetConfig(key string, value interface{}) error {
 }
 
 func (a *MockAgent) GetStatus() map[string]interface{} {
-	return map[string]interface{}{}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := map[string]interface{}{
+		"running_commands": a.commands,
+		"queued_commands":  a.commands,
+		"plugins": map[string]*plugin.PluginStatus{
+			plugin.SchedulerPluginName: {Metrics: map[string]interface{}{"running_tasks": a.runningTasks}},
+		},
+	}
+	status["connected"] = a.connected
+	return status
 }
 
 func (a *MockAgent) SetStatus(key string, value interface{}) error {
@@ -64,6 +135,9 @@ func (a *MockAgent) SetStatus(key string, value interface{}) error {
 }
 
 func (a *MockAgent) NotifyEvent(eventType string, data map[string]interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, mockEvent{Type: eventType, Data: data})
 	return nil
 }
 
@@ -83,6 +157,28 @@ func TestUpdaterPluginInfo(t *testing.T) {
 	assert.Equal(t, "1.0.0", info.Version)
 	assert.Equal(t, "Automatic update plugin for assistant agent", info.Description)
 	assert.Contains(t, info.Tags, "updater")
+
+	// 替换可执行文件、写入下载目录和重启 Agent 都需要声明权限，写权限不随 download_dir 变化
+	updaterPlugin.config["download_dir"] = "/"
+	info = updaterPlugin.Info()
+	require.NotNil(t, info.Permissions)
+	assert.True(t, info.Permissions.Exec)
+	assert.Equal(t, []string{plugin.PathDataDir, plugin.PathExecDir}, info.Permissions.WritePaths)
+}
+
+func TestUpdaterPluginDownloadDir(t *testing.T) {
+	p := NewUpdaterPlugin()
+	dataDir := t.TempDir()
+
+	// 默认和相对路径都位于数据目录下
+	assert.Equal(t, filepath.Join(dataDir, "downloads"), p.getDownloadDir(dataDir))
+	p.config["download_dir"] = "updates"
+	assert.Equal(t, filepath.Join(dataDir, "updates"), p.getDownloadDir(dataDir))
+
+	// 服务器下发的配置不能把下载目录指向数据目录以外
+	assert.NoError(t, p.ValidateConfig(map[string]interface{}{"download_dir": "updates"}))
+	assert.Error(t, p.ValidateConfig(map[string]interface{}{"download_dir": "/"}))
+	assert.Error(t, p.ValidateConfig(map[string]interface{}{"download_dir": "../etc"}))
 }
 
 func TestUpdaterPluginInit(t *testing.T) {
@@ -90,7 +186,7 @@ func TestUpdaterPluginInit(t *testing.T) {
 	updaterPlugin := NewUpdaterPlugin()
 	ctx := &plugin.PluginContext{
 		Agent:  &MockAgent{},
-		Logger: &MockLogger{},
+		Logger: &plugintest.Logger{},
 	}
 
 	err := updaterPlugin.Init(ctx)
@@ -103,7 +199,7 @@ func TestUpdaterPluginStartStop(t *testing.T) {
 	updaterPlugin := NewUpdaterPlugin()
 	ctx := &plugin.PluginContext{
 		Agent:  &MockAgent{},
-		Logger: &MockLogger{},
+		Logger: &plugintest.Logger{},
 	}
 
 	// 初始化
@@ -126,7 +222,7 @@ func TestUpdaterPluginHandleCommand(t *testing.T) {
 	updaterPlugin := NewUpdaterPlugin()
 	ctx := &plugin.PluginContext{
 		Agent:  &MockAgent{},
-		Logger: &MockLogger{},
+		Logger: &plugintest.Logger{},
 	}
 
 	// 初始化
@@ -167,6 +263,8 @@ func TestUpdaterPluginCompareVersions(t *testing.T) {
 		{"1.0.1", "1.0.0", 1},
 		{"1.0.0", "2.0.0", -1},
 		{"2.0.0", "1.0.0", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"v1.2", "1.2.0", -1},
 	}
 
 	for _, test := range tests {
@@ -189,7 +287,7 @@ func TestUpdaterPluginCopyFile(t *testing.T) {
 	require.NoError(t, err)
 
 	// 复制文件
-	err = copyFile(srcFile, dstFile)
+	err = copyFile(plugin.LocalFS{}, srcFile, dstFile)
 	require.NoError(t, err)
 
 	// 验证目标文件存在
@@ -236,3 +334,554 @@ func TestUpdateInfo(t *testing.T) {
 	assert.Equal(t, "Test update", updateInfo.Changelog)
 	assert.Equal(t, int64(1024), updateInfo.Size)
 }
+
+// newTestPlugin 创建使用模拟 Agent 初始化的更新插件，下载目录为临时目录
+func newTestPlugin(t *testing.T, agent *MockAgent, config map[string]interface{}) *UpdaterPlugin {
+	p := NewUpdaterPlugin()
+	config["download_dir"] = t.TempDir()
+	require.NoError(t, p.SetConfig(config))
+	require.NoError(t, p.Init(&plugin.PluginContext{Agent: agent, Logger: &plugintest.Logger{}}))
+	return p
+}
+
+func TestCheckUpdate(t *testing.T) {
+	var mu sync.Mutex
+	version := "1.4.0"
+	var query map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		query = map[string]string{"os": r.URL.Query().Get("os"), "arch": r.URL.Query().Get("arch"), "version": r.URL.Query().Get("version")}
+		switch r.URL.Path {
+		case "/stable/manifest.json":
+			fmt.Fprintf(w, `{"version": %q, "changelog": "Bug fixes", "platforms": {%q: {"url": "files/agent", "checksum": "ABCDEF", "size": 42}}}`, version, platformKey())
+		case "/stable/manifest.toml":
+			w.Header().Set("Content-Type", "application/toml")
+			fmt.Fprintf(w, "version = %q\nrelease_date = 2026-10-01T00:00:00Z\n\n[platforms.%s]\nurl = \"https://cdn.example.com/agent\"\nsize = 7\n", version, platformKey())
+		case "/other/manifest.json":
+			fmt.Fprint(w, `{"version": "9.0.0", "platforms": {"plan9-mips": {"url": "agent"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	agent := &MockAgent{version: "1.2.0"}
+	p := newTestPlugin(t, agent, map[string]interface{}{"update_url": server.URL + "/stable/manifest.json", "check_interval": "0"})
+
+	// 清单中的相对地址按清单地址解析，请求带当前平台和版本
+	result, err := p.HandleCommand("check_update", map[string]interface{}{})
+	require.NoError(t, err)
+	update := result.(map[string]interface{})["update"].(*UpdateInfo)
+	assert.Equal(t, "1.4.0", update.Version)
+	assert.Equal(t, server.URL+"/stable/files/agent", update.URL)
+	assert.Equal(t, "abcdef", update.Checksum)
+	assert.Equal(t, int64(42), update.Size)
+	mu.Lock()
+	assert.Equal(t, map[string]string{"os": runtime.GOOS, "arch": runtime.GOARCH, "version": "1.2.0"}, query)
+	mu.Unlock()
+
+	// 同一版本只发送一次 update_available 事件
+	_, err = p.HandleCommand("check_update", map[string]interface{}{})
+	require.NoError(t, err)
+	events := agent.eventsOf("update_available")
+	require.Len(t, events, 1)
+	assert.Equal(t, "1.4.0", events[0].Data["version"])
+	assert.Equal(t, "1.2.0", events[0].Data["current_version"])
+	result, err = p.HandleCommand("get_version", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, "1.4.0", result.(map[string]interface{})["latest_version"])
+	assert.Equal(t, 2, p.Status().Metrics["total_checks"])
+
+	// TOML 清单
+	p.SetConfig(map[string]interface{}{"update_url": server.URL + "/stable/manifest.toml"})
+	available, update, err := p.isUpdateAvailable()
+	require.NoError(t, err)
+	assert.True(t, available)
+	assert.Equal(t, "https://cdn.example.com/agent", update.URL)
+	assert.Equal(t, 2026, update.ReleaseDate.Year())
+
+	// 版本不比当前新、清单没有当前平台或请求失败时没有可用更新
+	mu.Lock()
+	version = "1.2.0"
+	mu.Unlock()
+	available, _, err = p.isUpdateAvailable()
+	require.NoError(t, err)
+	assert.False(t, available)
+	p.SetConfig(map[string]interface{}{"update_url": server.URL + "/other/manifest.json"})
+	available, update, err = p.isUpdateAvailable()
+	require.NoError(t, err)
+	assert.False(t, available)
+	assert.Nil(t, update)
+	p.SetConfig(map[string]interface{}{"update_url": server.URL + "/missing.json"})
+	_, err = p.HandleCommand("check_update", map[string]interface{}{})
+	assert.ErrorContains(t, err, "404")
+	assert.Equal(t, 1, p.Status().Metrics["failed_checks"])
+
+	// 启动后每隔 check_interval 自动检查
+	mu.Lock()
+	version = "1.5.0"
+	mu.Unlock()
+	p.SetConfig(map[string]interface{}{"update_url": server.URL + "/stable/manifest.json", "check_interval": "20ms"})
+	require.NoError(t, p.Start())
+	defer p.Stop()
+	require.Eventually(t, func() bool { return len(agent.eventsOf("update_available")) == 2 }, 2*time.Second, 5*time.Millisecond)
+}
+
+// signUpdate 使用测试私钥签名并嵌入对应公钥
+func signUpdate(t *testing.T, update *UpdateInfo) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	previous := updatePublicKey
+	updatePublicKey = base64.StdEncoding.EncodeToString(public)
+	t.Cleanup(func() { updatePublicKey = previous })
+	update.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, signedContent(update)))
+}
+
+func TestUpdateVerification(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho 1.4.0\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(binary)
+	update := &UpdateInfo{Version: "1.4.0", URL: server.URL + "/agent", Checksum: hex.EncodeToString(sum[:])}
+	signUpdate(t, update)
+
+	p := newTestPlugin(t, &MockAgent{}, map[string]interface{}{})
+	exe := filepath.Join(t.TempDir(), "assistant_agent")
+	require.NoError(t, os.WriteFile(exe, []byte("old"), 0755))
+	p.executable = func() (string, error) { return exe, nil }
+	p.restart = func(string) error { return nil }
+
+	// 校验和或签名不匹配时不保留下载的文件
+	for name, modify := range map[string]func(u *UpdateInfo){
+		"checksum mismatch": func(u *UpdateInfo) { u.Checksum = strings.Repeat("0", 64) },
+		"invalid signature": func(u *UpdateInfo) { u.Version = "1.5.0" },
+		"no checksum":       func(u *UpdateInfo) { u.Checksum = "" },
+	} {
+		bad := *update
+		modify(&bad)
+		_, err := p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(&bad)})
+		assert.ErrorContains(t, err, name)
+		entries, err := os.ReadDir(p.downloadDir)
+		require.NoError(t, err)
+		assert.Empty(t, entries, name)
+	}
+
+	// 只安装 download_update 下载并校验过的文件
+	_, err := p.HandleCommand("install_update", map[string]interface{}{"filepath": exe})
+	assert.ErrorContains(t, err, "not downloaded by download_update")
+
+	result, err := p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(update)})
+	require.NoError(t, err)
+	path := result.(map[string]interface{})["filepath"].(string)
+
+	// 下载后被修改的文件拒绝安装
+	require.NoError(t, os.WriteFile(path, []byte("tampered"), 0755))
+	_, err = p.HandleCommand("install_update", map[string]interface{}{"filepath": path})
+	assert.ErrorContains(t, err, "checksum mismatch")
+	data, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+
+	require.NoError(t, os.WriteFile(path, binary, 0755))
+	_, err = p.HandleCommand("install_update", map[string]interface{}{"filepath": path})
+	require.NoError(t, err)
+	data, err = os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, binary, data)
+	assert.Equal(t, 1, p.Status().Metrics["successful_updates"])
+	assert.Equal(t, 2, p.Status().Metrics["failed_updates"])
+
+	// 没有嵌入公钥时只有 allow_unsigned 允许安装
+	updatePublicKey = ""
+	_, err = p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(update)})
+	assert.ErrorContains(t, err, "no update signing key")
+	p.SetConfig(map[string]interface{}{"allow_unsigned": "true"})
+	_, err = p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(update)})
+	assert.NoError(t, err)
+}
+
+// toJSON 模拟参数经过 JSON 编码后的结构
+func toJSON(value interface{}) interface{} {
+	data, _ := json.Marshal(value)
+	var result interface{}
+	json.Unmarshal(data, &result)
+	return result
+}
+
+func TestRollout(t *testing.T) {
+	// 找到灰度 10% 范围内外的 Agent
+	var inside, outside string
+	for i := 0; inside == "" || outside == ""; i++ {
+		id := fmt.Sprintf("agent-%d", i)
+		if rolloutBucket(id, "1.5.0-beta.1") < 10 {
+			inside = id
+		} else {
+			outside = id
+		}
+	}
+	assert.Equal(t, rolloutBucket(inside, "1.5.0-beta.1"), rolloutBucket(inside, "1.5.0-beta.1"))
+
+	var channel string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel = r.URL.Query().Get("channel")
+		w.Header().Set("Content-Type", "application/toml")
+		fmt.Fprintf(w, `version = "1.4.0"
+[platforms.%[1]s]
+url = "stable/agent"
+
+[channels.beta]
+version = "1.5.0-beta.1"
+rollout = 10
+[channels.beta.platforms.%[1]s]
+url = "beta/agent"
+
+[channels.canary]
+version = "1.3.9"
+[channels.canary.platforms.%[1]s]
+url = "canary/agent"
+`, platformKey())
+	}))
+	defer server.Close()
+
+	check := func(id, channel string) *UpdateInfo {
+		p := newTestPlugin(t, &MockAgent{id: id, version: "1.2.0"}, map[string]interface{}{"update_url": server.URL, "channel": channel})
+		available, update, err := p.isUpdateAvailable()
+		require.NoError(t, err)
+		if !available {
+			return nil
+		}
+		return update
+	}
+
+	// stable 渠道不接收 beta 版本
+	update := check(inside, "stable")
+	assert.Equal(t, "1.4.0", update.Version)
+	assert.Equal(t, "stable", update.Channel)
+	assert.Equal(t, "stable", channel)
+
+	// beta 灰度范围内的 Agent 接收 beta 版本，范围外和未知 ID 的 Agent 只接收 stable 版本
+	update = check(inside, "beta")
+	assert.Equal(t, "1.5.0-beta.1", update.Version)
+	assert.Equal(t, server.URL+"/beta/agent", update.URL)
+	assert.Equal(t, "beta", channel)
+	assert.Equal(t, "1.4.0", check(outside, "beta").Version)
+	assert.Equal(t, "1.4.0", check("", "beta").Version)
+
+	// canary 渠道同时接收 beta 和 stable，取最新版本
+	update = check(inside, "canary")
+	assert.Equal(t, "1.5.0-beta.1", update.Version)
+
+	p := NewUpdaterPlugin()
+	assert.NoError(t, p.ValidateConfig(map[string]interface{}{"channel": "canary"}))
+	assert.Error(t, p.ValidateConfig(map[string]interface{}{"channel": "nightly"}))
+	_, err := parseManifest([]byte(`{"channels": {"nightly": {"version": "2.0"}}}`), "", "")
+	assert.ErrorContains(t, err, "invalid channel")
+}
+
+func TestRestartAndRollback(t *testing.T) {
+	binary := []byte("new agent")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+	sum := sha256.Sum256(binary)
+	update := &UpdateInfo{Version: "1.4.0", URL: server.URL, Checksum: hex.EncodeToString(sum[:])}
+	signUpdate(t, update)
+
+	dataDir := t.TempDir()
+	exe := filepath.Join(t.TempDir(), "assistant_agent")
+	config := map[string]interface{}{"restart_delay": "1ms", "health_check_window": "100ms", "check_interval": "0"}
+	restarts := make(chan string, 10)
+	// start 模拟 Agent 以 version 启动
+	start := func(agent *MockAgent) *UpdaterPlugin {
+		p := NewUpdaterPlugin()
+		p.executable = func() (string, error) { return exe, nil }
+		p.restart = func(exe string) error {
+			restarts <- exe
+			return nil
+		}
+		agent.dataDir = dataDir
+		config["download_dir"] = t.TempDir()
+		require.NoError(t, p.SetConfig(config))
+		require.NoError(t, p.Init(&plugin.PluginContext{Agent: agent, Logger: &plugintest.Logger{}}))
+		require.NoError(t, p.Start())
+		t.Cleanup(func() { p.Stop() })
+		return p
+	}
+	install := func() {
+		require.NoError(t, os.WriteFile(exe, []byte("old agent"), 0755))
+		agent := &MockAgent{version: "1.2.0", connected: true}
+		p := start(agent)
+		result, err := p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(update)})
+		require.NoError(t, err)
+		_, err = p.HandleCommand("install_update", map[string]interface{}{"filepath": result.(map[string]interface{})["filepath"]})
+		require.NoError(t, err)
+		assert.Equal(t, exe, <-restarts)
+		require.Len(t, agent.eventsOf("update_restarting"), 1)
+		assert.FileExists(t, filepath.Join(dataDir, updateStateFileName))
+	}
+
+	// 新版本启动后连接到服务器，确认更新
+	install()
+	agent := &MockAgent{version: "1.4.0", connected: true}
+	start(agent)
+	require.Eventually(t, func() bool { return len(agent.eventsOf("update_completed")) == 1 }, time.Second, time.Millisecond)
+	assert.NoFileExists(t, filepath.Join(dataDir, updateStateFileName))
+	data, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, binary, data)
+
+	// 新版本在 health_check_window 内没有连接到服务器，恢复备份并重启
+	install()
+	agent = &MockAgent{version: "1.4.0"}
+	start(agent)
+	require.Eventually(t, func() bool { return len(agent.eventsOf("update_rolled_back")) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, exe, <-restarts)
+	data, err = os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, "old agent", string(data))
+	assert.Equal(t, "1.2.0", agent.eventsOf("update_rolled_back")[0].Data["previous_version"])
+	assert.NoFileExists(t, filepath.Join(dataDir, updateStateFileName))
+
+	// 新版本反复启动（崩溃循环）时直接回滚
+	install()
+	for i := 0; i < maxUpdateStarts; i++ {
+		p := start(&MockAgent{version: "1.4.0"})
+		p.Stop()
+	}
+	agent = &MockAgent{version: "1.4.0", connected: true}
+	start(agent)
+	require.Len(t, agent.eventsOf("update_rolled_back"), 1)
+	assert.Contains(t, agent.eventsOf("update_rolled_back")[0].Data["reason"], "restarted 3 times")
+	assert.Equal(t, exe, <-restarts)
+	data, err = os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, "old agent", string(data))
+}
+
+// testPatch 把 testPatchOld 转换为 testPatchNew 的 bsdiff 补丁
+const testPatch = "QlNESUZGNDAxAAAAAAAAACoAAAAAAAAALwAAAAAAAABCWmg5MUFZJlNZ8e5pwAAACPAAaBgIAAQAIAAxDACU00yXm8CKIvi7kinChIePc04AQlpoOTFBWSZTWZrko/0AAAHgAFAAAAIgADDMDPUEucXckU4UJCa5KP9AQlpoOTFBWSZTWXpJk0QAAAARgEBgLkBEACAAMQAwIANqTGIQI8XckU4UJB6SZNEA"
+
+const (
+	testPatchOld = "#!/bin/sh\necho assistant_agent 1.2.0\n"
+	testPatchNew = "#!/bin/sh\necho assistant_agent 1.4.0 (patched)\n"
+)
+
+func TestPatchUpdate(t *testing.T) {
+	patch, err := base64.StdEncoding.DecodeString(testPatch)
+	require.NoError(t, err)
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/agent.patch":
+			w.Write(patch)
+		case "/agent":
+			w.Write([]byte(testPatchNew))
+		case "/corrupt.patch":
+			w.Write(append([]byte("BSDIFF40"), patch[8:40]...))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	hits := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[path]
+	}
+
+	// 清单提供从当前版本升级的补丁
+	patchSum := sha256.Sum256(patch)
+	manifest, err := parseManifest([]byte(`{"version": "1.4.0", "platforms": {"`+platformKey()+`": {"url": "agent",
+		"patches": {"1.2.0": {"url": "agent.patch", "checksum": "`+hex.EncodeToString(patchSum[:])+`"}}}}}`), "application/json", "manifest.json")
+	require.NoError(t, err)
+	base, err := url.Parse(server.URL + "/manifest.json")
+	require.NoError(t, err)
+	update, err := manifest.release(base, "stable", "", "1.2.0")
+	require.NoError(t, err)
+	require.NotNil(t, update.Patch)
+	assert.Equal(t, "1.2.0", update.Patch.From)
+	assert.Equal(t, server.URL+"/agent.patch", update.Patch.URL)
+	other, err := manifest.release(base, "stable", "", "1.1.0")
+	require.NoError(t, err)
+	assert.Nil(t, other.Patch)
+
+	sum := sha256.Sum256([]byte(testPatchNew))
+	update.Checksum = hex.EncodeToString(sum[:])
+	update.Size = int64(len(testPatchNew))
+	signUpdate(t, update)
+
+	p := newTestPlugin(t, &MockAgent{version: "1.2.0"}, map[string]interface{}{})
+	exe := filepath.Join(t.TempDir(), "assistant_agent")
+	require.NoError(t, os.WriteFile(exe, []byte(testPatchOld), 0755))
+	p.executable = func() (string, error) { return exe, nil }
+
+	// 用补丁生成新版本，不下载完整文件
+	result, err := p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(update)})
+	require.NoError(t, err)
+	assert.Equal(t, true, result.(map[string]interface{})["patched"])
+	data, err := os.ReadFile(result.(map[string]interface{})["filepath"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, testPatchNew, string(data))
+	assert.Equal(t, 1, hits("/agent.patch"))
+	assert.Equal(t, 0, hits("/agent"))
+	assert.Equal(t, 1, p.Status().Metrics["patched_downloads"])
+
+	// 当前可执行文件与补丁的旧版本不一致时，生成的文件校验失败，改为下载完整文件
+	require.NoError(t, os.WriteFile(exe, []byte("#!/bin/sh\necho assistant_agent 1.3.0\n"), 0755))
+	result, err = p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(update)})
+	require.NoError(t, err)
+	assert.Equal(t, false, result.(map[string]interface{})["patched"])
+	data, err = os.ReadFile(result.(map[string]interface{})["filepath"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, testPatchNew, string(data))
+	assert.Equal(t, 1, hits("/agent"))
+	assert.Equal(t, 1, p.Status().Metrics["patch_failures"])
+
+	// 损坏的补丁同样回退
+	corrupt := *update
+	corrupt.Patch = &PatchInfo{From: "1.2.0", URL: server.URL + "/corrupt.patch"}
+	_, err = p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(&corrupt)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, hits("/agent"))
+	assert.Equal(t, 2, p.Status().Metrics["patch_failures"])
+	entries, err := os.ReadDir(p.downloadDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// patch_updates 为 false 时直接下载完整文件
+	require.NoError(t, p.SetConfig(map[string]interface{}{"patch_updates": false}))
+	_, err = p.HandleCommand("download_update", map[string]interface{}{"update": toJSON(update)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, hits("/agent.patch"))
+	assert.Equal(t, 3, hits("/agent"))
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	for _, value := range []string{"02:00", "mon-xyz 01:00-02:00", "25:00-01:00", "01:00-01:00"} {
+		_, err := parseMaintenanceWindows(value)
+		assert.Error(t, err, value)
+	}
+
+	// 2024-01-03 是星期三
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local) }
+	windows, err := parseMaintenanceWindows("fri 23:00-01:00, sat-sun 10:00-14:00")
+	require.NoError(t, err)
+	assert.True(t, inMaintenanceWindow(windows, at(5, 23, 30)))
+	assert.True(t, inMaintenanceWindow(windows, at(6, 0, 30)), "跨午夜的后半部分属于星期五开始的时间段")
+	assert.False(t, inMaintenanceWindow(windows, at(7, 0, 30)))
+	assert.True(t, inMaintenanceWindow(windows, at(7, 13, 59)))
+	assert.False(t, inMaintenanceWindow(windows, at(7, 14, 0)))
+	assert.Equal(t, at(5, 23, 0), nextMaintenanceWindow(windows, at(3, 12, 0)))
+	assert.Equal(t, at(6, 10, 0), nextMaintenanceWindow(windows, at(5, 23, 30)))
+	assert.Equal(t, at(12, 23, 0), nextMaintenanceWindow(windows, at(7, 15, 0)))
+
+	windows, err = parseMaintenanceWindows("")
+	require.NoError(t, err)
+	assert.True(t, inMaintenanceWindow(windows, at(3, 12, 0)))
+	assert.True(t, nextMaintenanceWindow(windows, at(3, 12, 0)).IsZero())
+}
+
+func TestAutoUpdate(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho 1.4.0\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+	sum := sha256.Sum256(binary)
+	update := &UpdateInfo{Version: "1.4.0", URL: server.URL, Checksum: hex.EncodeToString(sum[:])}
+	signUpdate(t, update)
+
+	agent := &MockAgent{version: "1.2.0", runningTasks: 1}
+	p := newTestPlugin(t, agent, map[string]interface{}{"maintenance_windows": "02:00-04:00"})
+	exe := filepath.Join(t.TempDir(), "assistant_agent")
+	require.NoError(t, os.WriteFile(exe, []byte("old"), 0755))
+	p.executable = func() (string, error) { return exe, nil }
+	p.restart = func(string) error { return nil }
+	p.latest = update
+	deferred := func() []string {
+		var reasons []string
+		for _, event := range agent.eventsOf("update_deferred") {
+			reasons = append(reasons, event.Data["reason"].(string))
+		}
+		return reasons
+	}
+
+	// 2024-01-03 是星期三，未开启 auto_update 时不处理
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local) }
+	p.tryAutoUpdate(at(3, 12, 0))
+	assert.Empty(t, deferred())
+
+	require.NoError(t, p.SetConfig(map[string]interface{}{"auto_update": true, "restart_delay": "1ms"}))
+	p.tryAutoUpdate(at(3, 12, 0))
+	p.tryAutoUpdate(at(3, 12, 1))
+	assert.Equal(t, []string{deferOutsideWindow}, deferred())
+	assert.Equal(t, at(4, 2, 0), agent.eventsOf("update_deferred")[0].Data["next_window"])
+
+	// 维护时间段内有计划任务在执行，时间段结束时仍未安装
+	p.tryAutoUpdate(at(4, 2, 30))
+	assert.Equal(t, 1, agent.eventsOf("update_deferred")[1].Data["running_tasks"])
+	p.tryAutoUpdate(at(4, 4, 0))
+	p.tryAutoUpdate(at(4, 5, 0))
+	assert.Equal(t, []string{deferOutsideWindow, deferTasksRunning, deferWindowMissed}, deferred())
+	assert.Equal(t, at(5, 2, 0), agent.eventsOf("update_deferred")[2].Data["next_window"])
+
+	// 有命令在执行时同样推迟，require_idle 为 false 时不检查
+	agent.mu.Lock()
+	agent.runningTasks, agent.commands = 0, 2
+	agent.mu.Unlock()
+	p.tryAutoUpdate(at(5, 2, 10))
+	assert.Equal(t, 2, agent.eventsOf("update_deferred")[3].Data["running_commands"])
+	data, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+
+	require.NoError(t, p.SetConfig(map[string]interface{}{"require_idle": false}))
+	p.tryAutoUpdate(at(5, 2, 11))
+	data, err = os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, binary, data)
+	require.Eventually(t, func() bool { return len(agent.eventsOf("update_restarting")) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, p.Status().Metrics["successful_updates"])
+
+	// 同一版本只自动安装一次
+	p.tryAutoUpdate(at(5, 2, 12))
+	assert.Equal(t, 1, p.Status().Metrics["successful_updates"])
+	assert.Len(t, agent.eventsOf("update_deferred"), 4)
+
+	assert.Error(t, p.ValidateConfig(map[string]interface{}{"maintenance_windows": "sat 02:00"}))
+}
+
+// restartingAgent 支持重启的模拟 Agent，记录重启请求但不执行 replace
+type restartingAgent struct {
+	*MockAgent
+	restarted bool
+}
+
+func (a *restartingAgent) Restart(replace func() error) error {
+	a.restarted = true
+	return nil
+}
+
+func TestRestartAgentStopsAgent(t *testing.T) {
+	agent := &restartingAgent{MockAgent: &MockAgent{}}
+	p := NewUpdaterPlugin()
+	require.NoError(t, p.Init(&plugin.PluginContext{Agent: agent, Logger: &plugintest.Logger{}}))
+
+	// exec 模式通过 Agent 重启，替换进程前先停止插件、保存状态
+	require.NoError(t, p.restartAgent(filepath.Join(t.TempDir(), "assistant_agent")))
+	assert.True(t, agent.restarted)
+
+	// Agent 不支持重启时不绕过 Agent 直接替换进程
+	p = NewUpdaterPlugin()
+	require.NoError(t, p.Init(&plugin.PluginContext{Agent: &MockAgent{}, Logger: &plugintest.Logger{}}))
+	assert.Error(t, p.restartAgent(filepath.Join(t.TempDir(), "assistant_agent")))
+}
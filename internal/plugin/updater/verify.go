@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// updatePublicKey 校验更新签名的 Ed25519 公钥（base64），构建时通过
+// -ldflags "-X assistant_agent/internal/plugin/updater.updatePublicKey=..." 嵌入
+var updatePublicKey string
+
+// signedContent 返回签名覆盖的内容，将版本和平台与文件摘要绑定，防止用其他版本或平台的合法文件替换
+func signedContent(update *UpdateInfo) []byte {
+	return []byte(update.Version + "\n" + platformKey() + "\n" + strings.ToLower(update.Checksum))
+}
+
+// fileSHA256 计算文件的 SHA-256（十六进制）
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifySignature 使用嵌入的公钥校验更新签名。构建时没有嵌入公钥的 Agent 拒绝安装，
+// 除非配置了 allow_unsigned（只用于开发环境）
+func (p *UpdaterPlugin) verifySignature(update *UpdateInfo) error {
+	if updatePublicKey == "" {
+		if p.configBool("allow_unsigned", false) {
+			p.ctx.Logger.Warnf("Installing update %s without signature verification", update.Version)
+			return nil
+		}
+		return fmt.Errorf("no update signing key is embedded in this build")
+	}
+	key, err := base64.StdEncoding.DecodeString(updatePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid embedded update signing key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(update.Signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), signedContent(update), signature) {
+		return fmt.Errorf("invalid signature for update %s", update.Version)
+	}
+	return nil
+}
+
+// verifyUpdate 校验文件的 SHA-256 与 UpdateInfo.Checksum 一致并校验签名
+func (p *UpdaterPlugin) verifyUpdate(path string, update *UpdateInfo) error {
+	if update.Checksum == "" {
+		return fmt.Errorf("update %s has no checksum", update.Version)
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if sum != strings.ToLower(update.Checksum) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", strings.ToLower(update.Checksum), sum)
+	}
+	return p.verifySignature(update)
+}
+
+// updateArg 解析命令参数中的更新信息，未提供时使用最近一次检查发现的更新
+func (p *UpdaterPlugin) updateArg(args map[string]interface{}) (*UpdateInfo, error) {
+	switch v := args["update"].(type) {
+	case *UpdateInfo:
+		return v, nil
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		update := &UpdateInfo{}
+		if err := json.Unmarshal(data, update); err != nil || update.Version == "" || update.URL == "" {
+			return nil, fmt.Errorf("invalid update info")
+		}
+		return update, nil
+	case nil:
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		if p.latest == nil {
+			return nil, fmt.Errorf("no update available, run check_update first")
+		}
+		return p.latest, nil
+	}
+	return nil, fmt.Errorf("invalid update info")
+}
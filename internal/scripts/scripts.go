@@ -0,0 +1,260 @@
+package scripts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/fsutil"
+)
+
+// LatestVersion 引用中表示最新版本的版本号
+const LatestVersion = "latest"
+
+// namePattern 脚本名称和版本号允许的字符，避免路径穿越
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Script 脚本库中的脚本
+type Script struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	Type        string    `json:"type"` // shell, powershell, interpreter
+	Interpreter string    `json:"interpreter,omitempty"`
+	Content     string    `json:"content"`
+	Checksum    string    `json:"checksum"` // 内容的 SHA-256 十六进制摘要
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Ref 返回脚本引用 name@version
+func (s *Script) Ref() string {
+	return s.Name + "@" + s.Version
+}
+
+// Verify 校验脚本内容与摘要是否一致
+func (s *Script) Verify() error {
+	if !strings.EqualFold(Checksum(s.Content), s.Checksum) {
+		return fmt.Errorf("checksum mismatch for script %s", s.Ref())
+	}
+	return nil
+}
+
+// Checksum 计算脚本内容的 SHA-256 摘要
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseRef 解析 name@version 格式的脚本引用，未指定版本时返回 latest
+func ParseRef(ref string) (string, string, error) {
+	name, version, found := strings.Cut(strings.TrimSpace(ref), "@")
+	if !found || version == "" {
+		version = LatestVersion
+	}
+	if !namePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid script name: %q", name)
+	}
+	if !namePattern.MatchString(version) {
+		return "", "", fmt.Errorf("invalid script version: %q", version)
+	}
+	return name, version, nil
+}
+
+// Store 脚本库，每个版本保存为 <dir>/<name>/<version>.json
+type Store struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewStore 创建脚本库
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Save 保存脚本，提供了 Checksum 时必须与内容一致，同名同版本的脚本会被覆盖
+func (s *Store) Save(script *Script) error {
+	if script == nil || !namePattern.MatchString(script.Name) {
+		return fmt.Errorf("invalid script name")
+	}
+	if !namePattern.MatchString(script.Version) || script.Version == LatestVersion {
+		return fmt.Errorf("invalid script version")
+	}
+	if script.Content == "" {
+		return fmt.Errorf("content is required")
+	}
+	if script.Type == "" {
+		script.Type = "shell"
+	}
+
+	if script.Checksum == "" {
+		script.Checksum = Checksum(script.Content)
+	} else if err := script.Verify(); err != nil {
+		return err
+	}
+	if script.CreatedAt.IsZero() {
+		script.CreatedAt = time.Now()
+	}
+
+	data, err := json.MarshalIndent(script, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal script: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(s.dir, script.Name), 0700); err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免读取到写了一半的脚本
+	path := s.path(script.Name, script.Version)
+	return fsutil.WriteFileAtomic(path, data, 0600)
+}
+
+// Get 获取脚本，version 为空或 latest 时返回最近保存的版本
+func (s *Store) Get(name, version string) (*Script, error) {
+	if version == "" {
+		version = LatestVersion
+	}
+	if !namePattern.MatchString(name) || !namePattern.MatchString(version) {
+		return nil, fmt.Errorf("invalid script reference: %s@%s", name, version)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if version == LatestVersion {
+		versions, err := s.versions(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("script not found: %s", name)
+		}
+		return versions[len(versions)-1], nil
+	}
+
+	script, err := s.load(s.path(name, version))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("script not found: %s@%s", name, version)
+	}
+	return script, err
+}
+
+// Resolve 按引用获取脚本并校验摘要，用于执行前
+func (s *Store) Resolve(ref string) (*Script, error) {
+	name, version, err := ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	script, err := s.Get(name, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := script.Verify(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// List 列出脚本库中所有脚本的全部版本（不含内容）
+func (s *Store) List() ([]*Script, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := make([]*Script, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		versions, err := s.versions(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		for _, script := range versions {
+			script.Content = ""
+			scripts = append(scripts, script)
+		}
+	}
+
+	return scripts, nil
+}
+
+// Delete 删除脚本，version 为空时删除全部版本
+func (s *Store) Delete(name, version string) error {
+	if !namePattern.MatchString(name) || (version != "" && !namePattern.MatchString(version)) {
+		return fmt.Errorf("invalid script reference: %s@%s", name, version)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version == "" {
+		return os.RemoveAll(filepath.Join(s.dir, name))
+	}
+
+	err := os.Remove(s.path(name, version))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("script not found: %s@%s", name, version)
+	}
+	return err
+}
+
+// versions 读取脚本的所有版本，按创建时间升序排列
+func (s *Store) versions(name string) ([]*Script, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, name, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := make([]*Script, 0, len(files))
+	for _, file := range files {
+		script, err := s.load(file)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, script)
+	}
+
+	sort.Slice(scripts, func(i, j int) bool {
+		return scripts[i].CreatedAt.Before(scripts[j].CreatedAt)
+	})
+	return scripts, nil
+}
+
+// load 读取脚本文件
+func (s *Store) load(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var script Script
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("failed to parse script %s: %v", filepath.Base(path), err)
+	}
+	return &script, nil
+}
+
+// path 返回脚本版本文件路径
+func (s *Store) path(name, version string) string {
+	return filepath.Join(s.dir, name, version+".json")
+}
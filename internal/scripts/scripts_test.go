@@ -0,0 +1,104 @@
+package scripts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRef(t *testing.T) {
+	name, version, err := ParseRef("backup@1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, "backup", name)
+	assert.Equal(t, "1.2.0", version)
+
+	name, version, err = ParseRef("backup")
+	require.NoError(t, err)
+	assert.Equal(t, "backup", name)
+	assert.Equal(t, LatestVersion, version)
+
+	_, _, err = ParseRef("../etc@1")
+	assert.Error(t, err)
+	_, _, err = ParseRef("backup@../1")
+	assert.Error(t, err)
+}
+
+func TestStoreSaveAndResolve(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	v1 := &Script{Name: "backup", Version: "1.0", Content: "echo v1", CreatedAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, store.Save(v1))
+	assert.Equal(t, "shell", v1.Type)
+	assert.Equal(t, Checksum("echo v1"), v1.Checksum)
+
+	v2 := &Script{Name: "backup", Version: "2.0", Content: "echo v2", Checksum: Checksum("echo v2")}
+	require.NoError(t, store.Save(v2))
+
+	script, err := store.Resolve("backup@1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "echo v1", script.Content)
+
+	// 未指定版本时返回最近保存的版本
+	script, err = store.Resolve("backup")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0", script.Version)
+
+	_, err = store.Resolve("backup@3.0")
+	assert.Error(t, err)
+	_, err = store.Resolve("missing")
+	assert.Error(t, err)
+
+	scripts, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, scripts, 2)
+	assert.Empty(t, scripts[0].Content)
+}
+
+func TestStoreChecksum(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+
+	// 摘要与内容不一致时拒绝保存
+	err = store.Save(&Script{Name: "deploy", Version: "1", Content: "echo hi", Checksum: "deadbeef"})
+	assert.Error(t, err)
+
+	require.NoError(t, store.Save(&Script{Name: "deploy", Version: "1", Content: "echo hi"}))
+
+	// 磁盘上的脚本被篡改后拒绝执行
+	path := filepath.Join(dir, "deploy", "1.json")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), "echo hi", "echo hacked", 1)), 0600))
+
+	_, err = store.Resolve("deploy@1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestStoreValidationAndDelete(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	assert.Error(t, store.Save(&Script{Name: "", Version: "1", Content: "x"}))
+	assert.Error(t, store.Save(&Script{Name: "a", Version: "latest", Content: "x"}))
+	assert.Error(t, store.Save(&Script{Name: "a", Version: "1"}))
+
+	require.NoError(t, store.Save(&Script{Name: "a", Version: "1", Content: "x"}))
+	require.NoError(t, store.Save(&Script{Name: "a", Version: "2", Content: "y"}))
+
+	require.NoError(t, store.Delete("a", "1"))
+	assert.Error(t, store.Delete("a", "1"))
+	_, err = store.Get("a", "2")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Delete("a", ""))
+	_, err = store.Get("a", "")
+	assert.Error(t, err)
+}
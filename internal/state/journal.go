@@ -0,0 +1,330 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"assistant_agent/internal/fsutil"
+	"assistant_agent/internal/logger"
+)
+
+// 日志记录类型
+const (
+	JournalStarted       = "agent_started"
+	JournalStopped       = "agent_stopped"
+	JournalConfigChanged = "config_changed"
+	JournalTasksChanged  = "tasks_changed"
+)
+
+// 日志落盘方式
+const (
+	SyncAlways   = "always"   // 每条记录写入后 fsync
+	SyncInterval = "interval" // 距上次 fsync 超过 journalSyncInterval 时 fsync，崩溃时可能丢失最后一秒的记录
+	SyncNone     = "none"     // 由操作系统决定何时落盘
+)
+
+const (
+	journalFile         = "journal.log"
+	journalSyncInterval = time.Second
+
+	// 日志超过 journalMaxEntries 条时压缩为最近的 journalKeepEntries 条
+	journalMaxEntries  = 10000
+	journalKeepEntries = 1000
+
+	// recoveryMaxEntries 恢复报告中最多包含的上次运行记录数
+	recoveryMaxEntries = 100
+)
+
+// JournalEntry 状态变化记录
+type JournalEntry struct {
+	Seq       int64                  `json:"seq"`
+	Timestamp time.Time              `json:"timestamp"`
+	Type      string                 `json:"type"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Recovery 上次运行的恢复信息，上次运行没有记录 agent_stopped 时视为崩溃
+type Recovery struct {
+	Crashed      bool            `json:"crashed"`
+	StartedAt    time.Time       `json:"started_at"`    // 上次启动时间
+	LastEntryAt  time.Time       `json:"last_entry_at"` // 最后一条记录的时间，接近崩溃时间
+	RunningTasks int             `json:"running_tasks"` // 最后记录的正在执行的任务数
+	TotalTasks   int             `json:"total_tasks"`
+	Entries      []*JournalEntry `json:"entries"` // 上次运行的记录，最多 recoveryMaxEntries 条
+}
+
+// Journal 只追加的状态变化日志（JSON Lines），用于崩溃后报告 Agent 当时在做什么
+type Journal struct {
+	path     string
+	file     *os.File
+	seq      int64
+	count    int
+	syncMode string
+	lastSync time.Time
+	dirty    bool
+	mu       sync.Mutex
+}
+
+// OpenJournal 打开日志文件，记录过多时先压缩
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{path: path, syncMode: SyncInterval}
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > journalMaxEntries {
+		entries = entries[len(entries)-journalKeepEntries:]
+		if err := j.rewrite(entries); err != nil {
+			return nil, err
+		}
+	}
+	if len(entries) > 0 {
+		j.seq = entries[len(entries)-1].Seq
+	}
+	j.count = len(entries)
+
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// SetSyncMode 设置落盘方式，不支持的方式返回错误
+func (j *Journal) SetSyncMode(mode string) error {
+	switch mode {
+	case SyncAlways, SyncInterval, SyncNone:
+	default:
+		return fmt.Errorf("invalid journal sync mode: %s", mode)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.syncMode = mode
+	return nil
+}
+
+// Append 追加一条记录
+func (j *Journal) Append(entryType string, data map[string]interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// Close 之后再次写入时重新打开
+	if j.file == nil {
+		if err := j.open(); err != nil {
+			return err
+		}
+	}
+
+	entry := &JournalEntry{Seq: j.seq + 1, Timestamp: time.Now().UTC(), Type: entryType, Data: data}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %v", err)
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	j.seq = entry.Seq
+	j.count++
+	j.dirty = true
+
+	if j.syncMode == SyncAlways || (j.syncMode == SyncInterval && time.Since(j.lastSync) >= journalSyncInterval) {
+		if err := j.sync(); err != nil {
+			return err
+		}
+	}
+
+	if j.count > journalMaxEntries {
+		if err := j.compact(); err != nil {
+			logger.Warnf("Failed to compact state journal: %v", err)
+		}
+	}
+	return nil
+}
+
+// Entries 读取全部记录，损坏的记录（如崩溃时写了一半的最后一行）跳过
+func (j *Journal) Entries() ([]*JournalEntry, error) {
+	file, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Warnf("Skipping corrupted state journal entry: %v", err)
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Recovery 根据日志生成上次运行的恢复信息，在本次启动记录 agent_started 之前调用，没有上次运行时返回 nil
+func (j *Journal) Recovery() (*Recovery, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	return recoveryFrom(entries), nil
+}
+
+// recoveryFrom 从最后一次 agent_started 开始整理上次运行的记录
+func recoveryFrom(entries []*JournalEntry) *Recovery {
+	start := -1
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Type == JournalStarted {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	run := entries[start:]
+	last := run[len(run)-1]
+	recovery := &Recovery{
+		Crashed:     last.Type != JournalStopped,
+		StartedAt:   run[0].Timestamp,
+		LastEntryAt: last.Timestamp,
+	}
+	for _, entry := range run {
+		if entry.Type == JournalTasksChanged {
+			recovery.RunningTasks = intValue(entry.Data["running"])
+			recovery.TotalTasks = intValue(entry.Data["total"])
+		}
+	}
+	if len(run) > recoveryMaxEntries {
+		run = run[len(run)-recoveryMaxEntries:]
+	}
+	recovery.Entries = run
+	return recovery
+}
+
+// Close 落盘并关闭日志
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.sync()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	j.file = nil
+	return err
+}
+
+// open 以追加方式打开日志文件
+func (j *Journal) open() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %v", err)
+	}
+	// 崩溃时写了一半的最后一行没有换行符，补上换行避免与新记录连在一起
+	if truncated, err := missingNewline(j.path); err == nil && truncated {
+		file.Write([]byte{'\n'})
+	}
+	j.file = file
+	return nil
+}
+
+// missingNewline 判断非空文件是否以换行符结尾
+func missingNewline(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+// sync 把未落盘的记录写入磁盘
+func (j *Journal) sync() error {
+	if !j.dirty {
+		return nil
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %v", err)
+	}
+	j.dirty = false
+	j.lastSync = time.Now()
+	return nil
+}
+
+// compact 保留最近 journalKeepEntries 条记录
+func (j *Journal) compact() error {
+	if err := j.sync(); err != nil {
+		return err
+	}
+	entries, err := j.Entries()
+	if err != nil {
+		return err
+	}
+	if len(entries) > journalKeepEntries {
+		entries = entries[len(entries)-journalKeepEntries:]
+	}
+	j.file.Close()
+	j.file = nil
+	if err := j.rewrite(entries); err != nil {
+		// 重写失败时继续追加到原文件
+		if openErr := j.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	j.count = len(entries)
+	return j.open()
+}
+
+// rewrite 通过临时文件加重命名原子地替换日志内容
+func (j *Journal) rewrite(entries []*JournalEntry) error {
+	return fsutil.WriteAtomic(fsutil.OS, j.path, 0644, func(w io.Writer) error {
+		for _, entry := range entries {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// intValue 读取 JSON 解码后的整数字段
+func intValue(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
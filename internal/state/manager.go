@@ -25,6 +25,8 @@ type Status struct {
 	MemoryUsage   float64                `json:"memory_usage"`
 	CPUUsage      float64                `json:"cpu_usage"`
 	DiskUsage     float64                `json:"disk_usage"`
+	Counters      map[string]float64     `json:"counters,omitempty"` // 累计计数，如执行的命令数，重启后继续累加
+	Gauges        map[string]float64     `json:"gauges,omitempty"`   // 最近一次设置的值
 }
 
 // Manager 状态管理器
@@ -33,10 +35,36 @@ type Manager struct {
 	status    *Status
 	mu        sync.RWMutex
 	startTime time.Time
+
+	journal  *Journal  // 状态变化日志，打开失败时为 nil
+	recovery *Recovery // 上次运行的恢复信息，启动时生成
+
+	// 写入存储时不持有 mu，saveMu 保证写入串行、较旧的快照不会覆盖较新的
+	saveMu    sync.Mutex
+	store     Store // Stop 之后为 nil，再次 Start 时重新打开
+	backend   string
+	saveTimer *time.Timer // 延迟保存的定时器，为 nil 表示没有待保存的变化
 }
 
-// NewManager 创建新的状态管理器
+// saveDelay 心跳、系统信息等频繁更新延迟合并保存的时间
+const saveDelay = 10 * time.Second
+
+// NewManager 创建使用 JSON 文件保存状态的状态管理器
 func NewManager(dataDir string) (*Manager, error) {
+	return NewManagerWithBackend(dataDir, BackendJSON)
+}
+
+// NewManagerWithBackend 创建状态管理器，backend 为 json 或 bolt。
+// 使用 bolt 时如果数据库中还没有状态，从已有的 status.json 迁移
+func NewManagerWithBackend(dataDir, backend string) (*Manager, error) {
+	switch backend {
+	case "":
+		backend = BackendJSON
+	case BackendJSON, BackendBolt:
+	default:
+		return nil, fmt.Errorf("unsupported state backend: %s", backend)
+	}
+
 	// 创建数据目录
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, err
@@ -49,53 +77,158 @@ func NewManager(dataDir string) (*Manager, error) {
 			Status:    "stopped",
 			StartTime: time.Now(),
 		},
+		backend: backend,
 	}
+	manager.openStore()
 
 	// 加载保存的状态
 	if err := manager.loadStatus(); err != nil {
 		logger.Warnf("Failed to load status: %v", err)
 	}
 
+	// 打开状态变化日志
+	journal, err := OpenJournal(filepath.Join(dataDir, journalFile))
+	if err != nil {
+		logger.Warnf("Failed to open state journal: %v", err)
+	} else {
+		manager.journal = journal
+	}
+
 	return manager, nil
 }
 
+// openStore 打开存储，调用方需持有 saveMu。
+// bolt 数据库被其他进程占用或损坏时退回 JSON 文件，不影响 Agent 启动
+func (m *Manager) openStore() {
+	jsonPath := filepath.Join(m.dataDir, statusFile)
+	if m.backend == BackendJSON {
+		m.store = &jsonStore{path: jsonPath}
+		return
+	}
+
+	store, err := openBoltStore(filepath.Join(m.dataDir, boltFile))
+	if err != nil {
+		logger.Warnf("%v, falling back to %s", err, statusFile)
+		m.store = &jsonStore{path: jsonPath}
+		return
+	}
+	m.store = store
+	if err := m.migrateJSON(); err != nil {
+		logger.Warnf("Failed to migrate status.json: %v", err)
+	}
+}
+
+// SetJournalSync 设置状态变化日志的落盘方式：always、interval 或 none
+func (m *Manager) SetJournalSync(mode string) error {
+	if m.journal == nil {
+		return nil
+	}
+	return m.journal.SetSyncMode(mode)
+}
+
+// Recovery 返回上次运行的恢复信息，Start 之前或没有上次运行的记录时为 nil
+func (m *Manager) Recovery() *Recovery {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.recovery
+}
+
+// RecordEvent 在状态变化日志中记录一条事件，如配置变更
+func (m *Manager) RecordEvent(entryType string, data map[string]interface{}) {
+	if m.journal == nil {
+		return
+	}
+	if err := m.journal.Append(entryType, data); err != nil {
+		logger.Warnf("Failed to record %s in state journal: %v", entryType, err)
+	}
+}
+
 // Start 启动状态管理器
 func (m *Manager) Start() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.saveMu.Lock()
+	if m.store == nil {
+		m.openStore()
+	}
+	m.saveMu.Unlock()
 
+	m.mu.Lock()
 	m.status.Status = "running"
 	m.status.StartTime = time.Now()
 	m.status.LastHeartbeat = time.Now()
+	version := m.status.Version
+	m.mu.Unlock()
 
 	if err := m.saveStatus(); err != nil {
 		return err
 	}
 
+	// 先根据日志判断上次运行是否正常退出，再记录本次启动
+	if m.journal != nil {
+		recovery, err := m.journal.Recovery()
+		if err != nil {
+			logger.Warnf("Failed to read state journal: %v", err)
+		}
+		m.mu.Lock()
+		m.recovery = recovery
+		m.mu.Unlock()
+		if recovery != nil && recovery.Crashed {
+			logger.Warnf("Previous run started at %s did not stop cleanly, last journal entry at %s",
+				recovery.StartedAt.Format(time.RFC3339), recovery.LastEntryAt.Format(time.RFC3339))
+		}
+		m.RecordEvent(JournalStarted, map[string]interface{}{
+			"version": version,
+			"pid":     os.Getpid(),
+		})
+	}
+
 	logger.Info("State manager started")
 	return nil
 }
 
-// Stop 停止状态管理器
+// Stop 停止状态管理器，保存状态后关闭存储
 func (m *Manager) Stop() {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	m.status.Status = "stopped"
-	m.saveStatus()
+	if m.saveTimer != nil {
+		m.saveTimer.Stop()
+		m.saveTimer = nil
+	}
+	m.mu.Unlock()
+
+	if err := m.saveStatus(); err != nil {
+		logger.Warnf("Failed to save status: %v", err)
+	}
+
+	m.saveMu.Lock()
+	if m.store != nil {
+		// 非 JSON 存储在停止时导出 status.json，供外部工具查看
+		if _, ok := m.store.(*jsonStore); !ok {
+			if err := m.exportJSON(filepath.Join(m.dataDir, statusFile)); err != nil {
+				logger.Warnf("Failed to export status.json: %v", err)
+			}
+		}
+		if err := m.store.Close(); err != nil {
+			logger.Warnf("Failed to close state store: %v", err)
+		}
+		m.store = nil
+	}
+	m.saveMu.Unlock()
+
+	if m.journal != nil {
+		m.RecordEvent(JournalStopped, nil)
+		if err := m.journal.Close(); err != nil {
+			logger.Warnf("Failed to close state journal: %v", err)
+		}
+	}
 
 	logger.Info("State manager stopped")
 }
 
-// GetStatus 获取当前状态
+// GetStatus 获取当前状态的副本，修改返回值不影响管理器
 func (m *Manager) GetStatus() *Status {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-
-	// 更新运行时间
-	m.status.Uptime = time.Since(m.startTime).Seconds()
-
-	return m.status
+	return m.snapshot()
 }
 
 // UpdateSystemInfo 更新系统信息
@@ -103,7 +236,27 @@ func (m *Manager) UpdateSystemInfo(info map[string]interface{}) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.status.SystemInfo = info
+	// 复制一份，调用方之后修改 info 不影响保存的状态
+	m.status.SystemInfo = make(map[string]interface{}, len(info))
+	m.applySystemInfo(info)
+}
+
+// MergeSystemInfo 合并部分系统信息（如心跳收集的资源使用率），保留其他字段
+func (m *Manager) MergeSystemInfo(info map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.status.SystemInfo == nil {
+		m.status.SystemInfo = make(map[string]interface{}, len(info))
+	}
+	m.applySystemInfo(info)
+}
+
+// applySystemInfo 写入系统信息并更新资源使用情况，调用方需持有锁
+func (m *Manager) applySystemInfo(info map[string]interface{}) {
+	for key, value := range info {
+		m.status.SystemInfo[key] = value
+	}
 	m.status.LastHeartbeat = time.Now()
 
 	// 更新资源使用情况
@@ -117,19 +270,22 @@ func (m *Manager) UpdateSystemInfo(info map[string]interface{}) {
 		m.status.DiskUsage = disk
 	}
 
-	m.saveStatus()
+	m.scheduleSave()
 }
 
-// UpdateTaskCount 更新任务计数
+// UpdateTaskCount 更新任务计数，计数变化时记录到状态变化日志
 func (m *Manager) UpdateTaskCount(running, total int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if running != m.status.RunningTasks || total != m.status.TotalTasks {
+		m.RecordEvent(JournalTasksChanged, map[string]interface{}{"running": running, "total": total})
+	}
 	m.status.RunningTasks = running
 	m.status.TotalTasks = total
 	m.status.LastHeartbeat = time.Now()
 
-	m.saveStatus()
+	m.scheduleSave()
 }
 
 // UpdateHeartbeat 更新心跳时间
@@ -138,69 +294,164 @@ func (m *Manager) UpdateHeartbeat() {
 	defer m.mu.Unlock()
 
 	m.status.LastHeartbeat = time.Now()
-	m.saveStatus()
+	m.scheduleSave()
 }
 
-// SetAgentID 设置 Agent ID
+// SetAgentID 设置 Agent ID，立即保存
 func (m *Manager) SetAgentID(id string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	m.status.AgentID = id
-	m.saveStatus()
+	m.mu.Unlock()
+
+	if err := m.saveStatus(); err != nil {
+		logger.Warnf("Failed to save status: %v", err)
+	}
 }
 
-// SetVersion 设置版本
+// GetAgentID 获取 Agent ID
+func (m *Manager) GetAgentID() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status.AgentID
+}
+
+// SetVersion 设置版本，立即保存
 func (m *Manager) SetVersion(version string) {
+	m.mu.Lock()
+	m.status.Version = version
+	m.mu.Unlock()
+
+	if err := m.saveStatus(); err != nil {
+		logger.Warnf("Failed to save status: %v", err)
+	}
+}
+
+// SetGauge 设置统计值，随状态摘要和心跳上报
+func (m *Manager) SetGauge(name string, value float64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.status.Version = version
-	m.saveStatus()
+	if m.status.Gauges == nil {
+		m.status.Gauges = make(map[string]float64)
+	}
+	m.status.Gauges[name] = value
+	m.scheduleSave()
 }
 
-// saveStatus 保存状态到文件
+// IncCounter 累加计数，负数忽略，随状态摘要和心跳上报
+func (m *Manager) IncCounter(name string, delta float64) {
+	if delta < 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.status.Counters == nil {
+		m.status.Counters = make(map[string]float64)
+	}
+	m.status.Counters[name] += delta
+	m.scheduleSave()
+}
+
+// scheduleSave 延迟 saveDelay 保存状态，期间的多次更新合并为一次写入，调用方需持有写锁
+func (m *Manager) scheduleSave() {
+	if m.saveTimer != nil {
+		return
+	}
+	m.saveTimer = time.AfterFunc(saveDelay, func() {
+		m.mu.Lock()
+		m.saveTimer = nil
+		m.mu.Unlock()
+		if err := m.saveStatus(); err != nil {
+			logger.Warnf("Failed to save status: %v", err)
+		}
+	})
+}
+
+// saveStatus 把当前状态的快照写入存储，写入期间不持有 mu，调用方不能持有 mu。Stop 之后不再写入
 func (m *Manager) saveStatus() error {
-	statusFile := filepath.Join(m.dataDir, "status.json")
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
 
-	data, err := json.MarshalIndent(m.status, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal status: %v", err)
+	if m.store == nil {
+		return nil
 	}
+	m.mu.RLock()
+	status := m.snapshot()
+	m.mu.RUnlock()
+	return m.store.Save(status)
+}
 
-	if err := os.WriteFile(statusFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write status file: %v", err)
+// snapshot 复制当前状态并计算运行时间，调用方需持有锁。
+// SystemInfo 只复制顶层，UpdateSystemInfo 和 MergeSystemInfo 只替换其中的值而不会原地修改
+func (m *Manager) snapshot() *Status {
+	status := *m.status
+	if m.status.SystemInfo != nil {
+		status.SystemInfo = make(map[string]interface{}, len(m.status.SystemInfo))
+		for key, value := range m.status.SystemInfo {
+			status.SystemInfo[key] = value
+		}
 	}
+	status.Counters = copyStats(m.status.Counters)
+	status.Gauges = copyStats(m.status.Gauges)
+	status.Uptime = time.Since(m.startTime).Seconds()
+	return &status
+}
 
-	return nil
+// copyStats 复制计数或统计值，nil 保持为 nil
+func copyStats(stats map[string]float64) map[string]float64 {
+	if stats == nil {
+		return nil
+	}
+	copied := make(map[string]float64, len(stats))
+	for name, value := range stats {
+		copied[name] = value
+	}
+	return copied
 }
 
-// loadStatus 从文件加载状态
+// loadStatus 从存储加载状态
 func (m *Manager) loadStatus() error {
-	statusFile := filepath.Join(m.dataDir, "status.json")
-
-	data, err := os.ReadFile(statusFile)
+	status, err := m.store.Load()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // 文件不存在，使用默认状态
-		}
-		return fmt.Errorf("failed to read status file: %v", err)
+		return err
 	}
+	if status != nil {
+		m.status = status
+	}
+	return nil
+}
 
-	var status Status
-	if err := json.Unmarshal(data, &status); err != nil {
-		return fmt.Errorf("failed to unmarshal status: %v", err)
+// migrateJSON 数据库中还没有状态时导入 status.json，保留 Agent ID 等信息
+func (m *Manager) migrateJSON() error {
+	existing, err := m.store.Load()
+	if err != nil || existing != nil {
+		return err
+	}
+	status, err := (&jsonStore{path: filepath.Join(m.dataDir, statusFile)}).Load()
+	if err != nil || status == nil {
+		return err
 	}
+	logger.Infof("Migrating %s to %s state backend", statusFile, m.backend)
+	return m.store.Save(status)
+}
 
-	m.status = &status
-	return nil
+// ExportJSON 以 JSON 格式导出当前状态
+func (m *Manager) ExportJSON() ([]byte, error) {
+	return json.MarshalIndent(m.GetStatus(), "", "  ")
+}
+
+// exportJSON 把当前状态写入 JSON 文件
+func (m *Manager) exportJSON(path string) error {
+	return (&jsonStore{path: path}).Save(m.GetStatus())
 }
 
 // GetStatusSummary 获取状态摘要
 func (m *Manager) GetStatusSummary() map[string]interface{} {
 	status := m.GetStatus()
 
-	return map[string]interface{}{
+	summary := map[string]interface{}{
 		"agent_id":       status.AgentID,
 		"version":        status.Version,
 		"status":         status.Status,
@@ -212,6 +463,13 @@ func (m *Manager) GetStatusSummary() map[string]interface{} {
 		"cpu_usage":      status.CPUUsage,
 		"disk_usage":     status.DiskUsage,
 	}
+	if len(status.Counters) > 0 {
+		summary["counters"] = status.Counters
+	}
+	if len(status.Gauges) > 0 {
+		summary["gauges"] = status.Gauges
+	}
+	return summary
 }
 
 // IsHealthy 检查 Agent 是否健康
@@ -1,8 +1,11 @@
 package state
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -101,6 +104,13 @@ func TestManagerUpdateSystemInfo(t *testing.T) {
 	cpuInfo := systemInfo["cpu_info"].(map[string]interface{})
 	assert.Equal(t, 4, cpuInfo["cores"])
 	assert.Equal(t, 25.5, cpuInfo["usage"])
+
+	// 合并心跳的资源使用率，保留其他字段
+	manager.MergeSystemInfo(map[string]interface{}{"cpu_usage": 12.5})
+	status = manager.GetStatus()
+	assert.Equal(t, "test-host", status.SystemInfo["hostname"])
+	assert.Equal(t, 12.5, status.SystemInfo["cpu_usage"])
+	assert.Equal(t, 12.5, status.CPUUsage)
 }
 
 func TestManagerUpdateTaskCount(t *testing.T) {
@@ -322,3 +332,248 @@ func TestManagerConcurrentAccess(t *testing.T) {
 	status := manager.GetStatus()
 	assert.Equal(t, "concurrent-agent", status.AgentID)
 }
+
+func TestJournal(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+
+	// 第一次启动没有上次运行的记录
+	manager, err := NewManager(dataDir)
+	require.NoError(t, err)
+	require.NoError(t, manager.SetJournalSync(SyncAlways))
+	assert.Error(t, manager.SetJournalSync("sometimes"))
+	require.NoError(t, manager.Start())
+	assert.Nil(t, manager.Recovery())
+
+	// 任务数变化时才记录，模拟崩溃：没有调用 Stop
+	manager.UpdateTaskCount(2, 5)
+	manager.UpdateTaskCount(2, 5)
+	manager.RecordEvent(JournalConfigChanged, map[string]interface{}{"plugin": "monitor", "keys": []string{"interval"}})
+	entries, err := manager.journal.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{JournalStarted, JournalTasksChanged, JournalConfigChanged},
+		[]string{entries[0].Type, entries[1].Type, entries[2].Type})
+	assert.Equal(t, int64(3), entries[2].Seq)
+
+	// 崩溃时写了一半的记录被跳过，之后的记录不受影响
+	manager.journal.Close()
+	file, err := os.OpenFile(filepath.Join(dataDir, journalFile), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	file.WriteString(`{"seq": 4, "type": "tasks_ch`)
+	file.Close()
+
+	manager, err = NewManager(dataDir)
+	require.NoError(t, err)
+	require.NoError(t, manager.Start())
+	recovery := manager.Recovery()
+	require.NotNil(t, recovery)
+	assert.True(t, recovery.Crashed)
+	assert.Equal(t, 2, recovery.RunningTasks)
+	assert.Equal(t, 5, recovery.TotalTasks)
+	assert.Len(t, recovery.Entries, 3)
+	entries, err = manager.journal.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, JournalStarted, entries[3].Type)
+	assert.Equal(t, int64(4), entries[3].Seq)
+
+	// 正常停止后不算崩溃
+	manager.Stop()
+	manager, err = NewManager(dataDir)
+	require.NoError(t, err)
+	require.NoError(t, manager.Start())
+	require.NotNil(t, manager.Recovery())
+	assert.False(t, manager.Recovery().Crashed)
+	manager.Stop()
+
+	// 记录过多时压缩为最近的记录
+	path := filepath.Join(t.TempDir(), journalFile)
+	journal, err := OpenJournal(path)
+	require.NoError(t, err)
+	require.NoError(t, journal.SetSyncMode(SyncNone))
+	for i := 0; i <= journalMaxEntries; i++ {
+		require.NoError(t, journal.Append(JournalTasksChanged, nil))
+	}
+	require.NoError(t, journal.Close())
+	entries, err = journal.Entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, journalKeepEntries)
+	assert.Equal(t, int64(journalMaxEntries+1), entries[len(entries)-1].Seq)
+}
+
+func TestStateBackend(t *testing.T) {
+	// 频繁更新延迟合并保存
+	dataDir := filepath.Join(t.TempDir(), "data")
+	manager, err := NewManager(dataDir)
+	require.NoError(t, err)
+	manager.UpdateTaskCount(1, 2)
+	manager.UpdateHeartbeat()
+	assert.NoFileExists(t, filepath.Join(dataDir, statusFile))
+	manager.mu.RLock()
+	assert.NotNil(t, manager.saveTimer)
+	manager.mu.RUnlock()
+	manager.SetAgentID("agent-json")
+	assert.FileExists(t, filepath.Join(dataDir, statusFile))
+	manager.Stop()
+
+	// bolt 后端从已有的 status.json 迁移
+	manager, err = NewManagerWithBackend(dataDir, BackendBolt)
+	require.NoError(t, err)
+	assert.Equal(t, "agent-json", manager.GetAgentID())
+	assert.FileExists(t, filepath.Join(dataDir, boltFile))
+
+	// 运行期间不写 status.json，停止时导出
+	require.NoError(t, os.Remove(filepath.Join(dataDir, statusFile)))
+	require.NoError(t, manager.Start())
+	manager.SetAgentID("agent-bolt")
+	assert.NoFileExists(t, filepath.Join(dataDir, statusFile))
+	manager.Stop()
+	exported, err := (&jsonStore{path: filepath.Join(dataDir, statusFile)}).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "agent-bolt", exported.AgentID)
+	assert.Equal(t, "stopped", exported.Status)
+
+	// 状态从数据库加载，不再读取 status.json
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, statusFile), []byte(`{"agent_id": "stale"}`), 0644))
+	manager, err = NewManagerWithBackend(dataDir, BackendBolt)
+	require.NoError(t, err)
+	assert.Equal(t, "agent-bolt", manager.GetAgentID())
+	data, err := manager.ExportJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"agent_id": "agent-bolt"`)
+
+	// 数据库被占用时退回 JSON
+	locked, err := NewManagerWithBackend(dataDir, BackendBolt)
+	require.NoError(t, err)
+	assert.IsType(t, &jsonStore{}, locked.store)
+	manager.Stop()
+
+	_, err = NewManagerWithBackend(dataDir, "sqlite")
+	assert.Error(t, err)
+}
+
+func TestStatusSnapshot(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	manager, err := NewManager(dataDir)
+	require.NoError(t, err)
+
+	// 修改返回的状态和传入的系统信息不影响管理器
+	info := map[string]interface{}{"hostname": "web-01"}
+	manager.UpdateSystemInfo(info)
+	info["hostname"] = "changed"
+	status := manager.GetStatus()
+	status.AgentID = "changed"
+	status.SystemInfo["extra"] = true
+	status = manager.GetStatus()
+	assert.Equal(t, "", status.AgentID)
+	assert.Equal(t, map[string]interface{}{"hostname": "web-01"}, status.SystemInfo)
+
+	// 并发读写和保存
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				manager.UpdateSystemInfo(map[string]interface{}{"cpu_usage": float64(i)})
+				manager.SetAgentID(fmt.Sprintf("agent-%d", i))
+				_ = manager.GetStatus().Uptime
+				_ = manager.GetStatusSummary()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 原子写入不留下临时文件，残留的临时文件不影响加载
+	require.NoError(t, manager.saveStatus())
+	assert.NoFileExists(t, filepath.Join(dataDir, statusFile+".tmp"))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, statusFile+".tmp"), []byte(`{"agent_id":`), 0644))
+	loaded, err := NewManager(dataDir)
+	require.NoError(t, err)
+	assert.Equal(t, manager.GetAgentID(), loaded.GetAgentID())
+
+	// bolt 存储停止后可以再次启动
+	manager, err = NewManagerWithBackend(dataDir, BackendBolt)
+	require.NoError(t, err)
+	require.NoError(t, manager.Start())
+	manager.Stop()
+	require.NoError(t, manager.Start())
+	manager.SetAgentID("agent-restarted")
+	manager.Stop()
+	manager, err = NewManagerWithBackend(dataDir, BackendBolt)
+	require.NoError(t, err)
+	assert.Equal(t, "agent-restarted", manager.GetAgentID())
+	manager.Stop()
+}
+
+func TestCountersAndGauges(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	manager, err := NewManager(dataDir)
+	require.NoError(t, err)
+
+	summary := manager.GetStatusSummary()
+	assert.NotContains(t, summary, "counters")
+	assert.NotContains(t, summary, "gauges")
+
+	manager.IncCounter("commands_executed", 1)
+	manager.IncCounter("commands_executed", 2)
+	manager.IncCounter("commands_executed", -5) // 负数忽略
+	manager.SetGauge("queue_length", 4)
+	manager.SetGauge("queue_length", 2)
+
+	summary = manager.GetStatusSummary()
+	assert.Equal(t, map[string]float64{"commands_executed": 3}, summary["counters"])
+	assert.Equal(t, map[string]float64{"queue_length": 2}, summary["gauges"])
+
+	// 返回的是副本
+	summary["counters"].(map[string]float64)["commands_executed"] = 100
+	assert.Equal(t, float64(3), manager.GetStatus().Counters["commands_executed"])
+
+	// 计数持久化，重启后继续累加
+	manager.Stop()
+	manager, err = NewManager(dataDir)
+	require.NoError(t, err)
+	manager.IncCounter("commands_executed", 1)
+	status := manager.GetStatus()
+	assert.Equal(t, float64(4), status.Counters["commands_executed"])
+	assert.Equal(t, float64(2), status.Gauges["queue_length"])
+}
+
+func TestSettings(t *testing.T) {
+	dir := t.TempDir()
+	settings, err := OpenSettings(dir)
+	require.NoError(t, err)
+	assert.Nil(t, settings.Get("scheduler.last_run"))
+
+	// 值经过 JSON 编解码
+	value, changed, err := settings.Set("monitor.thresholds", map[string]int{"cpu": 90})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]interface{}{"cpu": 90.0}, value)
+	_, changed, err = settings.Set("monitor.thresholds", map[string]interface{}{"cpu": 90.0})
+	require.NoError(t, err)
+	assert.False(t, changed)
+	_, _, err = settings.Set("scheduler.last_run", "2024-01-01")
+	require.NoError(t, err)
+
+	// 无效的键和无法序列化的值
+	_, _, err = settings.Set("", 1)
+	assert.Error(t, err)
+	_, _, err = settings.Set(" padded", 1)
+	assert.Error(t, err)
+	_, _, err = settings.Set("bad", make(chan int))
+	assert.Error(t, err)
+	_, _, err = settings.Set("large", strings.Repeat("x", maxSettingSize))
+	assert.Error(t, err)
+
+	// 重新打开后保留，nil 删除
+	reopened, err := OpenSettings(dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"monitor.thresholds": map[string]interface{}{"cpu": 90.0}, "scheduler.last_run": "2024-01-01"}, reopened.All())
+	_, changed, err = reopened.Set("scheduler.last_run", nil)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	reopened, err = OpenSettings(dir)
+	require.NoError(t, err)
+	assert.Nil(t, reopened.Get("scheduler.last_run"))
+}
@@ -0,0 +1,125 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"assistant_agent/internal/fsutil"
+)
+
+const (
+	settingsFile = "settings.json"
+
+	// maxSettingSize 单个值序列化后的最大字节数，动态配置只用于保存少量设置
+	maxSettingSize = 64 * 1024
+	// maxSettings 最多保存的键数
+	maxSettings = 1000
+)
+
+// Settings 插件等通过 SetConfig 写入的动态配置，以 JSON 保存在数据目录下的 settings.json
+type Settings struct {
+	path   string
+	values map[string]interface{}
+	mu     sync.RWMutex
+}
+
+// OpenSettings 读取数据目录下保存的动态配置，文件不存在时为空
+func OpenSettings(dataDir string) (*Settings, error) {
+	s := &Settings{path: filepath.Join(dataDir, settingsFile), values: map[string]interface{}{}}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read settings: %v", err)
+	}
+	if err := json.Unmarshal(data, &s.values); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal settings: %v", err)
+	}
+	if s.values == nil {
+		s.values = map[string]interface{}{}
+	}
+	return s, nil
+}
+
+// Get 读取动态配置，不存在时返回 nil
+func (s *Settings) Get(key string) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[key]
+}
+
+// All 返回全部动态配置的副本
+func (s *Settings) All() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]interface{}, len(s.values))
+	for key, value := range s.values {
+		result[key] = value
+	}
+	return result
+}
+
+// Set 写入动态配置并保存，value 为 nil 时删除。值经过 JSON 编解码，重启前后读到的类型一致。
+// 返回解码后的值以及值是否发生变化
+func (s *Settings) Set(key string, value interface{}) (interface{}, bool, error) {
+	if key == "" || strings.TrimSpace(key) != key {
+		return nil, false, fmt.Errorf("invalid setting key: %q", key)
+	}
+
+	var decoded interface{}
+	if value != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("setting %s is not serializable: %v", key, err)
+		}
+		if len(data) > maxSettingSize {
+			return nil, false, fmt.Errorf("setting %s exceeds %d bytes", key, maxSettingSize)
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return nil, false, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.values[key]
+	if decoded == nil && !exists {
+		return nil, false, nil
+	}
+	if exists && reflect.DeepEqual(current, decoded) {
+		return decoded, false, nil
+	}
+	if !exists && len(s.values) >= maxSettings {
+		return nil, false, fmt.Errorf("too many settings (max %d)", maxSettings)
+	}
+
+	values := make(map[string]interface{}, len(s.values)+1)
+	for k, v := range s.values {
+		values[k] = v
+	}
+	if decoded == nil {
+		delete(values, key)
+	} else {
+		values[key] = decoded
+	}
+
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal settings: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, false, err
+	}
+	if err := fsutil.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return nil, false, fmt.Errorf("failed to write settings: %v", err)
+	}
+	s.values = values
+	return decoded, true, nil
+}
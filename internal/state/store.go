@@ -0,0 +1,123 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"assistant_agent/internal/fsutil"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 状态存储后端
+const (
+	BackendJSON = "json" // 每次保存重写 status.json
+	BackendBolt = "bolt" // bbolt 数据库 state.db，status.json 只在停止时导出
+)
+
+const (
+	statusFile = "status.json"
+	boltFile   = "state.db"
+)
+
+var (
+	statusBucket = []byte("state")
+	statusKey    = []byte("status")
+)
+
+// Store 状态持久化接口
+type Store interface {
+	// Load 读取保存的状态，没有保存过时返回 nil
+	Load() (*Status, error)
+	Save(status *Status) error
+	Close() error
+}
+
+// jsonStore 以 JSON 文件保存状态
+type jsonStore struct {
+	path string
+}
+
+func (s *jsonStore) Load() (*Status, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read status file: %v", err)
+	}
+
+	var status Status
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal status: %v", err)
+	}
+	return &status, nil
+}
+
+func (s *jsonStore) Save(status *Status) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %v", err)
+	}
+	if err := fsutil.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write status file: %v", err)
+	}
+	return nil
+}
+
+func (s *jsonStore) Close() error {
+	return nil
+}
+
+// boltStore 以 bbolt 数据库保存状态，只改写变化的页，减少闪存设备上的写放大
+type boltStore struct {
+	db *bolt.DB
+}
+
+// openBoltStore 打开 bbolt 数据库，另一个进程持有数据库时等待一秒后失败
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database: %v", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(statusBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize state database: %v", err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Load() (*Status, error) {
+	var status *Status
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(statusBucket).Get(statusKey)
+		if data == nil {
+			return nil
+		}
+		status = &Status{}
+		return json.Unmarshal(data, status)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load status: %v", err)
+	}
+	return status, nil
+}
+
+func (s *boltStore) Save(status *Status) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %v", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(statusBucket).Put(statusKey, data)
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
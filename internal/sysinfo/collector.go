@@ -3,13 +3,16 @@ package sysinfo
 import (
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
 )
 
 // SystemInfo 系统信息结构（简化版）
@@ -25,9 +28,22 @@ type SystemInfo struct {
 	CPU    CPUInfo    `json:"cpu"`
 	Memory MemoryInfo `json:"memory"`
 	Disk   DiskInfo   `json:"disk"`
+	GPUs   []GPUInfo  `json:"gpus"`
+
+	// 资产信息
+	Inventory InventoryInfo `json:"inventory"`
+
+	// 容器信息，只在容器模式下收集
+	Container *ContainerInfo `json:"container,omitempty"`
+
+	// 网络环境，只在开启 network_env 时收集
+	NetworkEnv *NetworkEnv `json:"network_env,omitempty"`
 
 	// 网络信息
-	Network NetworkInfo `json:"network"`
+	Network        NetworkInfo      `json:"network"`
+	NetworkStats   []InterfaceStats `json:"network_stats"`
+	Connections    map[string]int   `json:"connections"` // TCP 连接数，按状态统计
+	ListeningPorts []ListeningPort  `json:"listening_ports"`
 
 	// 系统状态
 	Uptime      float64   `json:"uptime"`
@@ -90,6 +106,32 @@ type InterfaceInfo struct {
 type Collector struct {
 	lastCPUUsage float64
 	lastCPUTime  time.Time
+
+	procMu      sync.Mutex
+	procSamples map[int32]processSample // 进程 CPU 时间的上次采样
+
+	netMu       sync.Mutex
+	netSamples  map[string]net.IOCountersStat // 网络接口计数的上次采样
+	netSampleAt time.Time
+
+	invMu       sync.Mutex
+	inventory   *InventoryInfo // 缓存的资产信息
+	inventoryAt time.Time
+
+	containerMode bool
+	containerMu   sync.Mutex
+	cgroupCPU     float64 // cgroup 累计 CPU 时间的上次采样（秒）
+	cgroupCPUAt   time.Time
+
+	netEnvMu      sync.Mutex
+	netEnvEnabled bool
+	publicIPURL   string
+	netEnv        *NetworkEnv // 缓存的网络环境
+	netEnvAt      time.Time
+
+	gpuMu sync.Mutex
+	gpus  []GPUInfo // 缓存的 Windows、macOS 显卡列表
+	gpuAt time.Time
 }
 
 // NewCollector 创建新的收集器
@@ -99,6 +141,11 @@ func NewCollector() (*Collector, error) {
 	}, nil
 }
 
+// SetContainerMode 设置是否运行在容器内，开启后 CPU 和内存使用率以 cgroup 限制为准
+func (c *Collector) SetContainerMode(enabled bool) {
+	c.containerMode = enabled
+}
+
 // Collect 收集系统信息
 func (c *Collector) Collect() (map[string]interface{}, error) {
 	info := &SystemInfo{}
@@ -118,6 +165,11 @@ func (c *Collector) Collect() (map[string]interface{}, error) {
 		return nil, err
 	}
 
+	// 收集容器信息
+	if err := c.collectContainerInfo(info); err != nil {
+		return nil, err
+	}
+
 	// 收集磁盘信息
 	if err := c.collectDiskInfo(info); err != nil {
 		return nil, err
@@ -128,6 +180,26 @@ func (c *Collector) Collect() (map[string]interface{}, error) {
 		return nil, err
 	}
 
+	// 收集网络流量、连接和监听端口
+	if err := c.collectNetworkStats(info); err != nil {
+		return nil, err
+	}
+
+	// 收集 GPU 信息
+	if err := c.collectGPUInfo(info); err != nil {
+		return nil, err
+	}
+
+	// 收集资产信息
+	if err := c.collectInventory(info); err != nil {
+		return nil, err
+	}
+
+	// 收集网络环境
+	if err := c.collectNetworkEnv(info); err != nil {
+		return nil, err
+	}
+
 	// 转换为 map（简化输出）
 	result := map[string]interface{}{
 		"hostname":     info.Hostname,
@@ -146,11 +218,78 @@ func (c *Collector) Collect() (map[string]interface{}, error) {
 		"memory_info":  info.Memory,
 		"disk_info":    info.Disk,
 		"network_info": info.Network,
+		"gpu_info":     info.GPUs,
+		"inventory":    info.Inventory,
+
+		"network_stats":   info.NetworkStats,
+		"connections":     info.Connections,
+		"listening_ports": info.ListeningPorts,
+	}
+	if info.Container != nil {
+		result["container"] = info.Container
+	}
+	if info.NetworkEnv != nil {
+		result["network_env"] = info.NetworkEnv
 	}
 
 	return result, nil
 }
 
+// CollectSummary 只收集心跳需要的 CPU、内存、磁盘使用率、负载、进程数和运行时间，
+// 不执行 Collect 中 GPU、资产、网络连接等耗时的收集
+func (c *Collector) CollectSummary() (map[string]interface{}, error) {
+	info := &SystemInfo{}
+	if err := c.collectBasicInfo(info); err != nil {
+		return nil, err
+	}
+	if err := c.collectCPUUsage(info); err != nil {
+		return nil, err
+	}
+	if err := c.collectMemoryInfo(info); err != nil {
+		return nil, err
+	}
+	if err := c.collectContainerInfo(info); err != nil {
+		return nil, err
+	}
+	c.collectDiskUsage(info)
+
+	return map[string]interface{}{
+		"cpu_usage":    info.CPU.Usage,
+		"memory_usage": info.Memory.Usage,
+		"disk_usage":   info.Disk.Usage,
+		"load_average": info.LoadAverage,
+		"processes":    info.Processes,
+		"uptime":       info.Uptime,
+	}, nil
+}
+
+// staticKeys Collect 结果中很少变化的字段，上报时只在变化后发送
+var staticKeys = map[string]bool{
+	"hostname":     true,
+	"os":           true,
+	"architecture": true,
+	"platform":     true,
+	"kernel":       true,
+	"boot_time":    true,
+	"network_info": true,
+	"inventory":    true,
+	"network_env":  true,
+}
+
+// SplitStatic 把 Collect 的结果拆分为静态信息和动态信息
+func SplitStatic(info map[string]interface{}) (static, dynamic map[string]interface{}) {
+	static = make(map[string]interface{})
+	dynamic = make(map[string]interface{})
+	for key, value := range info {
+		if staticKeys[key] {
+			static[key] = value
+		} else {
+			dynamic[key] = value
+		}
+	}
+	return static, dynamic
+}
+
 // collectBasicInfo 收集基本信息
 func (c *Collector) collectBasicInfo(info *SystemInfo) error {
 	// 主机名
@@ -191,14 +330,9 @@ func (c *Collector) collectBasicInfo(info *SystemInfo) error {
 
 // collectCPUInfo 收集 CPU 信息
 func (c *Collector) collectCPUInfo(info *SystemInfo) error {
-	// CPU 使用率
-	usage, err := cpu.Percent(0, false)
-	if err != nil {
+	if err := c.collectCPUUsage(info); err != nil {
 		return err
 	}
-	if len(usage) > 0 {
-		info.CPU.Usage = usage[0]
-	}
 
 	// CPU 信息
 	cpuInfo, err := cpu.Info()
@@ -214,6 +348,18 @@ func (c *Collector) collectCPUInfo(info *SystemInfo) error {
 	return nil
 }
 
+// collectCPUUsage 收集 CPU 使用率（与上次采样之间的平均值）
+func (c *Collector) collectCPUUsage(info *SystemInfo) error {
+	usage, err := cpu.Percent(0, false)
+	if err != nil {
+		return err
+	}
+	if len(usage) > 0 {
+		info.CPU.Usage = usage[0]
+	}
+	return nil
+}
+
 // collectMemoryInfo 收集内存信息
 func (c *Collector) collectMemoryInfo(info *SystemInfo) error {
 	// 虚拟内存
@@ -230,13 +376,7 @@ func (c *Collector) collectMemoryInfo(info *SystemInfo) error {
 
 // collectDiskInfo 收集磁盘信息
 func (c *Collector) collectDiskInfo(info *SystemInfo) error {
-	// 磁盘使用情况
-	if diskStat, err := disk.Usage("/"); err == nil {
-		info.Disk.Total = diskStat.Total
-		info.Disk.Used = diskStat.Used
-		info.Disk.Free = diskStat.Free
-		info.Disk.Usage = diskStat.UsedPercent
-	}
+	c.collectDiskUsage(info)
 
 	// 分区信息（只收集主要分区）
 	if partitions, err := disk.Partitions(false); err == nil {
@@ -265,6 +405,16 @@ func (c *Collector) collectDiskInfo(info *SystemInfo) error {
 	return nil
 }
 
+// collectDiskUsage 收集根分区的使用情况
+func (c *Collector) collectDiskUsage(info *SystemInfo) {
+	if diskStat, err := disk.Usage("/"); err == nil {
+		info.Disk.Total = diskStat.Total
+		info.Disk.Used = diskStat.Used
+		info.Disk.Free = diskStat.Free
+		info.Disk.Usage = diskStat.UsedPercent
+	}
+}
+
 // collectNetworkInfo 收集网络信息
 func (c *Collector) collectNetworkInfo(info *SystemInfo) error {
 	// 网络接口
@@ -291,21 +441,29 @@ func (c *Collector) collectNetworkInfo(info *SystemInfo) error {
 	return nil
 }
 
-// getKernelVersion 获取内核版本
+// getKernelVersion 获取内核版本，Windows 上为系统版本号（如 10.0.19045 Build 19045），获取失败时为操作系统名称
 func (c *Collector) getKernelVersion() (string, error) {
-	// 这里可以实现获取内核版本的逻辑
-	// 不同操作系统有不同的实现方式
-	return runtime.GOOS, nil
+	version, err := host.KernelVersion()
+	if err != nil || version == "" {
+		return runtime.GOOS, nil
+	}
+	return version, nil
 }
 
 // getProcessCount 获取进程数
 func (c *Collector) getProcessCount() (int, error) {
-	// 这里可以实现获取进程数的逻辑
-	return 0, nil
+	pids, err := process.Pids()
+	if err != nil {
+		return 0, err
+	}
+	return len(pids), nil
 }
 
-// getLoadAverage 获取负载平均值
+// getLoadAverage 获取 1、5、15 分钟负载平均值，Windows 上由 gopsutil 根据处理器队列长度估算，启动后需要一段时间才有值
 func (c *Collector) getLoadAverage() ([]float64, error) {
-	// 这里可以实现获取负载平均值的逻辑
-	return []float64{0, 0, 0}, nil
+	avg, err := load.Avg()
+	if err != nil {
+		return nil, err
+	}
+	return []float64{avg.Load1, avg.Load5, avg.Load15}, nil
 }
@@ -0,0 +1,247 @@
+package sysinfo
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupUnlimited cgroup v1 中不限制内存时 memory.limit_in_bytes 的近似值，超过时视为不限制
+const cgroupUnlimited = 1 << 62
+
+// containerIDPattern cgroup 路径和 mountinfo 中的 64 位十六进制容器 ID
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerRuntimes cgroup 路径中的关键字到容器运行时的映射，按顺序匹配
+var containerRuntimes = []struct{ marker, runtime string }{
+	{"libpod", "podman"},
+	{"crio", "cri-o"},
+	{"cri-containerd", "containerd"},
+	{"containerd", "containerd"},
+	{"docker", "docker"},
+	{"kubepods", "kubernetes"},
+	{"lxc", "lxc"},
+}
+
+// ContainerInfo 容器内运行时的 cgroup 限制和使用情况，没有限制的字段为空
+type ContainerInfo struct {
+	Runtime       string   `json:"runtime,omitempty"` // docker、podman、containerd、cri-o、kubernetes 或 lxc
+	ID            string   `json:"id,omitempty"`
+	CgroupVersion int      `json:"cgroup_version,omitempty"`
+	CPUQuota      *float64 `json:"cpu_quota,omitempty"` // 可用的 CPU 核数
+	CPUUsage      float64  `json:"cpu_usage"`           // 相对于 CPU 配额（没有配额时为全部 CPU）的百分比
+	MemoryLimit   uint64   `json:"memory_limit,omitempty"`
+	MemoryUsage   uint64   `json:"memory_usage"` // 不含可回收的文件缓存，与 docker stats 一致
+	MemoryPercent float64  `json:"memory_percent,omitempty"`
+}
+
+// cgroupStats 从 cgroup 文件读取的原始数据
+type cgroupStats struct {
+	version     int
+	cpuQuota    float64 // 核数，0 表示不限制
+	cpuUsage    float64 // 累计 CPU 时间（秒）
+	memoryLimit uint64  // 0 表示不限制
+	memoryUsage uint64
+}
+
+// collectContainerInfo 容器模式下收集 cgroup 限制，并用容器范围的数值替换主机的 CPU 和内存使用率
+func (c *Collector) collectContainerInfo(info *SystemInfo) error {
+	if !c.containerMode || runtime.GOOS != "linux" {
+		return nil
+	}
+
+	container := &ContainerInfo{}
+	cgroupFile, _ := os.ReadFile("/proc/self/cgroup")
+	mountinfo, _ := os.ReadFile("/proc/self/mountinfo")
+	container.Runtime, container.ID = detectContainer(string(cgroupFile), string(mountinfo))
+	if container.Runtime == "" {
+		if _, err := os.Stat("/.dockerenv"); err == nil {
+			container.Runtime = "docker"
+		} else if _, err := os.Stat("/run/.containerenv"); err == nil {
+			container.Runtime = "podman"
+		}
+	}
+
+	stats := readCgroupStats(cgroupRoot, string(cgroupFile))
+	container.CgroupVersion = stats.version
+	cores := float64(runtime.NumCPU())
+	if stats.cpuQuota > 0 {
+		quota := stats.cpuQuota
+		container.CPUQuota = &quota
+		cores = min(cores, quota)
+	}
+
+	now := time.Now()
+	c.containerMu.Lock()
+	if !c.cgroupCPUAt.IsZero() && stats.cpuUsage >= c.cgroupCPU {
+		if elapsed := now.Sub(c.cgroupCPUAt).Seconds(); elapsed > 0 {
+			container.CPUUsage = min((stats.cpuUsage-c.cgroupCPU)/elapsed/cores*100, 100)
+		}
+	}
+	c.cgroupCPU, c.cgroupCPUAt = stats.cpuUsage, now
+	c.containerMu.Unlock()
+	info.CPU.Usage = container.CPUUsage
+
+	container.MemoryUsage = stats.memoryUsage
+	if stats.memoryLimit > 0 {
+		container.MemoryLimit = stats.memoryLimit
+		container.MemoryPercent = float64(stats.memoryUsage) / float64(stats.memoryLimit) * 100
+		// 内存限制小于主机内存时，内存信息以容器限制为准
+		if info.Memory.Total == 0 || stats.memoryLimit < info.Memory.Total {
+			info.Memory.Total = stats.memoryLimit
+			info.Memory.Used = min(stats.memoryUsage, stats.memoryLimit)
+			info.Memory.Free = stats.memoryLimit - info.Memory.Used
+			info.Memory.Available = info.Memory.Free
+			info.Memory.Usage = container.MemoryPercent
+		}
+	}
+
+	info.Container = container
+	return nil
+}
+
+// detectContainer 根据 /proc/self/cgroup 和 /proc/self/mountinfo 判断容器运行时和容器 ID。
+// 使用 cgroup 命名空间时 cgroup 路径为 /，此时从 mountinfo 中 /etc/hostname 等文件的来源路径查找 ID
+func detectContainer(cgroupFile, mountinfo string) (runtimeName, id string) {
+	for _, line := range strings.Split(cgroupFile, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		path := parts[2]
+		for _, r := range containerRuntimes {
+			if strings.Contains(path, r.marker) {
+				if runtimeName == "" {
+					runtimeName = r.runtime
+				}
+				break
+			}
+		}
+		if id == "" {
+			id = containerIDPattern.FindString(path)
+		}
+	}
+	if id == "" {
+		for _, line := range strings.Split(mountinfo, "\n") {
+			if !strings.Contains(line, "/etc/hostname") && !strings.Contains(line, "/etc/hosts") {
+				continue
+			}
+			if match := containerIDPattern.FindString(line); match != "" {
+				id = match
+				if runtimeName == "" {
+					for _, r := range containerRuntimes {
+						if strings.Contains(line, r.marker) {
+							runtimeName = r.runtime
+							break
+						}
+					}
+				}
+				break
+			}
+		}
+	}
+	return runtimeName, id
+}
+
+// readCgroupStats 读取当前进程所在 cgroup 的 CPU 配额、CPU 时间和内存，root 为 cgroup 挂载点
+func readCgroupStats(root, cgroupFile string) cgroupStats {
+	paths := map[string]string{}
+	for _, line := range strings.Split(cgroupFile, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+
+	stats := cgroupStats{}
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		// cgroup v2：统一层级，控制器名为空
+		stats.version = 2
+		dir := cgroupDir(root, paths[""])
+		if fields := strings.Fields(readSysfsString(filepath.Join(dir, "cpu.max"))); len(fields) == 2 && fields[0] != "max" {
+			quota, _ := strconv.ParseFloat(fields[0], 64)
+			period, _ := strconv.ParseFloat(fields[1], 64)
+			if period > 0 {
+				stats.cpuQuota = quota / period
+			}
+		}
+		if usec, ok := cgroupStatValue(filepath.Join(dir, "cpu.stat"), "usage_usec"); ok {
+			stats.cpuUsage = float64(usec) / 1e6
+		}
+		if limit, ok := readSysfsUint(filepath.Join(dir, "memory.max")); ok {
+			stats.memoryLimit = limit
+		}
+		stats.memoryUsage, _ = readSysfsUint(filepath.Join(dir, "memory.current"))
+		if inactive, ok := cgroupStatValue(filepath.Join(dir, "memory.stat"), "inactive_file"); ok && inactive < stats.memoryUsage {
+			stats.memoryUsage -= inactive
+		}
+		return stats
+	}
+
+	// cgroup v1：每个控制器单独挂载
+	if _, ok := paths["memory"]; !ok {
+		return stats
+	}
+	stats.version = 1
+	cpuDir := cgroupDir(filepath.Join(root, "cpu"), paths["cpu"])
+	quota, okQuota := readCgroupInt(filepath.Join(cpuDir, "cpu.cfs_quota_us"))
+	period, okPeriod := readCgroupInt(filepath.Join(cpuDir, "cpu.cfs_period_us"))
+	if okQuota && okPeriod && quota > 0 && period > 0 {
+		stats.cpuQuota = float64(quota) / float64(period)
+	}
+	cpuacctDir := cgroupDir(filepath.Join(root, "cpuacct"), paths["cpuacct"])
+	if ns, ok := readSysfsUint(filepath.Join(cpuacctDir, "cpuacct.usage")); ok {
+		stats.cpuUsage = float64(ns) / 1e9
+	}
+	memoryDir := cgroupDir(filepath.Join(root, "memory"), paths["memory"])
+	if limit, ok := readSysfsUint(filepath.Join(memoryDir, "memory.limit_in_bytes")); ok && limit < cgroupUnlimited {
+		stats.memoryLimit = limit
+	}
+	stats.memoryUsage, _ = readSysfsUint(filepath.Join(memoryDir, "memory.usage_in_bytes"))
+	if inactive, ok := cgroupStatValue(filepath.Join(memoryDir, "memory.stat"), "total_inactive_file"); ok && inactive < stats.memoryUsage {
+		stats.memoryUsage -= inactive
+	}
+	return stats
+}
+
+// cgroupDir 返回 cgroup 路径对应的目录，容器内看不到宿主机上的完整路径时使用挂载点本身
+func cgroupDir(mount, path string) string {
+	if path != "" && path != "/" {
+		dir := filepath.Join(mount, path)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return mount
+}
+
+// cgroupStatValue 读取 cpu.stat、memory.stat 等 "key value" 格式文件中的值
+func cgroupStatValue(path, key string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			value, err := strconv.ParseUint(fields[1], 10, 64)
+			return value, err == nil
+		}
+	}
+	return 0, false
+}
+
+// readCgroupInt 读取可能为负数的 cgroup 文件，如 cpu.cfs_quota_us 的 -1
+func readCgroupInt(path string) (int64, bool) {
+	value, err := strconv.ParseInt(readSysfsString(path), 10, 64)
+	return value, err == nil
+}
@@ -0,0 +1,294 @@
+package sysinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// gpuCommandTimeout nvidia-smi、PowerShell 和 system_profiler 的执行超时
+	gpuCommandTimeout = 10 * time.Second
+	// gpuTTL PowerShell 和 system_profiler 查询的显卡列表的缓存时间，其中只有型号、驱动和显存大小，
+	// 很少变化；nvidia-smi 和 sysfs 提供的显存使用、利用率和温度每次重新读取
+	gpuTTL = time.Hour
+
+	drmRoot = "/sys/class/drm"
+)
+
+// gpuVendors PCI 厂商 ID
+var gpuVendors = map[string]string{
+	"0x10de": "nvidia",
+	"0x1002": "amd",
+	"0x8086": "intel",
+}
+
+// GPUInfo GPU 信息，不支持的字段为空：显存和利用率只有 NVIDIA（nvidia-smi）和 AMD（amdgpu）提供
+type GPUInfo struct {
+	Index       int      `json:"index"`
+	Vendor      string   `json:"vendor"` // nvidia、amd、intel 或 apple
+	Model       string   `json:"model"`
+	UUID        string   `json:"uuid,omitempty"`
+	Driver      string   `json:"driver,omitempty"`
+	MemoryTotal uint64   `json:"memory_total,omitempty"` // 字节
+	MemoryUsed  uint64   `json:"memory_used,omitempty"`  // 字节
+	Utilization *float64 `json:"utilization,omitempty"`  // 百分比
+	Temperature *float64 `json:"temperature,omitempty"`  // 摄氏度
+}
+
+// collectGPUInfo 收集 GPU 信息，没有 GPU 或检测工具时为空
+func (c *Collector) collectGPUInfo(info *SystemInfo) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gpuCommandTimeout)
+	defer cancel()
+
+	// NVIDIA 优先使用 nvidia-smi（Linux 和 Windows 驱动自带），其他 GPU 按平台检测
+	gpus := nvidiaGPUs(ctx)
+	var others []GPUInfo
+	switch runtime.GOOS {
+	case "linux":
+		others = drmGPUs(drmRoot)
+	case "windows":
+		others = c.cachedGPUs(ctx, windowsGPUs)
+	case "darwin":
+		others = c.cachedGPUs(ctx, darwinGPUs)
+	}
+	for _, gpu := range others {
+		if gpu.Vendor == "nvidia" && len(gpus) > 0 {
+			continue
+		}
+		gpu.Index = len(gpus)
+		gpus = append(gpus, gpu)
+	}
+	info.GPUs = gpus
+	return nil
+}
+
+// cachedGPUs 返回 read 查询的显卡列表，结果缓存 gpuTTL
+func (c *Collector) cachedGPUs(ctx context.Context, read func(context.Context) []GPUInfo) []GPUInfo {
+	c.gpuMu.Lock()
+	defer c.gpuMu.Unlock()
+
+	if c.gpuAt.IsZero() || time.Since(c.gpuAt) > gpuTTL {
+		c.gpus, c.gpuAt = read(ctx), time.Now()
+	}
+	return append([]GPUInfo(nil), c.gpus...)
+}
+
+// nvidiaGPUs 通过 nvidia-smi 查询 NVIDIA GPU，未安装时返回空
+func nvidiaGPUs(ctx context.Context) []GPUInfo {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return nil
+	}
+	out, err := exec.CommandContext(ctx, "nvidia-smi",
+		"--query-gpu=index,name,uuid,driver_version,memory.total,memory.used,utilization.gpu,temperature.gpu",
+		"--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil
+	}
+	return parseNvidiaGPUs(out)
+}
+
+// parseNvidiaGPUs 解析 nvidia-smi 的 CSV 输出，显存单位为 MiB，不支持的字段（[N/A]）留空
+func parseNvidiaGPUs(data []byte) []GPUInfo {
+	var gpus []GPUInfo
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 8 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		gpu := GPUInfo{Index: index, Vendor: "nvidia", Model: fields[1], UUID: fields[2], Driver: fields[3]}
+		if value, err := strconv.ParseUint(fields[4], 10, 64); err == nil {
+			gpu.MemoryTotal = value * 1024 * 1024
+		}
+		if value, err := strconv.ParseUint(fields[5], 10, 64); err == nil {
+			gpu.MemoryUsed = value * 1024 * 1024
+		}
+		gpu.Utilization = parseOptionalFloat(fields[6])
+		gpu.Temperature = parseOptionalFloat(fields[7])
+		gpus = append(gpus, gpu)
+	}
+	return gpus
+}
+
+// drmGPUs 读取 Linux DRM 设备（/sys/class/drm/cardN/device），amdgpu 提供显存、利用率和温度
+func drmGPUs(root string) []GPUInfo {
+	cards, _ := filepath.Glob(filepath.Join(root, "card[0-9]*"))
+	var gpus []GPUInfo
+	for _, card := range cards {
+		// 跳过 card0-DP-1 等显示接口
+		if strings.Contains(filepath.Base(card), "-") {
+			continue
+		}
+		device := filepath.Join(card, "device")
+		vendor, ok := gpuVendors[readSysfsString(filepath.Join(device, "vendor"))]
+		if !ok {
+			continue
+		}
+		gpu := GPUInfo{Vendor: vendor}
+		if link, err := os.Readlink(filepath.Join(device, "driver")); err == nil {
+			gpu.Driver = filepath.Base(link)
+		}
+		gpu.Model = readSysfsString(filepath.Join(device, "product_name"))
+		if gpu.Model == "" {
+			gpu.Model = fmt.Sprintf("%s %s", strings.ToUpper(vendor), readSysfsString(filepath.Join(device, "device")))
+		}
+		if value, ok := readSysfsUint(filepath.Join(device, "mem_info_vram_total")); ok {
+			gpu.MemoryTotal = value
+		}
+		if value, ok := readSysfsUint(filepath.Join(device, "mem_info_vram_used")); ok {
+			gpu.MemoryUsed = value
+		}
+		if value, ok := readSysfsUint(filepath.Join(device, "gpu_busy_percent")); ok {
+			utilization := float64(value)
+			gpu.Utilization = &utilization
+		}
+		temps, _ := filepath.Glob(filepath.Join(device, "hwmon", "hwmon*", "temp1_input"))
+		if len(temps) > 0 {
+			if value, ok := readSysfsUint(temps[0]); ok {
+				temperature := float64(value) / 1000
+				gpu.Temperature = &temperature
+			}
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus
+}
+
+// windowsGPUs 通过 Win32_VideoController 查询显卡，AdapterRAM 为 32 位，超过 4GiB 的显存不准确
+func windowsGPUs(ctx context.Context) []GPUInfo {
+	out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command",
+		"Get-CimInstance Win32_VideoController | Select-Object Name,AdapterRAM,DriverVersion,PNPDeviceID | ConvertTo-Json").Output()
+	if err != nil {
+		return nil
+	}
+	return parseVideoControllers(out)
+}
+
+// parseVideoControllers 解析 Win32_VideoController 的 JSON 输出，只有一个对象时 ConvertTo-Json 不输出数组
+func parseVideoControllers(data []byte) []GPUInfo {
+	type controller struct {
+		Name          string
+		AdapterRAM    uint64
+		DriverVersion string
+		PNPDeviceID   string
+	}
+	var controllers []controller
+	if err := json.Unmarshal(data, &controllers); err != nil {
+		var single controller
+		if err := json.Unmarshal(data, &single); err != nil {
+			return nil
+		}
+		controllers = []controller{single}
+	}
+
+	var gpus []GPUInfo
+	for _, c := range controllers {
+		// PNPDeviceID 形如 PCI\VEN_10DE&DEV_2204&...，远程桌面等虚拟显卡不是 PCI 设备
+		upper := strings.ToUpper(c.PNPDeviceID)
+		start := strings.Index(upper, "VEN_")
+		if start < 0 || len(upper) < start+8 {
+			continue
+		}
+		vendor, ok := gpuVendors["0x"+strings.ToLower(upper[start+4:start+8])]
+		if !ok {
+			continue
+		}
+		gpus = append(gpus, GPUInfo{Vendor: vendor, Model: c.Name, Driver: c.DriverVersion, MemoryTotal: c.AdapterRAM})
+	}
+	return gpus
+}
+
+// darwinGPUs 通过 system_profiler 查询显卡
+func darwinGPUs(ctx context.Context) []GPUInfo {
+	out, err := exec.CommandContext(ctx, "system_profiler", "SPDisplaysDataType", "-json").Output()
+	if err != nil {
+		return nil
+	}
+	return parseSystemProfilerGPUs(out)
+}
+
+// parseSystemProfilerGPUs 解析 system_profiler SPDisplaysDataType -json 的输出，
+// Apple 芯片的 GPU 与系统共享内存，没有独立显存
+func parseSystemProfilerGPUs(data []byte) []GPUInfo {
+	var out struct {
+		Displays []struct {
+			Model  string `json:"sppci_model"`
+			Vendor string `json:"spdisplays_vendor"`
+			VRAM   string `json:"spdisplays_vram"`
+		} `json:"SPDisplaysDataType"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+
+	var gpus []GPUInfo
+	for _, display := range out.Displays {
+		gpu := GPUInfo{Model: display.Model, Vendor: "apple"}
+		vendor := strings.ToLower(display.Vendor + " " + display.Model)
+		for _, name := range []string{"nvidia", "amd", "intel"} {
+			if strings.Contains(vendor, name) {
+				gpu.Vendor = name
+			}
+		}
+		gpu.MemoryTotal = parseVRAM(display.VRAM)
+		gpus = append(gpus, gpu)
+	}
+	return gpus
+}
+
+// parseVRAM 解析 "8 GB"、"1536 MB" 形式的显存大小
+func parseVRAM(value string) uint64 {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return 0
+	}
+	size, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToUpper(fields[1]) {
+	case "GB":
+		return size * 1024 * 1024 * 1024
+	case "MB":
+		return size * 1024 * 1024
+	}
+	return 0
+}
+
+// parseOptionalFloat 解析数值字段，不支持时返回 nil
+func parseOptionalFloat(value string) *float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// readSysfsString 读取 sysfs 文件内容，去掉首尾空白
+func readSysfsString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSysfsUint 读取 sysfs 中的整数文件
+func readSysfsUint(path string) (uint64, bool) {
+	value, err := strconv.ParseUint(readSysfsString(path), 10, 64)
+	return value, err == nil
+}
@@ -0,0 +1,247 @@
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+const (
+	// inventoryTTL 资产信息的缓存时间，硬件和域信息很少变化，避免每次收集都执行外部命令
+	inventoryTTL = time.Hour
+
+	// inventoryCommandTimeout PowerShell、system_profiler 等命令的执行超时
+	inventoryCommandTimeout = 15 * time.Second
+
+	dmiRoot = "/sys/class/dmi/id"
+)
+
+// InventoryInfo 主机资产信息，供 CMDB 使用，无法获取的字段为空
+type InventoryInfo struct {
+	Vendor         string `json:"vendor,omitempty"`
+	Model          string `json:"model,omitempty"`
+	SerialNumber   string `json:"serial_number,omitempty"` // Linux 上需要 root 权限
+	BIOSVendor     string `json:"bios_vendor,omitempty"`
+	BIOSVersion    string `json:"bios_version,omitempty"`
+	BIOSDate       string `json:"bios_date,omitempty"`
+	Virtualization string `json:"virtualization"`   // kvm、vmware、hyper-v、xen、virtualbox 或 none
+	Domain         string `json:"domain,omitempty"` // 加入的 Active Directory 域或 Kerberos realm，未加入时为空
+	OSName         string `json:"os_name,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	PatchLevel     string `json:"patch_level,omitempty"` // Linux 为发行版小版本，Windows 为含 UBR 的版本号，macOS 为构建号
+	LastHotfix     string `json:"last_hotfix,omitempty"` // Windows 最近安装的补丁，如 KB5032189
+}
+
+// collectInventory 收集资产信息，结果缓存 inventoryTTL
+func (c *Collector) collectInventory(info *SystemInfo) error {
+	c.invMu.Lock()
+	defer c.invMu.Unlock()
+
+	if c.inventory == nil || time.Since(c.inventoryAt) > inventoryTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), inventoryCommandTimeout)
+		defer cancel()
+		c.inventory = readInventory(ctx)
+		c.inventoryAt = time.Now()
+	}
+	info.Inventory = *c.inventory
+	return nil
+}
+
+// readInventory 按平台收集资产信息
+func readInventory(ctx context.Context) *InventoryInfo {
+	inv := &InventoryInfo{}
+	if platform, _, version, err := host.PlatformInformation(); err == nil {
+		inv.OSName, inv.OSVersion = platform, version
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		dmiInventory(dmiRoot, inv)
+		inv.PatchLevel = osReleaseVersion("/etc/os-release")
+		inv.Domain = linuxDomain(ctx)
+	case "windows":
+		if out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsInventoryScript).Output(); err == nil {
+			parseWindowsInventory(out, inv)
+		}
+	case "darwin":
+		inv.Vendor = "Apple Inc."
+		if out, err := exec.CommandContext(ctx, "system_profiler", "SPHardwareDataType", "-json").Output(); err == nil {
+			parseSystemProfilerHardware(out, inv)
+		}
+		if out, err := exec.CommandContext(ctx, "sw_vers", "-buildVersion").Output(); err == nil {
+			inv.PatchLevel = strings.TrimSpace(string(out))
+		}
+		if out, err := exec.CommandContext(ctx, "dsconfigad", "-show").Output(); err == nil {
+			inv.Domain = parseDsconfigad(out)
+		}
+	}
+
+	inv.Virtualization = virtualizationFromDMI(inv.Vendor, inv.Model)
+	if inv.Virtualization == "none" && runtime.GOOS == "linux" {
+		// DMI 不可读时（如部分 Xen 半虚拟化主机）使用 gopsutil 的检测结果，容器不算虚拟化
+		if system, role, err := host.Virtualization(); err == nil && role == "guest" {
+			if name, ok := hypervisors[system]; ok {
+				inv.Virtualization = name
+			}
+		}
+	}
+	return inv
+}
+
+// hypervisors gopsutil 虚拟化类型到上报名称的映射
+var hypervisors = map[string]string{
+	"kvm":    "kvm",
+	"xen":    "xen",
+	"vmware": "vmware",
+	"vbox":   "virtualbox",
+	"hyperv": "hyper-v",
+}
+
+// virtualizationFromDMI 根据系统厂商和型号判断虚拟化类型
+func virtualizationFromDMI(vendor, model string) string {
+	value := strings.ToLower(vendor + " " + model)
+	switch {
+	case strings.Contains(value, "vmware"):
+		return "vmware"
+	case strings.Contains(value, "microsoft") && strings.Contains(value, "virtual"):
+		return "hyper-v"
+	case strings.Contains(value, "virtualbox") || strings.Contains(value, "innotek"):
+		return "virtualbox"
+	case strings.Contains(value, "xen"):
+		return "xen"
+	case strings.Contains(value, "qemu") || strings.Contains(value, "kvm") ||
+		strings.Contains(value, "amazon ec2") || strings.Contains(value, "google compute engine"):
+		return "kvm"
+	}
+	return "none"
+}
+
+// dmiInventory 读取 Linux DMI 信息（/sys/class/dmi/id）
+func dmiInventory(root string, inv *InventoryInfo) {
+	read := func(name string) string {
+		return readSysfsString(filepath.Join(root, name))
+	}
+	inv.Vendor = read("sys_vendor")
+	inv.Model = read("product_name")
+	inv.SerialNumber = read("product_serial")
+	inv.BIOSVendor = read("bios_vendor")
+	inv.BIOSVersion = read("bios_version")
+	inv.BIOSDate = read("bios_date")
+}
+
+// osReleaseVersion 读取 os-release 中的 VERSION，如 "22.04.3 LTS (Jammy Jellyfish)"，没有时使用 VERSION_ID
+func osReleaseVersion(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok {
+			values[key] = strings.Trim(value, `"'`)
+		}
+	}
+	if values["VERSION"] != "" {
+		return values["VERSION"]
+	}
+	return values["VERSION_ID"]
+}
+
+// linuxDomain 通过 realmd 查询已加入的域，没有安装 realmd 时为空
+func linuxDomain(ctx context.Context) string {
+	if _, err := exec.LookPath("realm"); err != nil {
+		return ""
+	}
+	out, err := exec.CommandContext(ctx, "realm", "list", "--name-only").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// windowsInventoryScript 一次 PowerShell 调用查询 Win32_ComputerSystem、Win32_BIOS、UBR 和最近安装的补丁
+const windowsInventoryScript = `$cs = Get-CimInstance Win32_ComputerSystem; $bios = Get-CimInstance Win32_BIOS; ` +
+	`$os = Get-CimInstance Win32_OperatingSystem; ` +
+	`$ubr = (Get-ItemProperty 'HKLM:\SOFTWARE\Microsoft\Windows NT\CurrentVersion' -ErrorAction SilentlyContinue).UBR; ` +
+	`$hotfix = Get-HotFix -ErrorAction SilentlyContinue | Sort-Object InstalledOn -Descending | Select-Object -First 1; ` +
+	`[pscustomobject]@{Manufacturer=$cs.Manufacturer; Model=$cs.Model; Domain=$cs.Domain; PartOfDomain=$cs.PartOfDomain; ` +
+	`SerialNumber=$bios.SerialNumber; BIOSVendor=$bios.Manufacturer; BIOSVersion=$bios.SMBIOSBIOSVersion; ` +
+	`BIOSDate=$(if ($bios.ReleaseDate) { $bios.ReleaseDate.ToString('yyyy-MM-dd') }); ` +
+	`OSName=$os.Caption; OSVersion=$os.Version; UBR=$ubr; HotFix=$hotfix.HotFixID} | ConvertTo-Json`
+
+// parseWindowsInventory 解析 windowsInventoryScript 的输出，工作组成员的 Domain 为工作组名，不算加入域
+func parseWindowsInventory(data []byte, inv *InventoryInfo) {
+	var out struct {
+		Manufacturer, Model, Domain       string
+		PartOfDomain                      bool
+		SerialNumber                      string
+		BIOSVendor, BIOSVersion, BIOSDate string
+		OSName, OSVersion                 string
+		UBR                               *int
+		HotFix                            string
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return
+	}
+	inv.Vendor, inv.Model = strings.TrimSpace(out.Manufacturer), strings.TrimSpace(out.Model)
+	inv.SerialNumber = strings.TrimSpace(out.SerialNumber)
+	inv.BIOSVendor, inv.BIOSVersion, inv.BIOSDate = out.BIOSVendor, out.BIOSVersion, out.BIOSDate
+	if out.PartOfDomain {
+		inv.Domain = out.Domain
+	}
+	if out.OSName != "" {
+		inv.OSName, inv.OSVersion = strings.TrimSpace(out.OSName), out.OSVersion
+	}
+	inv.PatchLevel = out.OSVersion
+	if out.UBR != nil {
+		inv.PatchLevel = fmt.Sprintf("%s.%d", out.OSVersion, *out.UBR)
+	}
+	inv.LastHotfix = out.HotFix
+}
+
+// parseSystemProfilerHardware 解析 system_profiler SPHardwareDataType -json 的输出
+func parseSystemProfilerHardware(data []byte, inv *InventoryInfo) {
+	var out struct {
+		Hardware []struct {
+			Name    string `json:"machine_name"`
+			Model   string `json:"machine_model"`
+			Serial  string `json:"serial_number"`
+			BootROM string `json:"boot_rom_version"`
+		} `json:"SPHardwareDataType"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil || len(out.Hardware) == 0 {
+		return
+	}
+	hw := out.Hardware[0]
+	inv.Model = strings.TrimSpace(hw.Name + " " + hw.Model)
+	inv.SerialNumber = hw.Serial
+	inv.BIOSVersion = hw.BootROM
+}
+
+// parseDsconfigad 解析 dsconfigad -show 输出中的 Active Directory 域，未加入域时输出为空
+func parseDsconfigad(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(key) == "Active Directory Domain" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,367 @@
+package sysinfo
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	stdnet "net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// netEnvTTL 网络环境的缓存时间，避免每次收集都请求公网 IP 服务
+	netEnvTTL = 10 * time.Minute
+
+	// netEnvTimeout 查询公网 IP 和执行外部命令的超时
+	netEnvTimeout = 10 * time.Second
+
+	// maxPublicIPResponse 公网 IP 服务响应的最大读取字节数
+	maxPublicIPResponse = 64 * 1024
+)
+
+// proxyEnvVars 读取的代理环境变量，小写形式优先
+var proxyEnvVars = []string{"http_proxy", "https_proxy", "all_proxy", "no_proxy"}
+
+// NetworkEnv 网络环境，用于排查远程站点的网络问题，无法获取的字段为空
+type NetworkEnv struct {
+	PublicIP         string            `json:"public_ip,omitempty"`
+	Geo              *GeoInfo          `json:"geo,omitempty"`
+	DNSServers       []string          `json:"dns_servers,omitempty"`
+	SearchDomains    []string          `json:"search_domains,omitempty"`
+	DefaultGateway   string            `json:"default_gateway,omitempty"`
+	GatewayInterface string            `json:"gateway_interface,omitempty"`
+	Proxy            map[string]string `json:"proxy,omitempty"` // 代理地址中的密码已脱敏
+}
+
+// GeoInfo 公网 IP 服务返回的地理位置，只有返回 JSON 的服务（如 ipinfo.io/json）才有
+type GeoInfo struct {
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+	Org     string `json:"org,omitempty"` // 运营商或自治系统
+}
+
+// SetNetworkEnv 设置是否收集网络环境，publicIPURL 为返回公网 IP 的服务地址，为空时不查询公网 IP
+func (c *Collector) SetNetworkEnv(enabled bool, publicIPURL string) {
+	c.netEnvMu.Lock()
+	defer c.netEnvMu.Unlock()
+	c.netEnvEnabled = enabled
+	c.publicIPURL = publicIPURL
+	c.netEnv = nil
+}
+
+// collectNetworkEnv 收集网络环境，结果缓存 netEnvTTL
+func (c *Collector) collectNetworkEnv(info *SystemInfo) error {
+	c.netEnvMu.Lock()
+	defer c.netEnvMu.Unlock()
+	if !c.netEnvEnabled {
+		return nil
+	}
+
+	if c.netEnv == nil || time.Since(c.netEnvAt) > netEnvTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), netEnvTimeout)
+		defer cancel()
+		env := readNetworkEnv(ctx)
+		if c.publicIPURL != "" {
+			env.PublicIP, env.Geo = lookupPublicIP(ctx, c.publicIPURL)
+		}
+		c.netEnv, c.netEnvAt = env, time.Now()
+	}
+	info.NetworkEnv = c.netEnv
+	return nil
+}
+
+// readNetworkEnv 按平台读取 DNS、默认网关和代理设置
+func readNetworkEnv(ctx context.Context) *NetworkEnv {
+	env := &NetworkEnv{Proxy: proxyFromEnv(os.Getenv)}
+	switch runtime.GOOS {
+	case "linux":
+		env.DNSServers, env.SearchDomains = parseResolvConf(readFileString("/etc/resolv.conf"))
+		// systemd-resolved 的本地存根，实际的上游服务器在 /run/systemd/resolve/resolv.conf
+		if len(env.DNSServers) == 1 && env.DNSServers[0] == "127.0.0.53" {
+			if servers, _ := parseResolvConf(readFileString("/run/systemd/resolve/resolv.conf")); len(servers) > 0 {
+				env.DNSServers = servers
+			}
+		}
+		env.DefaultGateway, env.GatewayInterface = parseProcNetRoute(readFileString("/proc/net/route"))
+	case "darwin":
+		env.DNSServers, env.SearchDomains = parseResolvConf(readFileString("/etc/resolv.conf"))
+		if out, err := exec.CommandContext(ctx, "route", "-n", "get", "default").Output(); err == nil {
+			env.DefaultGateway, env.GatewayInterface = parseRouteGet(string(out))
+		}
+		if out, err := exec.CommandContext(ctx, "scutil", "--proxy").Output(); err == nil {
+			mergeProxy(env, parseScutilProxy(string(out)))
+		}
+	case "windows":
+		if out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsNetEnvScript).Output(); err == nil {
+			parseWindowsNetEnv(out, env)
+		}
+	}
+	return env
+}
+
+// lookupPublicIP 请求公网 IP 服务，响应为纯文本 IP 或包含 ip 字段的 JSON
+func lookupPublicIP(ctx context.Context, url string) (string, *GeoInfo) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil
+	}
+	req.Header.Set("Accept", "application/json, text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPublicIPResponse))
+	if err != nil {
+		return "", nil
+	}
+	return parsePublicIP(body)
+}
+
+// parsePublicIP 解析公网 IP 服务的响应，兼容 ipinfo.io（ip、region、org）和 ip-api.com（query、regionName、isp）的字段
+func parsePublicIP(body []byte) (string, *GeoInfo) {
+	text := strings.TrimSpace(string(body))
+	if ip := stdnet.ParseIP(text); ip != nil {
+		return ip.String(), nil
+	}
+
+	var out struct {
+		IP         string `json:"ip"`
+		Query      string `json:"query"`
+		Country    string `json:"country"`
+		Region     string `json:"region"`
+		RegionName string `json:"regionName"`
+		City       string `json:"city"`
+		Org        string `json:"org"`
+		ISP        string `json:"isp"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", nil
+	}
+	address := out.IP
+	if address == "" {
+		address = out.Query
+	}
+	ip := stdnet.ParseIP(address)
+	if ip == nil {
+		return "", nil
+	}
+	geo := &GeoInfo{Country: out.Country, Region: out.Region, City: out.City, Org: out.Org}
+	if geo.Region == "" {
+		geo.Region = out.RegionName
+	}
+	if geo.Org == "" {
+		geo.Org = out.ISP
+	}
+	if *geo == (GeoInfo{}) {
+		geo = nil
+	}
+	return ip.String(), geo
+}
+
+// parseResolvConf 解析 resolv.conf 中的 nameserver 和 search
+func parseResolvConf(content string) (servers, search []string) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			servers = append(servers, fields[1])
+		case "search", "domain":
+			search = append(search, fields[1:]...)
+		}
+	}
+	return servers, search
+}
+
+// parseProcNetRoute 从 /proc/net/route 中找出度量值最小的默认路由，网关为小端序十六进制
+func parseProcNetRoute(content string) (gateway, iface string) {
+	bestMetric := -1
+	for i, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 7 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil || (bestMetric >= 0 && metric >= bestMetric) {
+			continue
+		}
+		ip := make(stdnet.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		gateway, iface, bestMetric = ip.String(), fields[0], metric
+	}
+	return gateway, iface
+}
+
+// parseRouteGet 解析 macOS route -n get default 的输出
+func parseRouteGet(content string) (gateway, iface string) {
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "gateway":
+			gateway = strings.TrimSpace(value)
+		case "interface":
+			iface = strings.TrimSpace(value)
+		}
+	}
+	return gateway, iface
+}
+
+// parseScutilProxy 解析 scutil --proxy 输出中启用的 HTTP、HTTPS 代理和例外列表
+func parseScutilProxy(content string) map[string]string {
+	values := map[string]string{}
+	var exceptions []string
+	inExceptions := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if inExceptions {
+			if line == "}" {
+				inExceptions = false
+			} else if _, value, ok := strings.Cut(line, ":"); ok {
+				exceptions = append(exceptions, strings.TrimSpace(value))
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "ExceptionsList" {
+			inExceptions = true
+			continue
+		}
+		values[key] = value
+	}
+
+	proxy := map[string]string{}
+	for _, scheme := range []struct{ prefix, name string }{{"HTTP", "http_proxy"}, {"HTTPS", "https_proxy"}} {
+		if values[scheme.prefix+"Enable"] == "1" && values[scheme.prefix+"Proxy"] != "" {
+			proxy[scheme.name] = "http://" + stdnet.JoinHostPort(values[scheme.prefix+"Proxy"], values[scheme.prefix+"Port"])
+		}
+	}
+	if len(proxy) > 0 && len(exceptions) > 0 {
+		proxy["no_proxy"] = strings.Join(exceptions, ",")
+	}
+	return proxy
+}
+
+// windowsNetEnvScript 一次 PowerShell 调用查询 DNS 服务器、默认路由和 WinINet 代理设置
+const windowsNetEnvScript = `$dns = @(Get-DnsClientServerAddress -AddressFamily IPv4 -ErrorAction SilentlyContinue | ForEach-Object { $_.ServerAddresses }) | Select-Object -Unique; ` +
+	`$route = Get-NetRoute -DestinationPrefix '0.0.0.0/0' -ErrorAction SilentlyContinue | Sort-Object RouteMetric | Select-Object -First 1; ` +
+	`$search = (Get-DnsClientGlobalSetting -ErrorAction SilentlyContinue).SuffixSearchList; ` +
+	`$proxy = Get-ItemProperty 'HKCU:\Software\Microsoft\Windows\CurrentVersion\Internet Settings' -ErrorAction SilentlyContinue; ` +
+	`[pscustomobject]@{DNS=@($dns); Search=@($search); Gateway=$route.NextHop; Interface=$route.InterfaceAlias; ` +
+	`ProxyEnable=$proxy.ProxyEnable; ProxyServer=$proxy.ProxyServer; ProxyOverride=$proxy.ProxyOverride} | ConvertTo-Json`
+
+// parseWindowsNetEnv 解析 windowsNetEnvScript 的输出，ProxyServer 可以是 host:port 或 http=host:port;https=host:port
+func parseWindowsNetEnv(data []byte, env *NetworkEnv) {
+	var out struct {
+		DNS           []string
+		Search        []string
+		Gateway       string
+		Interface     string
+		ProxyEnable   int
+		ProxyServer   string
+		ProxyOverride string
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return
+	}
+	// @($null) 输出 [null]
+	env.DNSServers, env.SearchDomains = nonEmpty(out.DNS), nonEmpty(out.Search)
+	env.DefaultGateway, env.GatewayInterface = out.Gateway, out.Interface
+	if out.ProxyEnable != 1 || out.ProxyServer == "" {
+		return
+	}
+
+	proxy := map[string]string{}
+	if !strings.Contains(out.ProxyServer, "=") {
+		proxy["http_proxy"] = "http://" + out.ProxyServer
+		proxy["https_proxy"] = "http://" + out.ProxyServer
+	} else {
+		for _, item := range strings.Split(out.ProxyServer, ";") {
+			scheme, address, ok := strings.Cut(item, "=")
+			if ok && (scheme == "http" || scheme == "https") {
+				proxy[scheme+"_proxy"] = "http://" + address
+			}
+		}
+	}
+	if out.ProxyOverride != "" {
+		proxy["no_proxy"] = strings.ReplaceAll(out.ProxyOverride, ";", ",")
+	}
+	mergeProxy(env, proxy)
+}
+
+// proxyFromEnv 读取代理环境变量，大小写形式都支持
+func proxyFromEnv(getenv func(string) string) map[string]string {
+	proxy := map[string]string{}
+	for _, name := range proxyEnvVars {
+		value := getenv(name)
+		if value == "" {
+			value = getenv(strings.ToUpper(name))
+		}
+		if value != "" {
+			proxy[name] = urlCredentialPattern.ReplaceAllString(value, "${1}***@")
+		}
+	}
+	if len(proxy) == 0 {
+		return nil
+	}
+	return proxy
+}
+
+// mergeProxy 合并系统代理设置，环境变量优先
+func mergeProxy(env *NetworkEnv, proxy map[string]string) {
+	for name, value := range proxy {
+		if env.Proxy == nil {
+			env.Proxy = map[string]string{}
+		}
+		if _, ok := env.Proxy[name]; !ok {
+			env.Proxy[name] = urlCredentialPattern.ReplaceAllString(value, "${1}***@")
+		}
+	}
+}
+
+// nonEmpty 去掉空字符串
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// readFileString 读取文件内容，失败时返回空字符串
+func readFileString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,156 @@
+package sysinfo
+
+import (
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// InterfaceStats 网络接口的累计计数和速率，速率为相邻两次收集之间的平均值，首次收集时为 0
+type InterfaceStats struct {
+	Name            string  `json:"name"`
+	BytesSent       uint64  `json:"bytes_sent"`
+	BytesRecv       uint64  `json:"bytes_recv"`
+	PacketsSent     uint64  `json:"packets_sent"`
+	PacketsRecv     uint64  `json:"packets_recv"`
+	Errin           uint64  `json:"errin"`
+	Errout          uint64  `json:"errout"`
+	Dropin          uint64  `json:"dropin"`
+	Dropout         uint64  `json:"dropout"`
+	BytesSentRate   float64 `json:"bytes_sent_rate"` // 字节/秒
+	BytesRecvRate   float64 `json:"bytes_recv_rate"` // 字节/秒
+	PacketsSentRate float64 `json:"packets_sent_rate"`
+	PacketsRecvRate float64 `json:"packets_recv_rate"`
+}
+
+// ListeningPort 正在监听的端口，无权限查看的进程 PID 为 0
+type ListeningPort struct {
+	Protocol string `json:"protocol"` // tcp、tcp6、udp 或 udp6
+	Address  string `json:"address"`
+	Port     uint32 `json:"port"`
+	PID      int32  `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
+// collectNetworkStats 收集网络接口计数、TCP 连接状态统计和监听端口
+func (c *Collector) collectNetworkStats(info *SystemInfo) error {
+	if counters, err := net.IOCounters(true); err == nil {
+		now := time.Now()
+		c.netMu.Lock()
+		var elapsed float64
+		if !c.netSampleAt.IsZero() {
+			elapsed = now.Sub(c.netSampleAt).Seconds()
+		}
+		info.NetworkStats = interfaceStats(c.netSamples, counters, elapsed)
+		c.netSamples = make(map[string]net.IOCountersStat, len(counters))
+		for _, counter := range counters {
+			c.netSamples[counter.Name] = counter
+		}
+		c.netSampleAt = now
+		c.netMu.Unlock()
+	}
+
+	if conns, err := net.Connections("inet"); err == nil {
+		info.Connections, info.ListeningPorts = summarizeConnections(conns)
+		names := map[int32]string{}
+		for i := range info.ListeningPorts {
+			port := &info.ListeningPorts[i]
+			if port.PID == 0 {
+				continue
+			}
+			name, ok := names[port.PID]
+			if !ok {
+				if proc, err := process.NewProcess(port.PID); err == nil {
+					name, _ = proc.Name()
+				}
+				names[port.PID] = name
+			}
+			port.Process = name
+		}
+	}
+
+	return nil
+}
+
+// interfaceStats 根据上次采样计算每个接口的速率，计数器回绕或接口重建时速率为 0
+func interfaceStats(prev map[string]net.IOCountersStat, counters []net.IOCountersStat, elapsed float64) []InterfaceStats {
+	rate := func(current, previous uint64) float64 {
+		if elapsed <= 0 || current < previous {
+			return 0
+		}
+		return float64(current-previous) / elapsed
+	}
+
+	stats := make([]InterfaceStats, 0, len(counters))
+	for _, counter := range counters {
+		stat := InterfaceStats{
+			Name:        counter.Name,
+			BytesSent:   counter.BytesSent,
+			BytesRecv:   counter.BytesRecv,
+			PacketsSent: counter.PacketsSent,
+			PacketsRecv: counter.PacketsRecv,
+			Errin:       counter.Errin,
+			Errout:      counter.Errout,
+			Dropin:      counter.Dropin,
+			Dropout:     counter.Dropout,
+		}
+		if last, ok := prev[counter.Name]; ok {
+			stat.BytesSentRate = rate(counter.BytesSent, last.BytesSent)
+			stat.BytesRecvRate = rate(counter.BytesRecv, last.BytesRecv)
+			stat.PacketsSentRate = rate(counter.PacketsSent, last.PacketsSent)
+			stat.PacketsRecvRate = rate(counter.PacketsRecv, last.PacketsRecv)
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// summarizeConnections 按状态统计 TCP 连接数，并找出监听中的 TCP 端口和未连接的 UDP 端口
+func summarizeConnections(conns []net.ConnectionStat) (map[string]int, []ListeningPort) {
+	counts := map[string]int{}
+	seen := map[ListeningPort]bool{}
+	ports := []ListeningPort{}
+	for _, conn := range conns {
+		var protocol string
+		switch conn.Type {
+		case syscall.SOCK_STREAM:
+			counts[conn.Status]++
+			if conn.Status != "LISTEN" {
+				continue
+			}
+			protocol = "tcp"
+		case syscall.SOCK_DGRAM:
+			if conn.Raddr.Port != 0 {
+				continue
+			}
+			protocol = "udp"
+		default:
+			continue
+		}
+		if conn.Laddr.Port == 0 {
+			continue
+		}
+		if conn.Family == syscall.AF_INET6 {
+			protocol += "6"
+		}
+		port := ListeningPort{Protocol: protocol, Address: conn.Laddr.IP, Port: conn.Laddr.Port, PID: conn.Pid}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		if ports[i].Protocol != ports[j].Protocol {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		return ports[i].Address < ports[j].Address
+	})
+	return counts, ports
+}
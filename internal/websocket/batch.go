@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MessageTypeBatch 批量消息，data 为多条完整消息组成的数组
+const MessageTypeBatch = "batch"
+
+// batchMaxMessageSize 参与合并的单条消息最大字节数，更大的消息直接发送
+const batchMaxMessageSize = 8 * 1024
+
+// DefaultBatchMaxMessages 默认单个批次最多合并的消息数
+const DefaultBatchMaxMessages = 50
+
+// batcher 在时间窗口内合并多条小消息，窗口结束或达到数量上限时一次发送
+type batcher struct {
+	window      time.Duration
+	maxMessages int
+	pending     []json.RawMessage
+	timer       *time.Timer
+	send        func([]json.RawMessage)
+	mu          sync.Mutex
+	sendMu      sync.Mutex // 保证批次按顺序发送
+}
+
+// newBatcher 创建消息合并器
+func newBatcher(window time.Duration, maxMessages int, send func([]json.RawMessage)) *batcher {
+	if maxMessages <= 0 {
+		maxMessages = DefaultBatchMaxMessages
+	}
+	return &batcher{
+		window:      window,
+		maxMessages: maxMessages,
+		send:        send,
+	}
+}
+
+// add 加入一条消息，返回 false 表示消息过大，需要调用方先 flush 再直接发送
+func (b *batcher) add(data []byte) bool {
+	if len(data) > batchMaxMessageSize {
+		return false
+	}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, json.RawMessage(data))
+	if len(b.pending) >= b.maxMessages {
+		b.mu.Unlock()
+		b.flush()
+		return true
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+	b.mu.Unlock()
+	return true
+}
+
+// flush 立即发送等待中的消息
+func (b *batcher) flush() {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.takeLocked()
+	b.mu.Unlock()
+
+	if len(batch) > 0 {
+		b.send(batch)
+	}
+}
+
+// discard 丢弃等待中的消息，用于客户端停止时
+func (b *batcher) discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.takeLocked()
+}
+
+// takeLocked 取出等待中的消息并停止计时器，调用方需持有锁
+func (b *batcher) takeLocked() []json.RawMessage {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
@@ -1,10 +1,16 @@
 package websocket
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"assistant_agent/internal/logger"
@@ -14,35 +20,222 @@ import (
 
 // Message 消息结构
 type Message struct {
-	Type    string      `json:"type"`
-	Data    interface{} `json:"data"`
-	ID      string      `json:"id,omitempty"`
-	Timestamp time.Time `json:"timestamp"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	ID        string      `json:"id,omitempty"`
+	ReplyTo   string      `json:"reply_to,omitempty"` // 响应消息对应的请求 ID
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// log WebSocket 客户端日志，可通过 logging.components.websocket 单独设置级别
+var log = logger.Component("websocket")
+
+// ErrClientStopped 客户端已停止
+var ErrClientStopped = errors.New("websocket client stopped")
+
+// MessageTypeAck 消息确认，data 中的 id 为被确认的消息 ID
+const MessageTypeAck = "ack"
+
+// MessageTypeError 服务器对请求返回的错误响应
+const MessageTypeError = "error"
+
+// DefaultCallTimeout Call 未指定超时时间时的默认值
+const DefaultCallTimeout = 30 * time.Second
+
+// defaultReliableTypes 默认需要服务器确认的消息类型
+var defaultReliableTypes = []string{"command_result", "plugin_result", "task_result"}
+
+// ConnectionState 连接状态
+type ConnectionState string
+
+const (
+	StateConnected    ConnectionState = "connected"
+	StateDisconnected ConnectionState = "disconnected"
+	StateReconnecting ConnectionState = "reconnecting"
+	StateFailed       ConnectionState = "failed" // 超过最大重连次数
+	StateStopped      ConnectionState = "stopped"
+)
+
+// StateHandler 连接状态变化回调，err 为导致状态变化的错误
+type StateHandler func(state ConnectionState, err error)
+
+// ReconnectOptions 断线重连参数
+type ReconnectOptions struct {
+	InitialDelay time.Duration // 首次重连等待时间
+	MaxDelay     time.Duration // 最大等待时间
+	Multiplier   float64       // 每次失败后等待时间的增长倍数
+	Jitter       float64       // 随机抖动比例（0~1），避免大量 Agent 同时重连
+	MaxRetries   int           // 单次断线最大重连次数，0 表示不限制
+}
+
+// DefaultReconnectOptions 返回默认断线重连参数
+func DefaultReconnectOptions() ReconnectOptions {
+	return ReconnectOptions{
+		InitialDelay: time.Second,
+		MaxDelay:     5 * time.Minute,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// Delay 返回第 attempt 次（从 1 开始）重连前的等待时间
+func (o ReconnectOptions) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := o.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(o.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if o.MaxDelay > 0 && delay > float64(o.MaxDelay) {
+		delay = float64(o.MaxDelay)
+	}
+
+	// 在 [delay*(1-jitter), delay] 范围内随机取值
+	if o.Jitter > 0 {
+		jitter := math.Min(o.Jitter, 1)
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
 }
 
 // Client WebSocket 客户端
 type Client struct {
-	url       string
-	token     string
-	conn      *websocket.Conn
-	connected bool
-	mu        sync.RWMutex
+	url          string
+	token        string
+	conn         *websocket.Conn
+	connected    bool
+	stopped      bool
+	stopCh       chan struct{}
+	reconnect    ReconnectOptions
+	stateHandler StateHandler
+	outbox       *outbox         // 待确认消息队列，为空时不保证送达
+	reliable     map[string]bool // 需要确认的消息类型
+	msgSeq       uint64
+	tlsConfig    *tls.Config              // wss 连接使用的 TLS 配置，为空时使用默认配置
+	compression  bool                     // 是否协商 permessage-deflate 压缩
+	batch        *batcher                 // 小消息合并器，为空时逐条发送
+	calls        map[string]chan *Message // 等待响应的请求
+	pings        map[string]chan struct{} // 等待 pong 的 ping，键为 ping 的内容
+	pingSeq      uint64
+	callMu       sync.Mutex // 保护 calls 和 pings
+	mu           sync.RWMutex
+	writeMu      sync.Mutex // gorilla/websocket 不支持并发写
 }
 
 // NewClient 创建新的 WebSocket 客户端
 func NewClient(url, token string) (*Client, error) {
-	return &Client{
-		url:   url,
-		token: token,
-	}, nil
+	client := &Client{
+		url:       url,
+		token:     token,
+		stopCh:    make(chan struct{}),
+		reconnect: DefaultReconnectOptions(),
+		calls:     make(map[string]chan *Message),
+		pings:     make(map[string]chan struct{}),
+	}
+	client.SetReliableTypes(defaultReliableTypes...)
+	return client, nil
 }
 
-// Connect 连接到服务器
-func (c *Client) Connect() error {
+// EnableOutbox 启用持久化发送队列，需要确认的消息在收到 ack 前保存在 dir 中，
+// 断线期间产生的消息会在重连后按顺序重发
+func (c *Client) EnableOutbox(dir string, maxSize int) error {
+	box, err := newOutbox(dir, maxSize)
+	if err != nil {
+		return fmt.Errorf("failed to open outbox: %v", err)
+	}
+
+	c.mu.Lock()
+	c.outbox = box
+	c.mu.Unlock()
+
+	if count := box.len(); count > 0 {
+		log.Infof("Loaded %d undelivered messages from outbox", count)
+	}
+	return nil
+}
+
+// SetReliableTypes 设置需要服务器确认的消息类型
+func (c *Client) SetReliableTypes(types ...string) {
+	reliable := make(map[string]bool, len(types))
+	for _, msgType := range types {
+		reliable[msgType] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reliable = reliable
+}
+
+// PendingMessages 返回等待确认的消息数
+func (c *Client) PendingMessages() int {
+	c.mu.RLock()
+	box := c.outbox
+	c.mu.RUnlock()
+
+	if box == nil {
+		return 0
+	}
+	return box.len()
+}
+
+// SetReconnectOptions 设置断线重连参数
+func (c *Client) SetReconnectOptions(opts ReconnectOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnect = opts
+}
+
+// SetTLSConfig 设置 wss 连接的 TLS 配置，下次连接时生效
+func (c *Client) SetTLSConfig(tlsConfig *tls.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tlsConfig = tlsConfig
+}
+
+// SetCompression 设置是否启用 permessage-deflate 压缩，下次连接时生效
+// 服务器不支持压缩时自动回退为不压缩
+func (c *Client) SetCompression(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.compression = enabled
+}
+
+// SetBatching 设置小消息合并发送，window 内产生的消息合并为一条 batch 消息，
+// window 为 0 时关闭合并
+func (c *Client) SetBatching(window time.Duration, maxMessages int) {
+	c.mu.Lock()
+	old := c.batch
+	c.batch = nil
+	if window > 0 {
+		c.batch = newBatcher(window, maxMessages, c.writeBatch)
+	}
+	c.mu.Unlock()
+
+	if old != nil {
+		old.flush()
+	}
+}
+
+// OnStateChange 设置连接状态变化回调
+func (c *Client) OnStateChange(handler StateHandler) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.stateHandler = handler
+}
+
+// Connect 连接到服务器，成功时触发 connected 状态
+func (c *Client) Connect() error {
+	c.mu.Lock()
 
+	if c.stopped {
+		c.mu.Unlock()
+		return ErrClientStopped
+	}
 	if c.connected {
+		c.mu.Unlock()
 		return nil
 	}
 
@@ -53,18 +246,55 @@ func (c *Client) Connect() error {
 	}
 
 	// 建立连接
-	conn, _, err := websocket.DefaultDialer.Dial(c.url, headers)
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = c.tlsConfig
+	dialer.EnableCompression = c.compression
+	conn, _, err := dialer.Dial(c.url, headers)
 	if err != nil {
+		c.mu.Unlock()
 		return fmt.Errorf("failed to connect to server: %v", err)
 	}
+	if c.compression {
+		// 仅在服务器同意 permessage-deflate 时生效
+		conn.EnableWriteCompression(true)
+	}
+	conn.SetPongHandler(c.handlePong)
 
 	c.conn = conn
 	c.connected = true
+	handler := c.stateHandler
+	c.mu.Unlock()
 
-	logger.Info("Connected to server via WebSocket")
+	log.Info("Connected to server via WebSocket")
+	if handler != nil {
+		handler(StateConnected, nil)
+	}
+	c.flushOutbox()
 	return nil
 }
 
+// flushOutbox 重发所有未确认的消息，写入失败时停止，等待下次连接
+func (c *Client) flushOutbox() {
+	c.mu.RLock()
+	box := c.outbox
+	c.mu.RUnlock()
+
+	if box == nil {
+		return
+	}
+
+	entries := box.pending()
+	for i, entry := range entries {
+		if err := c.write(entry.data); err != nil {
+			log.Warnf("Outbox flush interrupted, %d messages pending: %v", len(entries)-i, err)
+			return
+		}
+	}
+	if len(entries) > 0 {
+		log.Infof("Redelivered %d unacknowledged messages", len(entries))
+	}
+}
+
 // Disconnect 断开连接
 func (c *Client) Disconnect() {
 	c.mu.Lock()
@@ -76,12 +306,99 @@ func (c *Client) Disconnect() {
 	}
 	c.connected = false
 
-	logger.Info("Disconnected from server")
+	log.Info("Disconnected from server")
 }
 
-// Stop 停止客户端
+// Stop 停止客户端，停止后不再重连，阻塞中的 Receive 返回 ErrClientStopped
 func (c *Client) Stop() {
+	c.mu.Lock()
+	if !c.stopped {
+		c.stopped = true
+		close(c.stopCh)
+	}
+	handler := c.stateHandler
+	batch := c.batch
+	c.mu.Unlock()
+
+	// 需要确认的消息仍保存在发送队列中，下次启动后重发
+	if batch != nil {
+		batch.discard()
+	}
+
 	c.Disconnect()
+	if handler != nil {
+		handler(StateStopped, nil)
+	}
+}
+
+// dropConnection 连接异常时关闭连接，Receive 会在下次读取时重连
+func (c *Client) dropConnection(conn *websocket.Conn, cause error) {
+	c.mu.Lock()
+	if c.conn != conn {
+		// 连接已被替换或关闭
+		c.mu.Unlock()
+		return
+	}
+	conn.Close()
+	c.conn = nil
+	c.connected = false
+	handler := c.stateHandler
+	stopped := c.stopped
+	c.mu.Unlock()
+
+	if handler != nil && !stopped {
+		handler(StateDisconnected, cause)
+	}
+}
+
+// Reconnect 主动断开当前连接，Receive 会按退避策略重新连接
+func (c *Client) Reconnect(cause error) {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+
+	if conn != nil {
+		log.Warnf("Dropping server connection: %v", cause)
+		c.dropConnection(conn, cause)
+	}
+}
+
+// reconnectLoop 按指数退避重连，直到连接成功、客户端停止或超过最大重连次数
+func (c *Client) reconnectLoop(cause error) error {
+	c.mu.RLock()
+	opts := c.reconnect
+	handler := c.stateHandler
+	c.mu.RUnlock()
+
+	lastErr := cause
+	for attempt := 1; opts.MaxRetries <= 0 || attempt <= opts.MaxRetries; attempt++ {
+		delay := opts.Delay(attempt)
+		log.Infof("Reconnecting to server in %v (attempt %d)", delay, attempt)
+		if handler != nil {
+			handler(StateReconnecting, lastErr)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-c.stopCh:
+			timer.Stop()
+			return ErrClientStopped
+		case <-timer.C:
+		}
+
+		if lastErr = c.Connect(); lastErr == nil {
+			return nil
+		}
+		if lastErr == ErrClientStopped {
+			return lastErr
+		}
+		log.Warnf("Reconnect attempt %d failed: %v", attempt, lastErr)
+	}
+
+	if handler != nil {
+		handler(StateFailed, lastErr)
+	}
+	return fmt.Errorf("reconnect failed after %d attempts: %v", opts.MaxRetries, lastErr)
 }
 
 // IsConnected 检查是否已连接
@@ -101,18 +418,13 @@ func (c *Client) Send(msgType string, data interface{}) error {
 	return c.SendMessage(msgType, data)
 }
 
-// SendMessage 发送消息
+// SendMessage 发送消息，每条消息带唯一 ID
+// 需要确认的消息先写入发送队列，未连接或发送失败时返回 nil，重连后自动重发
 func (c *Client) SendMessage(msgType string, data interface{}) error {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if !c.connected || c.conn == nil {
-		return fmt.Errorf("not connected to server")
-	}
-
 	msg := Message{
 		Type:      msgType,
 		Data:      data,
+		ID:        c.newMessageID(),
 		Timestamp: time.Now(),
 	}
 
@@ -122,16 +434,210 @@ func (c *Client) SendMessage(msgType string, data interface{}) error {
 		return fmt.Errorf("failed to marshal message: %v", err)
 	}
 
+	c.mu.RLock()
+	box := c.outbox
+	reliable := c.reliable[msgType]
+	c.mu.RUnlock()
+
+	if reliable && box != nil {
+		if err := box.add(msg.ID, msgBytes); err != nil {
+			log.Warnf("Failed to persist message %s, sending without delivery guarantee: %v", msg.ID, err)
+		} else {
+			if err := c.send(msgBytes); err != nil {
+				log.Debugf("Message %s (%s) queued for redelivery: %v", msg.ID, msgType, err)
+				return nil
+			}
+			log.Debugf("Sent message: %s", msgType)
+			return nil
+		}
+	}
+
 	// 发送消息
-	if err := c.conn.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
-		c.connected = false
-		return fmt.Errorf("failed to send message: %v", err)
+	if err := c.send(msgBytes); err != nil {
+		return err
 	}
 
-	logger.Debugf("Sent message: %s", msgType)
+	log.Debugf("Sent message: %s", msgType)
 	return nil
 }
 
+// send 发送一条消息，启用合并时小消息进入合并窗口
+func (c *Client) send(data []byte) error {
+	c.mu.RLock()
+	batch := c.batch
+	connected := c.connected && c.conn != nil
+	c.mu.RUnlock()
+
+	if batch == nil {
+		return c.write(data)
+	}
+	if !connected {
+		return fmt.Errorf("not connected to server")
+	}
+	if batch.add(data) {
+		return nil
+	}
+
+	// 大消息直接发送，先发出等待中的消息以保证顺序
+	batch.flush()
+	return c.write(data)
+}
+
+// writeBatch 发送一个批次，只有一条消息时直接发送
+func (c *Client) writeBatch(batch []json.RawMessage) {
+	var err error
+	if len(batch) == 1 {
+		err = c.write(batch[0])
+	} else {
+		var data []byte
+		data, err = json.Marshal(Message{
+			Type:      MessageTypeBatch,
+			Data:      batch,
+			Timestamp: time.Now(),
+		})
+		if err == nil {
+			err = c.write(data)
+		}
+	}
+	if err != nil {
+		log.Warnf("Failed to send batch of %d messages: %v", len(batch), err)
+	}
+}
+
+// write 向当前连接写入一条消息，写入失败时断开连接
+func (c *Client) write(data []byte) error {
+	c.mu.RLock()
+	conn := c.conn
+	connected := c.connected
+	c.mu.RUnlock()
+
+	if !connected || conn == nil {
+		return fmt.Errorf("not connected to server")
+	}
+
+	c.writeMu.Lock()
+	err := conn.WriteMessage(websocket.TextMessage, data)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.dropConnection(conn, err)
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	return nil
+}
+
+// newMessageID 生成消息 ID
+func (c *Client) newMessageID() string {
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), atomic.AddUint64(&c.msgSeq, 1))
+}
+
+// handleAck 处理服务器的消息确认，从发送队列中删除对应消息
+func (c *Client) handleAck(msg *Message) {
+	id := msg.ID
+	if data, ok := msg.Data.(map[string]interface{}); ok {
+		if ackID, ok := data["id"].(string); ok && ackID != "" {
+			id = ackID
+		}
+	}
+
+	c.mu.RLock()
+	box := c.outbox
+	c.mu.RUnlock()
+
+	if box != nil && id != "" && box.remove(id) {
+		log.Debugf("Message %s acknowledged", id)
+	}
+}
+
+// sendAck 确认收到服务器消息
+func (c *Client) sendAck(id string) {
+	ack, err := json.Marshal(Message{
+		Type:      MessageTypeAck,
+		Data:      map[string]interface{}{"id": id},
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	if err := c.write(ack); err != nil {
+		log.Debugf("Failed to acknowledge message %s: %v", id, err)
+	}
+}
+
+// Call 发送请求并等待服务器响应，响应消息的 reply_to 为请求 ID
+// 响应由 Receive 读取并分发，调用方需保证有 goroutine 在运行 Receive
+func (c *Client) Call(msgType string, data interface{}, timeout time.Duration) (interface{}, error) {
+	if timeout <= 0 {
+		timeout = DefaultCallTimeout
+	}
+
+	msg := Message{
+		Type:      msgType,
+		Data:      data,
+		ID:        c.newMessageID(),
+		Timestamp: time.Now(),
+	}
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %v", err)
+	}
+
+	reply := make(chan *Message, 1)
+	c.callMu.Lock()
+	c.calls[msg.ID] = reply
+	c.callMu.Unlock()
+	defer func() {
+		c.callMu.Lock()
+		delete(c.calls, msg.ID)
+		c.callMu.Unlock()
+	}()
+
+	// 请求不参与合并，避免增加等待时间
+	if err := c.write(msgBytes); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-reply:
+		if resp.Type == MessageTypeError {
+			return nil, fmt.Errorf("server returned error for %s: %s", msgType, errorText(resp.Data))
+		}
+		return resp.Data, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("call %s timed out after %v", msgType, timeout)
+	case <-c.stopCh:
+		return nil, ErrClientStopped
+	}
+}
+
+// deliverReply 将响应交给等待中的 Call，返回是否有对应的请求
+func (c *Client) deliverReply(msg *Message) bool {
+	c.callMu.Lock()
+	reply, exists := c.calls[msg.ReplyTo]
+	delete(c.calls, msg.ReplyTo)
+	c.callMu.Unlock()
+
+	if !exists {
+		return false
+	}
+	reply <- msg
+	return true
+}
+
+// errorText 提取错误响应中的错误信息
+func errorText(data interface{}) string {
+	if fields, ok := data.(map[string]interface{}); ok {
+		for _, key := range []string{"error", "message"} {
+			if text, ok := fields[key].(string); ok && text != "" {
+				return text
+			}
+		}
+	}
+	return fmt.Sprintf("%v", data)
+}
+
 // SendHeartbeat 发送心跳
 func (c *Client) SendHeartbeat(status interface{}) error {
 	return c.SendMessage("heartbeat", status)
@@ -167,7 +673,7 @@ func (c *Client) HandleMessages(handler func(string, interface{}) error) {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				logger.Errorf("WebSocket connection closed unexpectedly: %v", err)
+				log.Errorf("WebSocket connection closed unexpectedly: %v", err)
 			}
 			c.mu.Lock()
 			c.connected = false
@@ -178,19 +684,72 @@ func (c *Client) HandleMessages(handler func(string, interface{}) error) {
 		// 解析消息
 		var msg Message
 		if err := json.Unmarshal(message, &msg); err != nil {
-			logger.Errorf("Failed to unmarshal message: %v", err)
+			log.Errorf("Failed to unmarshal message: %v", err)
 			continue
 		}
 
-		logger.Debugf("Received message: %s", msg.Type)
+		log.Debugf("Received message: %s", msg.Type)
 
 		// 处理消息
 		if err := handler(msg.Type, msg.Data); err != nil {
-			logger.Errorf("Failed to handle message %s: %v", msg.Type, err)
+			log.Errorf("Failed to handle message %s: %v", msg.Type, err)
 		}
 	}
 }
 
+// Ping 发送 WebSocket ping 控制帧并等待服务器的 pong，返回往返时间。
+// pong 由 Receive 读取连接时处理，调用方需要同时在接收消息
+func (c *Client) Ping(timeout time.Duration) (time.Duration, error) {
+	c.mu.RLock()
+	conn := c.conn
+	connected := c.connected
+	c.mu.RUnlock()
+
+	if !connected || conn == nil {
+		return 0, fmt.Errorf("not connected to server")
+	}
+
+	payload := strconv.FormatUint(atomic.AddUint64(&c.pingSeq, 1), 10)
+	pong := make(chan struct{})
+	c.callMu.Lock()
+	c.pings[payload] = pong
+	c.callMu.Unlock()
+	defer func() {
+		c.callMu.Lock()
+		delete(c.pings, payload)
+		c.callMu.Unlock()
+	}()
+
+	start := time.Now()
+	// WriteControl 可以与其他写操作并发调用
+	if err := conn.WriteControl(websocket.PingMessage, []byte(payload), start.Add(timeout)); err != nil {
+		return 0, fmt.Errorf("failed to send ping: %v", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-pong:
+		return time.Since(start), nil
+	case <-timer.C:
+		return 0, fmt.Errorf("no pong received within %v", timeout)
+	case <-c.stopCh:
+		return 0, ErrClientStopped
+	}
+}
+
+// handlePong 唤醒等待该 pong 的 Ping，未知的 pong 忽略
+func (c *Client) handlePong(appData string) error {
+	c.callMu.Lock()
+	pong, ok := c.pings[appData]
+	delete(c.pings, appData)
+	c.callMu.Unlock()
+	if ok {
+		close(pong)
+	}
+	return nil
+}
+
 // SendPing 发送 ping
 func (c *Client) SendPing() error {
 	c.mu.RLock()
@@ -223,24 +782,54 @@ func (c *Client) SetCloseHandler(handler func(int, string) error) {
 	}
 }
 
-// Receive 接收消息
+// Receive 接收消息，连接断开时自动按退避策略重连并继续读取
+// ack 消息和 Call 的响应在内部处理，带 ID 的消息会自动回复 ack
+// 仅在客户端停止或超过最大重连次数时返回错误
 func (c *Client) Receive() (string, interface{}, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	var cause error
+	for {
+		c.mu.RLock()
+		conn := c.conn
+		stopped := c.stopped
+		c.mu.RUnlock()
 
-	if !c.connected || c.conn == nil {
-		return "", nil, fmt.Errorf("not connected")
-	}
+		if stopped {
+			return "", nil, ErrClientStopped
+		}
+		if conn == nil {
+			if err := c.reconnectLoop(cause); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
 
-	_, message, err := c.conn.ReadMessage()
-	if err != nil {
-		return "", nil, err
-	}
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Warnf("WebSocket connection lost: %v", err)
+			}
+			cause = err
+			c.dropConnection(conn, err)
+			continue
+		}
 
-	var msg Message
-	if err := json.Unmarshal(message, &msg); err != nil {
-		return "", nil, err
-	}
+		var msg Message
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Errorf("Failed to unmarshal message: %v", err)
+			continue
+		}
 
-	return msg.Type, msg.Data, nil
-} 
\ No newline at end of file
+		if msg.Type == MessageTypeAck {
+			c.handleAck(&msg)
+			continue
+		}
+		if msg.ID != "" {
+			c.sendAck(msg.ID)
+		}
+		if msg.ReplyTo != "" && c.deliverReply(&msg) {
+			continue
+		}
+
+		return msg.Type, msg.Data, nil
+	}
+}
@@ -1,9 +1,21 @@
 package websocket
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -174,3 +186,460 @@ func TestMessageStructure(t *testing.T) {
 	assert.Equal(t, "test-id", msg.ID)
 	assert.NotZero(t, msg.Timestamp)
 }
+
+func TestReconnectOptionsDelay(t *testing.T) {
+	opts := ReconnectOptions{InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2}
+	assert.Equal(t, time.Second, opts.Delay(1))
+	assert.Equal(t, 4*time.Second, opts.Delay(3))
+	assert.Equal(t, 10*time.Second, opts.Delay(10))
+
+	// 抖动后的等待时间落在 [delay*(1-jitter), delay] 范围内
+	opts.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := opts.Delay(2)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.LessOrEqual(t, delay, 2*time.Second)
+	}
+}
+
+func TestClientReceiveReconnects(t *testing.T) {
+	// 每个连接发送一条消息后立即断开
+	var connections int32
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+		conn.WriteJSON(Message{Type: "hello", Data: float64(n)})
+		conn.Close()
+	}))
+	defer server.Close()
+
+	client, err := NewClient("ws"+server.URL[4:], "")
+	require.NoError(t, err)
+	client.SetReconnectOptions(ReconnectOptions{InitialDelay: 10 * time.Millisecond, Multiplier: 2})
+
+	var states []ConnectionState
+	client.OnStateChange(func(state ConnectionState, err error) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+	})
+
+	require.NoError(t, client.Connect())
+	defer client.Stop()
+
+	for i := 1; i <= 2; i++ {
+		msgType, data, err := client.Receive()
+		require.NoError(t, err)
+		assert.Equal(t, "hello", msgType)
+		assert.Equal(t, float64(i), data)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []ConnectionState{StateConnected, StateDisconnected, StateReconnecting, StateConnected}, states[:4])
+}
+
+func TestClientReceiveMaxRetries(t *testing.T) {
+	client, err := NewClient("ws://127.0.0.1:1/ws", "")
+	require.NoError(t, err)
+	client.SetReconnectOptions(ReconnectOptions{InitialDelay: time.Millisecond, MaxRetries: 2})
+
+	var failed bool
+	client.OnStateChange(func(state ConnectionState, err error) {
+		if state == StateFailed {
+			failed = true
+		}
+	})
+
+	_, _, err = client.Receive()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "after 2 attempts")
+	assert.True(t, failed)
+}
+
+func TestClientStopUnblocksReceive(t *testing.T) {
+	client, err := NewClient("ws://127.0.0.1:1/ws", "")
+	require.NoError(t, err)
+	client.SetReconnectOptions(ReconnectOptions{InitialDelay: time.Hour})
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.Receive()
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	client.Stop()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, ErrClientStopped, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receive did not return after Stop")
+	}
+	assert.Equal(t, ErrClientStopped, client.Connect())
+}
+
+func TestOutboxPersistence(t *testing.T) {
+	dir := t.TempDir()
+	box, err := newOutbox(dir, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, box.add("a", []byte("1")))
+	require.NoError(t, box.add("b", []byte("2")))
+	require.NoError(t, box.add("c", []byte("3")))
+	// 超出容量时丢弃最旧的消息
+	assert.Equal(t, 2, box.len())
+
+	reopened, err := newOutbox(dir, 2)
+	require.NoError(t, err)
+	pending := reopened.pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, "b", pending[0].id)
+	assert.Equal(t, "c", pending[1].id)
+	assert.Equal(t, []byte("3"), pending[1].data)
+
+	assert.True(t, reopened.remove("b"))
+	assert.False(t, reopened.remove("b"))
+	require.NoError(t, reopened.add("d", []byte("4")))
+	pending = reopened.pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, "d", pending[1].id)
+}
+
+func TestClientOutboxRedelivery(t *testing.T) {
+	received := make(chan Message, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// 确认客户端的结果消息，然后发送一条需要确认的消息
+		var result Message
+		if err := conn.ReadJSON(&result); err != nil {
+			return
+		}
+		received <- result
+		conn.WriteJSON(Message{Type: MessageTypeAck, Data: map[string]interface{}{"id": result.ID}})
+		conn.WriteJSON(Message{Type: "hello", ID: "server-1"})
+
+		var ack Message
+		if err := conn.ReadJSON(&ack); err != nil {
+			return
+		}
+		received <- ack
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	client, err := NewClient("ws"+server.URL[4:], "")
+	require.NoError(t, err)
+	require.NoError(t, client.EnableOutbox(t.TempDir(), 0))
+	defer client.Stop()
+
+	// 断线期间的结果消息写入发送队列，普通消息直接返回错误
+	require.NoError(t, client.SendCommandResult(map[string]interface{}{"command_id": "cmd-1"}))
+	assert.Equal(t, 1, client.PendingMessages())
+	assert.Error(t, client.SendHeartbeat(nil))
+
+	require.NoError(t, client.Connect())
+
+	select {
+	case result := <-received:
+		assert.Equal(t, "command_result", result.Type)
+		assert.NotEmpty(t, result.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued message was not redelivered")
+	}
+
+	msgType, _, err := client.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", msgType)
+	assert.Equal(t, 0, client.PendingMessages())
+
+	select {
+	case ack := <-received:
+		assert.Equal(t, MessageTypeAck, ack.Type)
+		assert.Equal(t, map[string]interface{}{"id": "server-1"}, ack.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not acknowledge server message")
+	}
+}
+
+// writeClientCert 生成自签名客户端证书，返回证书、私钥文件路径和证书
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "agent-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile, cert
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewTLSConfig(TLSOptions{CertFile: "client.crt"})
+	assert.Error(t, err)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+	_, err = NewTLSConfig(TLSOptions{CAFile: caFile, VerifySSL: true})
+	assert.Error(t, err)
+
+	tlsConfig, err := NewTLSConfig(TLSOptions{VerifySSL: false})
+	require.NoError(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+}
+
+func TestClientConnectMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(Message{Type: "hello", Data: r.TLS.PeerCertificates[0].Subject.CommonName})
+		conn.ReadMessage()
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	// 服务器证书由自定义 CA 签发
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	url := "wss" + server.URL[5:]
+
+	// 未提供客户端证书时握手失败
+	client, err := NewClient(url, "")
+	require.NoError(t, err)
+	tlsConfig, err := NewTLSConfig(TLSOptions{CAFile: caFile, VerifySSL: true})
+	require.NoError(t, err)
+	client.SetTLSConfig(tlsConfig)
+	assert.Error(t, client.Connect())
+
+	tlsConfig, err = NewTLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile, CAFile: caFile, VerifySSL: true})
+	require.NoError(t, err)
+	client.SetTLSConfig(tlsConfig)
+	require.NoError(t, client.Connect())
+	defer client.Stop()
+
+	msgType, data, err := client.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", msgType)
+	assert.Equal(t, "agent-test", data)
+}
+
+func TestClientCompressionAndBatching(t *testing.T) {
+	frames := make(chan Message, 4)
+	var extensions string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extensions = r.Header.Get("Sec-Websocket-Extensions")
+		upgrader := websocket.Upgrader{EnableCompression: true}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			frames <- msg
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("ws"+server.URL[4:], "")
+	require.NoError(t, err)
+	client.SetCompression(true)
+	client.SetBatching(50*time.Millisecond, 3)
+	require.NoError(t, client.Connect())
+	defer client.Stop()
+	assert.Contains(t, extensions, "permessage-deflate")
+
+	// 达到数量上限时立即发送一个批次
+	for i := 0; i < 3; i++ {
+		require.NoError(t, client.SendMessage("metric", i))
+	}
+	select {
+	case msg := <-frames:
+		assert.Equal(t, MessageTypeBatch, msg.Type)
+		items, ok := msg.Data.([]interface{})
+		require.True(t, ok)
+		require.Len(t, items, 3)
+		assert.Equal(t, "metric", items[0].(map[string]interface{})["type"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not sent")
+	}
+
+	// 窗口结束后发送剩余的单条消息
+	require.NoError(t, client.SendMessage("metric", 3))
+	select {
+	case msg := <-frames:
+		assert.Equal(t, "metric", msg.Type)
+		assert.Equal(t, float64(3), msg.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch window did not flush")
+	}
+
+	// 大消息不参与合并
+	large := make([]byte, batchMaxMessageSize)
+	for i := range large {
+		large[i] = 'a'
+	}
+	require.NoError(t, client.SendMessage("system_info", string(large)))
+	select {
+	case msg := <-frames:
+		assert.Equal(t, "system_info", msg.Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("large message was not sent")
+	}
+}
+
+func TestClientCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			switch msg.Type {
+			case "fetch_configuration":
+				// 先发送一条无关消息，确认响应不会被普通消息打断
+				conn.WriteJSON(Message{Type: "notice", Data: "unrelated"})
+				conn.WriteJSON(Message{Type: "configuration", ReplyTo: msg.ID, Data: map[string]interface{}{"heartbeat": float64(10)}})
+			case "lookup":
+				conn.WriteJSON(Message{Type: MessageTypeError, ReplyTo: msg.ID, Data: map[string]interface{}{"error": "not found"}})
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("ws"+server.URL[4:], "")
+	require.NoError(t, err)
+	require.NoError(t, client.Connect())
+	defer client.Stop()
+
+	received := make(chan string, 4)
+	go func() {
+		for {
+			msgType, _, err := client.Receive()
+			if err != nil {
+				return
+			}
+			received <- msgType
+		}
+	}()
+
+	data, err := client.Call("fetch_configuration", nil, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"heartbeat": float64(10)}, data)
+	assert.Equal(t, "notice", <-received)
+
+	_, err = client.Call("lookup", map[string]interface{}{"key": "x"}, 5*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+
+	_, err = client.Call("ignored", nil, 50*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.Empty(t, received)
+}
+
+func TestClientPing(t *testing.T) {
+	answer := make(chan bool, 1)
+	answer <- true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// 第一个连接按默认方式回复 pong，之后的连接不响应 ping
+		if !<-answer {
+			conn.SetPingHandler(func(string) error { return nil })
+		}
+		answer <- false
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("ws"+server.URL[4:], "")
+	require.NoError(t, err)
+	client.SetReconnectOptions(ReconnectOptions{InitialDelay: 10 * time.Millisecond, Multiplier: 2})
+	_, err = client.Ping(time.Second)
+	assert.Error(t, err)
+
+	require.NoError(t, client.Connect())
+	defer client.Stop()
+	go func() {
+		for {
+			if _, _, err := client.Receive(); err != nil {
+				return
+			}
+		}
+	}()
+
+	rtt, err := client.Ping(5 * time.Second)
+	require.NoError(t, err)
+	assert.Greater(t, rtt, time.Duration(0))
+
+	// 服务器不响应时超时
+	client.Reconnect(errors.New("test"))
+	assert.Eventually(t, client.IsConnected, 5*time.Second, 10*time.Millisecond)
+	_, err = client.Ping(100 * time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no pong")
+}
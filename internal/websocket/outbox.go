@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"assistant_agent/internal/fsutil"
+)
+
+// DefaultOutboxSize 默认最多缓存的待确认消息数
+const DefaultOutboxSize = 10000
+
+// outboxEntry 待确认的消息
+type outboxEntry struct {
+	seq  int64
+	id   string
+	data []byte
+}
+
+// outbox 持久化的发送队列，消息在收到服务器确认前保存在磁盘上
+// 每条消息保存为 <dir>/<seq>_<id>.json，seq 保证重启后按原顺序重发
+type outbox struct {
+	dir     string
+	maxSize int
+	seq     int64
+	files   map[string]string // 消息 ID -> 文件名
+	mu      sync.Mutex
+}
+
+// newOutbox 打开发送队列目录，加载上次未确认的消息
+func newOutbox(dir string, maxSize int) (*outbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultOutboxSize
+	}
+
+	o := &outbox{
+		dir:     dir,
+		maxSize: maxSize,
+		files:   make(map[string]string),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		seq, id, ok := parseOutboxName(entry.Name())
+		if !ok {
+			continue
+		}
+		o.files[id] = entry.Name()
+		if seq > o.seq {
+			o.seq = seq
+		}
+	}
+
+	return o, nil
+}
+
+// add 保存一条待确认消息，超出容量时丢弃最旧的消息
+func (o *outbox) add(id string, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, exists := o.files[id]; exists {
+		return nil
+	}
+
+	o.seq++
+	name := fmt.Sprintf("%020d_%s.json", o.seq, id)
+	if err := fsutil.WriteFileAtomic(filepath.Join(o.dir, name), data, 0600); err != nil {
+		return err
+	}
+	o.files[id] = name
+
+	for len(o.files) > o.maxSize {
+		oldest := o.oldestLocked()
+		log.Warnf("Outbox full, dropping undelivered message %s", oldest)
+		o.removeLocked(oldest)
+	}
+	return nil
+}
+
+// remove 删除已确认的消息，返回消息是否存在
+func (o *outbox) remove(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.removeLocked(id)
+}
+
+// pending 按保存顺序返回全部待确认消息
+func (o *outbox) pending() []*outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make([]*outboxEntry, 0, len(o.files))
+	for id, name := range o.files {
+		data, err := os.ReadFile(filepath.Join(o.dir, name))
+		if err != nil {
+			log.Warnf("Failed to read outbox message %s: %v", id, err)
+			continue
+		}
+		seq, _, _ := parseOutboxName(name)
+		entries = append(entries, &outboxEntry{seq: seq, id: id, data: data})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+	return entries
+}
+
+// len 返回待确认消息数
+func (o *outbox) len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.files)
+}
+
+// removeLocked 删除消息文件，调用方需持有锁
+func (o *outbox) removeLocked(id string) bool {
+	name, exists := o.files[id]
+	if !exists {
+		return false
+	}
+	if err := os.Remove(filepath.Join(o.dir, name)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Failed to remove outbox message %s: %v", id, err)
+	}
+	delete(o.files, id)
+	return true
+}
+
+// oldestLocked 返回最早保存的消息 ID，调用方需持有锁
+func (o *outbox) oldestLocked() string {
+	var oldestID string
+	var oldestSeq int64
+	for id, name := range o.files {
+		seq, _, _ := parseOutboxName(name)
+		if oldestID == "" || seq < oldestSeq {
+			oldestID, oldestSeq = id, seq
+		}
+	}
+	return oldestID
+}
+
+// parseOutboxName 解析消息文件名中的序号和消息 ID
+func parseOutboxName(name string) (int64, string, bool) {
+	if !strings.HasSuffix(name, ".json") {
+		return 0, "", false
+	}
+	seqPart, id, found := strings.Cut(strings.TrimSuffix(name, ".json"), "_")
+	if !found || id == "" {
+		return 0, "", false
+	}
+	seq, err := strconv.ParseInt(seqPart, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return seq, id, true
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"assistant_agent/internal/agent"
@@ -13,6 +17,11 @@ import (
 )
 
 func main() {
+	// 子命令：加密配置值
+	if len(os.Args) > 1 && os.Args[1] == "encrypt-secret" {
+		os.Exit(encryptSecret(os.Args[2:]))
+	}
+
 	// 初始化配置
 	if err := config.Init(); err != nil {
 		logrus.Fatalf("Failed to initialize config: %v", err)
@@ -36,12 +45,78 @@ func main() {
 		logger.Fatalf("Failed to start agent: %v", err)
 	}
 
-	// 等待中断信号
+	// 配置文件变化后自动重新加载
+	stopWatch, err := config.Watch(func(err error) {
+		logger.Warnf("Failed to reload config: %v", err)
+	})
+	if err != nil {
+		logger.Warnf("Config hot reload disabled: %v", err)
+	} else {
+		defer stopWatch()
+	}
+
+	// 等待中断信号，SIGHUP 重新加载配置，SIGUSR1 重新打开日志文件
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, reopenLogSignals...)...)
+wait:
+	for sig := range sigChan {
+		switch {
+		case sig == syscall.SIGHUP:
+			logger.Info("Received SIGHUP, reloading config")
+			if err := config.Reload(); err != nil {
+				logger.Warnf("Failed to reload config: %v", err)
+			}
+		case isReopenLogSignal(sig):
+			if err := logger.Reopen(); err != nil {
+				logrus.Errorf("Failed to reopen log file: %v", err)
+			}
+		default:
+			break wait
+		}
+	}
 
 	logger.Info("Shutting down Assistant Agent...")
 	a.Stop()
 	logger.Info("Assistant Agent stopped")
-} 
\ No newline at end of file
+} 
+
+// isReopenLogSignal 判断是否为重新打开日志文件的信号
+func isReopenLogSignal(sig os.Signal) bool {
+	for _, reopen := range reopenLogSignals {
+		if sig == reopen {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptSecret 加密一个配置值并输出，未指定值时从标准输入读取一行，避免明文留在 shell 历史中
+func encryptSecret(args []string) int {
+	flags := flag.NewFlagSet("encrypt-secret", flag.ContinueOnError)
+	method := flags.String("method", "enc", "encryption method: enc (machine key) or dpapi (windows)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: assistant_agent encrypt-secret [-method enc|dpapi] [value]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	value := flags.Arg(0)
+	if flags.NArg() == 0 {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintf(os.Stderr, "Failed to read value: %v\n", err)
+			return 1
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+
+	encrypted, err := config.EncryptValue(value, *method)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encrypt value: %v\n", err)
+		return 1
+	}
+	fmt.Println(encrypted)
+	return 0
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenLogSignals 通知重新打开日志文件的信号，与 logrotate 的 postrotate 配合使用
+var reopenLogSignals = []os.Signal{syscall.SIGUSR1}
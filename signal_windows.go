@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reopenLogSignals Windows 没有 SIGUSR1，日志文件由 Agent 自行轮转
+var reopenLogSignals []os.Signal